@@ -18,9 +18,25 @@ func (i *Comment) Position() Position {
 
 type ImportStmt struct {
 	Pos     Position
-	Alias   string
+	Alias   string        // the namespace: import * as alias from "x"
+	Default string        // the default import: import foo from "x"
+	Names   []*ImportName // named imports: import { a, b as c } from "x"
+	All     bool          // export * from "x"
+	Export  bool          // a re-export: export { a } from "x"
 	Path    string
 	AbsPath string
+
+	// the imports that are erased for the compiler are kept to print the
+	// source: "import type { Foo } from" and the members like { type Foo }
+	TypeOnly  bool
+	TypeNames []*ImportName
+}
+
+// ImportName is a member in an import or export list: { name as alias }.
+type ImportName struct {
+	Pos   Position
+	Name  string
+	Alias string
 }
 
 func (i *ImportStmt) Position() Position {
@@ -36,6 +52,12 @@ type File struct {
 	Comments   []*Comment
 	Imports    []*ImportStmt
 	Directives []string
+	Default    string // the name of the default export
+	Types      []Stmt // interfaces, type aliases and declarations for the type checker
+
+	// TypeImports are the imports of types and definition
+	// files. They are ignored by the compiler.
+	TypeImports []*ImportStmt
 }
 
 func (f *File) Import(alias string) *ImportStmt {
@@ -128,6 +150,7 @@ type WhileStmt struct {
 	Pos        Position
 	Expression Expr
 	Body       *BlockStmt
+	Do         bool // do...while: the condition is tested after the body
 
 	label      string
 	continuePC int
@@ -248,8 +271,21 @@ type CallStmt struct {
 
 func (i *CallStmt) stmtNode() {}
 
+type AwaitStmt struct {
+	*AwaitExpr
+}
+
+func (i *AwaitStmt) stmtNode() {}
+
+type YieldStmt struct {
+	*YieldExpr
+}
+
+func (i *YieldStmt) stmtNode() {}
+
 type TailCallStmt struct {
 	*CallExpr
+	Return bool // written as "return f()"
 }
 
 func (i *TailCallStmt) stmtNode() {}
@@ -270,9 +306,13 @@ type ClassDeclStmt struct {
 	Pos        Position
 	Name       string
 	Exported   bool
+	TypeParams []*TypeParam
+	Extends    Expr // the base class or nil
+	Implements []*TypeRef
 	Fields     []*VarDeclStmt
 	Functions  []*FuncDeclStmt
 	Directives []string
+	Decorators []*Decorator
 }
 
 func (c *ClassDeclStmt) Position() Position {
@@ -281,6 +321,13 @@ func (c *ClassDeclStmt) Position() Position {
 func (*ClassDeclStmt) declNode() {}
 func (*ClassDeclStmt) stmtNode() {}
 
+// Decorator is metadata attached to a class or function: @route("/users")
+type Decorator struct {
+	Pos  Position
+	Name string // the name as written: foo or foo.bar
+	Args []Expr
+}
+
 type EnumDeclStmt struct {
 	Pos      Position
 	Name     string
@@ -303,13 +350,21 @@ func (i *EnumDeclStmt) stmtNode() {}
 
 type FuncDeclStmt struct {
 	Pos        Position
+	TypeParams []*TypeParam
 	Args       *Arguments
+	Result     TypeExpr // the return type or nil
 	Variadic   bool
 	Body       *BlockStmt
 	Name       string
 	Exported   bool
 	Anonymous  bool
+	Async      bool
+	Generator  bool
+	Static     bool
+	Getter     bool
+	Setter     bool
 	Directives []string
+	Decorators []*Decorator
 	Comment    *Comment
 
 	// a Object value means that it is a method of that object
@@ -325,9 +380,13 @@ func (i *FuncDeclStmt) stmtNode() {}
 type VarDeclStmt struct {
 	Pos      Position
 	Name     string
+	Pattern  *PatternExpr // set instead of Name if it is a destructuring declaration
+	Type     TypeExpr     // the type annotation or nil
 	Value    Expr
 	Exported bool
 	Const    bool
+	Static   bool // class fields only
+	Readonly bool // class fields only
 }
 
 func (i *VarDeclStmt) Position() Position {
@@ -393,10 +452,14 @@ func (i *ThrowStmt) stmtNode() {}
 
 // FuncDeclExpr is a function as a value expression
 type FuncDeclExpr struct {
-	Pos      Position
-	Args     *Arguments
-	Variadic bool
-	Body     *BlockStmt
+	Pos       Position
+	Args      *Arguments
+	Result    TypeExpr // the return type or nil
+	Variadic  bool
+	Async     bool
+	Generator bool
+	Lambda    bool // written as an arrow function: (a) => a
+	Body      *BlockStmt
 }
 
 func (i *FuncDeclExpr) Position() Position {
@@ -418,8 +481,9 @@ func (i *RegisterExpr) Position() Position {
 func (i *RegisterExpr) exprNode() {}
 
 type IdentExpr struct {
-	Pos  Position
-	Name string
+	Pos      Position
+	Name     string
+	TypeArgs []TypeExpr // the type arguments of a generic call: foo<T>()
 }
 
 func (i *IdentExpr) Position() Position {
@@ -431,6 +495,7 @@ type ConstantExpr struct {
 	Pos   Position
 	Kind  Type
 	Value string
+	Raw   string // the number as written if it is different: 0xFF or 1_000
 }
 
 func (i *ConstantExpr) Position() Position {
@@ -476,7 +541,7 @@ type NewInstanceExpr struct {
 	Lparen Position
 	Args   []Expr
 	Rparen Position
-	Spread bool // if the last argument has a spread operator
+	Spread bool // if any argument has a spread operator
 }
 
 func (i *NewInstanceExpr) Position() Position {
@@ -489,7 +554,7 @@ type CallExpr struct {
 	Lparen   Position
 	Args     []Expr
 	Rparen   Position
-	Spread   bool // if the last argument has a spread operator
+	Spread   bool // if any argument has a spread operator
 	Optional bool // Optional chaining ?.
 	First    bool // if it is the first part of the expression
 }
@@ -499,6 +564,41 @@ func (i *CallExpr) Position() Position {
 }
 func (i *CallExpr) exprNode() {}
 
+// AwaitExpr suspends the current function until the promise X settles.
+type AwaitExpr struct {
+	Pos Position
+	X   Expr
+}
+
+func (i *AwaitExpr) Position() Position {
+	return i.Pos
+}
+func (i *AwaitExpr) exprNode() {}
+
+// YieldExpr suspends a generator returning X. With Delegate
+// it yields all the values of X ("yield* X").
+type YieldExpr struct {
+	Pos      Position
+	X        Expr // nil if there is no value
+	Delegate bool
+}
+
+func (i *YieldExpr) Position() Position {
+	return i.Pos
+}
+func (i *YieldExpr) exprNode() {}
+
+// AsExpr is a type assertion: X as Type. It has no effect at runtime.
+type AsExpr struct {
+	X    Expr
+	Type TypeExpr
+}
+
+func (i *AsExpr) Position() Position {
+	return i.X.Position()
+}
+func (i *AsExpr) exprNode() {}
+
 type TypeofExpr struct {
 	Expr Expr
 }
@@ -540,6 +640,18 @@ type KeyValue struct {
 	Value   Expr
 }
 
+// SpreadExpr is ...X in array and map literals and call arguments.
+// In a map literal it is the value of a KeyValue without key.
+type SpreadExpr struct {
+	Pos Position
+	X   Expr
+}
+
+func (i *SpreadExpr) Position() Position {
+	return i.Pos
+}
+func (i *SpreadExpr) exprNode() {}
+
 type MapDeclExpr struct {
 	Pos  Position
 	List []KeyValue
@@ -560,6 +672,41 @@ func (i *ArrayDeclExpr) Position() Position {
 }
 func (i *ArrayDeclExpr) exprNode() {}
 
+// TemplateExpr is a template literal: `a${b}c`. Strings has always
+// one element more than Values.
+type TemplateExpr struct {
+	Pos     Position
+	Tag     Expr // the function of a tagged template: tag`a${b}c`
+	Strings []string
+	Values  []Expr
+}
+
+func (i *TemplateExpr) Position() Position {
+	return i.Pos
+}
+func (i *TemplateExpr) exprNode() {}
+
+// PatternExpr is a destructuring pattern: [a, b] or { a, b: c }
+type PatternExpr struct {
+	Pos      Position
+	IsObject bool
+	Elements []*PatternElement
+}
+
+func (i *PatternExpr) Position() Position {
+	return i.Pos
+}
+func (i *PatternExpr) exprNode() {}
+
+// PatternElement is each of the elements of a destructuring pattern.
+type PatternElement struct {
+	Pos     Position
+	Key     string // the property name in object patterns
+	Target  Expr   // nil for holes in array patterns: [, b]
+	Default Expr
+	Rest    bool
+}
+
 type Node interface {
 	Position() Position
 }
@@ -601,5 +748,194 @@ type Arguments struct {
 type Field struct {
 	Pos      Position
 	Name     string
+	Pattern  *PatternExpr // set instead of Name if it is a destructuring parameter
 	Optional bool
+	Default  Expr     // the default value or nil
+	Type     TypeExpr // the type annotation or nil
+}
+
+// TypeExpr is a type annotation. The compiler ignores them,
+// they are only used by the type checker.
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// TypeRef is a reference to a named type: string, Foo, io.File or Array<T>.
+type TypeRef struct {
+	Pos  Position
+	Name string
+	Args []TypeExpr
+
+	// Syntax is the source of the types that are checked as other type,
+	// like keyof T that is checked as a string.
+	Syntax string
+}
+
+func (i *TypeRef) Position() Position {
+	return i.Pos
+}
+func (i *TypeRef) typeNode() {}
+
+// LiteralType is a literal used as a type: "GET", 1, true or null.
+type LiteralType struct {
+	Pos   Position
+	Kind  Type
+	Value string
+}
+
+func (i *LiteralType) Position() Position {
+	return i.Pos
+}
+func (i *LiteralType) typeNode() {}
+
+// ArrayType is T[]
+type ArrayType struct {
+	Pos  Position
+	Elem TypeExpr
+}
+
+func (i *ArrayType) Position() Position {
+	return i.Pos
+}
+func (i *ArrayType) typeNode() {}
+
+// TupleType is [A, B]
+type TupleType struct {
+	Pos   Position
+	Elems []TypeExpr
+}
+
+func (i *TupleType) Position() Position {
+	return i.Pos
+}
+func (i *TupleType) typeNode() {}
+
+// UnionType is A | B
+type UnionType struct {
+	Pos   Position
+	Types []TypeExpr
+}
+
+func (i *UnionType) Position() Position {
+	return i.Pos
+}
+func (i *UnionType) typeNode() {}
+
+// IntersectionType is A & B
+type IntersectionType struct {
+	Pos   Position
+	Types []TypeExpr
+}
+
+func (i *IntersectionType) Position() Position {
+	return i.Pos
+}
+func (i *IntersectionType) typeNode() {}
+
+// FuncType is a function signature: <T>(a: T, ...b: T[]) => T
+type FuncType struct {
+	Pos        Position
+	TypeParams []*TypeParam
+	Params     []*Field
+	Variadic   bool
+	Result     TypeExpr
+	New        bool // a constructor type: new () => T
+}
+
+func (i *FuncType) Position() Position {
+	return i.Pos
+}
+func (i *FuncType) typeNode() {}
+
+// ObjectType is the body of an interface or an object literal type.
+type ObjectType struct {
+	Pos     Position
+	Members []*TypeMember
+}
+
+func (i *ObjectType) Position() Position {
+	return i.Pos
+}
+func (i *ObjectType) typeNode() {}
+
+// TypeMember is a property, a method or an index signature of an ObjectType.
+// Call signatures have no name and construct signatures are named "new".
+type TypeMember struct {
+	Pos      Position
+	Name     string
+	Type     TypeExpr
+	KeyType  TypeExpr // set in index signatures: [key: string]: T
+	Optional bool
+	Readonly bool
+	Method   bool // Type is a *FuncType
+	Static   bool // in declared classes
+}
+
+// TypeParam is a generic parameter: T extends Foo = Bar
+type TypeParam struct {
+	Pos        Position
+	Name       string
+	Constraint TypeExpr
+	Default    TypeExpr
+}
+
+// InterfaceDeclStmt declares an interface. Class is true for
+// classes declared in definition files: declare class Foo {}
+type InterfaceDeclStmt struct {
+	Pos        Position
+	Name       string
+	TypeParams []*TypeParam
+	Extends    []*TypeRef
+	Body       *ObjectType
+	Exported   bool
+	Class      bool
+}
+
+func (i *InterfaceDeclStmt) Position() Position {
+	return i.Pos
+}
+func (i *InterfaceDeclStmt) declNode() {}
+func (i *InterfaceDeclStmt) stmtNode() {}
+
+// TypeAliasStmt is a type declaration: type Foo = "a" | "b"
+type TypeAliasStmt struct {
+	Pos        Position
+	Name       string
+	TypeParams []*TypeParam
+	Type       TypeExpr
+	Exported   bool
+}
+
+func (i *TypeAliasStmt) Position() Position {
+	return i.Pos
+}
+func (i *TypeAliasStmt) declNode() {}
+func (i *TypeAliasStmt) stmtNode() {}
+
+// DeclareStmt declares the type of a value in a definition file:
+// declare function foo(): void or declare const foo: number
+type DeclareStmt struct {
+	Pos  Position
+	Name string
+	Type TypeExpr
+}
+
+func (i *DeclareStmt) Position() Position {
+	return i.Pos
+}
+func (i *DeclareStmt) declNode() {}
+func (i *DeclareStmt) stmtNode() {}
+
+// NamespaceDecl is a namespace in a definition file: declare namespace foo {}
+type NamespaceDecl struct {
+	Pos   Position
+	Name  string
+	Decls []Stmt
+}
+
+func (i *NamespaceDecl) Position() Position {
+	return i.Pos
 }
+func (i *NamespaceDecl) declNode() {}
+func (i *NamespaceDecl) stmtNode() {}
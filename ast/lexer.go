@@ -12,42 +12,48 @@ import (
 )
 
 var reservedWords = map[string]Type{
-	"if":        IF,
-	"else":      ELSE,
-	"for":       FOR,
-	"while":     WHILE,
-	"break":     BREAK,
-	"continue":  CONTINUE,
-	"return":    RETURN,
-	"true":      TRUE,
-	"false":     FALSE,
-	"import":    IMPORT,
-	"export":    EXPORT,
-	"function":  FUNCTION,
-	"interface": INTERFACE,
-	"var":       VAR,
-	"let":       LET,
-	"const":     CONST,
-	"enum":      ENUM,
-	"switch":    SWITCH,
-	"case":      CASE,
-	"default":   DEFAULT,
-	"null":      NULL,
-	"undefined": UNDEFINED,
-	"try":       TRY,
-	"catch":     CATCH,
-	"throw":     THROW,
-	"finally":   FINALLY,
-	"new":       NEW,
-	"class":     CLASS,
-	"delete":    DELETE,
-	"typeof":    TYPEOF,
+	"if":         IF,
+	"else":       ELSE,
+	"for":        FOR,
+	"while":      WHILE,
+	"break":      BREAK,
+	"continue":   CONTINUE,
+	"return":     RETURN,
+	"true":       TRUE,
+	"false":      FALSE,
+	"import":     IMPORT,
+	"export":     EXPORT,
+	"function":   FUNCTION,
+	"interface":  INTERFACE,
+	"var":        VAR,
+	"let":        LET,
+	"const":      CONST,
+	"enum":       ENUM,
+	"switch":     SWITCH,
+	"case":       CASE,
+	"default":    DEFAULT,
+	"null":       NULL,
+	"undefined":  UNDEFINED,
+	"try":        TRY,
+	"catch":      CATCH,
+	"throw":      THROW,
+	"finally":    FINALLY,
+	"new":        NEW,
+	"class":      CLASS,
+	"delete":     DELETE,
+	"typeof":     TYPEOF,
+	"instanceof": INSTANCEOF,
+	"in":         IN,
+	"do":         DO,
+	"await":      AWAIT,
+	"yield":      YIELD,
 }
 
 type Token struct {
 	Type Type
 	Str  string
 	Pos  Position
+	Raw  string // numbers with separators as written: 1_000
 }
 
 func (t Token) String() string {
@@ -71,6 +77,11 @@ const (
 	FLOAT  // 123.45
 	RUNE   // 'a'
 	STRING // "abc"
+	REGEX  // /ab+c/i
+
+	// the string parts of a template literal. For example `a${b}c`
+	// is BACKTICK TEMPLATE DOLLAR_LBRACE IDENT RBRACE TEMPLATE BACKTICK
+	TEMPLATE
 
 	// Operators and delimiters
 	ADD // +
@@ -78,13 +89,15 @@ const (
 	MUL // *
 	DIV // /
 	MOD // %
+	POW // **
 
-	AND // &
-	BOR // | binary or
-	XOR // ^
-	LSH // << left shift
-	RSH // >> right shift
-	BNT // ~ bitwise not
+	AND  // &
+	BOR  // | binary or
+	XOR  // ^
+	LSH  // << left shift
+	RSH  // >> right shift
+	URSH // >>> unsigned right shift
+	BNT  // ~ bitwise not
 
 	QUESTION // ?
 
@@ -96,6 +109,10 @@ const (
 	BOR_ASSIGN // |=
 	MOD_ASSIGN // %=
 
+	LAND_ASSIGN // &&=
+	LOR_ASSIGN  // ||=
+	NOR_ASSIGN  // ??=
+
 	LAND // &&
 	LOR  // ||
 	NOR  // ??
@@ -125,6 +142,10 @@ const (
 	RBRACE    // }
 	SEMICOLON // ;
 	COLON     // :
+	BACKTICK  // `
+	AT        // @
+
+	DOLLAR_LBRACE // ${
 
 	DECL   // :=
 	LAMBDA // =>
@@ -136,6 +157,7 @@ const (
 	ELSE
 	FOR
 	WHILE
+	DO
 	RETURN
 	IMPORT
 	SWITCH
@@ -164,7 +186,11 @@ const (
 	THROW
 
 	TYPEOF
+	INSTANCEOF
+	IN
 	DELETE
+	AWAIT
+	YIELD
 )
 
 const (
@@ -205,6 +231,12 @@ type Lexer struct {
 	Pos    Position
 	reader *bufio.Reader
 	Tokens []*Token
+
+	// the braces depth of each open template substitution: `${ ... }`
+	templates []int
+
+	// if the next token is the string part of a template
+	inTemplate bool
 }
 
 func New(reader io.Reader, fileName string) *Lexer {
@@ -237,6 +269,13 @@ func (l *Lexer) Run() error {
 	for {
 		token := &Token{}
 
+		if l.inTemplate {
+			if err := l.readTemplate(token); err != nil {
+				return err
+			}
+			continue
+		}
+
 		l.skipWhiteSpace()
 		c := l.next()
 		if c == byte(EOF) {
@@ -289,12 +328,9 @@ func (l *Lexer) Run() error {
 					return err
 				}
 			case '`':
-				token.Type = STRING
-				err := l.readMultilineString(c, &buf)
-				token.Str = buf.String()
-				if err != nil {
-					return err
-				}
+				token.Type = BACKTICK
+				token.Str = string(c)
+				l.inTemplate = true
 			case '+':
 				if l.peek() == '+' {
 					token.Type = INC
@@ -326,6 +362,10 @@ func (l *Lexer) Run() error {
 					token.Type = MUL_ASSIGN
 					token.Str = "*="
 					l.next()
+				} else if l.peek() == '*' {
+					token.Type = POW
+					token.Str = "**"
+					l.next()
 				} else {
 					token.Type = MUL
 					token.Str = string(c)
@@ -349,12 +389,19 @@ func (l *Lexer) Run() error {
 					token.Str = string(c)
 				}
 			case '/':
-				switch l.peek() {
-				case '=':
+				switch n := l.peek(); {
+				case n != '/' && n != '*' && l.regexAllowed():
+					token.Type = REGEX
+					err := l.readRegex(&buf)
+					token.Str = buf.String()
+					if err != nil {
+						return err
+					}
+				case n == '=':
 					token.Type = DIV_ASSIGN
 					token.Str = "/="
 					l.next()
-				case '/':
+				case n == '/':
 					err := l.readComment(&buf)
 					str := buf.String()
 
@@ -370,7 +417,7 @@ func (l *Lexer) Run() error {
 					if err != nil {
 						return err
 					}
-				case '*':
+				case n == '*':
 					err := l.readMultilineComment(&buf)
 					token.Type = MULTILINE_COMMENT
 					token.Str = buf.String()
@@ -419,9 +466,15 @@ func (l *Lexer) Run() error {
 					token.Str = ">="
 					l.next()
 				} else if l.peek() == '>' {
-					token.Type = RSH
-					token.Str = string(c)
 					l.next()
+					if l.peek() == '>' {
+						token.Type = URSH
+						token.Str = ">>>"
+						l.next()
+					} else {
+						token.Type = RSH
+						token.Str = string(c)
+					}
 				} else {
 					token.Type = GTR
 					token.Str = string(c)
@@ -443,18 +496,30 @@ func (l *Lexer) Run() error {
 				}
 			case '&':
 				if l.peek() == '&' {
-					token.Type = LAND
-					token.Str = "&&"
 					l.next()
+					if l.peek() == '=' {
+						token.Type = LAND_ASSIGN
+						token.Str = "&&="
+						l.next()
+					} else {
+						token.Type = LAND
+						token.Str = "&&"
+					}
 				} else {
 					token.Type = AND
 					token.Str = string(c)
 				}
 			case '|':
 				if l.peek() == '|' {
-					token.Type = LOR
-					token.Str = "||"
 					l.next()
+					if l.peek() == '=' {
+						token.Type = LOR_ASSIGN
+						token.Str = "||="
+						l.next()
+					} else {
+						token.Type = LOR
+						token.Str = "||"
+					}
 				} else if l.peek() == '=' {
 					token.Type = BOR_ASSIGN
 					token.Str = string(c)
@@ -465,9 +530,15 @@ func (l *Lexer) Run() error {
 				}
 			case '?':
 				if l.peek() == '?' {
-					token.Type = NOR
-					token.Str = "??"
 					l.next()
+					if l.peek() == '=' {
+						token.Type = NOR_ASSIGN
+						token.Str = "??="
+						l.next()
+					} else {
+						token.Type = NOR
+						token.Str = "??"
+					}
 				} else {
 					token.Type = QUESTION
 					token.Str = string(c)
@@ -475,6 +546,9 @@ func (l *Lexer) Run() error {
 			case '~':
 				token.Type = BNT
 				token.Str = string(c)
+			case '@':
+				token.Type = AT
+				token.Str = string(c)
 			case '(':
 				token.Type = LPAREN
 				token.Str = string(c)
@@ -484,9 +558,21 @@ func (l *Lexer) Run() error {
 			case '{':
 				token.Type = LBRACE
 				token.Str = string(c)
+				if n := len(l.templates); n > 0 {
+					l.templates[n-1]++
+				}
 			case '}':
 				token.Type = RBRACE
 				token.Str = string(c)
+				if n := len(l.templates); n > 0 {
+					if l.templates[n-1] == 0 {
+						// the end of a template substitution
+						l.templates = l.templates[:n-1]
+						l.inTemplate = true
+					} else {
+						l.templates[n-1]--
+					}
+				}
 			case '[':
 				token.Type = LBRACK
 				token.Str = string(c)
@@ -528,8 +614,10 @@ func (l *Lexer) readNumber(c byte, buf *bytes.Buffer, token *Token) error {
 		return nil
 	}
 
+	var raw bytes.Buffer
+
 	token.Type = INT
-	err := l.readDecimal(c, buf)
+	err := l.readDecimal(c, buf, &raw)
 	token.Str = buf.String()
 	if err != nil {
 		return err
@@ -537,37 +625,154 @@ func (l *Lexer) readNumber(c byte, buf *bytes.Buffer, token *Token) error {
 	c = l.peek()
 	if c == '.' {
 		buf.WriteByte(c)
+		raw.WriteByte(c)
 		l.next()
 		c = l.next()
 		if !isDecimal(c) {
 			return l.error(buf.String(), "Invalid number")
 		}
 		token.Type = FLOAT
-		err = l.readDecimal(c, buf)
+		err = l.readDecimal(c, buf, &raw)
 		token.Str = buf.String()
 		if err != nil {
 			return err
 		}
 	}
+
+	if raw.Len() != buf.Len() {
+		token.Raw = raw.String()
+	}
 	return nil
 }
 
+// regexAllowed returns true if a slash starts a regular expression
+// instead of a division: it can't follow a value.
+func (l *Lexer) regexAllowed() bool {
+	for i := len(l.Tokens) - 1; i >= 0; i-- {
+		switch l.Tokens[i].Type {
+		case COMMENT, MULTILINE_COMMENT:
+			continue
+		case IDENT, INT, HEX, FLOAT, RUNE, STRING, REGEX, BACKTICK,
+			RPAREN, RBRACK, RBRACE, INC, DEC, NULL, UNDEFINED, TRUE, FALSE:
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+// readRegex reads a regular expression literal. The opening slash is already
+// read and the result is the literal as written: /pattern/flags
+func (l *Lexer) readRegex(b *bytes.Buffer) error {
+	b.WriteByte('/')
+
+	var inClass bool
+	for {
+		c := l.next()
+		switch c {
+		case '\n', '\r', byte(EOF):
+			return l.error(b.String(), "unterminated regular expression")
+		case '\\':
+			b.WriteByte(c)
+			c = l.next()
+			if c == '\n' || c == '\r' || c == byte(EOF) {
+				return l.error(b.String(), "unterminated regular expression")
+			}
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				b.WriteByte(c)
+				for isIdent(l.peek(), 1) {
+					b.WriteByte(l.next())
+				}
+				return nil
+			}
+		}
+		b.WriteByte(c)
+	}
+}
+
 func (l *Lexer) addToken(t *Token) {
 	t.Pos = l.Pos
 	t.Pos.Column-- // base 0 for consistency with line nums
 	l.Tokens = append(l.Tokens, t)
 }
 
-func (l *Lexer) readMultilineString(quote byte, b *bytes.Buffer) error {
-	c := l.next()
-	for c != quote {
-		if c == byte(EOF) {
+// readTemplate reads the string part of a template literal until the
+// closing backtick or the start of a substitution. The opening backtick
+// or the closing brace of the previous substitution is already read.
+//
+// Templates without substitutions are lexed as a single STRING unless
+// they are tagged: tag`foo`
+func (l *Lexer) readTemplate(token *Token) error {
+	l.inTemplate = false
+
+	var b bytes.Buffer
+
+	for {
+		c := l.next()
+		switch c {
+		case byte(EOF):
 			return l.error(b.String(), "unterminated multiline string")
+
+		case '\\':
+			// allow to escape the backtick and the substitutions
+			switch l.peek() {
+			case '`', '$':
+				c = l.next()
+			}
+			b.WriteByte(c)
+
+		case '$':
+			if l.peek() != '{' {
+				b.WriteByte(c)
+				continue
+			}
+			l.next()
+
+			token.Type = TEMPLATE
+			token.Str = b.String()
+			l.addToken(token)
+			l.addToken(&Token{Type: DOLLAR_LBRACE, Str: "${"})
+			l.templates = append(l.templates, 0)
+			return nil
+
+		case '`':
+			n := len(l.Tokens)
+			if n > 0 && l.Tokens[n-1].Type == BACKTICK && !l.isTagged(n-1) {
+				// a simple multiline string
+				l.Tokens[n-1].Type = STRING
+				l.Tokens[n-1].Str = b.String()
+				return nil
+			}
+
+			token.Type = TEMPLATE
+			token.Str = b.String()
+			l.addToken(token)
+			l.addToken(&Token{Type: BACKTICK, Str: "`"})
+			return nil
+
+		default:
+			b.WriteByte(c)
 		}
-		b.WriteByte(c)
-		c = l.next()
 	}
-	return nil
+}
+
+// isTagged returns true if the backtick at index i follows
+// an expression like tag`foo` or obj.tag`foo`.
+func (l *Lexer) isTagged(i int) bool {
+	if i == 0 {
+		return false
+	}
+
+	switch l.Tokens[i-1].Type {
+	case IDENT, RPAREN, RBRACK:
+		return true
+	}
+	return false
 }
 
 func (l *Lexer) readString(quote byte, b *bytes.Buffer) error {
@@ -697,19 +902,24 @@ func (l *Lexer) readHexadecimal(b *bytes.Buffer) error {
 	return nil
 }
 
-func (l *Lexer) readDecimal(c byte, b *bytes.Buffer) error {
+// readDecimal reads the digits in b. The separators are
+// ignored but they are kept in raw as written.
+func (l *Lexer) readDecimal(c byte, b, raw *bytes.Buffer) error {
 	b.WriteByte(c)
+	raw.WriteByte(c)
 	for {
 		p := l.peek()
 
 		if p == '_' {
 			// ignore as separator
-			l.next()
+			raw.WriteByte(l.next())
 			continue
 		}
 
 		if isDecimal(p) {
-			b.WriteByte(l.next())
+			c := l.next()
+			b.WriteByte(c)
+			raw.WriteByte(c)
 			continue
 		}
 
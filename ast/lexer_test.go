@@ -17,6 +17,14 @@ func TestLex(t *testing.T) {
 		{"|= 0xFF", []Type{BOR_ASSIGN, HEX}},
 		{"<< 0xFF", []Type{LSH, HEX}},
 		{">> 0xFF", []Type{RSH, HEX}},
+		{">>> 0xFF", []Type{URSH, HEX}},
+		{"a ** 2", []Type{IDENT, POW, INT}},
+		{"a &&= b ||= c ??= d", []Type{IDENT, LAND_ASSIGN, IDENT, LOR_ASSIGN, IDENT, NOR_ASSIGN, IDENT}},
+		{"a instanceof B", []Type{IDENT, INSTANCEOF, IDENT}},
+		{"a / b / 2", []Type{IDENT, DIV, IDENT, DIV, INT}},
+		{"(a) / 2", []Type{LPAREN, IDENT, RPAREN, DIV, INT}},
+		{"x = /a[/]b\\//gi.test(s)", []Type{IDENT, ASSIGN, REGEX, PERIOD, IDENT, LPAREN, IDENT, RPAREN}},
+		{"return /=/", []Type{RETURN, REGEX}},
 		{"~a", []Type{BNT, IDENT}},
 		{"-1", []Type{SUB, INT}},
 		{"-1 // foo", []Type{SUB, INT, COMMENT}},
@@ -30,6 +38,10 @@ func TestLex(t *testing.T) {
 		{"i := 1 + b", []Type{IDENT, DECL, INT, ADD, IDENT}},
 		{"\"bar \\n  foo\"", []Type{STRING}},
 		{"`xxxxx \n  qqqqq`", []Type{STRING}},
+		{"`a${b}c`", []Type{BACKTICK, TEMPLATE, DOLLAR_LBRACE, IDENT, RBRACE, TEMPLATE, BACKTICK}},
+		{"`${ {a: `${b}`} }`", []Type{BACKTICK, TEMPLATE, DOLLAR_LBRACE, LBRACE, IDENT, COLON,
+			BACKTICK, TEMPLATE, DOLLAR_LBRACE, IDENT, RBRACE, TEMPLATE, BACKTICK, RBRACE, RBRACE, TEMPLATE, BACKTICK}},
+		{"tag`a`", []Type{IDENT, BACKTICK, TEMPLATE, BACKTICK}},
 		{"// [foo]", []Type{DIRECTIVE}},
 		{`a := 0 // bla bla bla
 		  // this is a comment
@@ -49,6 +61,17 @@ func TestLex(t *testing.T) {
 	}
 }
 
+func TestLexRegex(t *testing.T) {
+	l := New(strings.NewReader(`f(/a\/[/]b/gi, 2)`), "")
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if k := l.Tokens[2]; k.Type != REGEX || k.Str != `/a\/[/]b/gi` {
+		t.Fatal(k)
+	}
+}
+
 func TestLexQuotes(t *testing.T) {
 	s := `"\""`
 	l := New(strings.NewReader(s), "")
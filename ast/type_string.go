@@ -19,85 +19,102 @@ func _() {
 	_ = x[FLOAT-8]
 	_ = x[RUNE-9]
 	_ = x[STRING-10]
-	_ = x[ADD-11]
-	_ = x[SUB-12]
-	_ = x[MUL-13]
-	_ = x[DIV-14]
-	_ = x[MOD-15]
-	_ = x[AND-16]
-	_ = x[BOR-17]
-	_ = x[XOR-18]
-	_ = x[LSH-19]
-	_ = x[RSH-20]
-	_ = x[BNT-21]
-	_ = x[QUESTION-22]
-	_ = x[ADD_ASSIGN-23]
-	_ = x[SUB_ASSIGN-24]
-	_ = x[MUL_ASSIGN-25]
-	_ = x[DIV_ASSIGN-26]
-	_ = x[XOR_ASSIGN-27]
-	_ = x[BOR_ASSIGN-28]
-	_ = x[MOD_ASSIGN-29]
-	_ = x[LAND-30]
-	_ = x[LOR-31]
-	_ = x[NOR-32]
-	_ = x[INC-33]
-	_ = x[DEC-34]
-	_ = x[EQL-35]
-	_ = x[SEQ-36]
-	_ = x[NEQ-37]
-	_ = x[SNE-38]
-	_ = x[LSS-39]
-	_ = x[GTR-40]
-	_ = x[ASSIGN-41]
-	_ = x[NOT-42]
-	_ = x[LEQ-43]
-	_ = x[GEQ-44]
-	_ = x[LPAREN-45]
-	_ = x[LBRACK-46]
-	_ = x[LBRACE-47]
-	_ = x[COMMA-48]
-	_ = x[PERIOD-49]
-	_ = x[RPAREN-50]
-	_ = x[RBRACK-51]
-	_ = x[RBRACE-52]
-	_ = x[SEMICOLON-53]
-	_ = x[COLON-54]
-	_ = x[DECL-55]
-	_ = x[LAMBDA-56]
-	_ = x[BREAK-57]
-	_ = x[CONTINUE-58]
-	_ = x[IF-59]
-	_ = x[ELSE-60]
-	_ = x[FOR-61]
-	_ = x[WHILE-62]
-	_ = x[RETURN-63]
-	_ = x[IMPORT-64]
-	_ = x[SWITCH-65]
-	_ = x[CASE-66]
-	_ = x[DEFAULT-67]
-	_ = x[LET-68]
-	_ = x[VAR-69]
-	_ = x[CONST-70]
-	_ = x[FUNCTION-71]
-	_ = x[ENUM-72]
-	_ = x[NULL-73]
-	_ = x[UNDEFINED-74]
-	_ = x[INTERFACE-75]
-	_ = x[EXPORT-76]
-	_ = x[NEW-77]
-	_ = x[CLASS-78]
-	_ = x[TRUE-79]
-	_ = x[FALSE-80]
-	_ = x[TRY-81]
-	_ = x[CATCH-82]
-	_ = x[FINALLY-83]
-	_ = x[THROW-84]
+	_ = x[REGEX-11]
+	_ = x[TEMPLATE-12]
+	_ = x[ADD-13]
+	_ = x[SUB-14]
+	_ = x[MUL-15]
+	_ = x[DIV-16]
+	_ = x[MOD-17]
+	_ = x[POW-18]
+	_ = x[AND-19]
+	_ = x[BOR-20]
+	_ = x[XOR-21]
+	_ = x[LSH-22]
+	_ = x[RSH-23]
+	_ = x[URSH-24]
+	_ = x[BNT-25]
+	_ = x[QUESTION-26]
+	_ = x[ADD_ASSIGN-27]
+	_ = x[SUB_ASSIGN-28]
+	_ = x[MUL_ASSIGN-29]
+	_ = x[DIV_ASSIGN-30]
+	_ = x[XOR_ASSIGN-31]
+	_ = x[BOR_ASSIGN-32]
+	_ = x[MOD_ASSIGN-33]
+	_ = x[LAND_ASSIGN-34]
+	_ = x[LOR_ASSIGN-35]
+	_ = x[NOR_ASSIGN-36]
+	_ = x[LAND-37]
+	_ = x[LOR-38]
+	_ = x[NOR-39]
+	_ = x[INC-40]
+	_ = x[DEC-41]
+	_ = x[EQL-42]
+	_ = x[SEQ-43]
+	_ = x[NEQ-44]
+	_ = x[SNE-45]
+	_ = x[LSS-46]
+	_ = x[GTR-47]
+	_ = x[ASSIGN-48]
+	_ = x[NOT-49]
+	_ = x[LEQ-50]
+	_ = x[GEQ-51]
+	_ = x[LPAREN-52]
+	_ = x[LBRACK-53]
+	_ = x[LBRACE-54]
+	_ = x[COMMA-55]
+	_ = x[PERIOD-56]
+	_ = x[RPAREN-57]
+	_ = x[RBRACK-58]
+	_ = x[RBRACE-59]
+	_ = x[SEMICOLON-60]
+	_ = x[COLON-61]
+	_ = x[BACKTICK-62]
+	_ = x[AT-63]
+	_ = x[DOLLAR_LBRACE-64]
+	_ = x[DECL-65]
+	_ = x[LAMBDA-66]
+	_ = x[BREAK-67]
+	_ = x[CONTINUE-68]
+	_ = x[IF-69]
+	_ = x[ELSE-70]
+	_ = x[FOR-71]
+	_ = x[WHILE-72]
+	_ = x[DO-73]
+	_ = x[RETURN-74]
+	_ = x[IMPORT-75]
+	_ = x[SWITCH-76]
+	_ = x[CASE-77]
+	_ = x[DEFAULT-78]
+	_ = x[LET-79]
+	_ = x[VAR-80]
+	_ = x[CONST-81]
+	_ = x[FUNCTION-82]
+	_ = x[ENUM-83]
+	_ = x[NULL-84]
+	_ = x[UNDEFINED-85]
+	_ = x[INTERFACE-86]
+	_ = x[EXPORT-87]
+	_ = x[NEW-88]
+	_ = x[CLASS-89]
+	_ = x[TRUE-90]
+	_ = x[FALSE-91]
+	_ = x[TRY-92]
+	_ = x[CATCH-93]
+	_ = x[FINALLY-94]
+	_ = x[THROW-95]
+	_ = x[TYPEOF-96]
+	_ = x[INSTANCEOF-97]
+	_ = x[IN-98]
+	_ = x[DELETE-99]
+	_ = x[AWAIT-100]
+	_ = x[YIELD-101]
 }
 
-const _Type_name = "ERROREOFCOMMENTMULTILINE_COMMENTDIRECTIVEIDENTINTHEXFLOATRUNESTRINGADDSUBMULDIVMODANDBORXORLSHRSHBNTQUESTIONADD_ASSIGNSUB_ASSIGNMUL_ASSIGNDIV_ASSIGNXOR_ASSIGNBOR_ASSIGNMOD_ASSIGNLANDLORNORINCDECEQLSEQNEQSNELSSGTRASSIGNNOTLEQGEQLPARENLBRACKLBRACECOMMAPERIODRPARENRBRACKRBRACESEMICOLONCOLONDECLLAMBDABREAKCONTINUEIFELSEFORWHILERETURNIMPORTSWITCHCASEDEFAULTLETVARCONSTFUNCTIONENUMNULLUNDEFINEDINTERFACEEXPORTNEWCLASSTRUEFALSETRYCATCHFINALLYTHROW"
+const _Type_name = "ERROREOFCOMMENTMULTILINE_COMMENTDIRECTIVEIDENTINTHEXFLOATRUNESTRINGREGEXTEMPLATEADDSUBMULDIVMODPOWANDBORXORLSHRSHURSHBNTQUESTIONADD_ASSIGNSUB_ASSIGNMUL_ASSIGNDIV_ASSIGNXOR_ASSIGNBOR_ASSIGNMOD_ASSIGNLAND_ASSIGNLOR_ASSIGNNOR_ASSIGNLANDLORNORINCDECEQLSEQNEQSNELSSGTRASSIGNNOTLEQGEQLPARENLBRACKLBRACECOMMAPERIODRPARENRBRACKRBRACESEMICOLONCOLONBACKTICKATDOLLAR_LBRACEDECLLAMBDABREAKCONTINUEIFELSEFORWHILEDORETURNIMPORTSWITCHCASEDEFAULTLETVARCONSTFUNCTIONENUMNULLUNDEFINEDINTERFACEEXPORTNEWCLASSTRUEFALSETRYCATCHFINALLYTHROWTYPEOFINSTANCEOFINDELETEAWAITYIELD"
 
-var _Type_index = [...]uint16{0, 5, 8, 15, 32, 41, 46, 49, 52, 57, 61, 67, 70, 73, 76, 79, 82, 85, 88, 91, 94, 97, 100, 108, 118, 128, 138, 148, 158, 168, 178, 182, 185, 188, 191, 194, 197, 200, 203, 206, 209, 212, 218, 221, 224, 227, 233, 239, 245, 250, 256, 262, 268, 274, 283, 288, 292, 298, 303, 311, 313, 317, 320, 325, 331, 337, 343, 347, 354, 357, 360, 365, 373, 377, 381, 390, 399, 405, 408, 413, 417, 422, 425, 430, 437, 442}
+var _Type_index = [...]uint16{0, 5, 8, 15, 32, 41, 46, 49, 52, 57, 61, 67, 72, 80, 83, 86, 89, 92, 95, 98, 101, 104, 107, 110, 113, 117, 120, 128, 138, 148, 158, 168, 178, 188, 198, 209, 219, 229, 233, 236, 239, 242, 245, 248, 251, 254, 257, 260, 263, 269, 272, 275, 278, 284, 290, 296, 301, 307, 313, 319, 325, 334, 339, 347, 349, 362, 366, 372, 377, 385, 387, 391, 394, 399, 401, 407, 413, 419, 423, 430, 433, 436, 441, 449, 453, 457, 466, 475, 481, 484, 489, 493, 498, 501, 506, 513, 518, 524, 534, 536, 542, 547, 552}
 
 func (i Type) String() string {
 	if i >= Type(len(_Type_index)-1) {
@@ -0,0 +1,47 @@
+package benchmarks
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/binary"
+)
+
+func BenchmarkLoadProgram(b *testing.B) {
+	var code strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&code, `
+			function f%d(a, b) {
+				let s = 0
+				for (let i = 0; i < a; i++) {
+					s += i * b
+				}
+				return s > 100 ? s : -s
+			}
+		`, i)
+	}
+
+	p, err := dune.CompileStr(code.String())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, p); err != nil {
+		b.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := binary.Load(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
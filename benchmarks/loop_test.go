@@ -0,0 +1,95 @@
+package benchmarks
+
+import (
+	"log"
+	"testing"
+
+	"github.com/scorredoira/dune"
+)
+
+func BenchmarkLoop(b *testing.B) {
+	vm := initVM(b, `
+			function sum() {
+				let s = 0
+				for (let i = 0; i < 10000; i++) {
+					if (i % 3 == 0) {
+						s += i
+					} else {
+						s -= 1
+					}
+				}
+				return s
+			}
+		`)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := vm.RunFunc("sum")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if v.ToInt() != 16661667 {
+			log.Fatal(v)
+		}
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	vm := initVM(b, `
+			function fib(n) {
+				if (n < 2) {
+					return n
+				}
+				return fib(n - 1) + fib(n - 2)
+			}
+		`)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := vm.RunFunc("fib", dune.NewInt(20))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if v.ToInt() != 6765 {
+			log.Fatal(v)
+		}
+	}
+}
+
+// BenchmarkOperands runs instructions that read locals,
+// globals and constants to measure the decoding of operands.
+func BenchmarkOperands(b *testing.B) {
+	vm := initVM(b, `
+			let factor = 3
+
+			function run() {
+				let a = 0
+				let c = 1
+				for (let i = 0; i < 10000; i++) {
+					a = (a + i * factor) % 1000003
+					c = c ^ (a & 255)
+				}
+				return a + c
+			}
+		`)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := vm.RunFunc("run")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if v.ToInt() != 984632 {
+			log.Fatal(v)
+		}
+	}
+}
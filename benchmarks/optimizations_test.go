@@ -0,0 +1,57 @@
+package benchmarks
+
+import (
+	"log"
+	"testing"
+
+	"github.com/scorredoira/dune/parser"
+)
+
+const optimizationsCode = `
+	const SECONDS = 60 * 60 * 24
+
+	enum Flags {
+		a = 1,
+		b = 2,
+		c = 4
+	}
+
+	function main() {
+		let s = 0
+		for (let i = 0; i < 1000; i++) {
+			if (i % 2 == 0) {
+				continue
+			}
+			s += (SECONDS / 86400) * (Flags.a | Flags.c)
+		}
+		return s
+	}
+`
+
+func BenchmarkNoOptimizations(b *testing.B) {
+	parser.Optimizations = false
+	benchmarkOptimizations(b)
+}
+
+func BenchmarkOptimizations(b *testing.B) {
+	parser.Optimizations = true
+	benchmarkOptimizations(b)
+}
+
+func benchmarkOptimizations(b *testing.B) {
+	vm := initVM(b, optimizationsCode)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := vm.RunFunc("main")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if v.ToInt() != 2500 {
+			log.Fatal(v)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package benchmarks
+
+import (
+	"log"
+	"testing"
+)
+
+func BenchmarkClassLoop(b *testing.B) {
+	vm := initVM(b, `
+			class Point {
+				x = 0
+				y = 0
+
+				constructor(x, y) {
+					this.x = x
+					this.y = y
+				}
+
+				get sum() {
+					return this.x + this.y
+				}
+
+				move(n) {
+					this.x += n
+				}
+			}
+
+			function run() {
+				let p = new Point(1, 2)
+				let s = 0
+				for (let i = 0; i < 1000; i++) {
+					p.move(1)
+					s += p.sum
+				}
+				return s
+			}
+		`)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := vm.RunFunc("run")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if v.ToInt() != 503500 {
+			log.Fatal(v)
+		}
+	}
+}
+
+func BenchmarkArrayPrototype(b *testing.B) {
+	vm := initVM(b, `
+			function run() {
+				let items = []
+				for (let i = 0; i < 1000; i++) {
+					items.push(i)
+				}
+				return items.length
+			}
+		`)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		v, err := vm.RunFunc("run")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if v.ToInt() != 1000 {
+			log.Fatal(v)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/scorredoira/dune"
+	_ "github.com/scorredoira/dune/lib"
 )
 
 func initVM(b *testing.B, code string) *dune.VM {
@@ -241,3 +241,115 @@ func assertValue(t *testing.T, expected interface{}, p *dune.Program) {
 		t.Fatalf("Expected %v %T, got %v %T", expected, expected, ret, ret)
 	}
 }
+
+func TestRegExpConstants(t *testing.T) {
+	p := compile(t, `
+		function main() {
+			let m = /(\d+)-(?<b>\d+)/i.exec("x12-34")
+			return m[1] + m.groups.b
+		}
+	`)
+
+	var buf bytes.Buffer
+
+	err := Write(&buf, p)
+	if err != nil {
+		t.Fatal("Write: " + err.Error())
+	}
+
+	if p, err = Read(&buf); err != nil {
+		t.Fatal("Read: " + err.Error())
+	}
+
+	assertValue(t, "1234", p)
+}
+
+func TestDecorators(t *testing.T) {
+	p := compile(t, `
+		@entity("users", { fields: ["id", 2, -1.5], strict: true })
+		class User {
+			@column
+			name() { }
+		}
+
+		@task(null)
+		function main() { }
+	`)
+
+	var buf bytes.Buffer
+
+	err := Write(&buf, p)
+	if err != nil {
+		t.Fatal("Write: " + err.Error())
+	}
+
+	if p, err = Read(&buf); err != nil {
+		t.Fatal("Read: " + err.Error())
+	}
+
+	c := p.Classes[0]
+	if len(c.Decorators) != 1 || c.Decorators[0].Name != "entity" || len(c.Decorators[0].Args) != 2 {
+		t.Fatal(c.Decorators)
+	}
+
+	opts := c.Decorators[0].Args[1].ToMap().Map
+	fields := opts[dune.NewString("fields")].ToArray()
+	if len(fields) != 3 || fields[1] != dune.NewInt(2) || fields[2] != dune.NewFloat(-1.5) {
+		t.Fatal(fields)
+	}
+	if opts[dune.NewString("strict")] != dune.TrueValue {
+		t.Fatal(opts)
+	}
+
+	m := p.Functions[c.Functions[0]]
+	if len(m.Decorators) != 1 || m.Decorators[0].String() != "@column()" {
+		t.Fatal(m.Decorators)
+	}
+
+	f, _ := p.Function("main")
+	if len(f.Decorators) != 1 || f.Decorators[0].String() != "@task(null)" {
+		t.Fatal(f.Decorators)
+	}
+}
+
+func TestShapes(t *testing.T) {
+	p := compile(t, `
+		type Kind = "a" | "b" | 3
+
+		interface Item {
+			kind: Kind
+			values?: [string, number][]
+			extra: { children?: Item[] } & { id: number }
+			tags: { [key: string]: Kind }
+		}
+	`)
+
+	var buf bytes.Buffer
+
+	err := Write(&buf, p)
+	if err != nil {
+		t.Fatal("Write: " + err.Error())
+	}
+
+	if p, err = Read(&buf); err != nil {
+		t.Fatal("Read: " + err.Error())
+	}
+
+	v := dune.NewMapValues(map[dune.Value]dune.Value{
+		dune.NewString("kind"):   dune.NewInt(3),
+		dune.NewString("values"): dune.NewArrayValues([]dune.Value{dune.NewArrayValues([]dune.Value{dune.NewString("x"), dune.NewString("y")})}),
+		dune.NewString("extra"):  dune.NewMapValues(map[dune.Value]dune.Value{dune.NewString("id"): dune.NewInt(1)}),
+		dune.NewString("tags"):   dune.NewMapValues(map[dune.Value]dune.Value{dune.NewString("t"): dune.NewString("c")}),
+	})
+
+	errors, err := p.Validate(v, "Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errors) != 2 ||
+		errors[0].Error() != "values[0][1]: expected number, got string" ||
+		errors[1].Error() != `tags.t: expected Kind, got "c"` {
+		t.Fatal(errors)
+	}
+}
@@ -51,6 +51,10 @@ func Read(r io.Reader) (*dune.Program, error) {
 		return nil, err
 	}
 
+	if p.Shapes, err = readShapes(r, key); err != nil {
+		return nil, err
+	}
+
 	if p.Constants, err = readConstants(r, key); err != nil {
 		return nil, err
 	}
@@ -225,12 +229,18 @@ func readClasses(r io.Reader, key byte, p *dune.Program) error {
 		if class.Directives, err = readDirectives(r, key); err != nil {
 			return err
 		}
+		if class.Decorators, err = readDecorators(r, key); err != nil {
+			return err
+		}
 		if class.Name, err = readString(r, key); err != nil {
 			return err
 		}
 		if class.Exported, err = readBool(r); err != nil {
 			return err
 		}
+		if class.Base, err = readInt32(r); err != nil {
+			return err
+		}
 		if class.Fields, err = readClassFields(r, key); err != nil {
 			return err
 		}
@@ -287,6 +297,12 @@ func readClassFields(r io.Reader, key byte) ([]*dune.Field, error) {
 		if f.Exported, err = readBool(r); err != nil {
 			return nil, err
 		}
+		if f.Static, err = readBool(r); err != nil {
+			return nil, err
+		}
+		if f.Readonly, err = readBool(r); err != nil {
+			return nil, err
+		}
 
 		fields = append(fields, f)
 	}
@@ -314,6 +330,9 @@ func readFunctions(r io.Reader, key byte, p *dune.Program) error {
 		if f.Directives, err = readDirectives(r, key); err != nil {
 			return err
 		}
+		if f.Decorators, err = readDecorators(r, key); err != nil {
+			return err
+		}
 		if f.Name, err = readString(r, key); err != nil {
 			return err
 		}
@@ -332,6 +351,24 @@ func readFunctions(r io.Reader, key byte, p *dune.Program) error {
 		if f.IsGlobal, err = readBool(r); err != nil {
 			return err
 		}
+		if f.Async, err = readBool(r); err != nil {
+			return err
+		}
+		if f.Generator, err = readBool(r); err != nil {
+			return err
+		}
+		if f.Static, err = readBool(r); err != nil {
+			return err
+		}
+		if f.Getter, err = readBool(r); err != nil {
+			return err
+		}
+		if f.Setter, err = readBool(r); err != nil {
+			return err
+		}
+		if f.Defaults, err = readBool(r); err != nil {
+			return err
+		}
 		if f.Arguments, err = readInt32(r); err != nil {
 			return err
 		}
@@ -452,7 +489,7 @@ func readRegisters(r io.Reader, key byte) ([]*dune.Register, error) {
 	return regs, nil
 }
 
-func readInstructions(r io.Reader, key byte) ([]*dune.Instruction, error) {
+func readInstructions(r io.Reader, key byte) ([]dune.Instruction, error) {
 	s, err := readSection(r)
 	if err != nil {
 		return nil, err
@@ -462,140 +499,296 @@ func readInstructions(r io.Reader, key byte) ([]*dune.Instruction, error) {
 		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_instructions, t)
 	}
 
-	l := int(v)
-	instrs := make([]*dune.Instruction, l)
-
-	for i, l := 0, int(v); i < l; i++ {
-		instr := &dune.Instruction{}
+	instrs := make([]dune.Instruction, v)
+	if err := binary.Read(r, binary.BigEndian, instrs); err != nil {
+		return nil, fmt.Errorf("invalid instructions: %v", err)
+	}
 
-		instrs[i] = instr
+	s, err = readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	t, v = s.values()
+	if t != section_nativeFuncs {
+		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_nativeFuncs, t)
+	}
 
-		if err := binary.Read(r, binary.BigEndian, &instr.Opcode); err != nil {
+	natives := make([]int, v)
+	for i := range natives {
+		name, err := readString(r, key)
+		if err != nil {
 			return nil, err
 		}
+		f, ok := dune.NativeFuncFromName(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid native function %s", name)
+		}
+		natives[i] = f.Index
+	}
 
-		addr, err := readAddress(r, key)
-		if err != nil {
-			return nil, err
+	native := func(a dune.Address) (dune.Address, error) {
+		if a.Kind() != dune.AddrNativeFunc {
+			return a, nil
+		}
+		i := int(a.Value())
+		if i < 0 || i >= len(natives) {
+			return a, fmt.Errorf("invalid native function address %v", a)
 		}
-		instr.A = addr
+		return dune.NewAddress(dune.AddrNativeFunc, natives[i]), nil
+	}
 
-		addr, err = readAddress(r, key)
-		if err != nil {
+	for i := range instrs {
+		instr := &instrs[i]
+		if instr.A, err = native(instr.A); err != nil {
 			return nil, err
 		}
-		instr.B = addr
-
-		addr, err = readAddress(r, key)
-		if err != nil {
+		if instr.B, err = native(instr.B); err != nil {
+			return nil, err
+		}
+		if instr.C, err = native(instr.C); err != nil {
 			return nil, err
 		}
-		instr.C = addr
 	}
 
 	return instrs, nil
 }
 
-func readAddress(r io.Reader, key byte) (*dune.Address, error) {
-	a := &dune.Address{}
-
-	if err := binary.Read(r, binary.BigEndian, &a.Kind); err != nil {
+func readConstants(r io.Reader, key byte) ([]dune.Value, error) {
+	s, err := readSection(r)
+	if err != nil {
 		return nil, err
 	}
+	t, v := s.values()
+	if t != section_constants {
+		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_constants, t)
+	}
+
+	constants := make([]dune.Value, 0, v)
 
-	if a.Kind == dune.AddrNativeFunc {
-		v, err := readString(r, key)
+	for i, l := 0, int(v); i < l; i++ {
+		k, err := readValue(r, key)
 		if err != nil {
 			return nil, err
 		}
-		f, ok := dune.NativeFuncFromName(v)
-		if !ok {
-			return nil, fmt.Errorf("invalid native function %s", v)
-		}
-		a.Value = int32(f.Index)
-	} else {
-		if err := binary.Read(r, binary.BigEndian, &a.Value); err != nil {
-			return nil, fmt.Errorf("invalid address: %v", err)
-		}
+		constants = append(constants, k)
 	}
+	return constants, nil
+}
 
-	// the instance must be the same
-	// TODO: compare everywhere Kind only
-	if a.Kind == dune.AddrVoid {
-		return dune.Void, nil
+func readValue(r io.Reader, key byte) (dune.Value, error) {
+	s, err := readSection(r)
+	if err != nil {
+		return dune.NullValue, err
 	}
+	t, v := s.values()
+	switch t {
+
+	case section_kInt:
+		k, err := readInt64(r)
+		if err != nil {
+			return dune.NullValue, err
+		}
+		return dune.NewInt64(k), nil
+
+	case section_kFloat:
+		k, err := readFloat64(r)
+		if err != nil {
+			return dune.NullValue, err
+		}
+		return dune.NewFloat(k), nil
+
+	case section_kBool:
+		k, err := readBool(r)
+		if err != nil {
+			return dune.NullValue, err
+		}
+		return dune.NewBool(k), nil
+
+	case section_kString:
+		p := make([]byte, v)
+		if _, err := io.ReadFull(r, p); err != nil {
+			return dune.NullValue, err
+		}
+		unxor(p, key)
+		return dune.NewString(string(p)), nil
+
+	case section_kNull:
+		return dune.NullValue, nil
+
+	case section_kUndefined:
+		return dune.UndefinedValue, nil
 
-	return a, nil
+	case section_kRune:
+		i, err := readInt64(r)
+		if err != nil {
+			return dune.NullValue, err
+		}
+		return dune.NewRune(rune(i)), nil
+
+	case section_kRegExp:
+		p := make([]byte, v)
+		if _, err := io.ReadFull(r, p); err != nil {
+			return dune.NullValue, err
+		}
+		unxor(p, key)
+		re, err := dune.ParseRegExp(string(p))
+		if err != nil {
+			return dune.NullValue, err
+		}
+		return dune.NewObject(re), nil
+
+	case section_kArray:
+		values := make([]dune.Value, v)
+		for i := range values {
+			if values[i], err = readValue(r, key); err != nil {
+				return dune.NullValue, err
+			}
+		}
+		return dune.NewArrayValues(values), nil
+
+	case section_kMap:
+		m := make(map[dune.Value]dune.Value, v)
+		for i, l := 0, int(v); i < l; i++ {
+			k, err := readValue(r, key)
+			if err != nil {
+				return dune.NullValue, err
+			}
+			if m[k], err = readValue(r, key); err != nil {
+				return dune.NullValue, err
+			}
+		}
+		return dune.NewMapValues(m), nil
+
+	default:
+		return dune.NullValue, fmt.Errorf("invalid constant type: %v", t)
+	}
 }
 
-func readConstants(r io.Reader, key byte) ([]dune.Value, error) {
+func readShapes(r io.Reader, key byte) ([]*dune.Shape, error) {
 	s, err := readSection(r)
 	if err != nil {
 		return nil, err
 	}
 	t, v := s.values()
-	if t != section_constants {
-		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_constants, t)
+	if t != section_shapes {
+		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_shapes, t)
 	}
 
-	var constants []dune.Value
+	var shapes []*dune.Shape
 
 	for i, l := 0, int(v); i < l; i++ {
-		s, err := readSection(r)
-		if err != nil {
+		s := &dune.Shape{}
+		if s.Name, err = readString(r, key); err != nil {
+			return nil, err
+		}
+		if s.Module, err = readString(r, key); err != nil {
+			return nil, err
+		}
+		if s.Exported, err = readBool(r); err != nil {
 			return nil, err
 		}
-		t, v := s.values()
-		switch t {
+		if s.Type, err = readShapeType(r, key); err != nil {
+			return nil, err
+		}
+		shapes = append(shapes, s)
+	}
 
-		case section_kInt:
-			k, err := readInt64(r)
-			if err != nil {
-				return nil, err
-			}
-			constants = append(constants, dune.NewInt64(k))
+	return shapes, nil
+}
 
-		case section_kFloat:
-			k, err := readFloat64(r)
-			if err != nil {
-				return nil, err
-			}
-			constants = append(constants, dune.NewFloat(k))
+func readShapeType(r io.Reader, key byte) (*dune.ShapeType, error) {
+	s, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	st, v := s.values()
+	if st != section_shapeType {
+		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_shapeType, st)
+	}
 
-		case section_kBool:
-			k, err := readBool(r)
-			if err != nil {
-				return nil, err
-			}
-			constants = append(constants, dune.NewBool(k))
+	t := &dune.ShapeType{Kind: dune.ShapeKind(v)}
+
+	switch t.Kind {
+	case dune.ShapeLiteral:
+		t.Value, err = readValue(r, key)
+		return t, err
+
+	case dune.ShapeRef:
+		t.Ref, err = readInt32(r)
+		return t, err
 
-		case section_kString:
-			p := make([]byte, v)
-			if _, err := r.Read(p); err != nil {
+	case dune.ShapeArray, dune.ShapeTuple, dune.ShapeUnion, dune.ShapeIntersection, dune.ShapeObject:
+		l, err := readInt32(r)
+		if err != nil {
+			return nil, err
+		}
+		t.Elems = make([]*dune.ShapeType, l)
+		for i := range t.Elems {
+			if t.Elems[i], err = readShapeType(r, key); err != nil {
 				return nil, err
 			}
-			unxor(p, key)
-			constants = append(constants, dune.NewString(string(p)))
+		}
+	}
 
-		case section_kNull:
-			constants = append(constants, dune.NullValue)
+	if t.Kind != dune.ShapeObject {
+		return t, nil
+	}
 
-		case section_kUndefined:
-			constants = append(constants, dune.UndefinedValue)
+	l, err := readInt32(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < l; i++ {
+		p := &dune.ShapeProp{}
+		if p.Name, err = readString(r, key); err != nil {
+			return nil, err
+		}
+		if p.Optional, err = readBool(r); err != nil {
+			return nil, err
+		}
+		if p.Type, err = readShapeType(r, key); err != nil {
+			return nil, err
+		}
+		t.Props = append(t.Props, p)
+	}
 
-		case section_kRune:
-			i, err := readInt64(r)
-			if err != nil {
-				return nil, err
-			}
-			constants = append(constants, dune.NewRune(rune(i)))
+	hasIndex, err := readBool(r)
+	if err != nil {
+		return nil, err
+	}
+	if hasIndex {
+		if t.Index, err = readShapeType(r, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func readDecorators(r io.Reader, key byte) ([]*dune.Decorator, error) {
+	s, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	t, v := s.values()
+	if t != section_decorators {
+		return nil, fmt.Errorf("invalid section, expected %v, got %v", section_decorators, t)
+	}
 
-		default:
-			panic(fmt.Sprintf("Invalid constant type: %v", t))
+	var decorators []*dune.Decorator
 
+	for i, l := 0, int(v); i < l; i++ {
+		d := &dune.Decorator{}
+		if d.Name, err = readString(r, key); err != nil {
+			return nil, err
+		}
+		if d.Args, err = readConstants(r, key); err != nil {
+			return nil, err
 		}
+		decorators = append(decorators, d)
 	}
-	return constants, nil
+
+	return decorators, nil
 }
 
 func readFiles(r io.Reader, key byte) ([]string, error) {
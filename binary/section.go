@@ -2,7 +2,7 @@
 
 package binary
 
-const header = "DUNE v1"
+const header = "DUNE v8"
 
 type SectionType int
 
@@ -18,6 +18,7 @@ const (
 	section_dynamicCalls
 	section_registers
 	section_instructions
+	section_nativeFuncs
 	section_constants
 	section_positions
 	section_files
@@ -33,17 +34,24 @@ const (
 	section_kNull
 	section_kUndefined
 	section_kRune
+	section_kRegExp
+	section_kArray
+	section_kMap
+	section_decorators
+	section_shapes
+	section_shapeType
 	section_EOF
 )
 
 type section uint64
 
+// a section is the type in the lower 8 bits and a value in the rest.
 func newSection(sType SectionType, v int) section {
-	return section(int64(sType) | int64(v)<<5)
+	return section(int64(sType) | int64(v)<<8)
 }
 
 func (s section) values() (SectionType, int64) {
-	t := SectionType(int((s >> 0) & ((1 << 5) - 1)))
-	v := int64((int64(s) >> 5) & ((1 << 59) - 1))
+	t := SectionType(int((s >> 0) & ((1 << 8) - 1)))
+	v := int64((int64(s) >> 8) & ((1 << 56) - 1))
 	return t, v
 }
@@ -19,30 +19,37 @@ func _() {
 	_ = x[section_dynamicCalls-8]
 	_ = x[section_registers-9]
 	_ = x[section_instructions-10]
-	_ = x[section_constants-11]
-	_ = x[section_positions-12]
-	_ = x[section_files-13]
-	_ = x[section_resources-14]
-	_ = x[section_sources-15]
-	_ = x[section_sourceLines-16]
-	_ = x[section_string-17]
-	_ = x[section_bytes-18]
-	_ = x[section_kInt-19]
-	_ = x[section_kFloat-20]
-	_ = x[section_kBool-21]
-	_ = x[section_kString-22]
-	_ = x[section_kNull-23]
-	_ = x[section_kUndefined-24]
-	_ = x[section_kRune-25]
-	_ = x[section_EOF-26]
+	_ = x[section_nativeFuncs-11]
+	_ = x[section_constants-12]
+	_ = x[section_positions-13]
+	_ = x[section_files-14]
+	_ = x[section_resources-15]
+	_ = x[section_sources-16]
+	_ = x[section_sourceLines-17]
+	_ = x[section_string-18]
+	_ = x[section_bytes-19]
+	_ = x[section_kInt-20]
+	_ = x[section_kFloat-21]
+	_ = x[section_kBool-22]
+	_ = x[section_kString-23]
+	_ = x[section_kNull-24]
+	_ = x[section_kUndefined-25]
+	_ = x[section_kRune-26]
+	_ = x[section_kRegExp-27]
+	_ = x[section_kArray-28]
+	_ = x[section_kMap-29]
+	_ = x[section_decorators-30]
+	_ = x[section_shapes-31]
+	_ = x[section_shapeType-32]
+	_ = x[section_EOF-33]
 }
 
-const _SectionType_name = "section_directivessection_buildsection_enumssection_enumValuessection_classessection_classFunctionssection_classFieldssection_functionssection_dynamicCallssection_registerssection_instructionssection_constantssection_positionssection_filessection_resourcessection_sourcessection_sourceLinessection_stringsection_bytessection_kIntsection_kFloatsection_kBoolsection_kStringsection_kNullsection_kUndefinedsection_kRunesection_EOF"
+const _SectionType_name = "section_directivessection_buildsection_enumssection_enumValuessection_classessection_classFunctionssection_classFieldssection_functionssection_dynamicCallssection_registerssection_instructionssection_nativeFuncssection_constantssection_positionssection_filessection_resourcessection_sourcessection_sourceLinessection_stringsection_bytessection_kIntsection_kFloatsection_kBoolsection_kStringsection_kNullsection_kUndefinedsection_kRunesection_kRegExpsection_kArraysection_kMapsection_decoratorssection_shapessection_shapeTypesection_EOF"
 
-var _SectionType_index = [...]uint16{0, 18, 31, 44, 62, 77, 99, 118, 135, 155, 172, 192, 209, 226, 239, 256, 271, 290, 304, 317, 329, 343, 356, 371, 384, 402, 415, 426}
+var _SectionType_index = [...]uint16{0, 18, 31, 44, 62, 77, 99, 118, 135, 155, 172, 192, 211, 228, 245, 258, 275, 290, 309, 323, 336, 348, 362, 375, 390, 403, 421, 434, 449, 463, 475, 493, 507, 524, 535}
 
 func (i SectionType) String() string {
-	if i < 0 || i >= SectionType(len(_SectionType_index)-1) {
+	if i >= SectionType(len(_SectionType_index)-1) {
 		return "SectionType(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
 	return _SectionType_name[_SectionType_index[i]:_SectionType_index[i+1]]
@@ -36,6 +36,10 @@ func Write(w io.Writer, p *dune.Program) error {
 		return err
 	}
 
+	if err := writeShapes(w, p.Shapes, key); err != nil {
+		return err
+	}
+
 	if err := writeConstants(w, p.Constants, key); err != nil {
 		return err
 	}
@@ -90,63 +94,206 @@ func writeConstants(w io.Writer, constants []dune.Value, key byte) error {
 	}
 
 	for _, k := range constants {
-		switch k.Type {
-		case dune.Int:
-			if err := writeSection(w, section_kInt, 0); err != nil {
-				return err
-			}
-			if err := binary.Write(w, binary.BigEndian, k.ToInt()); err != nil {
-				return err
-			}
+		if err := writeValue(w, k, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		case dune.Float:
-			if err := writeSection(w, section_kFloat, 0); err != nil {
-				return err
-			}
-			if err := binary.Write(w, binary.BigEndian, k.ToFloat()); err != nil {
-				return err
-			}
+// writeValue writes a constant value. Arrays and maps
+// are only used in the arguments of decorators.
+func writeValue(w io.Writer, v dune.Value, key byte) error {
+	switch v.Type {
+	case dune.Int:
+		if err := writeSection(w, section_kInt, 0); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, v.ToInt()); err != nil {
+			return err
+		}
 
-		case dune.Bool:
-			if err := writeSection(w, section_kBool, 0); err != nil {
-				return err
-			}
-			if err := binary.Write(w, binary.BigEndian, k.ToBool()); err != nil {
+	case dune.Float:
+		if err := writeSection(w, section_kFloat, 0); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, v.ToFloat()); err != nil {
+			return err
+		}
+
+	case dune.Bool:
+		if err := writeSection(w, section_kBool, 0); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, v.ToBool()); err != nil {
+			return err
+		}
+
+	case dune.String:
+		b := []byte(v.ToString())
+		xor(b, key)
+		if err := writeSection(w, section_kString, len(b)); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, b); err != nil {
+			return err
+		}
+
+	case dune.Null:
+		if err := writeSection(w, section_kNull, 0); err != nil {
+			return err
+		}
+
+	case dune.Undefined:
+		if err := writeSection(w, section_kUndefined, 0); err != nil {
+			return err
+		}
+
+	case dune.Rune:
+		if err := writeSection(w, section_kRune, 0); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, int64(v.ToRune())); err != nil {
+			return err
+		}
+
+	case dune.Array:
+		values := v.ToArray()
+		if err := writeSection(w, section_kArray, len(values)); err != nil {
+			return err
+		}
+		for _, item := range values {
+			if err := writeValue(w, item, key); err != nil {
 				return err
 			}
+		}
 
-		case dune.String:
-			b := []byte(k.ToString())
-			xor(b, key)
-			if err := writeSection(w, section_kString, len(b)); err != nil {
+	case dune.Map:
+		m := v.ToMap()
+		m.RLock()
+		defer m.RUnlock()
+		if err := writeSection(w, section_kMap, len(m.Map)); err != nil {
+			return err
+		}
+		for k, item := range m.Map {
+			if err := writeValue(w, k, key); err != nil {
 				return err
 			}
-			if err := binary.Write(w, binary.BigEndian, b); err != nil {
+			if err := writeValue(w, item, key); err != nil {
 				return err
 			}
+		}
 
-		case dune.Null:
-			if err := writeSection(w, section_kNull, 0); err != nil {
-				return err
-			}
+	case dune.Object:
+		r, ok := v.ToObject().(*dune.RegExp)
+		if !ok {
+			return fmt.Errorf("invalid constant type: %v", v.TypeName())
+		}
+		b := []byte(r.String())
+		xor(b, key)
+		if err := writeSection(w, section_kRegExp, len(b)); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, b); err != nil {
+			return err
+		}
 
-		case dune.Undefined:
-			if err := writeSection(w, section_kUndefined, 0); err != nil {
-				return err
-			}
+	default:
+		return fmt.Errorf("invalid constant type: %v", v.Type)
+	}
 
-		case dune.Rune:
-			if err := writeSection(w, section_kRune, 0); err != nil {
-				return err
-			}
-			if err := binary.Write(w, binary.BigEndian, int64(k.ToRune())); err != nil {
+	return nil
+}
+
+func writeDecorators(w io.Writer, decorators []*dune.Decorator, key byte) error {
+	if err := writeSection(w, section_decorators, len(decorators)); err != nil {
+		return err
+	}
+
+	for _, d := range decorators {
+		if err := writeString(w, d.Name, key); err != nil {
+			return err
+		}
+		if err := writeConstants(w, d.Args, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeShapes(w io.Writer, shapes []*dune.Shape, key byte) error {
+	if err := writeSection(w, section_shapes, len(shapes)); err != nil {
+		return err
+	}
+
+	for _, s := range shapes {
+		if err := writeString(w, s.Name, key); err != nil {
+			return err
+		}
+		if err := writeString(w, s.Module, key); err != nil {
+			return err
+		}
+		if err := writeBool(w, s.Exported); err != nil {
+			return err
+		}
+		if err := writeShapeType(w, s.Type, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeShapeType(w io.Writer, t *dune.ShapeType, key byte) error {
+	if err := writeSection(w, section_shapeType, int(t.Kind)); err != nil {
+		return err
+	}
+
+	switch t.Kind {
+	case dune.ShapeLiteral:
+		return writeValue(w, t.Value, key)
+
+	case dune.ShapeRef:
+		return binary.Write(w, binary.BigEndian, int32(t.Ref))
+
+	case dune.ShapeArray, dune.ShapeTuple, dune.ShapeUnion, dune.ShapeIntersection, dune.ShapeObject:
+		if err := binary.Write(w, binary.BigEndian, int32(len(t.Elems))); err != nil {
+			return err
+		}
+		for _, e := range t.Elems {
+			if err := writeShapeType(w, e, key); err != nil {
 				return err
 			}
+		}
+	}
+
+	if t.Kind != dune.ShapeObject {
+		return nil
+	}
 
-		default:
-			return fmt.Errorf("invalid constant type: %v", k.Type)
+	if err := binary.Write(w, binary.BigEndian, int32(len(t.Props))); err != nil {
+		return err
+	}
+	for _, p := range t.Props {
+		if err := writeString(w, p.Name, key); err != nil {
+			return err
+		}
+		if err := writeBool(w, p.Optional); err != nil {
+			return err
+		}
+		if err := writeShapeType(w, p.Type, key); err != nil {
+			return err
 		}
 	}
+
+	if err := writeBool(w, t.Index != nil); err != nil {
+		return err
+	}
+	if t.Index != nil {
+		return writeShapeType(w, t.Index, key)
+	}
+
 	return nil
 }
 
@@ -179,12 +326,18 @@ func writeClass(w io.Writer, classes []*dune.Class, key byte) error {
 		if err := writeDirectives(w, c.Directives, key); err != nil {
 			return err
 		}
+		if err := writeDecorators(w, c.Decorators, key); err != nil {
+			return err
+		}
 		if err := writeString(w, c.Name, key); err != nil {
 			return err
 		}
 		if err := writeBool(w, c.Exported); err != nil {
 			return err
 		}
+		if err := writeInt32(w, c.Base); err != nil {
+			return err
+		}
 		if err := writeClassFields(w, c.Fields, key); err != nil {
 			return err
 		}
@@ -222,6 +375,12 @@ func writeClassFields(w io.Writer, fields []*dune.Field, key byte) error {
 		if err := writeBool(w, f.Exported); err != nil {
 			return err
 		}
+		if err := writeBool(w, f.Static); err != nil {
+			return err
+		}
+		if err := writeBool(w, f.Readonly); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -239,6 +398,9 @@ func writeFunctions(w io.Writer, funcs []*dune.Function, key byte) error {
 		if err := writeDirectives(w, f.Directives, key); err != nil {
 			return err
 		}
+		if err := writeDecorators(w, f.Decorators, key); err != nil {
+			return err
+		}
 		if err := writeString(w, f.Name, key); err != nil {
 			return err
 		}
@@ -257,6 +419,24 @@ func writeFunctions(w io.Writer, funcs []*dune.Function, key byte) error {
 		if err := writeBool(w, f.IsGlobal); err != nil {
 			return err
 		}
+		if err := writeBool(w, f.Async); err != nil {
+			return err
+		}
+		if err := writeBool(w, f.Generator); err != nil {
+			return err
+		}
+		if err := writeBool(w, f.Static); err != nil {
+			return err
+		}
+		if err := writeBool(w, f.Getter); err != nil {
+			return err
+		}
+		if err := writeBool(w, f.Setter); err != nil {
+			return err
+		}
+		if err := writeBool(w, f.Defaults); err != nil {
+			return err
+		}
 		if err := writeInt32(w, f.Arguments); err != nil {
 			return err
 		}
@@ -283,41 +463,45 @@ func writeFunctions(w io.Writer, funcs []*dune.Function, key byte) error {
 	return nil
 }
 
-func writeInstructions(w io.Writer, ins []*dune.Instruction, key byte) error {
-	if err := writeSection(w, section_instructions, len(ins)); err != nil {
-		return err
-	}
+// writeInstructions writes the instructions as they are in memory. The native
+// functions are written by name because their index depends on the order in
+// which they are registered, so the addresses point to the list of names.
+func writeInstructions(w io.Writer, ins []dune.Instruction, key byte) error {
+	var natives []string
+	indexes := make(map[int32]int)
 
-	for _, i := range ins {
-		if err := binary.Write(w, binary.BigEndian, byte(i.Opcode)); err != nil {
-			return err
-		}
-		if err := writeAddress(w, i.A, key); err != nil {
-			return err
+	native := func(a dune.Address) dune.Address {
+		if a.Kind() != dune.AddrNativeFunc {
+			return a
 		}
-		if err := writeAddress(w, i.B, key); err != nil {
-			return err
-		}
-		if err := writeAddress(w, i.C, key); err != nil {
-			return err
+		i, ok := indexes[a.Value()]
+		if !ok {
+			i = len(natives)
+			indexes[a.Value()] = i
+			natives = append(natives, dune.NativeFuncFromIndex(int(a.Value())).Name)
 		}
+		return dune.NewAddress(dune.AddrNativeFunc, i)
 	}
 
-	return nil
-}
+	code := make([]dune.Instruction, len(ins))
+	for i, instr := range ins {
+		code[i] = dune.NewInstruction(instr.Opcode, native(instr.A), native(instr.B), native(instr.C))
+	}
 
-func writeAddress(w io.Writer, a *dune.Address, key byte) error {
-	if err := binary.Write(w, binary.BigEndian, byte(a.Kind)); err != nil {
+	if err := writeSection(w, section_instructions, len(code)); err != nil {
 		return err
 	}
 
-	if a.Kind == dune.AddrNativeFunc {
-		f := dune.NativeFuncFromIndex(int(a.Value))
-		if err := writeString(w, f.Name, key); err != nil {
-			return err
-		}
-	} else {
-		if err := binary.Write(w, binary.BigEndian, a.Value); err != nil {
+	if err := binary.Write(w, binary.BigEndian, code); err != nil {
+		return err
+	}
+
+	if err := writeSection(w, section_nativeFuncs, len(natives)); err != nil {
+		return err
+	}
+
+	for _, name := range natives {
+		if err := writeString(w, name, key); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,533 @@
+package checker
+
+// union returns the union of types without duplicates.
+func union(types ...Type) Type {
+	var list []Type
+
+	var add func(t Type) bool
+	add = func(t Type) bool {
+		switch t := t.(type) {
+		case *Union:
+			for _, u := range t.Types {
+				if !add(u) {
+					return false
+				}
+			}
+			return true
+		case *Basic:
+			switch t {
+			case Any:
+				return false
+			case Never:
+				return true
+			}
+		}
+
+		for _, u := range list {
+			if identical(t, u) {
+				return true
+			}
+		}
+		list = append(list, t)
+		return true
+	}
+
+	for _, t := range types {
+		if !add(t) {
+			return Any
+		}
+	}
+
+	switch len(list) {
+	case 0:
+		return Never
+	case 1:
+		return list[0]
+	}
+	return &Union{Types: list}
+}
+
+// identical returns true if a and b are the same type.
+func identical(a, b Type) bool {
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Literal:
+		b, ok := b.(*Literal)
+		return ok && a.Base == b.Base && a.Value == b.Value
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && identical(a.Elem, b.Elem)
+	case *Named:
+		b, ok := b.(*Named)
+		if !ok || a.decl != b.decl || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i := range a.Args {
+			if !identical(a.Args[i], b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// widen returns the type of a mutable value initialized with t.
+func widen(t Type) Type {
+	switch t := t.(type) {
+	case *Literal:
+		return t.Base
+	case *Union:
+		types := make([]Type, len(t.Types))
+		for i, u := range t.Types {
+			types[i] = widen(u)
+		}
+		return union(types...)
+	}
+	return t
+}
+
+// inferVar returns the type of a variable without annotation initialized
+// with a value of type t. Constants keep literal types.
+func (c *checker) inferVar(t Type, constant bool) Type {
+	switch t {
+	case Null, Undefined, Void, Never:
+		return Any
+	}
+	if constant {
+		return t
+	}
+	return widen(t)
+}
+
+// assignable returns true if a value of type src can be assigned to dst.
+//
+// The rules are relaxed where the declarations are not precise: any is
+// compatible in both directions, null and undefined can be assigned to
+// anything and a union is accepted if any of its types is.
+func (c *checker) assignable(src, dst Type) bool {
+	return c.isAssignable(src, dst, 0)
+}
+
+func (c *checker) isAssignable(src, dst Type, depth int) bool {
+	if src == dst || depth > 20 {
+		return true
+	}
+
+	// instances of the same generic type compare their arguments
+	if sn, ok := src.(*Named); ok {
+		if dn, ok := dst.(*Named); ok && sn.decl == dn.decl {
+			for i := range dn.Args {
+				if i < len(sn.Args) && !c.isAssignable(sn.Args[i], dn.Args[i], depth+1) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	s := c.underlying(src)
+	d := c.underlying(dst)
+
+	switch d {
+	case Any, Unknown:
+		return true
+	}
+
+	switch s {
+	case Any, Unknown, Never, Null, Undefined:
+		return true
+	}
+
+	if p, ok := s.(*TypeParam); ok {
+		return p.Constraint == nil || c.isAssignable(p.Constraint, dst, depth+1)
+	}
+
+	if u, ok := s.(*Union); ok {
+		for _, t := range u.Types {
+			if t != Null && t != Undefined && c.isAssignable(t, dst, depth+1) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch d := d.(type) {
+	case *Union:
+		for _, t := range d.Types {
+			if c.isAssignable(src, t, depth+1) {
+				return true
+			}
+		}
+		return false
+
+	case *Basic:
+		switch s := s.(type) {
+		case *Basic:
+			return s == d
+		case *Literal:
+			return s.Base == d
+		case *Enum:
+			return s.base() == d
+		}
+		return false
+
+	case *Literal:
+		switch s := s.(type) {
+		case *Literal:
+			return s.Base == d.Base && s.Value == d.Value
+		case *Enum:
+			for _, v := range s.Members {
+				if v.Base == d.Base && v.Value == d.Value {
+					return true
+				}
+			}
+		}
+		return false
+
+	case *Enum:
+		switch s := s.(type) {
+		case *Enum:
+			return s == d
+		case *Basic:
+			return s == Number && d.base() == Number
+		case *Literal:
+			for _, v := range d.Members {
+				if v.Base == s.Base && v.Value == s.Value {
+					return true
+				}
+			}
+			return s.Base == Number && d.base() == Number
+		}
+		return false
+
+	case *Array:
+		switch s := s.(type) {
+		case *Array:
+			return c.isAssignable(s.Elem, d.Elem, depth+1)
+		case *Tuple:
+			for _, e := range s.Elems {
+				if !c.isAssignable(e, d.Elem, depth+1) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+
+	case *Tuple:
+		switch s := s.(type) {
+		case *Tuple:
+			if len(s.Elems) != len(d.Elems) {
+				return false
+			}
+			for i, e := range s.Elems {
+				if !c.isAssignable(e, d.Elems[i], depth+1) {
+					return false
+				}
+			}
+			return true
+		case *Array:
+			return s.Elem == Any
+		}
+		return false
+
+	case *Func:
+		return c.funcAssignable(c.signatures(s), d, depth)
+
+	case *Object:
+		return c.objectAssignable(s, d, depth)
+
+	case *Class:
+		return s == d
+	}
+
+	return true
+}
+
+// signatures returns the call signatures of t.
+func (c *checker) signatures(t Type) []*Func {
+	switch t := c.underlying(t).(type) {
+	case *Func:
+		return []*Func{t}
+	case *Overloads:
+		return t.Funcs
+	case *Object:
+		return t.Calls
+	}
+	return nil
+}
+
+// funcAssignable returns true if any of the signatures can be used as d.
+// Parameters are compared in both directions like in TypeScript.
+func (c *checker) funcAssignable(funcs []*Func, d *Func, depth int) bool {
+outer:
+	for _, f := range funcs {
+		// the function can't require more arguments than it will receive
+		if !d.Variadic && f.minArgs() > len(d.Params) {
+			continue
+		}
+
+		for i, p := range f.Params {
+			if i >= len(d.Params) {
+				break
+			}
+			if (f.Variadic && i == len(f.Params)-1) || (d.Variadic && i == len(d.Params)-1) {
+				break
+			}
+			dp := d.Params[i].Type
+			if !c.isAssignable(dp, p.Type, depth+1) && !c.isAssignable(p.Type, dp, depth+1) {
+				continue outer
+			}
+		}
+
+		if d.Result == Void || c.isAssignable(f.Result, d.Result, depth+1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// objectAssignable compares the members of src with the object d.
+func (c *checker) objectAssignable(src Type, d *Object, depth int) bool {
+	if d.empty() {
+		return true
+	}
+
+	for _, name := range d.names {
+		p := d.Props[name]
+		t, ok := c.member(src, name)
+		if !ok {
+			if p.Optional {
+				continue
+			}
+			return false
+		}
+		if !c.isAssignable(t, p.Type, depth+1) {
+			return false
+		}
+	}
+
+	if d.Index != nil {
+		if o, ok := c.underlying(src).(*Object); ok {
+			for _, p := range o.Props {
+				if !c.isAssignable(p.Type, d.Index, depth+1) {
+					return false
+				}
+			}
+		}
+	}
+
+	if len(d.Calls) > 0 {
+		funcs := c.signatures(src)
+		for _, f := range d.Calls {
+			if !c.funcAssignable(funcs, f, depth) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// missing returns the first required property of d that src doesn't have.
+func (c *checker) missing(src Type, d *Object) string {
+	for _, name := range d.names {
+		if p := d.Props[name]; !p.Optional {
+			if _, ok := c.member(src, name); !ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// subst replaces the type parameters in t.
+func subst(t Type, m map[*TypeParam]Type) Type {
+	if len(m) == 0 {
+		return t
+	}
+
+	switch t := t.(type) {
+	case *TypeParam:
+		if v, ok := m[t]; ok && v != nil {
+			return v
+		}
+		return t
+
+	case *Array:
+		return &Array{Elem: subst(t.Elem, m)}
+
+	case *Tuple:
+		elems := make([]Type, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = subst(e, m)
+		}
+		return &Tuple{Elems: elems}
+
+	case *Union:
+		types := make([]Type, len(t.Types))
+		for i, u := range t.Types {
+			types[i] = subst(u, m)
+		}
+		return union(types...)
+
+	case *Func:
+		return substFunc(t, m)
+
+	case *Overloads:
+		o := &Overloads{Funcs: make([]*Func, len(t.Funcs))}
+		for i, f := range t.Funcs {
+			o.Funcs[i] = substFunc(f, m)
+		}
+		return o
+
+	case *Named:
+		if len(t.Args) == 0 {
+			return t
+		}
+		n := &Named{decl: t.decl, Args: make([]Type, len(t.Args))}
+		for i, a := range t.Args {
+			n.Args[i] = subst(a, m)
+		}
+		return n
+
+	case *Object:
+		o := &Object{
+			Name:  t.Name,
+			Props: make(map[string]*Prop, len(t.Props)),
+			Open:  t.Open,
+			names: append([]string(nil), t.names...),
+		}
+		for name, p := range t.Props {
+			prop := *p
+			prop.Type = subst(p.Type, m)
+			o.Props[name] = &prop
+		}
+		if t.Index != nil {
+			o.Index = subst(t.Index, m)
+		}
+		if t.NumIndex != nil {
+			o.NumIndex = subst(t.NumIndex, m)
+		}
+		for _, f := range t.Calls {
+			o.Calls = append(o.Calls, substFunc(f, m))
+		}
+		for _, f := range t.Ctors {
+			o.Ctors = append(o.Ctors, substFunc(f, m))
+		}
+		return o
+	}
+
+	return t
+}
+
+func substFunc(f *Func, m map[*TypeParam]Type) *Func {
+	r := &Func{
+		TypeParams: f.TypeParams,
+		Variadic:   f.Variadic,
+		Params:     make([]*Param, len(f.Params)),
+		Result:     subst(f.Result, m),
+	}
+	for i, p := range f.Params {
+		r.Params[i] = &Param{Name: p.Name, Type: subst(p.Type, m), Optional: p.Optional}
+	}
+	return r
+}
+
+// infer binds the type parameters of m that are not bound yet
+// matching the type of a parameter with the type of an argument.
+func (c *checker) infer(param, arg Type, m map[*TypeParam]Type) {
+	c.inferDepth(param, arg, m, 0)
+}
+
+func (c *checker) inferDepth(param, arg Type, m map[*TypeParam]Type, depth int) {
+	if depth > 10 || arg == nil {
+		return
+	}
+
+	switch p := param.(type) {
+	case *TypeParam:
+		if v, ok := m[p]; ok && v == nil {
+			switch arg {
+			case Null, Undefined:
+				return
+			}
+			m[p] = widen(arg)
+		}
+		return
+
+	case *Named:
+		if a, ok := arg.(*Named); ok && a.decl == p.decl {
+			for i := range p.Args {
+				if i < len(a.Args) {
+					c.inferDepth(p.Args[i], a.Args[i], m, depth+1)
+				}
+			}
+			return
+		}
+	}
+
+	switch p := param.(type) {
+	case *Array:
+		switch a := c.underlying(arg).(type) {
+		case *Array:
+			c.inferDepth(p.Elem, a.Elem, m, depth+1)
+		case *Tuple:
+			c.inferDepth(p.Elem, union(a.Elems...), m, depth+1)
+		}
+
+	case *Union:
+		// first try the members with a structure like Promise<T>
+		// and then the bare type parameters.
+		for _, t := range p.Types {
+			if _, ok := t.(*TypeParam); !ok {
+				c.inferDepth(t, arg, m, depth+1)
+			}
+		}
+		for _, t := range p.Types {
+			if _, ok := t.(*TypeParam); ok {
+				c.inferDepth(t, arg, m, depth+1)
+			}
+		}
+
+	case *Func:
+		if fs := c.signatures(arg); len(fs) == 1 {
+			a := fs[0]
+			for i, pp := range p.Params {
+				if i < len(a.Params) {
+					c.inferDepth(pp.Type, a.Params[i].Type, m, depth+1)
+				}
+			}
+			c.inferDepth(p.Result, a.Result, m, depth+1)
+		}
+
+	case *Named:
+		if a, ok := c.underlying(arg).(*Object); ok {
+			if po, ok := c.underlying(p).(*Object); ok {
+				c.inferObject(po, a, m, depth)
+			}
+		}
+
+	case *Object:
+		if a, ok := c.underlying(arg).(*Object); ok {
+			c.inferObject(p, a, m, depth)
+		}
+	}
+}
+
+func (c *checker) inferObject(p, a *Object, m map[*TypeParam]Type, depth int) {
+	for name, pp := range p.Props {
+		if ap, ok := a.Props[name]; ok {
+			c.inferDepth(pp.Type, ap.Type, m, depth+1)
+		}
+	}
+	if p.Index != nil && a.Index != nil {
+		c.inferDepth(p.Index, a.Index, m, depth+1)
+	}
+}
@@ -0,0 +1,690 @@
+// Package checker implements an optional static type checker.
+//
+// It uses the type annotations of the source and the declarations of
+// definition files like native.d.ts. The checking is gradual: values
+// without annotations are any and only the errors that can be proven
+// with the available types are reported.
+package checker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// Error is a type error.
+type Error struct {
+	Pos     ast.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Message)
+}
+
+// Check type checks a program. defs are definition files like
+// native.d.ts that declare the native functions and types.
+func Check(mod *ast.Module, defs ...*ast.File) []*Error {
+	c := newChecker()
+
+	for _, f := range defs {
+		c.declareDefs(c.global, f.Types)
+	}
+
+	c.checkProgram(mod)
+
+	c.errors = ignored(c.errors, mod)
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		a, b := c.errors[i].Pos, c.errors[j].Pos
+		if a.FileName != b.FileName {
+			return a.FileName < b.FileName
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return c.errors
+}
+
+// ignored removes the errors of the lines after a // @ts-ignore
+// or // @ts-expect-error comment.
+func ignored(errors []*Error, mod *ast.Module) []*Error {
+	lines := make(map[string]bool)
+
+	files := []*ast.File{mod.File}
+	for _, f := range mod.Modules {
+		files = append(files, f)
+	}
+
+	for _, f := range files {
+		for _, cm := range f.Comments {
+			if strings.Contains(cm.Str, "@ts-ignore") || strings.Contains(cm.Str, "@ts-expect-error") {
+				lines[fmt.Sprintf("%s:%d", cm.Pos.FileName, cm.Pos.Line+1)] = true
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return errors
+	}
+
+	var result []*Error
+	for _, err := range errors {
+		if !lines[fmt.Sprintf("%s:%d", err.Pos.FileName, err.Pos.Line)] {
+			result = append(result, err)
+		}
+	}
+	return result
+}
+
+type checker struct {
+	errors  []*Error
+	seen    map[string]bool
+	silent  int // don't report errors if greater than 0
+	global  *scope
+	scope   *scope
+	fn      *funcContext
+	modules map[string]*module
+}
+
+// funcContext is the function that is being checked.
+type funcContext struct {
+	result    Type // the declared result or nil to infer it
+	returns   []Type
+	async     bool
+	generator bool
+	this      Type
+}
+
+// module is a source file of the program.
+type module struct {
+	path  string
+	file  *ast.File
+	scope *scope
+}
+
+func newChecker() *checker {
+	universe := newScope(nil)
+	for _, t := range []*Basic{Any, Unknown, Number, String, Boolean, Void, Null, Undefined, Never} {
+		universe.types[t.Name] = t
+	}
+	universe.types["object"] = Any
+	universe.types["symbol"] = Any
+	universe.types["bigint"] = Number
+
+	global := newScope(universe)
+
+	return &checker{
+		seen:    make(map[string]bool),
+		global:  global,
+		scope:   global,
+		modules: make(map[string]*module),
+	}
+}
+
+func (c *checker) errorf(pos ast.Position, format string, args ...interface{}) {
+	if c.silent > 0 {
+		return
+	}
+
+	err := &Error{Pos: pos, Message: fmt.Sprintf(format, args...)}
+
+	// expressions can be evaluated more than once
+	key := err.Error()
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+
+	c.errors = append(c.errors, err)
+}
+
+// scope contains the values and types declared in a block.
+type scope struct {
+	parent *scope
+	values map[string]*symbol
+	types  map[string]Type
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{
+		parent: parent,
+		values: make(map[string]*symbol),
+		types:  make(map[string]Type),
+	}
+}
+
+func (s *scope) lookup(name string) *symbol {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.values[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func (s *scope) lookupType(name string) Type {
+	for ; s != nil; s = s.parent {
+		if t, ok := s.types[name]; ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// symbol is a declared value.
+type symbol struct {
+	typ       Type
+	declared  bool // the type comes from an annotation
+	constant  bool
+	exported  bool
+	init      func() Type // computes the type the first time it is used
+	overloads []*ast.FuncType
+}
+
+func (c *checker) typeOf(s *symbol) Type {
+	if s.typ == nil {
+		if s.init == nil {
+			return Any
+		}
+		// the type is any while it is being resolved
+		// if it references itself.
+		s.typ = Any
+		s.typ = s.init()
+	}
+	return s.typ
+}
+
+// declareDefs adds the declarations of a definition file.
+func (c *checker) declareDefs(s *scope, decls []ast.Stmt) {
+	for _, d := range decls {
+		switch t := d.(type) {
+		case *ast.NamespaceDecl:
+			if t.Name == "" {
+				c.declareDefs(c.global, t.Decls)
+				continue
+			}
+			c.declareDefs(c.namespace(s, t.Name).scope, t.Decls)
+
+		case *ast.InterfaceDeclStmt:
+			d := c.declareInterface(s, t, false)
+			if t.Class {
+				s.values[t.Name] = &symbol{init: func() Type { return c.declaredClass(d) }, declared: true}
+			}
+
+		case *ast.TypeAliasStmt:
+			c.declareAlias(s, t, false)
+
+		case *ast.EnumDeclStmt:
+			c.declareEnum(s, t)
+
+		case *ast.DeclareStmt:
+			c.declareValue(s, t)
+		}
+	}
+}
+
+// namespace returns the namespace declared with name in s. Declarations
+// of the same namespace are merged.
+func (c *checker) namespace(s *scope, name string) *Namespace {
+	if v, ok := s.values[name]; ok {
+		if ns, ok := v.typ.(*Namespace); ok {
+			return ns
+		}
+	}
+
+	ns := &Namespace{Name: "typeof " + name, scope: newScope(s)}
+	s.values[name] = &symbol{typ: ns, constant: true}
+	return ns
+}
+
+// declareValue declares a function, constant or variable of a definition
+// file. Functions declared more than once are overloads.
+func (c *checker) declareValue(s *scope, t *ast.DeclareStmt) {
+	f, isFunc := t.Type.(*ast.FuncType)
+
+	if v, ok := s.values[t.Name]; ok && isFunc && v.overloads != nil {
+		v.overloads = append(v.overloads, f)
+		return
+	}
+
+	v := &symbol{declared: true}
+
+	if isFunc {
+		v.overloads = []*ast.FuncType{f}
+		v.init = func() Type {
+			if len(v.overloads) == 1 {
+				return c.resolveFunc(v.overloads[0], s, false)
+			}
+			o := &Overloads{}
+			for _, f := range v.overloads {
+				o.Funcs = append(o.Funcs, c.resolveFunc(f, s, false))
+			}
+			return o
+		}
+	} else {
+		v.init = func() Type { return c.resolve(t.Type, s, false) }
+	}
+
+	s.values[t.Name] = v
+}
+
+func (c *checker) declareInterface(s *scope, t *ast.InterfaceDeclStmt, report bool) *typeDecl {
+	// declarations with the same name are merged
+	if n, ok := s.types[t.Name].(*Named); ok && n.decl.interfaces != nil {
+		n.decl.interfaces = append(n.decl.interfaces, t)
+		return n.decl
+	}
+
+	d := &typeDecl{
+		name:       t.Name,
+		params:     newTypeParams(t.TypeParams),
+		scope:      s,
+		report:     report,
+		interfaces: []*ast.InterfaceDeclStmt{t},
+		build:      c.buildInterface,
+	}
+
+	s.types[t.Name] = &Named{decl: d}
+	return d
+}
+
+func (c *checker) declareAlias(s *scope, t *ast.TypeAliasStmt, report bool) {
+	d := &typeDecl{
+		name:   t.Name,
+		params: newTypeParams(t.TypeParams),
+		scope:  s,
+		report: report,
+	}
+
+	d.build = func(d *typeDecl) Type {
+		ps := c.paramScope(d, t.TypeParams)
+		return c.resolve(t.Type, ps, d.report)
+	}
+
+	s.types[t.Name] = &Named{decl: d}
+}
+
+func (c *checker) declareEnum(s *scope, t *ast.EnumDeclStmt) {
+	e := &Enum{Name: t.Name, Members: make(map[string]*Literal)}
+	ns := &Namespace{Name: "typeof " + t.Name, scope: newScope(nil)}
+
+	for _, v := range t.Values {
+		base := Number
+		if v.Kind == ast.STRING {
+			base = String
+		}
+		e.Members[v.Name] = &Literal{Base: base, Value: v.Value.Value}
+		ns.scope.values[v.Name] = &symbol{typ: e, constant: true}
+	}
+
+	s.types[t.Name] = e
+	s.values[t.Name] = &symbol{typ: ns, constant: true, exported: t.Exported}
+}
+
+func newTypeParams(params []*ast.TypeParam) []*TypeParam {
+	if len(params) == 0 {
+		return nil
+	}
+	tps := make([]*TypeParam, len(params))
+	for i, p := range params {
+		tps[i] = &TypeParam{Name: p.Name}
+	}
+	return tps
+}
+
+// paramScope returns a scope with the type parameters of a declaration.
+// Merged declarations can name them differently so they are
+// matched by position.
+func (c *checker) paramScope(d *typeDecl, params []*ast.TypeParam) *scope {
+	return c.withTypeParams(d.scope, d.params, params, d.report)
+}
+
+// checkProgram checks the main file and all the imported modules.
+func (c *checker) checkProgram(mod *ast.Module) {
+	mods := []*module{c.newModule("", mod.File)}
+
+	paths := make([]string, 0, len(mod.Modules))
+	for path := range mod.Modules {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		mods = append(mods, c.newModule(path, mod.Modules[path]))
+	}
+
+	// declarations are resolved lazily so they can be declared in any
+	// order but imports need the declarations of all modules.
+	for _, m := range mods {
+		c.declareTypes(m)
+	}
+	for _, m := range mods {
+		c.declareValues(m)
+	}
+	for _, m := range mods {
+		c.bindImports(m)
+	}
+	for _, m := range mods {
+		c.checkModule(m)
+	}
+}
+
+func (c *checker) newModule(path string, file *ast.File) *module {
+	m := &module{path: path, file: file, scope: newScope(c.global)}
+	c.modules[path] = m
+	return m
+}
+
+// declareTypes declares the interfaces, type aliases, classes and enums of a module.
+func (c *checker) declareTypes(m *module) {
+	for _, d := range m.file.Types {
+		switch t := d.(type) {
+		case *ast.InterfaceDeclStmt:
+			c.declareInterface(m.scope, t, true)
+		case *ast.TypeAliasStmt:
+			c.declareAlias(m.scope, t, true)
+		}
+	}
+
+	for _, s := range m.file.Global {
+		if t, ok := s.(*ast.EnumDeclStmt); ok {
+			c.declareEnum(c.global, t)
+		}
+	}
+
+	for _, s := range m.file.Stms {
+		switch t := s.(type) {
+		case *ast.ClassDeclStmt:
+			c.declareClass(m.scope, t)
+		case *ast.EnumDeclStmt:
+			c.declareEnum(m.scope, t)
+		}
+	}
+}
+
+// declareValues declares the top level functions and variables of a module.
+func (c *checker) declareValues(m *module) {
+	c.scope = m.scope
+
+	for _, s := range m.file.Global {
+		if t, ok := s.(*ast.VarDeclStmt); ok {
+			c.declareVar(c.global, t)
+		}
+	}
+
+	for _, s := range m.file.Stms {
+		switch t := s.(type) {
+		case *ast.FuncDeclStmt:
+			if t.ReceiverType != "" {
+				c.declareExtension(m.scope, t)
+			} else {
+				c.declareFunc(m.scope, t)
+			}
+		case *ast.VarDeclStmt:
+			c.declareVar(m.scope, t)
+		}
+	}
+}
+
+// declareVar declares a top level variable. The type is
+// computed when it is used or the declaration is checked.
+func (c *checker) declareVar(s *scope, t *ast.VarDeclStmt) {
+	if t.Pattern != nil {
+		// the names of patterns are declared when checked
+		return
+	}
+
+	v := &symbol{declared: t.Type != nil, constant: t.Const, exported: t.Exported}
+	v.init = func() Type {
+		if t.Type != nil {
+			return c.resolve(t.Type, s, true)
+		}
+		c.silent++
+		defer func() { c.silent-- }()
+		return c.inferVar(c.exprIn(t.Value, nil, s), t.Const)
+	}
+
+	s.values[t.Name] = v
+}
+
+// declareExtension adds a method declared with Type.prototype.name.
+func (c *checker) declareExtension(s *scope, t *ast.FuncDeclStmt) {
+	name := t.ReceiverType
+	switch name {
+	case "Bytes":
+		name = "Array"
+	}
+
+	n, ok := s.lookupType(name).(*Named)
+	if !ok {
+		return
+	}
+
+	n.decl.extensions = append(n.decl.extensions, func() *Prop {
+		return &Prop{Name: t.Name, Type: c.funcSignature(t.TypeParams, t.Args, t.Variadic, t.Result, s, nil)}
+	})
+}
+
+// bindImports declares the names imported by a module.
+func (c *checker) bindImports(m *module) {
+	for _, imp := range m.file.Imports {
+		if imp.Export {
+			continue
+		}
+
+		target, ok := c.modules[imp.AbsPath]
+
+		if imp.Alias != "" {
+			if !ok {
+				m.scope.values[imp.Alias] = &symbol{typ: Any}
+				continue
+			}
+			ns := c.moduleNamespace(target, imp.Alias, nil)
+			m.scope.values[imp.Alias] = &symbol{typ: ns, constant: true}
+		}
+
+		if imp.Default != "" {
+			c.bindImport(m, target, "default", imp.Default)
+		}
+
+		for _, n := range imp.Names {
+			c.bindImport(m, target, n.Name, n.Alias)
+		}
+	}
+}
+
+func (c *checker) bindImport(m, target *module, name, alias string) {
+	if target == nil {
+		m.scope.values[alias] = &symbol{typ: Any}
+		return
+	}
+
+	v, t := c.export(target, name, nil)
+	if v != nil {
+		m.scope.values[alias] = v
+	}
+	if t != nil {
+		m.scope.types[alias] = t
+	}
+	if v == nil && t == nil {
+		// the compiler reports members that are not exported
+		m.scope.values[alias] = &symbol{typ: Any}
+	}
+}
+
+// export returns the value and the type exported with name by a module
+// following its default export and re-exports.
+func (c *checker) export(m *module, name string, visited map[*module]bool) (*symbol, Type) {
+	if name == "default" {
+		if m.file.Default == "" {
+			return nil, nil
+		}
+		name = m.file.Default
+	}
+
+	v := m.scope.values[name]
+	if v != nil && !v.exported {
+		v = nil
+	}
+
+	var t Type
+	if c.isExportedType(m, name) {
+		t = m.scope.types[name]
+	}
+
+	if v != nil || t != nil {
+		return v, t
+	}
+
+	// avoid cycles between modules that re-export each other
+	if visited == nil {
+		visited = make(map[*module]bool)
+	}
+	if visited[m] {
+		return nil, nil
+	}
+	visited[m] = true
+
+	for _, imp := range m.file.Imports {
+		target, ok := c.modules[imp.AbsPath]
+		if !imp.Export || !ok {
+			continue
+		}
+
+		for _, n := range imp.Names {
+			if n.Alias == name {
+				return c.export(target, n.Name, visited)
+			}
+		}
+
+		// the default export is not included in export *
+		if imp.All && name != "default" {
+			if v, t := c.export(target, name, visited); v != nil || t != nil {
+				return v, t
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *checker) isExportedType(m *module, name string) bool {
+	for _, d := range m.file.Types {
+		switch t := d.(type) {
+		case *ast.InterfaceDeclStmt:
+			if t.Name == name && t.Exported {
+				return true
+			}
+		case *ast.TypeAliasStmt:
+			if t.Name == name && t.Exported {
+				return true
+			}
+		}
+	}
+
+	for _, s := range m.file.Stms {
+		switch t := s.(type) {
+		case *ast.ClassDeclStmt:
+			if t.Name == name && t.Exported {
+				return true
+			}
+		case *ast.EnumDeclStmt:
+			if t.Name == name && t.Exported {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// moduleNamespace returns the namespace of an import * as name.
+func (c *checker) moduleNamespace(m *module, name string, visited map[*module]bool) *Namespace {
+	ns := &Namespace{Name: "typeof " + name, scope: newScope(nil)}
+
+	// avoid cycles between modules that re-export each other
+	if visited == nil {
+		visited = make(map[*module]bool)
+	}
+	if visited[m] {
+		return ns
+	}
+	visited[m] = true
+
+	for k, v := range m.scope.values {
+		if v.exported {
+			ns.scope.values[k] = v
+		}
+	}
+
+	for k, t := range m.scope.types {
+		if c.isExportedType(m, k) {
+			ns.scope.types[k] = t
+		}
+	}
+
+	for _, imp := range m.file.Imports {
+		target, ok := c.modules[imp.AbsPath]
+		if !imp.Export || !ok {
+			continue
+		}
+		for _, n := range imp.Names {
+			v, t := c.export(target, n.Name, nil)
+			if v != nil {
+				ns.scope.values[n.Alias] = v
+			}
+			if t != nil {
+				ns.scope.types[n.Alias] = t
+			}
+		}
+		if imp.All {
+			other := c.moduleNamespace(target, name, visited)
+			for k, v := range other.scope.values {
+				if _, ok := ns.scope.values[k]; !ok {
+					ns.scope.values[k] = v
+				}
+			}
+			for k, t := range other.scope.types {
+				if _, ok := ns.scope.types[k]; !ok {
+					ns.scope.types[k] = t
+				}
+			}
+		}
+	}
+
+	return ns
+}
+
+// checkModule checks the statements of a module.
+func (c *checker) checkModule(m *module) {
+	c.scope = m.scope
+	c.fn = nil
+
+	for _, s := range m.file.Global {
+		if t, ok := s.(*ast.VarDeclStmt); ok {
+			c.checkTopVar(c.global, t)
+		}
+	}
+
+	for _, s := range m.file.Stms {
+		switch t := s.(type) {
+		case *ast.VarDeclStmt:
+			if t.Pattern == nil {
+				c.checkTopVar(m.scope, t)
+				continue
+			}
+		case *ast.FuncDeclStmt:
+			if t.ReceiverType != "" {
+				c.checkExtension(t)
+				continue
+			}
+		}
+		c.stmt(s)
+	}
+}
@@ -0,0 +1,257 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/filesystem"
+	"github.com/scorredoira/dune/parser"
+
+	_ "github.com/scorredoira/dune/lib"
+)
+
+func TestInterfaces(t *testing.T) {
+	assertCheck(t, `
+		interface Point { x: number; y: number }
+
+		function dist(p: Point): number {
+			return p.x + p.y
+		}
+
+		dist({ x: 1, y: 2 })
+		let p: Point = { x: 1 }
+		let q: Point = { x: 1, y: 2, z: 3 }
+		let r = p.x.toFixed(2)
+		let a = "a"
+		let s = a.foo
+	`,
+		"Property 'y' is missing in type '{ x: number; }' but required in type 'Point'",
+		"Object literal may only specify known properties, and 'z' does not exist in type 'Point'",
+		"Property 'foo' does not exist on type 'string'",
+	)
+}
+
+func TestInterfaceExtends(t *testing.T) {
+	assertCheck(t, `
+		interface A { a: string }
+		interface B extends A { b?: number }
+
+		let b: B = { a: "x" }
+		let s: number = b.a
+	`,
+		"Type 'string' is not assignable to type 'number'",
+	)
+}
+
+func TestFunctionSignatures(t *testing.T) {
+	assertCheck(t, `
+		function foo(a: number, b?: string): string {
+			return b
+		}
+
+		foo()
+		foo(1)
+		foo(1, "a", 2)
+		foo("a")
+		let n: number = foo(1)
+
+		let f: (a: number) => string = a => a * 2
+	`,
+		"Expected 1-2 arguments, but got 0",
+		"Expected 1-2 arguments, but got 3",
+		"Argument of type '\"a\"' is not assignable to parameter of type 'number'",
+		"Type 'string' is not assignable to type 'number'",
+		"Type '(a: number) => number' is not assignable to type '(a: number) => string'",
+	)
+}
+
+func TestReturnType(t *testing.T) {
+	assertCheck(t, `
+		function foo(): number {
+			return "a"
+		}
+
+		async function bar(): Promise<number> {
+			return 1
+		}
+
+		async function main() {
+			let s: string = await bar()
+		}
+	`,
+		"Type '\"a\"' is not assignable to type 'number'",
+		"Type 'number' is not assignable to type 'string'",
+	)
+}
+
+func TestUnions(t *testing.T) {
+	assertCheck(t, `
+		type Kind = "a" | "b"
+
+		let k: Kind = "a"
+		let k2: Kind = "c"
+		let v: string | number = 1
+		let v2: string | number = true
+		let xs: number[] = [1, 2, "a"]
+	`,
+		"Type '\"c\"' is not assignable to type 'Kind'",
+		"Type 'true' is not assignable to type 'string | number'",
+		"Type '\"a\"' is not assignable to type 'number'",
+	)
+}
+
+func TestGenerics(t *testing.T) {
+	assertCheck(t, `
+		function id<T>(v: T): T {
+			return v
+		}
+
+		function first<T>(v: T[]): T {
+			return v[0]
+		}
+
+		let a: number = id("a")
+		let b: string = first([1, 2])
+
+		class Box<T> {
+			private v: T
+			constructor(v: T) {
+				this.v = v
+			}
+			get(): T {
+				return this.v
+			}
+		}
+
+		let c: string = new Box(1).get()
+		let d: string = new Box<string>("a").get()
+	`,
+		"Type 'string' is not assignable to type 'number'",
+		"Type 'number' is not assignable to type 'string'",
+		"Type 'number' is not assignable to type 'string'",
+	)
+}
+
+func TestNativeFunctions(t *testing.T) {
+	assertCheck(t, `
+		let names = ["a", "b"]
+		let upper = names.select(n => n.toUpper())
+		let n: number[] = upper
+		let s: number = strings.repeat("a", 2)
+		names.foo()
+	`,
+		"Type 'string[]' is not assignable to type 'number[]'",
+		"Type 'string' is not assignable to type 'number'",
+		"Property 'foo' does not exist on type 'string[]'",
+	)
+}
+
+func TestClasses(t *testing.T) {
+	assertCheck(t, `
+		interface Named { name: string }
+
+		class A implements Named {
+			id = 1
+		}
+
+		class B extends A {
+			foo() {
+				return this.id + this.bar
+			}
+		}
+
+		let b = new B()
+		b.id = "a"
+	`,
+		"Class 'A' incorrectly implements interface 'Named'. Property 'name' is missing in type 'A'",
+		"Property 'bar' does not exist on type 'B'",
+		"Type '\"a\"' is not assignable to type 'number'",
+	)
+}
+
+func TestConstants(t *testing.T) {
+	assertCheck(t, `
+		const a = 1
+		a = 2
+		let b = "a"
+		b++
+	`,
+		"Cannot assign to 'a' because it is a constant",
+		"An arithmetic operand must be of type 'any', 'number' or an enum type",
+	)
+}
+
+func TestTsIgnore(t *testing.T) {
+	assertCheck(t, `
+		// @ts-ignore
+		let a: number = "a"
+	`)
+}
+
+func TestImports(t *testing.T) {
+	fs := filesystem.NewMemFS()
+
+	fs.WritePath("/lib.ts", []byte(`
+		export interface User { name: string }
+		export function find(id: number): User {
+			return { name: "a" }
+		}
+	`))
+
+	fs.WritePath("/main.ts", []byte(`
+		import { find, User } from "./lib"
+		import * as lib from "./lib"
+
+		let u: User = find("a")
+		let n: number = lib.find(1).name
+	`))
+
+	p, err := parser.Parse(fs, "/main.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertErrors(t, Check(p, definitions(t)),
+		"Argument of type '\"a\"' is not assignable to parameter of type 'number'",
+		"Type 'string' is not assignable to type 'number'",
+	)
+}
+
+func definitions(t *testing.T) *ast.File {
+	defs, err := parser.ParseDefinitions("native.d.ts", dune.TypeDefs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return defs
+}
+
+func assertCheck(t *testing.T, code string, expected ...string) {
+	t.Helper()
+
+	p, err := parser.ParseStr(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertErrors(t, Check(p, definitions(t)), expected...)
+}
+
+func assertErrors(t *testing.T, errors []*Error, expected ...string) {
+	t.Helper()
+
+	if len(errors) != len(expected) {
+		var msgs []string
+		for _, e := range errors {
+			msgs = append(msgs, e.Error())
+		}
+		t.Fatalf("expected %d errors, got %d:\n%s", len(expected), len(errors), strings.Join(msgs, "\n"))
+	}
+
+	for i, e := range errors {
+		if e.Message != expected[i] {
+			t.Fatalf("expected '%s', got '%s'", expected[i], e)
+		}
+	}
+}
@@ -0,0 +1,824 @@
+package checker
+
+import (
+	"strconv"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// exprIn returns the type of e evaluated in the scope s.
+func (c *checker) exprIn(e ast.Expr, expected Type, s *scope) Type {
+	scope, fn := c.scope, c.fn
+	c.scope, c.fn = s, nil
+	t := c.expr(e, expected)
+	c.scope, c.fn = scope, fn
+	return t
+}
+
+// expr returns the type of e. expected is the type required by the context
+// or nil. It is used to type the parameters of function literals and the
+// values of object and array literals.
+func (c *checker) expr(e ast.Expr, expected Type) Type {
+	switch t := e.(type) {
+	case nil:
+		return Undefined
+
+	case *ast.ConstantExpr:
+		if t.Kind == ast.REGEX {
+			if r, ok := c.global.types["RegExp"]; ok {
+				return r
+			}
+			return Any
+		}
+		return literalType(t.Kind, t.Value)
+
+	case *ast.TemplateExpr:
+		for _, v := range t.Values {
+			c.expr(v, nil)
+		}
+		if t.Tag != nil {
+			if f, ok := c.underlying(c.expr(t.Tag, nil)).(*Func); ok {
+				return f.Result
+			}
+			return Any
+		}
+		return String
+
+	case *ast.IdentExpr:
+		return c.ident(t)
+
+	case *ast.UnaryExpr:
+		return c.unary(t)
+
+	case *ast.BinaryExpr:
+		return c.binary(t, expected)
+
+	case *ast.TernaryExpr:
+		c.expr(t.Condition, nil)
+		return union(c.expr(t.Left, expected), c.expr(t.Right, expected))
+
+	case *ast.MapDeclExpr:
+		return c.objectLiteral(t, expected)
+
+	case *ast.ArrayDeclExpr:
+		return c.arrayLiteral(t, expected)
+
+	case *ast.IndexExpr:
+		return c.index(t)
+
+	case *ast.SelectorExpr:
+		x := c.expr(t.X, nil)
+		typ, ok := c.property(x, t.Sel.Name)
+		if !ok {
+			c.errorf(t.Sel.Pos, "Property '%s' does not exist on type '%v'", t.Sel.Name, x)
+			return Any
+		}
+		return typ
+
+	case *ast.FuncDeclExpr:
+		return c.funcLiteral(t, expected)
+
+	case *ast.CallExpr:
+		return c.callType(c.expr(t.Ident, nil), t.Args, t.Spread, t.Position())
+
+	case *ast.NewInstanceExpr:
+		return c.newInstance(t)
+
+	case *ast.AwaitExpr:
+		return c.await(c.expr(t.X, nil))
+
+	case *ast.YieldExpr:
+		c.expr(t.X, nil)
+		return Any
+
+	case *ast.AsExpr:
+		x := c.expr(t.X, nil)
+		if ref, ok := t.Type.(*ast.TypeRef); ok && ref.Name == "const" {
+			return x
+		}
+		return c.resolve(t.Type, c.scope, true)
+
+	case *ast.TypeofExpr:
+		c.expr(t.Expr, nil)
+		return String
+
+	case *ast.SpreadExpr:
+		return c.expr(t.X, nil)
+	}
+
+	return Any
+}
+
+func (c *checker) ident(t *ast.IdentExpr) Type {
+	switch t.Name {
+	case "this":
+		if c.fn != nil && c.fn.this != nil {
+			return c.fn.this
+		}
+		return Any
+	case "super", "arguments":
+		return Any
+	}
+
+	v := c.scope.lookup(t.Name)
+	if v == nil {
+		// undeclared names are reported by the compiler
+		return Any
+	}
+
+	return c.typeOf(v)
+}
+
+func (c *checker) unary(t *ast.UnaryExpr) Type {
+	x := c.expr(t.Operand, nil)
+
+	switch t.Operator {
+	case ast.NOT:
+		return Boolean
+	case ast.SUB, ast.BNT:
+		if !c.isNumeric(x) {
+			c.errorf(t.Pos, "An arithmetic operand must be of type 'any', 'number' or an enum type")
+		}
+		return Number
+	case ast.ADD:
+		return Number
+	}
+
+	return Any
+}
+
+func (c *checker) binary(t *ast.BinaryExpr, expected Type) Type {
+	l := c.expr(t.Left, nil)
+
+	switch t.Operator {
+	case ast.LAND:
+		return union(l, c.expr(t.Right, expected))
+	case ast.LOR, ast.NOR:
+		return union(nonNull(l), c.expr(t.Right, expected))
+	case ast.INSTANCEOF:
+		// the right side can be the name of a native type that is not declared
+		return Boolean
+	}
+
+	r := c.expr(t.Right, nil)
+
+	switch t.Operator {
+	case ast.ADD:
+		switch {
+		case c.isString(l) || c.isString(r):
+			return String
+		case c.isNumeric(l) && c.isNumeric(r):
+			return Number
+		case c.isPrimitive(l) && c.isPrimitive(r):
+			c.errorf(t.Position(), "Operator '+' cannot be applied to types '%v' and '%v'", l, r)
+		}
+		return Any
+
+	case ast.SUB, ast.MUL, ast.DIV, ast.MOD, ast.POW, ast.AND, ast.BOR, ast.XOR, ast.LSH, ast.RSH, ast.URSH:
+		if !c.isNumeric(l) && c.isPrimitive(l) {
+			c.errorf(t.Left.Position(), "The left-hand side of an arithmetic operation must be of type 'any', 'number' or an enum type")
+		}
+		if !c.isNumeric(r) && c.isPrimitive(r) {
+			c.errorf(t.Right.Position(), "The right-hand side of an arithmetic operation must be of type 'any', 'number' or an enum type")
+		}
+		return Number
+
+	case ast.EQL, ast.NEQ, ast.SEQ, ast.SNE:
+		lb, rb := c.primitive(l), c.primitive(r)
+		if lb != nil && rb != nil && lb != rb {
+			c.errorf(t.Position(), "This comparison appears to be unintentional because the types '%v' and '%v' have no overlap", l, r)
+		}
+		return Boolean
+
+	case ast.LSS, ast.LEQ, ast.GTR, ast.GEQ, ast.IN:
+		return Boolean
+	}
+
+	return Any
+}
+
+// primitive returns the primitive type of t or nil if it is
+// not a string, number or boolean.
+func (c *checker) primitive(t Type) *Basic {
+	switch t := c.underlying(t).(type) {
+	case *Basic:
+		switch t {
+		case String, Number, Boolean:
+			return t
+		}
+	case *Literal:
+		return t.Base
+	case *Enum:
+		return t.base()
+	}
+	return nil
+}
+
+func (c *checker) isPrimitive(t Type) bool {
+	return c.primitive(t) != nil
+}
+
+func (c *checker) isString(t Type) bool {
+	return c.primitive(t) == String
+}
+
+// isNumeric returns true if t can be used in arithmetic operations.
+func (c *checker) isNumeric(t Type) bool {
+	switch c.primitive(t) {
+	case String, Boolean:
+		return false
+	}
+	return true
+}
+
+// nonNull returns t without null and undefined.
+func nonNull(t Type) Type {
+	u, ok := t.(*Union)
+	if !ok {
+		return t
+	}
+
+	var types []Type
+	for _, t := range u.Types {
+		if t != Null && t != Undefined {
+			types = append(types, t)
+		}
+	}
+	return union(types...)
+}
+
+func (c *checker) objectLiteral(t *ast.MapDeclExpr, expected Type) Type {
+	if len(t.List) == 0 && expected == nil {
+		// an empty object is usually filled later
+		return Any
+	}
+
+	exp, _ := c.underlying(expected).(*Object)
+
+	o := newObject("")
+	o.Open = true
+
+	// the methods of the object are not checked with the this of the context
+	if c.fn != nil {
+		this := c.fn.this
+		c.fn.this = nil
+		defer func() { c.fn.this = this }()
+	}
+
+	spreadAny := false
+
+	for _, kv := range t.List {
+		if kv.Key == "" {
+			// a spread: { ...a }
+			s, ok := c.underlying(c.expr(kv.Value, nil)).(*Object)
+			if !ok {
+				spreadAny = true
+				continue
+			}
+			for _, name := range s.names {
+				o.set(s.Props[name])
+			}
+			continue
+		}
+
+		var pe Type
+		if exp != nil {
+			if p, ok := exp.Props[kv.Key]; ok {
+				pe = p.Type
+			} else {
+				pe = exp.Index
+			}
+		}
+
+		v := c.expr(kv.Value, pe)
+		if !c.hasLiterals(pe) {
+			v = widen(v)
+		}
+
+		o.set(&Prop{Name: kv.Key, Type: v})
+	}
+
+	if spreadAny {
+		return Any
+	}
+
+	return o
+}
+
+func (c *checker) arrayLiteral(t *ast.ArrayDeclExpr, expected Type) Type {
+	var elem Type
+
+	switch e := c.underlying(expected).(type) {
+	case *Array:
+		elem = e.Elem
+	case *Tuple:
+		if len(e.Elems) == len(t.List) && !hasSpread(t.List) {
+			elems := make([]Type, len(t.List))
+			for i, x := range t.List {
+				elems[i] = c.expr(x, e.Elems[i])
+			}
+			return &Tuple{Elems: elems}
+		}
+	}
+
+	if len(t.List) == 0 {
+		if elem != nil {
+			return &Array{Elem: elem}
+		}
+		return &Array{Elem: Any}
+	}
+
+	types := make([]Type, len(t.List))
+	for i, x := range t.List {
+		if s, ok := x.(*ast.SpreadExpr); ok {
+			types[i] = c.elemType(c.expr(s.X, nil))
+			continue
+		}
+		types[i] = c.expr(x, elem)
+		if elem != nil {
+			c.checkAssign(x.Position(), x, types[i], elem)
+		}
+		if !c.hasLiterals(elem) {
+			types[i] = widen(types[i])
+		}
+	}
+
+	return &Array{Elem: union(types...)}
+}
+
+// hasLiterals returns true if t requires literal values.
+func (c *checker) hasLiterals(t Type) bool {
+	switch u := c.underlying(t).(type) {
+	case *Literal, *Enum:
+		return true
+	case *Union:
+		for _, t := range u.Types {
+			if c.hasLiterals(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasSpread(list []ast.Expr) bool {
+	for _, x := range list {
+		if _, ok := x.(*ast.SpreadExpr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// elemType returns the type of the values of a collection.
+func (c *checker) elemType(t Type) Type {
+	switch t := c.underlying(t).(type) {
+	case *Array:
+		return t.Elem
+	case *Tuple:
+		return union(t.Elems...)
+	case *Object:
+		if t.Index != nil {
+			return t.Index
+		}
+		if t.NumIndex != nil {
+			return t.NumIndex
+		}
+	}
+
+	if c.isString(t) {
+		return String
+	}
+
+	return Any
+}
+
+func (c *checker) index(t *ast.IndexExpr) Type {
+	x := c.expr(t.Left, nil)
+	i := c.expr(t.Index, nil)
+
+	switch u := c.underlying(x).(type) {
+	case *Array:
+		return u.Elem
+
+	case *Tuple:
+		if l, ok := i.(*Literal); ok && l.Base == Number {
+			if n, err := strconv.Atoi(l.Value); err == nil && n >= 0 && n < len(u.Elems) {
+				return u.Elems[n]
+			}
+		}
+		return union(u.Elems...)
+
+	case *Object:
+		if l, ok := i.(*Literal); ok && l.Base == String {
+			if p, ok := u.Props[l.Value]; ok {
+				return p.Type
+			}
+		}
+		if u.NumIndex != nil && c.primitive(i) == Number {
+			return u.NumIndex
+		}
+		if u.Index != nil {
+			return u.Index
+		}
+	}
+
+	if c.isString(x) {
+		return String
+	}
+
+	return Any
+}
+
+// member returns the type of the property name of t. ok is
+// false if t is known not to have it.
+func (c *checker) member(t Type, name string) (Type, bool) {
+	switch u := c.underlying(t).(type) {
+	case *Object:
+		if p, ok := u.Props[name]; ok {
+			return p.Type, true
+		}
+		if u.Index != nil {
+			return u.Index, true
+		}
+		return nil, false
+
+	case *Basic:
+		switch u {
+		case String:
+			return c.builtinMember("String", nil, name)
+		case Number:
+			return c.builtinMember("Number", nil, name)
+		case Boolean:
+			return c.builtinMember("Boolean", nil, name)
+		}
+		return Any, true
+
+	case *Literal:
+		return c.member(u.Base, name)
+
+	case *Enum:
+		return c.member(u.base(), name)
+
+	case *Array:
+		return c.builtinMember("Array", []Type{u.Elem}, name)
+
+	case *Tuple:
+		return c.builtinMember("Array", []Type{union(u.Elems...)}, name)
+
+	case *Class:
+		if p, ok := u.Static.Props[name]; ok {
+			return p.Type, true
+		}
+		switch name {
+		case "name", "prototype":
+			return Any, true
+		}
+		return nil, false
+
+	case *Namespace:
+		if v, ok := u.scope.values[name]; ok {
+			return c.typeOf(v), true
+		}
+		return nil, false
+
+	case *Union:
+		var types []Type
+		known := false
+		for _, m := range u.Types {
+			if m == Null || m == Undefined {
+				continue
+			}
+			known = true
+			if mt, ok := c.member(m, name); ok {
+				types = append(types, mt)
+			}
+		}
+		if known && len(types) == 0 {
+			return nil, false
+		}
+		return union(types...), true
+
+	case *TypeParam:
+		if u.Constraint != nil {
+			return c.member(u.Constraint, name)
+		}
+	}
+
+	return Any, true
+}
+
+// builtinMember returns a member of an interface of the definitions
+// like String or Array<T>. Empty interfaces are not checked.
+func (c *checker) builtinMember(iface string, args []Type, name string) (Type, bool) {
+	n, ok := c.global.types[iface].(*Named)
+	if !ok {
+		return Any, true
+	}
+
+	o, ok := c.underlying(&Named{decl: n.decl, Args: args}).(*Object)
+	if !ok || o.empty() {
+		return Any, true
+	}
+
+	if p, ok := o.Props[name]; ok {
+		return p.Type, true
+	}
+
+	return nil, false
+}
+
+// property returns the type of a property that is read or written.
+// Unlike member, object literals are open so their properties
+// can be added after they are created.
+func (c *checker) property(t Type, name string) (Type, bool) {
+	if typ, ok := c.member(t, name); ok {
+		return typ, true
+	}
+
+	if o, ok := c.underlying(t).(*Object); ok && o.Open {
+		return Any, true
+	}
+
+	return nil, false
+}
+
+func (c *checker) funcLiteral(t *ast.FuncDeclExpr, expected Type) Type {
+	var exp *Func
+	if fs := c.signatures(expected); len(fs) == 1 {
+		exp = fs[0]
+	}
+
+	sig := c.funcSignature(nil, t.Args, t.Variadic, t.Result, c.scope, exp)
+
+	var this Type
+	if c.fn != nil {
+		this = c.fn.this
+	}
+
+	result := c.funcBody(sig, nil, t.Args, t.Body, t.Async, t.Generator, this, t.Result != nil)
+	if t.Result == nil {
+		sig.Result = result
+	}
+
+	return sig
+}
+
+// callType checks a call to a value of type fn and returns its result.
+func (c *checker) callType(fn Type, args []ast.Expr, spread bool, pos ast.Position) Type {
+	switch u := c.underlying(fn).(type) {
+	case *Func:
+		return c.callFunc(u, args, spread, pos)
+
+	case *Overloads:
+		return c.callOverloads(u.Funcs, args, spread, pos)
+
+	case *Object:
+		switch len(u.Calls) {
+		case 0:
+			c.errorf(pos, "This expression is not callable. Type '%v' has no call signatures", fn)
+		case 1:
+			return c.callFunc(u.Calls[0], args, spread, pos)
+		default:
+			return c.callOverloads(u.Calls, args, spread, pos)
+		}
+
+	case *Class:
+		c.errorf(pos, "Value of type '%v' is not callable. Did you mean to include 'new'?", fn)
+
+	case *Literal, *Array, *Tuple, *Enum, *Namespace:
+		c.errorf(pos, "This expression is not callable. Type '%v' has no call signatures", fn)
+
+	case *Basic:
+		if c.isPrimitive(u) {
+			c.errorf(pos, "This expression is not callable. Type '%v' has no call signatures", fn)
+		}
+	}
+
+	for _, a := range args {
+		c.expr(a, nil)
+	}
+
+	return Any
+}
+
+func (c *checker) callFunc(f *Func, args []ast.Expr, spread bool, pos ast.Position) Type {
+	c.checkArity(f, len(args), spread, pos)
+
+	m := typeParamMap(f)
+	types := make([]Type, len(args))
+
+	// function literals are checked after the other arguments
+	// to type their parameters with the inferred types.
+	for i, a := range args {
+		if _, ok := a.(*ast.FuncDeclExpr); ok && m != nil {
+			continue
+		}
+		pt := f.param(i)
+		types[i] = c.expr(a, subst(pt, m))
+		if m != nil && pt != nil {
+			c.infer(pt, types[i], m)
+		}
+	}
+
+	for i, a := range args {
+		if types[i] != nil {
+			continue
+		}
+		pt := f.param(i)
+		types[i] = c.expr(a, subst(pt, m))
+		if pt != nil {
+			c.infer(pt, types[i], m)
+		}
+	}
+
+	bindDefaults(m)
+
+	for i, a := range args {
+		pt := f.param(i)
+		if pt == nil {
+			continue
+		}
+		if _, ok := a.(*ast.SpreadExpr); ok {
+			continue
+		}
+		pt = subst(pt, m)
+		if !c.assignable(types[i], pt) {
+			c.errorf(a.Position(), "Argument of type '%v' is not assignable to parameter of type '%v'", types[i], pt)
+			continue
+		}
+		c.excessProps(a, pt)
+	}
+
+	return subst(f.Result, m)
+}
+
+func (c *checker) callOverloads(funcs []*Func, args []ast.Expr, spread bool, pos ast.Position) Type {
+	types := make([]Type, len(args))
+	for i, a := range args {
+		types[i] = c.expr(a, nil)
+	}
+
+outer:
+	for _, f := range funcs {
+		if !spread && !arityMatches(f, len(args)) {
+			continue
+		}
+
+		m := typeParamMap(f)
+		for i, t := range types {
+			if pt := f.param(i); pt != nil && m != nil {
+				c.infer(pt, t, m)
+			}
+		}
+		bindDefaults(m)
+
+		for i, t := range types {
+			if _, ok := args[i].(*ast.SpreadExpr); ok {
+				continue
+			}
+			if pt := f.param(i); pt != nil && !c.assignable(t, subst(pt, m)) {
+				continue outer
+			}
+		}
+
+		return subst(f.Result, m)
+	}
+
+	c.errorf(pos, "No overload matches this call")
+	return Any
+}
+
+func arityMatches(f *Func, n int) bool {
+	return n >= f.minArgs() && (f.Variadic || n <= len(f.Params))
+}
+
+func (c *checker) checkArity(f *Func, n int, spread bool, pos ast.Position) {
+	if spread || arityMatches(f, n) {
+		return
+	}
+
+	min, max := f.minArgs(), len(f.Params)
+
+	switch {
+	case f.Variadic:
+		c.errorf(pos, "Expected at least %d arguments, but got %d", min, n)
+	case min == max:
+		c.errorf(pos, "Expected %d arguments, but got %d", min, n)
+	default:
+		c.errorf(pos, "Expected %d-%d arguments, but got %d", min, max, n)
+	}
+}
+
+// typeParamMap returns the type parameters of f to infer or nil.
+func typeParamMap(f *Func) map[*TypeParam]Type {
+	if len(f.TypeParams) == 0 {
+		return nil
+	}
+	m := make(map[*TypeParam]Type, len(f.TypeParams))
+	for _, p := range f.TypeParams {
+		m[p] = nil
+	}
+	return m
+}
+
+// bindDefaults binds the type parameters that could not be inferred.
+func bindDefaults(m map[*TypeParam]Type) {
+	for p, t := range m {
+		if t == nil {
+			if p.Default != nil {
+				m[p] = p.Default
+			} else {
+				m[p] = Any
+			}
+		}
+	}
+}
+
+func (c *checker) newInstance(t *ast.NewInstanceExpr) Type {
+	typ := c.expr(t.Name, nil)
+
+	var ctors []*Func
+
+	switch u := c.underlying(typ).(type) {
+	case *Class:
+		ctors = u.Ctors
+	case *Object:
+		if len(u.Ctors) == 0 {
+			c.errorf(t.Position(), "This expression is not constructable. Type '%v' has no construct signatures", typ)
+		}
+		ctors = u.Ctors
+	}
+
+	switch len(ctors) {
+	case 0:
+		for _, a := range t.Args {
+			c.expr(a, nil)
+		}
+		return Any
+	case 1:
+		return c.callFunc(ctors[0], t.Args, t.Spread, t.Position())
+	default:
+		return c.callOverloads(ctors, t.Args, t.Spread, t.Position())
+	}
+}
+
+// await returns the type of the value of a promise.
+func (c *checker) await(t Type) Type {
+	switch u := t.(type) {
+	case *Named:
+		if c.isPromise(u) {
+			if len(u.Args) == 0 {
+				return Any
+			}
+			return u.Args[0]
+		}
+	case *Union:
+		types := make([]Type, len(u.Types))
+		for i, t := range u.Types {
+			types[i] = c.await(t)
+		}
+		return union(types...)
+	}
+	return t
+}
+
+func (c *checker) isPromise(n *Named) bool {
+	p, ok := c.global.types["Promise"].(*Named)
+	return ok && p.decl == n.decl
+}
+
+// promiseOf returns the type Promise<t>.
+func (c *checker) promiseOf(t Type) Type {
+	p, ok := c.global.types["Promise"].(*Named)
+	if !ok {
+		return Any
+	}
+	return &Named{decl: p.decl, Args: []Type{t}}
+}
+
+// excessProps reports the properties of an object literal
+// that are not declared in the type it is assigned to.
+func (c *checker) excessProps(e ast.Expr, dst Type) {
+	lit, ok := e.(*ast.MapDeclExpr)
+	if !ok {
+		return
+	}
+
+	o, ok := c.underlying(dst).(*Object)
+	if !ok || o.Index != nil || o.Open || o.empty() {
+		return
+	}
+
+	for _, kv := range lit.List {
+		if kv.Key == "" {
+			continue
+		}
+		p, ok := o.Props[kv.Key]
+		if !ok {
+			c.errorf(kv.Value.Position(), "Object literal may only specify known properties, and '%s' does not exist in type '%v'", kv.Key, dst)
+			continue
+		}
+		c.excessProps(kv.Value, p.Type)
+	}
+}
@@ -0,0 +1,565 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// libTypes are types of the standard TypeScript library that
+// are not declared in native.d.ts and are checked as any.
+var libTypes = map[string]bool{
+	"ArrayLike":            true,
+	"AsyncGenerator":       true,
+	"AsyncIterable":        true,
+	"Awaited":              true,
+	"Error":                true,
+	"Exclude":              true,
+	"Extract":              true,
+	"Generator":            true,
+	"InstanceType":         true,
+	"Iterable":             true,
+	"IterableIterator":     true,
+	"Iterator":             true,
+	"Omit":                 true,
+	"Parameters":           true,
+	"Pick":                 true,
+	"PromiseLike":          true,
+	"ReturnType":           true,
+	"Symbol":               true,
+	"TemplateStringsArray": true,
+}
+
+// resolve returns the type of a type annotation. Errors are only
+// reported if report is true so definition files are not checked.
+func (c *checker) resolve(t ast.TypeExpr, s *scope, report bool) Type {
+	switch t := t.(type) {
+	case nil:
+		return Any
+
+	case *ast.TypeRef:
+		return c.resolveRef(t, s, report)
+
+	case *ast.LiteralType:
+		return literalType(t.Kind, t.Value)
+
+	case *ast.ArrayType:
+		return &Array{Elem: c.resolve(t.Elem, s, report)}
+
+	case *ast.TupleType:
+		elems := make([]Type, len(t.Elems))
+		for i, e := range t.Elems {
+			elems[i] = c.resolve(e, s, report)
+		}
+		return &Tuple{Elems: elems}
+
+	case *ast.UnionType:
+		types := make([]Type, len(t.Types))
+		for i, e := range t.Types {
+			types[i] = c.resolve(e, s, report)
+		}
+		return union(types...)
+
+	case *ast.IntersectionType:
+		return c.intersection(t, s, report)
+
+	case *ast.FuncType:
+		return c.resolveFunc(t, s, report)
+
+	case *ast.ObjectType:
+		o := newObject("")
+		c.addMembers(o, t, s, report, false)
+		return o
+	}
+
+	return Any
+}
+
+func literalType(kind ast.Type, value string) Type {
+	switch kind {
+	case ast.STRING, ast.RUNE:
+		return &Literal{Base: String, Value: value}
+	case ast.INT, ast.HEX, ast.FLOAT:
+		return &Literal{Base: Number, Value: value}
+	case ast.TRUE, ast.FALSE:
+		return &Literal{Base: Boolean, Value: value}
+	case ast.NULL:
+		return Null
+	case ast.UNDEFINED:
+		return Undefined
+	}
+	return Any
+}
+
+func (c *checker) resolveRef(t *ast.TypeRef, s *scope, report bool) Type {
+	args := make([]Type, len(t.Args))
+	for i, a := range t.Args {
+		args[i] = c.resolve(a, s, report)
+	}
+
+	arg := func(i int) Type {
+		if i < len(args) {
+			return args[i]
+		}
+		return Any
+	}
+
+	switch t.Name {
+	case "Array", "ReadonlyArray":
+		return &Array{Elem: arg(0)}
+	case "Record":
+		o := newObject("")
+		o.Index = arg(1)
+		return o
+	case "Partial":
+		return c.partial(arg(0))
+	case "Readonly", "Required", "NonNullable":
+		return arg(0)
+	case "Function":
+		return anyFunc()
+	case "Object":
+		return Any
+	case "String":
+		return String
+	case "Number", "byte":
+		return Number
+	case "Boolean":
+		return Boolean
+	}
+
+	var typ Type
+	if i := strings.LastIndexByte(t.Name, '.'); i != -1 {
+		if ns := c.lookupNamespace(t.Name[:i], s); ns != nil {
+			typ = ns.scope.types[t.Name[i+1:]]
+		}
+	} else {
+		typ = s.lookupType(t.Name)
+	}
+
+	if typ == nil {
+		if report && !libTypes[t.Name] {
+			c.errorf(t.Pos, "Cannot find name '%s'", t.Name)
+		}
+		return Any
+	}
+
+	if n, ok := typ.(*Named); ok && len(args) > 0 {
+		return &Named{decl: n.decl, Args: args}
+	}
+
+	return typ
+}
+
+// lookupNamespace returns the namespace of a qualified name like http.Request.
+func (c *checker) lookupNamespace(name string, s *scope) *Namespace {
+	parts := strings.Split(name, ".")
+
+	v := s.lookup(parts[0])
+	if v == nil {
+		return nil
+	}
+
+	ns, ok := c.typeOf(v).(*Namespace)
+	if !ok {
+		return nil
+	}
+
+	for _, p := range parts[1:] {
+		v, ok := ns.scope.values[p]
+		if !ok {
+			return nil
+		}
+		if ns, ok = c.typeOf(v).(*Namespace); !ok {
+			return nil
+		}
+	}
+
+	return ns
+}
+
+// anyFunc is the type of a function that can receive any argument.
+func anyFunc() *Func {
+	return &Func{
+		Params:   []*Param{{Name: "args", Type: &Array{Elem: Any}}},
+		Variadic: true,
+		Result:   Any,
+	}
+}
+
+// partial returns t with all the properties optional.
+func (c *checker) partial(t Type) Type {
+	o, ok := c.underlying(t).(*Object)
+	if !ok {
+		return t
+	}
+
+	p := newObject(o.Name)
+	for _, name := range o.names {
+		prop := *o.Props[name]
+		prop.Optional = true
+		p.add(&prop)
+	}
+	p.Index = o.Index
+	p.NumIndex = o.NumIndex
+	return p
+}
+
+// intersection merges the members of object types. Other types are any.
+func (c *checker) intersection(t *ast.IntersectionType, s *scope, report bool) Type {
+	o := newObject("")
+
+	for _, e := range t.Types {
+		u, ok := c.underlying(c.resolve(e, s, report)).(*Object)
+		if !ok {
+			return Any
+		}
+		o.inherit(u)
+	}
+
+	return o
+}
+
+func (c *checker) resolveFunc(t *ast.FuncType, s *scope, report bool) *Func {
+	f := &Func{TypeParams: newTypeParams(t.TypeParams), Variadic: t.Variadic}
+	ps := c.withTypeParams(s, f.TypeParams, t.TypeParams, report)
+
+	for _, p := range t.Params {
+		f.Params = append(f.Params, &Param{
+			Name:     paramName(p),
+			Type:     c.resolve(p.Type, ps, report),
+			Optional: p.Optional || p.Default != nil,
+		})
+	}
+
+	f.Result = c.resolve(t.Result, ps, report)
+	return f
+}
+
+func paramName(f *ast.Field) string {
+	if f.Name == "" {
+		return "arg"
+	}
+	return f.Name
+}
+
+// withTypeParams returns a scope with the type parameters declared.
+func (c *checker) withTypeParams(s *scope, tps []*TypeParam, params []*ast.TypeParam, report bool) *scope {
+	if len(params) == 0 {
+		return s
+	}
+
+	ps := newScope(s)
+	for i, p := range params {
+		if i < len(tps) {
+			ps.types[p.Name] = tps[i]
+		}
+	}
+
+	for i, p := range params {
+		if i >= len(tps) {
+			break
+		}
+		tp := tps[i]
+		if p.Constraint != nil && tp.Constraint == nil {
+			tp.Constraint = c.resolve(p.Constraint, ps, report)
+		}
+		if p.Default != nil && tp.Default == nil {
+			tp.Default = c.resolve(p.Default, ps, report)
+		}
+	}
+
+	return ps
+}
+
+// addMembers adds the members of an object type. If static is true only
+// the static members of a declared class are added and otherwise
+// only the instance members.
+func (c *checker) addMembers(o *Object, body *ast.ObjectType, s *scope, report, static bool) {
+	for _, m := range body.Members {
+		if m.Static != static {
+			continue
+		}
+
+		switch {
+		case m.KeyType != nil:
+			t := c.resolve(m.Type, s, report)
+			if c.resolve(m.KeyType, s, report) == Number {
+				o.NumIndex = t
+			} else {
+				o.Index = t
+			}
+
+		case m.Method && m.Name == "":
+			o.Calls = append(o.Calls, c.resolveFunc(m.Type.(*ast.FuncType), s, report))
+
+		case m.Method && (m.Name == "new" || m.Name == "constructor"):
+			o.Ctors = append(o.Ctors, c.resolveFunc(m.Type.(*ast.FuncType), s, report))
+
+		default:
+			o.add(&Prop{
+				Name:     m.Name,
+				Type:     c.resolve(m.Type, s, report),
+				Optional: m.Optional,
+				Readonly: m.Readonly,
+			})
+		}
+	}
+}
+
+// underlying returns the type referenced by a named type.
+func (c *checker) underlying(t Type) Type {
+	for {
+		n, ok := t.(*Named)
+		if !ok {
+			return t
+		}
+		t = c.resolveNamed(n)
+	}
+}
+
+func (c *checker) resolveNamed(n *Named) Type {
+	if n.underlying != nil {
+		return n.underlying
+	}
+
+	d := n.decl
+
+	if d.body == nil {
+		if d.resolving {
+			// a declaration that references itself like type A = A
+			return Any
+		}
+		d.resolving = true
+		body := d.build(d)
+		d.resolving = false
+		d.body = body
+	}
+
+	t := d.body
+
+	if len(d.params) > 0 {
+		m := make(map[*TypeParam]Type, len(d.params))
+		for i, p := range d.params {
+			switch {
+			case i < len(n.Args):
+				m[p] = n.Args[i]
+			case p.Default != nil:
+				m[p] = p.Default
+			default:
+				m[p] = Any
+			}
+		}
+		t = subst(t, m)
+	}
+
+	n.underlying = t
+	return t
+}
+
+func (c *checker) buildInterface(d *typeDecl) Type {
+	o := newObject(d.name)
+
+	var bases []*Object
+
+	for _, t := range d.interfaces {
+		s := c.paramScope(d, t.TypeParams)
+		c.addMembers(o, t.Body, s, d.report, false)
+
+		for _, ext := range t.Extends {
+			if base, ok := c.underlying(c.resolve(ext, s, d.report)).(*Object); ok {
+				bases = append(bases, base)
+			}
+		}
+	}
+
+	for _, ext := range d.extensions {
+		o.add(ext())
+	}
+
+	for _, base := range bases {
+		o.inherit(base)
+	}
+
+	return o
+}
+
+// declaredClass returns the type of a class of a definition file.
+func (c *checker) declaredClass(d *typeDecl) Type {
+	cl := &Class{
+		Name:       d.name,
+		TypeParams: d.params,
+		Instance:   instanceOf(d),
+		Static:     newObject("typeof " + d.name),
+	}
+
+	for _, t := range d.interfaces {
+		if !t.Class {
+			continue
+		}
+
+		s := c.paramScope(d, t.TypeParams)
+		c.addMembers(cl.Static, t.Body, s, false, true)
+
+		for _, m := range t.Body.Members {
+			if m.Static || !m.Method || (m.Name != "constructor" && m.Name != "new") {
+				continue
+			}
+			f := c.resolveFunc(m.Type.(*ast.FuncType), s, false)
+			f.TypeParams = append(d.params, f.TypeParams...)
+			f.Result = cl.Instance
+			cl.Ctors = append(cl.Ctors, f)
+		}
+	}
+
+	if len(cl.Ctors) == 0 {
+		cl.Ctors = []*Func{{TypeParams: d.params, Result: cl.Instance}}
+	}
+
+	return cl
+}
+
+// instanceOf returns the type of the instances of a class.
+func instanceOf(d *typeDecl) *Named {
+	n := &Named{decl: d}
+	for _, p := range d.params {
+		n.Args = append(n.Args, p)
+	}
+	return n
+}
+
+// declareClass declares a class of the source. The members
+// are resolved the first time the class is used.
+func (c *checker) declareClass(s *scope, t *ast.ClassDeclStmt) {
+	d := &typeDecl{
+		name:   t.Name,
+		params: newTypeParams(t.TypeParams),
+		scope:  s,
+		report: true,
+	}
+
+	d.build = func(d *typeDecl) Type {
+		return c.classInstance(t, d)
+	}
+
+	s.types[t.Name] = &Named{decl: d}
+	s.values[t.Name] = &symbol{
+		constant: true,
+		declared: true,
+		exported: t.Exported,
+		init:     func() Type { return c.classType(t, d) },
+	}
+}
+
+func (c *checker) classInstance(t *ast.ClassDeclStmt, d *typeDecl) Type {
+	o := newObject(t.Name)
+	s := c.paramScope(d, t.TypeParams)
+
+	for _, f := range t.Fields {
+		if !f.Static {
+			o.add(&Prop{Name: f.Name, Type: c.fieldType(f, s), Readonly: f.Readonly})
+		}
+	}
+
+	for _, f := range t.Functions {
+		if f.Static || f.Name == "constructor" {
+			continue
+		}
+
+		switch {
+		case f.Getter:
+			o.set(&Prop{Name: f.Name, Type: c.resolve(f.Result, s, true)})
+		case f.Setter:
+			if _, ok := o.Props[f.Name]; !ok && len(f.Args.List) > 0 {
+				o.add(&Prop{Name: f.Name, Type: c.resolve(f.Args.List[0].Type, s, true)})
+			}
+		default:
+			o.add(&Prop{Name: f.Name, Type: c.funcSignature(f.TypeParams, f.Args, f.Variadic, f.Result, s, nil)})
+		}
+	}
+
+	if base := c.baseClass(t, s); base != nil {
+		if bo, ok := c.underlying(base.Instance).(*Object); ok {
+			o.inherit(bo)
+		}
+	}
+
+	return o
+}
+
+// classType returns the type of the class value.
+func (c *checker) classType(t *ast.ClassDeclStmt, d *typeDecl) Type {
+	cl := &Class{
+		Name:       t.Name,
+		TypeParams: d.params,
+		Instance:   instanceOf(d),
+		Static:     newObject("typeof " + t.Name),
+	}
+
+	s := c.paramScope(d, t.TypeParams)
+
+	for _, f := range t.Fields {
+		if f.Static {
+			cl.Static.add(&Prop{Name: f.Name, Type: c.fieldType(f, s), Readonly: f.Readonly})
+		}
+	}
+
+	for _, f := range t.Functions {
+		switch {
+		case f.Name == "constructor":
+			ctor := c.funcSignature(f.TypeParams, f.Args, f.Variadic, nil, s, nil)
+			ctor.TypeParams = d.params
+			ctor.Result = cl.Instance
+			cl.Ctors = []*Func{ctor}
+		case f.Static:
+			cl.Static.add(&Prop{Name: f.Name, Type: c.funcSignature(f.TypeParams, f.Args, f.Variadic, f.Result, s, nil)})
+		}
+	}
+
+	base := c.baseClass(t, s)
+	if base != nil {
+		cl.Static.inherit(base.Static)
+	}
+
+	if cl.Ctors == nil {
+		if base != nil {
+			// the constructor is inherited
+			for _, f := range base.Ctors {
+				ctor := *f
+				ctor.Result = cl.Instance
+				cl.Ctors = append(cl.Ctors, &ctor)
+			}
+		} else {
+			cl.Ctors = []*Func{{TypeParams: d.params, Result: cl.Instance}}
+		}
+	}
+
+	return cl
+}
+
+// baseClass returns the class that t extends or nil.
+func (c *checker) baseClass(t *ast.ClassDeclStmt, s *scope) *Class {
+	if t.Extends == nil {
+		return nil
+	}
+
+	c.silent++
+	defer func() { c.silent-- }()
+
+	cl, _ := c.underlying(c.exprIn(t.Extends, nil, s)).(*Class)
+	return cl
+}
+
+// fieldType returns the type of a class field.
+func (c *checker) fieldType(f *ast.VarDeclStmt, s *scope) Type {
+	if f.Type != nil {
+		return c.resolve(f.Type, s, true)
+	}
+
+	if f.Value == nil {
+		return Any
+	}
+
+	c.silent++
+	defer func() { c.silent-- }()
+	return c.inferVar(c.exprIn(f.Value, nil, s), false)
+}
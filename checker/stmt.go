@@ -0,0 +1,586 @@
+package checker
+
+import (
+	"github.com/scorredoira/dune/ast"
+)
+
+// funcSignature returns the signature of a function declaration. The
+// parameters without annotation take the type of the expected signature
+// if the function is passed where a function type is required.
+func (c *checker) funcSignature(tps []*ast.TypeParam, args *ast.Arguments, variadic bool,
+	result ast.TypeExpr, s *scope, expected *Func) *Func {
+	f := &Func{TypeParams: newTypeParams(tps), Variadic: variadic}
+	ps := c.withTypeParams(s, f.TypeParams, tps, true)
+
+	var list []*ast.Field
+	if args != nil {
+		list = args.List
+	}
+
+	for i, a := range list {
+		p := &Param{Name: paramName(a), Optional: a.Optional || a.Default != nil}
+
+		var exp Type
+		if expected != nil {
+			exp = expected.param(i)
+		}
+
+		switch {
+		case a.Type != nil:
+			p.Type = c.resolve(a.Type, ps, true)
+		case variadic && i == len(list)-1:
+			if exp == nil {
+				exp = Any
+			}
+			p.Type = &Array{Elem: exp}
+		case exp != nil:
+			p.Type = exp
+		case a.Default != nil:
+			c.silent++
+			p.Type = widen(c.exprIn(a.Default, nil, ps))
+			c.silent--
+		default:
+			p.Type = Any
+		}
+
+		f.Params = append(f.Params, p)
+	}
+
+	if result != nil {
+		f.Result = c.resolve(result, ps, true)
+	} else {
+		f.Result = Any
+	}
+
+	return f
+}
+
+// funcBody checks the body of a function and returns the type of
+// the values that it returns.
+func (c *checker) funcBody(sig *Func, tps []*ast.TypeParam, args *ast.Arguments, body *ast.BlockStmt,
+	async, generator bool, this Type, declaredResult bool) Type {
+	scope, fn := c.scope, c.fn
+	defer func() { c.scope, c.fn = scope, fn }()
+
+	c.scope = newScope(c.withTypeParams(c.scope, sig.TypeParams, tps, true))
+	c.fn = &funcContext{async: async, generator: generator, this: this}
+	if declaredResult {
+		c.fn.result = sig.Result
+	}
+
+	if args != nil {
+		for i, a := range args.List {
+			typ := sig.Params[i].Type
+			if a.Pattern != nil {
+				c.bindPattern(a.Pattern, typ)
+				continue
+			}
+			c.scope.values[a.Name] = &symbol{typ: typ, declared: a.Type != nil}
+		}
+	}
+
+	if body != nil {
+		c.block(body)
+	}
+
+	if generator {
+		return Any
+	}
+
+	result := Type(Void)
+	if len(c.fn.returns) > 0 {
+		types := make([]Type, len(c.fn.returns))
+		for i, t := range c.fn.returns {
+			types[i] = widen(t)
+		}
+		result = union(types...)
+	}
+
+	if async {
+		return c.promiseOf(result)
+	}
+
+	return result
+}
+
+// declareFunc declares a function. Its signature is resolved
+// the first time it is used.
+func (c *checker) declareFunc(s *scope, t *ast.FuncDeclStmt) {
+	s.values[t.Name] = &symbol{
+		constant: true,
+		declared: true,
+		exported: t.Exported,
+		init: func() Type {
+			return c.funcSignature(t.TypeParams, t.Args, t.Variadic, t.Result, s, nil)
+		},
+	}
+}
+
+func (c *checker) funcDecl(t *ast.FuncDeclStmt) {
+	var sig *Func
+	if v, ok := c.scope.values[t.Name]; ok {
+		sig, _ = c.typeOf(v).(*Func)
+	}
+	if sig == nil {
+		sig = c.funcSignature(t.TypeParams, t.Args, t.Variadic, t.Result, c.scope, nil)
+	}
+
+	c.funcBody(sig, t.TypeParams, t.Args, t.Body, t.Async, t.Generator, nil, t.Result != nil)
+}
+
+// checkExtension checks a method declared with Type.prototype.name.
+func (c *checker) checkExtension(t *ast.FuncDeclStmt) {
+	var this Type
+	switch t.ReceiverType {
+	case "String":
+		this = String
+	case "Array", "Bytes":
+		this = &Array{Elem: Any}
+	default:
+		this = c.scope.lookupType(t.ReceiverType)
+	}
+
+	sig := c.funcSignature(t.TypeParams, t.Args, t.Variadic, t.Result, c.scope, nil)
+	c.funcBody(sig, t.TypeParams, t.Args, t.Body, t.Async, t.Generator, this, t.Result != nil)
+}
+
+// checkTopVar checks a top level variable declared in s.
+func (c *checker) checkTopVar(s *scope, t *ast.VarDeclStmt) {
+	v, ok := s.values[t.Name]
+	if !ok {
+		c.localVar(t)
+		return
+	}
+
+	typ := c.typeOf(v)
+
+	if t.Value == nil {
+		return
+	}
+
+	if t.Type == nil {
+		// evaluate it again to report the errors
+		c.expr(t.Value, nil)
+		return
+	}
+
+	c.checkAssign(t.Value.Position(), t.Value, c.expr(t.Value, typ), typ)
+}
+
+func (c *checker) localVar(t *ast.VarDeclStmt) {
+	var typ Type
+
+	switch {
+	case t.Type != nil:
+		typ = c.resolve(t.Type, c.scope, true)
+		if t.Value != nil {
+			c.checkAssign(t.Value.Position(), t.Value, c.expr(t.Value, typ), typ)
+		}
+	case t.Value != nil:
+		typ = c.inferVar(c.expr(t.Value, nil), t.Const)
+	default:
+		typ = Any
+	}
+
+	if t.Pattern != nil {
+		c.bindPattern(t.Pattern, typ)
+		return
+	}
+
+	c.scope.values[t.Name] = &symbol{typ: typ, declared: t.Type != nil, constant: t.Const}
+}
+
+// bindPattern declares the names of a destructuring pattern
+// that is initialized with a value of type t.
+func (c *checker) bindPattern(p *ast.PatternExpr, t Type) {
+	for i, e := range p.Elements {
+		if e.Target == nil {
+			continue
+		}
+
+		var typ Type
+
+		switch {
+		case e.Rest && p.IsObject:
+			typ = Any
+		case e.Rest:
+			typ = &Array{Elem: c.elemType(t)}
+		case p.IsObject:
+			pt, ok := c.property(t, e.Key)
+			if !ok {
+				c.errorf(e.Pos, "Property '%s' does not exist on type '%v'", e.Key, t)
+				pt = Any
+			}
+			typ = pt
+		default:
+			if u, ok := c.underlying(t).(*Tuple); ok && i < len(u.Elems) {
+				typ = u.Elems[i]
+			} else {
+				typ = c.elemType(t)
+			}
+		}
+
+		if e.Default != nil {
+			d := c.expr(e.Default, typ)
+			if typ == Any {
+				typ = widen(d)
+			}
+		}
+
+		switch target := e.Target.(type) {
+		case *ast.IdentExpr:
+			c.scope.values[target.Name] = &symbol{typ: typ}
+		case *ast.PatternExpr:
+			c.bindPattern(target, typ)
+		}
+	}
+}
+
+// checkAssign reports an error if a value of type t is not assignable to dst.
+// e is the expression of the value.
+func (c *checker) checkAssign(pos ast.Position, e ast.Expr, t, dst Type) {
+	if c.assignable(t, dst) {
+		c.excessProps(e, dst)
+		return
+	}
+
+	if o, ok := c.underlying(dst).(*Object); ok {
+		if _, ok := c.underlying(t).(*Object); ok {
+			if name := c.missing(t, o); name != "" {
+				c.errorf(pos, "Property '%s' is missing in type '%v' but required in type '%v'", name, t, dst)
+				return
+			}
+		}
+	}
+
+	c.errorf(pos, "Type '%v' is not assignable to type '%v'", t, dst)
+}
+
+func (c *checker) assign(t *ast.AsignStmt) {
+	var dst Type
+
+	switch l := t.Left.(type) {
+	case *ast.IdentExpr:
+		if v := c.scope.lookup(l.Name); v != nil {
+			if v.constant {
+				c.errorf(l.Pos, "Cannot assign to '%s' because it is a constant", l.Name)
+				c.expr(t.Value, nil)
+				return
+			}
+			dst = c.typeOf(v)
+		}
+
+	case *ast.SelectorExpr:
+		x := c.expr(l.X, nil)
+		typ, ok := c.property(x, l.Sel.Name)
+		if !ok {
+			c.errorf(l.Sel.Pos, "Property '%s' does not exist on type '%v'", l.Sel.Name, x)
+		}
+		dst = typ
+
+	case *ast.IndexExpr:
+		dst = c.index(l)
+	}
+
+	v := c.expr(t.Value, dst)
+	if dst != nil {
+		c.checkAssign(t.Value.Position(), t.Value, v, dst)
+	}
+}
+
+func (c *checker) returnStmt(t *ast.ReturnStmt) {
+	if c.fn == nil || c.fn.generator {
+		c.expr(t.Value, nil)
+		return
+	}
+
+	exp := c.fn.result
+	if exp != nil && c.fn.async {
+		exp = c.await(exp)
+	}
+
+	typ := c.expr(t.Value, exp)
+	if c.fn.async {
+		typ = c.await(typ)
+	}
+
+	if t.Value == nil {
+		typ = Void
+	}
+
+	if exp == nil {
+		c.fn.returns = append(c.fn.returns, typ)
+		return
+	}
+
+	if t.Value != nil {
+		c.checkAssign(t.Value.Position(), t.Value, typ, exp)
+	}
+}
+
+func (c *checker) forStmt(t *ast.ForStmt) {
+	scope := c.scope
+	c.scope = newScope(scope)
+	defer func() { c.scope = scope }()
+
+	switch {
+	case t.OfExpression != nil:
+		c.forVar(t.Declaration, c.elemType(c.expr(t.OfExpression, nil)))
+
+	case t.InExpression != nil:
+		var key Type = String
+		x := c.expr(t.InExpression, nil)
+		switch c.underlying(x).(type) {
+		case *Array, *Tuple:
+			key = Number
+		default:
+			if c.isString(x) {
+				key = Number
+			}
+		}
+		c.forVar(t.Declaration, key)
+
+	default:
+		for _, d := range t.Declaration {
+			c.stmt(d)
+		}
+		if t.Expression != nil {
+			c.expr(t.Expression, nil)
+		}
+		if t.Step != nil {
+			c.stmt(t.Step)
+		}
+	}
+
+	c.block(t.Body)
+}
+
+// forVar declares the variable of a for in or for of loop.
+func (c *checker) forVar(decls []ast.Stmt, t Type) {
+	if len(decls) == 0 {
+		return
+	}
+
+	v, ok := decls[0].(*ast.VarDeclStmt)
+	if !ok {
+		return
+	}
+
+	if v.Type != nil {
+		t = c.resolve(v.Type, c.scope, true)
+	}
+
+	if v.Pattern != nil {
+		c.bindPattern(v.Pattern, t)
+		return
+	}
+
+	c.scope.values[v.Name] = &symbol{typ: t, declared: v.Type != nil, constant: v.Const}
+}
+
+func (c *checker) classDecl(t *ast.ClassDeclStmt) {
+	n, ok := c.scope.types[t.Name].(*Named)
+	if !ok {
+		return
+	}
+
+	d := n.decl
+	inst := instanceOf(d)
+	cls := c.typeOf(c.scope.values[t.Name])
+
+	if t.Extends != nil {
+		c.expr(t.Extends, nil)
+	}
+
+	scope, fn := c.scope, c.fn
+	c.scope = c.paramScope(d, t.TypeParams)
+
+	for _, f := range t.Fields {
+		if f.Value == nil {
+			continue
+		}
+
+		this := Type(inst)
+		if f.Static {
+			this = cls
+		}
+		c.fn = &funcContext{this: this}
+
+		if f.Type == nil {
+			c.expr(f.Value, nil)
+			continue
+		}
+
+		typ := c.resolve(f.Type, c.scope, true)
+		c.checkAssign(f.Value.Position(), f.Value, c.expr(f.Value, typ), typ)
+	}
+
+	c.fn = fn
+
+	for _, f := range t.Functions {
+		this := Type(inst)
+		if f.Static {
+			this = cls
+		}
+		sig := c.funcSignature(f.TypeParams, f.Args, f.Variadic, f.Result, c.scope, nil)
+		c.funcBody(sig, f.TypeParams, f.Args, f.Body, f.Async, f.Generator, this, f.Result != nil)
+	}
+
+	for _, ref := range t.Implements {
+		c.implements(t, inst, c.resolve(ref, c.scope, true))
+	}
+
+	c.scope = scope
+}
+
+// implements checks that the instances of a class have
+// the members of an interface that it implements.
+func (c *checker) implements(t *ast.ClassDeclStmt, inst, iface Type) {
+	o, ok := c.underlying(iface).(*Object)
+	if !ok {
+		return
+	}
+
+	for _, name := range o.names {
+		p := o.Props[name]
+
+		typ, ok := c.member(inst, name)
+		if !ok {
+			if !p.Optional {
+				c.errorf(t.Pos, "Class '%s' incorrectly implements interface '%v'. Property '%s' is missing in type '%s'",
+					t.Name, iface, name, t.Name)
+			}
+			continue
+		}
+
+		if !c.assignable(typ, p.Type) {
+			c.errorf(t.Pos, "Property '%s' in type '%s' is not assignable to the same property in base type '%v'",
+				name, t.Name, iface)
+		}
+	}
+}
+
+// block checks a block in a new scope.
+func (c *checker) block(b *ast.BlockStmt) {
+	if b == nil {
+		return
+	}
+	c.stmts(b.List)
+}
+
+// stmts checks a list of statements in a new scope.
+func (c *checker) stmts(list []ast.Stmt) {
+	scope := c.scope
+	c.scope = newScope(scope)
+	defer func() { c.scope = scope }()
+
+	c.declareLocal(list)
+
+	for _, s := range list {
+		c.stmt(s)
+	}
+}
+
+// declareLocal hoists the functions, classes and enums of a block
+// so they can be used before they are declared.
+func (c *checker) declareLocal(list []ast.Stmt) {
+	for _, s := range list {
+		switch t := s.(type) {
+		case *ast.FuncDeclStmt:
+			if t.ReceiverType == "" {
+				c.declareFunc(c.scope, t)
+			}
+		case *ast.ClassDeclStmt:
+			c.declareClass(c.scope, t)
+		case *ast.EnumDeclStmt:
+			c.declareEnum(c.scope, t)
+		}
+	}
+}
+
+func (c *checker) stmt(s ast.Stmt) {
+	switch t := s.(type) {
+	case *ast.VarDeclStmt:
+		c.localVar(t)
+
+	case *ast.FuncDeclStmt:
+		if t.ReceiverType != "" {
+			c.checkExtension(t)
+			return
+		}
+		c.funcDecl(t)
+
+	case *ast.ClassDeclStmt:
+		c.classDecl(t)
+
+	case *ast.AsignStmt:
+		c.assign(t)
+
+	case *ast.IndexAsignStmt:
+		c.expr(t.IndexExpr, nil)
+		c.expr(t.Value, nil)
+
+	case *ast.IncStmt:
+		if !c.isNumeric(c.expr(t.Left, nil)) {
+			c.errorf(t.Position(), "An arithmetic operand must be of type 'any', 'number' or an enum type")
+		}
+
+	case *ast.CallStmt:
+		c.expr(t.CallExpr, nil)
+
+	case *ast.TailCallStmt:
+		c.expr(t.CallExpr, nil)
+
+	case *ast.AwaitStmt:
+		c.expr(t.AwaitExpr, nil)
+
+	case *ast.YieldStmt:
+		c.expr(t.YieldExpr, nil)
+
+	case *ast.BlockStmt:
+		c.block(t)
+
+	case *ast.IfStmt:
+		for _, b := range t.IfBlocks {
+			c.expr(b.Condition, nil)
+			c.block(b.Body)
+		}
+		c.block(t.Else)
+
+	case *ast.WhileStmt:
+		c.expr(t.Expression, nil)
+		c.block(t.Body)
+
+	case *ast.ForStmt:
+		c.forStmt(t)
+
+	case *ast.SwitchStmt:
+		c.expr(t.Expression, nil)
+		for _, b := range t.Blocks {
+			c.expr(b.Expression, nil)
+			c.stmts(b.Stmts)
+		}
+		if t.Default != nil {
+			c.stmts(t.Default.Stmts)
+		}
+
+	case *ast.TryStmt:
+		c.block(t.Body)
+		if t.Catch != nil {
+			scope := c.scope
+			c.scope = newScope(scope)
+			if t.CatchIdent != nil {
+				c.scope.values[t.CatchIdent.Name] = &symbol{typ: Any}
+			}
+			c.block(t.Catch)
+			c.scope = scope
+		}
+		c.block(t.Finally)
+
+	case *ast.ReturnStmt:
+		c.returnStmt(t)
+
+	case *ast.ThrowStmt:
+		c.expr(t.Value, nil)
+	}
+}
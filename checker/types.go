@@ -0,0 +1,357 @@
+package checker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// Type is a static type.
+type Type interface {
+	String() string
+}
+
+// Basic is a primitive type.
+type Basic struct {
+	Name string
+}
+
+func (t *Basic) String() string {
+	return t.Name
+}
+
+var (
+	Any       = &Basic{"any"}
+	Unknown   = &Basic{"unknown"}
+	Number    = &Basic{"number"}
+	String    = &Basic{"string"}
+	Boolean   = &Basic{"boolean"}
+	Void      = &Basic{"void"}
+	Null      = &Basic{"null"}
+	Undefined = &Basic{"undefined"}
+	Never     = &Basic{"never"}
+)
+
+// Literal is the type of a constant string, number or boolean.
+type Literal struct {
+	Base  *Basic
+	Value string
+}
+
+func (t *Literal) String() string {
+	if t.Base == String {
+		return strconv.Quote(t.Value)
+	}
+	return t.Value
+}
+
+// Array is an array of Elem.
+type Array struct {
+	Elem Type
+}
+
+func (t *Array) String() string {
+	switch t.Elem.(type) {
+	case *Union, *Func, *Overloads:
+		return "(" + t.Elem.String() + ")[]"
+	}
+	return t.Elem.String() + "[]"
+}
+
+// Tuple is an array with a fixed number of elements.
+type Tuple struct {
+	Elems []Type
+}
+
+func (t *Tuple) String() string {
+	return "[" + join(t.Elems, ", ") + "]"
+}
+
+// Union is a value of any of its types.
+type Union struct {
+	Types []Type
+}
+
+func (t *Union) String() string {
+	return join(t.Types, " | ")
+}
+
+// Param is a function parameter.
+type Param struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+// Func is the signature of a function. If it is variadic the type
+// of the last parameter is the array of the rest of the arguments.
+type Func struct {
+	TypeParams []*TypeParam
+	Params     []*Param
+	Variadic   bool
+	Result     Type
+}
+
+func (t *Func) String() string {
+	var b strings.Builder
+
+	if len(t.TypeParams) > 0 {
+		names := make([]string, len(t.TypeParams))
+		for i, p := range t.TypeParams {
+			names[i] = p.Name
+		}
+		b.WriteString("<" + strings.Join(names, ", ") + ">")
+	}
+
+	b.WriteString("(")
+	for i, p := range t.Params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if t.Variadic && i == len(t.Params)-1 {
+			b.WriteString("...")
+		}
+		b.WriteString(p.Name)
+		if p.Optional {
+			b.WriteString("?")
+		}
+		b.WriteString(": ")
+		b.WriteString(p.Type.String())
+	}
+	b.WriteString(") => ")
+	b.WriteString(t.Result.String())
+	return b.String()
+}
+
+// minArgs returns the number of required arguments.
+func (t *Func) minArgs() int {
+	for i, p := range t.Params {
+		if p.Optional || (t.Variadic && i == len(t.Params)-1) {
+			return i
+		}
+	}
+	return len(t.Params)
+}
+
+// param returns the type of the parameter that receives the argument i
+// or nil if there are more arguments than parameters.
+func (t *Func) param(i int) Type {
+	n := len(t.Params)
+	if t.Variadic && i >= n-1 {
+		if a, ok := t.Params[n-1].Type.(*Array); ok {
+			return a.Elem
+		}
+		return Any
+	}
+	if i < n {
+		return t.Params[i].Type
+	}
+	return nil
+}
+
+// Overloads is a function with several signatures.
+type Overloads struct {
+	Funcs []*Func
+}
+
+func (t *Overloads) String() string {
+	return fmt.Sprintf("%v (+%d overloads)", t.Funcs[0], len(t.Funcs)-1)
+}
+
+// Prop is a property of an object.
+type Prop struct {
+	Name     string
+	Type     Type
+	Optional bool
+	Readonly bool
+}
+
+// Object is the type of interfaces, class instances and object literals.
+type Object struct {
+	Name     string // the name of interfaces and classes
+	Props    map[string]*Prop
+	Index    Type // [key: string]: T
+	NumIndex Type // [n: number]: T
+	Calls    []*Func
+	Ctors    []*Func
+	Open     bool // properties that are not declared are any
+	names    []string
+}
+
+func newObject(name string) *Object {
+	return &Object{Name: name, Props: make(map[string]*Prop)}
+}
+
+// add adds a property. A method that is declared again is an overload.
+func (t *Object) add(p *Prop) {
+	old, ok := t.Props[p.Name]
+	if !ok {
+		t.names = append(t.names, p.Name)
+		t.Props[p.Name] = p
+		return
+	}
+
+	// the properties can be shared with other objects so they are replaced
+	if f, ok := p.Type.(*Func); ok {
+		switch o := old.Type.(type) {
+		case *Func:
+			t.Props[p.Name] = &Prop{Name: p.Name, Type: &Overloads{Funcs: []*Func{o, f}}}
+			return
+		case *Overloads:
+			funcs := append(o.Funcs[:len(o.Funcs):len(o.Funcs)], f)
+			t.Props[p.Name] = &Prop{Name: p.Name, Type: &Overloads{Funcs: funcs}}
+			return
+		}
+	}
+
+	t.Props[p.Name] = p
+}
+
+// set adds or replaces a property.
+func (t *Object) set(p *Prop) {
+	if _, ok := t.Props[p.Name]; !ok {
+		t.names = append(t.names, p.Name)
+	}
+	t.Props[p.Name] = p
+}
+
+// inherit adds the members of base that are not declared in t.
+func (t *Object) inherit(base *Object) {
+	for _, name := range base.names {
+		if _, ok := t.Props[name]; !ok {
+			t.add(base.Props[name])
+		}
+	}
+	if t.Index == nil {
+		t.Index = base.Index
+	}
+	if t.NumIndex == nil {
+		t.NumIndex = base.NumIndex
+	}
+	if len(t.Calls) == 0 {
+		t.Calls = base.Calls
+	}
+}
+
+func (t *Object) empty() bool {
+	return len(t.Props) == 0 && t.Index == nil && t.NumIndex == nil && len(t.Calls) == 0
+}
+
+func (t *Object) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	if t.empty() {
+		return "{}"
+	}
+
+	var b strings.Builder
+	b.WriteString("{ ")
+	if t.Index != nil {
+		fmt.Fprintf(&b, "[key: string]: %v; ", t.Index)
+	}
+	for _, name := range t.names {
+		p := t.Props[name]
+		b.WriteString(name)
+		if p.Optional {
+			b.WriteString("?")
+		}
+		fmt.Fprintf(&b, ": %v; ", p.Type)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// TypeParam is a type parameter of a generic declaration.
+type TypeParam struct {
+	Name       string
+	Constraint Type
+	Default    Type
+}
+
+func (t *TypeParam) String() string {
+	return t.Name
+}
+
+// Class is the type of a class. It is used to create instances
+// and to access the static members.
+type Class struct {
+	Name       string
+	TypeParams []*TypeParam
+	Instance   Type
+	Static     *Object
+	Ctors      []*Func
+}
+
+func (t *Class) String() string {
+	return "typeof " + t.Name
+}
+
+// Enum is the type of the values of an enum.
+type Enum struct {
+	Name    string
+	Members map[string]*Literal
+}
+
+func (t *Enum) String() string {
+	return t.Name
+}
+
+// base returns string if all the values of the enum are strings.
+func (t *Enum) base() *Basic {
+	for _, v := range t.Members {
+		if v.Base != String {
+			return Number
+		}
+	}
+	return String
+}
+
+// Namespace is the type of namespaces, imported modules and enums.
+type Namespace struct {
+	Name  string
+	scope *scope
+}
+
+func (t *Namespace) String() string {
+	return t.Name
+}
+
+// Named is a reference to a declared interface, class or type alias.
+// It is resolved lazily so declarations can reference each other.
+type Named struct {
+	decl       *typeDecl
+	Args       []Type
+	underlying Type
+}
+
+func (t *Named) String() string {
+	if len(t.Args) == 0 {
+		return t.decl.name
+	}
+	return t.decl.name + "<" + join(t.Args, ", ") + ">"
+}
+
+// typeDecl is a named type declaration.
+type typeDecl struct {
+	name       string
+	params     []*TypeParam
+	scope      *scope
+	report     bool // report errors found resolving it
+	interfaces []*ast.InterfaceDeclStmt
+	build      func(d *typeDecl) Type
+	extensions []func() *Prop // methods added with Type.prototype.name
+	body       Type
+	resolving  bool
+}
+
+func join(types []Type, sep string) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = t.String()
+	}
+	return strings.Join(s, sep)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/dap"
+	"github.com/scorredoira/dune/filesystem"
+)
+
+// debug runs the program serving the Debug Adapter Protocol on
+// stdio or, if addr is not empty, to the first client that connects.
+func debug(programPath string, args []string, addr string) error {
+	p, err := loadProgram(programPath)
+	if err != nil {
+		return err
+	}
+
+	p.AddPermission("trusted")
+
+	vm := dune.NewVM(p)
+	vm.FileSystem = filesystem.OS
+
+	values := make([]dune.Value, len(args))
+	for i, arg := range args {
+		values[i] = dune.NewValue(arg)
+	}
+
+	s := dap.NewServer(vm, values...)
+
+	if addr == "" {
+		return s.ServeStdio()
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	fmt.Fprintf(os.Stderr, "Debugger listening on %s\n", l.Addr())
+
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return s.Serve(conn, conn)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scorredoira/dune/format"
+)
+
+// formatPaths formats the .ts files in paths. Directories are walked
+// recursively. If write is true the files are overwritten, otherwise
+// the result is written to stdout.
+func formatPaths(paths []string, write bool) error {
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if err := formatFile(path, write); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sourceFiles returns the files in paths and the .ts files
+// of the directories in paths, walked recursively.
+func sourceFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() && isSourceFile(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// isSourceFile returns true for .ts files that are not definitions.
+func isSourceFile(path string) bool {
+	return strings.HasSuffix(path, ".ts") && !strings.HasSuffix(path, ".d.ts")
+}
+
+func formatFile(path string, write bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	b, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !write {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+
+	if bytes.Equal(src, b) {
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, fi.Mode())
+}
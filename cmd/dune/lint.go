@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/filesystem"
+	"github.com/scorredoira/dune/lint"
+	"github.com/scorredoira/dune/parser"
+)
+
+// lintPaths checks the .ts files in paths and prints the problems
+// as text or as a JSON array. With fix it removes the unused imports.
+// It exits with status 1 if there are problems.
+func lintPaths(paths []string, asJSON, fix bool) error {
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	defs, err := parser.ParseDefinitions("native.d.ts", dune.TypeDefs())
+	if err != nil {
+		return err
+	}
+
+	diagnostics := []*lint.Diagnostic{}
+
+	for _, path := range files {
+		d, err := lintFile(path, fix, defs)
+		if err != nil {
+			return err
+		}
+		diagnostics = append(diagnostics, d...)
+	}
+
+	if asJSON {
+		b, err := json.MarshalIndent(diagnostics, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+func lintFile(path string, fix bool, defs *ast.File) ([]*lint.Diagnostic, error) {
+	m, err := parser.Parse(filesystem.OS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := lint.ReadConfig(filesystem.OS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := lint.Lint(m, config, defs)
+	if !fix {
+		return diagnostics, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, diagnostics := lint.Fix(src, diagnostics)
+	if string(b) == string(src) {
+		return diagnostics, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return diagnostics, os.WriteFile(path, b, fi.Mode())
+}
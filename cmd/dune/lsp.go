@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+
+	"github.com/scorredoira/dune/filesystem"
+	"github.com/scorredoira/dune/lsp"
+)
+
+// serveLSP serves the Language Server Protocol on stdio until the editor exits.
+func serveLSP() error {
+	return lsp.NewServer(filesystem.OS).Serve(os.Stdin, os.Stdout)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/scorredoira/dune"
 	"github.com/scorredoira/dune/binary"
+	"github.com/scorredoira/dune/checker"
 	"github.com/scorredoira/dune/filesystem"
 	"github.com/scorredoira/dune/parser"
 
@@ -27,7 +28,19 @@ func main() {
 	d := flag.Bool("d", false, "decompile")
 	r := flag.Bool("r", false, "list resources")
 	n := flag.Bool("n", false, "no optimizations")
+	check := flag.Bool("check", false, "type check")
 	ini := flag.Bool("init", false, "generate native.d.ts and tsconfig.json")
+	dbg := flag.Bool("debug", false, "debug serving the Debug Adapter Protocol on stdio")
+	dbgAddr := flag.String("debug-addr", "", "serve the debugger on a TCP address instead of stdio")
+	langServer := flag.Bool("lsp", false, "serve the Language Server Protocol on stdio")
+	profile := flag.String("profile", "", "write a pprof profile of the execution to the file")
+	cover := flag.String("cover", "", "write the LCOV coverage of the execution to the file")
+	coverHTML := flag.String("cover-html", "", "write an HTML coverage report of the execution to the file")
+	fmtSource := flag.Bool("fmt", false, "format the source files")
+	w := flag.Bool("w", false, "write the formatted source to the files instead of stdout")
+	lnt := flag.Bool("lint", false, "check the source files for likely bugs")
+	jsonOut := flag.Bool("json", false, "print the lint problems as JSON")
+	fix := flag.Bool("fix", false, "remove the unused imports found by the linter")
 	flag.Parse()
 
 	if *v {
@@ -68,6 +81,50 @@ func main() {
 		return
 	}
 
+	if *check {
+		if err := typeCheck(args[0]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *dbg {
+		if aLen == 0 {
+			fatal("expected the program to debug")
+		}
+		if err := debug(args[0], args[1:], *dbgAddr); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *fmtSource {
+		if aLen == 0 {
+			fatal("expected the files to format")
+		}
+		if err := formatPaths(args, *w); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *lnt {
+		if aLen == 0 {
+			fatal("expected the files to check")
+		}
+		if err := lintPaths(args, *jsonOut, *fix); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *langServer {
+		if err := serveLSP(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
 	if *r {
 		p, err := loadProgram(args[0])
 		if err != nil {
@@ -89,7 +146,8 @@ func main() {
 	}
 
 	if aLen > 0 {
-		if err := exec(args[0], args[1:]); err != nil {
+		opts := execOptions{profile: *profile, cover: *cover, coverHTML: *coverHTML}
+		if err := exec(args[0], args[1:], opts); err != nil {
 			fatal(err)
 		}
 		return
@@ -115,7 +173,42 @@ func build(p *dune.Program, out string) error {
 	return nil
 }
 
-func exec(programPath string, args []string) error {
+func typeCheck(programPath string) error {
+	path, err := findPath(programPath)
+	if err != nil {
+		return err
+	}
+
+	m, err := parser.Parse(filesystem.OS, path)
+	if err != nil {
+		return err
+	}
+
+	defs, err := parser.ParseDefinitions("native.d.ts", dune.TypeDefs())
+	if err != nil {
+		return err
+	}
+
+	errors := checker.Check(m, defs)
+	for _, err := range errors {
+		fmt.Println(err)
+	}
+
+	if len(errors) > 0 {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// execOptions are the reports written after the execution.
+type execOptions struct {
+	profile   string
+	cover     string
+	coverHTML string
+}
+
+func exec(programPath string, args []string, opts execOptions) error {
 	p, err := loadProgram(programPath)
 	if err != nil {
 		return err
@@ -132,10 +225,81 @@ func exec(programPath string, args []string) error {
 		values[i] = dune.NewValue(args[i])
 	}
 
+	var coverage *dune.Coverage
+	if opts.cover != "" || opts.coverHTML != "" {
+		coverage = dune.NewCoverage()
+		vm.SetCoverage(coverage)
+	}
+
+	if opts.profile != "" {
+		if err := vm.StartProfile(dune.NewProfiler()); err != nil {
+			return err
+		}
+	}
+
 	_, err = vm.Run(values...)
+
+	if opts.profile != "" {
+		if e := writeProfile(vm.StopProfile(), opts.profile); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if coverage != nil {
+		if e := writeCoverage(coverage, opts.cover, opts.coverHTML); e != nil && err == nil {
+			err = e
+		}
+	}
+
 	return err
 }
 
+func writeProfile(p *dune.Profiler, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeCoverage(c *dune.Coverage, lcov, html string) error {
+	if lcov != "" {
+		f, err := os.Create(lcov)
+		if err != nil {
+			return err
+		}
+		if err := c.WriteLCOV(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if html != "" {
+		f, err := os.Create(html)
+		if err != nil {
+			return err
+		}
+		if err := c.WriteHTML(f, filesystem.OS); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func loadProgram(programPath string) (*dune.Program, error) {
 	path, err := findPath(programPath)
 	if err != nil {
@@ -13,7 +13,7 @@ import (
 
 const GlobalNamespace = "::globalnamespace"
 
-var builtinFuncs = []string{"go", "defer", "panic", "T"}
+var builtinFuncs = []string{"go", "defer", "panic", "T", "Promise", "RegExp"}
 var builtinProperties []string
 
 func AddBuiltinFunc(name string) {
@@ -66,7 +66,7 @@ func NewCompiler() *compiler {
 }
 
 type selector struct {
-	optChainings []*Instruction
+	optChainings []instrRef
 }
 
 type compiler struct {
@@ -84,11 +84,42 @@ type compiler struct {
 	builtinFuncs      []string
 	builtinProperties []string
 	selectors         []*selector
+	currentClass      *Class               // the class being compiled
+	files             map[string]*ast.File // the source files by module prefix
+	decorated         []*decorated
+	shapes            []*shapeDecl
 }
 
-func (c *compiler) Compile(mod *ast.Module) (*Program, error) {
+// shapeDecl is an interface or a type alias that is added to the program.
+// The types are resolved when all the modules are compiled so they can
+// reference types declared in other modules.
+type shapeDecl struct {
+	shape *Shape
+	decls []ast.Stmt
+}
+
+// decorated is a function or a class with decorators. They are evaluated
+// after the file is compiled so they can reference any constant in it.
+type decorated struct {
+	decorators []*ast.Decorator
+	target     *[]*Decorator
+}
+
+func (c *compiler) Compile(mod *ast.Module) (p *Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p, err = nil, c.tooBig(r)
+		}
+	}()
+
 	compiled := make(map[string]bool)
 
+	c.files = make(map[string]*ast.File, len(mod.Modules)+1)
+	for path, file := range mod.Modules {
+		c.files[path] = file
+	}
+	c.files[""] = mod.File
+
 	// compile first the global namespace
 	c.modulePrefix = GlobalNamespace
 	if err := c.compileStmts(mod.File.Global); err != nil {
@@ -112,6 +143,8 @@ func (c *compiler) Compile(mod *ast.Module) (*Program, error) {
 		return nil, err
 	}
 
+	c.compileShapes()
+
 	if err := c.generateInits(); err != nil {
 		return nil, err
 	}
@@ -119,9 +152,34 @@ func (c *compiler) Compile(mod *ast.Module) (*Program, error) {
 	// make sure that the last instruction is a return
 	c.emit(op_ret, Void, Void, Void, ast.Position{})
 
+	if parser.Optimizations {
+		for _, f := range c.program.Functions {
+			optimize(f)
+		}
+	}
+
 	return c.program, nil
 }
 
+// tooBig returns the error of a program that has more registers, constants
+// or instructions than an address can encode. Other panics are not handled.
+func (c *compiler) tooBig(r interface{}) error {
+	e, ok := r.(*addressError)
+	if !ok {
+		panic(r)
+	}
+
+	var pos ast.Position
+	if fi := c.currentFunc; fi != nil {
+		if n := len(fi.function.Positions); n > 0 {
+			p := fi.function.Positions[n-1]
+			pos = ast.Position{FileName: c.program.Files[p.File], Line: p.Line, Column: p.Column}
+		}
+	}
+
+	return newError(pos, "the program is too big: %v", e)
+}
+
 func (c *compiler) compileModule(path string, modules map[string]*ast.File, compiled map[string]bool) error {
 	if compiled[path] {
 		return nil
@@ -164,10 +222,20 @@ func (c *compiler) compileFile(file *ast.File) error {
 		return err
 	}
 
+	if err := c.checkImports(file); err != nil {
+		return err
+	}
+
+	c.declareShapes(file.Types)
+
 	if err := c.compileStmts(file.Stms); err != nil {
 		return err
 	}
 
+	if err := c.compileDecorators(); err != nil {
+		return err
+	}
+
 	if err := c.setTargetOffsets(); err != nil {
 		return err
 	}
@@ -177,6 +245,7 @@ func (c *compiler) compileFile(file *ast.File) error {
 
 func (c *compiler) compileStmts(stms []ast.Stmt) error {
 	sort.Sort(ByPriority(stms))
+	sortBaseClasses(stms)
 
 	for _, node := range stms {
 		switch t := node.(type) {
@@ -204,6 +273,14 @@ func (c *compiler) compileStmts(stms []ast.Stmt) error {
 }
 
 func (c *compiler) compileVarDeclStmt(t *ast.VarDeclStmt) error {
+	if t.Pattern != nil {
+		src, err := c.compileExpr(t.Value, Void)
+		if err != nil {
+			return err
+		}
+		return c.compileDestructuring(t.Pattern, src, true, t.Exported)
+	}
+
 	name := t.Name
 
 	if ok, _ := c.isInScope(name); ok {
@@ -224,7 +301,7 @@ func (c *compiler) compileVarDeclStmt(t *ast.VarDeclStmt) error {
 	}
 
 	// the right hand is a expression
-	i := c.newRegister(name, t.Exported, nil)
+	i := c.newRegister(name, t.Exported, Void)
 	if _, err := c.compileExpr(t.Value, i); err != nil {
 		return err
 	}
@@ -232,6 +309,106 @@ func (c *compiler) compileVarDeclStmt(t *ast.VarDeclStmt) error {
 	return nil
 }
 
+// compileDestructuring assigns the elements of src to the targets of the pattern.
+// If declare is true the targets are new variables in the current scope.
+func (c *compiler) compileDestructuring(t *ast.PatternExpr, src Address, declare, exported bool) error {
+	// the keys of the elements to exclude them from a rest element
+	var keys []Address
+
+	for i, e := range t.Elements {
+		if e.Target == nil {
+			// a hole: [, b]
+			continue
+		}
+
+		var key Address
+		if t.IsObject {
+			key = c.program.addConstant(NewString(e.Key))
+			keys = append(keys, key)
+		} else {
+			key = NewAddress(AddrData, i)
+		}
+
+		// the register that receives the value
+		var dest Address
+		ident, isIdent := e.Target.(*ast.IdentExpr)
+		switch {
+		case isIdent && declare:
+			if ok, _ := c.isInScope(ident.Name); ok {
+				return newError(ident.Pos, "Redeclared identifier in the same block: '%s'", ident.Name)
+			}
+			dest = c.newRegister(ident.Name, exported, Void)
+		case isIdent:
+			var err error
+			dest, err = c.compileExpr(ident, Void)
+			if err != nil {
+				return err
+			}
+		default:
+			dest = c.newTempRegister()
+		}
+
+		if e.Rest {
+			if t.IsObject {
+				exclude := c.newTempRegister()
+				c.emit(op_arr, exclude, NewAddress(AddrData, len(keys)), Void, e.Pos)
+				for j, k := range keys {
+					c.emit(op_set, exclude, NewAddress(AddrData, j), k, e.Pos)
+				}
+				c.emit(op_rst, dest, src, exclude, e.Pos)
+			} else {
+				c.emit(op_rst, dest, src, key, e.Pos)
+			}
+		} else {
+			c.emit(op_dst, dest, src, key, e.Pos)
+		}
+
+		if e.Default != nil {
+			// only evaluate the default value if the value is undefined
+			x := NewAddress(AddrData, int(jumpIfDefined))
+			jump := c.emit(op_tjp, dest, Void, x, e.Pos)
+			start := c.pc()
+
+			v, err := c.compileExpr(e.Default, Void)
+			if err != nil {
+				return err
+			}
+			c.emit(op_mov, dest, v, Void, e.Pos)
+
+			jump.instr().B = NewAddress(AddrData, c.pc()-start)
+		}
+
+		switch s := e.Target.(type) {
+		case *ast.IdentExpr:
+		case *ast.PatternExpr:
+			if err := c.compileDestructuring(s, dest, declare, exported); err != nil {
+				return err
+			}
+		case *ast.SelectorExpr:
+			x, err := c.compileExpr(s.X, Void)
+			if err != nil {
+				return err
+			}
+			k := c.program.addConstant(NewString(s.Sel.Name))
+			c.emit(op_set, x, k, dest, s.Position())
+		case *ast.IndexExpr:
+			x, err := c.compileExpr(s.Left, Void)
+			if err != nil {
+				return err
+			}
+			k, err := c.compileExpr(s.Index, Void)
+			if err != nil {
+				return err
+			}
+			c.emit(op_set, x, k, dest, s.Position())
+		default:
+			return newError(e.Pos, "Invalid destructuring target")
+		}
+	}
+
+	return nil
+}
+
 func (c *compiler) compileEnumDeclStmt(t *ast.EnumDeclStmt) error {
 	name := c.registerName(t.Name)
 
@@ -248,7 +425,7 @@ func (c *compiler) compileEnumDeclStmt(t *ast.EnumDeclStmt) error {
 		}
 		enum.Values = append(enum.Values, &EnumValue{
 			Name:   v.Name,
-			KIndex: int(k.Value),
+			KIndex: int(k.Value()),
 		})
 	}
 
@@ -272,6 +449,14 @@ func (c *compiler) compileFuncDecl(t *ast.FuncDeclStmt, isClass bool) (*function
 				return nil, newError(t.Pos, "init functions can't be exported.")
 			}
 
+			if t.Async {
+				return nil, newError(t.Pos, "init functions can't be async.")
+			}
+
+			if t.Generator {
+				return nil, newError(t.Pos, "init functions can't be generators.")
+			}
+
 			// init functions are renamed to allow multiple versions
 			// They can't be called directly so it doesn't matter the renaming.
 			name = "@init"
@@ -304,8 +489,18 @@ func (c *compiler) compileFuncDecl(t *ast.FuncDeclStmt, isClass bool) (*function
 	}
 	f.Variadic = t.Variadic
 	f.Exported = t.Exported
+	f.Async = t.Async
+	f.Generator = t.Generator
 	f.Directives = t.Directives
 
+	if len(t.Decorators) > 0 {
+		c.decorated = append(c.decorated, &decorated{t.Decorators, &f.Decorators})
+	}
+
+	if f.Async && f.Generator {
+		return nil, newError(t.Pos, "Async generators are not supported.")
+	}
+
 	if !fi.anonymous {
 		// restart closures references when is a top function
 		c.closures = nil
@@ -328,14 +523,16 @@ func (c *compiler) compileFuncBody(t *ast.FuncDeclStmt, fi *functionInfo) error
 
 	// Create first the arguments because when the function is called
 	// they are copied directly to the beginning of the values.
-	for _, arg := range t.Args.List {
-		c.newRegister(arg.Name, false, nil)
-	}
+	args := c.newArgRegisters(t.Args)
 
 	// if it is a method reserve a register for the "this" object.
 	// but *after* params.
 	if fi.receiverType != "" {
-		c.newRegister("this", false, nil)
+		c.newRegister("this", false, Void)
+	}
+
+	if err := c.compileArgPatterns(t.Args, args); err != nil {
+		return err
 	}
 
 	// don't open a block because the arguments are declared in the current scope
@@ -369,6 +566,56 @@ func (c *compiler) compileFuncBody(t *ast.FuncDeclStmt, fi *functionInfo) error
 	return nil
 }
 
+// newArgRegisters creates a register for each argument. Destructured
+// arguments get a temp register and are unpacked by compileArgPatterns.
+func (c *compiler) newArgRegisters(args *ast.Arguments) []Address {
+	if args == nil {
+		return nil
+	}
+
+	regs := make([]Address, len(args.List))
+	for i, arg := range args.List {
+		if arg.Pattern != nil {
+			regs[i] = c.newTempRegister()
+		} else {
+			regs[i] = c.newRegister(arg.Name, false, Void)
+		}
+	}
+	return regs
+}
+
+// compileArgPatterns sets the default values of the arguments
+// that are not provided and unpacks destructured arguments.
+func (c *compiler) compileArgPatterns(args *ast.Arguments, regs []Address) error {
+	if args == nil {
+		return nil
+	}
+
+	for i, arg := range args.List {
+		if arg.Default != nil {
+			// the parameters that are not provided are undefined
+			c.currentFunc.function.Defaults = true
+
+			// skip the default value if the argument is not undefined
+			jump := c.emit(op_tjp, regs[i], Void, NewAddress(AddrData, int(jumpIfDefined)), arg.Pos)
+			pc := c.pc()
+
+			if _, err := c.compileExpr(arg.Default, regs[i]); err != nil {
+				return err
+			}
+
+			jump.instr().B = NewAddress(AddrData, c.pc()-pc)
+		}
+
+		if arg.Pattern != nil {
+			if err := c.compileDestructuring(arg.Pattern, regs[i], true, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (c *compiler) compileBlockStmt(t *ast.BlockStmt) error {
 	c.openScope()
 	if err := c.compileBlockStmtScope(t); err != nil {
@@ -417,6 +664,14 @@ func (c *compiler) compileStmt(stmt ast.Stmt) error {
 		if _, err := c.compileCallExpr(t.CallExpr, Void, false); err != nil {
 			return err
 		}
+	case *ast.AwaitStmt:
+		if _, err := c.compileAwaitExpr(t.AwaitExpr, Void); err != nil {
+			return err
+		}
+	case *ast.YieldStmt:
+		if _, err := c.compileYieldExpr(t.YieldExpr, Void); err != nil {
+			return err
+		}
 	case *ast.TailCallStmt:
 		if err := c.compileTailCallStmt(t.CallExpr); err != nil {
 			return err
@@ -477,7 +732,7 @@ func (c *compiler) compileDeleteStmt(t *ast.DeleteStmt) error {
 		return err
 	}
 
-	switch i.Kind {
+	switch i.Kind() {
 	case AddrClass:
 		return newError(t.Position(), "can't delete a Class member")
 	}
@@ -577,6 +832,7 @@ func (c *compiler) compileBreakStmt(t *ast.BreakStmt) error {
 
 func (c *compiler) compileBranchExit(targets []*branch, branch ast.Stmt) {
 	pos := branch.Position()
+	_, isBreak := branch.(*ast.BreakStmt)
 
 	for j := len(targets) - 1; j >= 0; j-- {
 		target := targets[j]
@@ -591,6 +847,12 @@ func (c *compiler) compileBranchExit(targets []*branch, branch ast.Stmt) {
 				c.emit(op_trx, Void, Void, Void, pos)
 			}
 		}
+
+		// the loops that are exited must close their iterators. A continue
+		// doesn't exit the loop that it targets.
+		if target.iterator != Void && (j > 0 || isBreak) {
+			c.emit(op_itc, target.iterator, Void, Void, pos)
+		}
 	}
 }
 
@@ -615,7 +877,7 @@ func (c *compiler) compileForStmt(t *ast.ForStmt) error {
 }
 
 func (c *compiler) compileForInOfStmt(t *ast.ForStmt, in bool) error {
-	c.openBranch(t)
+	b := c.openBranch(t)
 	c.openScope()
 
 	if len(t.Declaration) != 1 {
@@ -628,8 +890,8 @@ func (c *compiler) compileForInOfStmt(t *ast.ForStmt, in bool) error {
 		return newError(t.Position(), "Invalid range declaration")
 	}
 
-	// compile the expression that must return a map or array
-	var rng *Address
+	// compile the expression that must return a map, array or iterator
+	var rng Address
 	var err error
 	if in {
 		if rng, err = c.compileExpr(t.InExpression, Void); err != nil {
@@ -642,51 +904,83 @@ func (c *compiler) compileForInOfStmt(t *ast.ForStmt, in bool) error {
 	}
 
 	// this is the key variable
-	key := c.newRegister(dec.Name, false, nil)
+	var key Address
+	if dec.Pattern != nil {
+		key = c.newTempRegister()
+	} else {
+		key = c.newRegister(dec.Name, false, Void)
+	}
 
-	// create a temp array with the keys/index or values
-	items := c.newTempRegister()
+	var loopStart, bodyStart int
+	var loopBrk instrRef
 
 	if in {
+		// create a temp array with the keys/index
+		items := c.newTempRegister()
 		c.emit(op_key, items, rng, Void, dec.Pos)
-	} else {
-		c.emit(op_val, items, rng, Void, dec.Pos)
-	}
 
-	// get the length of the keys/index
-	iLen := c.newTempRegister()
-	c.emit(op_len, iLen, items, Void, ast.Position{})
+		// get the length of the keys/index
+		iLen := c.newTempRegister()
+		c.emit(op_len, iLen, items, Void, ast.Position{})
 
-	// create the counter
-	counter := c.newTempRegister()
+		// create the counter
+		counter := c.newTempRegister()
 
-	// initialize it with 0
-	k := c.program.addConstant(NewInt(0))
-	c.emit(op_ldk, counter, k, Void, ast.Position{})
+		// initialize it with 0
+		k := c.program.addConstant(NewInt(0))
+		c.emit(op_ldk, counter, k, Void, ast.Position{})
 
-	// the register that will hold the condition to continue
-	isLess := c.newTempRegister()
+		// the register that will hold the condition to continue
+		isLess := c.newTempRegister()
 
-	// skip the first step increment
-	c.emit(op_jmp, NewAddress(AddrData, 1), Void, Void, ast.Position{})
+		// skip the first step increment
+		c.emit(op_jmp, NewAddress(AddrData, 1), Void, Void, ast.Position{})
 
-	// this is start point where it needs to return each iteration
-	loopStart := c.pc()
-	t.SetContinuePC(loopStart)
+		// this is start point where it needs to return each iteration
+		loopStart = c.pc()
+		t.SetContinuePC(loopStart)
 
-	// the step increment part of the for
-	c.emit(op_inc, counter, Void, Void, ast.Position{})
+		// the step increment part of the for
+		c.emit(op_inc, counter, Void, Void, ast.Position{})
 
-	// set in isLess if counter < keys/values length
-	c.emit(op_lst, isLess, counter, iLen, ast.Position{})
+		// set in isLess if counter < keys/values length
+		c.emit(op_lst, isLess, counter, iLen, ast.Position{})
 
-	bodyStart := c.pc()
+		bodyStart = c.pc()
+
+		// conditional jump: test R(A) and jump R(B) instructions. R(C)=1 means jump if false
+		loopBrk = c.emit(op_tjp, isLess, Void, NewAddress(AddrData, 1), ast.Position{})
+
+		// assign the key
+		c.emit(op_get, key, items, counter, ast.Position{})
+	} else {
+		// create an iterator over the values. Generators and native
+		// iterators are consumed lazily.
+		itr := c.newTempRegister()
+		c.emit(op_itr, itr, rng, Void, dec.Pos)
+		b.iterator = itr
+
+		// the register that will hold the condition to continue
+		hasValue := c.newTempRegister()
+
+		// this is start point where it needs to return each iteration
+		loopStart = c.pc()
+		t.SetContinuePC(loopStart)
 
-	// conditional jump: test R(A) and jump R(B) instructions. R(C)=1 means jump if false
-	loopBrk := c.emit(op_tjp, isLess, Void, NewAddress(AddrData, 1), ast.Position{})
+		// assign the next value
+		c.emit(op_nxt, key, itr, hasValue, dec.Pos)
 
-	// assign the key
-	c.emit(op_get, key, items, counter, ast.Position{})
+		bodyStart = c.pc()
+
+		// conditional jump: test R(A) and jump R(B) instructions. R(C)=1 means jump if false
+		loopBrk = c.emit(op_tjp, hasValue, Void, NewAddress(AddrData, 1), ast.Position{})
+	}
+
+	if dec.Pattern != nil {
+		if err := c.compileDestructuring(dec.Pattern, key, true, false); err != nil {
+			return err
+		}
+	}
 
 	// the body of the loop
 	if err := c.compileBlockStmt(t.Body); err != nil {
@@ -701,7 +995,7 @@ func (c *compiler) compileForInOfStmt(t *ast.ForStmt, in bool) error {
 	t.SetBreakPC(bodyEnd)
 
 	// set the offset to jump when the condition for the loop fails
-	loopBrk.B = NewAddress(AddrData, bodyEnd-bodyStart-1)
+	loopBrk.instr().B = NewAddress(AddrData, bodyEnd-bodyStart-1)
 
 	c.closeScope()
 	c.closeBranch()
@@ -711,6 +1005,10 @@ func (c *compiler) compileForInOfStmt(t *ast.ForStmt, in bool) error {
 
 // del tipo "for next() {}"
 func (c *compiler) compileWhileStmt(t *ast.WhileStmt) error {
+	if t.Do {
+		return c.compileDoWhileStmt(t)
+	}
+
 	c.openBranch(t)
 	c.openScope()
 
@@ -743,7 +1041,54 @@ func (c *compiler) compileWhileStmt(t *ast.WhileStmt) error {
 	t.SetBreakPC(bodyEnd)
 
 	// set the offset to jump when the condition for the loop fails
-	loopBrk.B = NewAddress(AddrData, bodyEnd-bodyStart-1)
+	loopBrk.instr().B = NewAddress(AddrData, bodyEnd-bodyStart-1)
+
+	c.closeScope()
+	c.closeBranch()
+
+	return nil
+}
+
+// compileDoWhileStmt compiles the condition before the body like a while
+// and skips it the first iteration so continue can jump back to it.
+func (c *compiler) compileDoWhileStmt(t *ast.WhileStmt) error {
+	c.openBranch(t)
+	c.openScope()
+
+	// skip the condition the first iteration
+	skip := c.emit(op_jmp, Void, Void, Void, ast.Position{})
+
+	// this is start point where it needs to return each iteration
+	loopStart := c.pc()
+	t.SetContinuePC(loopStart)
+
+	r, err := c.compileExpr(t.Expression, Void)
+	if err != nil {
+		return err
+	}
+
+	bodyStart := c.pc()
+
+	// condition to continue looping. Will set later the jump length
+	// Set R(C) to 1 to make it jump if R(A) is false.
+	loopBrk := c.emit(op_tjp, r, Void, NewAddress(AddrData, 1), t.Pos)
+
+	skip.instr().A = NewAddress(AddrData, c.pc()-loopStart)
+
+	// the body of the loop
+	if err := c.compileBlockStmt(t.Body); err != nil {
+		return err
+	}
+
+	// jump back to iterate
+	steps := c.pc() - loopStart
+	c.emit(op_jpb, NewAddress(AddrData, steps), Void, Void, ast.Position{})
+
+	bodyEnd := c.pc()
+	t.SetBreakPC(bodyEnd)
+
+	// set the offset to jump when the condition for the loop fails
+	loopBrk.instr().B = NewAddress(AddrData, bodyEnd-bodyStart-1)
 
 	c.closeScope()
 	c.closeBranch()
@@ -759,7 +1104,7 @@ func (c *compiler) setTargetOffsets() error {
 			if offset < 0 {
 				panic("Invalid break offset")
 			}
-			b.inst.A = NewAddress(AddrData, offset)
+			b.inst.instr().A = NewAddress(AddrData, offset)
 		}
 
 		for _, cont := range t.continues {
@@ -768,7 +1113,7 @@ func (c *compiler) setTargetOffsets() error {
 			if offset < 0 {
 				panic("Invalid continue offset")
 			}
-			cont.inst.A = NewAddress(AddrData, offset)
+			cont.inst.instr().A = NewAddress(AddrData, offset)
 		}
 	}
 	return nil
@@ -808,15 +1153,16 @@ loop:
 	for i, l := fIndex+1, len(pr.Functions); i < l; i++ {
 		f := pr.Functions[i]
 
-		for _, inst := range f.Instructions {
-			if inst.A.Kind == AddrClosure {
-				inst.A = NewAddress(AddrClosure, c.closures[inst.A.Value].index)
+		for pc := range f.Instructions {
+			inst := &f.Instructions[pc]
+			if inst.A.Kind() == AddrClosure {
+				inst.A = NewAddress(AddrClosure, c.closures[inst.A.Value()].index)
 			}
-			if inst.B.Kind == AddrClosure {
-				inst.B = NewAddress(AddrClosure, c.closures[inst.B.Value].index)
+			if inst.B.Kind() == AddrClosure {
+				inst.B = NewAddress(AddrClosure, c.closures[inst.B.Value()].index)
 			}
-			if inst.C.Kind == AddrClosure {
-				inst.C = NewAddress(AddrClosure, c.closures[inst.C.Value].index)
+			if inst.C.Kind() == AddrClosure {
+				inst.C = NewAddress(AddrClosure, c.closures[inst.C.Value()].index)
 			}
 		}
 	}
@@ -859,7 +1205,7 @@ func (c *compiler) compileTryStmt(t *ast.TryStmt) error {
 	start := c.pc()
 
 	if t.CatchIdent != nil {
-		try.B = c.newRegister(t.CatchIdent.Name, true, nil)
+		try.instr().B = c.newRegister(t.CatchIdent.Name, true, Void)
 
 		// make the err register on scope from the beginning of the current scope
 		regs := c.currentFunc.function.Registers
@@ -868,7 +1214,7 @@ func (c *compiler) compileTryStmt(t *ast.TryStmt) error {
 	}
 
 	if t.Catch != nil {
-		try.A = NewAddress(AddrData, start)
+		try.instr().A = NewAddress(AddrData, start)
 
 		if err := c.compileBlockStmt(t.Catch); err != nil {
 			return err
@@ -879,12 +1225,12 @@ func (c *compiler) compileTryStmt(t *ast.TryStmt) error {
 		}
 	}
 
-	jump.A = NewAddress(AddrData, c.pc()-start)
+	jump.instr().A = NewAddress(AddrData, c.pc()-start)
 
 	if t.Finally != nil {
 		b.inFinally = true
 
-		try.C = NewAddress(AddrData, c.pc())
+		try.instr().C = NewAddress(AddrData, c.pc())
 
 		if err := c.compileBlockStmt(t.Finally); err != nil {
 			return err
@@ -927,7 +1273,7 @@ func (c *compiler) compileForWithStepStmt(t *ast.ForStmt) error {
 		}
 	}
 
-	firstj.A = NewAddress(AddrData, c.pc()-loopStart)
+	firstj.instr().A = NewAddress(AddrData, c.pc()-loopStart)
 
 	// the expression part of the for
 	r, err := c.compileExpr(t.Expression, Void)
@@ -954,7 +1300,7 @@ func (c *compiler) compileForWithStepStmt(t *ast.ForStmt) error {
 	t.SetBreakPC(pc)
 
 	// set the offset to jump when the condition for the loop fails
-	loopBrk.B = NewAddress(AddrData, pc-bodyStart-1)
+	loopBrk.instr().B = NewAddress(AddrData, pc-bodyStart-1)
 
 	c.closeScope()
 	c.closeBranch()
@@ -992,7 +1338,7 @@ func (c *compiler) compileSwitchStmt(t *ast.SwitchStmt) error {
 		return err
 	}
 
-	fallThroughs := make(map[int]*Instruction)
+	fallThroughs := make(map[int]instrRef)
 
 	for _, block := range t.Blocks {
 		b, err := c.compileExpr(block.Expression, Void)
@@ -1012,10 +1358,10 @@ func (c *compiler) compileSwitchStmt(t *ast.SwitchStmt) error {
 		if len(fallThroughs) > 0 {
 			totalLen := c.pc()
 			for k, i := range fallThroughs {
-				i.C = NewAddress(AddrData, totalLen-k)
+				i.instr().C = NewAddress(AddrData, totalLen-k)
 			}
 			// reset for the next case
-			fallThroughs = make(map[int]*Instruction)
+			fallThroughs = make(map[int]instrRef)
 		}
 
 		if err := c.compileCaseBlock(t, block, jump); err != nil {
@@ -1024,7 +1370,7 @@ func (c *compiler) compileSwitchStmt(t *ast.SwitchStmt) error {
 	}
 
 	if t.Default != nil {
-		if err := c.compileCaseBlock(t, t.Default, nil); err != nil {
+		if err := c.compileCaseBlock(t, t.Default, instrRef{}); err != nil {
 			return err
 		}
 	}
@@ -1035,7 +1381,7 @@ func (c *compiler) compileSwitchStmt(t *ast.SwitchStmt) error {
 	return nil
 }
 
-func (c *compiler) compileCaseBlock(t *ast.SwitchStmt, block *ast.CaseBlock, jump *Instruction) error {
+func (c *compiler) compileCaseBlock(t *ast.SwitchStmt, block *ast.CaseBlock, jump instrRef) error {
 	// this is start point where it needs to return each iteration
 	bodyStart := c.pc()
 
@@ -1049,9 +1395,9 @@ func (c *compiler) compileCaseBlock(t *ast.SwitchStmt, block *ast.CaseBlock, jum
 
 	c.closeScope()
 
-	if jump != nil {
+	if jump.fn != nil {
 		// jump to the next CASE.
-		jump.C = NewAddress(AddrData, c.pc()-bodyStart)
+		jump.instr().C = NewAddress(AddrData, c.pc()-bodyStart)
 	}
 
 	return nil
@@ -1063,7 +1409,7 @@ func (c *compiler) compileIfStmt(t *ast.IfStmt) error {
 		return c.compileIfBlockStmt(t)
 	}
 
-	exits := make(map[int]*Instruction)
+	exits := make(map[int]instrRef)
 
 	for _, branch := range t.IfBlocks {
 		// the expression part of the for
@@ -1090,7 +1436,7 @@ func (c *compiler) compileIfStmt(t *ast.IfStmt) error {
 		exits[c.pc()+1] = c.emit(op_jmp, Void, Void, Void, ast.Position{})
 
 		//jump to the nexto branch if the condition fails
-		jump.A = NewAddress(AddrData, c.pc()-bodyStart)
+		jump.instr().A = NewAddress(AddrData, c.pc()-bodyStart)
 	}
 
 	if t.Else != nil {
@@ -1102,7 +1448,7 @@ func (c *compiler) compileIfStmt(t *ast.IfStmt) error {
 	// now that all is processed, set the exit jumps
 	totalLen := c.pc()
 	for k, i := range exits {
-		i.A = NewAddress(AddrData, totalLen-k)
+		i.instr().A = NewAddress(AddrData, totalLen-k)
 	}
 
 	return nil
@@ -1131,15 +1477,15 @@ func (c *compiler) compileIfBlockStmt(t *ast.IfStmt) error {
 	}
 
 	// set how long is the jump
-	jump.B = NewAddress(AddrData, c.pc()-bodyStart)
+	jump.instr().B = NewAddress(AddrData, c.pc()-bodyStart)
 
 	return nil
 }
 
 // compileExpr compiles the expression and stores the result in dest
-func (c *compiler) compileExpr(t ast.Expr, dest *Address) (*Address, error) {
-	if dest.Kind == AddrConstant {
-		return nil, fmt.Errorf("can't modify a constant")
+func (c *compiler) compileExpr(t ast.Expr, dest Address) (Address, error) {
+	if dest.Kind() == AddrConstant {
+		return Void, fmt.Errorf("can't modify a constant")
 	}
 
 	switch t := t.(type) {
@@ -1163,10 +1509,21 @@ func (c *compiler) compileExpr(t ast.Expr, dest *Address) (*Address, error) {
 		return c.compileSelectorExpr(t, dest)
 	case *ast.FuncDeclExpr:
 		return c.compileFuncDeclExpr(t, dest)
+	case *ast.AwaitExpr:
+		return c.compileAwaitExpr(t, dest)
+	case *ast.YieldExpr:
+		return c.compileYieldExpr(t, dest)
 	case *ast.CallExpr:
 		return c.compileCallExpr(t, dest, true)
 	case *ast.NewInstanceExpr:
 		return c.compileNewInstanceExpr(t, dest)
+	case *ast.TemplateExpr:
+		return c.compileTemplateExpr(t, dest)
+	case *ast.SpreadExpr:
+		return Void, newError(t.Pos, "Unexpected spread operator")
+	case *ast.AsExpr:
+		// type assertions are only used by the type checker
+		return c.compileExpr(t.X, dest)
 	// case *ast.TypeofExpr:
 	// 	return c.compileTypeofExpr(t, dest)
 	default:
@@ -1174,7 +1531,54 @@ func (c *compiler) compileExpr(t ast.Expr, dest *Address) (*Address, error) {
 	}
 }
 
-func (c *compiler) compileFuncDeclExpr(t *ast.FuncDeclExpr, dest *Address) (*Address, error) {
+func (c *compiler) compileTemplateExpr(t *ast.TemplateExpr, dest Address) (Address, error) {
+	if t.Tag != nil {
+		// a tagged template is a call to the tag with an array of
+		// the strings and the values as the rest of the arguments.
+		strings := &ast.ArrayDeclExpr{Pos: t.Pos}
+		for _, s := range t.Strings {
+			strings.List = append(strings.List, &ast.ConstantExpr{Pos: t.Pos, Kind: ast.STRING, Value: s})
+		}
+
+		call := &ast.CallExpr{
+			Ident:  t.Tag,
+			Lparen: t.Pos,
+			Args:   append([]ast.Expr{strings}, t.Values...),
+			Rparen: t.Pos,
+			First:  true,
+		}
+		return c.compileCallExpr(call, dest, true)
+	}
+
+	// concatenate in a temp register because dest can
+	// be referenced by the values: s = `${s}foo`
+	r := c.newTempRegister()
+
+	k := c.program.addConstant(NewString(t.Strings[0]))
+	c.emit(op_ldk, r, k, Void, t.Pos)
+
+	for i, v := range t.Values {
+		a, err := c.compileExpr(v, Void)
+		if err != nil {
+			return Void, err
+		}
+		c.emit(op_add, r, r, a, v.Position())
+
+		if s := t.Strings[i+1]; s != "" {
+			k := c.program.addConstant(NewString(s))
+			c.emit(op_add, r, r, k, t.Pos)
+		}
+	}
+
+	if dest == Void {
+		return r, nil
+	}
+
+	c.emit(op_mov, dest, r, Void, t.Pos)
+	return dest, nil
+}
+
+func (c *compiler) compileFuncDeclExpr(t *ast.FuncDeclExpr, dest Address) (Address, error) {
 	// get the function address
 	i := len(c.program.Functions)
 
@@ -1183,6 +1587,8 @@ func (c *compiler) compileFuncDeclExpr(t *ast.FuncDeclExpr, dest *Address) (*Add
 		Name:      fmt.Sprintf("@lambda_%d", i),
 		Anonymous: true,
 		Variadic:  t.Variadic,
+		Async:     t.Async,
+		Generator: t.Generator,
 		Args:      t.Args,
 		Body:      t.Body,
 	}
@@ -1209,6 +1615,67 @@ func (c *compiler) compileFuncDeclExpr(t *ast.FuncDeclExpr, dest *Address) (*Add
 	return dest, nil
 }
 
+func (c *compiler) compileAwaitExpr(t *ast.AwaitExpr, dest Address) (Address, error) {
+	f := c.currentFunc.function
+	if !f.Async && !f.IsGlobal {
+		return Void, newError(t.Pos, "await is only valid in async functions")
+	}
+
+	x, err := c.compileExpr(t.X, Void)
+	if err != nil {
+		return Void, err
+	}
+
+	if dest == Void {
+		dest = c.newTempRegister()
+	}
+
+	c.emit(op_awt, dest, x, Void, t.Position())
+	return dest, nil
+}
+
+func (c *compiler) compileYieldExpr(t *ast.YieldExpr, dest Address) (Address, error) {
+	if !c.currentFunc.function.Generator {
+		return Void, newError(t.Pos, "yield is only valid in generator functions")
+	}
+
+	x := Void
+	if t.X != nil {
+		var err error
+		if x, err = c.compileExpr(t.X, Void); err != nil {
+			return Void, err
+		}
+	}
+
+	if t.Delegate {
+		// yield each value of the iterator
+		itr := c.newTempRegister()
+		c.emit(op_itr, itr, x, Void, t.Pos)
+
+		v := c.newTempRegister()
+		hasValue := c.newTempRegister()
+
+		loopStart := c.pc()
+		c.emit(op_nxt, v, itr, hasValue, t.Pos)
+		c.emit(op_tjp, hasValue, NewAddress(AddrData, 2), NewAddress(AddrData, 1), t.Pos)
+		c.emit(op_yld, Void, v, Void, t.Pos)
+		c.emit(op_jpb, NewAddress(AddrData, c.pc()-loopStart), Void, Void, t.Pos)
+
+		if dest == Void {
+			return Void, nil
+		}
+		c.emit(op_mov, dest, Void, Void, t.Pos)
+		return dest, nil
+	}
+
+	if dest == Void {
+		dest = c.newTempRegister()
+	}
+
+	c.emit(op_yld, dest, x, Void, t.Position())
+	return dest, nil
+}
+
 // TODO merge: compile expression and inc the result
 func (c *compiler) compileIncStmt(t *ast.IncStmt) error {
 	switch s := t.Left.(type) {
@@ -1256,6 +1723,22 @@ func (c *compiler) compileIncIndexExpr(s *ast.IndexExpr, t *ast.IncStmt) error {
 }
 
 func (c *compiler) compileIncSelectorExpr(s *ast.SelectorExpr, t *ast.IncStmt) error {
+	static, err := c.staticFieldTarget(s)
+	if err != nil {
+		return err
+	}
+	if static != Void {
+		switch t.Operator {
+		case ast.INC:
+			c.emit(op_inc, static, Void, Void, t.Position())
+		case ast.DEC:
+			c.emit(op_dec, static, Void, Void, t.Position())
+		default:
+			return newError(t.Position(), "Invalid operator %s, expected ++ or --", t.Operator)
+		}
+		return nil
+	}
+
 	// get the map address
 	x, err := c.compileExpr(s.X, Void)
 	if err != nil {
@@ -1290,7 +1773,7 @@ func (c *compiler) compileIncIdentExpr(t *ast.IncStmt) error {
 		return err
 	}
 
-	if i.Kind == AddrConstant {
+	if i.Kind() == AddrConstant {
 		return fmt.Errorf("can't modify a constant")
 	}
 
@@ -1310,6 +1793,12 @@ func (c *compiler) compileAsignStmt(t *ast.AsignStmt) error {
 	switch s := t.Left.(type) {
 	case *ast.IdentExpr:
 		return c.compileAsignIdentExpr(t)
+	case *ast.PatternExpr:
+		src, err := c.compileExpr(t.Value, Void)
+		if err != nil {
+			return err
+		}
+		return c.compileDestructuring(s, src, false, false)
 	case *ast.SelectorExpr:
 		return c.compileAsignSelectorExpr(s, t)
 	case *ast.IndexExpr:
@@ -1344,7 +1833,16 @@ func (c *compiler) compileAsignIndexExpr(s *ast.IndexExpr, t *ast.AsignStmt) err
 }
 
 func (c *compiler) compileAsignSelectorExpr(s *ast.SelectorExpr, t *ast.AsignStmt) error {
-	// get the map address
+	static, err := c.staticFieldTarget(s)
+	if err != nil {
+		return err
+	}
+	if static != Void {
+		_, err = c.compileExpr(t.Value, static)
+		return err
+	}
+
+	// get the map address
 	x, err := c.compileExpr(s.X, Void)
 	if err != nil {
 		return err
@@ -1375,7 +1873,7 @@ func (c *compiler) compileAsignIdentExpr(t *ast.AsignStmt) error {
 }
 
 func (c *compiler) compileReturnStmt(s *ast.ReturnStmt) error {
-	var retIndex *Address
+	var retIndex Address
 
 	// if there is a return value compile it
 	if s.Value != nil {
@@ -1392,13 +1890,17 @@ func (c *compiler) compileReturnStmt(s *ast.ReturnStmt) error {
 	return nil
 }
 
-func (c *compiler) compileIdentExpr(t *ast.IdentExpr, dest *Address) (*Address, error) {
+func (c *compiler) compileIdentExpr(t *ast.IdentExpr, dest Address) (Address, error) {
+	if t.Name == "super" {
+		return Void, newError(t.Position(), "'super' must be followed by an argument list or member access")
+	}
+
 	i, err := c.findRegister(t.Name, c.currentFunc)
 	if err != nil {
 		return Void, err
 	}
 
-	switch i.Kind {
+	switch i.Kind() {
 	case AddrClass:
 		return Void, newError(t.Position(), "invalid value: Class")
 	}
@@ -1415,14 +1917,33 @@ func (c *compiler) compileIdentExpr(t *ast.IdentExpr, dest *Address) (*Address,
 	return i, nil
 }
 
-func (c *compiler) compileMapDeclExpr(t *ast.MapDeclExpr, dest *Address) (*Address, error) {
-	if dest == Void {
-		dest = c.newTempRegister()
+func (c *compiler) compileMapDeclExpr(t *ast.MapDeclExpr, dest Address) (Address, error) {
+	var hasSpread bool
+	for _, kv := range t.List {
+		if isSpread(kv.Value) {
+			hasSpread = true
+			break
+		}
+	}
+
+	// build it in a new register because dest can be spread: a = {...a, b: 1}
+	target := dest
+	if target == Void || hasSpread {
+		target = c.newTempRegister()
 	}
 
-	c.emit(op_map, dest, NewAddress(AddrData, len(t.List)), Void, t.Pos)
+	c.emit(op_map, target, NewAddress(AddrData, len(t.List)), Void, t.Pos)
 
 	for _, kv := range t.List {
+		if s, ok := kv.Value.(*ast.SpreadExpr); ok {
+			x, err := c.compileExpr(s.X, Void)
+			if err != nil {
+				return Void, err
+			}
+			c.emit(op_spd, target, x, Void, s.Pos)
+			continue
+		}
+
 		var v Value
 
 		switch kv.KeyType {
@@ -1431,11 +1952,11 @@ func (c *compiler) compileMapDeclExpr(t *ast.MapDeclExpr, dest *Address) (*Addre
 		case ast.INT:
 			i, err := strconv.Atoi(kv.Key)
 			if err != nil {
-				return nil, newError(t.Position(), "Invalid key type: %v", kv.KeyType)
+				return Void, newError(t.Position(), "Invalid key type: %v", kv.KeyType)
 			}
 			v = NewInt(i)
 		default:
-			return nil, newError(t.Position(), "Invalid key type: %v", kv.KeyType)
+			return Void, newError(t.Position(), "Invalid key type: %v", kv.KeyType)
 		}
 
 		// the key is a constant
@@ -1448,13 +1969,18 @@ func (c *compiler) compileMapDeclExpr(t *ast.MapDeclExpr, dest *Address) (*Addre
 		}
 
 		// copy the value to the map
-		c.emit(op_set, dest, k, exp, ast.Position{})
+		c.emit(op_set, target, k, exp, ast.Position{})
 	}
 
-	return dest, nil
+	if dest != Void && dest != target {
+		c.emit(op_mov, dest, target, Void, t.Pos)
+		return dest, nil
+	}
+
+	return target, nil
 }
 
-func (c *compiler) compileIndexExpr(t *ast.IndexExpr, dest *Address) (*Address, error) {
+func (c *compiler) compileIndexExpr(t *ast.IndexExpr, dest Address) (Address, error) {
 	if t.First {
 		c.openOptChainingScope()
 		defer c.closeOptChainingScope()
@@ -1485,7 +2011,22 @@ func (c *compiler) compileIndexExpr(t *ast.IndexExpr, dest *Address) (*Address,
 	return dest, nil
 }
 
-func (c *compiler) compileArrayDeclExpr(t *ast.ArrayDeclExpr, dest *Address) (*Address, error) {
+func (c *compiler) compileArrayDeclExpr(t *ast.ArrayDeclExpr, dest Address) (Address, error) {
+	for _, v := range t.List {
+		if isSpread(v) {
+			// build it in a new register because dest can be spread: a = [...a, b]
+			arr, err := c.compileSpreadArray(t.List, t.Pos)
+			if err != nil {
+				return Void, err
+			}
+			if dest != Void {
+				c.emit(op_mov, dest, arr, Void, t.Pos)
+				return dest, nil
+			}
+			return arr, nil
+		}
+	}
+
 	if dest == Void {
 		dest = c.newTempRegister()
 	}
@@ -1506,8 +2047,8 @@ func (c *compiler) compileArrayDeclExpr(t *ast.ArrayDeclExpr, dest *Address) (*A
 	return dest, nil
 }
 
-func (c *compiler) compileNewInstanceExpr(t *ast.NewInstanceExpr, dest *Address) (*Address, error) {
-	var addr *Address
+func (c *compiler) compileNewInstanceExpr(t *ast.NewInstanceExpr, dest Address) (Address, error) {
+	var addr Address
 	var err error
 
 	switch tp := t.Name.(type) {
@@ -1563,7 +2104,7 @@ func (c *compiler) compileNewInstanceExpr(t *ast.NewInstanceExpr, dest *Address)
 	return dest, nil
 }
 
-func (c *compiler) compileTernaryExpr(t *ast.TernaryExpr, dest *Address) (*Address, error) {
+func (c *compiler) compileTernaryExpr(t *ast.TernaryExpr, dest Address) (Address, error) {
 	if dest == Void {
 		dest = c.newTempRegister()
 	}
@@ -1585,13 +2126,13 @@ func (c *compiler) compileTernaryExpr(t *ast.TernaryExpr, dest *Address) (*Addre
 	jumpLeft := c.emit(op_jmp, Void, Void, Void, ast.Position{})
 	leftPC := c.pc()
 
-	jump.B = NewAddress(AddrData, c.pc()-pc)
+	jump.instr().B = NewAddress(AddrData, c.pc()-pc)
 
 	if _, err = c.compileExpr(t.Right, dest); err != nil {
 		return Void, err
 	}
 
-	jumpLeft.A = NewAddress(AddrData, c.pc()-leftPC)
+	jumpLeft.instr().A = NewAddress(AddrData, c.pc()-leftPC)
 
 	return dest, nil
 }
@@ -1602,9 +2143,13 @@ const (
 	jumpIfFalse   jumpType = 0
 	jumpIfTrue    jumpType = 1
 	jumpIfNotNull jumpType = 2
+
+	// jumpIfDefined skips default values, that are only
+	// applied to undefined values and not to null.
+	jumpIfDefined jumpType = 3
 )
 
-func (c *compiler) compileAndOrExpr(t *ast.BinaryExpr, jType jumpType, dest *Address) (*Address, error) {
+func (c *compiler) compileAndOrExpr(t *ast.BinaryExpr, jType jumpType, dest Address) (Address, error) {
 	left, err := c.compileExpr(t.Left, Void)
 	if err != nil {
 		return Void, err
@@ -1621,8 +2166,14 @@ func (c *compiler) compileAndOrExpr(t *ast.BinaryExpr, jType jumpType, dest *Add
 
 	x := NewAddress(AddrData, int(jType))
 
+	// ?? tests the value itself because leftSet is never null
+	test := leftSet
+	if jType == jumpIfNotNull {
+		test = dest
+	}
+
 	// op_tjp: test if true or not null and jump: test R(A) and jump R(B) instructions. R(C)=(0=jump if true, 1 jump if false)
-	jump := c.emit(op_tjp, leftSet, Void, x, t.Left.Position())
+	jump := c.emit(op_tjp, test, Void, x, t.Left.Position())
 
 	start := c.pc()
 
@@ -1635,12 +2186,12 @@ func (c *compiler) compileAndOrExpr(t *ast.BinaryExpr, jType jumpType, dest *Add
 	c.emit(op_mov, dest, right, Void, t.Left.Position())
 
 	// set the number of jumps for the right hand
-	jump.B = NewAddress(AddrData, c.pc()-start)
+	jump.instr().B = NewAddress(AddrData, c.pc()-start)
 
 	return dest, nil
 }
 
-func (c *compiler) compileBinaryExpr(t *ast.BinaryExpr, dest *Address) (*Address, error) {
+func (c *compiler) compileBinaryExpr(t *ast.BinaryExpr, dest Address) (Address, error) {
 	switch t.Operator {
 	case ast.LAND:
 		return c.compileAndOrExpr(t, jumpIfTrue, dest)
@@ -1648,6 +2199,18 @@ func (c *compiler) compileBinaryExpr(t *ast.BinaryExpr, dest *Address) (*Address
 		return c.compileAndOrExpr(t, jumpIfFalse, dest)
 	case ast.NOR:
 		return c.compileAndOrExpr(t, jumpIfNotNull, dest)
+	case ast.INSTANCEOF:
+		return c.compileInstanceOfExpr(t, dest)
+	}
+
+	if parser.Optimizations {
+		if v, ok := c.foldConstant(t); ok {
+			k := c.program.addConstant(v)
+			if dest != Void {
+				c.emit(op_ldk, dest, k, Void, t.Left.Position())
+			}
+			return k, nil
+		}
 	}
 
 	left, err := c.compileExpr(t.Left, Void)
@@ -1679,6 +2242,12 @@ func (c *compiler) compileBinaryExpr(t *ast.BinaryExpr, dest *Address) (*Address
 		c.emit(op_lsh, dest, left, right, t.Left.Position())
 	case ast.RSH:
 		c.emit(op_rsh, dest, left, right, t.Left.Position())
+	case ast.URSH:
+		c.emit(op_urs, dest, left, right, t.Left.Position())
+	case ast.POW:
+		c.emit(op_pow, dest, left, right, t.Left.Position())
+	case ast.IN:
+		c.emit(op_hin, dest, left, right, t.Left.Position())
 	case ast.XOR:
 		c.emit(op_xor, dest, left, right, t.Left.Position())
 	case ast.DIV:
@@ -1708,7 +2277,51 @@ func (c *compiler) compileBinaryExpr(t *ast.BinaryExpr, dest *Address) (*Address
 	return dest, nil
 }
 
-func (c *compiler) compileUnaryExpr(t *ast.UnaryExpr, dest *Address) (*Address, error) {
+// compileInstanceOfExpr compiles x instanceof T. T can be a class
+// or the name of a native type like Array or http.Request.
+func (c *compiler) compileInstanceOfExpr(t *ast.BinaryExpr, dest Address) (Address, error) {
+	left, err := c.compileExpr(t.Left, Void)
+	if err != nil {
+		return Void, err
+	}
+
+	right, err := c.classAddress(t.Right)
+	if err != nil {
+		return Void, err
+	}
+
+	if right == Void {
+		name, ok := typeName(t.Right)
+		if !ok {
+			return Void, newError(t.Right.Position(), "The right-hand side of 'instanceof' must be a class or a type name")
+		}
+		right = c.program.addConstant(NewString(name))
+	}
+
+	if dest == Void {
+		dest = c.newTempRegister()
+	}
+
+	c.emit(op_ins, dest, left, right, t.Left.Position())
+	return dest, nil
+}
+
+// typeName returns the dotted name of an identifier or selector: foo.Bar
+func typeName(exp ast.Expr) (string, bool) {
+	switch t := exp.(type) {
+	case *ast.IdentExpr:
+		return t.Name, true
+	case *ast.SelectorExpr:
+		x, ok := typeName(t.X)
+		if !ok {
+			return "", false
+		}
+		return x + "." + t.Sel.Name, true
+	}
+	return "", false
+}
+
+func (c *compiler) compileUnaryExpr(t *ast.UnaryExpr, dest Address) (Address, error) {
 	// if it  is a constant calculate the value and store the result constant
 	if k, ok := t.Operand.(*ast.ConstantExpr); ok {
 		return c.compileUnaryConstantExpr(t.Operator, k, dest)
@@ -1737,8 +2350,8 @@ func (c *compiler) compileUnaryExpr(t *ast.UnaryExpr, dest *Address) (*Address,
 	return dest, nil
 }
 
-func (c *compiler) compileUnaryConstantExpr(operator ast.Type, t *ast.ConstantExpr, dest *Address) (*Address, error) {
-	var k *Address
+func (c *compiler) compileUnaryConstantExpr(operator ast.Type, t *ast.ConstantExpr, dest Address) (Address, error) {
+	var k Address
 
 	switch t.Kind {
 	case ast.INT:
@@ -1782,7 +2395,7 @@ func (c *compiler) compileUnaryConstantExpr(operator ast.Type, t *ast.ConstantEx
 
 	return k, nil
 }
-func (c *compiler) enumKeyAddress(enumIndex int, key string, pos ast.Position) (*Address, error) {
+func (c *compiler) enumKeyAddress(enumIndex int, key string, pos ast.Position) (Address, error) {
 	enum := c.program.Enums[enumIndex]
 
 	_, i := enum.ValueByName(key)
@@ -1793,8 +2406,8 @@ func (c *compiler) enumKeyAddress(enumIndex int, key string, pos ast.Position) (
 	return NewAddress(AddrData, i), nil
 }
 
-func (c *compiler) compileEnumValueExpr(enumAddr *Address, key string, dest *Address, pos ast.Position) (*Address, error) {
-	keyAddr, err := c.enumKeyAddress(int(enumAddr.Value), key, pos)
+func (c *compiler) compileEnumValueExpr(enumAddr Address, key string, dest Address, pos ast.Position) (Address, error) {
+	keyAddr, err := c.enumKeyAddress(int(enumAddr.Value()), key, pos)
 	if err != nil {
 		return Void, err
 	}
@@ -1808,8 +2421,12 @@ func (c *compiler) compileEnumValueExpr(enumAddr *Address, key string, dest *Add
 	return dest, nil
 }
 
-func (c *compiler) compileSelectorExpr(t *ast.SelectorExpr, dest *Address) (*Address, error) {
-	var x *Address
+func (c *compiler) compileSelectorExpr(t *ast.SelectorExpr, dest Address) (Address, error) {
+	var x Address
+
+	if isSuper(t.X) {
+		return c.compileSuperMethod(t.Sel.Name, dest, t.Position())
+	}
 
 	// check if is a module call
 	ident, ok := t.X.(*ast.IdentExpr)
@@ -1818,9 +2435,12 @@ func (c *compiler) compileSelectorExpr(t *ast.SelectorExpr, dest *Address) (*Add
 		if err != nil {
 			return Void, err
 		}
-		if addr.Kind == AddrEnum {
+		if addr.Kind() == AddrEnum {
 			return c.compileEnumValueExpr(addr, t.Sel.Name, dest, t.Position())
 		}
+		if addr.Kind() == AddrClass {
+			return c.compileStaticMemberExpr(addr, t.Sel.Name, dest, t.Position())
+		}
 
 		addr, err = c.compileModuleExpr(ident.Name, t.Sel.Name, dest, t.Position())
 		if err != nil {
@@ -1865,13 +2485,16 @@ func (c *compiler) compileSelectorExpr(t *ast.SelectorExpr, dest *Address) (*Add
 			if err != nil {
 				return Void, err
 			}
-			if addr.Kind == AddrEnum {
+			if addr.Kind() == AddrEnum {
 				dest, err = c.compileEnumValueExpr(addr, t.Sel.Name, dest, xSel.Position())
 				if err != nil {
 					return Void, err
 				}
 				return dest, nil
 			}
+			if addr.Kind() == AddrClass {
+				return c.compileStaticMemberExpr(addr, t.Sel.Name, dest, t.Position())
+			}
 		}
 	}
 
@@ -1880,7 +2503,7 @@ func (c *compiler) compileSelectorExpr(t *ast.SelectorExpr, dest *Address) (*Add
 		defer c.closeOptChainingScope()
 	}
 
-	if x == nil {
+	if x == Void {
 		var err error
 		// get the map address
 		x, err = c.compileExpr(t.X, Void)
@@ -1923,14 +2546,15 @@ func (c *compiler) closeOptChainingScope() {
 	ln := len(c.selectors) - 1
 	sel := c.selectors[ln]
 	pc := c.pc()
-	for _, instr := range sel.optChainings {
-		offset := pc - int(instr.B.Value)
+	for _, ref := range sel.optChainings {
+		instr := ref.instr()
+		offset := pc - int(instr.B.Value())
 		instr.B = NewAddress(AddrData, offset)
 	}
 	c.selectors = c.selectors[:ln]
 }
 
-func (c *compiler) compileNativeFunction(pkg, name string, dest *Address, pos ast.Position) (*Address, error) {
+func (c *compiler) compileNativeFunction(pkg, name string, dest Address, pos ast.Position) (Address, error) {
 	var fullName string
 
 	if pkg != "" {
@@ -1954,7 +2578,7 @@ func (c *compiler) compileNativeFunction(pkg, name string, dest *Address, pos as
 	return dest, nil
 }
 
-func (c *compiler) compileNativeProperty(pkg, name string, dest *Address, pos ast.Position) (*Address, error) {
+func (c *compiler) compileNativeProperty(pkg, name string, dest Address, pos ast.Position) (Address, error) {
 	fullName := "->" + pkg + "." + name
 
 	f, ok := allNativeMap[fullName]
@@ -1972,7 +2596,7 @@ func (c *compiler) compileNativeProperty(pkg, name string, dest *Address, pos as
 	return dest, nil
 }
 
-func (c *compiler) compileModuleExpr(module, name string, dest *Address, pos ast.Position) (*Address, error) {
+func (c *compiler) compileModuleExpr(module, name string, dest Address, pos ast.Position) (Address, error) {
 	addr, err := c.findModuleRegister(module, name, pos)
 	if err != nil {
 		return Void, err
@@ -1995,9 +2619,9 @@ func (c *compiler) compileTailCallStmt(t *ast.CallExpr) error {
 
 	// calculate all args
 	lenArgs := len(t.Args)
-	var argRegs []*Address
+	var argRegs []Address
 	if lenArgs > 0 {
-		argRegs = make([]*Address, lenArgs)
+		argRegs = make([]Address, lenArgs)
 		for i, arg := range t.Args {
 			r, err := c.compileExpr(arg, Void)
 			if err != nil {
@@ -2022,18 +2646,27 @@ func (c *compiler) compileTailCallStmt(t *ast.CallExpr) error {
 	return nil
 }
 
-func (c *compiler) compileCallExpr(t *ast.CallExpr, dest *Address, retVal bool) (*Address, error) {
+func (c *compiler) compileCallExpr(t *ast.CallExpr, dest Address, retVal bool) (Address, error) {
 	if t.First {
 		c.openOptChainingScope()
 		defer c.closeOptChainingScope()
 	}
 
+	if isSuper(t.Ident) {
+		return Void, newError(t.Position(), "A 'super' call must be the first statement in the constructor")
+	}
+
 	// if it is a method m is the constant of the method name
 	i, err := c.compileExpr(t.Ident, Void)
 	if err != nil {
 		return Void, err
 	}
 
+	return c.compileCall(t, i, dest, retVal)
+}
+
+// compileCall calls the function in the address i.
+func (c *compiler) compileCall(t *ast.CallExpr, i, dest Address, retVal bool) (Address, error) {
 	if retVal && dest == Void {
 		dest = c.newTempRegister()
 	}
@@ -2070,12 +2703,16 @@ func (c *compiler) compileCallExpr(t *ast.CallExpr, dest *Address, retVal bool)
 }
 
 // compile the arguments of a function call.
-func (c *compiler) compileCallArgs(params []ast.Expr, spreadArg bool) (*Address, error) {
+func (c *compiler) compileCallArgs(params []ast.Expr, spreadArg bool) (Address, error) {
 	ln := len(params)
 	if ln == 0 {
 		return Void, nil
 	}
 
+	if spreadArg {
+		return c.compileSpreadArray(params, params[0].Position())
+	}
+
 	dest := c.newTempRegister()
 	c.emit(op_arr, dest, NewAddress(AddrData, ln), Void, params[0].Position())
 
@@ -2088,14 +2725,49 @@ func (c *compiler) compileCallArgs(params []ast.Expr, spreadArg bool) (*Address,
 		c.emit(op_set, dest, NewAddress(AddrData, i), exp, p.Position())
 	}
 
-	if spreadArg {
-		// concat the last arg if is spread
-		c.emit(op_spa, dest, Void, Void, params[ln-1].Position())
+	return dest, nil
+}
+
+// compileSpreadArray builds an array from a list of values where some
+// of them are spread: [a, ...b, c]. The values between spreads are
+// grouped in arrays that are spread too.
+func (c *compiler) compileSpreadArray(items []ast.Expr, pos ast.Position) (Address, error) {
+	dest := c.newTempRegister()
+	c.emit(op_arr, dest, NewAddress(AddrData, 0), Void, pos)
+
+	for i := 0; i < len(items); {
+		if s, ok := items[i].(*ast.SpreadExpr); ok {
+			x, err := c.compileExpr(s.X, Void)
+			if err != nil {
+				return Void, err
+			}
+			c.emit(op_spd, dest, x, Void, s.Pos)
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j < len(items) && !isSpread(items[j]) {
+			j++
+		}
+
+		group := &ast.ArrayDeclExpr{Pos: items[i].Position(), List: items[i:j]}
+		x, err := c.compileArrayDeclExpr(group, Void)
+		if err != nil {
+			return Void, err
+		}
+		c.emit(op_spd, dest, x, Void, group.Pos)
+		i = j
 	}
 
 	return dest, nil
 }
 
+func isSpread(exp ast.Expr) bool {
+	_, ok := exp.(*ast.SpreadExpr)
+	return ok
+}
+
 func (c *compiler) compileClassDeclStmt(t *ast.ClassDeclStmt) error {
 	name := c.registerName(t.Name)
 
@@ -2103,21 +2775,53 @@ func (c *compiler) compileClassDeclStmt(t *ast.ClassDeclStmt) error {
 		Name:       name,
 		Module:     c.modulePrefix,
 		Exported:   t.Exported,
+		Base:       -1,
 		Directives: t.Directives,
 	}
 
+	if len(t.Decorators) > 0 {
+		c.decorated = append(c.decorated, &decorated{t.Decorators, &cl.Decorators})
+	}
+
+	if t.Extends != nil {
+		base, err := c.findBaseClass(t.Extends)
+		if err != nil {
+			return err
+		}
+		cl.Base = base
+	}
+
+	var instanceFields []*ast.VarDeclStmt
+
 	for _, f := range t.Fields {
 		cl.Fields = append(cl.Fields, &Field{
 			Name:     f.Name,
 			Exported: f.Exported,
+			Static:   f.Static,
+			Readonly: f.Readonly,
 		})
+		if !f.Static {
+			instanceFields = append(instanceFields, f)
+		}
 	}
 
 	// Set as a top function and restart closures
 	c.currentFunc = c.globalFunc
 	c.closures = nil
 
+	// add it now so static members can be referenced from the class code
 	index := len(c.program.Classes)
+	c.program.Classes = append(c.program.Classes, cl)
+
+	c.currentClass = cl
+	defer func() { c.currentClass = nil }()
+
+	// static fields are global registers
+	for _, f := range t.Fields {
+		if f.Static {
+			c.newRegister(staticName(cl, f.Name), true, Void)
+		}
+	}
 
 	var constructorCompiled bool
 
@@ -2125,13 +2829,30 @@ func (c *compiler) compileClassDeclStmt(t *ast.ClassDeclStmt) error {
 		f.ReceiverType = name
 
 		if f.Name == "constructor" {
-			if err := c.compileConstructor(cl, f, index, t); err != nil {
+			if f.Async {
+				return newError(f.Pos, "A constructor can't be async.")
+			}
+			if f.Generator {
+				return newError(f.Pos, "A constructor can't be a generator.")
+			}
+			if f.Static || f.Getter || f.Setter {
+				return newError(f.Pos, "Invalid constructor declaration.")
+			}
+			if err := c.compileConstructor(cl, f, index, instanceFields); err != nil {
 				return err
 			}
 			constructorCompiled = true
 			continue
 		}
 
+		if f.Static {
+			if f.Getter || f.Setter {
+				return newError(f.Pos, "Static accessors are not supported.")
+			}
+			// static methods don't have a this
+			f.ReceiverType = ""
+		}
+
 		fi, err := c.compileFuncDecl(f, true)
 		if err != nil {
 			return err
@@ -2139,28 +2860,183 @@ func (c *compiler) compileClassDeclStmt(t *ast.ClassDeclStmt) error {
 
 		fi.function.IsClass = true
 		fi.function.Class = index
+		fi.function.Static = f.Static
+		fi.function.Getter = f.Getter
+		fi.function.Setter = f.Setter
 		cl.Functions = append(cl.Functions, fi.function.Index)
 	}
 
-	if !constructorCompiled && len(t.Fields) > 0 {
+	// initialize static fields in the global function. The constructor
+	// doesn't restore the current function so set it explicitly.
+	current := c.currentFunc
+	c.currentFunc = c.globalFunc
+
+	for _, f := range t.Fields {
+		if !f.Static {
+			continue
+		}
+
+		r, _, _ := c.staticField(cl, f.Name)
+
+		if e, ok := f.Value.(*ast.ConstantExpr); ok && e.Kind == ast.UNDEFINED {
+			c.emit(op_mov, r, c.program.addConstant(NullValue), Void, f.Position())
+			continue
+		}
+
+		if _, err := c.compileExpr(f.Value, r); err != nil {
+			return err
+		}
+	}
+
+	c.currentFunc = current
+
+	if !constructorCompiled && len(instanceFields) > 0 {
 		f := &ast.FuncDeclStmt{
 			Name:         "constructor",
 			ReceiverType: name,
 			Pos:          t.Pos,
 		}
-		if err := c.compileConstructor(cl, f, index, t); err != nil {
+		if cl.Base != -1 {
+			// pass all the arguments to the base constructor: constructor(...args) { super(...args) }
+			args := &ast.IdentExpr{Pos: t.Pos, Name: "args"}
+			super := &ast.IdentExpr{Pos: t.Pos, Name: "super"}
+			f.Variadic = true
+			f.Args = &ast.Arguments{Opening: t.Pos, List: []*ast.Field{{Pos: t.Pos, Name: args.Name}}}
+			f.Body = &ast.BlockStmt{Lbrace: t.Pos, Rbrace: t.Pos, List: []ast.Stmt{
+				&ast.CallStmt{CallExpr: &ast.CallExpr{
+					Ident:  super,
+					Args:   []ast.Expr{&ast.SpreadExpr{Pos: t.Pos, X: args}},
+					Spread: true,
+				}},
+			}}
+		}
+		if err := c.compileConstructor(cl, f, index, instanceFields); err != nil {
 			return err
 		}
 	}
 
-	c.program.Classes = append(c.program.Classes, cl)
 	c.currentFunc = c.globalFunc
 
 	return nil
 }
 
+// staticName is the name of the global register of a static field.
+func staticName(cl *Class, field string) string {
+	return cl.Name + "." + field
+}
+
+// staticField returns the register of a static field of the class or
+// its base classes and the class that declares it.
+func (c *compiler) staticField(cl *Class, name string) (Address, *Field, *Class) {
+	for ; cl != nil; cl = c.program.BaseClass(cl) {
+		for _, f := range cl.Fields {
+			if !f.Static || f.Name != name {
+				continue
+			}
+			regName := staticName(cl, name)
+			for _, r := range c.globalFunc.function.Registers {
+				if r.Name == regName {
+					return NewAddress(AddrGlobal, r.Index), f, cl
+				}
+			}
+		}
+	}
+	return Void, nil, nil
+}
+
+// staticMember returns the address of a static field or method. Private
+// members can only be accessed from the code of the class.
+func (c *compiler) staticMember(classAddr Address, name string, pos ast.Position) (Address, *Field, error) {
+	cl := c.program.Classes[classAddr.Value()]
+
+	if f, ok := c.program.StaticFunction(cl, name); ok {
+		if !f.Exported && c.currentClass != c.program.Classes[f.Class] {
+			return Void, nil, newError(pos, "Attempted to access a private method: %s", name)
+		}
+		return NewAddress(AddrFunc, f.Index), nil, nil
+	}
+
+	r, f, declaring := c.staticField(cl, name)
+	if f == nil {
+		return Void, nil, newError(pos, "Undefined static member %s.%s", cl.Name, name)
+	}
+
+	if !f.Exported && c.currentClass != declaring {
+		return Void, nil, newError(pos, "Attempted to access a private field: %s", name)
+	}
+
+	return r, f, nil
+}
+
+func (c *compiler) compileStaticMemberExpr(classAddr Address, name string, dest Address, pos ast.Position) (Address, error) {
+	addr, _, err := c.staticMember(classAddr, name, pos)
+	if err != nil {
+		return Void, err
+	}
+
+	if dest != Void {
+		c.emit(op_mov, dest, addr, Void, pos)
+		return dest, nil
+	}
+
+	return addr, nil
+}
+
+// staticFieldTarget returns the register of a static field that is going to be
+// modified or Void if the selector is not a static field.
+func (c *compiler) staticFieldTarget(s *ast.SelectorExpr) (Address, error) {
+	addr, err := c.classAddress(s.X)
+	if err != nil || addr == Void {
+		return Void, err
+	}
+
+	r, f, err := c.staticMember(addr, s.Sel.Name, s.Position())
+	if err != nil {
+		return Void, err
+	}
+
+	if f == nil {
+		return Void, newError(s.Position(), "Cannot assign to a method: %s", s.Sel.Name)
+	}
+
+	if f.Readonly {
+		return Void, newError(s.Position(), "Cannot assign to a readonly field: %s", s.Sel.Name)
+	}
+
+	return r, nil
+}
+
+// classAddress returns the address of the class if exp is a class name: Foo or module.Foo.
+func (c *compiler) classAddress(exp ast.Expr) (Address, error) {
+	var addr Address
+	var err error
+
+	switch t := exp.(type) {
+	case *ast.IdentExpr:
+		addr, err = c.findRegister(t.Name, c.currentFunc)
+	case *ast.SelectorExpr:
+		ident, ok := t.X.(*ast.IdentExpr)
+		if !ok {
+			return Void, nil
+		}
+		addr, err = c.findModuleRegister(ident.Name, t.Sel.Name, t.Position())
+	default:
+		return Void, nil
+	}
+
+	if err != nil {
+		return Void, err
+	}
+
+	if addr.Kind() != AddrClass {
+		return Void, nil
+	}
+
+	return addr, nil
+}
+
 // compile fields before the function body if it has one
-func (c *compiler) compileConstructor(cl *Class, t *ast.FuncDeclStmt, classIndex int, ct *ast.ClassDeclStmt) error {
+func (c *compiler) compileConstructor(cl *Class, t *ast.FuncDeclStmt, classIndex int, fields []*ast.VarDeclStmt) error {
 	var argsLen int
 	var optArgsLen int
 	if t.Args != nil {
@@ -2188,20 +3064,37 @@ func (c *compiler) compileConstructor(cl *Class, t *ast.FuncDeclStmt, classIndex
 
 	cl.Functions = append(cl.Functions, f.Index)
 
-	if t.Args != nil {
-		// Create first the arguments because when the function is called
-		// they are copied directly to the beginning of the values.
-		for _, arg := range t.Args.List {
-			c.newRegister(arg.Name, false, nil)
-		}
-	}
+	// Create first the arguments because when the function is called
+	// they are copied directly to the beginning of the values.
+	args := c.newArgRegisters(t.Args)
 
 	// reserve a register for the "this" object.
 	// but *after* the params.
-	this := c.newRegister("this", false, nil)
+	this := c.newRegister("this", false, Void)
+
+	if err := c.compileArgPatterns(t.Args, args); err != nil {
+		return err
+	}
+
+	body := t.Body
+
+	// the base constructor runs before the fields are initialized
+	if cl.Base != -1 {
+		var call *ast.CallExpr
+		if body != nil && len(body.List) > 0 {
+			call = superCall(body.List[0])
+		}
+		if call == nil {
+			return newError(t.Pos, "Constructors for derived classes must start with a 'super' call")
+		}
+		if _, err := c.compileSuperCall(call, Void, false); err != nil {
+			return err
+		}
+		body = &ast.BlockStmt{Lbrace: body.Lbrace, List: body.List[1:], Rbrace: body.Rbrace}
+	}
 
 	// initialize fields
-	for _, fl := range ct.Fields {
+	for _, fl := range fields {
 		i := c.program.addConstant(NewString(fl.Name))
 
 		// if the field is unitialized set it as NULL
@@ -2219,8 +3112,8 @@ func (c *compiler) compileConstructor(cl *Class, t *ast.FuncDeclStmt, classIndex
 		c.emit(op_set, this, i, dst, fl.Position())
 	}
 
-	if t.Body != nil {
-		if err := c.compileBlockStmt(t.Body); err != nil {
+	if body != nil {
+		if err := c.compileBlockStmt(body); err != nil {
 			return err
 		}
 	}
@@ -2231,41 +3124,464 @@ func (c *compiler) compileConstructor(cl *Class, t *ast.FuncDeclStmt, classIndex
 	return nil
 }
 
-func (c *compiler) compileConstantExpr(t *ast.ConstantExpr, dest *Address) (*Address, error) {
-	k, err := c.newConstant(t)
+// findBaseClass returns the index of the class that a class extends.
+func (c *compiler) findBaseClass(exp ast.Expr) (int, error) {
+	var addr Address
+	var err error
+
+	switch t := exp.(type) {
+	case *ast.IdentExpr:
+		addr, err = c.findRegister(t.Name, c.globalFunc)
+	case *ast.SelectorExpr:
+		ident, ok := t.X.(*ast.IdentExpr)
+		if !ok {
+			return 0, newError(exp.Position(), "Expected class name")
+		}
+		addr, err = c.findModuleRegister(ident.Name, t.Sel.Name, t.Position())
+	default:
+		return 0, newError(exp.Position(), "Expected class name")
+	}
+
 	if err != nil {
-		return Void, err
+		return 0, err
 	}
 
-	if dest != Void {
-		c.emit(op_ldk, dest, k, Void, t.Pos)
+	if addr.Kind() != AddrClass {
+		return 0, newError(exp.Position(), "Expected class name")
 	}
 
-	return k, nil
+	return int(addr.Value()), nil
 }
 
-func (c *compiler) newConstant(t *ast.ConstantExpr) (*Address, error) {
-	p := c.program
+// superCall returns the call if the statement is super(...)
+func superCall(stmt ast.Stmt) *ast.CallExpr {
+	s, ok := stmt.(*ast.CallStmt)
+	if !ok {
+		return nil
+	}
+	if !isSuper(s.Ident) {
+		return nil
+	}
+	return s.CallExpr
+}
 
-	switch t.Kind {
-	case ast.INT:
-		n, err := strconv.ParseInt(t.Value, 10, 64)
-		if err != nil {
-			return Void, newError(t.Pos, "Invalid int value %s", t.Value)
-		}
-		return p.addConstant(NewInt64(n)), nil
+func isSuper(exp ast.Expr) bool {
+	ident, ok := exp.(*ast.IdentExpr)
+	return ok && ident.Name == "super"
+}
 
-	case ast.FLOAT:
-		n, err := strconv.ParseFloat(t.Value, 64)
-		if err != nil {
-			return Void, newError(t.Pos, "Invalid float value %s", t.Value)
-		}
-		return p.addConstant(NewFloat(n)), nil
+// compileSuperCall calls the constructor of the base class.
+func (c *compiler) compileSuperCall(t *ast.CallExpr, dest Address, retVal bool) (Address, error) {
+	base, err := c.baseClass(t.Position())
+	if err != nil {
+		return Void, err
+	}
 
-	case ast.STRING:
-		return p.addConstant(NewString(t.Value)), nil
+	if _, ok := c.program.ClassFunction(base, "constructor"); !ok {
+		if len(t.Args) > 0 {
+			return Void, newError(t.Position(), "Expected 0 arguments, but got %d", len(t.Args))
+		}
+		return Void, nil
+	}
 
-	case ast.TRUE:
+	i, err := c.compileSuperMethod("constructor", Void, t.Position())
+	if err != nil {
+		return Void, err
+	}
+
+	return c.compileCall(t, i, dest, retVal)
+}
+
+// compileSuperMethod binds a method of the base class to this.
+func (c *compiler) compileSuperMethod(name string, dest Address, pos ast.Position) (Address, error) {
+	base, err := c.baseClass(pos)
+	if err != nil {
+		return Void, err
+	}
+
+	f, ok := c.program.ClassFunction(base, name)
+	if !ok {
+		return Void, newError(pos, "Undefined method in base class %s: %s", base.Name, name)
+	}
+
+	if !f.Exported && name != "constructor" {
+		return Void, newError(pos, "Attempted to access a private method: %s", name)
+	}
+
+	this, err := c.compileIdentExpr(&ast.IdentExpr{Pos: pos, Name: "this"}, Void)
+	if err != nil {
+		return Void, err
+	}
+
+	if dest == Void {
+		dest = c.newTempRegister()
+	}
+
+	c.emit(op_bnd, dest, this, NewAddress(AddrFunc, f.Index), pos)
+	return dest, nil
+}
+
+// baseClass returns the base of the class being compiled.
+func (c *compiler) baseClass(pos ast.Position) (*Class, error) {
+	if c.currentClass == nil || c.currentClass.Base == -1 {
+		return nil, newError(pos, "'super' can only be used in classes that extend another class")
+	}
+	return c.program.Classes[c.currentClass.Base], nil
+}
+
+func (c *compiler) compileConstantExpr(t *ast.ConstantExpr, dest Address) (Address, error) {
+	k, err := c.newConstant(t)
+	if err != nil {
+		return Void, err
+	}
+
+	if dest != Void {
+		c.emit(op_ldk, dest, k, Void, t.Pos)
+	}
+
+	return k, nil
+}
+
+func (c *compiler) declareShapes(types []ast.Stmt) {
+	for _, t := range types {
+		var name string
+		var exported bool
+
+		switch t := t.(type) {
+		case *ast.InterfaceDeclStmt:
+			if t.Class {
+				continue
+			}
+			name, exported = t.Name, t.Exported
+		case *ast.TypeAliasStmt:
+			name, exported = t.Name, t.Exported
+		default:
+			continue
+		}
+
+		// interfaces declared more than once are merged
+		if d := c.findShapeDecl(name, c.modulePrefix); d != nil {
+			if _, ok := t.(*ast.InterfaceDeclStmt); ok {
+				d.decls = append(d.decls, t)
+				d.shape.Exported = d.shape.Exported || exported
+			}
+			continue
+		}
+
+		shape := &Shape{Name: name, Module: c.modulePrefix, Exported: exported}
+		c.program.Shapes = append(c.program.Shapes, shape)
+		c.shapes = append(c.shapes, &shapeDecl{shape: shape, decls: []ast.Stmt{t}})
+	}
+}
+
+func (c *compiler) findShapeDecl(name, module string) *shapeDecl {
+	for _, d := range c.shapes {
+		if d.shape.Name == name && d.shape.Module == module {
+			return d
+		}
+	}
+	return nil
+}
+
+// compileShapes converts the type annotations of interfaces and type
+// aliases to shapes. Generic parameters and the types that can't
+// be checked at runtime like functions or classes are any.
+func (c *compiler) compileShapes() {
+	for _, d := range c.shapes {
+		module := d.shape.Module
+
+		switch t := d.decls[0].(type) {
+		case *ast.TypeAliasStmt:
+			params := typeParams(t.TypeParams)
+			d.shape.Type = c.shapeType(t.Type, module, params)
+
+		case *ast.InterfaceDeclStmt:
+			obj := &ShapeType{Kind: ShapeObject}
+			for _, decl := range d.decls {
+				i := decl.(*ast.InterfaceDeclStmt)
+				params := typeParams(i.TypeParams)
+				for _, ext := range i.Extends {
+					obj.Elems = append(obj.Elems, c.shapeType(ext, module, params))
+				}
+				c.addShapeMembers(obj, i.Body, module, params)
+			}
+			d.shape.Type = obj
+		}
+	}
+
+	c.shapes = nil
+}
+
+func typeParams(params []*ast.TypeParam) map[string]bool {
+	if len(params) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(params))
+	for _, p := range params {
+		m[p.Name] = true
+	}
+	return m
+}
+
+func (c *compiler) addShapeMembers(obj *ShapeType, body *ast.ObjectType, module string, params map[string]bool) {
+	if body == nil {
+		return
+	}
+
+	for _, m := range body.Members {
+		switch {
+		case m.KeyType != nil:
+			obj.Index = c.shapeType(m.Type, module, params)
+		case m.Method, m.Static, m.Name == "", m.Name == "new":
+			// methods are not validated
+		default:
+			obj.Props = append(obj.Props, &ShapeProp{
+				Name:     m.Name,
+				Type:     c.shapeType(m.Type, module, params),
+				Optional: m.Optional,
+			})
+		}
+	}
+}
+
+func (c *compiler) shapeType(t ast.TypeExpr, module string, params map[string]bool) *ShapeType {
+	switch t := t.(type) {
+	case *ast.TypeRef:
+		if params[t.Name] {
+			return &ShapeType{Kind: ShapeAny}
+		}
+
+		switch t.Name {
+		case "string":
+			return &ShapeType{Kind: ShapeString}
+		case "number":
+			return &ShapeType{Kind: ShapeNumber}
+		case "boolean":
+			return &ShapeType{Kind: ShapeBoolean}
+		case "null":
+			return &ShapeType{Kind: ShapeNull}
+		case "undefined", "void":
+			return &ShapeType{Kind: ShapeUndefined}
+		case "object":
+			return &ShapeType{Kind: ShapeObject}
+		case "Array", "ReadonlyArray":
+			if len(t.Args) == 1 {
+				return &ShapeType{Kind: ShapeArray, Elems: []*ShapeType{c.shapeType(t.Args[0], module, params)}}
+			}
+		case "Record":
+			if len(t.Args) == 2 {
+				return &ShapeType{Kind: ShapeObject, Index: c.shapeType(t.Args[1], module, params)}
+			}
+		}
+
+		if i := c.shapeIndex(t.Name, module); i != -1 {
+			return &ShapeType{Kind: ShapeRef, Ref: i}
+		}
+
+	case *ast.LiteralType:
+		switch t.Kind {
+		case ast.STRING:
+			return &ShapeType{Kind: ShapeLiteral, Value: NewString(t.Value)}
+		case ast.INT:
+			if n, err := strconv.ParseInt(t.Value, 10, 64); err == nil {
+				return &ShapeType{Kind: ShapeLiteral, Value: NewInt64(n)}
+			}
+		case ast.FLOAT:
+			if n, err := strconv.ParseFloat(t.Value, 64); err == nil {
+				return &ShapeType{Kind: ShapeLiteral, Value: NewFloat(n)}
+			}
+		case ast.TRUE:
+			return &ShapeType{Kind: ShapeLiteral, Value: TrueValue}
+		case ast.FALSE:
+			return &ShapeType{Kind: ShapeLiteral, Value: FalseValue}
+		case ast.NULL:
+			return &ShapeType{Kind: ShapeNull}
+		case ast.UNDEFINED:
+			return &ShapeType{Kind: ShapeUndefined}
+		}
+
+	case *ast.ArrayType:
+		return &ShapeType{Kind: ShapeArray, Elems: []*ShapeType{c.shapeType(t.Elem, module, params)}}
+
+	case *ast.TupleType:
+		return &ShapeType{Kind: ShapeTuple, Elems: c.shapeTypes(t.Elems, module, params)}
+
+	case *ast.UnionType:
+		return &ShapeType{Kind: ShapeUnion, Elems: c.shapeTypes(t.Types, module, params)}
+
+	case *ast.IntersectionType:
+		return &ShapeType{Kind: ShapeIntersection, Elems: c.shapeTypes(t.Types, module, params)}
+
+	case *ast.ObjectType:
+		obj := &ShapeType{Kind: ShapeObject}
+		c.addShapeMembers(obj, t, module, params)
+		return obj
+	}
+
+	return &ShapeType{Kind: ShapeAny}
+}
+
+func (c *compiler) shapeTypes(types []ast.TypeExpr, module string, params map[string]bool) []*ShapeType {
+	result := make([]*ShapeType, len(types))
+	for i, t := range types {
+		result[i] = c.shapeType(t, module, params)
+	}
+	return result
+}
+
+// shapeIndex returns the index of the shape declared in the module or
+// exported by other module. Qualified names like lib.User are searched
+// by the name of the type.
+func (c *compiler) shapeIndex(name, module string) int {
+	i := strings.LastIndexByte(name, '.')
+	qualified := i != -1
+	if qualified {
+		name = name[i+1:]
+	}
+
+	exported := -1
+
+	for i, s := range c.program.Shapes {
+		if s.Name != name {
+			continue
+		}
+		if s.Module == module && !qualified {
+			return i
+		}
+		if s.Exported && exported == -1 {
+			exported = i
+		}
+	}
+
+	return exported
+}
+
+// compileDecorators evaluates the arguments of the decorators declared in
+// the file. They are stored in the program as metadata so they must be constant values.
+func (c *compiler) compileDecorators() error {
+	for _, d := range c.decorated {
+		decorators := make([]*Decorator, len(d.decorators))
+
+		for i, dec := range d.decorators {
+			args := make([]Value, len(dec.Args))
+			for j, arg := range dec.Args {
+				v, err := c.constantValue(arg)
+				if err != nil {
+					return err
+				}
+				args[j] = v
+			}
+			decorators[i] = &Decorator{Name: dec.Name, Args: args}
+		}
+
+		*d.target = decorators
+	}
+
+	c.decorated = nil
+	return nil
+}
+
+// constantValue evaluates an expression that can be resolved at compile time:
+// literals, constants, enum values and arrays and objects of them.
+func (c *compiler) constantValue(expr ast.Expr) (Value, error) {
+	switch t := expr.(type) {
+	case *ast.ConstantExpr:
+		k, err := c.newConstant(t)
+		if err != nil {
+			return NullValue, err
+		}
+		return c.program.Constants[k.Value()], nil
+
+	case *ast.UnaryExpr:
+		if t.Operator == ast.SUB {
+			v, err := c.constantValue(t.Operand)
+			if err != nil {
+				return NullValue, err
+			}
+			switch v.Type {
+			case Int:
+				return NewInt64(-v.ToInt()), nil
+			case Float:
+				return NewFloat(-v.ToFloat()), nil
+			}
+		}
+
+	case *ast.IdentExpr:
+		addr, err := c.findRegister(t.Name, c.currentFunc)
+		if err != nil {
+			return NullValue, newError(t.Pos, "%v", err)
+		}
+		if addr.Kind() == AddrConstant {
+			return c.program.Constants[addr.Value()], nil
+		}
+
+	case *ast.SelectorExpr:
+		if ident, ok := t.X.(*ast.IdentExpr); ok {
+			addr, err := c.findRegister(ident.Name, c.currentFunc)
+			if err != nil {
+				return NullValue, newError(t.Position(), "%v", err)
+			}
+			if addr.Kind() == AddrEnum {
+				enum := c.program.Enums[addr.Value()]
+				v, i := enum.ValueByName(t.Sel.Name)
+				if i == -1 {
+					return NullValue, newError(t.Position(), "Invalid enum key: %s.%s", enum.Name, t.Sel.Name)
+				}
+				return c.program.Constants[v.KIndex], nil
+			}
+		}
+
+	case *ast.ArrayDeclExpr:
+		values := make([]Value, len(t.List))
+		for i, item := range t.List {
+			v, err := c.constantValue(item)
+			if err != nil {
+				return NullValue, err
+			}
+			values[i] = v
+		}
+		return NewArrayValues(values), nil
+
+	case *ast.MapDeclExpr:
+		m := make(map[Value]Value, len(t.List))
+		for _, kv := range t.List {
+			if isSpread(kv.Value) {
+				return NullValue, newError(t.Pos, "Decorator arguments must be constant values")
+			}
+			v, err := c.constantValue(kv.Value)
+			if err != nil {
+				return NullValue, err
+			}
+			m[NewString(kv.Key)] = v
+		}
+		return NewMapValues(m), nil
+	}
+
+	return NullValue, newError(expr.Position(), "Decorator arguments must be constant values")
+}
+
+func (c *compiler) newConstant(t *ast.ConstantExpr) (Address, error) {
+	p := c.program
+
+	switch t.Kind {
+	case ast.INT:
+		n, err := strconv.ParseInt(t.Value, 10, 64)
+		if err != nil {
+			return Void, newError(t.Pos, "Invalid int value %s", t.Value)
+		}
+		return p.addConstant(NewInt64(n)), nil
+
+	case ast.FLOAT:
+		n, err := strconv.ParseFloat(t.Value, 64)
+		if err != nil {
+			return Void, newError(t.Pos, "Invalid float value %s", t.Value)
+		}
+		return p.addConstant(NewFloat(n)), nil
+
+	case ast.STRING:
+		return p.addConstant(NewString(t.Value)), nil
+
+	case ast.TRUE:
 		return p.addConstant(TrueValue), nil
 
 	case ast.FALSE:
@@ -2280,15 +3596,39 @@ func (c *compiler) newConstant(t *ast.ConstantExpr) (*Address, error) {
 	case ast.UNDEFINED:
 		return p.addConstant(UndefinedValue), nil
 
+	case ast.REGEX:
+		// the same literal is compiled only once
+		for i, k := range p.Constants {
+			if r, ok := k.ToObjectOrNil().(*RegExp); ok && r.String() == t.Value {
+				return NewAddress(AddrConstant, i), nil
+			}
+		}
+		r, err := ParseRegExp(t.Value)
+		if err != nil {
+			return Void, newError(t.Pos, "%v", err)
+		}
+		return p.addConstant(NewObject(r)), nil
+
 	default:
 		return Void, newError(t.Pos, "Invalid type %s", t.Value)
 	}
 }
 
-func (ctx *compiler) emit(op Opcode, a, b, c *Address, pos ast.Position) *Instruction {
-	i := NewInstruction(op, a, b, c)
+// instrRef references an emitted instruction to update it later. The instructions
+// are stored by value so a pointer is not valid after emitting the next one.
+type instrRef struct {
+	fn *Function
+	pc int
+}
+
+func (r instrRef) instr() *Instruction {
+	return &r.fn.Instructions[r.pc]
+}
+
+func (ctx *compiler) emit(op Opcode, a, b, c Address, pos ast.Position) instrRef {
 	f := ctx.currentFunc.function
-	f.Instructions = append(f.Instructions, i)
+	i := instrRef{f, len(f.Instructions)}
+	f.Instructions = append(f.Instructions, NewInstruction(op, a, b, c))
 
 	p := ctx.program
 
@@ -2307,8 +3647,8 @@ func (ctx *compiler) emit(op Opcode, a, b, c *Address, pos ast.Position) *Instru
 	return i
 }
 
-func (c *compiler) newTempRegister() *Address {
-	return c.newRegister("@", false, nil)
+func (c *compiler) newTempRegister() Address {
+	return c.newRegister("@", false, Void)
 }
 
 func (c *compiler) registerName(name string) string {
@@ -2331,7 +3671,7 @@ func (c *compiler) globalNamespaceName(name string) string {
 	return GlobalNamespace + "." + name
 }
 
-func (c *compiler) newRegister(name string, exported bool, kAddress *Address) *Address {
+func (c *compiler) newRegister(name string, exported bool, kAddress Address) Address {
 	if c.currentFunc == c.globalFunc {
 		name = c.registerName(name)
 	}
@@ -2351,7 +3691,7 @@ func (c *compiler) newRegister(name string, exported bool, kAddress *Address) *A
 	f := fi.function
 	f.Registers = append(f.Registers, r)
 
-	if kAddress != nil {
+	if kAddress != Void {
 		return kAddress
 	}
 
@@ -2365,7 +3705,7 @@ func (c *compiler) newRegister(name string, exported bool, kAddress *Address) *A
 }
 
 // find a register in the current scope.
-func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error) {
+func (c *compiler) findRegister(name string, fi *functionInfo) (Address, error) {
 	// search local registers
 	if !fi.function.IsGlobal {
 		f := fi.function
@@ -2376,7 +3716,7 @@ func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error)
 				continue
 			}
 			if r.Name == name && (r.EndPC == 0 || pc <= r.EndPC) {
-				if r.KAddress != nil {
+				if r.KAddress != Void {
 					return r.KAddress, nil
 				}
 				return NewAddress(AddrLocal, r.Index), nil
@@ -2397,7 +3737,7 @@ func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error)
 			for i := len(parentFn.Registers) - 1; i >= 0; i-- {
 				r := parentFn.Registers[i]
 				if r.Name == name && pc >= r.StartPC && (r.EndPC == 0 || pc <= r.EndPC) {
-					if r.KAddress != nil {
+					if r.KAddress != Void {
 						return r.KAddress, nil
 					}
 					// we can't know in advance the index in the global array of closures
@@ -2413,6 +3753,11 @@ func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error)
 		}
 	}
 
+	// search named and default imports
+	if addr, ok, err := c.findImport(name); ok {
+		return addr, err
+	}
+
 	// search globals. Global registers are always in scope.
 	gfi := c.globalFunc
 	gf := gfi.function
@@ -2431,7 +3776,7 @@ func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error)
 			if r.Module != c.modulePrefix && !r.Exported {
 				continue
 			}
-			if r.KAddress != nil {
+			if r.KAddress != Void {
 				return r.KAddress, nil
 			}
 			return NewAddress(AddrGlobal, r.Index), nil
@@ -2498,7 +3843,7 @@ func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error)
 			continue
 		}
 		if r.Name == gnsName && (r.EndPC == 0 || pc <= r.EndPC) {
-			if r.KAddress != nil {
+			if r.KAddress != Void {
 				return r.KAddress, nil
 			}
 			return NewAddress(AddrGlobal, r.Index), nil
@@ -2514,7 +3859,7 @@ func (c *compiler) findRegister(name string, fi *functionInfo) (*Address, error)
 	return Void, nil
 }
 
-func (c *compiler) findModuleRegister(moduleAlias, name string, pos ast.Position) (*Address, error) {
+func (c *compiler) findModuleRegister(moduleAlias, name string, pos ast.Position) (Address, error) {
 	// check if the prefix is an imported module
 	var modulePath string
 	for _, imp := range c.imports {
@@ -2525,7 +3870,7 @@ func (c *compiler) findModuleRegister(moduleAlias, name string, pos ast.Position
 	}
 
 	if modulePath != "" {
-		addr, err := c.findRegister(modulePath+"."+name, c.globalFunc)
+		addr, err := c.findExport(modulePath, name, nil)
 		if err != nil {
 			return Void, newError(pos, err.Error())
 		}
@@ -2551,6 +3896,227 @@ func (c *compiler) findModuleRegister(moduleAlias, name string, pos ast.Position
 	return Void, nil
 }
 
+// findImport resolves a name bound by a named or default import
+// of the file being compiled: import foo, { bar as baz } from "x".
+// ok is false if the name is not imported.
+func (c *compiler) findImport(name string) (addr Address, ok bool, err error) {
+	if strings.ContainsRune(name, '.') {
+		return Void, false, nil
+	}
+
+	for _, imp := range c.imports {
+		if imp.Export || imp.AbsPath == "" {
+			continue
+		}
+
+		member := ""
+		if imp.Default == name {
+			member = "default"
+		} else {
+			for _, n := range imp.Names {
+				if n.Alias == name {
+					member = n.Name
+					break
+				}
+			}
+		}
+
+		if member == "" {
+			continue
+		}
+
+		addr, err := c.findExport(imp.AbsPath, member, nil)
+		return addr, true, err
+	}
+
+	return Void, false, nil
+}
+
+// checkImports reports the names imported by a file that
+// the modules don't export: import { foo } from "x".
+func (c *compiler) checkImports(file *ast.File) error {
+	for _, list := range [][]*ast.ImportStmt{file.Imports, file.TypeImports} {
+		for _, imp := range list {
+			if imp.AbsPath == "" {
+				// a .d.ts file
+				continue
+			}
+
+			if imp.Default != "" && !c.isExported(imp.AbsPath, "default", nil) {
+				return newError(imp.Pos, "Module \"%s\" has no default export", imp.Path)
+			}
+
+			for _, names := range [][]*ast.ImportName{imp.Names, imp.TypeNames} {
+				for _, n := range names {
+					if !c.isExported(imp.AbsPath, n.Name, nil) {
+						return newError(n.Pos, "%s is not exported by \"%s\"", n.Name, imp.Path)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// isExported returns true if a module exports a declaration or a type
+// with name directly or through its re-exports.
+func (c *compiler) isExported(modulePath, name string, visited map[string]bool) bool {
+	file, ok := c.files[modulePath]
+	if !ok {
+		// it can't be checked
+		return true
+	}
+
+	if name == "default" {
+		if file.Default != "" {
+			return true
+		}
+	} else if exportsDecl(file, name) {
+		return true
+	}
+
+	// avoid cycles between modules that re-export each other
+	if visited == nil {
+		visited = make(map[string]bool)
+	}
+	if visited[modulePath] {
+		return false
+	}
+	visited[modulePath] = true
+
+	for _, imp := range file.Imports {
+		if !imp.Export || imp.AbsPath == "" {
+			continue
+		}
+
+		for _, n := range imp.Names {
+			if n.Alias == name {
+				return c.isExported(imp.AbsPath, n.Name, visited)
+			}
+		}
+
+		// the default export is not included in export *
+		if imp.All && name != "default" && c.isExported(imp.AbsPath, name, visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exportsDecl returns true if the file declares and exports name.
+func exportsDecl(file *ast.File, name string) bool {
+	for _, s := range file.Stms {
+		switch t := s.(type) {
+		case *ast.FuncDeclStmt:
+			if t.Exported && t.Name == name {
+				return true
+			}
+		case *ast.ClassDeclStmt:
+			if t.Exported && t.Name == name {
+				return true
+			}
+		case *ast.EnumDeclStmt:
+			if t.Exported && t.Name == name {
+				return true
+			}
+		case *ast.VarDeclStmt:
+			if !t.Exported {
+				continue
+			}
+			if t.Pattern != nil {
+				if patternDeclares(t.Pattern, name) {
+					return true
+				}
+			} else if t.Name == name {
+				return true
+			}
+		}
+	}
+
+	for _, s := range file.Types {
+		switch t := s.(type) {
+		case *ast.InterfaceDeclStmt:
+			if t.Exported && t.Name == name {
+				return true
+			}
+		case *ast.TypeAliasStmt:
+			if t.Exported && t.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// patternDeclares returns true if a destructuring pattern declares name.
+func patternDeclares(p *ast.PatternExpr, name string) bool {
+	for _, e := range p.Elements {
+		switch t := e.Target.(type) {
+		case *ast.IdentExpr:
+			if t.Name == name {
+				return true
+			}
+		case *ast.PatternExpr:
+			if patternDeclares(t, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findExport returns the address of a member exported by a module following
+// its default export and re-exports: export { a } from "x", export * from "x".
+func (c *compiler) findExport(modulePath, name string, visited map[string]bool) (Address, error) {
+	file := c.files[modulePath]
+
+	if name == "default" {
+		if file == nil || file.Default == "" {
+			return Void, nil
+		}
+		name = file.Default
+	}
+
+	addr, err := c.findRegister(modulePath+"."+name, c.globalFunc)
+	if err != nil || addr != Void || file == nil {
+		return addr, err
+	}
+
+	// avoid cycles between modules that re-export each other
+	if visited == nil {
+		visited = make(map[string]bool)
+	}
+	if visited[modulePath] {
+		return Void, nil
+	}
+	visited[modulePath] = true
+
+	for _, imp := range file.Imports {
+		if !imp.Export || imp.AbsPath == "" {
+			continue
+		}
+
+		for _, n := range imp.Names {
+			if n.Alias == name {
+				return c.findExport(imp.AbsPath, n.Name, visited)
+			}
+		}
+
+		// the default export is not included in export *
+		if imp.All && name != "default" {
+			addr, err := c.findExport(imp.AbsPath, name, visited)
+			if err != nil || addr != Void {
+				return addr, err
+			}
+		}
+	}
+
+	return Void, nil
+}
+
 // signals that the register is referenced by a closure
 func (c *compiler) markAsClosure(f *Function, r *Register) int {
 	for _, v := range f.Closures {
@@ -2642,17 +4208,18 @@ func (c *compiler) closeBranch() {
 type unresolved struct {
 	name     string
 	pos      ast.Position
-	pc       int      // to resolve scope
-	address  *Address // to search and replace in the program
+	pc       int     // to resolve scope
+	address  Address // to search and replace in the program
 	module   string
 	function *functionInfo // the function where is declared
 }
 
-func (c *compiler) getUnresolved(name string, pos ast.Position) *Address {
+func (c *compiler) getUnresolved(name string, pos ast.Position) Address {
 	index := -1
-	for i, u := range c.unresolved {
+	for _, u := range c.unresolved {
 		if u.name == name && u.module == c.modulePrefix {
-			index = i
+			index = int(u.address.Value())
+			break
 		}
 	}
 
@@ -2676,15 +4243,20 @@ func (c *compiler) getUnresolved(name string, pos ast.Position) *Address {
 }
 
 func (c *compiler) fixUnresolved() error {
+	resolved := make(map[Address]Address, len(c.unresolved))
+
 	for _, u := range c.unresolved {
 
 		c.modulePrefix = u.module
+		if file, ok := c.files[u.module]; ok {
+			c.imports = file.Imports
+		}
 		v, err := c.findRegister(u.name, c.globalFunc)
 		if err != nil {
 			return newError(u.pos, err.Error())
 		}
 
-		if v.Kind == AddrVoid {
+		if v.Kind() == AddrVoid {
 			if u.module != "" {
 				v, err = c.findRegister(u.module+"."+u.name, c.globalFunc)
 				if err != nil {
@@ -2693,16 +4265,16 @@ func (c *compiler) fixUnresolved() error {
 			}
 		}
 
-		if v.Kind == AddrVoid {
+		if v.Kind() == AddrVoid {
 			return newError(u.pos, "Undeclared identifier: %s", u.name)
 		}
 
 		// Check that a global variable in the same module is not used before is declared.
-		if v.Kind == AddrGlobal {
+		if v.Kind() == AddrGlobal {
 			// globals called from inside a function are always in scope
 			if u.function == c.globalFunc {
 				// get the register module
-				r := c.globalFunc.function.Registers[v.Value]
+				r := c.globalFunc.function.Registers[v.Value()]
 				// if they are in different modules then globals are always in scope.
 				// only when they are in the same module they cant be used before declared.
 				if u.module == r.Module {
@@ -2713,18 +4285,37 @@ func (c *compiler) fixUnresolved() error {
 			}
 		}
 
-		// replace in all instructions
-		c.replaceAddress(u.address, v)
+		resolved[u.address] = v
 	}
 
+	c.replaceUnresolved(resolved)
 	c.unresolved = nil
 
 	return nil
 }
 
-func (c *compiler) replaceAddress(dst *Address, src *Address) {
-	dst.Kind = src.Kind
-	dst.Value = src.Value
+// replaceUnresolved replaces the unresolved addresses in all instructions.
+func (c *compiler) replaceUnresolved(resolved map[Address]Address) {
+	if len(resolved) == 0 {
+		return
+	}
+
+	replace := func(a *Address) {
+		if a.Kind() == AddrUnresolved {
+			if v, ok := resolved[*a]; ok {
+				*a = v
+			}
+		}
+	}
+
+	for _, f := range c.program.Functions {
+		for pc := range f.Instructions {
+			instr := &f.Instructions[pc]
+			replace(&instr.A)
+			replace(&instr.B)
+			replace(&instr.C)
+		}
+	}
 }
 
 type closure struct {
@@ -2743,7 +4334,8 @@ type branch struct {
 	continues  []*jumpInstr
 	tryCatchs  []*ast.TryStmt
 	outOfScope bool
-	inFinally  bool // if the current code is inside a finally block
+	inFinally  bool    // if the current code is inside a finally block
+	iterator   Address // the iterator of a for...of loop, closed when it is exited with a break
 }
 
 func (b *branch) isValidTarget(label string) bool {
@@ -2781,7 +4373,7 @@ type breakTarget interface {
 }
 
 type jumpInstr struct {
-	inst   *Instruction
+	inst   instrRef
 	pc     int
 	target target
 }
@@ -2835,6 +4427,49 @@ func (a ByPriority) Less(i, j int) bool {
 	return false
 }
 
+// sortBaseClasses moves the classes declared in stms so that
+// base classes are compiled before the classes that extend them.
+func sortBaseClasses(stms []ast.Stmt) {
+	var indexes []int
+	classes := make(map[string]*ast.ClassDeclStmt)
+
+	for i, s := range stms {
+		if cl, ok := s.(*ast.ClassDeclStmt); ok {
+			indexes = append(indexes, i)
+			classes[cl.Name] = cl
+		}
+	}
+
+	if len(indexes) < 2 {
+		return
+	}
+
+	sorted := make([]ast.Stmt, 0, len(indexes))
+	added := make(map[string]bool)
+
+	var add func(cl *ast.ClassDeclStmt)
+	add = func(cl *ast.ClassDeclStmt) {
+		if added[cl.Name] {
+			return
+		}
+		added[cl.Name] = true
+		if base, ok := cl.Extends.(*ast.IdentExpr); ok {
+			if b, ok := classes[base.Name]; ok {
+				add(b)
+			}
+		}
+		sorted = append(sorted, cl)
+	}
+
+	for _, i := range indexes {
+		add(stms[i].(*ast.ClassDeclStmt))
+	}
+
+	for i, s := range sorted {
+		stms[indexes[i]] = s
+	}
+}
+
 type functionInfo struct {
 	function  *Function
 	parent    *functionInfo
@@ -0,0 +1,117 @@
+package dune
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// RunContext executes the program like Run but stops when the context
+// is canceled or its deadline is exceeded.
+func (vm *VM) RunContext(ctx context.Context, args ...Value) (Value, error) {
+	defer vm.watch(ctx)()
+	return vm.runMain(args...)
+}
+
+// RunFuncContext executes a function by name like RunFunc but stops when
+// the context is canceled or its deadline is exceeded.
+func (vm *VM) RunFuncContext(ctx context.Context, name string, args ...Value) (Value, error) {
+	defer vm.watch(ctx)()
+	return vm.runFuncName(name, args...)
+}
+
+// GoContext returns the context of the current execution so native functions
+// can honor its cancellation. The Context field is the value for the scripts.
+func (vm *VM) GoContext() context.Context {
+	if vm.ctx == nil {
+		return context.Background()
+	}
+	return vm.ctx
+}
+
+// watch sets the context of an execution and returns a function to restore
+// the previous one. The deadline of the vm is applied to the outermost call.
+//
+// Native functions can call back into the vm while it is running. Those
+// calls keep the context of the outer execution unless they receive one
+// that can be canceled.
+func (vm *VM) watch(ctx context.Context) func() {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	prev := vm.ctx
+	if prev != nil && ctx.Done() == nil {
+		return func() {}
+	}
+
+	var cancel context.CancelFunc
+	if prev == nil && !vm.Deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, vm.Deadline)
+	}
+
+	vm.ctx = ctx
+	stop := vm.interruptOnDone(ctx)
+
+	return func() {
+		stop()
+		if cancel != nil {
+			cancel()
+		}
+
+		vm.ctx = prev
+
+		// a nested context that is done doesn't stop the outer execution
+		if prev == nil || prev.Err() == nil {
+			atomic.StoreInt32(&vm.interrupted, 0)
+		}
+	}
+}
+
+// interruptOnDone sets the interrupted flag when the context is done. The
+// flag is checked by the interpreter loop so it doesn't need to select
+// on the channel for each instruction.
+func (vm *VM) interruptOnDone(ctx context.Context) func() {
+	done := ctx.Done()
+	if done == nil {
+		return func() {}
+	}
+
+	if ctx.Err() != nil {
+		atomic.StoreInt32(&vm.interrupted, 1)
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		select {
+		case <-done:
+			atomic.StoreInt32(&vm.interrupted, 1)
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-exited
+	}
+}
+
+// interrupt aborts the execution with the error of the context. It can't be
+// catched by the program so the try-catchs are discarded and the finalizers
+// of all the frames are executed. The global frame is finalized by run.
+func (vm *VM) interrupt() {
+	err := vm.GoContext().Err()
+	if err == nil {
+		err = context.Canceled
+	}
+
+	vm.Error = vm.WrapError(err)
+	vm.tryCatchs = nil
+
+	for i := vm.fp; i > 0; i-- {
+		vm.cleanupFrame(i)
+	}
+}
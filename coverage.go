@@ -0,0 +1,329 @@
+package dune
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Coverage counts the instructions executed by the programs and the branches
+// taken by the conditional jumps. It can be shared by many VMs to merge the
+// coverage of different executions, for example of each test function.
+type Coverage struct {
+	mu       sync.Mutex
+	programs map[*Program]*programCoverage
+	order    []*Program
+}
+
+type programCoverage struct {
+	calls    []int64      // by function
+	counts   [][]int64    // by function and pc
+	branches [][][2]int64 // by function and pc: not jumped and jumped
+}
+
+// NewCoverage returns an empty coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{programs: make(map[*Program]*programCoverage)}
+}
+
+// SetCoverage records the code executed by the vm in c. A nil c disables it.
+func (vm *VM) SetCoverage(c *Coverage) {
+	if c == nil {
+		vm.coverage = nil
+		return
+	}
+	vm.coverage = &coverageRecorder{coverage: c, fp: -1}
+}
+
+func (c *Coverage) program(p *Program) *programCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc, ok := c.programs[p]
+	if ok {
+		return pc
+	}
+
+	pc = &programCoverage{
+		calls:    make([]int64, len(p.Functions)),
+		counts:   make([][]int64, len(p.Functions)),
+		branches: make([][][2]int64, len(p.Functions)),
+	}
+
+	for i, f := range p.Functions {
+		pc.counts[i] = make([]int64, len(f.Instructions))
+		pc.branches[i] = make([][2]int64, len(f.Instructions))
+	}
+
+	c.programs[p] = pc
+	c.order = append(c.order, p)
+	return pc
+}
+
+// coverageRecorder is the state of the coverage of each vm. The result of a
+// conditional jump is known when the next instruction is executed.
+type coverageRecorder struct {
+	coverage *Coverage
+	program  *Program
+	data     *programCoverage
+	branch   bool // the last instruction is a conditional jump
+	fp       int
+	fn       int
+	pc       int
+}
+
+// hit is called by the vm before executing an instruction.
+func (r *coverageRecorder) hit(vm *VM, frame *stackFrame, f *Function) {
+	if r.program != vm.Program {
+		r.program = vm.Program
+		r.data = r.coverage.program(vm.Program)
+		r.branch = false
+		r.fp = -1
+	}
+
+	pc := frame.pc
+
+	// a jump back to the start of the function is not a call
+	if pc == 0 && (r.fp != vm.fp || r.fn != f.Index) {
+		atomic.AddInt64(&r.data.calls[f.Index], 1)
+	}
+
+	if r.branch && r.fp == vm.fp && r.fn == f.Index {
+		jumped := 0
+		if pc != r.pc+1 {
+			jumped = 1
+		}
+		atomic.AddInt64(&r.data.branches[r.fn][r.pc][jumped], 1)
+	}
+
+	atomic.AddInt64(&r.data.counts[f.Index][pc], 1)
+
+	switch f.Instructions[pc].Opcode {
+	case op_ejp, op_djp, op_tjp:
+		r.branch = true
+	default:
+		r.branch = false
+	}
+
+	r.fp = vm.fp
+	r.fn = f.Index
+	r.pc = pc
+}
+
+// FileCoverage is the coverage of a source file.
+type FileCoverage struct {
+	File      string
+	Lines     map[int]int64 // the executions of each line with code
+	Functions []*FunctionCoverage
+	Branches  []*BranchCoverage
+}
+
+// FunctionCoverage is the number of times that a function has been called.
+type FunctionCoverage struct {
+	Name string
+	Line int
+	Hits int64
+}
+
+// BranchCoverage is the number of times that a conditional jump
+// has jumped or not. Block is the index of the jump in the line.
+type BranchCoverage struct {
+	Line      int
+	Block     int
+	Executed  bool
+	Jumped    int64
+	NotJumped int64
+}
+
+// CoveredLines returns the number of lines with code and how many have been executed.
+func (f *FileCoverage) CoveredLines() (int, int) {
+	var hit int
+	for _, n := range f.Lines {
+		if n > 0 {
+			hit++
+		}
+	}
+	return len(f.Lines), hit
+}
+
+// Files returns the coverage of each file sorted by name. If a file
+// is part of many programs the coverage of all of them is merged.
+func (c *Coverage) Files() []*FileCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files := make(map[string]*FileCoverage)
+
+	for _, p := range c.order {
+		c.addProgram(p, c.programs[p], files)
+	}
+
+	result := make([]*FileCoverage, 0, len(files))
+	for _, f := range files {
+		sort.Slice(f.Functions, func(i, j int) bool {
+			a, b := f.Functions[i], f.Functions[j]
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Name < b.Name
+		})
+		sort.Slice(f.Branches, func(i, j int) bool {
+			a, b := f.Branches[i], f.Branches[j]
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Block < b.Block
+		})
+		result = append(result, f)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].File < result[j].File
+	})
+
+	return result
+}
+
+func (c *Coverage) addProgram(p *Program, data *programCoverage, files map[string]*FileCoverage) {
+	getFile := func(name string) *FileCoverage {
+		fc, ok := files[name]
+		if !ok {
+			fc = &FileCoverage{File: name, Lines: make(map[int]int64)}
+			files[name] = fc
+		}
+		return fc
+	}
+
+	type blockKey struct {
+		file string
+		line int
+	}
+
+	// the conditional jumps are numbered in each line in the order of the program
+	blocks := make(map[blockKey]int)
+
+	for fi, f := range p.Functions {
+		counts := data.counts[fi]
+		firstLine := -1
+
+		for pc := range f.Instructions {
+			if pc >= len(f.Positions) {
+				break
+			}
+
+			file, pos := p.position(f, pc)
+			if file == "" || pos.Line == 0 {
+				continue
+			}
+
+			fc := getFile(file)
+
+			// a line is executed as many times as its most executed instruction
+			if n := counts[pc]; n > fc.Lines[pos.Line] {
+				fc.Lines[pos.Line] = n
+			} else if _, ok := fc.Lines[pos.Line]; !ok {
+				fc.Lines[pos.Line] = 0
+			}
+
+			if firstLine == -1 {
+				firstLine = pos.Line
+				if !f.IsGlobal {
+					fc.addFunction(f.Name, pos.Line, data.calls[fi])
+				}
+			}
+
+			switch f.Instructions[pc].Opcode {
+			case op_ejp, op_djp, op_tjp:
+				key := blockKey{file, pos.Line}
+				block := blocks[key]
+				blocks[key]++
+
+				b := data.branches[fi][pc]
+				fc.addBranch(pos.Line, block, counts[pc] > 0, b[1], b[0])
+			}
+		}
+	}
+}
+
+func (f *FileCoverage) addFunction(name string, line int, hits int64) {
+	for _, fn := range f.Functions {
+		if fn.Name == name && fn.Line == line {
+			fn.Hits += hits
+			return
+		}
+	}
+	f.Functions = append(f.Functions, &FunctionCoverage{Name: name, Line: line, Hits: hits})
+}
+
+func (f *FileCoverage) addBranch(line, block int, executed bool, jumped, notJumped int64) {
+	for _, b := range f.Branches {
+		if b.Line == line && b.Block == block {
+			b.Executed = b.Executed || executed
+			b.Jumped += jumped
+			b.NotJumped += notJumped
+			return
+		}
+	}
+
+	f.Branches = append(f.Branches, &BranchCoverage{
+		Line:      line,
+		Block:     block,
+		Executed:  executed,
+		Jumped:    jumped,
+		NotJumped: notJumped,
+	})
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	for _, f := range c.Files() {
+		fmt.Fprintf(b, "TN:\nSF:%s\n", f.File)
+
+		var fnHit int
+		for _, fn := range f.Functions {
+			fmt.Fprintf(b, "FN:%d,%s\n", fn.Line, fn.Name)
+		}
+		for _, fn := range f.Functions {
+			fmt.Fprintf(b, "FNDA:%d,%s\n", fn.Hits, fn.Name)
+			if fn.Hits > 0 {
+				fnHit++
+			}
+		}
+		fmt.Fprintf(b, "FNF:%d\nFNH:%d\n", len(f.Functions), fnHit)
+
+		var brHit int
+		for _, br := range f.Branches {
+			for i, n := range []int64{br.NotJumped, br.Jumped} {
+				if !br.Executed {
+					fmt.Fprintf(b, "BRDA:%d,%d,%d,-\n", br.Line, br.Block, i)
+					continue
+				}
+				fmt.Fprintf(b, "BRDA:%d,%d,%d,%d\n", br.Line, br.Block, i, n)
+				if n > 0 {
+					brHit++
+				}
+			}
+		}
+		fmt.Fprintf(b, "BRF:%d\nBRH:%d\n", len(f.Branches)*2, brHit)
+
+		lines := make([]int, 0, len(f.Lines))
+		for line := range f.Lines {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+
+		for _, line := range lines {
+			fmt.Fprintf(b, "DA:%d,%d\n", line, f.Lines[line])
+		}
+
+		total, hit := f.CoveredLines()
+		fmt.Fprintf(b, "LF:%d\nLH:%d\nend_of_record\n", total, hit)
+	}
+
+	return b.Flush()
+}
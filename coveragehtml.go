@@ -0,0 +1,130 @@
+package dune
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/scorredoira/dune/filesystem"
+)
+
+type htmlCoverageFile struct {
+	ID      int
+	Name    string
+	Percent string
+	Lines   []htmlCoverageLine
+}
+
+type htmlCoverageLine struct {
+	Number int
+	Hits   string
+	Class  string
+	Title  string
+	Code   string
+}
+
+// WriteHTML writes a report with the sources of the programs read from fs
+// annotated with the number of times that each line has been executed.
+func (c *Coverage) WriteHTML(w io.Writer, fs filesystem.FS) error {
+	var files []htmlCoverageFile
+
+	for i, f := range c.Files() {
+		src, err := filesystem.ReadAll(fs, f.File)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", f.File, err)
+		}
+
+		total, hit := f.CoveredLines()
+		percent := "100.0%"
+		if total > 0 {
+			percent = fmt.Sprintf("%.1f%%", float64(hit)*100/float64(total))
+		}
+
+		hf := htmlCoverageFile{ID: i, Name: f.File, Percent: percent}
+
+		branches := make(map[int][]*BranchCoverage)
+		for _, b := range f.Branches {
+			branches[b.Line] = append(branches[b.Line], b)
+		}
+
+		lines := strings.Split(string(bytes.TrimRight(src, "\n")), "\n")
+
+		for j, code := range lines {
+			line := htmlCoverageLine{Number: j + 1, Code: strings.TrimRight(code, "\r")}
+
+			if n, ok := f.Lines[j+1]; ok {
+				line.Hits = fmt.Sprint(n)
+				switch {
+				case n == 0:
+					line.Class = "uncovered"
+				case partialBranches(branches[j+1]):
+					line.Class = "partial"
+					line.Title = branchesTitle(branches[j+1])
+				default:
+					line.Class = "covered"
+				}
+			}
+
+			hf.Lines = append(hf.Lines, line)
+		}
+
+		files = append(files, hf)
+	}
+
+	return coverageTemplate.Execute(w, files)
+}
+
+// partialBranches returns true if a conditional jump has not gone both ways.
+func partialBranches(branches []*BranchCoverage) bool {
+	for _, b := range branches {
+		if !b.Executed || b.Jumped == 0 || b.NotJumped == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func branchesTitle(branches []*BranchCoverage) string {
+	parts := make([]string, len(branches))
+	for i, b := range branches {
+		parts[i] = fmt.Sprintf("branch %d: jumped %d, not jumped %d", b.Block, b.Jumped, b.NotJumped)
+	}
+	return strings.Join(parts, "\n")
+}
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; color: #333; }
+table.files td { padding: 2px 12px 2px 0; }
+table.source { border-collapse: collapse; font-family: monospace; font-size: 13px; margin-bottom: 40px; }
+table.source td { padding: 0 8px; white-space: pre; }
+td.number, td.hits { text-align: right; color: #999; }
+tr.covered td.code { background: #dfd; }
+tr.uncovered td.code { background: #fdd; }
+tr.partial td.code { background: #ffd; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<table class="files">
+{{- range .}}
+<tr><td><a href="#file{{.ID}}">{{.Name}}</a></td><td>{{.Percent}}</td></tr>
+{{- end}}
+</table>
+{{- range .}}
+<h2 id="file{{.ID}}">{{.Name}} <small>{{.Percent}}</small></h2>
+<table class="source">
+{{- range .Lines}}
+<tr class="{{.Class}}"{{if .Title}} title="{{.Title}}"{{end}}><td class="number">{{.Number}}</td><td class="hits">{{.Hits}}</td><td class="code">{{.Code}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,503 @@
+// Package dap serves the Debug Adapter Protocol so editors
+// like VSCode can debug programs executed by a VM.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/scorredoira/dune"
+)
+
+// there are no threads in the vm, async functions are not debugged.
+const threadID = 1
+
+// Server debugs a VM for a client connected with the protocol.
+type Server struct {
+	vm   *dune.VM
+	args []dune.Value
+	dbg  *dune.Debugger
+
+	out    io.Writer
+	mu     sync.Mutex // protects writes to out and seq
+	seq    int
+	files  map[string]string // the program files by absolute path
+	refs   []interface{}     // values and scopes that can be expanded while it is paused
+	start  launchArguments
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// scopeRef is a reference to the variables of a frame.
+type scopeRef struct {
+	frame int
+	kind  string
+}
+
+// NewServer returns a server that runs the program of the vm with args when
+// the client has finished the configuration. The output of the program is
+// sent to the client so stdio can be used for the protocol.
+func NewServer(vm *dune.VM, args ...dune.Value) *Server {
+	s := &Server{
+		vm:    vm,
+		args:  args,
+		files: make(map[string]string),
+		done:  make(chan struct{}),
+	}
+
+	for _, f := range vm.Program.Files {
+		if abs, err := filepath.Abs(f); err == nil {
+			s.files[abs] = f
+		}
+		s.files[f] = f
+	}
+
+	vm.Stdout = &output{server: s, category: "stdout"}
+	vm.Stderr = &output{server: s, category: "stderr"}
+
+	s.dbg = dune.NewDebugger(vm)
+	s.dbg.OnStop = func(reason dune.StopReason) {
+		s.send("stopped", map[string]interface{}{
+			"reason":            string(reason),
+			"threadId":          threadID,
+			"allThreadsStopped": true,
+		})
+	}
+
+	return s
+}
+
+// Serve reads requests until the client disconnects.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	in := bufio.NewReader(r)
+
+	for {
+		m, err := readMessage(in)
+		if err != nil {
+			s.stop()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if m.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(m)
+		s.respond(m, body, err)
+
+		switch m.Command {
+		case "initialize":
+			s.send("initialized", nil)
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+// ServeStdio reads requests from stdin and writes the responses to stdout.
+// The natives that write directly to the standard output, like os.stdout
+// or the commands of os.exec, would corrupt the messages so os.Stdout and
+// os.Stderr are replaced while it is serving and what is written to them
+// is sent to the client as output events.
+func (s *Server) ServeStdio() error {
+	return s.serveRedirected(os.Stdin, os.Stdout)
+}
+
+func (s *Server) serveRedirected(r io.Reader, w io.Writer) error {
+	stdout, stderr := os.Stdout, os.Stderr
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(&output{server: s, category: "stdout"}, outR)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(&output{server: s, category: "stderr"}, errR)
+	}()
+
+	os.Stdout, os.Stderr = outW, errW
+
+	err = s.Serve(r, w)
+
+	os.Stdout, os.Stderr = stdout, stderr
+
+	// wait until the pending output is sent
+	outW.Close()
+	errW.Close()
+	wg.Wait()
+	outR.Close()
+	errR.Close()
+
+	return err
+}
+
+func (s *Server) handle(m *message) (interface{}, error) {
+	switch m.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsConditionalBreakpoints:   true,
+			SupportsEvaluateForHovers:        true,
+			SupportTerminateDebuggee:         true,
+		}, nil
+
+	case "launch", "attach":
+		if len(m.Arguments) > 0 {
+			if err := json.Unmarshal(m.Arguments, &s.start); err != nil {
+				return nil, err
+			}
+		}
+		s.dbg.StopOnEntry = s.start.StopOnEntry
+		return nil, nil
+
+	case "setBreakpoints":
+		return s.setBreakpoints(m.Arguments)
+
+	case "setExceptionBreakpoints":
+		return map[string]interface{}{}, nil
+
+	case "configurationDone":
+		s.run()
+		return nil, nil
+
+	case "threads":
+		return map[string]interface{}{
+			"threads": []thread{{ID: threadID, Name: "main"}},
+		}, nil
+
+	case "stackTrace":
+		return s.stackTrace()
+
+	case "scopes":
+		return s.scopes(m.Arguments)
+
+	case "variables":
+		return s.variables(m.Arguments)
+
+	case "evaluate":
+		return s.evaluate(m.Arguments)
+
+	case "continue":
+		s.refs = nil
+		return map[string]interface{}{"allThreadsContinued": true}, s.dbg.Continue()
+
+	case "next":
+		s.refs = nil
+		return nil, s.dbg.StepOver()
+
+	case "stepIn":
+		s.refs = nil
+		return nil, s.dbg.StepIn()
+
+	case "stepOut":
+		s.refs = nil
+		return nil, s.dbg.StepOut()
+
+	case "pause":
+		s.dbg.Pause()
+		return nil, nil
+
+	case "disconnect", "terminate":
+		s.stop()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported command %s", m.Command)
+}
+
+// run executes the program in its own goroutine.
+func (s *Server) run() {
+	if s.start.NoDebug {
+		s.dbg.Detach()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	go func() {
+		defer close(s.done)
+
+		exitCode := 0
+		if _, err := s.vm.RunContext(ctx, s.args...); err != nil && ctx.Err() == nil {
+			s.send("output", map[string]interface{}{
+				"category": "stderr",
+				"output":   err.Error() + "\n",
+			})
+			exitCode = 1
+		}
+
+		s.send("exited", map[string]interface{}{"exitCode": exitCode})
+		s.send("terminated", nil)
+	}()
+}
+
+// stop cancels the program and waits until it ends.
+func (s *Server) stop() {
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	s.dbg.Detach()
+	<-s.done
+	s.cancel = nil
+}
+
+func (s *Server) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	bps := make([]*dune.Breakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		bps[i] = &dune.Breakpoint{Line: b.Line, Condition: b.Condition}
+	}
+
+	file, ok := s.files[args.Source.Path]
+	if !ok {
+		if abs, err := filepath.Abs(args.Source.Path); err == nil {
+			file, ok = s.files[abs]
+		}
+	}
+
+	result := make([]breakpoint, len(bps))
+
+	if !ok {
+		for i, b := range bps {
+			result[i] = breakpoint{Line: b.Line, Message: "the file is not part of the program"}
+		}
+	} else {
+		s.dbg.SetBreakpoints(file, bps)
+		for i, b := range bps {
+			result[i] = breakpoint{Verified: b.Verified, Line: b.Line}
+		}
+	}
+
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+func (s *Server) stackTrace() (interface{}, error) {
+	frames, err := s.dbg.Stack()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]stackFrame, len(frames))
+
+	for i, f := range frames {
+		// the frame ids start at 1 because 0 is the global frame
+		sf := stackFrame{ID: f.Index + 1, Name: f.Function, Line: f.Line, Column: f.Column}
+		if f.File != "" {
+			path, err := filepath.Abs(f.File)
+			if err != nil {
+				path = f.File
+			}
+			sf.Source = &source{Name: filepath.Base(f.File), Path: path}
+		}
+		result[i] = sf
+	}
+
+	return map[string]interface{}{
+		"stackFrames": result,
+		"totalFrames": len(result),
+	}, nil
+}
+
+func (s *Server) scopes(arguments json.RawMessage) (interface{}, error) {
+	var args frameArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	frame := args.FrameID - 1
+
+	var scopes []scope
+
+	if frame > 0 {
+		scopes = append(scopes, scope{Name: "Locals", VariablesReference: s.ref(scopeRef{frame, "locals"})})
+
+		closures, err := s.dbg.Closures(frame)
+		if err != nil {
+			return nil, err
+		}
+		if len(closures) > 0 {
+			scopes = append(scopes, scope{Name: "Closures", VariablesReference: s.ref(scopeRef{frame, "closures"})})
+		}
+	}
+
+	scopes = append(scopes, scope{Name: "Globals", VariablesReference: s.ref(scopeRef{0, "globals"})})
+
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(arguments json.RawMessage) (interface{}, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	i := args.VariablesReference - 1
+	if i < 0 || i >= len(s.refs) {
+		return nil, fmt.Errorf("invalid variables reference %d", args.VariablesReference)
+	}
+
+	var vars []dune.Variable
+	var err error
+
+	switch t := s.refs[i].(type) {
+	case scopeRef:
+		switch t.kind {
+		case "locals":
+			vars, err = s.dbg.Locals(t.frame)
+		case "closures":
+			vars, err = s.dbg.Closures(t.frame)
+		default:
+			vars, err = s.dbg.Globals()
+		}
+		if err != nil {
+			return nil, err
+		}
+	case dune.Value:
+		vars = s.dbg.Children(t)
+	}
+
+	result := make([]variable, len(vars))
+	for i, v := range vars {
+		result[i] = variable{
+			Name:               v.Name,
+			Value:              format(v.Value),
+			Type:               v.Value.TypeName(),
+			VariablesReference: s.valueRef(v.Value),
+		}
+	}
+
+	return map[string]interface{}{"variables": result}, nil
+}
+
+func (s *Server) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	frame := args.FrameID - 1
+	if frame < 0 {
+		// without a frame evaluate it in the current one
+		frames, err := s.dbg.Stack()
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) > 0 {
+			frame = frames[0].Index
+		}
+	}
+
+	v, err := s.dbg.Evaluate(frame, args.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"result":             format(v),
+		"type":               v.TypeName(),
+		"variablesReference": s.valueRef(v),
+	}, nil
+}
+
+// ref stores a reference that the client can expand. They are valid until it resumes.
+func (s *Server) ref(v interface{}) int {
+	s.refs = append(s.refs, v)
+	return len(s.refs)
+}
+
+func (s *Server) valueRef(v dune.Value) int {
+	if !s.dbg.HasChildren(v) {
+		return 0
+	}
+	return s.ref(v)
+}
+
+func format(v dune.Value) string {
+	switch v.Type {
+	case dune.String:
+		return strconv.Quote(v.ToString())
+	case dune.Array:
+		return "Array(" + strconv.Itoa(len(v.ToArray())) + ")"
+	case dune.Map:
+		return "Object"
+	}
+	return v.String()
+}
+
+func (s *Server) respond(m *message, body interface{}, err error) {
+	r := response{
+		Type:       "response",
+		RequestSeq: m.Seq,
+		Success:    err == nil,
+		Command:    m.Command,
+		Body:       body,
+	}
+
+	if err != nil {
+		r.Message = err.Error()
+		r.Body = nil
+	}
+
+	s.write(&r, &r.Seq)
+}
+
+func (s *Server) send(name string, body interface{}) {
+	e := event{Type: "event", Event: name, Body: body}
+	s.write(&e, &e.Seq)
+}
+
+func (s *Server) write(v interface{}, seq *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	*seq = s.seq
+
+	// the client is gone if it fails so there is nothing to do
+	writeMessage(s.out, v)
+}
+
+// output sends what the program writes as output events.
+type output struct {
+	server   *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.server.send("output", map[string]interface{}{
+		"category": o.category,
+		"output":   string(p),
+	})
+	return len(p), nil
+}
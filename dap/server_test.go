@@ -0,0 +1,276 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/filesystem"
+	_ "github.com/scorredoira/dune/lib"
+)
+
+func TestServer(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/main.ts", []byte(`function main() {
+	let a = { name: "foo" }
+	console.log(a.name)
+	return a
+}
+`))
+
+	p, err := dune.Compile(fs, "/main.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t, dune.NewVM(p))
+
+	c.request("initialize", nil)
+	c.expect("response", "initialize")
+	c.expect("event", "initialized")
+
+	c.request("launch", map[string]interface{}{})
+	c.expect("response", "launch")
+
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": p.Files[0]},
+		"breakpoints": []interface{}{map[string]interface{}{"line": 3}},
+	})
+	r := c.expect("response", "setBreakpoints")
+	var bps struct {
+		Breakpoints []breakpoint
+	}
+	c.decode(r["body"], &bps)
+	if len(bps.Breakpoints) != 1 || !bps.Breakpoints[0].Verified {
+		t.Fatalf("expected a verified breakpoint, got %v", bps)
+	}
+
+	c.request("configurationDone", nil)
+	c.expect("response", "configurationDone")
+	c.expect("event", "stopped")
+
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID})
+	var trace struct {
+		StackFrames []stackFrame
+	}
+	c.decode(c.expect("response", "stackTrace")["body"], &trace)
+	if len(trace.StackFrames) != 1 || trace.StackFrames[0].Name != "main" || trace.StackFrames[0].Line != 3 {
+		t.Fatalf("unexpected stack trace %v", trace)
+	}
+
+	c.request("scopes", map[string]interface{}{"frameId": trace.StackFrames[0].ID})
+	var scopes struct {
+		Scopes []scope
+	}
+	c.decode(c.expect("response", "scopes")["body"], &scopes)
+
+	c.request("variables", map[string]interface{}{"variablesReference": scopes.Scopes[0].VariablesReference})
+	var vars struct {
+		Variables []variable
+	}
+	c.decode(c.expect("response", "variables")["body"], &vars)
+	if len(vars.Variables) != 1 || vars.Variables[0].Name != "a" || vars.Variables[0].VariablesReference == 0 {
+		t.Fatalf("unexpected variables %v", vars)
+	}
+
+	c.request("variables", map[string]interface{}{"variablesReference": vars.Variables[0].VariablesReference})
+	c.decode(c.expect("response", "variables")["body"], &vars)
+	if len(vars.Variables) != 1 || vars.Variables[0].Value != `"foo"` {
+		t.Fatalf("unexpected properties %v", vars)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	c.expect("response", "continue")
+
+	out := c.expect("event", "output")
+	if body := out["body"].(map[string]interface{}); body["output"] != "foo\n" {
+		t.Fatalf("unexpected output %v", body)
+	}
+
+	c.expect("event", "terminated")
+
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect")
+}
+
+func TestServeStdio(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/main.ts", []byte(`function main() {
+	os.stdout.write("foo\n")
+	os.stderr.write("bar\n")
+}
+`))
+
+	p, err := dune.Compile(fs, "/main.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.AddPermission("trusted")
+
+	stdout := os.Stdout
+
+	c := connect(t, NewServer(dune.NewVM(p)).serveRedirected)
+
+	c.request("initialize", nil)
+	c.expect("response", "initialize")
+
+	c.request("launch", map[string]interface{}{})
+	c.expect("response", "launch")
+
+	c.request("configurationDone", nil)
+	c.expect("response", "configurationDone")
+
+	// the output of the pipes can arrive after the program has terminated
+	output := make(map[string]string)
+	terminated := false
+	for !terminated || output["stdout"] != "foo\n" || output["stderr"] != "bar\n" {
+		select {
+		case m, ok := <-c.in:
+			if !ok {
+				t.Fatal("the connection was closed")
+			}
+			switch m["event"] {
+			case "output":
+				body := m["body"].(map[string]interface{})
+				output[body["category"].(string)] += body["output"].(string)
+			case "terminated":
+				terminated = true
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("unexpected output %v", output)
+		}
+	}
+
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect")
+
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the server")
+	}
+
+	if os.Stdout != stdout {
+		t.Fatal("os.Stdout was not restored")
+	}
+}
+
+type client struct {
+	t    *testing.T
+	w    io.Writer
+	r    *bufio.Reader
+	seq  int
+	in   chan map[string]interface{}
+	done chan error
+}
+
+func newClient(t *testing.T, vm *dune.VM) *client {
+	return connect(t, NewServer(vm).Serve)
+}
+
+// connect runs serve in the background. When it returns
+// the error is sent to the done channel of the client.
+func connect(t *testing.T, serve func(r io.Reader, w io.Writer) error) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:    t,
+		w:    clientOut,
+		r:    bufio.NewReader(clientIn),
+		in:   make(chan map[string]interface{}, 100),
+		done: make(chan error, 1),
+	}
+
+	go func() {
+		c.done <- serve(serverIn, serverOut)
+	}()
+
+	go c.read()
+	return c
+}
+
+func (c *client) read() {
+	for {
+		header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+		if err != nil {
+			close(c.in)
+			return
+		}
+
+		n, _ := strconv.Atoi(header.Get("Content-Length"))
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			close(c.in)
+			return
+		}
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			close(c.in)
+			return
+		}
+		c.in <- m
+	}
+}
+
+func (c *client) request(command string, args interface{}) {
+	c.seq++
+	m := map[string]interface{}{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": args,
+	}
+	if err := writeMessage(c.w, m); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect skips the messages until it receives the response or the event.
+func (c *client) expect(typ, name string) map[string]interface{} {
+	c.t.Helper()
+
+	key := "command"
+	if typ == "event" {
+		key = "event"
+	}
+
+	for {
+		select {
+		case m, ok := <-c.in:
+			if !ok {
+				c.t.Fatalf("the connection was closed waiting for %s %s", typ, name)
+			}
+			if m["type"] != typ || m[key] != name {
+				continue
+			}
+			if typ == "response" && m["success"] != true {
+				c.t.Fatalf("%s failed: %v", name, m["message"])
+			}
+			return m
+		case <-time.After(5 * time.Second):
+			c.t.Fatalf("timeout waiting for %s %s", typ, name)
+		}
+	}
+}
+
+func (c *client) decode(body interface{}, v interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
@@ -0,0 +1,588 @@
+package dune
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrNotPaused = errors.New("the program is not paused")
+
+// StopReason is why the debugger has paused the execution.
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+)
+
+// Breakpoint is a line breakpoint. If it has a condition the execution
+// only stops if the expression is true.
+type Breakpoint struct {
+	Line      int
+	Condition string
+	Verified  bool // there is code in the line
+
+	// the condition compiled with the variables in scope. It is only
+	// used by the goroutine of the vm and discarded with the breakpoint.
+	code    string
+	program *Program
+}
+
+// DebugFrame is a frame of the call stack of a paused program.
+type DebugFrame struct {
+	Index    int // the frame pointer, to query its variables
+	Function string
+	File     string
+	Line     int
+	Column   int
+}
+
+// Variable is a named value shown by the debugger.
+type Variable struct {
+	Name  string
+	Value Value
+}
+
+type stepMode int
+
+const (
+	stepNone stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// location is the last line that the debugger has seen.
+type location struct {
+	fp   int
+	fn   int
+	pc   int
+	file int
+	line int
+}
+
+// Debugger stops the execution of a VM at breakpoints and steps.
+//
+// The vm calls it before each instruction but it only checks the
+// breakpoints when the execution enters a new line.
+//
+// OnStop is called from the goroutine of the VM when it pauses. The
+// execution doesn't continue until Continue or one of the steps is
+// called and, while it is paused, its frames and variables can be
+// inspected from other goroutines.
+type Debugger struct {
+	StopOnEntry bool
+	OnStop      func(reason StopReason)
+
+	vm       *VM
+	mu       sync.Mutex
+	bps      map[int]map[int]*Breakpoint // by file index and line
+	mode     stepMode
+	stepFP   int
+	last     location
+	started  bool
+	paused   bool
+	detached bool
+	pause    int32
+	resume   chan stepMode
+}
+
+// NewDebugger attaches a debugger to the vm. The async
+// functions executed in other goroutines are not debugged.
+func NewDebugger(vm *VM) *Debugger {
+	d := &Debugger{
+		vm:     vm,
+		bps:    make(map[int]map[int]*Breakpoint),
+		resume: make(chan stepMode, 1),
+		last:   location{fp: -1},
+	}
+	vm.debugger = d
+	return d
+}
+
+// SetBreakpoints replaces the breakpoints of a file. If there is no code
+// in the line the breakpoint is moved to the next line that has.
+func (d *Debugger) SetBreakpoints(file string, bps []*Breakpoint) {
+	p := d.vm.Program
+	index := p.FileIndex(file)
+
+	lines := make(map[int]*Breakpoint, len(bps))
+
+	for _, bp := range bps {
+		bp.Verified = false
+		if index == -1 {
+			continue
+		}
+		if line, ok := p.nextLineWithCode(index, bp.Line); ok {
+			bp.Line = line
+			bp.Verified = true
+			lines[line] = bp
+		}
+	}
+
+	d.mu.Lock()
+	d.bps[index] = lines
+	d.mu.Unlock()
+}
+
+// nextLineWithCode returns the first line equal or after line that has instructions.
+func (p *Program) nextLineWithCode(file, line int) (int, bool) {
+	next := -1
+	for _, f := range p.Functions {
+		for _, pos := range f.Positions {
+			if pos.File != file || pos.Line < line {
+				continue
+			}
+			if next == -1 || pos.Line < next {
+				next = pos.Line
+			}
+		}
+	}
+	return next, next != -1
+}
+
+// Continue resumes the execution until the next breakpoint.
+func (d *Debugger) Continue() error {
+	return d.resumeWith(stepNone)
+}
+
+// StepIn resumes the execution until the next line.
+func (d *Debugger) StepIn() error {
+	return d.resumeWith(stepIn)
+}
+
+// StepOver resumes the execution until the next line of the current function.
+func (d *Debugger) StepOver() error {
+	return d.resumeWith(stepOver)
+}
+
+// StepOut resumes the execution until the current function returns.
+func (d *Debugger) StepOut() error {
+	return d.resumeWith(stepOut)
+}
+
+// Pause stops the execution at the next line.
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.pause, 1)
+}
+
+// Detach removes the breakpoints and resumes the execution if it is paused.
+func (d *Debugger) Detach() {
+	d.mu.Lock()
+	d.detached = true
+	d.bps = make(map[int]map[int]*Breakpoint)
+	d.mu.Unlock()
+
+	d.resumeWith(stepNone)
+}
+
+// Paused returns true if the execution is stopped.
+func (d *Debugger) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused
+}
+
+func (d *Debugger) resumeWith(mode stepMode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.paused {
+		return ErrNotPaused
+	}
+
+	d.paused = false
+	d.resume <- mode
+	return nil
+}
+
+// check is called by the vm before executing an instruction.
+func (d *Debugger) check(vm *VM, frame *stackFrame, f *Function) {
+	pc := frame.pc
+	if pc >= len(f.Positions) {
+		return
+	}
+
+	pos := f.Positions[pc]
+	if pos.Line == 0 {
+		return
+	}
+
+	// a backward jump in the same line is a new iteration so it is checked again.
+	l := &d.last
+	if l.fp == vm.fp && l.fn == f.Index && l.file == pos.File && l.line == pos.Line && l.pc < pc {
+		l.pc = pc
+		return
+	}
+
+	*l = location{fp: vm.fp, fn: f.Index, pc: pc, file: pos.File, line: pos.Line}
+
+	reason, bp := d.shouldStop(vm, pos)
+	if bp != nil {
+		// the condition is compiled and evaluated without holding
+		// the lock to not block the requests of the client.
+		v, err := d.evaluate(vm.fp, bp.Condition, bp)
+		if err != nil || !v.ToBool() {
+			return
+		}
+		reason = StopBreakpoint
+	}
+
+	if reason != "" {
+		d.stop(vm, reason)
+	}
+}
+
+// shouldStop returns why the execution must stop in this position or,
+// if it is a breakpoint with a condition, the breakpoint to evaluate it.
+func (d *Debugger) shouldStop(vm *VM, pos Position) (StopReason, *Breakpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.detached {
+		return "", nil
+	}
+
+	if !d.started {
+		d.started = true
+		if d.StopOnEntry {
+			return StopEntry, nil
+		}
+	}
+
+	if atomic.CompareAndSwapInt32(&d.pause, 1, 0) {
+		return StopPause, nil
+	}
+
+	switch d.mode {
+	case stepIn:
+		return StopStep, nil
+	case stepOver:
+		if vm.fp <= d.stepFP {
+			return StopStep, nil
+		}
+	case stepOut:
+		if vm.fp < d.stepFP {
+			return StopStep, nil
+		}
+	}
+
+	bp, ok := d.bps[pos.File][pos.Line]
+	if !ok {
+		return "", nil
+	}
+
+	if bp.Condition != "" {
+		return "", bp
+	}
+
+	return StopBreakpoint, nil
+}
+
+// stop blocks the vm until the execution is resumed.
+func (d *Debugger) stop(vm *VM, reason StopReason) {
+	d.mu.Lock()
+	d.paused = true
+	d.mode = stepNone
+	d.mu.Unlock()
+
+	if d.OnStop != nil {
+		d.OnStop(reason)
+	}
+
+	mode := <-d.resume
+
+	d.mu.Lock()
+	d.mode = mode
+	d.stepFP = vm.fp
+	d.mu.Unlock()
+}
+
+// Stack returns the frames of the paused program starting from the current one.
+func (d *Debugger) Stack() ([]DebugFrame, error) {
+	if !d.Paused() {
+		return nil, ErrNotPaused
+	}
+
+	vm := d.vm
+	p := vm.Program
+
+	var frames []DebugFrame
+
+	for i := vm.fp; i >= 0; i-- {
+		frame := vm.callStack[i]
+		f := p.Functions[frame.funcIndex]
+
+		if f.IsGlobal && vm.initialized {
+			// the global function has ended
+			continue
+		}
+
+		// the pc of the callers has already advanced past the call
+		pc := frame.pc
+		if i != vm.fp && pc > 0 {
+			pc--
+		}
+
+		file, pos := p.position(f, pc)
+
+		frames = append(frames, DebugFrame{
+			Index:    i,
+			Function: f.Name,
+			File:     file,
+			Line:     pos.Line,
+			Column:   pos.Column,
+		})
+	}
+
+	return frames, nil
+}
+
+// position returns the file and the position of the instruction. Instructions
+// without position belong to the previous one like in ToTraceLine.
+func (p *Program) position(f *Function, pc int) (string, Position) {
+	if pc >= len(f.Positions) {
+		return "", Position{}
+	}
+
+	for pc > 0 && f.Positions[pc].Line == 0 {
+		pc--
+	}
+
+	pos := f.Positions[pc]
+
+	var file string
+	if pos.File < len(p.Files) {
+		file = p.Files[pos.File]
+	}
+
+	return file, pos
+}
+
+// Locals returns the variables of the frame that are in scope.
+func (d *Debugger) Locals(frameIndex int) ([]Variable, error) {
+	frame, f, err := d.frame(frameIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if frameIndex == 0 {
+		return d.Globals()
+	}
+
+	pc := frame.pc
+	if frameIndex != d.vm.fp && pc > 0 {
+		pc--
+	}
+
+	return registerVariables(f.Registers, frame.values, pc), nil
+}
+
+// Closures returns the variables captured by the function of the frame.
+func (d *Debugger) Closures(frameIndex int) ([]Variable, error) {
+	frame, _, err := d.frame(frameIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars []Variable
+	for _, c := range frame.closures {
+		if isDebugName(c.register.Name) {
+			vars = append(vars, Variable{Name: c.register.Name, Value: c.get()})
+		}
+	}
+
+	sortVariables(vars)
+	return vars, nil
+}
+
+// Globals returns the global variables of the program.
+func (d *Debugger) Globals() ([]Variable, error) {
+	if !d.Paused() {
+		return nil, ErrNotPaused
+	}
+
+	vm := d.vm
+	f := vm.Program.Functions[0]
+	return registerVariables(f.Registers, vm.callStack[0].values, -1), nil
+}
+
+func (d *Debugger) frame(index int) (*stackFrame, *Function, error) {
+	if !d.Paused() {
+		return nil, nil, ErrNotPaused
+	}
+
+	vm := d.vm
+	if index < 0 || index > vm.fp {
+		return nil, nil, errors.New("invalid frame " + strconv.Itoa(index))
+	}
+
+	frame := vm.callStack[index]
+	return frame, vm.Program.Functions[frame.funcIndex], nil
+}
+
+// registerVariables returns the named registers that are in scope at pc.
+// If two have the same name the one declared later shadows the other.
+// A pc of -1 returns all of them.
+func registerVariables(registers []*Register, values []Value, pc int) []Variable {
+	byName := make(map[string]*Register)
+
+	for _, r := range registers {
+		if !isDebugName(r.Name) || r.Index >= len(values) {
+			continue
+		}
+		if pc != -1 && (pc < r.StartPC || (r.EndPC != 0 && pc > r.EndPC)) {
+			continue
+		}
+		if prev, ok := byName[r.Name]; ok && prev.StartPC > r.StartPC {
+			continue
+		}
+		byName[r.Name] = r
+	}
+
+	vars := make([]Variable, 0, len(byName))
+	for name, r := range byName {
+		vars = append(vars, Variable{Name: name, Value: values[r.Index]})
+	}
+
+	sortVariables(vars)
+	return vars
+}
+
+// isDebugName excludes the temporary registers and the ones created by the compiler.
+func isDebugName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "@")
+}
+
+func sortVariables(vars []Variable) {
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+}
+
+// Children returns the elements of arrays, the properties of
+// objects and the fields of class instances.
+func (d *Debugger) Children(v Value) []Variable {
+	var vars []Variable
+
+	switch v.Type {
+	case Array:
+		for i, item := range v.ToArray() {
+			vars = append(vars, Variable{Name: strconv.Itoa(i), Value: item})
+		}
+
+	case Map:
+		m := v.ToMap()
+		m.RLock()
+		for k, item := range m.Map {
+			vars = append(vars, Variable{Name: k.String(), Value: item})
+		}
+		m.RUnlock()
+		sortVariables(vars)
+
+	case Object:
+		i, ok := v.ToObject().(*instance)
+		if !ok {
+			return nil
+		}
+		i.RLock()
+		for k, item := range i.iMap {
+			vars = append(vars, Variable{Name: k, Value: item})
+		}
+		i.RUnlock()
+		sortVariables(vars)
+	}
+
+	return vars
+}
+
+// HasChildren returns true if the value can be expanded with Children.
+func (d *Debugger) HasChildren(v Value) bool {
+	switch v.Type {
+	case Array, Map:
+		return true
+	case Object:
+		_, ok := v.ToObject().(*instance)
+		return ok
+	}
+	return false
+}
+
+// Evaluate evaluates an expression with the variables in scope in the frame.
+// The functions of the program can't be called from it.
+func (d *Debugger) Evaluate(frameIndex int, expr string) (Value, error) {
+	if !d.Paused() {
+		return NullValue, ErrNotPaused
+	}
+	return d.evaluate(frameIndex, expr, nil)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// evaluate compiles the expression as a function with a parameter
+// for each variable and executes it in a new vm. The conditions of
+// the breakpoints are compiled once while the variables don't change.
+func (d *Debugger) evaluate(frameIndex int, expr string, bp *Breakpoint) (Value, error) {
+	vm := d.vm
+	frame := vm.callStack[frameIndex]
+	f := vm.Program.Functions[frame.funcIndex]
+
+	pc := frame.pc
+	if frameIndex != vm.fp && pc > 0 {
+		pc--
+	}
+
+	// the inner scopes shadow the outer ones
+	scope := registerVariables(vm.Program.Functions[0].Registers, vm.callStack[0].values, -1)
+	for _, c := range frame.closures {
+		scope = append(scope, Variable{Name: c.register.Name, Value: c.get()})
+	}
+	if frameIndex > 0 {
+		scope = append(scope, registerVariables(f.Registers, frame.values, pc)...)
+	}
+
+	index := make(map[string]int)
+	var names []string
+	var values []Value
+
+	for _, v := range scope {
+		if !identifier.MatchString(v.Name) {
+			continue
+		}
+		if i, ok := index[v.Name]; ok {
+			values[i] = v.Value
+			continue
+		}
+		index[v.Name] = len(names)
+		names = append(names, v.Name)
+		values = append(values, v.Value)
+	}
+
+	code := "function main(" + strings.Join(names, ", ") + ") {\n return " + expr + "\n}"
+
+	var p *Program
+	if bp != nil && bp.code == code {
+		p = bp.program
+	} else {
+		var err error
+		p, err = CompileStr(code)
+		if err != nil {
+			return NullValue, err
+		}
+		if bp != nil {
+			bp.code = code
+			bp.program = p
+		}
+	}
+
+	m := NewVM(p)
+	m.MaxSteps = 100000
+	return m.Run(values...)
+}
@@ -95,6 +95,12 @@ func (e Error) Is(msg string) bool {
 	return false
 }
 
+// Unwrap returns the go error that originated it if any so
+// errors.Is(err, context.DeadlineExceeded) works.
+func (e Error) Unwrap() error {
+	return e.goError
+}
+
 func goErrorIs(err error, msg string) bool {
 	if err == nil {
 		return false
@@ -0,0 +1,623 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// precedence returns the binding power of an expression. An operand
+// with less precedence than required by its context is enclosed in parens.
+func precedence(e ast.Expr) int {
+	switch t := e.(type) {
+	case *ast.FuncDeclExpr, *ast.YieldExpr:
+		return 0
+	case *ast.TernaryExpr:
+		return 1
+	case *ast.BinaryExpr:
+		switch t.Operator {
+		case ast.LAND, ast.LOR, ast.NOR:
+			return 2
+		case ast.ADD, ast.SUB:
+			return 4
+		case ast.MUL, ast.DIV, ast.MOD:
+			return 5
+		case ast.POW:
+			return 6
+		}
+		return 3
+	case *ast.UnaryExpr, *ast.AwaitExpr, *ast.AsExpr:
+		return 7
+	}
+	return 8
+}
+
+var operators = map[ast.Type]string{
+	ast.ADD:        "+",
+	ast.SUB:        "-",
+	ast.MUL:        "*",
+	ast.DIV:        "/",
+	ast.MOD:        "%",
+	ast.POW:        "**",
+	ast.AND:        "&",
+	ast.BOR:        "|",
+	ast.XOR:        "^",
+	ast.LSH:        "<<",
+	ast.RSH:        ">>",
+	ast.URSH:       ">>>",
+	ast.BNT:        "~",
+	ast.NOT:        "!",
+	ast.LAND:       "&&",
+	ast.LOR:        "||",
+	ast.NOR:        "??",
+	ast.EQL:        "==",
+	ast.SEQ:        "===",
+	ast.NEQ:        "!=",
+	ast.SNE:        "!==",
+	ast.LSS:        "<",
+	ast.GTR:        ">",
+	ast.LEQ:        "<=",
+	ast.GEQ:        ">=",
+	ast.INSTANCEOF: "instanceof",
+	ast.IN:         "in",
+}
+
+// expr writes an expression that must have at least the precedence min.
+func (p *printer) expr(e ast.Expr, min int) {
+	if precedence(e) < min {
+		p.print("(")
+		p.expr(e, 0)
+		p.print(")")
+		return
+	}
+
+	switch t := e.(type) {
+	case *ast.IdentExpr:
+		p.mark(t.Pos)
+		p.print(t.Name)
+		p.typeArgs(t.TypeArgs)
+
+	case *ast.ConstantExpr:
+		p.mark(t.Pos)
+		p.constant(t)
+
+	case *ast.BinaryExpr:
+		op, ok := operators[t.Operator]
+		if !ok {
+			p.error(t)
+			return
+		}
+		prec := precedence(t)
+		if t.Operator == ast.POW {
+			// right associative: a ** b ** c is a ** (b ** c)
+			p.expr(t.Left, prec+1)
+			p.print(" " + op + " ")
+			p.expr(t.Right, prec)
+			return
+		}
+		p.operand(t.Left, t.Operator, prec)
+		p.print(" " + op + " ")
+		p.expr(t.Right, prec+1)
+
+	case *ast.UnaryExpr:
+		op, ok := operators[t.Operator]
+		if !ok {
+			p.error(t)
+			return
+		}
+		p.mark(t.Pos)
+		p.print(op)
+		p.expr(t.Operand, 8)
+
+	case *ast.TernaryExpr:
+		p.expr(t.Condition, 3)
+		p.print(" ? ")
+		p.expr(t.Left, 1)
+		p.print(" : ")
+		p.expr(t.Right, 1)
+
+	case *ast.AwaitExpr:
+		p.mark(t.Pos)
+		p.print("await ")
+		p.expr(t.X, 7)
+
+	case *ast.YieldExpr:
+		p.mark(t.Pos)
+		p.print("yield")
+		if t.Delegate {
+			p.print("*")
+		}
+		if t.X != nil {
+			p.print(" ")
+			p.expr(t.X, 0)
+		}
+
+	case *ast.AsExpr:
+		if _, ok := t.X.(*ast.AsExpr); ok {
+			p.expr(t.X, 7)
+		} else {
+			// the operand of an unary operator includes the assertion: -x as T
+			p.expr(t.X, 8)
+		}
+		p.print(" as ")
+		p.typ(t.Type, 0)
+
+	case *ast.SelectorExpr:
+		p.chainBase(t.X)
+		if t.Optional {
+			p.print("?.")
+		} else {
+			p.print(".")
+		}
+		p.expr(t.Sel, 8)
+
+	case *ast.IndexExpr:
+		p.chainBase(t.Left)
+		if t.Optional {
+			p.print("?.")
+		}
+		p.mark(t.Lbrack)
+		p.print("[")
+		p.expr(t.Index, 1)
+		p.mark(t.Rbrack)
+		p.print("]")
+
+	case *ast.CallExpr:
+		p.chainBase(t.Ident)
+		if t.Optional {
+			p.print("?.")
+		}
+		p.args(t.Lparen, t.Args)
+		p.mark(t.Rparen)
+
+	case *ast.NewInstanceExpr:
+		p.print("new ")
+		p.expr(t.Name, 8)
+		p.args(t.Lparen, t.Args)
+		p.mark(t.Rparen)
+
+	case *ast.SpreadExpr:
+		p.mark(t.Pos)
+		p.print("...")
+		p.expr(t.X, 0)
+
+	case *ast.ArrayDeclExpr:
+		start := func(i int) ast.Position { return exprStart(t.List[i]) }
+		elem := func(i int) { p.expr(t.List[i], 0) }
+		p.list("[", "]", t.Pos, len(t.List), start, elem)
+
+	case *ast.MapDeclExpr:
+		start := func(i int) ast.Position { return exprStart(t.List[i].Value) }
+		elem := func(i int) {
+			kv := t.List[i]
+			switch kv.KeyType {
+			case ast.STRING:
+				p.print(quote(kv.Key) + ": ")
+			case 0:
+				// a spread element: ...obj
+			default:
+				p.print(kv.Key + ": ")
+			}
+			p.expr(kv.Value, 0)
+		}
+		p.list("{", "}", t.Pos, len(t.List), start, elem)
+
+	case *ast.TemplateExpr:
+		if t.Tag != nil {
+			p.chainBase(t.Tag)
+		}
+		p.mark(t.Pos)
+		p.print("`")
+		for i, s := range t.Strings {
+			p.print(escapeTemplate(s))
+			if i < len(t.Values) {
+				p.print("${")
+				p.expr(t.Values[i], 0)
+				p.print("}")
+			}
+		}
+		p.print("`")
+
+	case *ast.FuncDeclExpr:
+		p.funcExpr(t)
+
+	case *ast.PatternExpr:
+		p.pattern(t)
+
+	default:
+		p.error(t)
+	}
+}
+
+// operand writes the left operand of a binary expression. The logical and
+// relational operators have the same precedence, so a different operator
+// is wrapped in parens even if they are redundant: (a || b) && c
+func (p *printer) operand(e ast.Expr, op ast.Type, prec int) {
+	if b, ok := e.(*ast.BinaryExpr); ok && b.Operator != op && precedence(b) == prec && prec <= 3 {
+		p.print("(")
+		p.expr(e, 0)
+		p.print(")")
+		return
+	}
+	p.expr(e, prec)
+}
+
+// chainBase writes the left part of a selector, an index, a call or a
+// tagged template.
+func (p *printer) chainBase(e ast.Expr) {
+	if chainParens(e) {
+		p.print("(")
+		p.expr(e, 0)
+		p.print(")")
+		return
+	}
+
+	p.expr(e, 8)
+}
+
+// chainParens returns true if e must be enclosed in parens to be the left
+// part of a chain. Only names, chains and some literals can be followed by
+// a selector: ([1, 2]).length
+func chainParens(e ast.Expr) bool {
+	switch t := e.(type) {
+	case *ast.IdentExpr, *ast.NewInstanceExpr, *ast.TemplateExpr:
+		return false
+	case *ast.SelectorExpr:
+		// a complete chain in parens ends the optional chaining: (a?.b).c
+		return t.First
+	case *ast.CallExpr:
+		return t.First
+	case *ast.IndexExpr:
+		return t.First
+	case *ast.ConstantExpr:
+		return t.Kind != ast.REGEX
+	}
+	return true
+}
+
+// startsWithParen returns true if e is written starting with a paren.
+func startsWithParen(e ast.Expr) bool {
+	for {
+		var base ast.Expr
+		switch t := e.(type) {
+		case *ast.SelectorExpr:
+			base = t.X
+		case *ast.CallExpr:
+			base = t.Ident
+		case *ast.IndexExpr:
+			base = t.Left
+		case *ast.TemplateExpr:
+			base = t.Tag
+		default:
+			return false
+		}
+		if base == nil {
+			return false
+		}
+		if chainParens(base) {
+			return true
+		}
+		e = base
+	}
+}
+
+// args writes the arguments of a call.
+func (p *printer) args(lparen ast.Position, args []ast.Expr) {
+	start := func(i int) ast.Position { return exprStart(args[i]) }
+	elem := func(i int) { p.expr(args[i], 0) }
+	p.list("(", ")", lparen, len(args), start, elem)
+}
+
+// typeArgs writes the type arguments of a generic call: foo<T>()
+func (p *printer) typeArgs(args []ast.TypeExpr) {
+	if len(args) == 0 {
+		return
+	}
+	p.print("<")
+	for i, a := range args {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.typ(a, 0)
+	}
+	p.print(">")
+}
+
+func (p *printer) constant(t *ast.ConstantExpr) {
+	switch t.Kind {
+	case ast.STRING:
+		if p.sourceChar(t.Pos) == '`' && canBacktick(t.Value) && !p.afterValue() {
+			p.print("`" + escapeTemplate(t.Value) + "`")
+		} else {
+			p.print(quote(t.Value))
+		}
+
+	case ast.RUNE:
+		p.print(quoteRune(t.Value))
+
+	case ast.INT, ast.FLOAT:
+		if t.Raw != "" {
+			p.print(t.Raw)
+		} else {
+			p.print(t.Value)
+		}
+
+	default:
+		p.print(t.Value)
+	}
+}
+
+// afterValue returns true if the last thing written is a value. A
+// backtick after it would be lexed as a tagged template: foo`bar`
+func (p *printer) afterValue() bool {
+	b := p.out.Bytes()
+	if len(b) == 0 {
+		return false
+	}
+
+	switch c := b[len(b)-1]; {
+	case c == ')' || c == ']':
+		return true
+	case !isIdentChar(c):
+		return false
+	}
+
+	i := len(b)
+	for i > 0 && isIdentChar(b[i-1]) {
+		i--
+	}
+
+	word := string(b[i:])
+	if word[0] >= '0' && word[0] <= '9' {
+		return false
+	}
+	return !keywords[word]
+}
+
+// funcExpr writes a function expression or a lambda.
+func (p *printer) funcExpr(t *ast.FuncDeclExpr) {
+	p.mark(t.Pos)
+
+	if t.Async {
+		p.print("async ")
+	}
+
+	if !t.Lambda {
+		p.print("function")
+		if t.Generator {
+			p.print("*")
+		}
+		p.funcSignature(t.Args, t.Variadic, t.Result)
+		p.print(" ")
+		p.block(t.Body)
+		return
+	}
+
+	if f := singleParam(t); f != nil {
+		p.print(f.Name)
+	} else {
+		p.funcSignature(t.Args, t.Variadic, t.Result)
+	}
+
+	p.print(" => ")
+
+	if ret := implicitReturn(t.Body); ret != nil {
+		// a map at the start of the body would be read as a block
+		if _, ok := leftmost(ret.Value).(*ast.MapDeclExpr); ok {
+			p.print("(")
+			p.expr(ret.Value, 0)
+			p.print(")")
+		} else {
+			p.expr(ret.Value, 1)
+		}
+		return
+	}
+
+	p.block(t.Body)
+}
+
+// singleParam returns the parameter of a lambda written without parens: t => t
+func singleParam(t *ast.FuncDeclExpr) *ast.Field {
+	if t.Args == nil || len(t.Args.List) != 1 || t.Variadic || t.Result != nil {
+		return nil
+	}
+
+	f := t.Args.List[0]
+	if f.Pos != t.Args.Opening || f.Pattern != nil || f.Type != nil || f.Default != nil || f.Optional {
+		return nil
+	}
+	return f
+}
+
+// implicitReturn returns the return statement that the parser adds to the
+// body of lambdas written as an expression: t => t * 2
+func implicitReturn(b *ast.BlockStmt) *ast.ReturnStmt {
+	if len(b.List) != 1 {
+		return nil
+	}
+
+	ret, ok := b.List[0].(*ast.ReturnStmt)
+	if !ok || ret.Value == nil {
+		return nil
+	}
+
+	if b.Lbrace != ret.Pos || ret.Pos != ret.Value.Position() {
+		return nil
+	}
+	return ret
+}
+
+// leftmost returns the expression written first in e.
+func leftmost(e ast.Expr) ast.Expr {
+	for {
+		switch t := e.(type) {
+		case *ast.BinaryExpr:
+			e = t.Left
+		case *ast.TernaryExpr:
+			e = t.Condition
+		case *ast.AsExpr:
+			e = t.X
+		default:
+			return e
+		}
+	}
+}
+
+// pattern writes a destructuring pattern: { a, b: [c, d] = [] }
+func (p *printer) pattern(t *ast.PatternExpr) {
+	start := func(i int) ast.Position { return t.Elements[i].Pos }
+	elem := func(i int) {
+		e := t.Elements[i]
+		if e.Target == nil {
+			// a hole at the end needs a comma: [a, ,]
+			if i == len(t.Elements)-1 {
+				p.print(",")
+			}
+			return
+		}
+
+		p.mark(e.Pos)
+
+		if e.Rest {
+			p.print("...")
+		}
+
+		if t.IsObject && !e.Rest {
+			if id, ok := e.Target.(*ast.IdentExpr); ok && id.Name == e.Key && isIdent(e.Key) && id.TypeArgs == nil {
+				p.print(e.Key)
+			} else {
+				if isIdent(e.Key) {
+					p.print(e.Key)
+				} else {
+					p.print(quote(e.Key))
+				}
+				p.print(": ")
+				p.expr(e.Target, 8)
+			}
+		} else {
+			p.expr(e.Target, 8)
+		}
+
+		if e.Default != nil {
+			p.print(" = ")
+			p.expr(e.Default, 0)
+		}
+	}
+
+	if t.IsObject {
+		p.list("{", "}", t.Pos, len(t.Elements), start, elem)
+	} else {
+		p.list("[", "]", t.Pos, len(t.Elements), start, elem)
+	}
+}
+
+// keywords can't be used as names.
+var keywords = map[string]bool{
+	"if": true, "else": true, "for": true, "while": true, "break": true,
+	"continue": true, "return": true, "true": true, "false": true,
+	"import": true, "export": true, "function": true, "interface": true,
+	"var": true, "let": true, "const": true, "enum": true, "switch": true,
+	"case": true, "default": true, "null": true, "undefined": true,
+	"try": true, "catch": true, "throw": true, "finally": true, "new": true,
+	"class": true, "delete": true, "typeof": true, "instanceof": true,
+	"in": true, "do": true, "await": true, "yield": true,
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isIdent returns true if s can be written as a name.
+func isIdent(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' || keywords[s] {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// quote returns s as a double quoted string.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+			i++
+			continue
+		}
+		b.WriteString(escape(s[i:i+size], '"'))
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteRune returns a single byte string single quoted: 'a'
+func quoteRune(s string) string {
+	if len(s) == 1 && s[0] >= utf8.RuneSelf {
+		return fmt.Sprintf(`'\x%02x'`, s[0])
+	}
+	return "'" + escape(s, '\'') + "'"
+}
+
+// escape returns the escaped form of a character in a quoted string.
+func escape(c string, quote byte) string {
+	switch c {
+	case string(quote):
+		return `\` + c
+	case `\`:
+		return `\\`
+	case "\n":
+		return `\n`
+	case "\t":
+		return `\t`
+	case "\r":
+		return `\r`
+	}
+
+	if len(c) == 1 && (c[0] < 0x20 || c[0] == 0x7f) {
+		return fmt.Sprintf(`\x%02x`, c[0])
+	}
+	return c
+}
+
+// canBacktick returns true if a string can be written as a multiline
+// string without changing its value.
+func canBacktick(s string) bool {
+	if strings.HasSuffix(s, `\`) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 && c != '\n' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return utf8.ValidString(s)
+}
+
+// escapeTemplate escapes the backticks and the characters that would
+// start a substitution in the text of a template.
+func escapeTemplate(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '`':
+			b.WriteString("\\`")
+		case c == '$' && (i+1 < len(s) && s[i+1] == '{' || i > 0 && s[i-1] == '\\'):
+			b.WriteString(`\$`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+// Package format prints Dune programs in a canonical style.
+//
+// The printer writes the source of an ast.File. Comments, directives and
+// blank lines are kept, and lists like arrays, maps, arguments and
+// parameters are written in multiple lines if they were written that way,
+// with the first element in a new line.
+package format
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/parser"
+)
+
+// Source formats the code of a program. The code after a //ts:ignore
+// comment is not parsed so it is written as is.
+func Source(src []byte) ([]byte, error) {
+	code := strings.Replace(string(src), "\r", "", -1)
+
+	var ignored string
+	if i := strings.Index(code, "//ts:ignore"); i != -1 {
+		if j := strings.LastIndexByte(code[:i], '\n'); j != -1 {
+			i = j + 1
+		} else {
+			i = 0
+		}
+		code, ignored = code[:i], code[i:]
+	}
+
+	m, err := parser.ParseStr(code)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := Fprint(&b, m.File, []byte(code)); err != nil {
+		return nil, err
+	}
+
+	if ignored != "" {
+		if b.Len() > 0 && strings.HasSuffix(code, "\n\n") {
+			b.WriteByte('\n')
+		}
+		b.WriteString(ignored)
+	}
+
+	return b.Bytes(), nil
+}
+
+// Fprint writes the source of the file to w. src is the code that the file
+// was parsed from. It is used to keep the layout and the comments and can
+// be nil for files that are not parsed.
+func Fprint(w io.Writer, f *ast.File, src []byte) error {
+	p := newPrinter(f, src)
+	p.printFile()
+	if p.err != nil {
+		return p.err
+	}
+
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
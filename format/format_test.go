@@ -0,0 +1,277 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/parser"
+)
+
+func TestFormatTests(t *testing.T) {
+	paths, err := filepath.Glob("../tests/*.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".d.ts") {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := roundTrip(string(b)); err != "" {
+			t.Errorf("%s: %s", path, err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src := `// [permissions trusted]
+import * as http from 'http'
+
+
+// doc of foo
+export function foo(a:number,b?:string) : string {
+    var x = (a + b) * 2; // twice
+    if (x>1) { return 'ab' } else if (x) { x++ }
+    let f = function () { return x }
+    let o = {a:1, b:2, 'c-d':3}
+    let v = ((a || b) && c) || (d && e)
+
+    return ` + "`${x}`" + `
+}
+
+enum E { A, B = 5, C }
+`
+
+	expected := `// [permissions trusted]
+
+import * as http from "http"
+
+// doc of foo
+export function foo(a: number, b?: string): string {
+    var x = (a + b) * 2 // twice
+    if (x > 1) {
+        return "ab"
+    } else if (x) {
+        x++
+    }
+    let f = function() {
+        return x
+    }
+    let o = { a: 1, b: 2, "c-d": 3 }
+    let v = ((a || b) && c) || (d && e)
+
+    return ` + "`${x}`" + `
+}
+
+enum E {
+    A,
+    B = 5,
+    C
+}
+`
+
+	b, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+}
+
+func TestFormatIgnore(t *testing.T) {
+	src := "function f() {\n    return\n}\n\n//ts:ignore\nanything  goes\n"
+
+	b, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != src {
+		t.Fatalf("the code after ts:ignore changed:\n%s", b)
+	}
+}
+
+func TestFormatLayoutOnly(t *testing.T) {
+	tests := []struct {
+		src, expected string
+	}{
+		{
+			"var a = 1\nexport var b\nlet c = 2\nconst d = 3\n",
+			"var a = 1\nexport var b\nlet c = 2\nconst d = 3\n",
+		},
+		{
+			"var [a, b] = c\nvar {d} = e\nfor (var i = 0, j = 1; i < j; i++) {}\nfor (var k of list) {}\n",
+			"var [a, b] = c\nvar { d } = e\nfor (var i = 0, j = 1; i < j; i++) {}\nfor (var k of list) {}\n",
+		},
+		{
+			"function f() {\n    let a = 1\n\n    outer:\n    for (;;) {\n        break outer\n    }\n}\n",
+			"function f() {\n    let a = 1\n\n    outer: for (;;) {\n        break outer\n    }\n}\n",
+		},
+		{
+			"let a = 1\n\nouter:\nwhile (a) {\n    switch (a) {\n        case 1:\n            a++\n\n            inner:\n            do {\n                break inner\n            } while (a)\n    }\n}\n",
+			"let a = 1\n\nouter: while (a) {\n    switch (a) {\n        case 1:\n            a++\n\n            inner: do {\n                break inner\n            } while (a)\n    }\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		b, err := Source([]byte(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, b)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"let x = a ** b ** c\nlet y = (a ** b) ** c",
+		"let x = -(a + b) + -c - -d",
+		"let x = !(a as any)\nlet y = (-a) as number",
+		"let x = a ? b : c ? d : e",
+		"let x = (a?.b).c + a?.b?.[c]?.(d)",
+		"let x = ([1, 2]).length + (\"abc\").length",
+		"let x = new Foo.Bar(1).baz + tag`a ${b}`",
+		"let x = () => ({ a: 1 })",
+		"let x = 'it\\'s' + \"a\\\"b\\\\c\\n\" + 'a'",
+		"let x = `a\nb ${c} \\${d} \\` e`",
+		"let x = 0xFF + 1_000 + 1.50",
+		"let x = /ab+c/gi.test(s)",
+		"let [a, , b = 4, ...c] = d",
+		"let { a, b: { c }, \"d-e\": f = 1, ...g } = h",
+		"let x = 1\n;[a, b] = [b, a]\n;(a as any).b = 1",
+		"let x = [\n    1,\n    2, // two\n    3\n]",
+		"/* a */ let x = 1 /* b */\n\n// c\n\n// d\nlet y = 2 // e\n// f",
+		"@route(\"/x\")\n@auth\nexport async function f<T>(a: T, ...b: T[]): Promise<T> {}",
+		"class A<T> extends B implements C {\n    private x: number = 1\n    static readonly y = 2\n    get z() { return 1 }\n    *gen() {}\n}",
+		"class A {\n    items = [1, 2];\n    *values() {}\n}",
+		"interface I<T extends object = {}> extends J {\n    a?: T[];\n    [key: string]: any\n    (v: number): string\n    new (v: number): I\n    m<U>(...a: U[]): void\n}",
+		"type T = \"a\" | (() => void) | A & B | (A | B)[] | [number, string]",
+		"type L = `a-${string}`\nlet x: `${L | \"b\"}-${number}px` = f()",
+		"enum E { A = \"a\", B = 2, C }",
+		"outer: for (let i = 0; i < 10; i++) {\n    for (const k of list) { continue outer }\n}",
+		"switch (x) {\n    case 1:\n    case 2: f(); break\n    // default\n    default:\n        g()\n}",
+		"try { throw new Error(\"x\") } catch (e) { f(e) } finally { g() }",
+		"do { x++ } while (x < 10)\nwhile (x) { x-- }\nfor (;;) {}",
+		"export default function() {}",
+		"import { a, b as c, type D } from \"./a\"\nimport type { T } from \"./t\"",
+	}
+
+	for _, code := range tests {
+		if err := roundTrip(code); err != "" {
+			t.Errorf("%s\n%s", code, err)
+		}
+	}
+}
+
+// roundTrip formats the code and checks that the result has the same
+// AST and comments and that formatting it again doesn't change it.
+func roundTrip(code string) string {
+	a, err := parser.ParseStr(code)
+	if err != nil {
+		return "invalid test: " + err.Error()
+	}
+
+	b, err := Source([]byte(code))
+	if err != nil {
+		return err.Error()
+	}
+
+	c, err := parser.ParseStr(string(b))
+	if err != nil {
+		return err.Error() + "\n" + string(b)
+	}
+
+	if !equalFiles(a.File, c.File) {
+		return "the AST changed:\n" + string(b)
+	}
+
+	d, err := Source(b)
+	if err != nil {
+		return err.Error()
+	}
+
+	if string(d) != string(b) {
+		return "not idempotent:\n" + string(b) + "\n---\n" + string(d)
+	}
+
+	return ""
+}
+
+// equalFiles compares two files ignoring the positions.
+func equalFiles(a, b *ast.File) bool {
+	if len(a.Comments) != len(b.Comments) {
+		return false
+	}
+	for i, c := range a.Comments {
+		if commentText(c) != commentText(b.Comments[i]) {
+			return false
+		}
+	}
+
+	x, y := *a, *b
+	x.Comments, y.Comments = nil, nil
+
+	clear := make(map[uintptr]bool)
+	clearPositions(reflect.ValueOf(&x), clear)
+	clearPositions(reflect.ValueOf(&y), clear)
+	return reflect.DeepEqual(x, y)
+}
+
+// commentText returns the words of a comment.
+func commentText(c *ast.Comment) string {
+	return strings.Join(strings.Fields(c.Str), " ")
+}
+
+var positionType = reflect.TypeOf(ast.Position{})
+var commentType = reflect.TypeOf(&ast.Comment{})
+
+// clearPositions sets to zero all the positions and comments of a node.
+func clearPositions(v reflect.Value, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		clearPositions(v.Elem(), seen)
+
+	case reflect.Interface:
+		if !v.IsNil() {
+			clearPositions(v.Elem(), seen)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			clearPositions(v.Index(i), seen)
+		}
+
+	case reflect.Struct:
+		if v.Type() == positionType {
+			if v.CanSet() {
+				v.Set(reflect.Zero(positionType))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if f.Type() == commentType {
+				f.Set(reflect.Zero(commentType))
+				continue
+			}
+			clearPositions(f, seen)
+		}
+	}
+}
@@ -0,0 +1,668 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+const indentation = "    "
+
+type printer struct {
+	file *ast.File
+	err  error
+
+	out       bytes.Buffer
+	indent    int
+	lineStart bool // nothing has been written in the current line
+	lastLine  int  // the last line of the source that has been printed
+
+	lines   []string
+	tokens  []*ast.Token
+	index   map[ast.Position]int // the index of the tokens by position
+	closing map[int]int          // the closing bracket of each opening one
+
+	comments []*ast.Comment
+	trailing map[*ast.Comment]bool // written after code in the same line
+	next     int                   // the next comment to print
+
+	current         ast.Stmt // the top level declaration being printed
+	defaultExported bool
+}
+
+func newPrinter(f *ast.File, src []byte) *printer {
+	p := &printer{
+		file:      f,
+		lineStart: true,
+		index:     make(map[ast.Position]int),
+		closing:   make(map[int]int),
+		trailing:  make(map[*ast.Comment]bool),
+	}
+
+	p.comments = append(p.comments, f.Comments...)
+	sort.SliceStable(p.comments, func(i, j int) bool {
+		return before(p.comments[i].Pos, p.comments[j].Pos)
+	})
+
+	if src == nil {
+		return p
+	}
+
+	p.lines = strings.Split(string(src), "\n")
+
+	l := ast.New(bytes.NewReader(src), "")
+	if err := l.Run(); err != nil {
+		return p
+	}
+	p.tokens = l.Tokens
+
+	var open []int
+	for i, t := range p.tokens {
+		p.index[t.Pos] = i
+		switch t.Type {
+		case ast.LPAREN, ast.LBRACK, ast.LBRACE, ast.DOLLAR_LBRACE:
+			open = append(open, i)
+		case ast.RPAREN, ast.RBRACK, ast.RBRACE:
+			if n := len(open); n > 0 {
+				p.closing[open[n-1]] = i
+				open = open[:n-1]
+			}
+		}
+	}
+
+	for _, c := range p.comments {
+		if i, ok := p.index[c.Pos]; ok && i > 0 {
+			p.trailing[c] = p.tokens[i-1].Pos.Line == startLine(c)
+		}
+	}
+
+	return p
+}
+
+func (p *printer) error(n interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("format: unexpected %T", n)
+	}
+}
+
+// print writes s indenting it if it is the start of a line.
+func (p *printer) print(s string) {
+	if s == "" {
+		return
+	}
+	if p.lineStart {
+		for i := 0; i < p.indent; i++ {
+			p.out.WriteString(indentation)
+		}
+		p.lineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+// linebreak ends the current line. The comments that were written
+// at the end of the lines already printed go before the break.
+func (p *printer) linebreak() {
+	for !p.lineStart && p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if !p.trailing[c] || c.Pos.Line > p.lastLine {
+			break
+		}
+		p.print(" ")
+		p.printComment(c, false)
+		p.next++
+	}
+
+	p.out.WriteByte('\n')
+	p.lineStart = true
+}
+
+// blankLine writes an empty line if the previous one is not empty.
+func (p *printer) blankLine() {
+	b := p.out.Bytes()
+	if len(b) == 0 || bytes.HasSuffix(b, []byte("\n\n")) {
+		return
+	}
+	p.out.WriteByte('\n')
+}
+
+// mark records that the code of the line of pos has been printed.
+func (p *printer) mark(pos ast.Position) {
+	if pos.Line > p.lastLine {
+		p.lastLine = pos.Line
+	}
+}
+
+// blankBefore returns true if the line before line is empty in the source.
+func (p *printer) blankBefore(line int) bool {
+	i := line - 2
+	if i < 0 || i >= len(p.lines) {
+		return false
+	}
+	return strings.TrimSpace(p.lines[i]) == ""
+}
+
+// blankBetween returns true if there is an empty line before line
+// after the code already printed.
+func (p *printer) blankBetween(line int) bool {
+	return line-1 > p.lastLine && p.blankBefore(line)
+}
+
+// beginLine writes the comments before pos, each in its own line, and keeps
+// the empty line written in the source before the node that starts at start.
+// If first is true the node is the first one of a block and it doesn't
+// need a separation.
+func (p *printer) beginLine(start, pos ast.Position, first bool) {
+	var after bool
+
+	for p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if !before(c.Pos, pos) {
+			break
+		}
+		if !first && p.blankBetween(startLine(c)) {
+			p.blankLine()
+		}
+		p.printComment(c, true)
+		p.next++
+		p.linebreak()
+		first = false
+		after = after || !before(c.Pos, start)
+	}
+
+	if !first && !after && p.blankBetween(start.Line) {
+		p.blankLine()
+	}
+}
+
+// closeComments writes the comments left before the closing bracket at pos.
+func (p *printer) closeComments(pos ast.Position, first bool) {
+	for p.hasComments(pos) {
+		c := p.comments[p.next]
+		if p.trailing[c] && c.Pos.Line <= p.lastLine && !p.lineStart {
+			p.print(" ")
+			p.printComment(c, false)
+			p.next++
+			continue
+		}
+		p.linebreak()
+		if !first && p.blankBetween(startLine(c)) {
+			p.blankLine()
+		}
+		p.printComment(c, true)
+		p.next++
+		first = false
+	}
+}
+
+// hasComments returns true if there are comments to print before pos.
+func (p *printer) hasComments(pos ast.Position) bool {
+	return pos.Line > 0 && p.next < len(p.comments) && before(p.comments[p.next].Pos, pos)
+}
+
+// printComment writes a comment. The lines of a multiline comment
+// that starts a line are indented as the code.
+func (p *printer) printComment(c *ast.Comment, leading bool) {
+	if !c.MultiLine {
+		p.print("//" + strings.TrimRight(c.Str, " \t"))
+		return
+	}
+
+	lines := strings.Split(c.Str, "\n")
+	p.print("/*" + lines[0])
+
+	var old string
+	if line := startLine(c) - 1; leading && line >= 0 && line < len(p.lines) {
+		s := p.lines[line]
+		old = s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+	}
+	current := strings.Repeat(indentation, p.indent)
+
+	for _, l := range lines[1:] {
+		p.out.WriteByte('\n')
+		if leading && l != "" && strings.HasPrefix(l, old) {
+			l = current + l[len(old):]
+		}
+		p.out.WriteString(l)
+	}
+	p.out.WriteString("*/")
+}
+
+// startLine returns the line where a comment starts.
+func startLine(c *ast.Comment) int {
+	return c.Pos.Line - strings.Count(c.Str, "\n")
+}
+
+func before(a, b ast.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// isMultiLine returns true if the list opened by the bracket at pos
+// has its first element in the next line.
+func (p *printer) isMultiLine(pos ast.Position) bool {
+	i, ok := p.index[pos]
+	if !ok {
+		return false
+	}
+
+	for _, t := range p.tokens[i+1:] {
+		switch t.Type {
+		case ast.COMMENT, ast.MULTILINE_COMMENT:
+			continue
+		}
+		return t.Pos.Line > pos.Line
+	}
+	return false
+}
+
+// closingOf returns the position of the bracket that closes the one at pos.
+func (p *printer) closingOf(pos ast.Position) ast.Position {
+	if i, ok := p.index[pos]; ok {
+		if j, ok := p.closing[i]; ok {
+			return p.tokens[j].Pos
+		}
+	}
+	return ast.Position{}
+}
+
+// tokenAfter returns the position of the first token of type typ after pos.
+func (p *printer) tokenAfter(pos ast.Position, typ ast.Type) ast.Position {
+	if i, ok := p.index[pos]; ok {
+		for _, t := range p.tokens[i+1:] {
+			if t.Type == typ {
+				return t.Pos
+			}
+		}
+	}
+	return ast.Position{}
+}
+
+// sourceChar returns the character of the source at pos.
+func (p *printer) sourceChar(pos ast.Position) byte {
+	i := pos.Line - 1
+	if i < 0 || i >= len(p.lines) {
+		return 0
+	}
+	l := p.lines[i]
+	if pos.Column < 0 || pos.Column >= len(l) {
+		return 0
+	}
+	return l[pos.Column]
+}
+
+// list writes the n elements of a list between open and close. It is
+// written in multiple lines if the first element was in a new line.
+func (p *printer) list(open, close string, pos ast.Position, n int, start func(int) ast.Position, elem func(int)) {
+	p.seq(open, close, ",", pos, n, start, elem)
+}
+
+// seq is like list but sep is the separator of the elements
+// when they are written in multiple lines.
+func (p *printer) seq(open, close, sep string, pos ast.Position, n int, start func(int) ast.Position, elem func(int)) {
+	p.mark(pos)
+	p.print(open)
+
+	if n == 0 {
+		p.print(close)
+		return
+	}
+
+	if !p.isMultiLine(pos) {
+		if open == "{" {
+			p.print(" ")
+		}
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.print(", ")
+			}
+			elem(i)
+		}
+		if open == "{" {
+			p.print(" ")
+		}
+		p.print(close)
+		p.mark(p.closingOf(pos))
+		return
+	}
+
+	p.indent++
+	for i := 0; i < n; i++ {
+		p.linebreak()
+		s := start(i)
+		p.beginLine(s, s, i == 0)
+		elem(i)
+		if i < n-1 {
+			p.print(sep)
+		}
+	}
+	end := p.closingOf(pos)
+	p.closeComments(end, false)
+	p.indent--
+	p.linebreak()
+	p.print(close)
+	p.mark(end)
+}
+
+// item is a top level declaration.
+type item struct {
+	node   ast.Node
+	start  ast.Position
+	global bool // declared in a "declare global" block
+}
+
+func (p *printer) printFile() {
+	f := p.file
+
+	if len(f.Directives) > 0 {
+		for _, t := range p.tokens {
+			if t.Type == ast.DIRECTIVE {
+				p.beginLine(t.Pos, t.Pos, true)
+				break
+			}
+		}
+		for _, d := range f.Directives {
+			p.print("// [" + d + "]")
+			p.linebreak()
+		}
+	}
+
+	items := p.items()
+
+	for i := 0; i < len(items); i++ {
+		it := items[i]
+		if i > 0 {
+			p.linebreak()
+		} else if len(f.Directives) > 0 {
+			// separate the directives of the file from the first declaration
+			p.blankLine()
+		}
+
+		if it.global {
+			j := i
+			for j+1 < len(items) && items[j+1].global {
+				j++
+			}
+			p.declareGlobal(items[i:j+1], i == 0 && len(f.Directives) == 0)
+			i = j
+			continue
+		}
+
+		p.beginLine(it.start, startPos(it.node), i == 0 && len(f.Directives) == 0)
+
+		switch t := it.node.(type) {
+		case *ast.ImportStmt:
+			p.importStmt(t)
+		case ast.Stmt:
+			p.stmt(t)
+			if i < len(items)-1 {
+				p.separate(t, items[i+1].node)
+			}
+		default:
+			p.error(t)
+		}
+	}
+
+	if f.Default != "" && !p.defaultExported {
+		if p.out.Len() > 0 {
+			p.linebreak()
+			p.blankLine()
+		}
+		p.print("export { " + f.Default + " as default }")
+	}
+
+	p.closeComments(ast.Position{Line: int(^uint(0) >> 1)}, p.out.Len() == 0)
+
+	if !p.lineStart {
+		p.linebreak()
+	}
+}
+
+// items returns the top level declarations sorted by position.
+func (p *printer) items() []item {
+	f := p.file
+	var items []item
+
+	add := func(n ast.Node, global bool) {
+		items = append(items, item{node: n, start: p.declStart(n), global: global})
+	}
+
+	for _, s := range f.Imports {
+		add(s, false)
+	}
+	for _, s := range f.TypeImports {
+		add(s, false)
+	}
+	for _, s := range f.Stms {
+		add(s, false)
+	}
+	for _, s := range f.Types {
+		add(s, false)
+	}
+	for _, s := range f.Global {
+		add(s, true)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return before(items[i].start, items[j].start)
+	})
+
+	return items
+}
+
+// declStart returns the position where a top level declaration starts
+// including its directives.
+func (p *printer) declStart(n ast.Node) ast.Position {
+	start := p.labelStart(n)
+
+	var directives int
+	switch t := n.(type) {
+	case *ast.FuncDeclStmt:
+		directives = len(t.Directives)
+	case *ast.ClassDeclStmt:
+		directives = len(t.Directives)
+	}
+
+	i, ok := p.index[start]
+	if !ok || directives == 0 {
+		return start
+	}
+
+	line := start.Line
+	for j := i - 1; j >= 0 && directives > 0; j-- {
+		t := p.tokens[j]
+		switch {
+		case t.Type == ast.DIRECTIVE:
+			start = t.Pos
+			directives--
+		case t.Type == ast.COMMENT || t.Type == ast.MULTILINE_COMMENT || t.Pos.Line == line:
+		default:
+			return start
+		}
+	}
+	return start
+}
+
+// declareGlobal writes a "declare global" block with the declarations.
+func (p *printer) declareGlobal(items []item, first bool) {
+	start := items[0].start
+	if i, ok := p.index[start]; ok {
+		for j := i - 1; j >= 0 && j >= i-4; j-- {
+			if t := p.tokens[j]; t.Str == "declare" {
+				start = t.Pos
+				break
+			}
+		}
+	}
+
+	p.beginLine(start, start, first)
+	p.print("declare global {")
+	p.indent++
+	for i, it := range items {
+		p.linebreak()
+		p.beginLine(it.start, it.start, i == 0)
+		switch t := it.node.(type) {
+		case *ast.VarDeclStmt:
+			p.print("const ")
+			p.binding(t)
+		case ast.Stmt:
+			p.stmt(t)
+		default:
+			p.error(t)
+		}
+	}
+	p.indent--
+	p.linebreak()
+	p.print("}")
+}
+
+func (p *printer) importStmt(t *ast.ImportStmt) {
+	p.mark(t.Pos)
+
+	if t.Export {
+		p.print("export ")
+		if t.All {
+			p.print("* from " + quote(t.Path))
+			return
+		}
+		p.importNames(t)
+		if t.Path != "" {
+			p.print(" from " + quote(t.Path))
+		}
+		return
+	}
+
+	p.print("import ")
+	if t.TypeOnly {
+		p.print("type ")
+	}
+
+	var clause bool
+	if t.Default != "" {
+		p.print(t.Default)
+		clause = true
+	}
+
+	if t.Alias != "" {
+		if clause {
+			p.print(", ")
+		}
+		p.print("* as " + t.Alias)
+		clause = true
+	}
+
+	if len(t.Names) > 0 || len(t.TypeNames) > 0 {
+		if clause {
+			p.print(", ")
+		}
+		p.importNames(t)
+		clause = true
+	}
+
+	if clause {
+		p.print(" from ")
+	}
+	p.print(quote(t.Path))
+}
+
+// importNames writes a list like { a, type B, c as d }
+func (p *printer) importNames(t *ast.ImportStmt) {
+	type name struct {
+		*ast.ImportName
+		typ bool
+	}
+
+	var names []name
+	for _, n := range t.Names {
+		names = append(names, name{n, false})
+	}
+	for _, n := range t.TypeNames {
+		names = append(names, name{n, true})
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return before(names[i].Pos, names[j].Pos)
+	})
+
+	start := func(i int) ast.Position { return names[i].Pos }
+	elem := func(i int) {
+		n := names[i]
+		if n.typ {
+			p.print("type ")
+		}
+		p.print(n.Name)
+		if n.Alias != "" && n.Alias != n.Name {
+			p.print(" as " + n.Alias)
+		}
+	}
+
+	p.list("{", "}", p.tokenAfter(t.Pos, ast.LBRACE), len(names), start, elem)
+}
+
+// startPos returns the position of the first token of a node.
+func startPos(n ast.Node) ast.Position {
+	switch t := n.(type) {
+	case *ast.FuncDeclStmt:
+		if len(t.Decorators) > 0 {
+			return t.Decorators[0].Pos
+		}
+	case *ast.ClassDeclStmt:
+		if len(t.Decorators) > 0 {
+			return t.Decorators[0].Pos
+		}
+	case *ast.AsignStmt:
+		return exprStart(t.Left)
+	case *ast.IncStmt:
+		return exprStart(t.Left)
+	case *ast.CallStmt:
+		return exprStart(t.CallExpr)
+	case *ast.TailCallStmt:
+		return exprStart(t.CallExpr)
+	case ast.Expr:
+		return exprStart(t)
+	}
+	return n.Position()
+}
+
+// labelStart returns the position of the label of a statement, that can
+// be written in the line before it, or the start of the statement.
+func (p *printer) labelStart(n ast.Node) ast.Position {
+	start := startPos(n)
+
+	t, ok := n.(ast.Target)
+	if !ok || t.Label() == "" {
+		return start
+	}
+
+	if i, ok := p.index[start]; ok && i > 1 {
+		if c, l := p.tokens[i-1], p.tokens[i-2]; c.Type == ast.COLON && l.Str == t.Label() {
+			return l.Pos
+		}
+	}
+	return start
+}
+
+// exprStart returns the position of the first token of an expression.
+func exprStart(e ast.Expr) ast.Position {
+	switch t := e.(type) {
+	case *ast.BinaryExpr:
+		return exprStart(t.Left)
+	case *ast.TernaryExpr:
+		return exprStart(t.Condition)
+	case *ast.CallExpr:
+		return exprStart(t.Ident)
+	case *ast.SelectorExpr:
+		return exprStart(t.X)
+	case *ast.IndexExpr:
+		return exprStart(t.Left)
+	case *ast.AsExpr:
+		return exprStart(t.X)
+	case *ast.NewInstanceExpr:
+		return exprStart(t.Name)
+	case *ast.TemplateExpr:
+		if t.Tag != nil {
+			return exprStart(t.Tag)
+		}
+	}
+	return e.Position()
+}
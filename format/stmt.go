@@ -0,0 +1,759 @@
+package format
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+func (p *printer) stmt(s ast.Stmt) {
+	p.mark(startPos(s))
+
+	switch t := s.(type) {
+	case *ast.VarDeclStmt:
+		p.varDecl(t)
+
+	case *ast.FuncDeclStmt:
+		p.funcDecl(t)
+
+	case *ast.ClassDeclStmt:
+		p.classDecl(t)
+
+	case *ast.EnumDeclStmt:
+		p.enumDecl(t)
+
+	case *ast.InterfaceDeclStmt:
+		p.interfaceDecl(t)
+
+	case *ast.TypeAliasStmt:
+		if t.Exported {
+			p.print("export ")
+		}
+		p.print("type " + t.Name)
+		p.typeParams(t.TypeParams)
+		p.print(" = ")
+		p.typ(t.Type, 0)
+
+	case *ast.BlockStmt:
+		p.block(t)
+
+	case *ast.AsignStmt:
+		p.asignStmt(t)
+
+	case *ast.IndexAsignStmt:
+		p.print(t.Name + "[")
+		p.expr(t.IndexExpr, 1)
+		p.print("] = ")
+		p.expr(t.Value, 0)
+
+	case *ast.IncStmt:
+		p.expr(t.Left, 8)
+		if t.Operator == ast.INC {
+			p.print("++")
+		} else {
+			p.print("--")
+		}
+
+	case *ast.CallStmt:
+		p.expr(t.CallExpr, 0)
+
+	case *ast.TailCallStmt:
+		if t.Return {
+			p.print("return ")
+		}
+		p.expr(t.CallExpr, 0)
+
+	case *ast.AwaitStmt:
+		p.expr(t.AwaitExpr, 0)
+
+	case *ast.YieldStmt:
+		p.expr(t.YieldExpr, 0)
+
+	case *ast.ReturnStmt:
+		p.print("return")
+		if t.Value != nil {
+			p.print(" ")
+			p.expr(t.Value, 0)
+		}
+
+	case *ast.ThrowStmt:
+		p.print("throw ")
+		p.expr(t.Value, 0)
+
+	case *ast.BreakStmt:
+		p.print("break")
+		if t.Label != "" {
+			p.print(" " + t.Label)
+		}
+
+	case *ast.ContinueStmt:
+		p.print("continue")
+		if t.Label != "" {
+			p.print(" " + t.Label)
+		}
+
+	case *ast.DeleteStmt:
+		p.print("delete " + t.Object + "." + t.Property)
+
+	case *ast.IfStmt:
+		p.ifStmt(t)
+
+	case *ast.WhileStmt:
+		p.label(t)
+		if t.Do {
+			p.print("do ")
+			p.block(t.Body)
+			p.print(" while (")
+			p.expr(t.Expression, 1)
+			p.print(")")
+			return
+		}
+		p.print("while (")
+		p.expr(t.Expression, 1)
+		p.print(") ")
+		p.block(t.Body)
+
+	case *ast.ForStmt:
+		p.forStmt(t)
+
+	case *ast.SwitchStmt:
+		p.switchStmt(t)
+
+	case *ast.TryStmt:
+		p.print("try ")
+		p.block(t.Body)
+		if t.Catch != nil {
+			p.print(" catch ")
+			if t.CatchIdent != nil {
+				p.print("(" + t.CatchIdent.Name + ") ")
+			}
+			p.block(t.Catch)
+		}
+		if t.Finally != nil {
+			p.print(" finally ")
+			p.block(t.Finally)
+		}
+
+	default:
+		p.error(t)
+	}
+}
+
+// block writes a braced list of statements.
+func (p *printer) block(b *ast.BlockStmt) {
+	p.mark(b.Lbrace)
+	p.print("{")
+	p.stmtList(b.List, b.Rbrace)
+	p.mark(b.Rbrace)
+	p.print("}")
+}
+
+// stmtList writes the statements of a block in their own lines. end is
+// the position of the closing brace.
+func (p *printer) stmtList(list []ast.Stmt, end ast.Position) {
+	if len(list) == 0 && !p.hasComments(end) {
+		return
+	}
+
+	p.indent++
+	for i, s := range list {
+		p.linebreak()
+		start := p.labelStart(s)
+		p.beginLine(start, start, i == 0)
+		p.stmt(s)
+		if i < len(list)-1 {
+			p.separate(s, list[i+1])
+		}
+	}
+	p.closeComments(end, len(list) == 0)
+	p.indent--
+	p.linebreak()
+}
+
+// separate writes a semicolon after s if the next statement starts with
+// a paren or a bracket that would continue its expression: a = b; [c, d] = e
+func (p *printer) separate(s ast.Stmt, next ast.Node) {
+	var start bool
+	switch t := next.(type) {
+	case *ast.AsignStmt:
+		_, start = t.Left.(*ast.PatternExpr)
+		start = start || startsWithParen(t.Left)
+	case *ast.CallStmt:
+		start = startsWithParen(t.CallExpr)
+	case *ast.IncStmt:
+		start = startsWithParen(t.Left)
+	}
+
+	if !start {
+		return
+	}
+
+	switch t := s.(type) {
+	case *ast.VarDeclStmt, *ast.AsignStmt, *ast.IndexAsignStmt, *ast.CallStmt,
+		*ast.TailCallStmt, *ast.IncStmt, *ast.AwaitStmt, *ast.YieldStmt, *ast.ThrowStmt:
+		p.print(";")
+	case *ast.ReturnStmt:
+		if t.Value != nil {
+			p.print(";")
+		}
+	}
+}
+
+func (p *printer) label(t ast.Target) {
+	if l := t.Label(); l != "" {
+		p.print(l + ": ")
+	}
+}
+
+func (p *printer) varDecl(t *ast.VarDeclStmt) {
+	if t.Exported {
+		if t.Name == "default" && p.file.Default == "default" {
+			p.defaultExported = true
+			p.print("export default ")
+			p.expr(t.Value, 0)
+			return
+		}
+		p.print("export ")
+	}
+
+	p.print(p.keyword(t))
+	p.binding(t)
+}
+
+// keyword returns the keyword of a declaration as it was written. The
+// parser doesn't distinguish var from let so it is read from the source.
+func (p *printer) keyword(t *ast.VarDeclStmt) string {
+	if t.Const {
+		return "const "
+	}
+	if i, ok := p.index[t.Pos]; ok && i > 0 && p.tokens[i-1].Type == ast.VAR {
+		return "var "
+	}
+	return "let "
+}
+
+// binding writes the name or pattern of a declaration with its type and value.
+func (p *printer) binding(t *ast.VarDeclStmt) {
+	if t.Pattern != nil {
+		p.pattern(t.Pattern)
+	} else {
+		p.print(t.Name)
+	}
+
+	if t.Type != nil {
+		p.print(": ")
+		p.typ(t.Type, 0)
+	}
+
+	if t.Value != nil && !isImplicit(t) {
+		p.print(" = ")
+		p.expr(t.Value, 0)
+	}
+}
+
+// isImplicit returns true if the value of the declaration is the
+// undefined that the parser sets for declarations without value.
+func isImplicit(t *ast.VarDeclStmt) bool {
+	c, ok := t.Value.(*ast.ConstantExpr)
+	return ok && c.Kind == ast.UNDEFINED && c.Pos == t.Pos
+}
+
+// compound are the operators of the assignments like a += b
+var compound = map[ast.Type]string{
+	ast.ADD:  "+=",
+	ast.SUB:  "-=",
+	ast.MUL:  "*=",
+	ast.DIV:  "/=",
+	ast.BOR:  "|=",
+	ast.XOR:  "^=",
+	ast.MOD:  "%=",
+	ast.LAND: "&&=",
+	ast.LOR:  "||=",
+	ast.NOR:  "??=",
+}
+
+func (p *printer) asignStmt(t *ast.AsignStmt) {
+	if pattern, ok := t.Left.(*ast.PatternExpr); ok {
+		// object patterns must be enclosed in parens: ({ a, b } = obj)
+		if pattern.IsObject {
+			p.print("(")
+		}
+		p.pattern(pattern)
+		p.print(" = ")
+		p.expr(t.Value, 0)
+		if pattern.IsObject {
+			p.print(")")
+		}
+		return
+	}
+
+	// the parser converts a += b to a = a + b with the same node
+	if b, ok := t.Value.(*ast.BinaryExpr); ok && b.Left == t.Left {
+		if op, ok := compound[b.Operator]; ok {
+			p.expr(t.Left, 8)
+			p.print(" " + op + " ")
+			p.expr(b.Right, 1)
+			return
+		}
+	}
+
+	p.expr(t.Left, 8)
+	p.print(" = ")
+	p.expr(t.Value, 0)
+}
+
+func (p *printer) ifStmt(t *ast.IfStmt) {
+	for i, b := range t.IfBlocks {
+		if i > 0 {
+			p.print(" else ")
+		}
+		p.print("if (")
+		p.expr(b.Condition, 1)
+		p.print(") ")
+		p.block(b.Body)
+	}
+
+	if t.Else != nil {
+		p.print(" else ")
+		p.block(t.Else)
+	}
+}
+
+func (p *printer) forStmt(t *ast.ForStmt) {
+	p.label(t)
+	p.print("for (")
+
+	if t.InExpression != nil || t.OfExpression != nil {
+		if d, ok := t.Declaration[0].(*ast.VarDeclStmt); ok {
+			p.print(p.keyword(d))
+			p.binding(d)
+		} else {
+			p.error(t.Declaration[0])
+		}
+
+		if t.OfExpression != nil {
+			p.print(" of ")
+			p.expr(t.OfExpression, 1)
+		} else {
+			p.print(" in ")
+			p.expr(t.InExpression, 1)
+		}
+	} else {
+		for i, s := range t.Declaration {
+			d, ok := s.(*ast.VarDeclStmt)
+			if !ok {
+				p.stmt(s)
+				continue
+			}
+			if i == 0 {
+				p.print(p.keyword(d))
+			} else {
+				p.print(", ")
+			}
+			p.binding(d)
+		}
+
+		p.print(";")
+		if t.Expression != nil {
+			p.print(" ")
+			p.expr(t.Expression, 1)
+		}
+
+		p.print(";")
+		if t.Step != nil {
+			p.print(" ")
+			p.stmt(t.Step)
+		}
+	}
+
+	p.print(") ")
+	p.block(t.Body)
+}
+
+func (p *printer) switchStmt(t *ast.SwitchStmt) {
+	p.label(t)
+	p.print("switch (")
+	p.expr(t.Expression, 1)
+	p.print(") {")
+
+	blocks := append([]*ast.CaseBlock{}, t.Blocks...)
+	if t.Default != nil {
+		blocks = append(blocks, t.Default)
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return before(blocks[i].Pos, blocks[j].Pos)
+	})
+
+	end := p.closingOf(p.tokenAfter(p.closingOf(p.tokenAfter(t.Pos, ast.LPAREN)), ast.LBRACE))
+
+	if len(blocks) == 0 && !p.hasComments(end) {
+		p.print("}")
+		return
+	}
+
+	p.indent++
+	for i, b := range blocks {
+		p.linebreak()
+		p.beginLine(b.Pos, b.Pos, i == 0)
+		p.mark(b.Pos)
+
+		if b == t.Default {
+			p.print("default:")
+		} else {
+			p.print("case ")
+			p.expr(b.Expression, 1)
+			p.print(":")
+		}
+
+		stmts := b.Stmts
+
+		// keep in the same line a statement written after the case: case 1: {
+		if len(stmts) > 0 && startPos(stmts[0]).Line == b.Pos.Line {
+			p.print(" ")
+			p.stmt(stmts[0])
+			if len(stmts) > 1 {
+				p.separate(stmts[0], stmts[1])
+			}
+			stmts = stmts[1:]
+		}
+
+		p.indent++
+		for j, s := range stmts {
+			p.linebreak()
+			start := p.labelStart(s)
+			p.beginLine(start, start, j == 0 && len(stmts) == len(b.Stmts))
+			p.stmt(s)
+			if j < len(stmts)-1 {
+				p.separate(s, stmts[j+1])
+			}
+		}
+		p.indent--
+	}
+	p.closeComments(end, false)
+	p.indent--
+	p.linebreak()
+	p.print("}")
+}
+
+// prefix writes the directives and decorators of a declaration
+// and its export modifiers.
+func (p *printer) prefix(name string, exported bool, directives []string, decorators []*ast.Decorator) {
+	for _, d := range directives {
+		p.print("// [" + d + "]")
+		p.linebreak()
+	}
+
+	// the directives of the first declaration of a file are moved from the
+	// file only if they are just above it so decorators must be inline.
+	inline := len(directives) > 0 && len(p.file.Directives) == 0 && len(p.file.Imports) == 0 &&
+		len(p.file.Stms) > 0 && p.file.Stms[0] == p.current
+
+	for _, d := range decorators {
+		p.mark(d.Pos)
+		p.print("@" + d.Name)
+		if len(d.Args) > 0 {
+			p.print("(")
+			for i, a := range d.Args {
+				if i > 0 {
+					p.print(", ")
+				}
+				p.expr(a, 1)
+			}
+			p.print(")")
+		}
+		if inline {
+			p.print(" ")
+		} else {
+			p.linebreak()
+		}
+	}
+
+	if exported {
+		if name != "" && name == p.file.Default {
+			p.defaultExported = true
+			p.print("export default ")
+		} else {
+			p.print("export ")
+		}
+	}
+}
+
+func (p *printer) funcDecl(t *ast.FuncDeclStmt) {
+	p.current = t
+
+	if t.ReceiverType != "" {
+		p.mark(t.Pos)
+		p.print(t.ReceiverType + ".prototype." + t.Name + " = function")
+		p.typeParams(t.TypeParams)
+		p.funcSignature(t.Args, t.Variadic, t.Result)
+		p.print(" ")
+		p.block(t.Body)
+		return
+	}
+
+	p.prefix(t.Name, t.Exported, t.Directives, t.Decorators)
+	p.mark(t.Pos)
+
+	if t.Async {
+		p.print("async ")
+	}
+	p.print("function")
+	if t.Generator {
+		p.print("*")
+	}
+	p.print(" " + t.Name)
+	p.typeParams(t.TypeParams)
+	p.funcSignature(t.Args, t.Variadic, t.Result)
+	p.print(" ")
+	p.block(t.Body)
+}
+
+// funcSignature writes the parameters and the result type of a function.
+func (p *printer) funcSignature(args *ast.Arguments, variadic bool, result ast.TypeExpr) {
+	var list []*ast.Field
+	var pos ast.Position
+	if args != nil {
+		list = args.List
+		pos = args.Opening
+	}
+
+	p.params(list, variadic, pos)
+
+	if result != nil {
+		p.print(": ")
+		p.typ(result, 0)
+	}
+}
+
+// params writes a list of parameters.
+func (p *printer) params(list []*ast.Field, variadic bool, pos ast.Position) {
+	start := func(i int) ast.Position { return list[i].Pos }
+	elem := func(i int) {
+		f := list[i]
+		if variadic && i == len(list)-1 {
+			p.print("...")
+		}
+
+		if f.Pattern != nil {
+			p.pattern(f.Pattern)
+		} else {
+			p.print(f.Name)
+		}
+
+		if f.Optional && f.Default == nil {
+			p.print("?")
+		}
+
+		if f.Type != nil {
+			p.print(": ")
+			p.typ(f.Type, 0)
+		}
+
+		if f.Default != nil {
+			p.print(" = ")
+			p.expr(f.Default, 0)
+		}
+	}
+
+	p.list("(", ")", pos, len(list), start, elem)
+}
+
+func (p *printer) classDecl(t *ast.ClassDeclStmt) {
+	p.current = t
+	p.prefix(t.Name, t.Exported, t.Directives, t.Decorators)
+	p.mark(t.Pos)
+
+	p.print("class " + t.Name)
+	p.typeParams(t.TypeParams)
+
+	if t.Extends != nil {
+		p.print(" extends ")
+		p.expr(t.Extends, 8)
+	}
+
+	if len(t.Implements) > 0 {
+		p.print(" implements ")
+		for i, r := range t.Implements {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.typ(r, 0)
+		}
+	}
+
+	p.print(" {")
+
+	var members []ast.Stmt
+	for _, f := range t.Fields {
+		members = append(members, f)
+	}
+	for _, f := range t.Functions {
+		members = append(members, f)
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return before(startPos(members[i]), startPos(members[j]))
+	})
+
+	end := p.closingOf(p.tokenAfter(t.Pos, ast.LBRACE))
+
+	if len(members) == 0 && !p.hasComments(end) {
+		p.print("}")
+		return
+	}
+
+	p.indent++
+	for i, m := range members {
+		p.linebreak()
+		start := startPos(m)
+		p.beginLine(start, start, i == 0)
+
+		switch m := m.(type) {
+		case *ast.VarDeclStmt:
+			p.mark(m.Pos)
+			p.modifiers(m.Exported, m.Static)
+			if m.Readonly {
+				p.print("readonly ")
+			}
+			p.binding(m)
+
+			// the value would be multiplied by a generator method: a = 1; *values() {}
+			if i < len(members)-1 && !isImplicit(m) {
+				if f, ok := members[i+1].(*ast.FuncDeclStmt); ok && f.Generator && !f.Static && f.Exported {
+					p.print(";")
+				}
+			}
+
+		case *ast.FuncDeclStmt:
+			p.method(m)
+		}
+	}
+	p.closeComments(end, len(members) == 0)
+	p.indent--
+	p.linebreak()
+	p.print("}")
+}
+
+func (p *printer) modifiers(exported, static bool) {
+	if !exported {
+		p.print("private ")
+	}
+	if static {
+		p.print("static ")
+	}
+}
+
+func (p *printer) method(t *ast.FuncDeclStmt) {
+	for _, d := range t.Decorators {
+		p.mark(d.Pos)
+		p.print("@" + d.Name)
+		if len(d.Args) > 0 {
+			p.print("(")
+			for i, a := range d.Args {
+				if i > 0 {
+					p.print(", ")
+				}
+				p.expr(a, 1)
+			}
+			p.print(")")
+		}
+		p.linebreak()
+	}
+
+	p.mark(t.Pos)
+	p.modifiers(t.Exported, t.Static)
+
+	if t.Async {
+		p.print("async ")
+	}
+	if t.Getter {
+		p.print("get ")
+	}
+	if t.Setter {
+		p.print("set ")
+	}
+	if t.Generator {
+		p.print("*")
+	}
+
+	p.print(t.Name)
+	p.typeParams(t.TypeParams)
+	p.funcSignature(t.Args, t.Variadic, t.Result)
+	p.print(" ")
+	p.block(t.Body)
+}
+
+func (p *printer) enumDecl(t *ast.EnumDeclStmt) {
+	if t.Exported {
+		p.print("export ")
+	}
+	p.mark(t.Pos)
+	p.print("enum " + t.Name + " {")
+
+	end := p.closingOf(p.tokenAfter(t.Pos, ast.LBRACE))
+
+	if len(t.Values) == 0 && !p.hasComments(end) {
+		p.print("}")
+		return
+	}
+
+	// the values without initializer are the next number
+	next := 0
+
+	p.indent++
+	for i, v := range t.Values {
+		p.linebreak()
+		p.beginLine(v.Pos, v.Pos, i == 0)
+		p.mark(v.Pos)
+		p.print(v.Name)
+
+		if v.Value != nil {
+			switch {
+			case v.Kind == ast.STRING:
+				p.print(" = " + quote(v.Value.Value))
+			case v.Value.Value != strconv.Itoa(next):
+				p.print(" = " + v.Value.Value)
+			}
+
+			if i == 0 && v.Kind == ast.INT {
+				next, _ = strconv.Atoi(v.Value.Value)
+			}
+		}
+		next++
+
+		if i < len(t.Values)-1 {
+			p.print(",")
+		}
+	}
+	p.closeComments(end, len(t.Values) == 0)
+	p.indent--
+	p.linebreak()
+	p.print("}")
+}
+
+func (p *printer) interfaceDecl(t *ast.InterfaceDeclStmt) {
+	if t.Exported {
+		p.print("export ")
+	}
+	p.mark(t.Pos)
+
+	if t.Class {
+		p.print("declare class " + t.Name)
+	} else {
+		p.print("interface " + t.Name)
+	}
+	p.typeParams(t.TypeParams)
+
+	if len(t.Extends) > 0 {
+		p.print(" extends ")
+		for i, r := range t.Extends {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.typ(r, 0)
+		}
+	}
+
+	p.print(" ")
+	p.objectType(t.Body)
+}
@@ -0,0 +1,217 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// typePrecedence returns the binding power of a type.
+func typePrecedence(t ast.TypeExpr) int {
+	switch t.(type) {
+	case *ast.FuncType:
+		return 0
+	case *ast.UnionType:
+		return 1
+	case *ast.IntersectionType:
+		return 2
+	}
+	return 3
+}
+
+// typ writes a type that must have at least the precedence min.
+func (p *printer) typ(t ast.TypeExpr, min int) {
+	if typePrecedence(t) < min {
+		p.print("(")
+		p.typ(t, 0)
+		p.print(")")
+		return
+	}
+
+	p.mark(t.Position())
+
+	switch t := t.(type) {
+	case *ast.TypeRef:
+		if t.Syntax != "" {
+			p.print(t.Syntax)
+			return
+		}
+		p.print(t.Name)
+		p.typeArgs(t.Args)
+
+	case *ast.LiteralType:
+		if t.Kind == ast.STRING {
+			p.print(quote(t.Value))
+		} else {
+			p.print(t.Value)
+		}
+
+	case *ast.ArrayType:
+		p.typ(t.Elem, 3)
+		p.print("[]")
+
+	case *ast.TupleType:
+		p.print("[")
+		for i, e := range t.Elems {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.typ(e, 0)
+		}
+		p.print("]")
+
+	case *ast.UnionType:
+		for i, e := range t.Types {
+			if i > 0 {
+				p.print(" | ")
+			}
+			p.typ(e, 2)
+		}
+
+	case *ast.IntersectionType:
+		for i, e := range t.Types {
+			if i > 0 {
+				p.print(" & ")
+			}
+			p.typ(e, 3)
+		}
+
+	case *ast.FuncType:
+		if t.New {
+			p.print("new ")
+		}
+		p.typeParams(t.TypeParams)
+		p.params(t.Params, t.Variadic, ast.Position{})
+		p.print(" => ")
+		p.typ(t.Result, 0)
+
+	case *ast.ObjectType:
+		p.objectType(t)
+
+	default:
+		p.error(t)
+	}
+}
+
+// typeParams writes the parameters of a generic declaration: <T extends Foo = Bar>
+func (p *printer) typeParams(params []*ast.TypeParam) {
+	if len(params) == 0 {
+		return
+	}
+
+	p.print("<")
+	for i, t := range params {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(t.Name)
+		if t.Constraint != nil {
+			p.print(" extends ")
+			p.typ(t.Constraint, 0)
+		}
+		if t.Default != nil {
+			p.print(" = ")
+			p.typ(t.Default, 0)
+		}
+	}
+	p.print(">")
+}
+
+// objectType writes the body of an interface or an object literal type.
+// The members written in multiple lines have no separator.
+func (p *printer) objectType(t *ast.ObjectType) {
+	start := func(i int) ast.Position { return t.Members[i].Pos }
+	elem := func(i int) {
+		p.typeMember(t.Members[i])
+
+		// a bracket or a paren in the next line would continue the type: a: T[]; [k: string]: T
+		if i < len(t.Members)-1 && p.isMultiLine(t.Pos) {
+			if n := t.Members[i+1]; n.KeyType != nil || n.Method && n.Name == "" {
+				p.print(";")
+			}
+		}
+	}
+	p.seq("{", "}", "", t.Pos, len(t.Members), start, elem)
+}
+
+func (p *printer) typeMember(m *ast.TypeMember) {
+	p.mark(m.Pos)
+
+	if m.Static {
+		p.print("static ")
+	}
+	if m.Readonly {
+		p.print("readonly ")
+	}
+
+	if m.KeyType != nil {
+		// an index signature or a mapped type: [key: string]: T or [K in keyof T]: V
+		if r, ok := m.KeyType.(*ast.TypeRef); ok && strings.HasPrefix(r.Syntax, m.Name+" in ") {
+			p.print("[" + r.Syntax + "]")
+		} else {
+			p.print("[" + m.Name + ": ")
+			p.typ(m.KeyType, 0)
+			p.print("]")
+		}
+		if m.Type != nil {
+			p.print(": ")
+			p.typ(m.Type, 0)
+		}
+		return
+	}
+
+	if m.Method {
+		switch m.Name {
+		case "":
+			// a call signature: (v: any): string
+		case "new":
+			p.print("new ")
+		default:
+			p.print(memberName(m.Name))
+			if m.Optional {
+				p.print("?")
+			}
+		}
+
+		f, ok := m.Type.(*ast.FuncType)
+		if !ok {
+			p.error(m.Type)
+			return
+		}
+		p.typeParams(f.TypeParams)
+		p.params(f.Params, f.Variadic, ast.Position{})
+		if f.Result != nil {
+			p.print(": ")
+			p.typ(f.Result, 0)
+		}
+		return
+	}
+
+	p.print(memberName(m.Name))
+	if m.Optional {
+		p.print("?")
+	}
+	if m.Type != nil {
+		p.print(": ")
+		p.typ(m.Type, 0)
+	}
+}
+
+// memberName quotes the names of members that are not valid identifiers.
+// Keywords and numbers are valid names: { default: string, 0: number }
+func memberName(s string) string {
+	if isIdent(s) || keywords[s] {
+		return s
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return quote(s)
+		}
+	}
+
+	if s == "" {
+		return quote(s)
+	}
+	return s
+}
@@ -0,0 +1,244 @@
+package dune
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Generator is the object returned by a generator function. It keeps the
+// frame of the function between calls to next so it resumes where it yielded.
+type Generator struct {
+	mu        sync.Mutex
+	frame     *stackFrame
+	tryCatchs []*tryCatch
+	sent      Address // where to store the value passed to next
+	yielded   bool
+	running   bool
+	done      bool
+	returning bool // resumed by return() to run the pending finally blocks
+}
+
+func (vm *VM) newGenerator(f *Function, closures []*closureRegister, isMethod bool, this Value, args []Value) *Generator {
+	frame := &stackFrame{
+		funcIndex:   f.Index,
+		maxRegIndex: f.MaxRegIndex,
+		values:      make([]Value, f.MaxRegIndex),
+		closures:    closures,
+	}
+
+	setArgs(f, frame.values, args, isMethod, this)
+
+	g := &Generator{frame: frame, sent: Void}
+	frame.generator = g
+	return g
+}
+
+func (g *Generator) Type() string {
+	return "Generator"
+}
+
+func (g *Generator) Size() int {
+	return 1
+}
+
+func (g *Generator) GetMethod(name string) NativeMethod {
+	switch name {
+	case "next":
+		return g.next
+	case "return":
+		return g.stop
+	}
+	return nil
+}
+
+func (g *Generator) next(args []Value, vm *VM) (Value, error) {
+	var sent Value
+	switch len(args) {
+	case 0:
+		sent = UndefinedValue
+	case 1:
+		sent = args[0]
+	default:
+		return NullValue, fmt.Errorf("expected 0 or 1 arguments, got %d", len(args))
+	}
+
+	v, ok, err := g.Resume(sent, vm)
+	if err != nil {
+		return NullValue, err
+	}
+
+	return iteratorResult(v, !ok), nil
+}
+
+func (g *Generator) stop(args []Value, vm *VM) (Value, error) {
+	v := UndefinedValue
+	switch len(args) {
+	case 0:
+	case 1:
+		v = args[0]
+	default:
+		return NullValue, fmt.Errorf("expected 0 or 1 arguments, got %d", len(args))
+	}
+
+	r, ok, err := g.Return(vm)
+	if err != nil {
+		return NullValue, err
+	}
+
+	if ok {
+		// a finally block has yielded
+		return iteratorResult(r, false), nil
+	}
+
+	return iteratorResult(v, true), nil
+}
+
+// Return finishes the generator running the finally blocks that are
+// pending where it is suspended. ok is true if one of them yields.
+func (g *Generator) Return(vm *VM) (v Value, ok bool, err error) {
+	g.mu.Lock()
+	if g.running {
+		g.mu.Unlock()
+		return NullValue, false, fmt.Errorf("the generator is already running")
+	}
+
+	// if it has not started there is nothing to clean up
+	if !g.done && g.frame.pc == 0 {
+		g.finish()
+	}
+
+	g.returning = !g.done
+	g.mu.Unlock()
+
+	return g.Resume(UndefinedValue, vm)
+}
+
+// Resume runs the generator until it yields a value or returns.
+// sent is the result of the yield expression where it was suspended.
+// ok is false when the generator has finished.
+func (g *Generator) Resume(sent Value, vm *VM) (v Value, ok bool, err error) {
+	g.mu.Lock()
+	if g.running {
+		g.mu.Unlock()
+		return NullValue, false, fmt.Errorf("the generator is already running")
+	}
+	if g.done {
+		g.mu.Unlock()
+		return UndefinedValue, false, nil
+	}
+	g.running = true
+	g.mu.Unlock()
+
+	v, err = vm.resume(g, sent)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running = false
+
+	if err != nil {
+		g.finish()
+		return NullValue, false, err
+	}
+
+	if !g.yielded {
+		// the function has returned
+		g.finish()
+		return v, false, nil
+	}
+
+	return v, true, nil
+}
+
+func (g *Generator) finish() {
+	g.done = true
+	g.frame = nil
+	g.tryCatchs = nil
+}
+
+// resume pushes the frame of the generator and runs it
+// until it yields or returns.
+func (vm *VM) resume(g *Generator, sent Value) (Value, error) {
+	currentFp := vm.fp
+	currentTryCatchs := vm.tryCatchs
+
+	// the generator returns to the native call
+	vm.callStack[vm.fp].retAddress = Void
+
+	frame := g.frame
+	frame.exit = true
+
+	vm.fp++
+	vm.callStack = append(vm.callStack[:vm.fp], frame)
+
+	// the frame can be in a different position each time it is resumed
+	for _, try := range g.tryCatchs {
+		try.fp = vm.fp
+	}
+	vm.tryCatchs = g.tryCatchs
+
+	if g.returning {
+		g.returning = false
+		vm.returnFromGenerator()
+	} else if g.sent != Void {
+		vm.set(g.sent, sent)
+	}
+
+	g.yielded = false
+	vm.run(false)
+
+	// restore
+	vm.tryCatchs = currentTryCatchs
+	vm.fp = currentFp
+
+	err := vm.Error
+	vm.Error = nil
+
+	if err != nil && err != io.EOF {
+		return NullValue, err
+	}
+
+	return vm.RetValue, nil
+}
+
+// generatorReturn is the return pc of the finally blocks that
+// run when a generator is finished by return().
+const generatorReturn = -2
+
+// returnFromGenerator jumps to the innermost finally block of the
+// current frame that has not started. When it ends it is called again
+// for the next one and at the end it jumps to the last instruction of
+// the function, that is always a return.
+func (vm *VM) returnFromGenerator() {
+	frame := vm.callStack[vm.fp]
+
+	for l := len(vm.tryCatchs); l > 0; l-- {
+		try := vm.tryCatchs[l-1]
+		if try.fp != vm.fp {
+			break
+		}
+
+		// discard it if there is no finally or it is already running. When
+		// it is resumed the pc can be the start of the finally if the yield
+		// is the last instruction of the try block.
+		if try.finallyPC == -1 || frame.pc > try.finallyPC {
+			vm.tryCatchs = vm.tryCatchs[:l-1]
+			continue
+		}
+
+		try.retPC = generatorReturn
+		try.finallyExecuted = true
+		vm.setPC(try.finallyPC)
+		return
+	}
+
+	f := vm.Program.Functions[frame.funcIndex]
+	vm.setPC(len(f.Instructions) - 1)
+}
+
+func iteratorResult(v Value, done bool) Value {
+	m := make(map[Value]Value, 2)
+	m[NewString("value")] = v
+	m[NewString("done")] = NewBool(done)
+	return NewMapValues(m)
+}
@@ -0,0 +1,224 @@
+package dune
+
+// inlineCache remembers how a property was resolved the last time that an
+// instruction was executed. If the next receiver has the same class or type
+// the lookup of methods, accessors and prototypes is skipped.
+//
+// The caches are kept by the vm for each instruction so they don't need locks.
+// The access checks only depend on the class of the receiver and on the function
+// that is being executed, which is always the same for an instruction.
+type inlineCache struct {
+	class *Class // the class of the receiver if it is an instance
+	vType Type   // the type of the receiver if it is a prototype
+	kind  cacheKind
+	fn    int // the index of the method, accessor or native function
+}
+
+type cacheKind byte
+
+const (
+	cacheNone      cacheKind = iota
+	cacheMethod              // a method of the class
+	cacheGetter              // a get accessor
+	cacheSetter              // a set accessor
+	cacheField               // a field that can be accessed from the instruction
+	cacheUndefined           // a property with only a set accessor
+	cacheNative              // a native prototype: Array.prototype.push
+	cacheProgram             // a prototype declared in the program
+)
+
+// inlineCache returns the cache of the current instruction.
+func (vm *VM) inlineCache() *inlineCache {
+	p := vm.Program
+	if vm.cacheProgram != p {
+		vm.caches = make([][]inlineCache, len(p.Functions))
+		vm.cacheProgram = p
+	}
+
+	frame := vm.callStack[vm.fp]
+	caches := vm.caches[frame.funcIndex]
+	if caches == nil {
+		caches = make([]inlineCache, len(p.Functions[frame.funcIndex].Instructions))
+		vm.caches[frame.funcIndex] = caches
+	}
+
+	return &caches[frame.pc]
+}
+
+// getCached reads a property of an instance or a prototype using the cache of
+// the instruction. It returns false if the value is not handled by the cache.
+func (vm *VM) getCached(instr *Instruction, v Value, key string) (bool, error) {
+	switch v.Type {
+	case Object:
+		i, ok := v.ToObject().(*instance)
+		if !ok {
+			return false, nil
+		}
+
+		c := vm.inlineCache()
+		if c.class != i.class && !c.resolveGet(i, key, vm) {
+			return false, nil
+		}
+
+		switch c.kind {
+		case cacheMethod:
+			vm.set(instr.A, NewObject(method{fn: c.fn, this: v}))
+		case cacheGetter:
+			r, err := vm.runMethod(vm.Program.Functions[c.fn], v)
+			if err != nil {
+				return true, vm.WrapError(err)
+			}
+			vm.set(instr.A, r)
+		case cacheField:
+			i.RLock()
+			r := i.iMap[key]
+			i.RUnlock()
+			vm.set(instr.A, r)
+		case cacheUndefined:
+			vm.set(instr.A, UndefinedValue)
+		}
+		return true, nil
+
+	case Array, String, Bytes:
+		c := vm.inlineCache()
+		if (c.class != nil || c.vType != v.Type || c.kind == cacheNone) && !c.resolvePrototype(v.Type, key, vm) {
+			return false, nil
+		}
+
+		switch c.kind {
+		case cacheNative:
+			vm.set(instr.A, NewObject(nativePrototype{this: v, fn: c.fn}))
+		case cacheProgram:
+			vm.set(instr.A, NewObject(method{fn: c.fn, this: v}))
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// setCached sets a property of an instance using the cache of
+// the instruction. It returns false if the value is not handled.
+func (vm *VM) setCached(av Value, key string, v Value) (bool, error) {
+	i, ok := av.ToObject().(*instance)
+	if !ok {
+		return false, nil
+	}
+
+	c := vm.inlineCache()
+	if c.class != i.class && !c.resolveSet(i, key, vm) {
+		return false, nil
+	}
+
+	switch c.kind {
+	case cacheSetter:
+		if _, err := vm.runMethod(vm.Program.Functions[c.fn], av, v); err != nil {
+			return true, vm.WrapError(err)
+		}
+	case cacheField:
+		i.Lock()
+		i.iMap[key] = v
+		i.Unlock()
+	}
+	return true, nil
+}
+
+// resolveGet looks for the member in the same order as instance.GetProperty.
+// Members that can't be accessed are not cached so they produce the error.
+func (c *inlineCache) resolveGet(i *instance, key string, vm *VM) bool {
+	p := vm.Program
+
+	if f, ok := i.Function(key, p); ok {
+		if !i.canAccessMethod(f, vm) {
+			return false
+		}
+		return c.setMember(i.class, cacheMethod, f.Index)
+	}
+
+	if f, ok := p.ClassGetter(i.class, key); ok {
+		if !i.canAccessMethod(f, vm) {
+			return false
+		}
+		return c.setMember(i.class, cacheGetter, f.Index)
+	}
+
+	if _, ok := p.ClassSetter(i.class, key); ok {
+		return c.setMember(i.class, cacheUndefined, 0)
+	}
+
+	if !i.canAccessField(key, vm) {
+		return false
+	}
+	return c.setMember(i.class, cacheField, 0)
+}
+
+// resolveSet looks for the member in the same order as instance.SetProperty.
+func (c *inlineCache) resolveSet(i *instance, key string, vm *VM) bool {
+	p := vm.Program
+
+	if f, ok := p.ClassSetter(i.class, key); ok {
+		if !i.canAccessMethod(f, vm) {
+			return false
+		}
+		return c.setMember(i.class, cacheSetter, f.Index)
+	}
+
+	if _, ok := p.ClassGetter(i.class, key); ok {
+		return false
+	}
+
+	if !i.canAccessField(key, vm) {
+		return false
+	}
+
+	if f, cl := i.field(key, p); f != nil && f.Readonly && !i.isConstructorPC(cl, vm) {
+		return false
+	}
+
+	return c.setMember(i.class, cacheField, 0)
+}
+
+// resolvePrototype looks for a native or program prototype of the type.
+// The properties like length are not prototypes and are not cached.
+func (c *inlineCache) resolvePrototype(t Type, key string, vm *VM) bool {
+	var prefixes []string
+	switch t {
+	case Array:
+		if key == "length" {
+			return false
+		}
+		prefixes = []string{"Array.prototype."}
+	case String:
+		if key == "length" || key == "runeCount" {
+			return false
+		}
+		prefixes = []string{"String.prototype."}
+	case Bytes:
+		if key == "length" {
+			return false
+		}
+		prefixes = []string{"Bytes.prototype.", "Array.prototype."}
+	}
+
+	for _, prefix := range prefixes {
+		name := prefix + key
+		if f, ok := allNativeMap[name]; ok {
+			return c.setPrototype(t, cacheNative, f.Index)
+		}
+		if f, ok := vm.Program.Function(name); ok {
+			return c.setPrototype(t, cacheProgram, f.Index)
+		}
+	}
+
+	return false
+}
+
+func (c *inlineCache) setMember(class *Class, kind cacheKind, fn int) bool {
+	*c = inlineCache{class: class, kind: kind, fn: fn}
+	return true
+}
+
+func (c *inlineCache) setPrototype(t Type, kind cacheKind, fn int) bool {
+	*c = inlineCache{vType: t, kind: kind, fn: fn}
+	return true
+}
@@ -5,12 +5,12 @@ import (
 	"sync"
 )
 
-func newInstance(a *Address, vm *VM) *instance {
-	if a.Kind != AddrClass {
+func newInstance(a Address, vm *VM) *instance {
+	if a.Kind() != AddrClass {
 		panic(fmt.Sprintf("Invalid class address: %v", a))
 	}
 
-	class := vm.Program.Classes[a.Value]
+	class := vm.Program.Classes[a.Value()]
 
 	return &instance{
 		iMap:  make(map[string]Value),
@@ -29,44 +29,109 @@ func (i *instance) String() string {
 }
 
 func (i *instance) Function(name string, p *Program) (*Function, bool) {
-	for _, i := range i.class.Functions {
-		f := p.Functions[i]
-		if f.Name == name {
-			return f, true
-		}
+	return p.ClassFunction(i.class, name)
+}
+
+// returns the class of the code that is being executed or nil.
+func (i *instance) pcClass(vm *VM) *Class {
+	frame := vm.callStack[vm.fp]
+	f := vm.Program.Functions[frame.funcIndex]
+	if !f.IsClass {
+		return nil
 	}
-	return nil, false
+	return vm.Program.Classes[f.Class]
 }
 
-// returns true if the pc is class code
+// returns true if the pc is code of the class or of its base classes
 func (i *instance) isSelfPC(vm *VM) bool {
+	pc := i.pcClass(vm)
+	if pc == nil {
+		return false
+	}
+	for cl := i.class; cl != nil; cl = vm.Program.BaseClass(cl) {
+		if cl == pc {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the declaration of a field and the class that declares it.
+func (i *instance) field(name string, p *Program) (*Field, *Class) {
+	for cl := i.class; cl != nil; cl = p.BaseClass(cl) {
+		for _, f := range cl.Fields {
+			if f.Name == name && !f.Static {
+				return f, cl
+			}
+		}
+	}
+	return nil, nil
+}
+
+// returns true if the class declares a field, method or accessor with the name.
+func (i *instance) hasMember(name string, p *Program) bool {
+	if f, _ := i.field(name, p); f != nil {
+		return true
+	}
+	if _, ok := p.ClassFunction(i.class, name); ok {
+		return true
+	}
+	if _, ok := p.ClassGetter(i.class, name); ok {
+		return true
+	}
+	return false
+}
+
+// returns true if the field can be accessed from the current pc. Private fields
+// can only be accessed by the class that declares them.
+func (i *instance) canAccessField(name string, vm *VM) bool {
+	f, cl := i.field(name, vm.Program)
+	if f == nil {
+		// fields not declared can only be used from the class code
+		return i.isSelfPC(vm)
+	}
+	return f.Exported || i.pcClass(vm) == cl
+}
+
+// returns true if the method can be called from the current pc.
+func (i *instance) canAccessMethod(f *Function, vm *VM) bool {
+	return f.Exported || i.pcClass(vm) == vm.Program.Classes[f.Class]
+}
+
+// returns true if the pc is the constructor of the class.
+func (i *instance) isConstructorPC(cl *Class, vm *VM) bool {
 	frame := vm.callStack[vm.fp]
 	f := vm.Program.Functions[frame.funcIndex]
-	return f.IsClass && i.class == vm.Program.Classes[f.Class]
+	return f.IsClass && f.Name == "constructor" && vm.Program.Classes[f.Class] == cl
 }
 
 func (i *instance) GetProperty(name string, vm *VM) (Value, error) {
+	p := vm.Program
+
 	// first look for a method
-	f, ok := i.Function(name, vm.Program)
-	if ok {
-		if !f.Exported && !i.isSelfPC(vm) {
+	if f, ok := i.Function(name, p); ok {
+		if !i.canAccessMethod(f, vm) {
 			return NullValue, vm.NewError("Attempted to access a private method: %s", name)
 		}
 		m := method{fn: f.Index, this: NewObject(i)}
 		return NewObject(m), nil
 	}
 
-	if !i.isSelfPC(vm) {
-		var ok bool
-		for _, f := range i.class.Fields {
-			if f.Name == name {
-				ok = f.Exported
-				break
-			}
-		}
-		if !ok {
-			return NullValue, vm.NewError("Attempted to access a private field: %s", name)
+	// then for a get accessor
+	if f, ok := p.ClassGetter(i.class, name); ok {
+		if !i.canAccessMethod(f, vm) {
+			return NullValue, vm.NewError("Attempted to access a private property: %s", name)
 		}
+		return vm.runMethod(f, NewObject(i))
+	}
+
+	// a property with only a set accessor
+	if _, ok := p.ClassSetter(i.class, name); ok {
+		return UndefinedValue, nil
+	}
+
+	if !i.canAccessField(name, vm) {
+		return NullValue, vm.NewError("Attempted to access a private field: %s", name)
 	}
 
 	// then look for a property
@@ -78,17 +143,27 @@ func (i *instance) GetProperty(name string, vm *VM) (Value, error) {
 }
 
 func (i *instance) SetProperty(name string, v Value, vm *VM) error {
-	if !i.isSelfPC(vm) {
-		var ok bool
-		for _, f := range i.class.Fields {
-			if f.Name == name {
-				ok = f.Exported
-				break
-			}
-		}
-		if !ok {
-			return vm.NewError("Attempted to access a private field: %s", name)
+	p := vm.Program
+
+	if f, ok := p.ClassSetter(i.class, name); ok {
+		if !i.canAccessMethod(f, vm) {
+			return vm.NewError("Attempted to access a private property: %s", name)
 		}
+		_, err := vm.runMethod(f, NewObject(i), v)
+		return err
+	}
+
+	if _, ok := p.ClassGetter(i.class, name); ok {
+		return vm.NewError("Cannot set a property that only has a get accessor: %s", name)
+	}
+
+	if !i.canAccessField(name, vm) {
+		return vm.NewError("Attempted to access a private field: %s", name)
+	}
+
+	// readonly fields can only be set in the constructor
+	if f, cl := i.field(name, p); f != nil && f.Readonly && !i.isConstructorPC(cl, vm) {
+		return vm.NewError("Cannot assign to a readonly field: %s", name)
 	}
 
 	i.Lock()
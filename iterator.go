@@ -0,0 +1,244 @@
+package dune
+
+import (
+	"fmt"
+)
+
+// Iterator is implemented by native objects that for...of can consume
+// lazily, one value at a time. ok is false when there are no more values.
+type Iterator interface {
+	Next() (v Value, ok bool, err error)
+}
+
+// iterator is the state of a for...of loop.
+type iterator interface {
+	next(vm *VM) (Value, bool, error)
+}
+
+// iteratorCloser is implemented by the iterators that must be notified
+// when a for...of loop is exited with a break before they are consumed.
+type iteratorCloser interface {
+	close(vm *VM) error
+}
+
+// newIterator returns an iterator over the values of v. Plain objects
+// are iterated by their values even if they have a next property. Only
+// generators, native iterators and class instances with a next() method
+// follow the iterator protocol.
+func (vm *VM) newIterator(v Value) (iterator, error) {
+	switch v.Type {
+	case Null, Undefined:
+		// allow to iterate if not initialized
+		return &valuesIterator{}, nil
+
+	case Array:
+		// copy the values so modifications inside the loop don't affect the iteration
+		s := v.ToArray()
+		values := make([]Value, len(s))
+		copy(values, s)
+		return &valuesIterator{values: values}, nil
+
+	case Bytes:
+		s := v.ToBytes()
+		values := make([]Value, len(s))
+		for i, b := range s {
+			values[i] = NewInt(int(b))
+		}
+		return &valuesIterator{values: values}, nil
+
+	case String:
+		s := v.ToString()
+		values := make([]Value, 0, len(s))
+		for _, r := range s {
+			values = append(values, NewString(string(r)))
+		}
+		return &valuesIterator{values: values}, nil
+
+	case Map:
+		m := v.ToMap()
+		m.RLock()
+		values := make([]Value, 0, len(m.Map))
+		for _, v := range m.Map {
+			values = append(values, v)
+		}
+		m.RUnlock()
+		return &valuesIterator{values: values}, nil
+
+	case Object:
+		switch t := v.ToObject().(type) {
+		case *Generator:
+			return &generatorIterator{g: t}, nil
+
+		case Iterator:
+			return &nativeIterator{it: t}, nil
+
+		case Enumerable:
+			values, err := t.Values()
+			if err != nil {
+				return nil, fmt.Errorf("Enumerable error: %v", err)
+			}
+			return &valuesIterator{values: values}, nil
+
+		case IterableByIndex:
+			return &indexIterator{col: t}, nil
+
+		case IterableByKey:
+			return &keyIterator{col: t, keys: t.Keys()}, nil
+		}
+	}
+
+	// any object with a next() method
+	if next, ok := vm.iteratorMethod(v); ok {
+		return &protocolIterator{nextFn: next}, nil
+	}
+
+	return nil, fmt.Errorf("Expected a enumerable, got %v", v.String())
+}
+
+// iteratorMethod returns the next method of v.
+func (vm *VM) iteratorMethod(v Value) (Value, bool) {
+	if v.Type != Object {
+		return NullValue, false
+	}
+
+	switch t := v.ToObject().(type) {
+	case Callable:
+		if m := t.GetMethod("next"); m != nil {
+			return NewObject(m), true
+		}
+	case PropertyGetter:
+		if next, err := t.GetProperty("next", vm); err == nil && isFunc(next) {
+			return next, true
+		}
+	}
+
+	return NullValue, false
+}
+
+func isFunc(v Value) bool {
+	switch v.Type {
+	case Func:
+		return true
+	case Object:
+		switch v.ToObject().(type) {
+		case *Closure, method, NativeMethod:
+			return true
+		}
+	}
+	return false
+}
+
+type valuesIterator struct {
+	values []Value
+	i      int
+}
+
+func (t *valuesIterator) next(vm *VM) (Value, bool, error) {
+	if t.i >= len(t.values) {
+		return NullValue, false, nil
+	}
+	v := t.values[t.i]
+	t.i++
+	return v, true, nil
+}
+
+type indexIterator struct {
+	col IterableByIndex
+	i   int
+}
+
+func (t *indexIterator) next(vm *VM) (Value, bool, error) {
+	if t.i >= t.col.Len() {
+		return NullValue, false, nil
+	}
+	v, err := t.col.GetIndex(t.i)
+	if err != nil {
+		return NullValue, false, err
+	}
+	t.i++
+	return v, true, nil
+}
+
+type keyIterator struct {
+	col  IterableByKey
+	keys []string
+	i    int
+}
+
+func (t *keyIterator) next(vm *VM) (Value, bool, error) {
+	if t.i >= len(t.keys) {
+		return NullValue, false, nil
+	}
+	v, err := t.col.GetKey(t.keys[t.i])
+	if err != nil {
+		return NullValue, false, err
+	}
+	t.i++
+	return v, true, nil
+}
+
+type nativeIterator struct {
+	it Iterator
+}
+
+func (t *nativeIterator) next(vm *VM) (Value, bool, error) {
+	return t.it.Next()
+}
+
+type generatorIterator struct {
+	g *Generator
+}
+
+func (t *generatorIterator) next(vm *VM) (Value, bool, error) {
+	return t.g.Resume(UndefinedValue, vm)
+}
+
+func (t *generatorIterator) close(vm *VM) error {
+	_, _, err := t.g.Return(vm)
+	return err
+}
+
+// protocolIterator calls the next method of an object that
+// returns results like { value: any, done: boolean }.
+type protocolIterator struct {
+	nextFn Value
+}
+
+func (t *protocolIterator) next(vm *VM) (Value, bool, error) {
+	r, err := vm.callValue(t.nextFn)
+	if err != nil {
+		return NullValue, false, err
+	}
+
+	var done, value Value
+
+	switch r.Type {
+	case Map:
+		m := r.ToMap()
+		m.RLock()
+		done = m.Map[NewString("done")]
+		value = m.Map[NewString("value")]
+		m.RUnlock()
+
+	case Object:
+		g, ok := r.ToObject().(PropertyGetter)
+		if !ok {
+			return NullValue, false, fmt.Errorf("Invalid iterator result: %v", r.TypeName())
+		}
+		if done, err = g.GetProperty("done", vm); err != nil {
+			return NullValue, false, err
+		}
+		if value, err = g.GetProperty("value", vm); err != nil {
+			return NullValue, false, err
+		}
+
+	default:
+		return NullValue, false, fmt.Errorf("Invalid iterator result: %v", r.TypeName())
+	}
+
+	if done.Type == Bool && done.ToBool() {
+		return NullValue, false, nil
+	}
+
+	return value, true, nil
+}
@@ -29,3 +29,20 @@ func TestArrayWhere(t *testing.T) {
 		t.Fatal(v)
 	}
 }
+
+func TestArrayPrototypeCache(t *testing.T) {
+	v := runTest(t, `
+		function find(v, x) {
+			return v.indexOf(x)
+		}
+
+		function main() {
+			let s = [find([1], 1), find([2, 1, 3], 1), find("a1", "1"), find("b", "1")]
+			return s.join(",")
+		}
+	`)
+
+	if v.ToString() != "0,1,1,-1" {
+		t.Fatal(v)
+	}
+}
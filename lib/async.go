@@ -2,6 +2,7 @@ package lib
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/scorredoira/dune"
 )
@@ -11,6 +12,19 @@ func init() {
 	
 declare function go(f: Function): void
 
+declare class Promise<T> {
+    constructor(executor: (resolve: (value?: T | Promise<T>) => void, reject: (reason?: any) => void) => void)
+
+    then<R>(onfulfilled?: (value: T) => R | Promise<R>, onrejected?: (reason: any) => any): Promise<R>
+    catch(onrejected?: (reason: any) => any): Promise<any>
+    finally(onfinally?: () => void): Promise<T>
+
+    static all<T>(values: (T | Promise<T>)[]): Promise<T[]>
+    static race<T>(values: (T | Promise<T>)[]): Promise<T>
+    static resolve<T>(value?: T | Promise<T>): Promise<T>
+    static reject<T = never>(reason?: any): Promise<T>
+}
+
 
 	`)
 }
@@ -27,10 +41,163 @@ var Async = []dune.NativeFunction{
 			return launchGoroutine(args, vm, nil)
 		},
 	},
+	{
+		Name:      "Promise",
+		Arguments: 1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			p := dune.NewPromise()
+
+			resolve := dune.NativeMethod(func(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+				if len(args) > 0 {
+					p.Resolve(args[0])
+				} else {
+					p.Resolve(dune.UndefinedValue)
+				}
+				return dune.NullValue, nil
+			})
+
+			reject := dune.NativeMethod(func(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+				if len(args) > 0 {
+					p.Reject(rejectReason(args[0], vm))
+				} else {
+					p.Reject(vm.NewError("rejected"))
+				}
+				return dune.NullValue, nil
+			})
+
+			// the executor runs synchronously like in javascript
+			if err := runFuncOrClosure(vm, args[0], dune.NewObject(resolve), dune.NewObject(reject)); err != nil {
+				p.Reject(err)
+			}
+
+			return dune.NewObject(p), nil
+		},
+	},
+	{
+		Name:      "Promise.resolve",
+		Arguments: -1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if len(args) > 1 {
+				return dune.NullValue, fmt.Errorf("expected 0 or 1 arguments, got %d", len(args))
+			}
+
+			if len(args) == 1 {
+				// a promise is returned as it is
+				if _, ok := args[0].ToObjectOrNil().(*dune.Promise); ok {
+					return args[0], nil
+				}
+			}
+
+			p := dune.NewPromise()
+			if len(args) == 1 {
+				p.Resolve(args[0])
+			} else {
+				p.Resolve(dune.UndefinedValue)
+			}
+			return dune.NewObject(p), nil
+		},
+	},
+	{
+		Name:      "Promise.reject",
+		Arguments: -1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if len(args) > 1 {
+				return dune.NullValue, fmt.Errorf("expected 0 or 1 arguments, got %d", len(args))
+			}
+
+			p := dune.NewPromise()
+			if len(args) == 1 {
+				p.Reject(rejectReason(args[0], vm))
+			} else {
+				p.Reject(vm.NewError("rejected"))
+			}
+			return dune.NewObject(p), nil
+		},
+	},
+	{
+		Name:      "Promise.all",
+		Arguments: 1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if args[0].Type != dune.Array {
+				return dune.NullValue, fmt.Errorf("expected an array, got %s", args[0].TypeName())
+			}
+
+			values := args[0].ToArray()
+			results := make([]dune.Value, len(values))
+			p := dune.NewPromise()
+
+			var wg sync.WaitGroup
+
+			for i, v := range values {
+				vp, ok := v.ToObjectOrNil().(*dune.Promise)
+				if !ok {
+					results[i] = v
+					continue
+				}
+
+				wg.Add(1)
+				go func(i int, vp *dune.Promise) {
+					defer wg.Done()
+					v, err := vp.Await()
+					if err != nil {
+						// the first error rejects the whole promise
+						p.Reject(err)
+						return
+					}
+					results[i] = v
+				}(i, vp)
+			}
+
+			go func() {
+				wg.Wait()
+				p.Resolve(dune.NewArrayValues(results))
+			}()
+
+			return dune.NewObject(p), nil
+		},
+	},
+	{
+		Name:      "Promise.race",
+		Arguments: 1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if args[0].Type != dune.Array {
+				return dune.NullValue, fmt.Errorf("expected an array, got %s", args[0].TypeName())
+			}
+
+			p := dune.NewPromise()
+
+			for _, v := range args[0].ToArray() {
+				vp, ok := v.ToObjectOrNil().(*dune.Promise)
+				if !ok {
+					p.Resolve(v)
+					break
+				}
+
+				go func(vp *dune.Promise) {
+					v, err := vp.Await()
+					if err != nil {
+						p.Reject(err)
+						return
+					}
+					p.Resolve(v)
+				}(vp)
+			}
+
+			return dune.NewObject(p), nil
+		},
+	},
+}
+
+// rejectReason converts the value passed to reject to an error.
+func rejectReason(v dune.Value, vm *dune.VM) error {
+	if e, ok := v.ToObjectOrNil().(dune.Error); ok {
+		return e
+	}
+	return vm.NewError(v.String())
 }
 
 func launchGoroutine(args []dune.Value, vm *dune.VM, t *waitGroup) (dune.Value, error) {
-	m, err := cloneForAsync(vm)
+	m, err := vm.CloneForAsync()
 	if err != nil {
 		return dune.NullValue, err
 	}
@@ -85,7 +252,7 @@ func launchGoroutine(args []dune.Value, vm *dune.VM, t *waitGroup) (dune.Value,
 }
 
 func runAsyncFuncOrClosure(vm *dune.VM, fn dune.Value, args ...dune.Value) error {
-	m, err := cloneForAsync(vm)
+	m, err := vm.CloneForAsync()
 	if err != nil {
 		return err
 	}
@@ -107,25 +274,3 @@ func runAsyncFuncOrClosure(vm *dune.VM, fn dune.Value, args ...dune.Value) error
 		return fmt.Errorf("expected a function, got: %s", fn.TypeName())
 	}
 }
-
-func cloneForAsync(vm *dune.VM) (*dune.VM, error) {
-	m := dune.NewInitializedVM(vm.Program, vm.Globals())
-	m.MaxAllocations = vm.MaxAllocations
-	m.MaxFrames = vm.MaxFrames
-	m.MaxSteps = vm.MaxSteps
-	m.FileSystem = vm.FileSystem
-	m.Context = vm.Context
-	m.Language = vm.Language
-	m.Localizer = vm.Localizer
-	m.Location = vm.Location
-	m.Now = vm.Now
-	m.Stdin = vm.Stdin
-	m.Stdout = vm.Stdout
-	m.Stderr = vm.Stderr
-
-	if err := m.AddSteps(vm.Steps()); err != nil {
-		return nil, err
-	}
-
-	return m, nil
-}
@@ -2,6 +2,7 @@ package lib
 
 import (
 	"testing"
+	"time"
 
 	"github.com/scorredoira/dune"
 )
@@ -38,3 +39,94 @@ func TestAsyncClosure(t *testing.T) {
 		t.Fatalf("Returned: %v", v)
 	}
 }
+
+func TestPromise(t *testing.T) {
+	v := runTest(t, `
+		async function main() {
+			let p = new Promise((resolve, reject) => resolve(3))
+			return await p.then(v => v * 2)
+		}
+	`)
+
+	if v != dune.NewValue(6) {
+		t.Fatalf("Returned: %v", v)
+	}
+}
+
+func TestPromiseReject(t *testing.T) {
+	v := runTest(t, `
+		async function main() {
+			let p = new Promise((resolve, reject) => reject("boom"))
+			return await p.catch(e => e.message + "!")
+		}
+	`)
+
+	if v != dune.NewValue("boom!") {
+		t.Fatalf("Returned: %v", v)
+	}
+}
+
+func TestPromiseAll(t *testing.T) {
+	v := runTest(t, `
+		async function double(a) {
+			return a * 2
+		}
+
+		async function main() {
+			let values = await Promise.all([double(1), double(2), 10])
+			return values[0] + values[1] + values[2]
+		}
+	`)
+
+	if v != dune.NewValue(16) {
+		t.Fatalf("Returned: %v", v)
+	}
+}
+
+func TestPromiseRace(t *testing.T) {
+	v := runTest(t, `
+		async function slow() {
+			time.sleep(200 * time.Millisecond)
+			return "slow"
+		}
+
+		async function fast() {
+			return "fast"
+		}
+
+		async function main() {
+			return await Promise.race([slow(), fast()])
+		}
+	`)
+
+	if v != dune.NewValue("fast") {
+		t.Fatalf("Returned: %v", v)
+	}
+}
+
+func TestAwaitConcurrent(t *testing.T) {
+	start := time.Now()
+
+	v := runTest(t, `
+		async function work(n) {
+			time.sleep(50 * time.Millisecond)
+			return n
+		}
+
+		async function main() {
+			let a = work(1)
+			let b = work(2)
+			let c = work(3)
+			return await a + await b + await c
+		}
+	`)
+
+	if v != dune.NewValue(6) {
+		t.Fatalf("Returned: %v", v)
+	}
+
+	// each task blocks only itself so they must sleep at the same time
+	if d := time.Since(start); d > 140*time.Millisecond {
+		t.Fatalf("Expected the tasks to run concurrently, took %v", d)
+	}
+}
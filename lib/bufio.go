@@ -24,7 +24,7 @@ declare namespace bufio {
         flush(): void
     }
 
-    export interface Scanner {
+    export interface Scanner extends Iterable<string> {
         scan(): boolean 
         text(): string
     }
@@ -315,6 +315,14 @@ func (s *scanner) GetMethod(name string) dune.NativeMethod {
 	return nil
 }
 
+// Next allows to iterate the scanner lines with for...of
+func (s *scanner) Next() (dune.Value, bool, error) {
+	if !s.s.Scan() {
+		return dune.NullValue, false, s.s.Err()
+	}
+	return dune.NewString(s.s.Text()), true, nil
+}
+
 func (s *scanner) text(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 	if err := ValidateArgs(args); err != nil {
 		return dune.NullValue, err
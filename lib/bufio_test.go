@@ -0,0 +1,28 @@
+package lib
+
+import "testing"
+
+func TestScannerForOf(t *testing.T) {
+	v := runTest(t, `
+		function* nonEmpty(lines) {
+			for (let line of lines) {
+				if (line != "") {
+					yield line
+				}
+			}
+		}
+
+		function main() {
+			let s = bufio.newScanner(strings.newReader("a\n\nb\nc"))
+			let result = ""
+			for (let line of nonEmpty(s)) {
+				result += line
+			}
+			return result
+		}
+	`)
+
+	if v.ToString() != "abc" {
+		t.Fatal(v)
+	}
+}
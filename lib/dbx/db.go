@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -67,6 +68,9 @@ type queryable interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 func (db *DB) queryable() queryable {
@@ -145,12 +149,17 @@ func (db *DB) ToSql(q sqx.Query) (string, []interface{}, error) {
 }
 
 func (db *DB) ExecRaw(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecRawContext(context.Background(), query, args...)
+}
+
+// ExecRawContext executes the query and cancels it when the context is done.
+func (db *DB) ExecRawContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	if db.ReadOnly {
 		return nil, ErrReadOnly
 	}
 
 	q := db.queryable()
-	r, err := q.Exec(query, args...)
+	r, err := q.ExecContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -158,7 +167,12 @@ func (db *DB) ExecRaw(query string, args ...interface{}) (sql.Result, error) {
 }
 
 func (db *DB) QueryRaw(query string, args ...interface{}) (*sql.Rows, error) {
-	r, err := db.queryable().Query(query, args...)
+	return db.QueryRawContext(context.Background(), query, args...)
+}
+
+// QueryRawContext executes the query and cancels it when the context is done.
+func (db *DB) QueryRawContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	r, err := db.queryable().QueryContext(ctx, query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -169,7 +183,12 @@ func (db *DB) QueryRaw(query string, args ...interface{}) (*sql.Rows, error) {
 }
 
 func (db *DB) QueryRowRaw(query string, args ...interface{}) *sql.Row {
-	return db.queryable().QueryRow(query, args...)
+	return db.QueryRowRawContext(context.Background(), query, args...)
+}
+
+// QueryRowRawContext executes the query and cancels it when the context is done.
+func (db *DB) QueryRowRawContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.queryable().QueryRowContext(ctx, query, args...)
 }
 
 func (db *DB) ScanValueRaw(v interface{}, query string, args ...interface{}) error {
@@ -316,7 +335,12 @@ func (db *DB) Reader(query string, args ...interface{}) (*Reader, error) {
 }
 
 func (db *DB) ReaderRaw(query string, args ...interface{}) (*Reader, error) {
-	rows, err := db.QueryRaw(query, args...)
+	return db.ReaderRawContext(context.Background(), query, args...)
+}
+
+// ReaderRawContext executes the query and cancels it when the context is done.
+func (db *DB) ReaderRawContext(ctx context.Context, query string, args ...interface{}) (*Reader, error) {
+	rows, err := db.QueryRawContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -422,7 +446,12 @@ func (db *DB) QueryValue(query string, args ...interface{}) (interface{}, error)
 }
 
 func (db *DB) QueryValueRaw(query string, args ...interface{}) (interface{}, error) {
-	rows, err := db.QueryRaw(query, args...)
+	return db.QueryValueRawContext(context.Background(), query, args...)
+}
+
+// QueryValueRawContext executes the query and cancels it when the context is done.
+func (db *DB) QueryValueRawContext(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	rows, err := db.QueryRawContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -539,7 +539,13 @@ var HTTP = []dune.NativeFunction{
 			}
 
 			client.Timeout = timeout
-			resp, err := client.Get(url)
+
+			r, err := http.NewRequestWithContext(vm.GoContext(), "GET", url, nil)
+			if err != nil {
+				return dune.NullValue, err
+			}
+
+			resp, err := client.Do(r)
 			if err != nil {
 				return dune.NullValue, err
 			}
@@ -580,7 +586,13 @@ var HTTP = []dune.NativeFunction{
 			}
 			m.RUnlock()
 
-			resp, err := http.PostForm(u, data)
+			r, err := http.NewRequestWithContext(vm.GoContext(), "POST", u, strings.NewReader(data.Encode()))
+			if err != nil {
+				return dune.NullValue, err
+			}
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			resp, err := http.DefaultClient.Do(r)
 			if err != nil {
 				return dune.NullValue, err
 			}
@@ -606,7 +618,12 @@ var HTTP = []dune.NativeFunction{
 			}
 			url := args[0].ToString()
 
-			resp, err := http.Get(url)
+			r, err := http.NewRequestWithContext(vm.GoContext(), "GET", url, nil)
+			if err != nil {
+				return dune.NullValue, err
+			}
+
+			resp, err := http.DefaultClient.Do(r)
 			if err != nil {
 				return dune.NullValue, err
 			}
@@ -1527,7 +1544,7 @@ func (r *request) execute(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		client.Transport = getTransport(tlsc.conf)
 	}
 
-	resp, err := client.Do(r.request)
+	resp, err := client.Do(r.request.WithContext(vm.GoContext()))
 	if err != nil {
 		return dune.NullValue, err
 	}
@@ -1564,7 +1581,7 @@ func (r *request) executeString(args []dune.Value, vm *dune.VM) (dune.Value, err
 		client.Transport = getTransport(tlsc.conf)
 	}
 
-	resp, err := client.Do(r.request)
+	resp, err := client.Do(r.request.WithContext(vm.GoContext()))
 	if err != nil {
 		return dune.NullValue, err
 	}
@@ -1613,7 +1630,7 @@ func (r *request) executeJSON(args []dune.Value, vm *dune.VM) (dune.Value, error
 		client.Transport = getTransport(tlsc.conf)
 	}
 
-	resp, err := client.Do(r.request)
+	resp, err := client.Do(r.request.WithContext(vm.GoContext()))
 	if err != nil {
 		return dune.NullValue, err
 	}
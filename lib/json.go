@@ -15,6 +15,11 @@ declare namespace json {
     export function escapeString(str: string): string
     export function marshal(v: any, indent?: boolean): string
     export function unmarshal(str: string | byte[]): any
+    /**
+     * Unmarshals and validates the value against an interface
+     * or type alias. It throws if it doesn't match.
+     */
+    export function unmarshal<T>(str: string | byte[], type: string): T
 
 }
 `)
@@ -61,10 +66,10 @@ var JSON = []dune.NativeFunction{
 	},
 	{
 		Name:      "json.unmarshal",
-		Arguments: 1,
+		Arguments: -1,
 		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
-			if len(args) != 1 {
-				return dune.NullValue, fmt.Errorf("expected 1 argument, got %d", len(args))
+			if err := ValidateArgRange(args, 1, 2); err != nil {
+				return dune.NullValue, err
 			}
 
 			a := args[0]
@@ -84,6 +89,15 @@ var JSON = []dune.NativeFunction{
 				return dune.NullValue, err
 			}
 
+			if len(args) == 2 {
+				if args[1].Type != dune.String {
+					return dune.NullValue, fmt.Errorf("expected argument 2 to be a string, got %s", args[1].TypeName())
+				}
+				if err := validateShape(v, args[1].ToString(), vm); err != nil {
+					return dune.NullValue, err
+				}
+			}
+
 			return v, nil
 		},
 	},
@@ -180,7 +180,7 @@ var libMap = []dune.NativeFunction{
 			case dune.Map:
 				m := a.ToMap()
 				m.RLock()
-				_, ok := m.Map[b]
+				_, ok := m.Map[b.Key()]
 				m.RUnlock()
 				return dune.NewBool(ok), nil
 
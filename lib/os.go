@@ -219,7 +219,7 @@ var OS = []dune.NativeFunction{
 				values[i] = v.ToString()
 			}
 
-			cmd := exec.Command(values[0], values[1:]...)
+			cmd := exec.CommandContext(vm.GoContext(), values[0], values[1:]...)
 			cmd.Stderr = os.Stderr
 			cmd.Stdout = os.Stdout
 
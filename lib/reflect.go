@@ -2,6 +2,7 @@ package lib
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/scorredoira/dune"
 )
@@ -23,6 +24,26 @@ declare namespace reflect {
 
     export function getFunction(name: string): Function
 
+    /**
+     * Returns the decorators of a function or of the class of an instance.
+     */
+    export function decorators(v: any): runtime.Decorator[]
+
+    /**
+     * Validates a value against an interface or a type alias. It checks
+     * the required properties, primitive types, arrays and unions and
+     * returns the errors found or an empty array if the value is valid.
+     */
+    export function validate(v: any, type: string): ValidationError[]
+
+    export interface ValidationError {
+        /**
+         * The location of the invalid value: address.lines[1]
+         */
+        path: string
+        message: string
+    }
+
     export function call(name: string, ...params: any[]): any
 
     export function runFunc(name: string, ...params: any[]): any
@@ -121,6 +142,41 @@ var Reflect = []dune.NativeFunction{
 			return v, nil
 		},
 	},
+	{
+		Name:      "reflect.decorators",
+		Arguments: 1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			list := vm.Program.Decorators(args[0])
+			result := make([]dune.Value, len(list))
+			for i, d := range list {
+				result[i] = d.ToValue()
+			}
+			return dune.NewArrayValues(result), nil
+		},
+	},
+	{
+		Name:      "reflect.validate",
+		Arguments: 2,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if args[1].Type != dune.String {
+				return dune.NullValue, fmt.Errorf("expected argument 2 to be a string, got %s", args[1].TypeName())
+			}
+
+			errors, err := vm.Program.Validate(args[0], args[1].ToString())
+			if err != nil {
+				return dune.NullValue, err
+			}
+
+			result := make([]dune.Value, len(errors))
+			for i, e := range errors {
+				result[i] = dune.NewMapValues(map[dune.Value]dune.Value{
+					dune.NewString("path"):    dune.NewString(e.Path),
+					dune.NewString("message"): dune.NewString(e.Message),
+				})
+			}
+			return dune.NewArrayValues(result), nil
+		},
+	},
 	{
 		Name:      "reflect.runFunc",
 		Arguments: -1,
@@ -145,3 +201,22 @@ var Reflect = []dune.NativeFunction{
 		},
 	},
 }
+
+// validateShape returns an error with all the errors found
+// validating the value against the type.
+func validateShape(v dune.Value, name string, vm *dune.VM) error {
+	errors, err := vm.Program.Validate(v, name)
+	if err != nil {
+		return err
+	}
+
+	if len(errors) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(errors))
+	for i, e := range errors {
+		msgs[i] = e.Error()
+	}
+	return fmt.Errorf("invalid %s: %s", name, strings.Join(msgs, "; "))
+}
@@ -1,9 +1,97 @@
 package lib
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestGenericIsType(t *testing.T) {
 	assertRegister(t, "x", true, `
 		let x = reflect.is(3, "int");
 	`)
 }
+
+func TestReflectDecorators(t *testing.T) {
+	v := runTest(t, `
+		@entity("users")
+		class User { }
+
+		@handler
+		function foo() { }
+
+		function main() {
+			let a = reflect.decorators(new User())
+			let b = reflect.decorators(foo)
+			let c = reflect.decorators(() => 1)
+			return a[0].name + a[0].args[0] + b[0].name + b[0].args.length + c.length
+		}
+	`)
+
+	if v.String() != "entityusershandler00" {
+		t.Fatal(v)
+	}
+}
+
+func TestReflectValidate(t *testing.T) {
+	v := runTest(t, `
+		type Role = "admin" | "user"
+
+		interface Address {
+			street: string
+			zip: number
+		}
+
+		interface Entity {
+			id: number
+		}
+
+		interface User extends Entity {
+			name: string
+			email?: string
+			roles: Role[]
+			address: Address | null
+			tags: Record<string, boolean>
+		}
+
+		function main() {
+			let u = {
+				id: "1",
+				roles: ["admin", "guest"],
+				address: { street: "a", zip: "b" },
+				tags: { a: true, b: 1 }
+			}
+
+			let errors = reflect.validate(u, "User")
+			let valid = reflect.validate({ id: 1, name: "a", roles: [], address: null, tags: {} }, "User")
+			return errors.select(e => e.path + ": " + e.message).join("\n") + "\n" + valid.length
+		}
+	`)
+
+	expected := `id: expected number, got string
+name: required property is missing
+roles[1]: expected Role, got "guest"
+address.zip: expected number, got string
+tags.b: expected boolean, got number
+0`
+
+	if v.String() != expected {
+		t.Fatal(v)
+	}
+}
+
+func TestJSONUnmarshalType(t *testing.T) {
+	_, err := runExpr(t, `
+		interface Point {
+			x: number
+			y: number
+		}
+
+		function main() {
+			json.unmarshal('{"x": 1, "y": true}', "Point")
+		}
+	`)
+
+	if err == nil || !strings.Contains(err.Error(), "invalid Point: y: expected number, got boolean") {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"fmt"
 	"regexp"
 
 	"github.com/scorredoira/dune"
@@ -18,10 +19,108 @@ declare namespace regex {
     export function replaceAllString(pattern: string, source: string, replace: string): string
 }
 
+/**
+ * A regular expression. The syntax is defined: https://golang.org/pkg/regexp/syntax
+ * Literals like /a+/i are compiled only once.
+ */
+declare class RegExp {
+    constructor(pattern: string | RegExp, flags?: string)
+    readonly source: string
+    readonly flags: string
+    readonly global: boolean
+    readonly ignoreCase: boolean
+    readonly multiline: boolean
+    test(s: string): boolean
+    exec(s: string): RegExpMatch | null
+}
+
+/**
+ * The matched string followed by the groups.
+ */
+interface RegExpMatch {
+    [n: number]: string
+    length: number
+    index: number
+    input: string
+    groups?: { [name: string]: string }
+}
+
+interface String {
+    /**
+     * Returns the first match or all the matched strings if the expression is global.
+     */
+    match(regex: RegExp): RegExpMatch | string[] | null
+    matchAll(regex: RegExp): RegExpMatch[]
+
+    /**
+     * Replaces the first match or all of them if the expression is global.
+     * The replacement can use $1, $<name>, $& or be a function.
+     */
+    replace(regex: RegExp, replacement: string | ((match: string, ...args: any[]) => string)): string
+}
+
 `)
 }
 
 var Regex = []dune.NativeFunction{
+	{
+		Name:      "RegExp",
+		Arguments: -1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if err := ValidateArgRange(args, 1, 2); err != nil {
+				return dune.NullValue, err
+			}
+
+			var pattern string
+			var flags string
+
+			switch t := args[0].ToObjectOrNil().(type) {
+			case *dune.RegExp:
+				pattern = t.Source
+				flags = t.Flags
+			default:
+				if args[0].Type != dune.String {
+					return dune.NullValue, fmt.Errorf("expected a string or RegExp, got %s", args[0].TypeName())
+				}
+				pattern = args[0].ToString()
+			}
+
+			if len(args) == 2 {
+				if args[1].Type != dune.String {
+					return dune.NullValue, fmt.Errorf("expected flags to be a string, got %s", args[1].TypeName())
+				}
+				flags = args[1].ToString()
+			}
+
+			r, err := dune.NewRegExp(pattern, flags)
+			if err != nil {
+				return dune.NullValue, err
+			}
+			return dune.NewObject(r), nil
+		},
+	},
+	{
+		Name:      "String.prototype.match",
+		Arguments: 1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			r, err := toRegExp(args[0])
+			if err != nil {
+				return dune.NullValue, err
+			}
+			return r.Match(this.ToString()), nil
+		},
+	},
+	{
+		Name:      "String.prototype.matchAll",
+		Arguments: 1,
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			r, err := toRegExp(args[0])
+			if err != nil {
+				return dune.NullValue, err
+			}
+			return r.MatchAll(this.ToString()), nil
+		},
+	},
 	{
 		Name:      "regex.match",
 		Arguments: 2,
@@ -186,3 +285,16 @@ var Regex = []dune.NativeFunction{
 		},
 	},
 }
+
+// toRegExp accepts a RegExp or a string pattern.
+func toRegExp(v dune.Value) (*dune.RegExp, error) {
+	if r, ok := v.ToObjectOrNil().(*dune.RegExp); ok {
+		return r, nil
+	}
+
+	if v.Type != dune.String {
+		return nil, fmt.Errorf("expected a RegExp, got %s", v.TypeName())
+	}
+
+	return dune.NewRegExp(v.ToString(), "")
+}
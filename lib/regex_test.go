@@ -0,0 +1,93 @@
+package lib
+
+import "testing"
+
+func TestRegExpLiteral(t *testing.T) {
+	v := runTest(t, `
+		function main() {
+			let a = /^ab+c$/i.test("xABBC")
+			let b = /^ab+c$/i.test("ABBC")
+			return a + "-" + b + "-" + (12 / 3 / 2 == 2)
+		}
+	`)
+
+	if v.ToString() != "false-true-true" {
+		t.Fatal(v)
+	}
+}
+
+func TestRegExpExec(t *testing.T) {
+	v := runTest(t, `
+		function main() {
+			let m = /(?<year>\d{4})-(\d\d)/.exec("since 2020-05")
+			return m[0] + "|" + m.groups.year + "|" + m[2] + "|" + m.index
+		}
+	`)
+
+	if v.ToString() != "2020-05|2020|05|6" {
+		t.Fatal(v)
+	}
+}
+
+func TestRegExpConstructor(t *testing.T) {
+	v := runTest(t, `
+		function main() {
+			let r = new RegExp("a[0-9]", "gi")
+			let s = "A1 b a2"
+			return r.source + "|" + r.flags + "|" + s.match(r).join(",")
+		}
+	`)
+
+	if v.ToString() != "a[0-9]|gi|A1,a2" {
+		t.Fatal(v)
+	}
+}
+
+func TestStringMatch(t *testing.T) {
+	v := runTest(t, `
+		function main() {
+			let s = "a1 b22 c333"
+			let all = s.match(/\d+/g)
+			let first = s.match(/[a-z](\d+)/)
+			let none = s.match(/x/)
+			return all.length + "|" + first[1] + "|" + (none === null)
+		}
+	`)
+
+	if v.ToString() != "3|1|true" {
+		t.Fatal(v)
+	}
+}
+
+func TestStringMatchAll(t *testing.T) {
+	v := runTest(t, `
+		function main() {
+			let s = ""
+			let v = "k1=v1;k2=v2"
+			for (let m of v.matchAll(/(?<key>\w+)=(\w+)/g)) {
+				s += m.groups.key + ":" + m[2] + ","
+			}
+			return s
+		}
+	`)
+
+	if v.ToString() != "k1:v1,k2:v2," {
+		t.Fatal(v)
+	}
+}
+
+func TestStringReplaceRegExp(t *testing.T) {
+	v := runTest(t, `
+		function main() {
+			let s = "2020-05 2021-06"
+			let a = s.replace(/(\d+)-(?<month>\d+)/, "$<month>/$1")
+			let b = s.replace(/\d+/g, x => "[" + x + "]")
+			let c = s.replace(/-/g, "$$")
+			return a + "|" + b + "|" + c
+		}
+	`)
+
+	if v.ToString() != "05/2020 2021-06|[2020]-[05] [2021]-[06]|2020$05 2021$06" {
+		t.Fatal(v)
+	}
+}
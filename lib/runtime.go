@@ -70,12 +70,25 @@ declare namespace runtime {
     export function resource(name: string): byte[]
 
     export function getStackTrace(): string
+
+    /**
+     * Starts sampling the execution to find where the time is spent and the memory allocated.
+     */
+    export function startProfile(): void
+
+    /**
+     * Stops the profile and returns it in the gzipped protobuf format of pprof.
+     */
+    export function stopProfile(): byte[]
+
     export function newVM(p: Program, globals?: any[]): VirtualMachine
 
     export interface Program {
 		readonly constants: any[]
         functions(): FunctionInfo[]
         functionInfo(name: string): FunctionInfo
+        classes(): ClassInfo[]
+        classInfo(name: string): ClassInfo
         resources(): string[]
         resource(key: string): byte[]
         setResource(key: string, value: byte[]): void
@@ -103,12 +116,44 @@ declare namespace runtime {
 		optionalArguments: number
         exported: boolean
 		func: Function
+		/**
+		 * The name of the class if it is a method.
+		 */
+		className: string
+		static: boolean
+		getter: boolean
+		setter: boolean
 		directives(): string[]
 		directive(): string
 		hasDirective(name: string): boolean
+		decorators(): Decorator[]
+		decorator(name: string): Decorator
+		hasDecorator(name: string): boolean
         toString(): string
     }
 
+    export interface ClassInfo {
+        name: string
+        exported: boolean
+        /**
+         * The name of the base class or null.
+         */
+        base: string
+        functions(): FunctionInfo[]
+		directives(): string[]
+		decorators(): Decorator[]
+		decorator(name: string): Decorator
+		hasDecorator(name: string): boolean
+    }
+
+    /**
+     * A decorator declared with @name(args). The arguments are constant values.
+     */
+    export interface Decorator {
+        name: string
+        args: any[]
+    }
+
     export interface VirtualMachine {
 		maxAllocations: number
 		maxFrames: number
@@ -407,6 +452,37 @@ var Runtime = []dune.NativeFunction{
 			return dune.NullValue, nil
 		},
 	},
+	{
+		Name: "runtime.startProfile",
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if !vm.HasPermission("trusted") {
+				return dune.NullValue, ErrUnauthorized
+			}
+			if err := vm.StartProfile(dune.NewProfiler()); err != nil {
+				return dune.NullValue, err
+			}
+			return dune.NullValue, nil
+		},
+	},
+	{
+		Name: "runtime.stopProfile",
+		Function: func(this dune.Value, args []dune.Value, vm *dune.VM) (dune.Value, error) {
+			if !vm.HasPermission("trusted") {
+				return dune.NullValue, ErrUnauthorized
+			}
+
+			p := vm.StopProfile()
+			if p == nil {
+				return dune.NullValue, fmt.Errorf("the profile has not been started")
+			}
+
+			var b bytes.Buffer
+			if err := p.Write(&b); err != nil {
+				return dune.NullValue, err
+			}
+			return dune.NewBytes(b.Bytes()), nil
+		},
+	},
 	{
 		Name:      "runtime.getStackTrace",
 		Arguments: 0,
@@ -533,6 +609,10 @@ func (p *program) GetMethod(name string) dune.NativeMethod {
 		return p.functions
 	case "functionInfo":
 		return p.functionInfo
+	case "classes":
+		return p.classes
+	case "classInfo":
+		return p.classInfo
 	case "toString":
 		return p.toString
 	case "toBytes":
@@ -770,6 +850,34 @@ func (p *program) functionInfo(args []dune.Value, vm *dune.VM) (dune.Value, erro
 	return dune.NewObject(functionInfo{f, *p}), nil
 }
 
+func (p *program) classes(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	if len(args) != 0 {
+		return dune.NullValue, fmt.Errorf("expected no args")
+	}
+
+	classes := make([]dune.Value, len(p.prog.Classes))
+	for i, c := range p.prog.Classes {
+		classes[i] = dune.NewObject(classInfo{c, *p})
+	}
+	return dune.NewArrayValues(classes), nil
+}
+
+func (p *program) classInfo(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	if err := ValidateArgs(args, dune.String); err != nil {
+		return dune.NullValue, err
+	}
+
+	name := args[0].ToString()
+
+	for _, c := range p.prog.Classes {
+		if c.Name == name {
+			return dune.NewObject(classInfo{c, *p}), nil
+		}
+	}
+
+	return dune.NullValue, nil
+}
+
 func (p *program) toBytes(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 	if err := ValidateArgs(args, dune.Object); err != nil {
 		return dune.NullValue, err
@@ -807,12 +915,30 @@ func (f functionInfo) GetMethod(name string) dune.NativeMethod {
 		return f.directive
 	case "hasDirective":
 		return f.hasDirective
+	case "decorators":
+		return f.decorators
+	case "decorator":
+		return f.decorator
+	case "hasDecorator":
+		return f.hasDecorator
 	case "toString":
 		return f.toString
 	}
 	return nil
 }
 
+func (f functionInfo) decorators(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	return decorators(f.fn.Decorators, args)
+}
+
+func (f functionInfo) decorator(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	return decorator(f.fn.Decorators, args)
+}
+
+func (f functionInfo) hasDecorator(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	return hasDecorator(f.fn.Decorators, args)
+}
+
 func (f functionInfo) hasDirective(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 	if err := ValidateArgs(args, dune.String); err != nil {
 		return dune.NullValue, err
@@ -878,10 +1004,130 @@ func (f functionInfo) GetProperty(name string, vm *dune.VM) (dune.Value, error)
 		return dune.NewBool(f.fn.Exported), nil
 	case "func":
 		return dune.NewFunction(f.fn.Index), nil
+	case "className":
+		if !f.fn.IsClass {
+			return dune.NullValue, nil
+		}
+		return dune.NewString(f.p.prog.Classes[f.fn.Class].Name), nil
+	case "static":
+		return dune.NewBool(f.fn.Static), nil
+	case "getter":
+		return dune.NewBool(f.fn.Getter), nil
+	case "setter":
+		return dune.NewBool(f.fn.Setter), nil
 	}
 	return dune.UndefinedValue, nil
 }
 
+type classInfo struct {
+	class *dune.Class
+	p     program
+}
+
+func (classInfo) Type() string {
+	return "runtime.ClassInfo"
+}
+
+func (c classInfo) GetProperty(name string, vm *dune.VM) (dune.Value, error) {
+	switch name {
+	case "name":
+		return dune.NewString(c.class.Name), nil
+	case "exported":
+		return dune.NewBool(c.class.Exported), nil
+	case "base":
+		if c.class.Base == -1 {
+			return dune.NullValue, nil
+		}
+		return dune.NewString(c.p.prog.Classes[c.class.Base].Name), nil
+	}
+	return dune.UndefinedValue, nil
+}
+
+func (c classInfo) GetMethod(name string) dune.NativeMethod {
+	switch name {
+	case "functions":
+		return c.functions
+	case "directives":
+		return c.directives
+	case "decorators":
+		return c.decorators
+	case "decorator":
+		return c.decorator
+	case "hasDecorator":
+		return c.hasDecorator
+	}
+	return nil
+}
+
+func (c classInfo) functions(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	if err := ValidateArgs(args); err != nil {
+		return dune.NullValue, err
+	}
+
+	funcs := make([]dune.Value, len(c.class.Functions))
+	for i, index := range c.class.Functions {
+		funcs[i] = dune.NewObject(functionInfo{c.p.prog.Functions[index], c.p})
+	}
+	return dune.NewArrayValues(funcs), nil
+}
+
+func (c classInfo) directives(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	if err := ValidateArgs(args); err != nil {
+		return dune.NullValue, err
+	}
+
+	result := make([]dune.Value, len(c.class.Directives))
+	for i, item := range c.class.Directives {
+		result[i] = dune.NewString(item)
+	}
+	return dune.NewArrayValues(result), nil
+}
+
+func (c classInfo) decorators(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	return decorators(c.class.Decorators, args)
+}
+
+func (c classInfo) decorator(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	return decorator(c.class.Decorators, args)
+}
+
+func (c classInfo) hasDecorator(args []dune.Value, vm *dune.VM) (dune.Value, error) {
+	return hasDecorator(c.class.Decorators, args)
+}
+
+func decorators(list []*dune.Decorator, args []dune.Value) (dune.Value, error) {
+	if err := ValidateArgs(args); err != nil {
+		return dune.NullValue, err
+	}
+
+	result := make([]dune.Value, len(list))
+	for i, d := range list {
+		result[i] = d.ToValue()
+	}
+	return dune.NewArrayValues(result), nil
+}
+
+func decorator(list []*dune.Decorator, args []dune.Value) (dune.Value, error) {
+	if err := ValidateArgs(args, dune.String); err != nil {
+		return dune.NullValue, err
+	}
+
+	d := dune.FindDecorator(list, args[0].ToString())
+	if d == nil {
+		return dune.NullValue, nil
+	}
+	return d.ToValue(), nil
+}
+
+func hasDecorator(list []*dune.Decorator, args []dune.Value) (dune.Value, error) {
+	if err := ValidateArgs(args, dune.String); err != nil {
+		return dune.NullValue, err
+	}
+
+	d := dune.FindDecorator(list, args[0].ToString())
+	return dune.NewBool(d != nil), nil
+}
+
 type libVM struct {
 	vm *dune.VM
 }
@@ -600,3 +600,108 @@ func TestFinalizeGlobal(t *testing.T) {
 		}
 	`)
 }
+
+func TestFunctionInfoClass(t *testing.T) {
+	v := runTest(t, `
+		class Foo {
+			get bar() { return 1 }
+			set bar(v) { }
+			static create() { return new Foo() }
+		}
+
+		function main() {
+			let result = []
+			for (let f of runtime.vm.program.functions()) {
+				if (f.className == "Foo") {
+					result.push(f.name + ":" + f.static + ":" + f.getter + ":" + f.setter)
+				}
+			}
+			return result.join(",")
+		}
+	`)
+
+	expected := "bar:false:true:false,bar:false:false:true,create:true:false:false"
+	if v.String() != expected {
+		t.Fatalf("Expected %s, got %v", expected, v)
+	}
+}
+
+func TestFunctionInfoDefaultParams(t *testing.T) {
+	v := runTest(t, `
+		function foo(a, b = 1, c?) {
+		}
+
+		function main() {
+			let f = runtime.vm.program.functionInfo("foo")
+			return f.arguments + "-" + f.optionalArguments
+		}
+	`)
+
+	if v.String() != "3-2" {
+		t.Fatalf("Expected 3-2, got %v", v)
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	v := runTest(t, `
+		enum Role { admin = 1, user = 2 }
+
+		const PREFIX = "/api"
+
+		@controller(PREFIX)
+		class Users {
+			@route("GET", "/:id")
+			@permission(Role.admin, ["read", "write"], { cache: -10 })
+			get(id: number) { }
+		}
+
+		@task("daily")
+		function cleanup() { }
+
+		function main() {
+			let p = reflect.program
+			let f = p.functionInfo("cleanup")
+			let d = f.decorator("task")
+
+			let c = p.classInfo("Users")
+			let m = c.functions()[0]
+			let perm = m.decorator("permission")
+
+			let values = [
+				d.name,
+				d.args[0],
+				f.hasDecorator("task"),
+				f.hasDecorator("route"),
+				c.decorator("controller").args[0],
+				m.decorators().length,
+				perm.args[0],
+				perm.args[1][1],
+				perm.args[2].cache
+			]
+
+			return values.join(",")
+		}
+	`)
+
+	if v.String() != "task,daily,true,false,/api,2,1,write,-10" {
+		t.Fatal(v)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	runTest(t, `
+		function main() {
+			runtime.startProfile()
+
+			let s = 0
+			for (let i = 0; i < 10; i++) {
+				s += i
+			}
+
+			let b = runtime.stopProfile()
+			if (b.length == 0) {
+				throw "expected a profile"
+			}
+		}
+	`)
+}
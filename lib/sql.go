@@ -80,7 +80,7 @@ declare namespace sql {
         nullable: boolean
     }
 
-    export interface Reader {
+    export interface Reader extends Iterable<any> {
         next(): boolean
         read(): any
         readValues(): any[]
@@ -637,6 +637,20 @@ func (r dbReader) GetMethod(name string) dune.NativeMethod {
 	return nil
 }
 
+// Next allows to iterate the rows with for...of
+func (r dbReader) Next() (dune.Value, bool, error) {
+	if !r.r.Next() {
+		return dune.NullValue, false, r.r.Err()
+	}
+
+	v, err := r.read(nil, nil)
+	if err != nil {
+		return dune.NullValue, false, err
+	}
+
+	return v, true, nil
+}
+
 func (r dbReader) next(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 	if len(args) != 0 {
 		return dune.NullValue, fmt.Errorf("expected 0 arguments, got %d", len(args))
@@ -1092,7 +1106,7 @@ func (s *libDB) execRaw(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		params = getSqlParams(args[1:])
 	}
 
-	res, err := s.db.ExecRaw(query, params...)
+	res, err := s.db.ExecRawContext(vm.GoContext(), query, params...)
 	if err != nil {
 		if errors.Is(err, dbx.ErrReadOnly) {
 			return dune.NullValue, dune.NewPublicError(err.Error())
@@ -1171,7 +1185,7 @@ func (s *libDB) exec(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		return dune.NullValue, err
 	}
 
-	res, err := s.db.ExecRaw(sQuery, params...)
+	res, err := s.db.ExecRawContext(vm.GoContext(), sQuery, params...)
 	if err != nil {
 		if errors.Is(err, dbx.ErrReadOnly) {
 			return dune.NullValue, dune.NewPublicError(err.Error())
@@ -1207,7 +1221,7 @@ func (s *libDB) queryFirst(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		if err != nil {
 			return dune.NullValue, err
 		}
-		rows, err = s.db.QueryRaw(sQuery, sParams...)
+		rows, err = s.db.QueryRawContext(vm.GoContext(), sQuery, sParams...)
 		if err != nil {
 			return dune.NullValue, err
 		}
@@ -1260,7 +1274,7 @@ func (s *libDB) queryFirstRaw(args []dune.Value, vm *dune.VM) (dune.Value, error
 		params = append(params, getSqlParams(args[1:])...)
 	}
 
-	rows, err := s.db.QueryRaw(query, params...)
+	rows, err := s.db.QueryRawContext(vm.GoContext(), query, params...)
 	if err != nil {
 		return dune.NullValue, err
 	}
@@ -1319,7 +1333,7 @@ func (s *libDB) queryValue(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 			return dune.NullValue, err
 		}
 
-		v, err = s.db.QueryValueRaw(sQuery, sParams...)
+		v, err = s.db.QueryValueRawContext(vm.GoContext(), sQuery, sParams...)
 		if err != nil {
 			return dune.NullValue, err
 		}
@@ -1356,7 +1370,7 @@ func (s *libDB) queryValueRaw(args []dune.Value, vm *dune.VM) (dune.Value, error
 		params = append(params, getSqlParams(args[1:])...)
 	}
 
-	row := s.db.QueryRowRaw(query, params...)
+	row := s.db.QueryRowRawContext(vm.GoContext(), query, params...)
 
 	var v interface{}
 	if err := row.Scan(&v); err != nil {
@@ -1694,7 +1708,7 @@ func (s *libDB) queryValuesRaw(args []dune.Value, vm *dune.VM) (dune.Value, erro
 		params = append(params, getSqlParams(args[1:])...)
 	}
 
-	rows, err := s.db.QueryRaw(query, params...)
+	rows, err := s.db.QueryRawContext(vm.GoContext(), query, params...)
 	if err != nil {
 		return dune.NullValue, err
 	}
@@ -1743,7 +1757,7 @@ func (s *libDB) getTable(args []dune.Value, vm *dune.VM) (*dbx.Table, error) {
 		if err != nil {
 			return nil, err
 		}
-		rows, err := s.db.QueryRaw(sQuery)
+		rows, err := s.db.QueryRawContext(vm.GoContext(), sQuery)
 		if err != nil {
 			return nil, err
 		}
@@ -1758,7 +1772,7 @@ func (s *libDB) getTable(args []dune.Value, vm *dune.VM) (*dbx.Table, error) {
 		if err != nil {
 			return nil, err
 		}
-		rows, err := s.db.QueryRaw(sQuery, sParams...)
+		rows, err := s.db.QueryRawContext(vm.GoContext(), sQuery, sParams...)
 		if err != nil {
 			return nil, err
 		}
@@ -1797,7 +1811,7 @@ func (s *libDB) queryRaw(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		params = append(params, getSqlParams(args[1:])...)
 	}
 
-	rows, err := s.db.QueryRaw(q, params...)
+	rows, err := s.db.QueryRawContext(vm.GoContext(), q, params...)
 	if err != nil {
 		return dune.NullValue, err
 	}
@@ -1851,7 +1865,7 @@ func (s *libDB) reader(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		if err != nil {
 			return dune.NullValue, err
 		}
-		dbxReader, err = s.db.ReaderRaw(sQuery)
+		dbxReader, err = s.db.ReaderRawContext(vm.GoContext(), sQuery)
 		if err != nil {
 			return dune.NullValue, err
 		}
@@ -1861,7 +1875,7 @@ func (s *libDB) reader(args []dune.Value, vm *dune.VM) (dune.Value, error) {
 		if err != nil {
 			return dune.NullValue, err
 		}
-		dbxReader, err = s.db.ReaderRaw(sQuery, sParams...)
+		dbxReader, err = s.db.ReaderRawContext(vm.GoContext(), sQuery, sParams...)
 		if err != nil {
 			return dune.NullValue, err
 		}
@@ -383,6 +383,13 @@ var Strings = []dune.NativeFunction{
 				return dune.NullValue, fmt.Errorf("expected 2 or 3 arguments, got %d", len(args))
 			}
 
+			if r, ok := args[0].ToObjectOrNil().(*dune.RegExp); ok {
+				if l != 2 {
+					return dune.NullValue, fmt.Errorf("expected 2 arguments, got %d", len(args))
+				}
+				return r.Replace(this.ToString(), args[1], vm)
+			}
+
 			oldStr := args[0].ToString()
 			newStr := args[1].ToString()
 
@@ -630,8 +630,17 @@ var Time = []dune.NativeFunction{
 				return dune.NullValue, err
 			}
 
-			time.Sleep(d)
-			return dune.NullValue, nil
+			// stop sleeping if the execution is canceled
+			ctx := vm.GoContext()
+			t := time.NewTimer(d)
+			defer t.Stop()
+
+			select {
+			case <-t.C:
+				return dune.NullValue, nil
+			case <-ctx.Done():
+				return dune.NullValue, ctx.Err()
+			}
 		},
 	},
 	{
@@ -1,8 +1,12 @@
 package lib
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/scorredoira/dune"
 )
 
 func TestParseDuration(t *testing.T) {
@@ -110,3 +114,28 @@ func TestTimeSetTime(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestSleepDeadline(t *testing.T) {
+	p, err := dune.CompileStr(`
+		function main() {
+			time.sleep(10 * time.Second)
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := dune.NewVM(p)
+	vm.Deadline = time.Now().Add(20 * time.Millisecond)
+
+	start := time.Now()
+
+	_, err = vm.Run()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatal("the sleep was not interrupted")
+	}
+}
@@ -0,0 +1,936 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+)
+
+type linter struct {
+	mod         *ast.Module
+	config      *Config
+	diagnostics []*Diagnostic
+	scope       *scope
+	async       bool            // if the function being checked is async
+	handler     bool            // if the function being checked handles http requests
+	packages    map[string]bool // the namespaces of the native functions: strings, http...
+	promises    map[string]bool // the natives that return a promise
+}
+
+// scope is a block where the identifiers are declared.
+type scope struct {
+	parent *scope
+	vars   map[string]*variable
+}
+
+type variable struct {
+	name  string
+	pos   ast.Position
+	used  bool
+	local bool // declared inside a function
+	param bool // parameters are not reported if unused
+	rest  bool // a property removed from a rest pattern: { a, ...rest }
+	async bool // an async function
+	hides bool // if it has been reported hiding a native package
+	imp   *ast.ImportStmt
+
+	// promise is the function that returned the promise stored in the
+	// variable. It is handled if it is awaited or passed to other code.
+	promise string
+	handled bool
+	module  *ast.File // the module of a namespace import
+}
+
+// blocking are the natives that wait for the network, a process or a timer.
+// They must be awaited inside async functions and http handlers.
+var blocking = map[string]bool{
+	"http.get":        true,
+	"http.getJSON":    true,
+	"http.post":       true,
+	"net.dial":        true,
+	"net.dialTCP":     true,
+	"net.dialTimeout": true,
+	"os.exec":         true,
+	"smtp.send":       true,
+	"sql.open":        true,
+	"time.sleep":      true,
+}
+
+func newLinter(mod *ast.Module, config *Config, defs []*ast.File) *linter {
+	l := &linter{
+		mod:      mod,
+		config:   config,
+		packages: make(map[string]bool),
+		promises: make(map[string]bool),
+	}
+
+	for _, f := range dune.All() {
+		name := strings.TrimPrefix(f.Name, "->")
+		if strings.Contains(name, ".prototype.") {
+			continue
+		}
+		if i := strings.IndexByte(name, '.'); i != -1 {
+			l.packages[name[:i]] = true
+		}
+	}
+
+	for _, f := range defs {
+		l.declarePromises("", f.Types)
+	}
+
+	return l
+}
+
+// declarePromises finds the declared functions that return a promise.
+func (l *linter) declarePromises(prefix string, decls []ast.Stmt) {
+	for _, d := range decls {
+		switch t := d.(type) {
+		case *ast.NamespaceDecl:
+			if t.Name == "" {
+				l.declarePromises(prefix, t.Decls)
+			} else {
+				l.declarePromises(prefix+t.Name+".", t.Decls)
+			}
+
+		case *ast.DeclareStmt:
+			if f, ok := t.Type.(*ast.FuncType); ok && isPromise(f.Result) {
+				l.promises[prefix+t.Name] = true
+			}
+
+		case *ast.InterfaceDeclStmt:
+			if !t.Class || t.Body == nil {
+				continue
+			}
+			for _, m := range t.Body.Members {
+				if f, ok := m.Type.(*ast.FuncType); ok && m.Static && m.Method && isPromise(f.Result) {
+					l.promises[prefix+t.Name+"."+m.Name] = true
+				}
+			}
+		}
+	}
+}
+
+func isPromise(t ast.TypeExpr) bool {
+	r, ok := t.(*ast.TypeRef)
+	return ok && r.Name == "Promise"
+}
+
+func (l *linter) report(pos ast.Position, rule string, format string, args ...interface{}) *Diagnostic {
+	severity := l.config.Rules[rule]
+	if severity == Off {
+		return nil
+	}
+
+	d := &Diagnostic{
+		Pos:      pos,
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	l.diagnostics = append(l.diagnostics, d)
+	return d
+}
+
+func (l *linter) file(f *ast.File) {
+	l.openScope()
+
+	for _, imp := range f.Imports {
+		l.declareImport(imp)
+	}
+	for _, imp := range f.TypeImports {
+		l.declareImport(imp)
+	}
+
+	l.hoist(f.Stms, false)
+	l.hoist(f.Types, false)
+	l.hoist(f.Global, false)
+
+	l.stmts(f.Stms)
+	l.stmts(f.Types)
+	l.stmts(f.Global)
+
+	if f.Default != "" {
+		l.use(f.Default)
+	}
+
+	for _, imp := range f.Imports {
+		l.unusedImport(imp)
+	}
+	for _, imp := range f.TypeImports {
+		l.unusedImport(imp)
+	}
+
+	l.scope = l.scope.parent
+}
+
+func (l *linter) declareImport(imp *ast.ImportStmt) {
+	if imp.Export {
+		return
+	}
+
+	module := l.mod.Modules[imp.AbsPath]
+
+	if imp.Alias != "" {
+		l.declare(&variable{name: imp.Alias, pos: imp.Pos, imp: imp, module: module})
+	}
+
+	if imp.Default != "" {
+		v := &variable{name: imp.Default, pos: imp.Pos, imp: imp}
+		if module != nil {
+			v.async = isAsync(module, module.Default)
+		}
+		l.declare(v)
+	}
+
+	for _, list := range [][]*ast.ImportName{imp.Names, imp.TypeNames} {
+		for _, n := range list {
+			v := &variable{name: n.Alias, pos: n.Pos, imp: imp}
+			if module != nil {
+				v.async = isAsync(module, n.Name)
+			}
+			l.declare(v)
+		}
+	}
+}
+
+// unusedImport reports the names of an import that are not used.
+func (l *linter) unusedImport(imp *ast.ImportStmt) {
+	if imp.Export {
+		return
+	}
+
+	var names []string
+	if imp.Alias != "" {
+		names = append(names, imp.Alias)
+	}
+	if imp.Default != "" {
+		names = append(names, imp.Default)
+	}
+	for _, n := range imp.Names {
+		names = append(names, n.Alias)
+	}
+	for _, n := range imp.TypeNames {
+		names = append(names, n.Alias)
+	}
+
+	for _, name := range names {
+		v := l.scope.vars[name]
+		if v == nil || v.imp != imp || v.used {
+			continue
+		}
+		if d := l.report(v.pos, UnusedImport, "%s is imported and not used", name); d != nil {
+			d.imp = imp
+			d.name = name
+		}
+	}
+}
+
+// isAsync returns true if name is an exported async function of the module.
+func isAsync(module *ast.File, name string) bool {
+	for _, s := range module.Stms {
+		if f, ok := s.(*ast.FuncDeclStmt); ok && f.Name == name && f.Async {
+			return f.Exported || module.Default == name
+		}
+	}
+	return false
+}
+
+func (l *linter) openScope() {
+	l.scope = &scope{parent: l.scope, vars: make(map[string]*variable)}
+}
+
+// closeScope reports the local declarations of the scope that are not used.
+func (l *linter) closeScope() {
+	for _, v := range l.scope.vars {
+		if !v.local || v.used || v.param || v.rest || strings.HasPrefix(v.name, "_") {
+			continue
+		}
+		l.report(v.pos, UnusedVariable, "%s is declared and not used", v.name)
+	}
+	for _, v := range l.scope.vars {
+		if v.promise != "" && !v.handled {
+			l.report(v.pos, MissingAwait, "the promise returned by %s and stored in %s is not awaited", v.promise, v.name)
+		}
+	}
+	l.scope = l.scope.parent
+}
+
+func (l *linter) lookup(name string) *variable {
+	for s := l.scope; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func (l *linter) use(name string) {
+	if v := l.lookup(name); v != nil {
+		v.used = true
+	}
+}
+
+// declare adds a variable to the current scope reporting
+// if it hides another one.
+func (l *linter) declare(v *variable) {
+	if v.name == "" {
+		return
+	}
+
+	if _, ok := l.scope.vars[v.name]; ok {
+		// declared twice: the compiler reports it
+		return
+	}
+
+	if outer := l.lookup(v.name); outer != nil {
+		l.report(v.pos, Shadow, "%s shadows the declaration of line %d", v.name, outer.pos.Line)
+	}
+
+	l.scope.vars[v.name] = v
+}
+
+// hoist declares the functions, classes and variables of a block
+// before checking it because they can be used before the declaration
+// in functions.
+func (l *linter) hoist(list []ast.Stmt, local bool) {
+	for _, s := range list {
+		switch t := s.(type) {
+		case *ast.FuncDeclStmt:
+			if t.ReceiverType == "" && !t.Anonymous {
+				l.declare(&variable{name: t.Name, pos: t.Pos, local: local, async: t.Async})
+			}
+
+		case *ast.ClassDeclStmt:
+			l.declare(&variable{name: t.Name, pos: t.Pos, local: local})
+
+		case *ast.EnumDeclStmt:
+			l.declare(&variable{name: t.Name, pos: t.Pos, local: local})
+
+		case *ast.VarDeclStmt:
+			l.declareVar(t, local, false)
+
+		case *ast.DeclareStmt:
+			l.declare(&variable{name: t.Name, pos: t.Pos})
+		}
+	}
+}
+
+func (l *linter) declareVar(t *ast.VarDeclStmt, local, param bool) {
+	if t.Pattern != nil {
+		l.declarePattern(t.Pattern, local, param)
+		return
+	}
+	l.declare(&variable{name: t.Name, pos: t.Pos, local: local, param: param})
+}
+
+func (l *linter) declarePattern(p *ast.PatternExpr, local, param bool) {
+	// the properties of an object pattern with a rest element
+	// can be declared only to remove them from the rest
+	var rest bool
+	if p.IsObject {
+		for _, e := range p.Elements {
+			rest = rest || e.Rest
+		}
+	}
+
+	for _, e := range p.Elements {
+		switch t := e.Target.(type) {
+		case *ast.IdentExpr:
+			l.declare(&variable{name: t.Name, pos: t.Pos, local: local, param: param, rest: rest && !e.Rest})
+		case *ast.PatternExpr:
+			l.declarePattern(t, local, param)
+		}
+	}
+}
+
+func (l *linter) block(b *ast.BlockStmt) {
+	if b == nil {
+		return
+	}
+	l.openScope()
+	l.hoist(b.List, true)
+	l.stmts(b.List)
+	l.closeScope()
+}
+
+// function checks a function declaring the arguments in the scope of the body.
+func (l *linter) function(args *ast.Arguments, result ast.TypeExpr, body *ast.BlockStmt, async, handler bool) {
+	outerAsync, outerHandler := l.async, l.handler
+	l.async, l.handler = async, handler || isHandler(args)
+	defer func() { l.async, l.handler = outerAsync, outerHandler }()
+
+	l.openScope()
+
+	if args != nil {
+		for _, f := range args.List {
+			if f.Pattern != nil {
+				l.declarePattern(f.Pattern, true, true)
+				l.patternDefaults(f.Pattern)
+			} else {
+				l.declare(&variable{name: f.Name, pos: f.Pos, local: true, param: true})
+			}
+			l.typ(f.Type)
+			l.expr(f.Default)
+		}
+	}
+
+	l.typ(result)
+
+	if body != nil {
+		l.hoist(body.List, true)
+		l.stmts(body.List)
+	}
+
+	l.closeScope()
+}
+
+func (l *linter) stmts(list []ast.Stmt) {
+	for _, s := range list {
+		l.stmt(s)
+	}
+	l.unreachable(list)
+}
+
+// unreachable reports the first statement after a return, throw, break or continue.
+func (l *linter) unreachable(list []ast.Stmt) {
+	for i, s := range list {
+		if !terminates(s) {
+			continue
+		}
+		for _, next := range list[i+1:] {
+			if _, ok := next.(ast.Decl); ok {
+				if _, ok := next.(*ast.VarDeclStmt); !ok {
+					// functions, classes and types are declared anyway
+					continue
+				}
+			}
+			l.report(next.Position(), Unreachable, "unreachable code")
+			return
+		}
+		return
+	}
+}
+
+// terminates returns true if the statements after s are never executed.
+func terminates(s ast.Stmt) bool {
+	switch t := s.(type) {
+	case *ast.ReturnStmt, *ast.ThrowStmt, *ast.BreakStmt, *ast.ContinueStmt:
+		return true
+
+	case *ast.TailCallStmt:
+		return t.Return
+
+	case *ast.BlockStmt:
+		for _, s := range t.List {
+			if terminates(s) {
+				return true
+			}
+		}
+
+	case *ast.IfStmt:
+		if t.Else == nil || !terminates(t.Else) {
+			return false
+		}
+		for _, b := range t.IfBlocks {
+			if !terminates(b.Body) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func (l *linter) stmt(s ast.Stmt) {
+	switch t := s.(type) {
+	case *ast.FuncDeclStmt:
+		l.decorators(t.Decorators)
+		if t.ReceiverType != "" {
+			l.use(t.ReceiverType)
+		}
+		l.typeParams(t.TypeParams)
+		l.function(t.Args, t.Result, t.Body, t.Async, false)
+
+	case *ast.ClassDeclStmt:
+		l.decorators(t.Decorators)
+		l.typeParams(t.TypeParams)
+		l.expr(t.Extends)
+		for _, r := range t.Implements {
+			l.typ(r)
+		}
+		for _, f := range t.Fields {
+			l.typ(f.Type)
+			l.expr(f.Value)
+		}
+		for _, f := range t.Functions {
+			l.decorators(f.Decorators)
+			l.typeParams(f.TypeParams)
+			l.function(f.Args, f.Result, f.Body, f.Async, false)
+		}
+
+	case *ast.VarDeclStmt:
+		l.typ(t.Type)
+		if t.Pattern != nil {
+			l.patternDefaults(t.Pattern)
+		}
+		l.expr(t.Value)
+		l.pass(t.Value)
+		l.stored(t)
+
+	case *ast.InterfaceDeclStmt:
+		l.typeParams(t.TypeParams)
+		for _, r := range t.Extends {
+			l.typ(r)
+		}
+		if t.Body != nil {
+			l.typ(t.Body)
+		}
+
+	case *ast.TypeAliasStmt:
+		l.typeParams(t.TypeParams)
+		l.typ(t.Type)
+
+	case *ast.DeclareStmt:
+		l.typ(t.Type)
+
+	case *ast.BlockStmt:
+		l.block(t)
+
+	case *ast.IfStmt:
+		for _, b := range t.IfBlocks {
+			l.expr(b.Condition)
+			l.block(b.Body)
+		}
+		l.block(t.Else)
+
+	case *ast.WhileStmt:
+		l.expr(t.Expression)
+		l.block(t.Body)
+
+	case *ast.ForStmt:
+		l.openScope()
+		l.hoist(t.Declaration, true)
+		l.stmts(t.Declaration)
+		l.expr(t.Expression)
+		if t.Step != nil {
+			l.stmt(t.Step)
+		}
+		l.expr(t.InExpression)
+		l.expr(t.OfExpression)
+		l.block(t.Body)
+		l.closeScope()
+
+	case *ast.SwitchStmt:
+		l.expr(t.Expression)
+		blocks := t.Blocks
+		if t.Default != nil {
+			blocks = append(blocks[:len(blocks):len(blocks)], t.Default)
+		}
+		// the cases share the scope
+		l.openScope()
+		for _, b := range blocks {
+			l.hoist(b.Stmts, true)
+		}
+		for _, b := range blocks {
+			l.expr(b.Expression)
+			l.stmts(b.Stmts)
+		}
+		l.closeScope()
+
+	case *ast.TryStmt:
+		l.block(t.Body)
+		if t.Catch != nil {
+			l.openScope()
+			if t.CatchIdent != nil {
+				l.declareVar(t.CatchIdent, true, true)
+			}
+			l.hoist(t.Catch.List, true)
+			l.stmts(t.Catch.List)
+			l.closeScope()
+		}
+		l.block(t.Finally)
+
+	case *ast.AsignStmt:
+		l.assign(t.Left)
+		if f, ok := t.Value.(*ast.FuncDeclExpr); ok && isHandlerField(t.Left) {
+			// s.handler = (w, r) => { ... }
+			l.function(f.Args, f.Result, f.Body, f.Async, true)
+		} else {
+			l.expr(t.Value)
+		}
+		l.pass(t.Value)
+
+	case *ast.IndexAsignStmt:
+		l.expr(t.IndexExpr)
+		l.expr(t.Value)
+
+	case *ast.IncStmt:
+		l.assign(t.Left)
+
+	case *ast.CallStmt:
+		l.call(t.CallExpr)
+		l.awaited(t.CallExpr)
+		l.blocks(t.CallExpr)
+
+	case *ast.TailCallStmt:
+		l.call(t.CallExpr)
+
+	case *ast.AwaitStmt:
+		l.expr(t.AwaitExpr)
+
+	case *ast.YieldStmt:
+		l.expr(t.YieldExpr)
+
+	case *ast.ReturnStmt:
+		l.expr(t.Value)
+		l.pass(t.Value)
+
+	case *ast.ThrowStmt:
+		l.expr(t.Value)
+
+	case *ast.DeleteStmt:
+		l.use(t.Object)
+	}
+}
+
+// assign checks the left side of an assignment. Assigning
+// a value to a variable is not a use of the variable.
+func (l *linter) assign(e ast.Expr) {
+	switch t := e.(type) {
+	case *ast.IdentExpr:
+	case *ast.PatternExpr:
+		for _, el := range t.Elements {
+			l.assign(el.Target)
+			l.expr(el.Default)
+		}
+	default:
+		l.expr(e)
+	}
+}
+
+func (l *linter) patternDefaults(p *ast.PatternExpr) {
+	for _, e := range p.Elements {
+		if t, ok := e.Target.(*ast.PatternExpr); ok {
+			l.patternDefaults(t)
+		}
+		l.expr(e.Default)
+	}
+}
+
+func (l *linter) decorators(list []*ast.Decorator) {
+	for _, d := range list {
+		l.use(rootName(d.Name))
+		l.exprs(d.Args)
+	}
+}
+
+// rootName returns the first part of a qualified name: foo in foo.bar
+func rootName(name string) string {
+	if i := strings.IndexByte(name, '.'); i != -1 {
+		return name[:i]
+	}
+	return name
+}
+
+func (l *linter) exprs(list []ast.Expr) {
+	for _, e := range list {
+		l.expr(e)
+	}
+}
+
+func (l *linter) expr(e ast.Expr) {
+	switch t := e.(type) {
+	case *ast.IdentExpr:
+		l.use(t.Name)
+		for _, a := range t.TypeArgs {
+			l.typ(a)
+		}
+	case *ast.FuncDeclExpr:
+		l.function(t.Args, t.Result, t.Body, t.Async, false)
+	case *ast.CallExpr:
+		l.call(t)
+		l.blocks(t)
+	case *ast.UnaryExpr:
+		l.expr(t.Operand)
+	case *ast.BinaryExpr:
+		l.expr(t.Left)
+		l.expr(t.Right)
+	case *ast.TernaryExpr:
+		l.expr(t.Condition)
+		l.expr(t.Left)
+		l.expr(t.Right)
+	case *ast.NewInstanceExpr:
+		l.expr(t.Name)
+		l.exprs(t.Args)
+	case *ast.AwaitExpr:
+		if c, ok := t.X.(*ast.CallExpr); ok {
+			l.call(c)
+		} else {
+			l.expr(t.X)
+		}
+		l.pass(t.X)
+	case *ast.YieldExpr:
+		l.expr(t.X)
+		l.pass(t.X)
+	case *ast.AsExpr:
+		l.expr(t.X)
+		l.typ(t.Type)
+	case *ast.TypeofExpr:
+		l.expr(t.Expr)
+	case *ast.SelectorExpr:
+		l.expr(t.X)
+		l.nativePackage(t)
+	case *ast.IndexExpr:
+		l.expr(t.Left)
+		l.expr(t.Index)
+	case *ast.SpreadExpr:
+		l.expr(t.X)
+	case *ast.MapDeclExpr:
+		for _, kv := range t.List {
+			l.expr(kv.Value)
+			l.pass(kv.Value)
+		}
+	case *ast.ArrayDeclExpr:
+		l.exprs(t.List)
+		for _, e := range t.List {
+			l.pass(e)
+		}
+	case *ast.TemplateExpr:
+		l.expr(t.Tag)
+		l.exprs(t.Values)
+	case *ast.PatternExpr:
+		l.assign(t)
+	}
+}
+
+func (l *linter) call(c *ast.CallExpr) {
+	l.expr(c.Ident)
+	l.exprs(c.Args)
+	l.native(c)
+
+	for _, a := range c.Args {
+		l.pass(a)
+	}
+
+	// p.then(...) and p.catch(...) handle the promise
+	if s, ok := c.Ident.(*ast.SelectorExpr); ok && (s.Sel.Name == "then" || s.Sel.Name == "catch") {
+		l.pass(s.X)
+	}
+}
+
+// native checks the calls to the native functions: pkg.name()
+func (l *linter) native(c *ast.CallExpr) {
+	var name string
+	var pos ast.Position
+
+	switch t := c.Ident.(type) {
+	case *ast.IdentExpr:
+		if l.lookup(t.Name) != nil {
+			return
+		}
+		name, pos = t.Name, t.Pos
+
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.IdentExpr)
+		if !ok || l.lookup(x.Name) != nil || !l.packages[x.Name] {
+			return
+		}
+		name, pos = x.Name+"."+t.Sel.Name, t.Sel.Pos
+
+	default:
+		return
+	}
+
+	f, ok := dune.NativeFuncFromName(name)
+	if !ok {
+		_, property := dune.NativeFuncFromName("->" + name)
+		if !property && strings.Contains(name, ".") {
+			l.report(pos, UnknownNative, "unknown native function %s", name)
+		}
+		return
+	}
+
+	if f.Arguments != -1 && !c.Spread && len(c.Args) != f.Arguments {
+		l.report(pos, NativeArity, "%s expects %d arguments, got %d", name, f.Arguments, len(c.Args))
+	}
+}
+
+// nativePackage reports the variables that hide a native package
+// where they are used as the package: let time = 1; time.now()
+func (l *linter) nativePackage(t *ast.SelectorExpr) {
+	x, ok := t.X.(*ast.IdentExpr)
+	if !ok || !l.packages[x.Name] {
+		return
+	}
+
+	v := l.lookup(x.Name)
+	if v == nil || v.imp != nil || v.hides {
+		return
+	}
+
+	name := x.Name + "." + t.Sel.Name
+	_, fn := dune.NativeFuncFromName(name)
+	_, property := dune.NativeFuncFromName("->" + name)
+	if fn || property {
+		v.hides = true
+		l.report(v.pos, Shadow, "%s hides the native package %s used in line %d", v.name, v.name, x.Pos.Line)
+	}
+}
+
+// awaited reports the promises that are ignored in an async function.
+func (l *linter) awaited(c *ast.CallExpr) {
+	if !l.async {
+		return
+	}
+	if name := l.promise(c.Ident); name != "" {
+		l.report(c.Position(), MissingAwait, "the promise returned by %s is not awaited", name)
+	}
+}
+
+// blocks reports the calls to blocking natives that are not awaited
+// in async functions and http handlers.
+func (l *linter) blocks(c *ast.CallExpr) {
+	if !l.async && !l.handler {
+		return
+	}
+
+	s, ok := c.Ident.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	x, ok := s.X.(*ast.IdentExpr)
+	if !ok || l.lookup(x.Name) != nil {
+		return
+	}
+
+	if name := x.Name + "." + s.Sel.Name; blocking[name] {
+		l.report(c.Position(), MissingAwait, "the blocking native %s is not awaited", name)
+	}
+}
+
+// isHandler returns true if the function receives an http.ResponseWriter
+// or an http.Request.
+func isHandler(args *ast.Arguments) bool {
+	if args == nil {
+		return false
+	}
+	for _, f := range args.List {
+		if r, ok := f.Type.(*ast.TypeRef); ok && (r.Name == "http.ResponseWriter" || r.Name == "http.Request") {
+			return true
+		}
+	}
+	return false
+}
+
+// isHandlerField returns true if e is the handler of an http server: s.handler.
+func isHandlerField(e ast.Expr) bool {
+	s, ok := e.(*ast.SelectorExpr)
+	return ok && s.Sel.Name == "handler"
+}
+
+// stored tracks the variables declared with the promise returned by a
+// call in an async function: let p = fetch(). They must be awaited or
+// passed to other code, like Promise.all([p]), before the scope ends.
+func (l *linter) stored(t *ast.VarDeclStmt) {
+	if !l.async || t.Pattern != nil {
+		return
+	}
+
+	c, ok := t.Value.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+
+	if v, ok := l.scope.vars[t.Name]; ok {
+		v.promise = l.promise(c.Ident)
+	}
+}
+
+// pass marks the promise stored in a variable as handled if e is the variable.
+func (l *linter) pass(e ast.Expr) {
+	if t, ok := e.(*ast.IdentExpr); ok {
+		if v := l.lookup(t.Name); v != nil {
+			v.handled = true
+		}
+	}
+}
+
+// promise returns the name of the function if it returns a promise:
+// an async function or a native declared as returning a Promise.
+func (l *linter) promise(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.IdentExpr:
+		v := l.lookup(t.Name)
+		if v != nil && v.async || v == nil && l.promises[t.Name] {
+			return t.Name
+		}
+
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.IdentExpr)
+		if !ok {
+			return ""
+		}
+		name := x.Name + "." + t.Sel.Name
+		v := l.lookup(x.Name)
+		if v == nil && l.promises[name] {
+			return name
+		}
+		if v != nil && v.module != nil && isAsync(v.module, t.Sel.Name) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func (l *linter) typeParams(list []*ast.TypeParam) {
+	for _, t := range list {
+		l.typ(t.Constraint)
+		l.typ(t.Default)
+	}
+}
+
+// typ marks the identifiers used in a type like the imported types.
+func (l *linter) typ(t ast.TypeExpr) {
+	switch t := t.(type) {
+	case *ast.TypeRef:
+		l.use(rootName(t.Name))
+		for _, a := range t.Args {
+			l.typ(a)
+		}
+		for _, word := range strings.FieldsFunc(t.Syntax, func(r rune) bool {
+			return !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+		}) {
+			l.use(word)
+		}
+	case *ast.ArrayType:
+		l.typ(t.Elem)
+	case *ast.TupleType:
+		for _, e := range t.Elems {
+			l.typ(e)
+		}
+	case *ast.UnionType:
+		for _, e := range t.Types {
+			l.typ(e)
+		}
+	case *ast.IntersectionType:
+		for _, e := range t.Types {
+			l.typ(e)
+		}
+	case *ast.FuncType:
+		l.typeParams(t.TypeParams)
+		for _, f := range t.Params {
+			l.typ(f.Type)
+		}
+		l.typ(t.Result)
+	case *ast.ObjectType:
+		for _, m := range t.Members {
+			l.typ(m.KeyType)
+			l.typ(m.Type)
+		}
+	}
+}
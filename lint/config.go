@@ -0,0 +1,87 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/scorredoira/dune/filesystem"
+	"github.com/scorredoira/dune/parser"
+)
+
+// Config sets the severity of the rules.
+type Config struct {
+	Rules map[string]Severity
+}
+
+// DefaultConfig returns a configuration with all the rules enabled.
+func DefaultConfig() *Config {
+	c := &Config{Rules: make(map[string]Severity, len(Rules))}
+	for k, v := range Rules {
+		c.Rules[k] = v
+	}
+	return c
+}
+
+// ReadConfig returns the configuration of the file at path. It is the
+// "lint" section of the first dune.json or tsconfig.json found in the
+// directory of the file or in its parents:
+//
+//	"lint": { "shadow": "off", "unused-variable": "error" }
+//
+// The rules that are not set keep their default severity.
+func ReadConfig(fs filesystem.FS, path string) (*Config, error) {
+	dir, err := fs.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		for _, name := range []string{"dune.json", "tsconfig.json"} {
+			path := filepath.Join(dir, name)
+
+			m, err := parser.ReadJSON(fs, path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+
+			if lint, ok := m["lint"]; ok {
+				return parseConfig(path, lint)
+			}
+		}
+
+		base := filepath.Dir(dir)
+		if base == dir {
+			return DefaultConfig(), nil
+		}
+		dir = base
+	}
+}
+
+func parseConfig(path string, v interface{}) (*Config, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: lint must be an object", path)
+	}
+
+	c := DefaultConfig()
+
+	for rule, v := range m {
+		if _, ok := Rules[rule]; !ok {
+			return nil, fmt.Errorf("%s: invalid lint rule %q", path, rule)
+		}
+
+		s, _ := v.(string)
+		severity, ok := parseSeverity(s)
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid severity for %s: %v. Expected off, warning or error", path, rule, v)
+		}
+
+		c.Rules[rule] = severity
+	}
+
+	return c, nil
+}
@@ -0,0 +1,162 @@
+package lint
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// Fix removes from src, the source of the file, the unused imports of
+// the diagnostics. It returns the fixed source and the diagnostics
+// that it could not fix.
+func Fix(src []byte, diagnostics []*Diagnostic) ([]byte, []*Diagnostic) {
+	unused := make(map[*ast.ImportStmt]map[string]bool)
+	var imports []*ast.ImportStmt
+
+	for _, d := range diagnostics {
+		if d.imp == nil {
+			continue
+		}
+		names, ok := unused[d.imp]
+		if !ok {
+			names = make(map[string]bool)
+			unused[d.imp] = names
+			imports = append(imports, d.imp)
+		}
+		names[d.name] = true
+	}
+
+	// edit from the bottom to keep the line numbers of the imports above
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].Pos.Line > imports[j].Pos.Line
+	})
+
+	lines := strings.Split(string(src), "\n")
+	fixed := make(map[*ast.ImportStmt]bool)
+
+	for _, imp := range imports {
+		start, end, ok := importLines(lines, imp)
+		if !ok {
+			continue
+		}
+
+		var edit []string
+		if s := importSource(imp, unused[imp], lines[end]); s != "" {
+			edit = []string{s}
+		}
+
+		lines = append(lines[:start], append(edit, lines[end+1:]...)...)
+		fixed[imp] = true
+	}
+
+	var rest []*Diagnostic
+	for _, d := range diagnostics {
+		if d.imp == nil || !fixed[d.imp] {
+			rest = append(rest, d)
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), rest
+}
+
+// importLines returns the lines of an import in base 0. It is only fixed
+// if there is nothing else in the lines to not remove other code.
+func importLines(lines []string, imp *ast.ImportStmt) (int, int, bool) {
+	start := imp.Pos.Line - 1
+	if start < 0 || start >= len(lines) || !strings.HasPrefix(strings.TrimSpace(lines[start]), "import") {
+		return 0, 0, false
+	}
+
+	for end := start; end < len(lines); end++ {
+		for _, q := range []string{`"`, "'"} {
+			i := strings.Index(lines[end], q+imp.Path+q)
+			if i == -1 {
+				continue
+			}
+			after := lines[end][i+len(imp.Path)+2:]
+			if strings.Trim(after, " \t\r;") != "" {
+				return 0, 0, false
+			}
+			return start, end, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// importSource writes the import without the unused names or returns
+// an empty string if all of them are unused. last is the last line of
+// the import in the source to keep the quotes and the semicolon.
+func importSource(imp *ast.ImportStmt, unused map[string]bool, last string) string {
+	var parts []string
+
+	if imp.Default != "" && !unused[imp.Default] {
+		parts = append(parts, imp.Default)
+	}
+
+	if imp.Alias != "" && !unused[imp.Alias] {
+		parts = append(parts, "* as "+imp.Alias)
+	}
+
+	var names []*ast.ImportName
+	types := make(map[*ast.ImportName]bool)
+	for _, n := range imp.Names {
+		if !unused[n.Alias] {
+			names = append(names, n)
+		}
+	}
+	for _, n := range imp.TypeNames {
+		if !unused[n.Alias] {
+			names = append(names, n)
+			types[n] = true
+		}
+	}
+
+	if len(names) > 0 {
+		sort.Slice(names, func(i, j int) bool {
+			a, b := names[i].Pos, names[j].Pos
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+
+		list := make([]string, len(names))
+		for i, n := range names {
+			s := n.Name
+			if n.Alias != n.Name {
+				s += " as " + n.Alias
+			}
+			if types[n] && !imp.TypeOnly {
+				s = "type " + s
+			}
+			list[i] = s
+		}
+		parts = append(parts, "{ "+strings.Join(list, ", ")+" }")
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("import ")
+	if imp.TypeOnly {
+		b.WriteString("type ")
+	}
+	b.WriteString(strings.Join(parts, ", "))
+
+	q := `"`
+	if !strings.Contains(last, q+imp.Path+q) {
+		q = "'"
+	}
+	b.WriteString(" from " + q + imp.Path + q)
+
+	end := strings.TrimRight(last, "\r")
+	if strings.HasSuffix(strings.TrimSpace(end), ";") {
+		b.WriteString(";")
+	}
+	if len(end) < len(last) {
+		b.WriteString("\r")
+	}
+
+	return b.String()
+}
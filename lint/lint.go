@@ -0,0 +1,133 @@
+// Package lint implements static checks of the source of a program
+// that are not errors for the compiler but are likely bugs: unused
+// declarations, unreachable code, shadowed identifiers and wrong uses
+// of the native functions.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// The rules that can be configured.
+const (
+	UnusedVariable = "unused-variable"
+	UnusedImport   = "unused-import"
+	Unreachable    = "unreachable"
+	Shadow         = "shadow"
+	UnknownNative  = "unknown-native"
+	NativeArity    = "native-arity"
+	MissingAwait   = "missing-await"
+)
+
+// Rules are the names of the rules with their default severity.
+var Rules = map[string]Severity{
+	UnusedVariable: Warning,
+	UnusedImport:   Warning,
+	Unreachable:    Warning,
+	Shadow:         Warning,
+	UnknownNative:  Error,
+	NativeArity:    Error,
+	MissingAwait:   Warning,
+}
+
+// Severity is how important is a problem. Off disables a rule.
+type Severity int
+
+const (
+	Off Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Off:
+		return "off"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// parseSeverity returns the severity of a name in the configuration.
+func parseSeverity(s string) (Severity, bool) {
+	switch s {
+	case "off":
+		return Off, true
+	case "warning", "warn":
+		return Warning, true
+	case "error":
+		return Error, true
+	}
+	return Off, false
+}
+
+// Diagnostic is a problem found in the source.
+type Diagnostic struct {
+	Pos      ast.Position
+	Rule     string
+	Severity Severity
+	Message  string
+
+	// the unused import that can be removed by Fix
+	imp  *ast.ImportStmt
+	name string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%v: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Fixable returns true if Fix can solve the problem.
+func (d *Diagnostic) Fixable() bool {
+	return d.imp != nil
+}
+
+// MarshalJSON writes the diagnostic with the file, the line and
+// the column where the token ends, both starting at 1.
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File     string `json:"file"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+		Rule     string `json:"rule"`
+		Severity string `json:"severity"`
+		Message  string `json:"message"`
+		Fixable  bool   `json:"fixable"`
+	}{
+		File:     d.Pos.FileName,
+		Line:     d.Pos.Line,
+		Column:   d.Pos.Column + 1,
+		Rule:     d.Rule,
+		Severity: d.Severity.String(),
+		Message:  d.Message,
+		Fixable:  d.Fixable(),
+	})
+}
+
+// Lint checks the main file of a program. defs are definition
+// files like native.d.ts that declare the native functions.
+func Lint(mod *ast.Module, config *Config, defs ...*ast.File) []*Diagnostic {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	l := newLinter(mod, config, defs)
+	l.file(mod.File)
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i].Pos, l.diagnostics[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return l.diagnostics
+}
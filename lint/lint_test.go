@@ -0,0 +1,316 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/filesystem"
+	_ "github.com/scorredoira/dune/lib"
+	"github.com/scorredoira/dune/parser"
+)
+
+func TestUnused(t *testing.T) {
+	assertLint(t, `
+		function main(arg) {
+			let a = 1
+			let b = 2
+			let _c = 3
+			let [d, e] = [1, 2]
+			let { f, ...rest } = { f: 1, g: 2 }
+			let x = 0
+			x = 2
+			return b + e + rest.g
+		}
+	`,
+		":3: a is declared and not used (unused-variable)",
+		":6: d is declared and not used (unused-variable)",
+		":8: x is declared and not used (unused-variable)",
+	)
+}
+
+func TestUnreachable(t *testing.T) {
+	assertLint(t, `
+		function main(a) {
+			if (a) {
+				return 1
+				a++
+			} else if (a > 2) {
+				throw "error"
+			} else {
+				return 2
+			}
+			return 3
+		}
+
+		function loop() {
+			for (let i = 0; i < 10; i++) {
+				throw "stop"
+				print(i)
+			}
+		}
+
+		return new Foo()
+		print(1)
+
+		class Foo {}
+	`,
+		":5: unreachable code (unreachable)",
+		":11: unreachable code (unreachable)",
+		":17: unreachable code (unreachable)",
+		":22: unreachable code (unreachable)",
+	)
+}
+
+func TestShadow(t *testing.T) {
+	assertLint(t, `
+		let a = 1
+
+		function main(b) {
+			let a = 2
+			for (let b of [a]) {
+				print(b)
+			}
+			try {
+				print(a)
+			} catch (e) {
+				let time = e
+				print(time.unix)
+				return (e) => time.now()
+			}
+		}
+	`,
+		":5: a shadows the declaration of line 2 (shadow)",
+		":6: b shadows the declaration of line 4 (shadow)",
+		":12: time hides the native package time used in line 13 (shadow)",
+		":14: e shadows the declaration of line 11 (shadow)",
+	)
+}
+
+func TestNatives(t *testing.T) {
+	assertLint(t, `
+		function main() {
+			let s = strings.repeat("a")
+			strings.foo(s)
+			convert.toInt(...[s])
+			let math = { square: (x) => x * x }
+			return math.square(2) + go(main)
+		}
+	`,
+		":3: strings.repeat expects 2 arguments, got 1 (native-arity)",
+		":4: unknown native function strings.foo (unknown-native)",
+	)
+}
+
+func TestMissingAwait(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/lib.ts", []byte(`
+		export async function save() {}
+		export function load() {}
+	`))
+	fs.WritePath("/main.ts", []byte(`
+		import * as lib from "lib"
+		import { save } from "lib"
+
+		async function handler() {
+			lib.save()
+			lib.load()
+			save()
+			other()
+			Promise.resolve(1)
+			await lib.save()
+			let p = other()
+			await p
+			let r = other()
+			console.log(r.status)
+			let a = save()
+			let b = lib.save()
+			await Promise.all([a, b])
+			let c = other()
+			c.then(() => {})
+			let d = other()
+			return d
+		}
+
+		async function other() {}
+
+		function main() {
+			save()
+			let p = other()
+			console.log(p)
+		}
+	`))
+
+	m, err := parser.Parse(fs, "/main.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiagnostics(t, Lint(m, nil, definitions(t)),
+		"/main.ts:6: the promise returned by lib.save is not awaited (missing-await)",
+		"/main.ts:8: the promise returned by save is not awaited (missing-await)",
+		"/main.ts:9: the promise returned by other is not awaited (missing-await)",
+		"/main.ts:10: the promise returned by Promise.resolve is not awaited (missing-await)",
+		"/main.ts:14: the promise returned by other and stored in r is not awaited (missing-await)",
+	)
+}
+
+func TestMissingAwaitBlocking(t *testing.T) {
+	assertLint(t, `
+		async function load(url) {
+			http.get(url)
+			let r = http.getJSON(url)
+			let b = await http.get(url)
+			await time.sleep(1)
+			return [r, b, strings.isIdent(url)]
+		}
+
+		function handle(w: http.ResponseWriter, r: http.Request) {
+			sql.open("mysql", "")
+			w.write(await http.get(r.url))
+		}
+
+		function main() {
+			let s = http.newServer()
+			s.handler = (w, r) => {
+				time.sleep(1)
+			}
+			http.get("")
+			go(() => http.get(""))
+		}
+	`,
+		":3: the blocking native http.get is not awaited (missing-await)",
+		":4: the blocking native http.getJSON is not awaited (missing-await)",
+		":11: the blocking native sql.open is not awaited (missing-await)",
+		":18: the blocking native time.sleep is not awaited (missing-await)",
+	)
+
+	for name := range blocking {
+		if _, ok := dune.NativeFuncFromName(name); !ok {
+			t.Errorf("unknown native %s", name)
+		}
+	}
+}
+
+func TestFix(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/lib.ts", []byte(`
+		export function a() {}
+		export function b() {}
+		export type T = string
+	`))
+
+	src := `import * as lib from "lib"
+import { a, b as c } from 'lib';
+import type { T } from "lib"
+import def, { type T as U } from "lib"
+
+function main(t: U) {
+    return c()
+}
+`
+	fs.WritePath("/main.ts", []byte(src))
+
+	m, err := parser.Parse(fs, "/main.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := Lint(m, nil)
+	assertDiagnostics(t, diagnostics,
+		"/main.ts:1: lib is imported and not used (unused-import)",
+		"/main.ts:2: a is imported and not used (unused-import)",
+		"/main.ts:3: T is imported and not used (unused-import)",
+		"/main.ts:4: def is imported and not used (unused-import)",
+	)
+
+	b, rest := Fix([]byte(src), diagnostics)
+	if len(rest) != 0 {
+		t.Fatalf("expected all the problems to be fixed, got %v", rest)
+	}
+
+	expected := `import { b as c } from 'lib';
+import { type T as U } from "lib"
+
+function main(t: U) {
+    return c()
+}
+`
+	if string(b) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/tsconfig.json", []byte(`{
+		// the rules
+		"lint": { "shadow": "off", "unreachable": "error" }
+	}`))
+	fs.WritePath("/src/main.ts", []byte(``))
+
+	c, err := ReadConfig(fs, "/src/main.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Rules[Shadow] != Off || c.Rules[Unreachable] != Error || c.Rules[UnusedImport] != Warning {
+		t.Fatalf("invalid rules: %v", c.Rules)
+	}
+
+	fs.WritePath("/src/dune.json", []byte(`{ "lint": { "foo": "off" } }`))
+	if _, err := ReadConfig(fs, "/src/main.ts"); err == nil || !strings.Contains(err.Error(), `invalid lint rule "foo"`) {
+		t.Fatalf("expected an invalid rule error, got %v", err)
+	}
+
+	p, err := parser.ParseStr(`
+		let a = 1
+		function main() {
+			let a = 2
+			return a
+			a++
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiagnostics(t, Lint(p, c),
+		":6: unreachable code (unreachable)",
+	)
+}
+
+func assertLint(t *testing.T, code string, expected ...string) {
+	t.Helper()
+
+	p, err := parser.ParseStr(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiagnostics(t, Lint(p, nil, definitions(t)), expected...)
+}
+
+func assertDiagnostics(t *testing.T, diagnostics []*Diagnostic, expected ...string) {
+	t.Helper()
+
+	var msgs []string
+	for _, d := range diagnostics {
+		msgs = append(msgs, d.Error())
+	}
+
+	if strings.Join(msgs, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(msgs, "\n"))
+	}
+}
+
+func definitions(t *testing.T) *ast.File {
+	t.Helper()
+
+	defs, err := parser.ParseDefinitions("native.d.ts", dune.TypeDefs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return defs
+}
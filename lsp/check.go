@@ -0,0 +1,155 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/checker"
+	"github.com/scorredoira/dune/parser"
+)
+
+// check parses, compiles and type checks a document and publishes the errors.
+func (s *Server) check(d *document) {
+	diagnostics := []diagnostic{}
+
+	m, err := parser.Parse(s.fs, d.path)
+	if err != nil {
+		diagnostics = append(diagnostics, s.diagnostic(d, err, severityError))
+	} else {
+		d.module = m
+		d.symbols = fileSymbols(m.File)
+
+		// compile a new parse to leave the ast of the document untouched
+		if _, err := dune.Compile(s.fs, d.path); err != nil {
+			diagnostics = append(diagnostics, s.diagnostic(d, err, severityError))
+		}
+
+		for _, e := range checker.Check(m, s.definitions()...) {
+			diagnostics = append(diagnostics, s.diagnosticAt(d, e.Pos, e.Message, severityWarning))
+		}
+	}
+
+	diagnostics = append(diagnostics, ignored(d.text)...)
+
+	s.publish(d, diagnostics)
+}
+
+// ignored returns a diagnostic for every //ts:ignore comment of the text.
+func ignored(text string) []diagnostic {
+	var diagnostics []diagnostic
+	for i, line := range strings.Split(text, "\n") {
+		for col := 0; ; col += len("//ts:ignore") {
+			j := strings.Index(line[col:], "//ts:ignore")
+			if j == -1 {
+				break
+			}
+			col += j
+			start := utf16Column(line, col)
+			diagnostics = append(diagnostics, diagnostic{
+				Range:    textRange{position{i, start}, position{i, start + len("//ts:ignore")}},
+				Severity: severityInformation,
+				Source:   "dune",
+				Message:  "the code below //ts:ignore is ignored by dune",
+			})
+		}
+	}
+	return diagnostics
+}
+
+// definitions returns the declarations of the native functions
+// for the type checker. They are parsed the first time.
+func (s *Server) definitions() []*ast.File {
+	if s.defs == nil {
+		defs, err := parser.ParseDefinitions("native.d.ts", dune.TypeDefs())
+		if err != nil {
+			return nil
+		}
+		s.defs = defs
+	}
+	return []*ast.File{s.defs}
+}
+
+// positionError is implemented by the errors of the lexer, parser and compiler.
+type positionError interface {
+	Position() ast.Position
+}
+
+func (s *Server) diagnostic(d *document, err error, severity int) diagnostic {
+	e, ok := err.(positionError)
+	if !ok {
+		return diagnostic{Severity: severity, Source: "dune", Message: err.Error()}
+	}
+
+	msg := err.Error()
+	if m, ok := err.(interface{ Message() string }); ok {
+		msg = m.Message()
+	}
+
+	return s.diagnosticAt(d, e.Position(), msg, severity)
+}
+
+// diagnosticAt returns a diagnostic for the word at pos. The errors
+// in other files are shown at the start of the document.
+func (s *Server) diagnosticAt(d *document, pos ast.Position, msg string, severity int) diagnostic {
+	if pos.FileName != "" && pos.FileName != d.path {
+		return diagnostic{
+			Severity: severity,
+			Source:   "dune",
+			Message:  fmt.Sprintf("%s: %s", pos, msg),
+		}
+	}
+
+	return diagnostic{
+		Range:    wordRange(d.text, pos),
+		Severity: severity,
+		Source:   "dune",
+		Message:  msg,
+	}
+}
+
+// wordRange returns the range of the identifier at pos or a single character.
+// The positions of the tokens are the last character, with the column in base 0
+// counted in bytes.
+func wordRange(text string, pos ast.Position) textRange {
+	line := pos.Line - 1
+	if line < 0 {
+		return textRange{}
+	}
+
+	lines := strings.Split(text, "\n")
+	if line >= len(lines) {
+		return textRange{position{line, 0}, position{line, 0}}
+	}
+
+	str := lines[line]
+	col := pos.Column
+	if col > len(str) {
+		col = len(str)
+	}
+	if col < 0 {
+		col = 0
+	}
+
+	start, end := col, col
+	for start > 0 && isIdent(str[start-1]) {
+		start--
+	}
+	for end < len(str) && isIdent(str[end]) {
+		end++
+	}
+
+	if start == end {
+		end = start + 1
+	}
+
+	return textRange{position{line, utf16Column(str, start)}, position{line, utf16Column(str, end)}}
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' ||
+		c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9'
+}
@@ -0,0 +1,515 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/filesystem"
+)
+
+// reference is the identifier at a position of a document.
+type reference struct {
+	name      string
+	qualifier string // the expression before the dot: qualifier.name
+	pos       ast.Position
+	rng       textRange
+}
+
+// referenceAt returns the identifier at p. If partial is true it only
+// includes the characters before p, the part typed for completion.
+func referenceAt(text string, p position, partial bool) reference {
+	lines := strings.Split(text, "\n")
+	if p.Line < 0 || p.Line >= len(lines) {
+		return reference{}
+	}
+
+	line := lines[p.Line]
+	col := byteColumn(line, p.Character)
+
+	start, end := col, col
+	for start > 0 && isIdent(line[start-1]) {
+		start--
+	}
+	if !partial {
+		for end < len(line) && isIdent(line[end]) {
+			end++
+		}
+	}
+
+	ref := reference{
+		name: line[start:end],
+		pos:  ast.Position{Line: p.Line + 1, Column: col},
+		rng:  textRange{position{p.Line, utf16Column(line, start)}, position{p.Line, utf16Column(line, end)}},
+	}
+
+	if start > 0 && line[start-1] == '.' {
+		q := start - 1
+		for q > 0 && (isIdent(line[q-1]) || line[q-1] == '.') {
+			q--
+		}
+		ref.qualifier = line[q : start-1]
+	}
+
+	return ref
+}
+
+// target is what a reference points to.
+type target struct {
+	path   string
+	sym    *symbol
+	module *ast.File // a module imported with an alias
+	native string    // a native function or namespace
+}
+
+func (s *Server) resolve(d *document, ref reference) *target {
+	if d.symbols == nil || ref.name == "" {
+		return nil
+	}
+
+	file := d.module.File
+
+	if q := ref.qualifier; q != "" {
+		if q == "this" {
+			if sym := d.symbols.member("", ref.name); sym != nil {
+				return &target{path: d.path, sym: sym}
+			}
+			return nil
+		}
+
+		if imp := importAlias(file, q); imp != nil {
+			mod := d.module.Modules[imp.AbsPath]
+			if mod == nil {
+				return nil
+			}
+			if sym := fileSymbols(mod).global(ref.name); sym != nil && sym.exported {
+				return &target{path: mod.Path, sym: sym}
+			}
+			return nil
+		}
+
+		// a static member of a class
+		if sym := d.symbols.member(q, ref.name); sym != nil {
+			return &target{path: d.path, sym: sym}
+		}
+
+		if name := q + "." + ref.name; isNative(name) {
+			return &target{native: name}
+		}
+
+		return nil
+	}
+
+	if sym := d.symbols.lookup(ref.name, ref.pos); sym != nil {
+		return &target{path: d.path, sym: sym}
+	}
+
+	for _, imp := range file.Imports {
+		mod := d.module.Modules[imp.AbsPath]
+		if mod == nil {
+			continue
+		}
+
+		if imp.Alias == ref.name {
+			return &target{path: mod.Path, module: mod}
+		}
+
+		name := ""
+		if imp.Default == ref.name {
+			name = mod.Default
+		}
+		for _, n := range imp.Names {
+			if n.Alias == ref.name || n.Alias == "" && n.Name == ref.name {
+				name = n.Name
+			}
+		}
+
+		if name != "" {
+			if sym := fileSymbols(mod).global(name); sym != nil {
+				return &target{path: mod.Path, sym: sym}
+			}
+		}
+	}
+
+	if isNative(ref.name) {
+		return &target{native: ref.name}
+	}
+
+	return nil
+}
+
+func importAlias(file *ast.File, alias string) *ast.ImportStmt {
+	for _, imp := range file.Imports {
+		if imp.Alias == alias {
+			return imp
+		}
+	}
+	return nil
+}
+
+// isNative returns true if name is a native function or namespace.
+func isNative(name string) bool {
+	for _, f := range dune.All() {
+		if f.Name == name || strings.HasPrefix(f.Name, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) definition(p textDocumentPositionParams) *location {
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	t := s.resolve(d, referenceAt(d.text, p.Position, false))
+	if t == nil || t.path == "" {
+		return nil
+	}
+
+	loc := &location{URI: pathToURI(t.path)}
+	if t.sym != nil {
+		loc.Range = s.nameRange(t.path, t.sym)
+	}
+
+	return loc
+}
+
+// nameRange returns the range of the name in the line of the declaration.
+func (s *Server) nameRange(path string, sym *symbol) textRange {
+	text := s.source(path)
+	lines := strings.Split(text, "\n")
+	line := sym.pos.Line - 1
+
+	if line >= 0 && line < len(lines) {
+		str := lines[line]
+		for i := 0; i+len(sym.name) <= len(str); i++ {
+			if !strings.HasPrefix(str[i:], sym.name) {
+				continue
+			}
+			end := i + len(sym.name)
+			if (i == 0 || !isIdent(str[i-1])) && (end == len(str) || !isIdent(str[end])) {
+				return textRange{position{line, utf16Column(str, i)}, position{line, utf16Column(str, end)}}
+			}
+		}
+	}
+
+	return wordRange(text, sym.pos)
+}
+
+// source returns the text of an open document or the file.
+func (s *Server) source(path string) string {
+	for _, d := range s.docs {
+		if d.path == path {
+			return d.text
+		}
+	}
+
+	b, err := filesystem.ReadAll(s.fs, path)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func (s *Server) hover(p textDocumentPositionParams) *hover {
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+
+	ref := referenceAt(d.text, p.Position, false)
+
+	t := s.resolve(d, ref)
+	if t == nil {
+		return nil
+	}
+
+	var signature, doc string
+
+	switch {
+	case t.native != "":
+		signature = s.nativeSignature(t.native)
+	case t.module != nil:
+		signature = "(module) " + t.path
+	default:
+		signature, doc = describe(t.sym)
+	}
+
+	value := "```typescript\n" + signature + "\n```"
+	if doc != "" {
+		value += "\n\n" + doc
+	}
+
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: value},
+		Range:    &ref.rng,
+	}
+}
+
+// describe returns the signature and the documentation of a declaration.
+func describe(sym *symbol) (string, string) {
+	switch t := sym.node.(type) {
+	case *ast.FuncDeclStmt:
+		var b strings.Builder
+		if sym.class != "" {
+			b.WriteString("(method) " + sym.class + ".")
+		} else {
+			if t.Async {
+				b.WriteString("async ")
+			}
+			b.WriteString("function ")
+		}
+		b.WriteString(t.Name)
+		writeArguments(&b, t.Args, t.Variadic)
+		return b.String(), commentText(t.Comment)
+
+	case *ast.ClassDeclStmt:
+		return "class " + t.Name, ""
+
+	case *ast.EnumDeclStmt:
+		return "enum " + t.Name, ""
+
+	case *ast.InterfaceDeclStmt:
+		return "interface " + t.Name, ""
+
+	case *ast.TypeAliasStmt:
+		return "type " + t.Name, ""
+
+	case *ast.Field:
+		return "(parameter) " + sym.name, ""
+
+	case *ast.VarDeclStmt:
+		if sym.class != "" {
+			return "(property) " + sym.class + "." + sym.name, ""
+		}
+		if t.Const {
+			return "const " + sym.name, ""
+		}
+		return "let " + sym.name, ""
+	}
+
+	return sym.name, ""
+}
+
+func writeArguments(b *strings.Builder, args *ast.Arguments, variadic bool) {
+	b.WriteByte('(')
+	if args != nil {
+		for i, f := range args.List {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if variadic && i == len(args.List)-1 {
+				b.WriteString("...")
+			}
+			if f.Pattern != nil {
+				b.WriteString("{...}")
+			} else {
+				b.WriteString(f.Name)
+			}
+			if f.Optional {
+				b.WriteByte('?')
+			}
+		}
+	}
+	b.WriteByte(')')
+}
+
+// commentText removes the decoration of a doc comment.
+func commentText(c *ast.Comment) string {
+	if c == nil {
+		return ""
+	}
+
+	var lines []string
+	for _, l := range strings.Split(c.Str, "\n") {
+		l = strings.TrimSpace(l)
+		if c.MultiLine {
+			l = strings.TrimSpace(strings.TrimLeft(l, "*"))
+		}
+		lines = append(lines, l)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// nativeSignature returns the declaration of a native function in native.d.ts.
+func (s *Server) nativeSignature(name string) string {
+	defs := s.definitions()
+	if len(defs) == 0 {
+		return name
+	}
+
+	parts := strings.Split(name, ".")
+	decls := defs[0].Types
+
+	for i, part := range parts {
+		last := i == len(parts)-1
+		var next []ast.Stmt
+
+		for _, st := range decls {
+			switch t := st.(type) {
+			case *ast.NamespaceDecl:
+				if t.Name != part {
+					continue
+				}
+				if last {
+					return "namespace " + name
+				}
+				next = append(next, t.Decls...)
+
+			case *ast.DeclareStmt:
+				if t.Name == part && last {
+					return declarationLine(t.Pos.Line, parts[:i])
+				}
+			}
+		}
+
+		decls = next
+	}
+
+	return name
+}
+
+// declarationLine returns a line of native.d.ts qualified with the namespace.
+func declarationLine(line int, namespace []string) string {
+	lines := strings.Split(dune.TypeDefs(), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	str := strings.TrimSpace(lines[line-1])
+	str = strings.TrimPrefix(str, "export ")
+	str = strings.TrimPrefix(str, "declare ")
+
+	if len(namespace) > 0 {
+		for _, kw := range []string{"function ", "const ", "let ", "var "} {
+			if strings.HasPrefix(str, kw) {
+				return kw + strings.Join(namespace, ".") + "." + strings.TrimPrefix(str, kw)
+			}
+		}
+	}
+
+	return str
+}
+
+func (s *Server) completion(p textDocumentPositionParams) *completionList {
+	list := &completionList{Items: []completionItem{}}
+
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return list
+	}
+
+	ref := referenceAt(d.text, p.Position, true)
+	seen := make(map[string]bool)
+
+	add := func(label string, kind int, detail string) {
+		if seen[label] || !strings.HasPrefix(label, ref.name) {
+			return
+		}
+		seen[label] = true
+		list.Items = append(list.Items, completionItem{Label: label, Kind: kind, Detail: detail})
+	}
+
+	if q := ref.qualifier; q != "" {
+		if d.symbols != nil {
+			if imp := importAlias(d.module.File, q); imp != nil {
+				if mod := d.module.Modules[imp.AbsPath]; mod != nil {
+					for _, sym := range fileSymbols(mod).list {
+						if sym.scope == nil && sym.exported {
+							add(sym.name, sym.kind, "")
+						}
+					}
+				}
+				return list
+			}
+
+			for _, sym := range d.symbols.members {
+				if q == "this" || sym.class == q {
+					add(sym.name, sym.kind, sym.class)
+				}
+			}
+		}
+
+		for _, name := range nativeNames(q + ".") {
+			add(name, kindFunction, q+"."+name)
+		}
+
+		return list
+	}
+
+	if d.symbols != nil {
+		for _, sym := range d.symbols.visible(ref.pos) {
+			add(sym.name, sym.kind, "")
+		}
+
+		for _, imp := range d.module.File.Imports {
+			if imp.Alias != "" {
+				add(imp.Alias, kindModule, imp.Path)
+			}
+			if imp.Default != "" {
+				add(imp.Default, kindVariable, imp.Path)
+			}
+			for _, n := range imp.Names {
+				if n.Alias != "" {
+					add(n.Alias, kindVariable, imp.Path)
+				} else {
+					add(n.Name, kindVariable, imp.Path)
+				}
+			}
+		}
+	}
+
+	for _, name := range nativeNames("") {
+		kind := kindFunction
+		if isNamespace(name) {
+			kind = kindModule
+		}
+		add(name, kind, "")
+	}
+
+	return list
+}
+
+// nativeNames returns the next part of the names of the
+// native functions that start with prefix, sorted.
+func nativeNames(prefix string) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, f := range dune.All() {
+		// skip properties and methods of the native types
+		if strings.HasPrefix(f.Name, "->") || strings.Contains(f.Name, ".prototype.") {
+			continue
+		}
+
+		if !strings.HasPrefix(f.Name, prefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(f.Name, prefix)
+		if i := strings.IndexByte(name, '.'); i != -1 {
+			name = name[:i]
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func isNamespace(name string) bool {
+	for _, f := range dune.All() {
+		if strings.HasPrefix(f.Name, name+".") {
+			return true
+		}
+	}
+	return false
+}
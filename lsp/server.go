@@ -0,0 +1,288 @@
+// Package lsp serves the Language Server Protocol so editors can
+// show the errors of Dune programs, navigate and complete the code.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/scorredoira/dune"
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/filesystem"
+)
+
+// Server answers the requests of an editor about the programs in a filesystem.
+type Server struct {
+	fs   *overlay
+	out  io.Writer
+	mu   sync.Mutex // protects writes to out
+	docs map[string]*document
+	defs *ast.File // the declarations of native.d.ts
+}
+
+// document is a file open in the editor.
+type document struct {
+	uri     string
+	path    string
+	text    string
+	module  *ast.Module // the last version parsed without errors
+	symbols *symbols
+}
+
+// NewServer returns a server for the programs in fs. The
+// documents open in the editor are read from memory.
+func NewServer(fs filesystem.FS) *Server {
+	return &Server{
+		fs:   &overlay{FS: fs, docs: filesystem.NewMemFS()},
+		docs: make(map[string]*document),
+	}
+}
+
+// Serve reads requests until the client exits.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	in := bufio.NewReader(r)
+
+	for {
+		m, err := readMessage(in)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if m.Method == "" {
+			// a response to a request of the server
+			continue
+		}
+
+		result, err := s.handle(m)
+
+		if len(m.ID) > 0 {
+			s.respond(m, result, err)
+		}
+
+		if m.Method == "exit" {
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(m *message) (interface{}, error) {
+	switch m.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:   syncFull,
+				DefinitionProvider: true,
+				HoverProvider:      true,
+				CompletionProvider: &completionOptions{TriggerCharacters: []string{"."}},
+			},
+			ServerInfo: serverInfo{Name: "dune", Version: dune.VERSION},
+		}, nil
+
+	case "initialized", "shutdown", "exit":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		s.open(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		// the changes are the full text of the document
+		if n := len(p.ContentChanges); n > 0 {
+			s.open(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didSave":
+		var p didSaveParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		if d, ok := s.docs[p.TextDocument.URI]; ok && p.Text != nil {
+			s.open(d.uri, *p.Text)
+		}
+		// other documents can import the saved one
+		for _, d := range s.docs {
+			if d.uri != p.TextDocument.URI {
+				s.check(d)
+			}
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		s.close(p.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.definition(p), nil
+
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.hover(p), nil
+
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if err := unmarshal(m.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.completion(p), nil
+	}
+
+	if len(m.ID) == 0 {
+		// unknown notifications are ignored
+		return nil, nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: "unsupported method " + m.Method}
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func unmarshal(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// open updates the text of a document and publishes its diagnostics.
+func (s *Server) open(uri, text string) {
+	d, ok := s.docs[uri]
+	if !ok {
+		d = &document{uri: uri, path: uriToPath(uri)}
+		s.docs[uri] = d
+	}
+
+	d.text = text
+
+	if err := s.fs.docs.WritePath(d.path, []byte(text)); err != nil {
+		s.publish(d, []diagnostic{{Severity: severityError, Source: "dune", Message: err.Error()}})
+		return
+	}
+
+	s.check(d)
+}
+
+func (s *Server) close(uri string) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return
+	}
+
+	delete(s.docs, uri)
+	s.fs.docs.RemoveAll(d.path)
+	s.publish(d, []diagnostic{})
+}
+
+func (s *Server) publish(d *document, diagnostics []diagnostic) {
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         d.uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) respond(m *message, result interface{}, err error) {
+	r := response{JSONRPC: "2.0", ID: m.ID, Result: result}
+
+	if err != nil {
+		e, ok := err.(*responseError)
+		if !ok {
+			e = &responseError{Code: codeInternalError, Message: err.Error()}
+		}
+		r.Error = e
+		r.Result = nil
+	}
+
+	s.write(&r)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the client is gone if it fails so there is nothing to do
+	writeMessage(s.out, v)
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
+
+// overlay reads the documents open in the editor from memory
+// and the rest of the files from the filesystem.
+type overlay struct {
+	filesystem.FS
+	docs *filesystem.MemFS
+}
+
+func (o *overlay) isOpen(name string) (string, bool) {
+	abs, err := o.FS.Abs(name)
+	if err != nil {
+		return "", false
+	}
+	fi, err := o.docs.Stat(abs)
+	return abs, err == nil && !fi.IsDir()
+}
+
+func (o *overlay) Open(name string) (filesystem.File, error) {
+	if abs, ok := o.isOpen(name); ok {
+		return o.docs.Open(abs)
+	}
+	return o.FS.Open(name)
+}
+
+func (o *overlay) OpenIfExists(name string) (filesystem.File, error) {
+	if abs, ok := o.isOpen(name); ok {
+		return o.docs.Open(abs)
+	}
+	return o.FS.OpenIfExists(name)
+}
+
+func (o *overlay) Stat(name string) (os.FileInfo, error) {
+	if abs, ok := o.isOpen(name); ok {
+		return o.docs.Stat(abs)
+	}
+	return o.FS.Stat(name)
+}
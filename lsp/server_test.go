@@ -0,0 +1,232 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scorredoira/dune/ast"
+	"github.com/scorredoira/dune/filesystem"
+	_ "github.com/scorredoira/dune/lib"
+)
+
+func TestServer(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/lib.ts", []byte(`// Sum returns
+// the sum of a and b.
+export function sum(a, b) {
+	return a + b
+}
+`))
+
+	main := `import * as lib from "lib"
+
+function main() {
+	let x = lib.sum(1, 2)
+	return x + strings.equalFold("a", "b")
+}
+`
+
+	c := &client{}
+	c.request("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": "file:///main.ts", "text": main},
+	})
+	c.request("textDocument/definition", c.position(3, 14))
+	c.request("textDocument/hover", c.position(3, 14))
+	c.request("textDocument/hover", c.position(4, 8))
+	c.request("textDocument/hover", c.position(4, 22))
+	c.request("textDocument/completion", c.position(3, 13))
+	c.request("textDocument/completion", c.position(4, 14))
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": "file:///main.ts"},
+		"contentChanges": []interface{}{map[string]interface{}{"text": "function main() {\n\tlet\n}\n"}},
+	})
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+
+	var out bytes.Buffer
+	if err := NewServer(fs).Serve(&c.buf, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := readAll(t, &out)
+
+	var diagnostics []publishDiagnosticsParams
+	results := make(map[int]json.RawMessage)
+
+	for _, m := range msgs {
+		if m.Method == "textDocument/publishDiagnostics" {
+			var p publishDiagnosticsParams
+			if err := json.Unmarshal(m.Params, &p); err != nil {
+				t.Fatal(err)
+			}
+			diagnostics = append(diagnostics, p)
+			continue
+		}
+		var id int
+		json.Unmarshal(m.ID, &id)
+		if m.Error != nil {
+			t.Fatalf("request %d failed: %s", id, m.Error.Message)
+		}
+		results[id] = m.Result
+	}
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diagnostics)
+	}
+
+	for _, d := range diagnostics[0].Diagnostics {
+		if d.Severity == severityError {
+			t.Fatalf("unexpected error %v", d)
+		}
+	}
+
+	if d := diagnostics[1].Diagnostics; len(d) != 1 || d[0].Severity != severityError || d[0].Range.Start.Line != 2 {
+		t.Fatalf("expected an error in line 2, got %v", d)
+	}
+
+	var loc location
+	decode(t, results[2], &loc)
+	if loc.URI != "file:///lib.ts" || loc.Range.Start != (position{2, 16}) {
+		t.Fatalf("unexpected definition %v", loc)
+	}
+
+	var h hover
+	decode(t, results[3], &h)
+	if !strings.Contains(h.Contents.Value, "function sum(a, b)") ||
+		!strings.Contains(h.Contents.Value, "Sum returns\nthe sum of a and b.") {
+		t.Fatalf("unexpected hover %q", h.Contents.Value)
+	}
+
+	decode(t, results[4], &h)
+	if !strings.Contains(h.Contents.Value, "let x") {
+		t.Fatalf("unexpected hover %q", h.Contents.Value)
+	}
+
+	decode(t, results[5], &h)
+	if !strings.Contains(h.Contents.Value, "function strings.equalFold(a: string, b: string): boolean") {
+		t.Fatalf("unexpected hover %q", h.Contents.Value)
+	}
+
+	var list completionList
+	decode(t, results[6], &list)
+	if len(list.Items) != 1 || list.Items[0].Label != "sum" {
+		t.Fatalf("unexpected completion %v", list.Items)
+	}
+
+	decode(t, results[7], &list)
+	labels := make(map[string]bool)
+	for _, item := range list.Items {
+		labels[item.Label] = true
+	}
+	if !labels["strings"] || labels["main"] {
+		t.Fatalf("unexpected completion %v", list.Items)
+	}
+}
+
+type client struct {
+	buf bytes.Buffer
+	id  int
+}
+
+func (c *client) request(method string, params interface{}) {
+	c.id++
+	writeMessage(&c.buf, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.id,
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (c *client) notify(method string, params interface{}) {
+	writeMessage(&c.buf, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (c *client) position(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": "file:///main.ts"},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+type serverMessage struct {
+	ID     json.RawMessage
+	Method string
+	Params json.RawMessage
+	Result json.RawMessage
+	Error  *responseError
+}
+
+func readAll(t *testing.T, out *bytes.Buffer) []serverMessage {
+	var msgs []serverMessage
+	r := bufio.NewReader(out)
+
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err != nil {
+			return msgs
+		}
+
+		n, _ := strconv.Atoi(header.Get("Content-Length"))
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+
+		var m serverMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func decode(t *testing.T, data json.RawMessage, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+}
+
+func TestUTF16Columns(t *testing.T) {
+	text := "let s = \"ñ😀\" + foo.bar // ts\n\t/* é */ //ts:ignore //ts:ignore"
+
+	// the lexer columns are the last byte of the token
+	r := wordRange(text, ast.Position{Line: 1, Column: strings.Index(text, "foo") + 2})
+	if r != (textRange{position{0, 16}, position{0, 19}}) {
+		t.Fatalf("unexpected range %v", r)
+	}
+
+	ref := referenceAt(text, position{0, 21}, false)
+	if ref.name != "bar" || ref.qualifier != "foo" || ref.pos.Column != strings.Index(text, "bar")+1 {
+		t.Fatalf("unexpected reference %+v", ref)
+	}
+	if ref.rng != (textRange{position{0, 20}, position{0, 23}}) {
+		t.Fatalf("unexpected range %v", ref.rng)
+	}
+
+	var ranges []textRange
+	for _, d := range ignored(text) {
+		ranges = append(ranges, d.Range)
+	}
+	expected := []textRange{
+		{position{1, 9}, position{1, 20}},
+		{position{1, 21}, position{1, 32}},
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("unexpected ranges %v", ranges)
+	}
+}
@@ -0,0 +1,369 @@
+package lsp
+
+import (
+	"github.com/scorredoira/dune/ast"
+)
+
+// symbol is a declaration in a source file.
+type symbol struct {
+	name     string
+	kind     int
+	pos      ast.Position
+	node     interface{} // the declaration
+	scope    *scope      // nil for the declarations of the file
+	class    string      // the class of a member
+	exported bool
+}
+
+// scope is the range of a block where a declaration is visible.
+type scope struct {
+	start ast.Position
+	end   ast.Position
+}
+
+func (s *scope) contains(pos ast.Position) bool {
+	return !before(pos, s.start) && !before(s.end, pos)
+}
+
+func before(a, b ast.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// symbols are the declarations of a file.
+type symbols struct {
+	list    []*symbol
+	members []*symbol // fields and methods of the classes
+}
+
+func fileSymbols(f *ast.File) *symbols {
+	s := &symbols{}
+	s.stmts(f.Stms, nil)
+	s.stmts(f.Types, nil)
+	return s
+}
+
+// lookup returns the declaration of name that is visible at pos.
+// The inner scopes shadow the outer ones.
+func (s *symbols) lookup(name string, pos ast.Position) *symbol {
+	var found *symbol
+
+	for _, sym := range s.list {
+		if sym.name != name || !sym.visible(pos) {
+			continue
+		}
+		if found == nil || sym.shadows(found) {
+			found = sym
+		}
+	}
+
+	return found
+}
+
+// visible returns the declarations that are visible at pos.
+func (s *symbols) visible(pos ast.Position) []*symbol {
+	var result []*symbol
+	seen := make(map[string]bool)
+
+	for _, sym := range s.list {
+		if seen[sym.name] || !sym.visible(pos) {
+			continue
+		}
+		seen[sym.name] = true
+		result = append(result, s.lookup(sym.name, pos))
+	}
+
+	return result
+}
+
+// global returns the declaration of name in the top level of the file.
+func (s *symbols) global(name string) *symbol {
+	for _, sym := range s.list {
+		if sym.scope == nil && sym.name == name {
+			return sym
+		}
+	}
+	return nil
+}
+
+// member returns a field or method of a class. Without a class
+// it returns the first member with that name in the file.
+func (s *symbols) member(class, name string) *symbol {
+	for _, sym := range s.members {
+		if sym.name == name && (class == "" || sym.class == class) {
+			return sym
+		}
+	}
+	return nil
+}
+
+func (s *symbol) visible(pos ast.Position) bool {
+	if s.scope == nil {
+		return true
+	}
+
+	if !s.scope.contains(pos) {
+		return false
+	}
+
+	switch s.kind {
+	case kindFunction, kindClass:
+		// they can be used before the declaration
+		return true
+	}
+
+	return s.pos.Line <= pos.Line
+}
+
+// shadows returns true if s is declared in a scope inside other's.
+func (s *symbol) shadows(other *symbol) bool {
+	if s.scope == nil {
+		return false
+	}
+	if other.scope == nil {
+		return true
+	}
+	if s.scope.start != other.scope.start {
+		return before(other.scope.start, s.scope.start)
+	}
+	return before(other.pos, s.pos)
+}
+
+func (s *symbols) add(name string, kind int, pos ast.Position, node interface{}, sc *scope, exported bool) {
+	if name == "" {
+		return
+	}
+	s.list = append(s.list, &symbol{
+		name:     name,
+		kind:     kind,
+		pos:      pos,
+		node:     node,
+		scope:    sc,
+		exported: exported,
+	})
+}
+
+func (s *symbols) stmts(list []ast.Stmt, sc *scope) {
+	for _, st := range list {
+		s.stmt(st, sc)
+	}
+}
+
+func (s *symbols) stmt(st ast.Stmt, sc *scope) {
+	switch t := st.(type) {
+	case *ast.FuncDeclStmt:
+		s.add(t.Name, kindFunction, t.Pos, t, sc, t.Exported)
+		s.function(t.Args, t.Body)
+
+	case *ast.ClassDeclStmt:
+		s.add(t.Name, kindClass, t.Pos, t, sc, t.Exported)
+		for _, f := range t.Fields {
+			s.members = append(s.members, &symbol{name: f.Name, kind: kindField, pos: f.Pos, node: f, class: t.Name})
+			s.expr(f.Value, sc)
+		}
+		for _, f := range t.Functions {
+			s.members = append(s.members, &symbol{name: f.Name, kind: kindMethod, pos: f.Pos, node: f, class: t.Name})
+			s.function(f.Args, f.Body)
+		}
+
+	case *ast.VarDeclStmt:
+		kind := kindVariable
+		if t.Const {
+			kind = kindConstant
+		}
+		if t.Pattern != nil {
+			s.pattern(t.Pattern, kind, t, sc)
+		} else {
+			s.add(t.Name, kind, t.Pos, t, sc, t.Exported)
+		}
+		s.expr(t.Value, sc)
+
+	case *ast.EnumDeclStmt:
+		s.add(t.Name, kindEnum, t.Pos, t, sc, t.Exported)
+
+	case *ast.InterfaceDeclStmt:
+		s.add(t.Name, kindInterface, t.Pos, t, sc, t.Exported)
+
+	case *ast.TypeAliasStmt:
+		s.add(t.Name, kindInterface, t.Pos, t, sc, t.Exported)
+
+	case *ast.BlockStmt:
+		s.block(t)
+
+	case *ast.IfStmt:
+		for _, b := range t.IfBlocks {
+			s.expr(b.Condition, sc)
+			s.block(b.Body)
+		}
+		s.block(t.Else)
+
+	case *ast.WhileStmt:
+		s.expr(t.Expression, sc)
+		s.block(t.Body)
+
+	case *ast.ForStmt:
+		// the declarations are visible from the start of the loop
+		inner := sc
+		if t.Body != nil {
+			inner = &scope{t.Pos, t.Body.Rbrace}
+		}
+		s.stmts(t.Declaration, inner)
+		s.expr(t.Expression, inner)
+		if t.Step != nil {
+			s.stmt(t.Step, inner)
+		}
+		s.expr(t.InExpression, inner)
+		s.expr(t.OfExpression, inner)
+		s.block(t.Body)
+
+	case *ast.SwitchStmt:
+		s.expr(t.Expression, sc)
+		for _, b := range t.Blocks {
+			s.expr(b.Expression, sc)
+			s.stmts(b.Stmts, sc)
+		}
+		if t.Default != nil {
+			s.stmts(t.Default.Stmts, sc)
+		}
+
+	case *ast.TryStmt:
+		s.block(t.Body)
+		if t.CatchIdent != nil && t.Catch != nil {
+			s.stmt(t.CatchIdent, blockScope(t.Catch))
+		}
+		s.block(t.Catch)
+		s.block(t.Finally)
+
+	case *ast.AsignStmt:
+		s.expr(t.Left, sc)
+		s.expr(t.Value, sc)
+
+	case *ast.IndexAsignStmt:
+		s.expr(t.IndexExpr, sc)
+		s.expr(t.Value, sc)
+
+	case *ast.IncStmt:
+		s.expr(t.Left, sc)
+
+	case *ast.CallStmt:
+		s.expr(t.CallExpr, sc)
+
+	case *ast.AwaitStmt:
+		s.expr(t.AwaitExpr, sc)
+
+	case *ast.YieldStmt:
+		s.expr(t.YieldExpr, sc)
+
+	case *ast.TailCallStmt:
+		s.expr(t.CallExpr, sc)
+
+	case *ast.ReturnStmt:
+		s.expr(t.Value, sc)
+
+	case *ast.ThrowStmt:
+		s.expr(t.Value, sc)
+	}
+}
+
+func blockScope(b *ast.BlockStmt) *scope {
+	return &scope{b.Lbrace, b.Rbrace}
+}
+
+func (s *symbols) block(b *ast.BlockStmt) {
+	if b == nil {
+		return
+	}
+	s.stmts(b.List, blockScope(b))
+}
+
+// function declares the arguments in the scope of the body. It starts
+// in the opening parenthesis to include the arguments.
+func (s *symbols) function(args *ast.Arguments, body *ast.BlockStmt) {
+	if body == nil {
+		return
+	}
+
+	sc := blockScope(body)
+
+	if args != nil {
+		sc.start = args.Opening
+		for _, f := range args.List {
+			if f.Pattern != nil {
+				s.pattern(f.Pattern, kindVariable, f, sc)
+			} else {
+				s.add(f.Name, kindVariable, f.Pos, f, sc, false)
+			}
+			s.expr(f.Default, sc)
+		}
+	}
+
+	s.stmts(body.List, sc)
+}
+
+func (s *symbols) pattern(p *ast.PatternExpr, kind int, node interface{}, sc *scope) {
+	for _, e := range p.Elements {
+		switch t := e.Target.(type) {
+		case *ast.IdentExpr:
+			s.add(t.Name, kind, t.Pos, node, sc, false)
+		case *ast.PatternExpr:
+			s.pattern(t, kind, node, sc)
+		}
+		s.expr(e.Default, sc)
+	}
+}
+
+func (s *symbols) exprs(list []ast.Expr, sc *scope) {
+	for _, e := range list {
+		s.expr(e, sc)
+	}
+}
+
+// expr looks for functions declared in expressions.
+func (s *symbols) expr(e ast.Expr, sc *scope) {
+	switch t := e.(type) {
+	case *ast.FuncDeclExpr:
+		s.function(t.Args, t.Body)
+	case *ast.UnaryExpr:
+		s.expr(t.Operand, sc)
+	case *ast.BinaryExpr:
+		s.expr(t.Left, sc)
+		s.expr(t.Right, sc)
+	case *ast.TernaryExpr:
+		s.expr(t.Condition, sc)
+		s.expr(t.Left, sc)
+		s.expr(t.Right, sc)
+	case *ast.NewInstanceExpr:
+		s.expr(t.Name, sc)
+		s.exprs(t.Args, sc)
+	case *ast.CallExpr:
+		s.expr(t.Ident, sc)
+		s.exprs(t.Args, sc)
+	case *ast.AwaitExpr:
+		s.expr(t.X, sc)
+	case *ast.YieldExpr:
+		s.expr(t.X, sc)
+	case *ast.AsExpr:
+		s.expr(t.X, sc)
+	case *ast.TypeofExpr:
+		s.expr(t.Expr, sc)
+	case *ast.SelectorExpr:
+		s.expr(t.X, sc)
+	case *ast.IndexExpr:
+		s.expr(t.Left, sc)
+		s.expr(t.Index, sc)
+	case *ast.SpreadExpr:
+		s.expr(t.X, sc)
+	case *ast.MapDeclExpr:
+		for _, kv := range t.List {
+			s.expr(kv.Value, sc)
+		}
+	case *ast.ArrayDeclExpr:
+		s.exprs(t.List, sc)
+	case *ast.TemplateExpr:
+		s.expr(t.Tag, sc)
+		s.exprs(t.Values, sc)
+	case *ast.PatternExpr:
+		for _, el := range t.Elements {
+			s.expr(el.Default, sc)
+		}
+	}
+}
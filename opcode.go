@@ -3,6 +3,7 @@ package dune
 import (
 	"fmt"
 	"io"
+	"math"
 )
 
 type Opcode byte
@@ -38,7 +39,6 @@ const (
 	op_get               // get array index or map key: A dest, B source C index or key
 	op_gto               // get optional chaining: A dest, B source C index or key. Reg0 stores the PC to jump if B is null.
 	op_set               // set array index or map key: A array or Map, B index or key, C value
-	op_spa               // spread last index of array A
 	op_jmp               // jump A positions
 	op_jpb               // jump back A positions
 	op_ejp               // jump if A and B are equal C instructions.
@@ -64,6 +64,19 @@ const (
 	op_fen               // finally-end: set the last finally body as ended.
 	op_trx               // try exit: a continue inside try/catch inside a loop for example
 	op_del               // delete object property
+	op_dst               // destructure: A dest, B source C index or key. Indexes out of range are undefined.
+	op_rst               // destructure the rest: A dest, B source C start index if it is an array or the keys to exclude if it is a map.
+	op_awt               // await: A dest, B the promise. Other values are copied as they are.
+	op_yld               // yield: suspend the generator returning B. A receives the value passed to next when it resumes.
+	op_itr               // iterator: A := iterator over the values of B.
+	op_nxt               // next: A := next value of the iterator B. C is set to false when there are no more values.
+	op_bnd               // bind: A := method C of the object B. Used to call methods of the base class.
+	op_spd               // spread: append the values of B to the array A or copy the properties of B to the map A.
+	op_pow               // A := B ** C
+	op_urs               // A := B >>> C
+	op_ins               // instanceof: A := B instanceof C. C is a class or a constant with the name of a native type.
+	op_hin               // in: A := B in C. The key B exists in the object C.
+	op_itc               // iterator close: notify the iterator A that the loop has been exited with a break.
 )
 
 const (
@@ -72,178 +85,81 @@ const (
 	vm_exit
 )
 
-func exec(i *Instruction, vm *VM) int {
-	switch i.Opcode {
-	case op_ldk:
-		return exec_ldk(i, vm)
-
-	case op_mov:
-		return exec_mov(i, vm)
-
-	case op_mob:
-		return exec_mob(i, vm)
-
-	case op_add:
-		return exec_add(i, vm)
-
-	case op_sub:
-		return exec_sub(i, vm)
-
-	case op_mul:
-		return exec_mul(i, vm)
-
-	case op_div:
-		return exec_div(i, vm)
-
-	case op_mod:
-		return exec_mod(i, vm)
-
-	case op_bor:
-		return exec_bor(i, vm)
-
-	case op_and:
-		return exec_and(i, vm)
-
-	case op_xor:
-		return exec_xor(i, vm)
-
-	case op_lsh:
-		return exec_lsh(i, vm)
-
-	case op_rsh:
-		return exec_rsh(i, vm)
-
-	case op_inc:
-		return exec_inc(i, vm)
-
-	case op_dec:
-		return exec_dec(i, vm)
-
-	case op_unm:
-		return exec_unm(i, vm)
-
-	case op_not:
-		return exec_not(i, vm)
-
-	case op_bnt:
-		return exec_bnt(i, vm)
-
-	case op_str:
-		return exec_str(i, vm)
-
-	case op_new:
-		return exec_new(i, vm)
-
-	case op_nes:
-		return exec_nes(i, vm)
-
-	case op_arr:
-		return exec_arr(i, vm)
-
-	case op_map:
-		return exec_map(i, vm)
-
-	case op_key:
-		return exec_key(i, vm)
-
-	case op_val:
-		return exec_val(i, vm)
-
-	case op_len:
-		return exec_len(i, vm)
-
-	case op_enu:
-		return exec_enu(i, vm)
-
-	case op_get:
-		return exec_get(i, vm)
-
-	case op_gto:
-		return exec_gto(i, vm)
-
-	case op_set:
-		return exec_set(i, vm)
-
-	case op_spa:
-		return exec_spa(i, vm)
-
-	case op_jmp:
-		return exec_jmp(i, vm)
-
-	case op_jpb:
-		return exec_jpb(i, vm)
-
-	case op_ejp:
-		return exec_ejp(i, vm)
-
-	case op_djp:
-		return exec_djp(i, vm)
-
-	case op_tjp:
-		return exec_tjp(i, vm)
-
-	case op_eql:
-		return exec_eql(i, vm)
-
-	case op_neq:
-		return exec_neq(i, vm)
-
-	case op_seq:
-		return exec_seq(i, vm)
-
-	case op_sne:
-		return exec_sne(i, vm)
-
-	case op_lst:
-		return exec_lst(i, vm)
-
-	case op_lse:
-		return exec_lse(i, vm)
-
-	case op_cal:
-		return exec_cal(i, vm)
-
-	case op_cco:
-		return exec_cco(i, vm)
-
-	case op_cas:
-		return exec_cas(i, vm)
-
-	case op_cso:
-		return exec_cso(i, vm)
-
-	case op_rnp:
-		return exec_rnp(i, vm)
-
-	case op_ret:
-		return exec_ret(i, vm)
-
-	case op_clo:
-		return exec_clo(vm)
-
-	case op_trw:
-		return exec_trw(i, vm)
-
-	case op_try:
-		return exec_try(i, vm)
-
-	case op_tre:
-		return exec_tre(vm)
-
-	case op_cen:
-		return exec_cen(vm)
-
-	case op_fen:
-		return exec_fen(vm)
-
-	case op_trx:
-		return exec_trx(vm)
-
-	case op_del:
-		return exec_del(i, vm)
-
-	default:
-		panic(fmt.Sprintf("Invalid opcode: %v", i))
+// executors are the functions that execute each opcode indexed by the
+// opcode so the vm dispatches an instruction with a single call.
+var executors [op_itc + 1]func(instr *Instruction, vm *VM) int
+
+func init() {
+	// initialized here because the executors call the vm that uses them
+	executors = [...]func(instr *Instruction, vm *VM) int{
+		op_ldk: exec_ldk,
+		op_mov: exec_mov,
+		op_mob: exec_mob,
+		op_add: exec_add,
+		op_sub: exec_sub,
+		op_mul: exec_mul,
+		op_div: exec_div,
+		op_mod: exec_mod,
+		op_bor: exec_bor,
+		op_and: exec_and,
+		op_xor: exec_xor,
+		op_lsh: exec_lsh,
+		op_rsh: exec_rsh,
+		op_inc: exec_inc,
+		op_dec: exec_dec,
+		op_unm: exec_unm,
+		op_not: exec_not,
+		op_bnt: exec_bnt,
+		op_str: exec_str,
+		op_new: exec_new,
+		op_nes: exec_nes,
+		op_arr: exec_arr,
+		op_map: exec_map,
+		op_key: exec_key,
+		op_val: exec_val,
+		op_len: exec_len,
+		op_enu: exec_enu,
+		op_get: exec_get,
+		op_gto: exec_gto,
+		op_set: exec_set,
+		op_jmp: exec_jmp,
+		op_jpb: exec_jpb,
+		op_ejp: exec_ejp,
+		op_djp: exec_djp,
+		op_tjp: exec_tjp,
+		op_eql: exec_eql,
+		op_neq: exec_neq,
+		op_seq: exec_seq,
+		op_sne: exec_sne,
+		op_lst: exec_lst,
+		op_lse: exec_lse,
+		op_cal: exec_cal,
+		op_cco: exec_cco,
+		op_cas: exec_cas,
+		op_cso: exec_cso,
+		op_rnp: exec_rnp,
+		op_ret: exec_ret,
+		op_clo: exec_clo,
+		op_trw: exec_trw,
+		op_try: exec_try,
+		op_tre: exec_tre,
+		op_cen: exec_cen,
+		op_fen: exec_fen,
+		op_trx: exec_trx,
+		op_del: exec_del,
+		op_dst: exec_dst,
+		op_rst: exec_rst,
+		op_awt: exec_awt,
+		op_yld: exec_yld,
+		op_itr: exec_itr,
+		op_nxt: exec_nxt,
+		op_bnd: exec_bnd,
+		op_spd: exec_spd,
+		op_pow: exec_pow,
+		op_urs: exec_urs,
+		op_ins: exec_ins,
+		op_hin: exec_hin,
+		op_itc: exec_itc,
 	}
 }
 
@@ -286,7 +202,7 @@ func exec_mob(instr *Instruction, vm *VM) int {
 }
 
 func exec_ldk(instr *Instruction, vm *VM) int {
-	k := vm.Program.Constants[instr.B.Value]
+	k := vm.Program.Constants[instr.B.Value()]
 	vm.set(instr.A, k)
 	return vm_next
 }
@@ -659,6 +575,32 @@ func exec_rsh(instr *Instruction, vm *VM) int {
 	return vm_next
 }
 
+func exec_urs(instr *Instruction, vm *VM) int {
+	lh := vm.get(instr.B)
+	rh := vm.get(instr.C)
+	switch lh.Type {
+	case Int:
+		switch rh.Type {
+		case Int:
+			// like javascript the value is treated as an unsigned 32 bit integer
+			vm.set(instr.A, NewInt64(int64(uint32(lh.ToInt())>>(uint32(rh.ToInt())&31))))
+		default:
+			if vm.handle((vm.NewError("Invalid operation on %v and %v", lh.Type, rh.Type))) {
+				return vm_continue
+			} else {
+				return vm_exit
+			}
+		}
+	default:
+		if vm.handle((vm.NewError("Invalid operation on %v and %v", lh.Type, rh.Type))) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+	return vm_next
+}
+
 func exec_xor(instr *Instruction, vm *VM) int {
 	lh := vm.get(instr.B)
 	rh := vm.get(instr.C)
@@ -766,6 +708,49 @@ func exec_div(instr *Instruction, vm *VM) int {
 	return vm_next
 }
 
+func exec_pow(instr *Instruction, vm *VM) int {
+	lh := vm.get(instr.B)
+	rh := vm.get(instr.C)
+	switch lh.Type {
+	case Int, Float:
+		switch rh.Type {
+		case Int:
+			if lh.Type == Int && rh.ToInt() >= 0 {
+				vm.set(instr.A, NewInt64(powInt(lh.ToInt(), rh.ToInt())))
+			} else {
+				vm.set(instr.A, NewFloat(math.Pow(lh.ToFloat(), rh.ToFloat())))
+			}
+		case Float:
+			vm.set(instr.A, NewFloat(math.Pow(lh.ToFloat(), rh.ToFloat())))
+		default:
+			if vm.handle((vm.NewError("Invalid operation on %v and %v", lh.Type, rh.Type))) {
+				return vm_continue
+			} else {
+				return vm_exit
+			}
+		}
+	default:
+		if vm.handle((vm.NewError("Invalid operation on %v and %v", lh.Type, rh.Type))) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+	return vm_next
+}
+
+func powInt(x, n int64) int64 {
+	r := int64(1)
+	for n > 0 {
+		if n&1 == 1 {
+			r *= x
+		}
+		x *= x
+		n >>= 1
+	}
+	return r
+}
+
 func exec_mod(instr *Instruction, vm *VM) int {
 	lh := vm.get(instr.B)
 	rh := vm.get(instr.C)
@@ -825,17 +810,17 @@ func exec_mod(instr *Instruction, vm *VM) int {
 }
 
 func exec_str(instr *Instruction, vm *VM) int {
-	if instr.A.Kind != AddrData {
+	if instr.A.Kind() != AddrData {
 		panic(fmt.Sprintf("Compiler error: invalid register number kind: %v", instr.A))
 	}
 
-	if instr.B.Kind != AddrData {
+	if instr.B.Kind() != AddrData {
 		panic(fmt.Sprintf("Compiler error: invalid register value kind: %v", instr.B))
 	}
 
-	switch instr.A.Value {
+	switch instr.A.Value() {
 	case 0:
-		vm.reg0 = instr.B.Value
+		vm.reg0 = instr.B.Value()
 	default:
 		panic(fmt.Sprintf("Compiler error: invalid register number: %v", instr.A))
 	}
@@ -1141,18 +1126,18 @@ func exec_sne(instr *Instruction, vm *VM) int {
 }
 
 func exec_arr(instr *Instruction, vm *VM) int {
-	vm.set(instr.A, NewArray(int(instr.B.Value)))
+	vm.set(instr.A, NewArray(int(instr.B.Value())))
 	return vm_next
 }
 
 func exec_map(instr *Instruction, vm *VM) int {
-	vm.set(instr.A, NewMap(int(instr.B.Value)))
+	vm.set(instr.A, NewMap(int(instr.B.Value())))
 	return vm_next
 }
 
 func exec_enu(instr *Instruction, vm *VM) int {
-	enum := vm.Program.Enums[int(instr.B.Value)]
-	value := enum.Values[int(instr.C.Value)]
+	enum := vm.Program.Enums[int(instr.B.Value())]
+	value := enum.Values[int(instr.C.Value())]
 	k := vm.Program.Constants[value.KIndex]
 	vm.set(instr.A, k)
 	return vm_next
@@ -1204,41 +1189,6 @@ func exec_set(instr *Instruction, vm *VM) int {
 	return vm_next
 }
 
-func exec_spa(instr *Instruction, vm *VM) int {
-	v := vm.get(instr.A)
-	if v.Type != Array {
-		if vm.handle((vm.NewError("Expected array, got %v", v.TypeName()))) {
-			return vm_continue
-		} else {
-			return vm_exit
-		}
-	}
-
-	va := v.ToArrayObject().Array
-
-	ln := len(va)
-	if ln == 0 {
-		return vm_next
-	}
-
-	last := va[ln-1]
-	switch last.Type {
-	case Null, Undefined:
-		vm.set(instr.A, NewArrayValues(va[:ln-1]))
-	case Array:
-		n := append(va[:ln-1], last.ToArrayObject().Array...)
-		vm.set(instr.A, NewArrayValues(n))
-	default:
-		if vm.handle((vm.NewError("Expected array, got %v", last.TypeName()))) {
-			return vm_continue
-		} else {
-			return vm_exit
-		}
-	}
-
-	return vm_next
-}
-
 func exec_key(instr *Instruction, vm *VM) int {
 	// gets the keys of a map or the indexes of an array: A := keys(B)
 	bv := vm.get(instr.B)
@@ -1464,10 +1414,10 @@ func exec_trw(instr *Instruction, vm *VM) int {
 func exec_try(instr *Instruction, vm *VM) int {
 	//  jump to A absolute pc, set the error to B. C: the 'finally' absolute pc.
 	var catchPC int
-	if instr.A.Kind == AddrVoid {
+	if instr.A.Kind() == AddrVoid {
 		catchPC = -1
 	} else {
-		catchPC = int(instr.A.Value)
+		catchPC = int(instr.A.Value())
 	}
 
 	try := &tryCatch{
@@ -1478,8 +1428,8 @@ func exec_try(instr *Instruction, vm *VM) int {
 	}
 
 	// set the finally pc if provided
-	if instr.C.Kind == AddrData {
-		try.finallyPC = int(instr.C.Value)
+	if instr.C.Kind() == AddrData {
+		try.finallyPC = int(instr.C.Value())
 	} else {
 		try.finallyPC = -1
 	}
@@ -1488,7 +1438,7 @@ func exec_try(instr *Instruction, vm *VM) int {
 	return vm_next
 }
 
-func exec_trx(vm *VM) int {
+func exec_trx(instr *Instruction, vm *VM) int {
 	i := len(vm.tryCatchs) - 1
 
 	if i >= 0 {
@@ -1512,7 +1462,7 @@ func exec_trx(vm *VM) int {
 	return vm_continue
 }
 
-func exec_tre(vm *VM) int {
+func exec_tre(instr *Instruction, vm *VM) int {
 	l := len(vm.tryCatchs) - 1
 
 	try := vm.tryCatchs[l]
@@ -1523,7 +1473,7 @@ func exec_tre(vm *VM) int {
 	return vm_next
 }
 
-func exec_cen(vm *VM) int {
+func exec_cen(instr *Instruction, vm *VM) int {
 	l := len(vm.tryCatchs) - 1
 
 	// don't need to check finally because cen is only emmited if there is no finally
@@ -1531,7 +1481,7 @@ func exec_cen(vm *VM) int {
 	return vm_next
 }
 
-func exec_fen(vm *VM) int {
+func exec_fen(instr *Instruction, vm *VM) int {
 	l := len(vm.tryCatchs) - 1
 	try := vm.tryCatchs[l]
 	vm.tryCatchs = vm.tryCatchs[:l]
@@ -1547,6 +1497,11 @@ func exec_fen(vm *VM) int {
 		}
 	}
 
+	if try.retPC == generatorReturn {
+		vm.returnFromGenerator()
+		return vm_continue
+	}
+
 	if try.retPC != -1 {
 		vm.setPC(try.retPC)
 		return vm_continue
@@ -1562,7 +1517,7 @@ func exec_ejp(instr *Instruction, vm *VM) int {
 	rh := vm.get(instr.B)
 
 	if lh.Equals(rh) {
-		vm.incPC(int(instr.C.Value))
+		vm.incPC(int(instr.C.Value()))
 	}
 	return vm_next
 }
@@ -1574,7 +1529,7 @@ func exec_djp(instr *Instruction, vm *VM) int {
 	rh := vm.get(instr.B)
 
 	if !lh.Equals(rh) {
-		vm.incPC(int(instr.C.Value))
+		vm.incPC(int(instr.C.Value()))
 	}
 	return vm_next
 }
@@ -1597,20 +1552,24 @@ func exec_tjp(instr *Instruction, vm *VM) int {
 		expr = !av.IsNilOrEmpty() // true if it has a value like in javascript
 	}
 
-	cv := instr.C.Value
+	cv := instr.C.Value()
 
 	switch jumpType(cv) {
 	case jumpIfFalse:
 		if expr {
-			vm.incPC(int(instr.B.Value))
+			vm.incPC(int(instr.B.Value()))
 		}
 	case jumpIfTrue:
 		if !expr {
-			vm.incPC(int(instr.B.Value))
+			vm.incPC(int(instr.B.Value()))
 		}
 	case jumpIfNotNull:
 		if !av.IsNil() {
-			vm.incPC(int(instr.B.Value))
+			vm.incPC(int(instr.B.Value()))
+		}
+	case jumpIfDefined:
+		if av.Type != Undefined {
+			vm.incPC(int(instr.B.Value()))
 		}
 	}
 
@@ -1618,19 +1577,18 @@ func exec_tjp(instr *Instruction, vm *VM) int {
 }
 
 func exec_jmp(instr *Instruction, vm *VM) int {
-	vm.incPC(int(instr.A.Value))
+	vm.incPC(int(instr.A.Value()))
 	return vm_next
 }
 
 func exec_jpb(instr *Instruction, vm *VM) int {
-	vm.incPC(int(instr.A.Value) * -1)
+	vm.incPC(int(instr.A.Value()) * -1)
 	return vm_continue
 }
 
-func exec_clo(vm *VM) int {
+func exec_clo(instr *Instruction, vm *VM) int {
 	// R(A) dest R(B value) funcIndex
-	instr := vm.instruction()
-	funcIndex := instr.B.Value
+	funcIndex := instr.B.Value()
 
 	// copy  closures carried from parent functions
 	frame := vm.callStack[vm.fp]
@@ -1665,6 +1623,10 @@ func exec_new(instr *Instruction, vm *VM) int {
 		args = vm.get(instr.C).ToArrayObject().Array
 	}
 
+	if instr.A.Kind() == AddrNativeFunc {
+		return newNativeInstance(instr, args, vm)
+	}
+
 	i := newInstance(instr.A, vm)
 
 	v := NewObject(i)
@@ -1682,6 +1644,10 @@ func exec_nes(instr *Instruction, vm *VM) int {
 
 	args := []Value{vm.get(instr.C)}
 
+	if instr.A.Kind() == AddrNativeFunc {
+		return newNativeInstance(instr, args, vm)
+	}
+
 	i := newInstance(instr.A, vm)
 
 	v := NewObject(i)
@@ -1695,6 +1661,19 @@ func exec_nes(instr *Instruction, vm *VM) int {
 	return vm_next
 }
 
+// newNativeInstance handles "new" with native functions that
+// act as constructors like Promise.
+func newNativeInstance(instr *Instruction, args []Value, vm *VM) int {
+	if err := vm.callNativeFunc(int(instr.A.Value()), args, instr.B, NullValue); err != nil {
+		if vm.handle(vm.WrapError(err)) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+	return vm_next
+}
+
 func exec_cal(instr *Instruction, vm *VM) int {
 	// A funcIndex, B retAddress, C argsAddress
 
@@ -1764,6 +1743,7 @@ func exec_ret(instr *Instruction, vm *VM) int {
 	if !currentFrame.inClosure {
 		currentFrame.finalizables = nil
 		currentFrame.closures = nil
+		currentFrame.generator = nil
 		for i := range currentFrame.values {
 			currentFrame.values[i] = UndefinedValue
 		}
@@ -1795,7 +1775,340 @@ func exec_del(instr *Instruction, vm *VM) int {
 
 	m := obj.ToMap()
 	m.Lock()
-	delete(m.Map, property)
+	delete(m.Map, property.Key())
+	m.Unlock()
+	return vm_next
+}
+
+func exec_dst(instr *Instruction, vm *VM) int {
+	bv := vm.get(instr.B)
+	if bv.Type == Object {
+		if cr, ok := bv.ToObject().(*closureRegister); ok {
+			bv = cr.get()
+		}
+	}
+
+	// like in javascript missing elements are undefined: let [a, b] = [1]
+	if bv.Type == Array {
+		cv := vm.get(instr.C)
+		if cv.Type == Int && int(cv.ToInt()) >= len(bv.ToArray()) {
+			vm.set(instr.A, UndefinedValue)
+			return vm_next
+		}
+	}
+
+	return exec_get(instr, vm)
+}
+
+func exec_rst(instr *Instruction, vm *VM) int {
+	bv := vm.get(instr.B)
+	if bv.Type == Object {
+		if cr, ok := bv.ToObject().(*closureRegister); ok {
+			bv = cr.get()
+		}
+	}
+
+	switch bv.Type {
+	case Array:
+		s := bv.ToArray()
+		i := int(vm.get(instr.C).ToInt())
+		if i > len(s) {
+			i = len(s)
+		}
+		values := make([]Value, len(s)-i)
+		copy(values, s[i:])
+		vm.set(instr.A, NewArrayValues(values))
+
+	case Map:
+		m := bv.ToMap()
+		m.RLock()
+		values := make(map[Value]Value, len(m.Map))
+		for k, v := range m.Map {
+			values[k] = v
+		}
+		m.RUnlock()
+
+		for _, k := range vm.get(instr.C).ToArray() {
+			delete(values, k)
+		}
+		vm.set(instr.A, NewMapValues(values))
+
+	default:
+		if vm.handle((vm.NewError("Can't destructure %v", bv.TypeName()))) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	return vm_next
+}
+
+func exec_awt(instr *Instruction, vm *VM) int {
+	bv := vm.get(instr.B)
+
+	p, ok := bv.ToObjectOrNil().(*Promise)
+	if !ok {
+		if instr.A != Void {
+			vm.set(instr.A, bv)
+		}
+		return vm_next
+	}
+
+	v, err := p.AwaitContext(vm.GoContext())
+	if err != nil {
+		if vm.handle(vm.WrapError(err)) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	if instr.A != Void {
+		vm.set(instr.A, v)
+	}
+	return vm_next
+}
+
+func exec_yld(instr *Instruction, vm *VM) int {
+	frame := vm.callStack[vm.fp]
+
+	g := frame.generator
+	g.sent = instr.A
+	g.tryCatchs = vm.tryCatchs
+	g.yielded = true
+
+	if instr.B == Void {
+		vm.RetValue = UndefinedValue
+	} else {
+		vm.RetValue = vm.get(instr.B)
+	}
+
+	// continue after the yield when it is resumed
+	frame.pc++
+
+	// pop the frame but keep it in the generator
+	vm.callStack = vm.callStack[:vm.fp]
+	vm.fp--
+
+	return vm_exit
+}
+
+func exec_itr(instr *Instruction, vm *VM) int {
+	it, err := vm.newIterator(vm.get(instr.B))
+	if err != nil {
+		if vm.handle(vm.WrapError(err)) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	vm.set(instr.A, NewObject(it))
+	return vm_next
+}
+
+func exec_nxt(instr *Instruction, vm *VM) int {
+	it := vm.get(instr.B).ToObject().(iterator)
+
+	v, ok, err := it.next(vm)
+	if err != nil {
+		if vm.handle(vm.WrapError(err)) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	if ok {
+		vm.set(instr.A, v)
+	}
+	vm.set(instr.C, NewBool(ok))
+	return vm_next
+}
+
+func exec_itc(instr *Instruction, vm *VM) int {
+	c, ok := vm.get(instr.A).ToObject().(iteratorCloser)
+	if !ok {
+		return vm_next
+	}
+
+	if err := c.close(vm); err != nil {
+		if vm.handle(vm.WrapError(err)) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	return vm_next
+}
+
+func exec_bnd(instr *Instruction, vm *VM) int {
+	m := method{fn: int(instr.C.Value()), this: vm.get(instr.B)}
+	vm.set(instr.A, NewObject(m))
+	return vm_next
+}
+
+func exec_spd(instr *Instruction, vm *VM) int {
+	dst := vm.get(instr.A)
+	src := vm.get(instr.B)
+
+	var err error
+	switch dst.Type {
+	case Array:
+		err = spreadArray(dst.ToArrayObject(), src, vm)
+	case Map:
+		err = spreadMap(dst.ToMap(), src)
+	default:
+		err = fmt.Errorf("Invalid spread target: %v", dst.TypeName())
+	}
+
+	if err != nil {
+		if vm.handle(vm.WrapError(err)) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	return vm_next
+}
+
+func spreadArray(a *NewArrayObject, v Value, vm *VM) error {
+	if v.Type == Array {
+		a.Array = append(a.Array, v.ToArray()...)
+		return nil
+	}
+
+	it, err := vm.newIterator(v)
+	if err != nil {
+		return fmt.Errorf("Expected an iterable to spread, got %v", v.TypeName())
+	}
+
+	for {
+		item, ok, err := it.next(vm)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		a.Array = append(a.Array, item)
+	}
+}
+
+func spreadMap(m *MapValue, v Value) error {
+	switch v.Type {
+	case Null, Undefined:
+		return nil
+	case Map:
+	default:
+		return fmt.Errorf("Expected an object to spread, got %v", v.TypeName())
+	}
+
+	src := v.ToMap()
+	if src == m {
+		return nil
+	}
+
+	src.RLock()
+	m.Lock()
+	for k, v := range src.Map {
+		m.Map[k] = v
+	}
 	m.Unlock()
+	src.RUnlock()
+	return nil
+}
+
+func exec_ins(instr *Instruction, vm *VM) int {
+	v := vm.get(instr.B)
+
+	if instr.C.Kind() == AddrClass {
+		vm.set(instr.A, NewBool(isClassInstance(v, vm.Program.Classes[instr.C.Value()], vm.Program)))
+		return vm_next
+	}
+
+	name := vm.get(instr.C).String()
+
+	var ok bool
+	switch v.Type {
+	case Array:
+		ok = name == "Array"
+	case Object:
+		if n, isNamed := v.ToObject().(NamedType); isNamed {
+			ok = n.Type() == name
+		}
+	}
+
+	vm.set(instr.A, NewBool(ok))
+	return vm_next
+}
+
+// isClassInstance returns true if v is an instance of the class or of a derived class.
+func isClassInstance(v Value, class *Class, p *Program) bool {
+	if v.Type != Object {
+		return false
+	}
+
+	i, ok := v.ToObject().(*instance)
+	if !ok {
+		return false
+	}
+
+	for cl := i.class; cl != nil; cl = p.BaseClass(cl) {
+		if cl == class {
+			return true
+		}
+	}
+	return false
+}
+
+func exec_hin(instr *Instruction, vm *VM) int {
+	key := vm.get(instr.B)
+	obj := vm.get(instr.C)
+
+	var ok bool
+
+	switch obj.Type {
+	case Map:
+		m := obj.ToMap()
+		m.RLock()
+		_, ok = m.Map[key.Key()]
+		m.RUnlock()
+
+	case Array:
+		if key.Type == Int {
+			i := key.ToInt()
+			ok = i >= 0 && i < int64(len(obj.ToArray()))
+		}
+
+	case Object:
+		i, isInstance := obj.ToObject().(*instance)
+		if !isInstance {
+			if vm.handle(vm.NewError("Cannot use 'in' operator to search for '%v' in %v", key, obj.TypeName())) {
+				return vm_continue
+			} else {
+				return vm_exit
+			}
+		}
+		name := key.String()
+		i.RLock()
+		_, ok = i.iMap[name]
+		i.RUnlock()
+		if !ok {
+			ok = i.hasMember(name, vm.Program)
+		}
+
+	default:
+		if vm.handle(vm.NewError("Cannot use 'in' operator to search for '%v' in %v", key, obj.TypeName())) {
+			return vm_continue
+		} else {
+			return vm_exit
+		}
+	}
+
+	vm.set(instr.A, NewBool(ok))
 	return vm_next
 }
@@ -38,37 +38,49 @@ func _() {
 	_ = x[op_get-27]
 	_ = x[op_gto-28]
 	_ = x[op_set-29]
-	_ = x[op_spa-30]
-	_ = x[op_jmp-31]
-	_ = x[op_jpb-32]
-	_ = x[op_ejp-33]
-	_ = x[op_djp-34]
-	_ = x[op_tjp-35]
-	_ = x[op_eql-36]
-	_ = x[op_neq-37]
-	_ = x[op_seq-38]
-	_ = x[op_sne-39]
-	_ = x[op_lst-40]
-	_ = x[op_lse-41]
-	_ = x[op_cal-42]
-	_ = x[op_cco-43]
-	_ = x[op_cas-44]
-	_ = x[op_cso-45]
-	_ = x[op_rnp-46]
-	_ = x[op_ret-47]
-	_ = x[op_clo-48]
-	_ = x[op_trw-49]
-	_ = x[op_try-50]
-	_ = x[op_tre-51]
-	_ = x[op_cen-52]
-	_ = x[op_fen-53]
-	_ = x[op_trx-54]
-	_ = x[op_del-55]
+	_ = x[op_jmp-30]
+	_ = x[op_jpb-31]
+	_ = x[op_ejp-32]
+	_ = x[op_djp-33]
+	_ = x[op_tjp-34]
+	_ = x[op_eql-35]
+	_ = x[op_neq-36]
+	_ = x[op_seq-37]
+	_ = x[op_sne-38]
+	_ = x[op_lst-39]
+	_ = x[op_lse-40]
+	_ = x[op_cal-41]
+	_ = x[op_cco-42]
+	_ = x[op_cas-43]
+	_ = x[op_cso-44]
+	_ = x[op_rnp-45]
+	_ = x[op_ret-46]
+	_ = x[op_clo-47]
+	_ = x[op_trw-48]
+	_ = x[op_try-49]
+	_ = x[op_tre-50]
+	_ = x[op_cen-51]
+	_ = x[op_fen-52]
+	_ = x[op_trx-53]
+	_ = x[op_del-54]
+	_ = x[op_dst-55]
+	_ = x[op_rst-56]
+	_ = x[op_awt-57]
+	_ = x[op_yld-58]
+	_ = x[op_itr-59]
+	_ = x[op_nxt-60]
+	_ = x[op_bnd-61]
+	_ = x[op_spd-62]
+	_ = x[op_pow-63]
+	_ = x[op_urs-64]
+	_ = x[op_ins-65]
+	_ = x[op_hin-66]
+	_ = x[op_itc-67]
 }
 
-const _Opcode_name = "op_ldkop_movop_mobop_addop_subop_mulop_divop_modop_borop_andop_xorop_lshop_rshop_incop_decop_unmop_notop_bntop_strop_newop_nesop_arrop_mapop_keyop_valop_lenop_enuop_getop_gtoop_setop_spaop_jmpop_jpbop_ejpop_djpop_tjpop_eqlop_neqop_seqop_sneop_lstop_lseop_calop_ccoop_casop_csoop_rnpop_retop_cloop_trwop_tryop_treop_cenop_fenop_trxop_del"
+const _Opcode_name = "op_ldkop_movop_mobop_addop_subop_mulop_divop_modop_borop_andop_xorop_lshop_rshop_incop_decop_unmop_notop_bntop_strop_newop_nesop_arrop_mapop_keyop_valop_lenop_enuop_getop_gtoop_setop_jmpop_jpbop_ejpop_djpop_tjpop_eqlop_neqop_seqop_sneop_lstop_lseop_calop_ccoop_casop_csoop_rnpop_retop_cloop_trwop_tryop_treop_cenop_fenop_trxop_delop_dstop_rstop_awtop_yldop_itrop_nxtop_bndop_spdop_powop_ursop_insop_hinop_itc"
 
-var _Opcode_index = [...]uint16{0, 6, 12, 18, 24, 30, 36, 42, 48, 54, 60, 66, 72, 78, 84, 90, 96, 102, 108, 114, 120, 126, 132, 138, 144, 150, 156, 162, 168, 174, 180, 186, 192, 198, 204, 210, 216, 222, 228, 234, 240, 246, 252, 258, 264, 270, 276, 282, 288, 294, 300, 306, 312, 318, 324, 330, 336}
+var _Opcode_index = [...]uint16{0, 6, 12, 18, 24, 30, 36, 42, 48, 54, 60, 66, 72, 78, 84, 90, 96, 102, 108, 114, 120, 126, 132, 138, 144, 150, 156, 162, 168, 174, 180, 186, 192, 198, 204, 210, 216, 222, 228, 234, 240, 246, 252, 258, 264, 270, 276, 282, 288, 294, 300, 306, 312, 318, 324, 330, 336, 342, 348, 354, 360, 366, 372, 378, 384, 390, 396, 402, 408}
 
 func (i Opcode) String() string {
 	if i >= Opcode(len(_Opcode_index)-1) {
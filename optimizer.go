@@ -0,0 +1,437 @@
+package dune
+
+import (
+	"strconv"
+
+	"github.com/scorredoira/dune/ast"
+)
+
+// foldConstant evaluates at compile time binary expressions of literals,
+// constants and enum values: 60 * 60 * 24 or Color.red | Color.blue
+func (c *compiler) foldConstant(expr ast.Expr) (Value, bool) {
+	switch t := expr.(type) {
+	case *ast.ConstantExpr:
+		switch t.Kind {
+		case ast.INT:
+			if n, err := strconv.ParseInt(t.Value, 10, 64); err == nil {
+				return NewInt64(n), true
+			}
+		case ast.FLOAT:
+			if n, err := strconv.ParseFloat(t.Value, 64); err == nil {
+				return NewFloat(n), true
+			}
+		case ast.STRING:
+			return NewString(t.Value), true
+		case ast.TRUE:
+			return TrueValue, true
+		case ast.FALSE:
+			return FalseValue, true
+		}
+
+	case *ast.UnaryExpr:
+		v, ok := c.foldConstant(t.Operand)
+		if !ok {
+			return NullValue, false
+		}
+		switch {
+		case t.Operator == ast.SUB && v.Type == Int:
+			return NewInt64(-v.ToInt()), true
+		case t.Operator == ast.SUB && v.Type == Float:
+			return NewFloat(-v.ToFloat()), true
+		case t.Operator == ast.BNT && v.Type == Int:
+			return NewInt64(^v.ToInt()), true
+		case t.Operator == ast.NOT && v.Type == Bool:
+			return NewBool(!v.ToBool()), true
+		}
+
+	case *ast.IdentExpr:
+		addr, err := c.findRegister(t.Name, c.currentFunc)
+		if err == nil && addr.Kind() == AddrConstant {
+			return foldable(c.program.Constants[addr.Value()])
+		}
+
+	case *ast.SelectorExpr:
+		ident, ok := t.X.(*ast.IdentExpr)
+		if !ok {
+			return NullValue, false
+		}
+		addr, err := c.findRegister(ident.Name, c.currentFunc)
+		if err != nil || addr.Kind() != AddrEnum {
+			return NullValue, false
+		}
+		v, i := c.program.Enums[addr.Value()].ValueByName(t.Sel.Name)
+		if i == -1 {
+			return NullValue, false
+		}
+		return foldable(c.program.Constants[v.KIndex])
+
+	case *ast.BinaryExpr:
+		left, ok := c.foldConstant(t.Left)
+		if !ok {
+			return NullValue, false
+		}
+		right, ok := c.foldConstant(t.Right)
+		if !ok {
+			return NullValue, false
+		}
+		return foldBinary(t.Operator, left, right)
+	}
+
+	return NullValue, false
+}
+
+func foldable(v Value) (Value, bool) {
+	switch v.Type {
+	case Int, Float, String, Bool:
+		return v, true
+	}
+	return NullValue, false
+}
+
+// foldBinary calculates the operations with the same result that the vm.
+// Anything that would be an error at runtime is not folded.
+func foldBinary(op ast.Type, a, b Value) (Value, bool) {
+	if a.Type == Int && b.Type == Int {
+		x, y := a.ToInt(), b.ToInt()
+		switch op {
+		case ast.ADD:
+			return NewInt64(x + y), true
+		case ast.SUB:
+			return NewInt64(x - y), true
+		case ast.MUL:
+			return NewInt64(x * y), true
+		case ast.MOD:
+			if y != 0 {
+				return NewInt64(x % y), true
+			}
+		case ast.BOR:
+			return NewInt64(x | y), true
+		case ast.AND:
+			return NewInt64(x & y), true
+		case ast.XOR:
+			return NewInt64(x ^ y), true
+		case ast.LSH:
+			return NewInt64(x << uint64(y)), true
+		case ast.RSH:
+			return NewInt64(x >> uint64(y)), true
+		}
+	}
+
+	if isNumber(a) && isNumber(b) {
+		x, y := a.ToFloat(), b.ToFloat()
+		switch op {
+		case ast.ADD:
+			return NewFloat(x + y), true
+		case ast.SUB:
+			return NewFloat(x - y), true
+		case ast.MUL:
+			return NewFloat(x * y), true
+		case ast.DIV:
+			if y != 0 {
+				return NewFloat(x / y), true
+			}
+		}
+	}
+
+	if a.Type == String && b.Type == String && op == ast.ADD {
+		return NewString(a.ToString() + b.ToString()), true
+	}
+
+	return NullValue, false
+}
+
+// optimize removes the unreachable code, threads the jumps
+// and removes the redundant moves of a compiled function.
+func optimize(f *Function) {
+	o := newOptimizer(f)
+	o.threadJumps()
+	o.removeUnreachable()
+	o.removeRedundant()
+	o.rewrite()
+}
+
+type optimizer struct {
+	fn      *Function
+	targets []int // the absolute target of jumps or -1
+	catches []int // the catch pc of op_try or -1
+	finally []int // the finally pc of op_try or -1
+	removed []bool
+}
+
+func newOptimizer(f *Function) *optimizer {
+	n := len(f.Instructions)
+
+	o := &optimizer{
+		fn:      f,
+		targets: make([]int, n),
+		catches: make([]int, n),
+		finally: make([]int, n),
+		removed: make([]bool, n),
+	}
+
+	for pc, i := range f.Instructions {
+		o.targets[pc] = -1
+		o.catches[pc] = -1
+		o.finally[pc] = -1
+
+		switch i.Opcode {
+		case op_jmp:
+			o.targets[pc] = pc + int(i.A.Value()) + 1
+		case op_jpb:
+			o.targets[pc] = pc - int(i.A.Value())
+		case op_ejp, op_djp:
+			o.targets[pc] = pc + int(i.C.Value()) + 1
+		case op_tjp:
+			o.targets[pc] = pc + int(i.B.Value()) + 1
+		case op_str:
+			// the pc to jump in optional chainings is relative to the next instruction
+			o.targets[pc] = pc + int(i.B.Value()) + 1
+		case op_try:
+			if i.A.Kind() == AddrData {
+				o.catches[pc] = int(i.A.Value())
+			}
+			if i.C.Kind() == AddrData {
+				o.finally[pc] = int(i.C.Value())
+			}
+		}
+	}
+
+	return o
+}
+
+func isJump(op Opcode) bool {
+	return op == op_jmp || op == op_jpb
+}
+
+// threadJumps makes jumps to unconditional jumps go directly to the final target.
+func (o *optimizer) threadJumps() {
+	instrs := o.fn.Instructions
+
+	for pc, i := range instrs {
+		switch i.Opcode {
+		case op_jmp, op_jpb, op_ejp, op_djp, op_tjp:
+		default:
+			continue
+		}
+
+		target := o.targets[pc]
+		for hops := 0; hops < 8; hops++ {
+			if target >= len(instrs) || !isJump(instrs[target].Opcode) || o.targets[target] == target {
+				break
+			}
+			target = o.targets[target]
+		}
+
+		// conditional jumps can only go forward
+		if !isJump(i.Opcode) && target <= pc {
+			continue
+		}
+
+		o.targets[pc] = target
+	}
+}
+
+// removeUnreachable removes the code that can't be reached from the
+// start of the function or the catch and finally blocks.
+func (o *optimizer) removeUnreachable() {
+	instrs := o.fn.Instructions
+	n := len(instrs)
+
+	reachable := make([]bool, n)
+	pending := []int{0}
+
+	for len(pending) > 0 {
+		pc := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for pc >= 0 && pc < n && !reachable[pc] {
+			reachable[pc] = true
+
+			for _, t := range []int{o.targets[pc], o.catches[pc], o.finally[pc]} {
+				if t != -1 {
+					pending = append(pending, t)
+				}
+			}
+
+			switch instrs[pc].Opcode {
+			case op_jmp, op_jpb, op_ret, op_trw:
+				pc = -1
+			default:
+				pc++
+			}
+		}
+	}
+
+	// the last return is never removed so code can be appended in the repl
+	for pc := 0; pc < n-1; pc++ {
+		if !reachable[pc] {
+			o.removed[pc] = true
+		}
+	}
+}
+
+// removeRedundant removes moves to the same register, moves that
+// undo the previous one and jumps to the next instruction.
+func (o *optimizer) removeRedundant() {
+	instrs := o.fn.Instructions
+	n := len(instrs)
+
+	// instructions that are the target of a jump
+	targeted := make([]bool, n+1)
+	for pc := range instrs {
+		for _, t := range []int{o.targets[pc], o.catches[pc], o.finally[pc]} {
+			if t >= 0 && t <= n {
+				targeted[t] = true
+			}
+		}
+	}
+
+	// don't remove anything between op_str and the instruction that
+	// reads the register because the jump is relative to it.
+	var inChaining bool
+	last := -1
+
+	for pc := 0; pc < n-1; pc++ {
+		if o.removed[pc] {
+			continue
+		}
+
+		i := instrs[pc]
+
+		switch i.Opcode {
+		case op_str:
+			inChaining = true
+		case op_gto, op_cco, op_cso:
+			inChaining = false
+		case op_mov:
+			if inChaining {
+				break
+			}
+			if i.A == i.B {
+				o.removed[pc] = true
+				continue
+			}
+			if last != -1 && !targeted[pc] {
+				prev := instrs[last]
+				if prev.Opcode == op_mov && prev.A == i.B && prev.B == i.A {
+					o.removed[pc] = true
+					continue
+				}
+			}
+		case op_jmp:
+			if !inChaining && o.nextInstruction(pc) == o.targets[pc] {
+				o.removed[pc] = true
+				continue
+			}
+		}
+
+		last = pc
+	}
+}
+
+// nextInstruction returns the next pc that is not removed.
+func (o *optimizer) nextInstruction(pc int) int {
+	for pc++; pc < len(o.removed) && o.removed[pc]; pc++ {
+	}
+	return pc
+}
+
+// rewrite removes the instructions and updates the
+// jumps, the positions and the scope of the registers.
+func (o *optimizer) rewrite() {
+	f := o.fn
+	n := len(f.Instructions)
+
+	// the new pc of each instruction. The removed ones point to the next.
+	newPC := make([]int, n+1)
+	count := 0
+	for pc := 0; pc < n; pc++ {
+		newPC[pc] = count
+		if !o.removed[pc] {
+			count++
+		}
+	}
+	newPC[n] = count
+
+	o.encodeJumps(newPC)
+
+	if count == n {
+		return
+	}
+
+	instrs := make([]Instruction, 0, count)
+	var positions []Position
+	if f.Positions != nil {
+		positions = make([]Position, 0, count)
+	}
+
+	for pc, i := range f.Instructions {
+		if o.removed[pc] {
+			continue
+		}
+		instrs = append(instrs, i)
+		if positions != nil && pc < len(f.Positions) {
+			positions = append(positions, f.Positions[pc])
+		}
+	}
+
+	for _, r := range f.Registers {
+		r.StartPC = remapPC(newPC, r.StartPC)
+		if r.EndPC != 0 {
+			r.EndPC = remapPC(newPC, r.EndPC)
+		}
+	}
+
+	f.Instructions = instrs
+	f.Positions = positions
+}
+
+func remapPC(newPC []int, pc int) int {
+	if pc < 0 {
+		return pc
+	}
+	if pc >= len(newPC) {
+		return newPC[len(newPC)-1]
+	}
+	return newPC[pc]
+}
+
+func (o *optimizer) encodeJumps(newPC []int) {
+	for pc := range o.fn.Instructions {
+		if o.removed[pc] {
+			continue
+		}
+
+		i := &o.fn.Instructions[pc]
+		from := newPC[pc]
+
+		if t := o.targets[pc]; t != -1 {
+			to := remapPC(newPC, t)
+
+			switch i.Opcode {
+			case op_jmp, op_jpb:
+				if to > from {
+					i.Opcode = op_jmp
+					i.A = NewAddress(AddrData, to-from-1)
+				} else {
+					i.Opcode = op_jpb
+					i.A = NewAddress(AddrData, from-to)
+				}
+			case op_ejp, op_djp:
+				i.C = NewAddress(AddrData, to-from-1)
+			case op_tjp:
+				i.B = NewAddress(AddrData, to-from-1)
+			case op_str:
+				i.B = NewAddress(AddrData, to-from-1)
+			}
+		}
+
+		if t := o.catches[pc]; t != -1 {
+			i.A = NewAddress(AddrData, remapPC(newPC, t))
+		}
+
+		if t := o.finally[pc]; t != -1 {
+			i.C = NewAddress(AddrData, remapPC(newPC, t))
+		}
+	}
+}
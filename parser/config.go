@@ -40,7 +40,8 @@ func ReadConfig(fs filesystem.FS, file string) (*Config, error) {
 	}
 }
 
-func parseConfig(fs filesystem.FS, path string) (*Config, error) {
+// ReadJSON reads a json file that can have line comments like tsconfig.json.
+func ReadJSON(fs filesystem.FS, path string) (map[string]interface{}, error) {
 	b, err := filesystem.ReadAll(fs, path)
 	if err != nil {
 		return nil, err
@@ -51,6 +52,15 @@ func parseConfig(fs filesystem.FS, path string) (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling %s: %w", path, err)
 	}
 
+	return m, nil
+}
+
+func parseConfig(fs filesystem.FS, path string) (*Config, error) {
+	m, err := ReadJSON(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &Config{
 		BasePath: filepath.Dir(path),
 	}
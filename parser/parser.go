@@ -49,6 +49,27 @@ func ParseStr(code string) (*ast.Module, error) {
 	return a, nil
 }
 
+// ParseDefinitions parses a type definition file like native.d.ts.
+// The declarations are returned in the Types of the file.
+func ParseDefinitions(path, code string) (*ast.File, error) {
+	r := strings.NewReader(code)
+	l := ast.New(r, path)
+	if err := l.Run(); err != nil {
+		return nil, err
+	}
+
+	p := newParser(nil)
+	p.tokens = l.Tokens
+	p.index = 0
+
+	decls, err := p.parseDefinitions(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.File{Path: path, Types: decls}, nil
+}
+
 func ParseExpr(code string) (ast.Expr, error) {
 	r := strings.NewReader(code)
 	l := ast.New(r, "")
@@ -78,6 +99,8 @@ type parser struct {
 	index         int
 	FS            filesystem.FS
 	global        []ast.Stmt
+	types         []ast.Stmt
+	typeImports   []*ast.ImportStmt
 	importedPaths map[string]bool
 }
 
@@ -228,9 +251,9 @@ func (p *parser) parseImports(ast *ast.Module, file *ast.File) error {
 		// because of tsconfig dirs
 		imp.AbsPath = absWithoutExt
 
-		// an import without alias is an import of a
+		// an import without bindings is an import of a
 		// regular source file, not a module
-		notModule := imp.Alias == ""
+		notModule := imp.Alias == "" && imp.Default == "" && len(imp.Names) == 0 && !imp.All
 
 		if notModule {
 			if _, ok := p.importedPaths[absPath]; ok {
@@ -384,14 +407,23 @@ func (p *parser) parseCode(code, absPath string) (*ast.File, error) {
 
 func (p *parser) parse() (*ast.File, error) {
 	file := &ast.File{}
+	p.types = nil
+	p.typeImports = nil
 
 	var directives []*ast.Token
+	var decorators []*ast.Decorator
+	var exportLists []*ast.ImportStmt
 	var lastDirective *ast.Token
 
 loop:
 	for {
 		t := p.peek()
-		switch t.Type {
+		typ := t.Type
+		if p.isAsyncFunc() {
+			typ = ast.FUNCTION
+		}
+
+		switch typ {
 
 		case ast.DIRECTIVE:
 			p.next()
@@ -407,6 +439,15 @@ loop:
 			directives = append(directives, t)
 			lastDirective = t
 
+		case ast.AT:
+			var err error
+			if decorators, err = p.parseDecorators(); err != nil {
+				return nil, err
+			}
+			if !p.isDecoratorTarget() {
+				return nil, NewError(t.Pos, "Decorators are not valid here")
+			}
+
 		case ast.IMPORT:
 			if len(directives) > 0 {
 				return nil, NewError(directives[0].Pos, "invalid directive")
@@ -424,11 +465,18 @@ loop:
 			}
 
 		case ast.FUNCTION:
+			async := p.isAsyncFunc()
+			if async {
+				p.next()
+			}
 			p.next()
 			fnDec, err := p.parseFuncDeclStmt(false, t)
 			if err != nil {
 				return nil, err
 			}
+			fnDec.Async = async
+			fnDec.Decorators = decorators
+			decorators = nil
 
 			if len(directives) > 0 {
 				for _, d := range directives {
@@ -452,6 +500,9 @@ loop:
 			if err != nil {
 				return nil, err
 			}
+			classStmt.Decorators = decorators
+			decorators = nil
+
 			if len(directives) > 0 {
 				for _, d := range directives {
 					classStmt.Directives = append(classStmt.Directives, d.Str)
@@ -474,11 +525,34 @@ loop:
 				return nil, NewError(directives[0].Pos, "invalid directive")
 			}
 
-			if err := p.ignoreInterface(); err != nil {
+			i, err := p.parseInterfaceDecl()
+			if err != nil {
 				return nil, err
 			}
+			p.types = append(p.types, i)
 
 		case ast.EXPORT:
+			switch p.peekTwo().Type {
+			case ast.MUL, ast.LBRACE:
+				exp, err := p.parseExportList()
+				if err != nil {
+					return nil, err
+				}
+				if exp.Path == "" {
+					exportLists = append(exportLists, exp)
+				} else if p.isTypeDefinitionFile(exp.Path) {
+					p.typeImports = append(p.typeImports, exp)
+				} else {
+					file.Imports = append(file.Imports, exp)
+				}
+				continue
+			}
+
+			isDefault := p.peekTwo().Type == ast.DEFAULT
+			if isDefault && file.Default != "" {
+				return nil, NewError(t.Pos, "A module cannot have multiple default exports")
+			}
+
 			// parseExportStmtOrNIL can return nil because there is no
 			// equivalent statement like "export interface"
 			exp, err := p.parseExportStmtOrNIL()
@@ -486,6 +560,22 @@ loop:
 				return nil, err
 			}
 			if exp != nil {
+				if isDefault {
+					file.Default = declName(exp)
+				}
+
+				if len(decorators) > 0 {
+					switch t := exp.(type) {
+					case *ast.FuncDeclStmt:
+						t.Decorators = decorators
+					case *ast.ClassDeclStmt:
+						t.Decorators = decorators
+					default:
+						return nil, NewError(decorators[0].Pos, "Decorators are not valid here")
+					}
+					decorators = nil
+				}
+
 				switch t := exp.(type) {
 				case *ast.FuncDeclStmt:
 					if len(directives) > 0 {
@@ -531,9 +621,11 @@ loop:
 			switch t.Str {
 			case "type":
 				// type definitions like: type a = "foo" | "bar";
-				if err := p.ignoreTypeDefinition(); err != nil {
+				a, err := p.parseTypeAlias()
+				if err != nil {
 					return nil, err
 				}
+				p.types = append(p.types, a)
 
 			case "declare":
 				stmts, err := p.parseDeclareGlobal()
@@ -574,417 +666,1084 @@ loop:
 		}
 	}
 
+	file.Types = p.types
+	file.TypeImports = p.typeImports
 	file.Comments = p.parseComments()
 
+	if err := exportDeclarations(file, exportLists); err != nil {
+		return nil, err
+	}
+
 	return file, nil
 }
 
-func (p *parser) parseComments() []*ast.Comment {
-	var cs []*ast.Comment
+// exportDeclarations marks as exported the declarations
+// in lists like: export { a, b as default }
+func exportDeclarations(file *ast.File, lists []*ast.ImportStmt) error {
+	for _, list := range lists {
+		for _, n := range list.Names {
+			if n.Alias == "default" {
+				if file.Default != "" {
+					return NewError(n.Pos, "A module cannot have multiple default exports")
+				}
+				file.Default = n.Name
+			} else if n.Alias != n.Name {
+				return NewError(n.Pos, "Renaming local exports is not supported")
+			}
 
-	for _, t := range p.tokens {
-		switch t.Type {
-		case ast.COMMENT, ast.MULTILINE_COMMENT:
-			cs = append(cs, &ast.Comment{
-				MultiLine: t.Type == ast.MULTILINE_COMMENT,
-				Str:       t.Str,
-				Pos:       t.Pos,
-			})
+			for _, s := range file.Stms {
+				if declName(s) != n.Name {
+					continue
+				}
+				switch t := s.(type) {
+				case *ast.FuncDeclStmt:
+					t.Exported = true
+				case *ast.ClassDeclStmt:
+					t.Exported = true
+				case *ast.VarDeclStmt:
+					t.Exported = true
+				case *ast.EnumDeclStmt:
+					t.Exported = true
+				}
+			}
+
+			for _, s := range file.Types {
+				switch t := s.(type) {
+				case *ast.InterfaceDeclStmt:
+					if t.Name == n.Name {
+						t.Exported = true
+					}
+				case *ast.TypeAliasStmt:
+					if t.Name == n.Name {
+						t.Exported = true
+					}
+				}
+			}
 		}
 	}
+	return nil
+}
 
-	return cs
+// declName returns the name of a top level declaration.
+func declName(s ast.Stmt) string {
+	switch t := s.(type) {
+	case *ast.FuncDeclStmt:
+		return t.Name
+	case *ast.ClassDeclStmt:
+		return t.Name
+	case *ast.VarDeclStmt:
+		return t.Name
+	case *ast.EnumDeclStmt:
+		return t.Name
+	}
+	return ""
 }
 
-func (p *parser) parseImport() (*ast.ImportStmt, error) {
-	t, err := p.accept(ast.IMPORT)
-	if err != nil {
-		return nil, err
+// parseDefinitions parses the declarations of a definition
+// file or the body of a namespace.
+func (p *parser) parseDefinitions(namespace bool) ([]ast.Stmt, error) {
+	var decls []ast.Stmt
+
+	for {
+		t := p.peek()
+		switch t.Type {
+		case ast.EOF:
+			if namespace {
+				return nil, NewError(t.Pos, "Unclosed namespace")
+			}
+			return decls, nil
+
+		case ast.RBRACE:
+			if !namespace {
+				return nil, NewError(t.Pos, "Unexpected }")
+			}
+			p.next()
+			return decls, nil
+
+		case ast.SEMICOLON:
+			p.next()
+			continue
+
+		case ast.EXPORT:
+			// all the declarations of a namespace are visible to the type checker
+			p.next()
+		}
+
+		if t := p.peek(); t.Type == ast.IDENT && t.Str == "declare" {
+			p.next()
+		}
+
+		d, err := p.parseDefinition()
+		if err != nil {
+			return nil, err
+		}
+
+		decls = append(decls, d)
 	}
+}
 
-	s := p.peek()
-	switch s.Type {
-	case ast.STRING:
-		// if is a source file import: import "foo"
+// parseDefinition parses a declaration without implementation:
+//
+//	interface Foo {}
+//	type Bar = string
+//	function foo(a: string): number
+//	const bar: number
+//	class Baz {}
+//	namespace qux {}
+func (p *parser) parseDefinition() (ast.Stmt, error) {
+	t := p.peek()
+
+	switch t.Type {
+	case ast.INTERFACE:
+		return p.parseInterfaceDecl()
+
+	case ast.ENUM:
+		return p.parseEnumDeclStmt(true)
+
+	case ast.CLASS:
+		return p.parseClassDefinition()
+
+	case ast.FUNCTION:
 		p.next()
+		name, err := p.acceptIdent()
+		if err != nil {
+			return nil, err
+		}
+		f, err := p.parseSignature()
+		if err != nil {
+			return nil, err
+		}
 		p.ignore(ast.SEMICOLON, 1)
-		if p.isTypeDefinitionFile(s.Str) {
-			// ignore imports to type definition files
-			return nil, nil
+		return &ast.DeclareStmt{Pos: name.Pos, Name: name.Str, Type: f}, nil
+
+	case ast.CONST, ast.LET, ast.VAR:
+		p.next()
+		name, err := p.acceptIdent()
+		if err != nil {
+			return nil, err
+		}
+		typ, err := p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
+		}
+		if typ == nil {
+			typ = &ast.TypeRef{Pos: name.Pos, Name: "any"}
+		}
+		if p.peek().Type == ast.ASSIGN {
+			// constants with a value: const foo = 1
+			p.next()
+			v, err := p.parseValueExpression()
+			if err != nil {
+				return nil, err
+			}
+			if k, ok := v.(*ast.ConstantExpr); ok {
+				typ = &ast.LiteralType{Pos: k.Pos, Kind: k.Kind, Value: k.Value}
+			}
 		}
-		return &ast.ImportStmt{Pos: t.Pos, Path: s.Str}, nil
+		p.ignore(ast.SEMICOLON, 1)
+		return &ast.DeclareStmt{Pos: name.Pos, Name: name.Str, Type: typ}, nil
 
-	case ast.LBRACE:
-		return nil, NewError(t.Pos, "Partial imports are not supported. Use import *")
-	}
+	case ast.IDENT:
+		switch t.Str {
+		case "type":
+			return p.parseTypeAlias()
 
-	// it is a module import.
-	// Only full imports are allowed: import * as foo from "x"
-	if _, err := p.accept(ast.MUL); err != nil {
-		return nil, err
+		case "namespace", "module", "global":
+			p.next()
+			ns := &ast.NamespaceDecl{Pos: t.Pos}
+
+			// "declare global {}" adds the declarations to the global scope
+			if t.Str != "global" {
+				name, err := p.parseTypeName()
+				if err != nil {
+					return nil, err
+				}
+				ns.Name = name
+			}
+
+			if _, err := p.accept(ast.LBRACE); err != nil {
+				return nil, err
+			}
+
+			decls, err := p.parseDefinitions(true)
+			if err != nil {
+				return nil, err
+			}
+			ns.Decls = decls
+			return ns, nil
+		}
 	}
 
-	a, err := p.acceptIdent()
+	return nil, NewError(t.Pos, "Unexpected %v in definition", t.Type)
+}
+
+// parseClassDefinition parses a declared class: "declare class Foo {}".
+// Static members and constructors are members of the interface.
+func (p *parser) parseClassDefinition() (*ast.InterfaceDeclStmt, error) {
+	t, err := p.accept(ast.CLASS)
 	if err != nil {
 		return nil, err
 	}
-	if a.Str != "as" {
-		return nil, NewError(a.Pos, "Expected 'as'")
-	}
 
-	alias, err := p.accept(ast.IDENT)
+	name, err := p.acceptIdent()
 	if err != nil {
 		return nil, err
 	}
 
-	if i, err := p.accept(ast.IDENT); err != nil || i.Str != "from" {
-		return nil, err
-	}
+	c := &ast.InterfaceDeclStmt{Pos: t.Pos, Name: name.Str, Class: true}
 
-	path, err := p.accept(ast.STRING)
-	if err != nil {
+	if c.TypeParams, err = p.parseTypeParams(); err != nil {
 		return nil, err
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
-
-	if p.isTypeDefinitionFile(path.Str) {
-		// ignore imports to type definition files
-		return nil, nil
+	for {
+		n := p.peek()
+		if n.Type != ast.IDENT || (n.Str != "extends" && n.Str != "implements") {
+			break
+		}
+		p.next()
+		refs, err := p.parseTypeRefs()
+		if err != nil {
+			return nil, err
+		}
+		c.Extends = append(c.Extends, refs...)
 	}
 
-	imp := &ast.ImportStmt{
-		Pos:   t.Pos,
-		Alias: alias.Str,
-		Path:  path.Str,
+	if c.Body, err = p.parseObjectType(); err != nil {
+		return nil, err
 	}
 
-	return imp, nil
+	p.ignore(ast.SEMICOLON, 1)
+	return c, nil
 }
 
-func (p *parser) parseClassDeclStmt() (*ast.ClassDeclStmt, error) {
-	var err error
-	var t *ast.Token
+func (p *parser) parseComments() []*ast.Comment {
+	var cs []*ast.Comment
 
-	if t, err = p.accept(ast.CLASS); err != nil {
-		return nil, err
+	for _, t := range p.tokens {
+		switch t.Type {
+		case ast.COMMENT, ast.MULTILINE_COMMENT:
+			cs = append(cs, &ast.Comment{
+				MultiLine: t.Type == ast.MULTILINE_COMMENT,
+				Str:       t.Str,
+				Pos:       t.Pos,
+			})
+		}
 	}
 
-	c := &ast.ClassDeclStmt{Pos: t.Pos}
+	return cs
+}
 
-	// class name
-	if t, err = p.accept(ast.IDENT); err != nil {
-		return nil, err
+// docComment returns the comments written just above the declaration
+// that starts with the token t. Consecutive line comments are joined.
+func (p *parser) docComment(t *ast.Token) *ast.Comment {
+	i := p.index - 1
+	for i >= 0 && p.tokens[i] != t {
+		i--
 	}
-	c.Name = t.Str
 
-	if _, err := p.accept(ast.LBRACE); err != nil {
-		return nil, err
+	// skip the modifiers like export or async written before
+	for i > 0 && !isComment(p.tokens[i-1]) && p.tokens[i-1].Pos.Line == t.Pos.Line {
+		i--
 	}
 
-	for {
-		t := p.peek()
-		switch t.Type {
-		case ast.IDENT:
-			var private bool
-			switch t.Str {
-			case "private":
-				private = true
-				t = p.next()
-
-			case "exported":
-				return nil, NewError(t.Pos, "Unexpected 'exported'. Members are exported by default")
-			}
-
-			if p.peekTwo().Type == ast.LPAREN {
-				f, err := p.parseFuncDeclStmt(!private, t)
-				if err != nil {
-					return nil, err
-				}
-				c.Functions = append(c.Functions, f)
-			} else {
-				f, err := p.parseVarDeclStmt(false)
-				if err != nil {
-					return nil, err
-				}
-				f.Exported = !private
-				c.Fields = append(c.Fields, f)
-			}
+	var lines []string
+	var c *ast.Comment
+	line := t.Pos.Line
 
-		case ast.RBRACE:
-			p.next()
-			return c, nil
+	for ; i > 0 && isComment(p.tokens[i-1]); i-- {
+		ct := p.tokens[i-1]
+		// the position of the tokens is where they end
+		if ct.Pos.Line != line-1 {
+			break
+		}
 
-		case ast.EOF:
-			return nil, NewError(t.Pos, "Unclosed class")
+		start := ct.Pos.Line - strings.Count(ct.Str, "\n")
 
-		default:
-			return nil, NewError(t.Pos, "Unexepected %s", t.Str)
+		// a comment at the end of a line of code is not part of the doc
+		if i > 1 && p.tokens[i-2].Pos.Line == start {
+			break
 		}
-	}
-}
 
-/*
-The syntax of a enum is:
+		lines = append([]string{ct.Str}, lines...)
+		line = start
 
-	enum Direction {
-	    Up = 1,
-	    Down,
-	    Left,
-	    Right
+		c = &ast.Comment{
+			MultiLine: ct.Type == ast.MULTILINE_COMMENT || (c != nil && c.MultiLine),
+			Pos:       ct.Pos,
+		}
 	}
 
-	enum Direction {
-		Up = "up",
-		Down = "down"
+	if c == nil {
+		return nil
 	}
 
-we can parse it as a map expression:
+	c.Str = strings.Join(lines, "\n")
+	return c
+}
 
-	let Direction = {
-	    Up: 1,
-	    Down: 2,
-	    Left: 3,
-	    Right: 4
+func (p *parser) parseImport() (*ast.ImportStmt, error) {
+	t, err := p.accept(ast.IMPORT)
+	if err != nil {
+		return nil, err
 	}
 
-*/
-func (p *parser) parseEnumDeclStmt(exported bool) (*ast.EnumDeclStmt, error) {
-	p.next()
+	s := p.peek()
+	switch s.Type {
+	case ast.STRING:
+		// if is a source file import: import "foo"
+		p.next()
+		p.ignore(ast.SEMICOLON, 1)
+		imp := &ast.ImportStmt{Pos: t.Pos, Path: s.Str}
+		if p.isTypeDefinitionFile(s.Str) {
+			// ignore imports to type definition files
+			p.typeImports = append(p.typeImports, imp)
+			return nil, nil
+		}
+		return imp, nil
 
-	t, err := p.accept(ast.IDENT)
+	case ast.IDENT:
+		// type only imports are erased: import type { Foo } from "x"
+		if s.Str == "type" && p.peekTwo().Type != ast.COMMA && !p.isFrom(p.peekTwo()) {
+			p.next()
+			imp, err := p.parseImportClause(t)
+			if err != nil {
+				return nil, err
+			}
+			imp.TypeOnly = true
+			p.typeImports = append(p.typeImports, imp)
+			return nil, nil
+		}
+	}
+
+	imp, err := p.parseImportClause(t)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := p.accept(ast.LBRACE); err != nil {
-		return nil, err
+	if p.isTypeDefinitionFile(imp.Path) {
+		// ignore imports to type definition files
+		p.typeImports = append(p.typeImports, imp)
+		return nil, nil
 	}
 
-	var values []ast.EnumValue
-	i := 0
+	return imp, nil
+}
 
-	for p.peek().Type != ast.RBRACE {
-		tt := p.next()
-		switch t.Type {
-		case ast.IDENT, ast.DELETE:
-		default:
-			return nil, NewError(t.Pos, "Expecting enum value got %v", tt.Type)
+// parseImportClause parses what follows the import keyword in a module import:
+//
+//	import foo from "x"
+//	import * as foo from "x"
+//	import { a, b as c } from "x"
+//	import foo, { a } from "x"
+//	import foo, * as bar from "x"
+func (p *parser) parseImportClause(t *ast.Token) (*ast.ImportStmt, error) {
+	imp := &ast.ImportStmt{Pos: t.Pos}
+
+	if p.peek().Type == ast.IDENT {
+		def, err := p.accept(ast.IDENT)
+		if err != nil {
+			return nil, err
 		}
+		imp.Default = def.Str
 
-		v := &ast.EnumValue{
-			Pos:  tt.Pos,
-			Name: tt.Str,
+		if p.peek().Type != ast.COMMA {
+			return p.parseImportFrom(imp)
 		}
+		p.next()
+	}
 
-		tt = p.peek()
-
-		// allow to specify the value
-		if tt.Type == ast.ASSIGN {
-			p.next()
-
-			tt = p.peek()
-
-			switch tt.Type {
-			case ast.INT:
-				if tt, err = p.accept(ast.INT); err != nil {
-					return nil, err
-				}
-				v.Kind = ast.INT
-				v.Value = &ast.ConstantExpr{Pos: tt.Pos, Kind: ast.INT, Value: tt.Str}
-
-				// if this is the first element start the counter from the first value
-				if i == 0 {
-					if i, err = strconv.Atoi(tt.Str); err != nil {
-						return nil, err
-					}
-				}
+	switch p.peek().Type {
+	case ast.MUL:
+		p.next()
+		a, err := p.acceptIdent()
+		if err != nil {
+			return nil, err
+		}
+		if a.Str != "as" {
+			return nil, NewError(a.Pos, "Expected 'as'")
+		}
 
-			case ast.STRING:
-				p.next()
-				v.Kind = ast.STRING
-				v.Value = &ast.ConstantExpr{Pos: tt.Pos, Kind: ast.STRING, Value: tt.Str}
+		alias, err := p.accept(ast.IDENT)
+		if err != nil {
+			return nil, err
+		}
+		imp.Alias = alias.Str
 
-			default:
-				return nil, NewError(tt.Pos, "Expecting ast.INT or STRING, got %v", tt.Type)
-			}
-		} else {
-			v.Kind = ast.INT
-			v.Value = &ast.ConstantExpr{Pos: tt.Pos, Kind: ast.INT, Value: strconv.Itoa(i)}
+	case ast.LBRACE:
+		names, types, err := p.parseImportNames()
+		if err != nil {
+			return nil, err
 		}
+		imp.Names = names
+		imp.TypeNames = types
 
-		i++
-		p.ignore(ast.COMMA, 1)
-		values = append(values, *v)
+	default:
+		return nil, NewError(p.peek().Pos, "Unexpected %v in import", p.peek().Type)
 	}
 
-	enum := &ast.EnumDeclStmt{
-		Pos:      t.Pos,
-		Name:     t.Str,
-		Values:   values,
-		Exported: exported,
+	return p.parseImportFrom(imp)
+}
+
+// parseImportNames parses a list like { a, b as c, default as d }
+// The type only members are returned in a separate list.
+func (p *parser) parseImportNames() ([]*ast.ImportName, []*ast.ImportName, error) {
+	if _, err := p.accept(ast.LBRACE); err != nil {
+		return nil, nil, err
 	}
 
-	// consume the rbrace
-	p.next()
+	var names, types []*ast.ImportName
 
-	// optional semicolon
-	p.ignore(ast.SEMICOLON, 1)
+	for p.peek().Type != ast.RBRACE {
+		t := p.next()
 
-	return enum, nil
-}
+		switch t.Type {
+		case ast.IDENT, ast.DEFAULT:
+		default:
+			return nil, nil, NewError(t.Pos, "Unexpected %v in import list", t.Type)
+		}
 
-func (p *parser) parseFuncDeclStmt(exported bool, t *ast.Token) (*ast.FuncDeclStmt, error) {
-	var err error
+		// type only members are erased: { type Foo, bar }
+		if t.Type == ast.IDENT && t.Str == "type" && p.peek().Type == ast.IDENT && !p.isAs(p.peek()) {
+			n := p.next()
+			tn := &ast.ImportName{Pos: n.Pos, Name: n.Str, Alias: n.Str}
+			if p.isAs(p.peek()) {
+				p.next()
+				tn.Alias = p.next().Str
+			}
+			types = append(types, tn)
+			p.ignore(ast.COMMA, 1)
+			continue
+		}
 
-	f := &ast.FuncDeclStmt{Pos: t.Pos}
+		n := &ast.ImportName{Pos: t.Pos, Name: t.Str, Alias: t.Str}
 
-	// func name
-	if t, err = p.accept(ast.IDENT); err != nil {
-		return nil, err
-	}
-	f.Name = t.Str
+		if p.isAs(p.peek()) {
+			p.next()
+			a := p.next()
+			switch a.Type {
+			case ast.IDENT, ast.DEFAULT:
+			default:
+				return nil, nil, NewError(a.Pos, "Unexpected %v in import list", a.Type)
+			}
+			n.Alias = a.Str
+		}
 
-	if err := p.ignoreGenericDecl(); err != nil {
-		return nil, err
-	}
+		names = append(names, n)
 
-	args, variadic, err := p.parseArguments()
-	if err != nil {
-		return nil, err
+		if p.peek().Type != ast.COMMA {
+			break
+		}
+		p.next()
 	}
-	f.Args = args
-	f.Variadic = variadic
-	f.Exported = exported
 
-	if err := p.ignoreUnionTypeDecl(); err != nil {
-		return nil, err
+	if _, err := p.accept(ast.RBRACE); err != nil {
+		return nil, nil, err
 	}
 
-	if err := p.ignoreGenericDecl(); err != nil {
+	return names, types, nil
+}
+
+func (p *parser) parseImportFrom(imp *ast.ImportStmt) (*ast.ImportStmt, error) {
+	if i, err := p.accept(ast.IDENT); err != nil {
 		return nil, err
+	} else if i.Str != "from" {
+		return nil, NewError(i.Pos, "Expected 'from'")
 	}
 
-	body, err := p.parseBlockStmt()
+	path, err := p.accept(ast.STRING)
 	if err != nil {
 		return nil, err
 	}
-	f.Body = body
+	imp.Path = path.Str
 
 	p.ignore(ast.SEMICOLON, 1)
+	return imp, nil
+}
 
-	if Optimizations {
-		p.setTailCall(f)
-	}
+func (p *parser) isAs(t *ast.Token) bool {
+	return t.Type == ast.IDENT && t.Str == "as"
+}
 
-	return f, nil
+func (p *parser) isFrom(t *ast.Token) bool {
+	return t.Type == ast.IDENT && t.Str == "from"
 }
 
-// if the function ends in a tail call, replace it
-func (p *parser) setTailCall(f *ast.FuncDeclStmt) {
-	list := f.Body.List
-	ln := len(list)
-	if ln == 0 {
-		return
+// parseExportList parses re-exports and export lists:
+//
+//	export * from "x"
+//	export { a, b as c } from "x"
+//	export { a, b as default }
+//
+// An export list without a path exports declarations of the file.
+func (p *parser) parseExportList() (*ast.ImportStmt, error) {
+	t, err := p.accept(ast.EXPORT)
+	if err != nil {
+		return nil, err
 	}
 
-	lastStmt := list[ln-1]
-
-	var call *ast.CallExpr
+	imp := &ast.ImportStmt{Pos: t.Pos, Export: true}
 
-	switch t := lastStmt.(type) {
-	case *ast.ReturnStmt:
-		var ok bool
-		call, ok = t.Value.(*ast.CallExpr)
-		if !ok {
-			return
+	switch p.peek().Type {
+	case ast.MUL:
+		p.next()
+		if p.isAs(p.peek()) {
+			return nil, NewError(p.peek().Pos, "'export * as' is not supported. Import the module and export it.")
 		}
-
-	case *ast.CallStmt:
-		call = t.CallExpr
+		imp.All = true
+		return p.parseImportFrom(imp)
 
 	default:
-		return
-	}
-
-	ident, ok := call.Ident.(*ast.IdentExpr)
-	if !ok {
-		return
+		names, types, err := p.parseImportNames()
+		if err != nil {
+			return nil, err
+		}
+		imp.Names = names
+		imp.TypeNames = types
 	}
 
-	if ident.Name != f.Name {
-		return
+	if p.isFrom(p.peek()) {
+		return p.parseImportFrom(imp)
 	}
 
-	list[ln-1] = &ast.TailCallStmt{CallExpr: call}
+	p.ignore(ast.SEMICOLON, 1)
+	return imp, nil
 }
 
-func (p *parser) parseLambda() (*ast.FuncDeclExpr, error) {
-	t := p.peek()
-	f := &ast.FuncDeclExpr{Pos: t.Pos}
+func (p *parser) parseClassDeclStmt() (*ast.ClassDeclStmt, error) {
+	var err error
+	var t *ast.Token
 
-	switch t.Type {
-	case ast.LPAREN:
-		args, variadic, err := p.parseArguments()
-		if err != nil {
-			return nil, err
-		}
-		f.Args = args
-		f.Variadic = variadic
-	case ast.IDENT:
-		// only one ident is supported without parenthesis
-		t := p.next()
-		list := []*ast.Field{{Pos: t.Pos, Name: t.Str}}
-		f.Args = &ast.Arguments{Opening: t.Pos, List: list}
+	if t, err = p.accept(ast.CLASS); err != nil {
+		return nil, err
 	}
 
-	_, err := p.accept(ast.LAMBDA)
-	if err != nil {
+	c := &ast.ClassDeclStmt{Pos: t.Pos}
+
+	// class name
+	if t, err = p.accept(ast.IDENT); err != nil {
 		return nil, err
 	}
+	c.Name = t.Str
 
-	// if it's a lambda with body: "(t) => { return t }"
-	if p.peek().Type == ast.LBRACE {
-		block, err := p.parseBlockStmt()
-		if err != nil {
+	if c.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
+	}
+
+	// base class
+	if n := p.peek(); n.Type == ast.IDENT && n.Str == "extends" {
+		p.next()
+		if c.Extends, err = p.parseExtends(); err != nil {
 			return nil, err
 		}
-		f.Body = block
-		return f, nil
 	}
 
-	// The body is an expression: "(t) => t * 2"
-	expr, err := p.parseExpression()
-	if err != nil {
-		return nil, err
+	if n := p.peek(); n.Type == ast.IDENT && n.Str == "implements" {
+		p.next()
+		if c.Implements, err = p.parseTypeRefs(); err != nil {
+			return nil, err
+		}
 	}
 
-	// We need to create a implicit return statment with the expression.
-	ret := &ast.ReturnStmt{Pos: expr.Position(), Value: expr}
-	f.Body = &ast.BlockStmt{Lbrace: expr.Position(), List: []ast.Stmt{ret}}
-	return f, nil
-}
-
-func (p *parser) parseFuncDeclExpr() (*ast.FuncDeclExpr, error) {
-	t, err := p.accept(ast.FUNCTION)
-	if err != nil {
+	if _, err := p.accept(ast.LBRACE); err != nil {
 		return nil, err
 	}
 
-	f := &ast.FuncDeclExpr{Pos: t.Pos}
+	var decorators []*ast.Decorator
 
-	args, variadic, err := p.parseArguments()
-	if err != nil {
-		return nil, err
+	for {
+		t := p.peek()
+		switch t.Type {
+		case ast.AT:
+			if decorators, err = p.parseDecorators(); err != nil {
+				return nil, err
+			}
+
+		case ast.IDENT:
+			var private, static, readonly bool
+
+			// modifiers are followed by the name of the member
+		modifiers:
+			for {
+				if n := p.peekTwo().Type; n != ast.IDENT && n != ast.MUL {
+					break
+				}
+				switch t.Str {
+				case "private":
+					private = true
+				case "public":
+				case "static":
+					static = true
+				case "readonly":
+					readonly = true
+				case "exported":
+					return nil, NewError(t.Pos, "Unexpected 'exported'. Members are exported by default")
+				default:
+					break modifiers
+				}
+				p.next()
+				t = p.peek()
+			}
+
+			var async bool
+			if p.peek().Str == "async" && p.peekTwo().Type == ast.IDENT {
+				async = true
+				t = p.next()
+			}
+
+			var accessor string
+			if s := p.peek().Str; (s == "get" || s == "set") && p.peekTwo().Type == ast.IDENT {
+				accessor = s
+				t = p.next()
+			}
+
+			if p.peek().Type == ast.MUL || p.peekTwo().Type == ast.LPAREN {
+				if readonly {
+					return nil, NewError(t.Pos, "'readonly' can only be used in fields")
+				}
+				f, err := p.parseFuncDeclStmt(!private, t)
+				if err != nil {
+					return nil, err
+				}
+				f.Async = async
+				f.Static = static
+				f.Decorators = decorators
+				decorators = nil
+				switch accessor {
+				case "get":
+					if len(f.Args.List) > 0 {
+						return nil, NewError(f.Pos, "A 'get' accessor cannot have parameters")
+					}
+					f.Getter = true
+				case "set":
+					if len(f.Args.List) != 1 || f.Variadic {
+						return nil, NewError(f.Pos, "A 'set' accessor must have exactly one parameter")
+					}
+					f.Setter = true
+				}
+				c.Functions = append(c.Functions, f)
+			} else if async {
+				return nil, NewError(t.Pos, "Expecting a method after async")
+			} else if accessor != "" {
+				return nil, NewError(t.Pos, "Expecting a method after %s", accessor)
+			} else {
+				if len(decorators) > 0 {
+					return nil, NewError(decorators[0].Pos, "Decorators are only valid in methods")
+				}
+				f, err := p.parseVarDeclStmt(false)
+				if err != nil {
+					return nil, err
+				}
+				f.Exported = !private
+				f.Static = static
+				f.Readonly = readonly
+				c.Fields = append(c.Fields, f)
+			}
+
+		case ast.MUL:
+			// a generator method: "*foo() {}"
+			if p.peekTwo().Type != ast.IDENT {
+				return nil, NewError(t.Pos, "Expecting a method after *")
+			}
+			f, err := p.parseFuncDeclStmt(true, t)
+			if err != nil {
+				return nil, err
+			}
+			f.Decorators = decorators
+			decorators = nil
+			c.Functions = append(c.Functions, f)
+
+		case ast.RBRACE:
+			if len(decorators) > 0 {
+				return nil, NewError(decorators[0].Pos, "Decorators are only valid in methods")
+			}
+			p.next()
+			return c, nil
+
+		case ast.EOF:
+			return nil, NewError(t.Pos, "Unclosed class")
+
+		default:
+			return nil, NewError(t.Pos, "Unexepected %s", t.Str)
+		}
+	}
+}
+
+// parseDecorators parses the decorators of a declaration: @name or @name(args).
+// The name can be qualified: @module.name
+func (p *parser) parseDecorators() ([]*ast.Decorator, error) {
+	var list []*ast.Decorator
+
+	for p.peek().Type == ast.AT {
+		t := p.next()
+
+		n, err := p.accept(ast.IDENT)
+		if err != nil {
+			return nil, err
+		}
+
+		d := &ast.Decorator{Pos: t.Pos, Name: n.Str}
+
+		for p.peek().Type == ast.PERIOD {
+			p.next()
+			n, err := p.accept(ast.IDENT)
+			if err != nil {
+				return nil, err
+			}
+			d.Name += "." + n.Str
+		}
+
+		if p.peek().Type == ast.LPAREN {
+			p.next()
+			for p.peek().Type != ast.RPAREN {
+				exp, err := p.parseExpression()
+				if err != nil {
+					return nil, err
+				}
+				d.Args = append(d.Args, exp)
+
+				if p.peek().Type != ast.COMMA {
+					break
+				}
+				p.next()
+			}
+			if _, err := p.accept(ast.RPAREN); err != nil {
+				return nil, err
+			}
+		}
+
+		list = append(list, d)
+	}
+
+	return list, nil
+}
+
+// isDecoratorTarget returns true if the next declaration can have decorators:
+// a function or a class, exported or not.
+func (p *parser) isDecoratorTarget() bool {
+	i := 0
+	t, _ := p.peekToken(i, false)
+	if t.Type == ast.EXPORT {
+		i++
+		if t, _ = p.peekToken(i, false); t.Type == ast.DEFAULT {
+			i++
+		}
+	}
+
+	t, _ = p.peekToken(i, false)
+	switch t.Type {
+	case ast.FUNCTION, ast.CLASS:
+		return true
+	case ast.IDENT:
+		n, _ := p.peekToken(i+1, false)
+		return t.Str == "async" && n.Type == ast.FUNCTION
+	}
+	return false
+}
+
+// parseExtends parses the name of a base class: Name or module.Name.
+// Type arguments are ignored.
+func (p *parser) parseExtends() (ast.Expr, error) {
+	t, err := p.accept(ast.IDENT)
+	if err != nil {
+		return nil, err
+	}
+
+	var exp ast.Expr = &ast.IdentExpr{Pos: t.Pos, Name: t.Str}
+
+	if p.peek().Type == ast.PERIOD {
+		p.next()
+		s, err := p.accept(ast.IDENT)
+		if err != nil {
+			return nil, err
+		}
+		exp = &ast.SelectorExpr{X: exp, Sel: &ast.IdentExpr{Pos: s.Pos, Name: s.Str}}
+	}
+
+	if p.peek().Type == ast.LSS {
+		if _, err := p.parseTypeArgs(); err != nil {
+			return nil, err
+		}
+	}
+
+	return exp, nil
+}
+
+/*
+The syntax of a enum is:
+
+	enum Direction {
+	    Up = 1,
+	    Down,
+	    Left,
+	    Right
+	}
+
+	enum Direction {
+		Up = "up",
+		Down = "down"
+	}
+
+we can parse it as a map expression:
+
+	let Direction = {
+	    Up: 1,
+	    Down: 2,
+	    Left: 3,
+	    Right: 4
+	}
+
+*/
+func (p *parser) parseEnumDeclStmt(exported bool) (*ast.EnumDeclStmt, error) {
+	p.next()
+
+	t, err := p.accept(ast.IDENT)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.accept(ast.LBRACE); err != nil {
+		return nil, err
+	}
+
+	var values []ast.EnumValue
+	i := 0
+
+	for p.peek().Type != ast.RBRACE {
+		tt := p.next()
+		switch t.Type {
+		case ast.IDENT, ast.DELETE:
+		default:
+			return nil, NewError(t.Pos, "Expecting enum value got %v", tt.Type)
+		}
+
+		v := &ast.EnumValue{
+			Pos:  tt.Pos,
+			Name: tt.Str,
+		}
+
+		tt = p.peek()
+
+		// allow to specify the value
+		if tt.Type == ast.ASSIGN {
+			p.next()
+
+			tt = p.peek()
+
+			switch tt.Type {
+			case ast.INT:
+				if tt, err = p.accept(ast.INT); err != nil {
+					return nil, err
+				}
+				v.Kind = ast.INT
+				v.Value = &ast.ConstantExpr{Pos: tt.Pos, Kind: ast.INT, Value: tt.Str}
+
+				// if this is the first element start the counter from the first value
+				if i == 0 {
+					if i, err = strconv.Atoi(tt.Str); err != nil {
+						return nil, err
+					}
+				}
+
+			case ast.STRING:
+				p.next()
+				v.Kind = ast.STRING
+				v.Value = &ast.ConstantExpr{Pos: tt.Pos, Kind: ast.STRING, Value: tt.Str}
+
+			default:
+				return nil, NewError(tt.Pos, "Expecting ast.INT or STRING, got %v", tt.Type)
+			}
+		} else {
+			v.Kind = ast.INT
+			v.Value = &ast.ConstantExpr{Pos: tt.Pos, Kind: ast.INT, Value: strconv.Itoa(i)}
+		}
+
+		i++
+		p.ignore(ast.COMMA, 1)
+		values = append(values, *v)
+	}
+
+	enum := &ast.EnumDeclStmt{
+		Pos:      t.Pos,
+		Name:     t.Str,
+		Values:   values,
+		Exported: exported,
+	}
+
+	// consume the rbrace
+	p.next()
+
+	// optional semicolon
+	p.ignore(ast.SEMICOLON, 1)
+
+	return enum, nil
+}
+
+func (p *parser) parseFuncDeclStmt(exported bool, t *ast.Token) (*ast.FuncDeclStmt, error) {
+	var err error
+
+	f := &ast.FuncDeclStmt{Pos: t.Pos, Comment: p.docComment(t)}
+
+	// a generator: "function* foo() {}"
+	if p.peek().Type == ast.MUL {
+		p.next()
+		f.Generator = true
+	}
+
+	// func name
+	if t, err = p.accept(ast.IDENT); err != nil {
+		return nil, err
+	}
+	f.Name = t.Str
+
+	if f.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
+	}
+
+	args, variadic, err := p.parseArguments()
+	if err != nil {
+		return nil, err
 	}
 	f.Args = args
 	f.Variadic = variadic
+	f.Exported = exported
+
+	if f.Result, err = p.parseTypeAnnotation(); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBlockStmt()
+	if err != nil {
+		return nil, err
+	}
+	f.Body = body
+
+	p.ignore(ast.SEMICOLON, 1)
+
+	if Optimizations {
+		p.setTailCall(f)
+	}
+
+	return f, nil
+}
+
+// if the function ends in a tail call, replace it
+func (p *parser) setTailCall(f *ast.FuncDeclStmt) {
+	list := f.Body.List
+	ln := len(list)
+	if ln == 0 {
+		return
+	}
+
+	lastStmt := list[ln-1]
+
+	var call *ast.CallExpr
+
+	switch t := lastStmt.(type) {
+	case *ast.ReturnStmt:
+		var ok bool
+		call, ok = t.Value.(*ast.CallExpr)
+		if !ok {
+			return
+		}
+
+	case *ast.CallStmt:
+		call = t.CallExpr
+
+	default:
+		return
+	}
+
+	if call.Spread {
+		return
+	}
+
+	ident, ok := call.Ident.(*ast.IdentExpr)
+	if !ok {
+		return
+	}
+
+	if ident.Name != f.Name {
+		return
+	}
+
+	_, ret := lastStmt.(*ast.ReturnStmt)
+	list[ln-1] = &ast.TailCallStmt{CallExpr: call, Return: ret}
+}
+
+func (p *parser) parseLambda() (*ast.FuncDeclExpr, error) {
+	t := p.peek()
+	f := &ast.FuncDeclExpr{Pos: t.Pos, Lambda: true}
+
+	switch t.Type {
+	case ast.LPAREN:
+		args, variadic, err := p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+		f.Args = args
+		f.Variadic = variadic
+	case ast.IDENT:
+		// only one ident is supported without parenthesis
+		t := p.next()
+		list := []*ast.Field{{Pos: t.Pos, Name: t.Str}}
+		f.Args = &ast.Arguments{Opening: t.Pos, List: list}
+	}
+
+	result, err := p.parseTypeAnnotation()
+	if err != nil {
+		return nil, err
+	}
+	f.Result = result
+
+	if _, err := p.accept(ast.LAMBDA); err != nil {
+		return nil, err
+	}
+
+	// if it's a lambda with body: "(t) => { return t }"
+	if p.peek().Type == ast.LBRACE {
+		block, err := p.parseBlockStmt()
+		if err != nil {
+			return nil, err
+		}
+		f.Body = block
+		return f, nil
+	}
+
+	// The body is an expression: "(t) => t * 2"
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	// We need to create a implicit return statment with the expression.
+	ret := &ast.ReturnStmt{Pos: expr.Position(), Value: expr}
+	f.Body = &ast.BlockStmt{Lbrace: expr.Position(), List: []ast.Stmt{ret}}
+	return f, nil
+}
 
-	if err := p.ignoreUnionTypeDecl(); err != nil {
+func (p *parser) parseFuncDeclExpr() (*ast.FuncDeclExpr, error) {
+	t, err := p.accept(ast.FUNCTION)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ast.FuncDeclExpr{Pos: t.Pos}
+
+	// a generator: "function*() {}"
+	if p.peek().Type == ast.MUL {
+		p.next()
+		f.Generator = true
+	}
+
+	args, variadic, err := p.parseArguments()
+	if err != nil {
 		return nil, err
 	}
+	f.Args = args
+	f.Variadic = variadic
 
-	if err := p.ignoreGenericDecl(); err != nil {
+	if f.Result, err = p.parseTypeAnnotation(); err != nil {
 		return nil, err
 	}
 
@@ -1018,13 +1777,24 @@ func (p *parser) parseArguments() (*ast.Arguments, bool, error) {
 			variadic = true
 		}
 
-		if p.peek().Type != ast.IDENT {
-			break
-		}
+		var f *ast.Field
 
-		t := p.next()
+		t := p.peek()
+		switch t.Type {
+		case ast.IDENT:
+			p.next()
+			f = &ast.Field{Pos: t.Pos, Name: t.Str}
+		case ast.LBRACK, ast.LBRACE:
+			pattern, err := p.parsePattern(true)
+			if err != nil {
+				return nil, false, err
+			}
+			f = &ast.Field{Pos: t.Pos, Pattern: pattern}
+		}
 
-		f := &ast.Field{Pos: t.Pos, Name: t.Str}
+		if f == nil {
+			break
+		}
 
 		if p.peek().Type == ast.QUESTION {
 			f.Optional = true
@@ -1035,12 +1805,23 @@ func (p *parser) parseArguments() (*ast.Arguments, bool, error) {
 
 		p.ignore(ast.QUESTION, 1)
 
-		if err := p.ignoreUnionTypeDecl(); err != nil {
+		var err error
+		if f.Type, err = p.parseTypeAnnotation(); err != nil {
 			return nil, false, err
 		}
 
-		if err := p.ignoreGenericDecl(); err != nil {
-			return nil, false, err
+		// default value: "limit = 10"
+		if p.peek().Type == ast.ASSIGN {
+			if variadic {
+				return nil, false, NewError(t.Pos, "A variadic parameter cannot have a default value")
+			}
+			p.next()
+			exp, err := p.parseValueExpression()
+			if err != nil {
+				return nil, false, err
+			}
+			f.Default = exp
+			f.Optional = true
 		}
 
 		if variadic {
@@ -1083,9 +1864,11 @@ func (p *parser) parseBlockStmt() (*ast.BlockStmt, error) {
 		case ast.IDENT:
 			if t.Str == "type" {
 				// type definitions like: type a = "foo" | "bar";
-				if err := p.ignoreTypeDefinition(); err != nil {
+				a, err := p.parseTypeAlias()
+				if err != nil {
 					return nil, err
 				}
+				p.types = append(p.types, a)
 			} else {
 				stmt, err := p.parseStmt()
 				if err != nil {
@@ -1132,12 +1915,20 @@ func (p *parser) parseStmt() (ast.Stmt, error) {
 		return p.parseForStmt()
 	case ast.WHILE:
 		return p.parseWhileStmt()
+	case ast.DO:
+		return p.parseDoWhileStmt()
 	case ast.IF:
 		return p.parseIfStmt()
 	case ast.SWITCH:
 		return p.parseSwitchStmt()
 	case ast.LPAREN:
+		if p.peekTwo().Type == ast.LBRACE {
+			// a destructuring assignment: ({ a, b } = obj)
+			return p.parsePatternAssignStmt()
+		}
 		return p.parseParenStmt()
+	case ast.LBRACK:
+		return p.parsePatternAssignStmt()
 	case ast.LBRACE:
 		return p.parseBlockStmt()
 	case ast.IDENT:
@@ -1148,6 +1939,10 @@ func (p *parser) parseStmt() (ast.Stmt, error) {
 		return p.parseReturnStmt()
 	case ast.THROW:
 		return p.parseThrow()
+	case ast.AWAIT:
+		return p.parseAwaitStmt()
+	case ast.YIELD:
+		return p.parseYieldStmt()
 	case ast.TRY:
 		return p.parseTryStmt()
 	case ast.BREAK:
@@ -1177,6 +1972,73 @@ func (p *parser) parseStmt() (ast.Stmt, error) {
 	}
 }
 
+func (p *parser) parseAwaitStmt() (*ast.AwaitStmt, error) {
+	exp, err := p.parseAwaitExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.ignore(ast.SEMICOLON, 1)
+	return &ast.AwaitStmt{AwaitExpr: exp}, nil
+}
+
+func (p *parser) parseAwaitExpr() (*ast.AwaitExpr, error) {
+	t, err := p.accept(ast.AWAIT)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := p.parseSignedFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.AwaitExpr{Pos: t.Pos, X: exp}, nil
+}
+
+func (p *parser) parseYieldStmt() (*ast.YieldStmt, error) {
+	exp, err := p.parseYieldExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.ignore(ast.SEMICOLON, 1)
+	return &ast.YieldStmt{YieldExpr: exp}, nil
+}
+
+func (p *parser) parseYieldExpr() (*ast.YieldExpr, error) {
+	t, err := p.accept(ast.YIELD)
+	if err != nil {
+		return nil, err
+	}
+
+	y := &ast.YieldExpr{Pos: t.Pos}
+
+	if p.peek().Type == ast.MUL {
+		p.next()
+		y.Delegate = true
+	}
+
+	// yield without a value
+	next := p.peek()
+	switch next.Type {
+	case ast.SEMICOLON, ast.RBRACE, ast.RPAREN, ast.RBRACK, ast.COMMA, ast.EOF:
+		if y.Delegate {
+			return nil, NewError(next.Pos, "Expecting expression after yield*")
+		}
+		return y, nil
+	}
+	if next.Pos.Line != t.Pos.Line && !y.Delegate {
+		return y, nil
+	}
+
+	exp, err := p.parseValueExpression()
+	if err != nil {
+		return nil, err
+	}
+	y.X = exp
+
+	return y, nil
+}
+
 func (p *parser) parseThrow() (*ast.ThrowStmt, error) {
 	t, err := p.accept(ast.THROW)
 	if err != nil {
@@ -1339,9 +2201,11 @@ func (p *parser) parseDefaultBlock() ([]ast.Stmt, error) {
 		case ast.IDENT:
 			if t.Str == "type" {
 				// type definitions like: type a = "foo" | "bar";
-				if err := p.ignoreTypeDefinition(); err != nil {
+				a, err := p.parseTypeAlias()
+				if err != nil {
 					return nil, err
 				}
+				p.types = append(p.types, a)
 			} else {
 				stmt, err := p.parseStmt()
 				if err != nil {
@@ -1390,9 +2254,11 @@ func (p *parser) parseCaseBlock() (*ast.CaseBlock, error) {
 		case ast.IDENT:
 			if t.Str == "type" {
 				// type definitions like: type a = "foo" | "bar";
-				if err := p.ignoreTypeDefinition(); err != nil {
+				a, err := p.parseTypeAlias()
+				if err != nil {
 					return nil, err
 				}
+				p.types = append(p.types, a)
 			} else {
 				stmt, err := p.parseStmt()
 				if err != nil {
@@ -1481,7 +2347,7 @@ func (p *parser) parseIfStmt() (*ast.IfStmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	ifStmt.IfBlocks = append(ifStmt.IfBlocks, &ast.IfBlock{exp, body})
+	ifStmt.IfBlocks = append(ifStmt.IfBlocks, &ast.IfBlock{Condition: exp, Body: body})
 
 	for {
 		if p.peek().Type != ast.ELSE {
@@ -1502,7 +2368,7 @@ func (p *parser) parseIfStmt() (*ast.IfStmt, error) {
 			if err != nil {
 				return nil, err
 			}
-			ifStmt.IfBlocks = append(ifStmt.IfBlocks, &ast.IfBlock{exp, body})
+			ifStmt.IfBlocks = append(ifStmt.IfBlocks, &ast.IfBlock{Condition: exp, Body: body})
 
 		case ast.LBRACE:
 			body, err = p.parseBlockStmt()
@@ -1524,7 +2390,46 @@ func (p *parser) parseWhileStmt() (*ast.WhileStmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	w := &ast.WhileStmt{Pos: t.Pos}
+	w := &ast.WhileStmt{Pos: t.Pos}
+
+	if _, err := p.accept(ast.LPAREN); err != nil {
+		return nil, err
+	}
+
+	exp, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	w.Expression = exp
+
+	if _, err := p.accept(ast.RPAREN); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBlockStmt()
+	if err != nil {
+		return nil, err
+	}
+	w.Body = body
+	return w, nil
+}
+
+func (p *parser) parseDoWhileStmt() (*ast.WhileStmt, error) {
+	t, err := p.accept(ast.DO)
+	if err != nil {
+		return nil, err
+	}
+	w := &ast.WhileStmt{Pos: t.Pos, Do: true}
+
+	body, err := p.parseBlockStmt()
+	if err != nil {
+		return nil, err
+	}
+	w.Body = body
+
+	if _, err := p.accept(ast.WHILE); err != nil {
+		return nil, err
+	}
 
 	if _, err := p.accept(ast.LPAREN); err != nil {
 		return nil, err
@@ -1540,11 +2445,7 @@ func (p *parser) parseWhileStmt() (*ast.WhileStmt, error) {
 		return nil, err
 	}
 
-	body, err := p.parseBlockStmt()
-	if err != nil {
-		return nil, err
-	}
-	w.Body = body
+	p.ignore(ast.SEMICOLON, 1)
 	return w, nil
 }
 
@@ -1575,8 +2476,8 @@ func (p *parser) parseForDeclarationPart(f *ast.ForStmt) error {
 	// parse the declaration part
 	t := p.peek()
 	switch t.Type {
-	case ast.LET, ast.VAR:
-		switch p.peekThree().Str {
+	case ast.LET, ast.VAR, ast.CONST:
+		switch p.peekAfterGroup(1).Str {
 		case "of", "in":
 			return p.parseForInOfDeclarationPart(f)
 
@@ -1646,8 +2547,8 @@ func (p *parser) parseForInOfDeclarationPart(f *ast.ForStmt) error {
 	t := p.peek()
 
 	switch t.Type {
-	case ast.LET, ast.VAR:
-		switch p.peekThree().Str {
+	case ast.LET, ast.VAR, ast.CONST:
+		switch p.peekAfterGroup(1).Str {
 		case "of", "in":
 			dec, err := p.parseForInOfVarDeclStmt()
 			if err != nil {
@@ -1686,965 +2587,1708 @@ func (p *parser) parseForInOfDeclarationPart(f *ast.ForStmt) error {
 }
 
 func (p *parser) parseForInOfVarDeclStmt() (*ast.VarDeclStmt, error) {
-	p.next()
+	isConst := p.next().Type == ast.CONST
+
+	switch p.peek().Type {
+	case ast.LBRACK, ast.LBRACE:
+		pattern, err := p.parsePattern(true)
+		if err != nil {
+			return nil, err
+		}
+
+		typ, err := p.parseTypeAnnotation()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ast.VarDeclStmt{Pos: pattern.Pos, Pattern: pattern, Type: typ, Const: isConst}, nil
+	}
+
+	t, err := p.accept(ast.IDENT)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, err := p.parseTypeAnnotation()
+	if err != nil {
+		return nil, err
+	}
 
+	return &ast.VarDeclStmt{Pos: t.Pos, Name: t.Str, Type: typ, Const: isConst}, nil
+}
+
+func (p *parser) isPrototype() bool {
+	if p.peek().Type != ast.IDENT {
+		return false
+	}
+	if p.peekTwo().Type != ast.PERIOD {
+		return false
+	}
+	return p.peekThree().Str == "prototype"
+}
+
+func (p *parser) parseMethod() (*ast.FuncDeclStmt, error) {
+	// the format is Map.prototype.Foo = function() {...}
 	t, err := p.accept(ast.IDENT)
 	if err != nil {
 		return nil, err
 	}
+	rt := t.Str
+
+	// consume the ".prototype." part
+	if _, err := p.accept(ast.PERIOD); err != nil {
+		return nil, err
+	}
+	t, err = p.accept(ast.IDENT)
+	if err != nil {
+		return nil, err
+	}
+	if t.Str != "prototype" {
+		return nil, NewError(t.Pos, "Expecting 'prototype', got: '%s'", t.Str)
+	}
+
+	if _, err := p.accept(ast.PERIOD); err != nil {
+		return nil, err
+	}
+
+	f := &ast.FuncDeclStmt{Pos: t.Pos, ReceiverType: rt}
+
+	// func name
+	if t, err = p.accept(ast.IDENT); err != nil {
+		return nil, err
+	}
+	f.Name = t.Str
+
+	// consume the "= function" part
+	if _, err := p.accept(ast.ASSIGN); err != nil {
+		return nil, err
+	}
+	if _, err := p.accept(ast.FUNCTION); err != nil {
+		return nil, err
+	}
+
+	if f.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
+	}
+
+	args, variadic, err := p.parseArguments()
+	if err != nil {
+		return nil, err
+	}
+	f.Args = args
+	f.Variadic = variadic
+
+	if f.Result, err = p.parseTypeAnnotation(); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBlockStmt()
+	if err != nil {
+		return nil, err
+	}
+	f.Body = body
+
+	p.ignore(ast.SEMICOLON, 1)
+
+	return f, nil
+}
+
+func (p *parser) parseNewInstanceStmt() (ast.Stmt, error) {
+	peek := p.peek()
+
+	exp, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := exp.(type) {
+	case *ast.CallExpr:
+		return &ast.CallStmt{CallExpr: t}, nil
+	default:
+		return nil, NewError(peek.Pos, "Unexpected %v", peek.Type)
+	}
+}
+
+func (p *parser) parseParenStmt() (ast.Stmt, error) {
+	exp, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := exp.(type) {
+	case *ast.CallExpr:
+		return &ast.CallStmt{CallExpr: t}, nil
+	}
+
+	t := p.peek()
+
+	switch t.Type {
+	case ast.ASSIGN:
+		return p.parseAssignStmt(exp)
+	case ast.ADD_ASSIGN, ast.SUB_ASSIGN, ast.MUL_ASSIGN,
+		ast.DIV_ASSIGN, ast.BOR_ASSIGN, ast.XOR_ASSIGN,
+		ast.LAND_ASSIGN, ast.LOR_ASSIGN, ast.NOR_ASSIGN:
+		return p.parseAddOrSubAssignStmt(exp)
+	case ast.INC:
+		return p.parseIncStmt(exp)
+	case ast.DEC:
+		return p.parseDecStmt(exp)
+	default:
+		return nil, NewError(t.Pos, "Unexpected %v", t.Type)
+	}
+}
+
+func (p *parser) parseIdentStmt() (ast.Stmt, error) {
+	if p.isPrototype() {
+		return p.parseMethod()
+	}
+
+	ident, err := p.parseIdentExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := ident.(type) {
+	case *ast.CallExpr:
+		return &ast.CallStmt{CallExpr: t}, nil
+	case *ast.IdentExpr:
+		if p.peek().Type == ast.COLON {
+			p.next()
+			return p.parseLabelStmt(t.Name)
+		}
+	}
+
+	t := p.peek()
+	switch t.Type {
+	case ast.ASSIGN:
+		return p.parseAssignStmt(ident)
+	case ast.ADD_ASSIGN, ast.SUB_ASSIGN, ast.MUL_ASSIGN,
+		ast.DIV_ASSIGN, ast.BOR_ASSIGN, ast.XOR_ASSIGN, ast.MOD_ASSIGN,
+		ast.LAND_ASSIGN, ast.LOR_ASSIGN, ast.NOR_ASSIGN:
+		return p.parseAddOrSubAssignStmt(ident)
+	case ast.INC:
+		return p.parseIncStmt(ident)
+	case ast.DEC:
+		return p.parseDecStmt(ident)
+	default:
+		return nil, NewError(t.Pos, "Unexpected %v", t.Type)
+	}
+}
+
+func (p *parser) parseDeleteStmt() (*ast.DeleteStmt, error) {
+	td := p.next()
+
+	t1, err := p.acceptIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.accept(ast.PERIOD); err != nil {
+		return nil, err
+	}
+
+	t2, err := p.acceptIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	exp := &ast.DeleteStmt{
+		Object:   t1.Str,
+		Property: t2.Str,
+		Pos:      td.Pos,
+	}
+
+	return exp, nil
+}
+
+func (p *parser) parseTypeof() (*ast.TypeofExpr, error) {
+	return nil, NewError(p.peek().Pos, "The typeof operator is not valid. Use reflect.typeOf")
+
+	// p.next()
+
+	// exp, err := p.parseFactor()
+	// if err != nil {
+	// 	return nil, err
+	// }
+
+	// return &ast.TypeofExpr{Expr: exp}, nil
+}
+
+func (p *parser) parseLabelStmt(name string) (ast.Stmt, error) {
+	t := p.peek()
+	switch t.Type {
+	case ast.FOR:
+		stmt, err := p.parseForStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmt.SetLabel(name)
+		return stmt, nil
+	case ast.WHILE:
+		stmt, err := p.parseWhileStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmt.SetLabel(name)
+		return stmt, nil
+	case ast.DO:
+		stmt, err := p.parseDoWhileStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmt.SetLabel(name)
+		return stmt, nil
+	case ast.SWITCH:
+		stmt, err := p.parseSwitchStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmt.SetLabel(name)
+		return stmt, nil
+	default:
+		return nil, NewError(t.Pos, "Unexpected %v", t.Type)
+	}
+}
+
+func (p *parser) parseIncStmt(exp ast.Expr) (*ast.IncStmt, error) {
+	_, err := p.accept(ast.INC)
+	if err != nil {
+		return nil, err
+	}
+
+	p.ignore(ast.SEMICOLON, 1)
+	return &ast.IncStmt{Operator: ast.INC, Left: exp}, nil
+}
 
-	if err := p.ignoreUnionTypeDecl(); err != nil {
+func (p *parser) parseDecStmt(exp ast.Expr) (*ast.IncStmt, error) {
+	_, err := p.accept(ast.DEC)
+	if err != nil {
 		return nil, err
 	}
 
-	return &ast.VarDeclStmt{Pos: t.Pos, Name: t.Str}, nil
+	p.ignore(ast.SEMICOLON, 1)
+	return &ast.IncStmt{Operator: ast.DEC, Left: exp}, nil
 }
 
-func (p *parser) isPrototype() bool {
-	if p.peek().Type != ast.IDENT {
-		return false
-	}
-	if p.peekTwo().Type != ast.PERIOD {
-		return false
+func (p *parser) parseAddOrSubAssignStmt(ident ast.Expr) (*ast.AsignStmt, error) {
+	var operator ast.Type
+	switch p.next().Type {
+	case ast.ADD_ASSIGN:
+		operator = ast.ADD
+	case ast.SUB_ASSIGN:
+		operator = ast.SUB
+	case ast.MUL_ASSIGN:
+		operator = ast.MUL
+	case ast.DIV_ASSIGN:
+		operator = ast.DIV
+	case ast.BOR_ASSIGN:
+		operator = ast.BOR
+	case ast.XOR_ASSIGN:
+		operator = ast.XOR
+	case ast.MOD_ASSIGN:
+		operator = ast.MOD
+	case ast.LAND_ASSIGN:
+		operator = ast.LAND
+	case ast.LOR_ASSIGN:
+		operator = ast.LOR
+	case ast.NOR_ASSIGN:
+		operator = ast.NOR
 	}
-	return p.peekThree().Str == "prototype"
-}
 
-func (p *parser) parseMethod() (*ast.FuncDeclStmt, error) {
-	// the format is Map.prototype.Foo = function() {...}
-	t, err := p.accept(ast.IDENT)
+	exp, err := p.parseExpression()
 	if err != nil {
 		return nil, err
 	}
-	rt := t.Str
 
-	// consume the ".prototype." part
-	if _, err := p.accept(ast.PERIOD); err != nil {
-		return nil, err
+	p.ignore(ast.SEMICOLON, 1)
+
+	// convert ast.IDENT += EXP to ast.IDENT = ast.IDENT + EXP
+	b := &ast.BinaryExpr{
+		Operator: operator,
+		Left:     ident,
+		Right:    exp,
 	}
-	t, err = p.accept(ast.IDENT)
+
+	d := &ast.AsignStmt{Left: ident, Value: b}
+	return d, nil
+}
+
+func (p *parser) parseAssignStmt(exp ast.Expr) (*ast.AsignStmt, error) {
+	_, err := p.accept(ast.ASSIGN)
 	if err != nil {
 		return nil, err
 	}
-	if t.Str != "prototype" {
-		return nil, NewError(t.Pos, "Expecting 'prototype', got: '%s'", t.Str)
-	}
 
-	if _, err := p.accept(ast.PERIOD); err != nil {
+	right, err := p.parseValueExpression()
+	if err != nil {
 		return nil, err
 	}
 
-	f := &ast.FuncDeclStmt{Pos: t.Pos, ReceiverType: rt}
+	p.ignore(ast.SEMICOLON, 1)
+	return &ast.AsignStmt{Left: exp, Value: right}, nil
+}
 
-	// func name
-	if t, err = p.accept(ast.IDENT); err != nil {
-		return nil, err
+func (p *parser) parseDeclareGlobal() ([]ast.Stmt, error) {
+	if t := p.next(); t.Str != "declare" {
+		return nil, NewError(t.Pos, "Expected declare")
 	}
-	f.Name = t.Str
 
-	// consume the "= function" part
-	if _, err := p.accept(ast.ASSIGN); err != nil {
-		return nil, err
+	if t := p.next(); t.Str != "global" {
+		return nil, NewError(t.Pos, "Expected global")
 	}
-	if _, err := p.accept(ast.FUNCTION); err != nil {
+
+	if _, err := p.accept(ast.LBRACE); err != nil {
 		return nil, err
 	}
 
-	if err := p.ignoreGenericDecl(); err != nil {
-		return nil, err
+	var stmts []ast.Stmt
+
+loop:
+	for {
+		t := p.peek()
+		switch t.Type {
+
+		case ast.INTERFACE:
+			i, err := p.parseInterfaceDecl()
+			if err != nil {
+				return nil, err
+			}
+			p.types = append(p.types, i)
+
+		case ast.RBRACE:
+			p.next()
+			break loop
+
+		case ast.ENUM:
+			enum, err := p.parseEnumDeclStmt(false)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, enum)
+
+		case ast.CONST:
+			p.next()
+			c, err := p.parseVarDeclStmt(true)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, c)
+
+		default:
+			return nil, NewError(t.Pos, "Unexpected token: %s", t.Str)
+		}
 	}
 
-	args, variadic, err := p.parseArguments()
-	if err != nil {
+	return stmts, nil
+}
+
+// parseExportStmtOrNIL can return nil because there is no
+// equivalent statement like "export interface"
+func (p *parser) parseExportStmtOrNIL() (ast.Stmt, error) {
+	if _, err := p.accept(ast.EXPORT); err != nil {
 		return nil, err
 	}
-	f.Args = args
-	f.Variadic = variadic
 
-	if err := p.ignoreUnionTypeDecl(); err != nil {
-		return nil, err
+	t := p.peek()
+	switch t.Type {
+	case ast.DEFAULT:
+		return p.parseExportDefault()
+
+	case ast.ENUM:
+		return p.parseEnumDeclStmt(true)
+
+	case ast.FUNCTION:
+		p.next()
+		return p.parseFuncDeclStmt(true, t)
+
+	case ast.CLASS:
+		cl, err := p.parseClassDeclStmt()
+		if err != nil {
+			return nil, err
+		}
+		cl.Exported = true
+		return cl, nil
+
+	case ast.INTERFACE:
+		i, err := p.parseInterfaceDecl()
+		if err != nil {
+			return nil, err
+		}
+		i.Exported = true
+		p.types = append(p.types, i)
+		return nil, nil
+
+	case ast.IDENT:
+		if t.Str == "type" {
+			a, err := p.parseTypeAlias()
+			if err != nil {
+				return nil, err
+			}
+			a.Exported = true
+			p.types = append(p.types, a)
+			return nil, nil
+		}
+		if p.isAsyncFunc() {
+			p.next()
+			p.next()
+			f, err := p.parseFuncDeclStmt(true, t)
+			if err != nil {
+				return nil, err
+			}
+			f.Async = true
+			return f, nil
+		}
+		return nil, NewError(t.Pos, "Unexpected %v after export", t.Type)
+
+	case ast.LET, ast.VAR:
+		p.next()
+		s, err := p.parseVarDeclStmt(false)
+		if err != nil {
+			return nil, err
+		}
+		s.Exported = true
+		return s, nil
+	case ast.CONST:
+		p.next()
+		s, err := p.parseVarDeclStmt(true)
+		if err != nil {
+			return nil, err
+		}
+		s.Exported = true
+		return s, nil
+
+	default:
+		return nil, NewError(t.Pos, "Unexpected %v after export", t.Type)
 	}
+}
 
-	if err := p.ignoreGenericDecl(); err != nil {
+// parseExportDefault parses the declaration or expression after "export default".
+// Anonymous functions and expressions are declared with the name "default".
+func (p *parser) parseExportDefault() (ast.Stmt, error) {
+	d, err := p.accept(ast.DEFAULT)
+	if err != nil {
 		return nil, err
 	}
 
-	body, err := p.parseBlockStmt()
+	t := p.peek()
+	switch t.Type {
+	case ast.CLASS:
+		cl, err := p.parseClassDeclStmt()
+		if err != nil {
+			return nil, err
+		}
+		cl.Exported = true
+		return cl, nil
+
+	case ast.FUNCTION:
+		if p.isNamedFunc(1) {
+			p.next()
+			return p.parseFuncDeclStmt(true, t)
+		}
+
+	case ast.IDENT:
+		if p.isAsyncFunc() && p.isNamedFunc(2) {
+			p.next()
+			p.next()
+			f, err := p.parseFuncDeclStmt(true, t)
+			if err != nil {
+				return nil, err
+			}
+			f.Async = true
+			return f, nil
+		}
+	}
+
+	expr, err := p.parseValueExpression()
 	if err != nil {
 		return nil, err
 	}
-	f.Body = body
 
 	p.ignore(ast.SEMICOLON, 1)
 
-	return f, nil
+	return &ast.VarDeclStmt{
+		Pos:      d.Pos,
+		Name:     "default",
+		Value:    expr,
+		Const:    true,
+		Exported: true,
+	}, nil
 }
 
-func (p *parser) parseNewInstanceStmt() (ast.Stmt, error) {
-	peek := p.peek()
+// isNamedFunc returns true if the function keyword at position i is
+// followed by a name: "function foo" or "function* foo".
+func (p *parser) isNamedFunc(i int) bool {
+	t, _ := p.peekToken(i, false)
+	if t.Type == ast.MUL {
+		t, _ = p.peekToken(i+1, false)
+	}
+	return t.Type == ast.IDENT
+}
 
-	exp, err := p.parseExpression()
-	if err != nil {
-		return nil, err
+func (p *parser) parseVarDeclStmt(isConst bool) (*ast.VarDeclStmt, error) {
+	switch p.peek().Type {
+	case ast.LBRACK, ast.LBRACE:
+		return p.parsePatternDeclStmt(isConst)
 	}
 
-	switch t := exp.(type) {
-	case *ast.CallExpr:
-		return &ast.CallStmt{t}, nil
-	default:
-		return nil, NewError(peek.Pos, "Unexpected %v", peek.Type)
+	t, err := p.accept(ast.IDENT)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (p *parser) parseParenStmt() (ast.Stmt, error) {
-	exp, err := p.parseExpression()
+	typ, err := p.parseTypeAnnotation()
 	if err != nil {
 		return nil, err
 	}
 
-	switch t := exp.(type) {
-	case *ast.CallExpr:
-		return &ast.CallStmt{t}, nil
+	if p.peek().Type != ast.ASSIGN {
+		p.ignore(ast.SEMICOLON, 1)
+		v := &ast.ConstantExpr{Pos: t.Pos, Kind: ast.UNDEFINED, Value: "undefined"}
+		return &ast.VarDeclStmt{Pos: t.Pos, Name: t.Str, Type: typ, Value: v}, nil
 	}
 
-	t := p.peek()
+	if _, err := p.accept(ast.ASSIGN); err != nil {
+		return nil, err
+	}
 
-	switch t.Type {
-	case ast.ASSIGN:
-		return p.parseAssignStmt(exp)
-	case ast.ADD_ASSIGN, ast.SUB_ASSIGN, ast.MUL_ASSIGN,
-		ast.DIV_ASSIGN, ast.BOR_ASSIGN, ast.XOR_ASSIGN:
-		return p.parseAddOrSubAssignStmt(exp)
-	case ast.INC:
-		return p.parseIncStmt(exp)
-	case ast.DEC:
-		return p.parseDecStmt(exp)
-	default:
-		return nil, NewError(t.Pos, "Unexpected %v", t.Type)
+	expr, err := p.parseValueExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &ast.VarDeclStmt{
+		Pos:   t.Pos,
+		Name:  t.Str,
+		Type:  typ,
+		Value: expr,
+		Const: isConst,
 	}
+
+	p.ignore(ast.SEMICOLON, 1)
+	return v, nil
 }
 
-func (p *parser) parseIdentStmt() (ast.Stmt, error) {
-	if p.isPrototype() {
-		return p.parseMethod()
+// parsePatternDeclStmt parses a destructuring declaration: let [a, b] = value
+func (p *parser) parsePatternDeclStmt(isConst bool) (*ast.VarDeclStmt, error) {
+	pattern, err := p.parsePattern(true)
+	if err != nil {
+		return nil, err
 	}
 
-	ident, err := p.parseIdentExpr()
+	typ, err := p.parseTypeAnnotation()
 	if err != nil {
 		return nil, err
 	}
 
-	switch t := ident.(type) {
-	case *ast.CallExpr:
-		return &ast.CallStmt{t}, nil
-	case *ast.IdentExpr:
-		if p.peek().Type == ast.COLON {
-			p.next()
-			return p.parseLabelStmt(t.Name)
-		}
+	if t := p.peek(); t.Type != ast.ASSIGN {
+		return nil, NewError(t.Pos, "A destructuring declaration must have an initializer")
 	}
+	p.next()
 
-	t := p.peek()
-	switch t.Type {
-	case ast.ASSIGN:
-		return p.parseAssignStmt(ident)
-	case ast.ADD_ASSIGN, ast.SUB_ASSIGN, ast.MUL_ASSIGN,
-		ast.DIV_ASSIGN, ast.BOR_ASSIGN, ast.XOR_ASSIGN, ast.MOD_ASSIGN:
-		return p.parseAddOrSubAssignStmt(ident)
-	case ast.INC:
-		return p.parseIncStmt(ident)
-	case ast.DEC:
-		return p.parseDecStmt(ident)
-	default:
-		return nil, NewError(t.Pos, "Unexpected %v", t.Type)
+	expr, err := p.parseValueExpression()
+	if err != nil {
+		return nil, err
 	}
+
+	v := &ast.VarDeclStmt{
+		Pos:     pattern.Pos,
+		Pattern: pattern,
+		Type:    typ,
+		Value:   expr,
+		Const:   isConst,
+	}
+
+	p.ignore(ast.SEMICOLON, 1)
+	return v, nil
 }
 
-func (p *parser) parseDeleteStmt() (*ast.DeleteStmt, error) {
-	td := p.next()
+// parsePatternAssignStmt parses a destructuring assignment: [a, b] = [b, a]
+// Object patterns must be enclosed in parens: ({ a, b } = obj)
+func (p *parser) parsePatternAssignStmt() (*ast.AsignStmt, error) {
+	paren := p.peek().Type == ast.LPAREN
+	if paren {
+		p.next()
+	}
 
-	t1, err := p.acceptIdent()
+	pattern, err := p.parsePattern(false)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := p.accept(ast.PERIOD); err != nil {
+	if _, err := p.accept(ast.ASSIGN); err != nil {
 		return nil, err
 	}
 
-	t2, err := p.acceptIdent()
+	right, err := p.parseValueExpression()
 	if err != nil {
 		return nil, err
 	}
 
-	exp := &ast.DeleteStmt{
-		Object:   t1.Str,
-		Property: t2.Str,
-		Pos:      td.Pos,
+	if paren {
+		if _, err := p.accept(ast.RPAREN); err != nil {
+			return nil, err
+		}
 	}
 
-	return exp, nil
+	p.ignore(ast.SEMICOLON, 1)
+	return &ast.AsignStmt{Left: pattern, Value: right}, nil
 }
 
-func (p *parser) parseTypeof() (*ast.TypeofExpr, error) {
-	return nil, NewError(p.peek().Pos, "The typeof operator is not valid. Use reflect.typeOf")
+// parsePattern parses a destructuring pattern like [a, , ...b] or { a, b: c = 1 }.
+// If binding is true it is part of a declaration and the targets can only be
+// identifiers or nested patterns.
+func (p *parser) parsePattern(binding bool) (*ast.PatternExpr, error) {
+	t := p.next()
 
-	// p.next()
+	var closing ast.Type
+	switch t.Type {
+	case ast.LBRACK:
+		closing = ast.RBRACK
+	case ast.LBRACE:
+		closing = ast.RBRACE
+	default:
+		return nil, NewError(t.Pos, "Expecting a destructuring pattern, got %v", t.Type)
+	}
 
-	// exp, err := p.parseFactor()
-	// if err != nil {
-	// 	return nil, err
-	// }
+	pattern := &ast.PatternExpr{Pos: t.Pos, IsObject: t.Type == ast.LBRACE}
 
-	// return &ast.TypeofExpr{Expr: exp}, nil
-}
+	for {
+		t := p.peek()
+		if t.Type == closing {
+			p.next()
+			return pattern, nil
+		}
 
-func (p *parser) parseLabelStmt(name string) (ast.Stmt, error) {
-	t := p.peek()
-	switch t.Type {
-	case ast.FOR:
-		stmt, err := p.parseForStmt()
-		if err != nil {
-			return nil, err
+		e := &ast.PatternElement{Pos: t.Pos}
+
+		if t.Type == ast.COMMA && !pattern.IsObject {
+			// a hole: [, b]
+			p.next()
+			pattern.Elements = append(pattern.Elements, e)
+			continue
 		}
-		stmt.SetLabel(name)
-		return stmt, nil
-	case ast.WHILE:
-		stmt, err := p.parseWhileStmt()
-		if err != nil {
-			return nil, err
+
+		if t.Type == ast.PERIOD {
+			for i := 0; i < 3; i++ {
+				if _, err := p.accept(ast.PERIOD); err != nil {
+					return nil, err
+				}
+			}
+			e.Rest = true
 		}
-		stmt.SetLabel(name)
-		return stmt, nil
-	case ast.SWITCH:
-		stmt, err := p.parseSwitchStmt()
-		if err != nil {
+
+		if pattern.IsObject && !e.Rest {
+			k := p.next()
+			switch k.Type {
+			case ast.IDENT, ast.STRING:
+			default:
+				return nil, NewError(k.Pos, "Expecting property name, got %v", k.Type)
+			}
+			e.Key = k.Str
+
+			if p.peek().Type == ast.COLON {
+				p.next()
+				target, err := p.parsePatternTarget(binding)
+				if err != nil {
+					return nil, err
+				}
+				e.Target = target
+			} else if k.Type == ast.IDENT {
+				e.Target = &ast.IdentExpr{Pos: k.Pos, Name: k.Str}
+			} else {
+				return nil, NewError(k.Pos, "Expecting ':' after %s", k.Str)
+			}
+		} else {
+			target, err := p.parsePatternTarget(binding)
+			if err != nil {
+				return nil, err
+			}
+			e.Target = target
+		}
+
+		if p.peek().Type == ast.ASSIGN {
+			if e.Rest {
+				return nil, NewError(e.Pos, "A rest element can't have a default value")
+			}
+			p.next()
+			def, err := p.parseValueExpression()
+			if err != nil {
+				return nil, err
+			}
+			e.Default = def
+		}
+
+		pattern.Elements = append(pattern.Elements, e)
+
+		if p.peek().Type == closing {
+			continue
+		}
+
+		if e.Rest {
+			return nil, NewError(e.Pos, "A rest element must be the last one")
+		}
+
+		if _, err := p.accept(ast.COMMA); err != nil {
 			return nil, err
 		}
-		stmt.SetLabel(name)
-		return stmt, nil
-	default:
-		return nil, NewError(t.Pos, "Unexpected %v", t.Type)
 	}
 }
 
-func (p *parser) parseIncStmt(exp ast.Expr) (*ast.IncStmt, error) {
-	_, err := p.accept(ast.INC)
-	if err != nil {
-		return nil, err
+func (p *parser) parsePatternTarget(binding bool) (ast.Expr, error) {
+	switch p.peek().Type {
+	case ast.LBRACK, ast.LBRACE:
+		return p.parsePattern(binding)
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
-	return &ast.IncStmt{Operator: ast.INC, Left: exp}, nil
+	if binding {
+		t, err := p.accept(ast.IDENT)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.IdentExpr{Pos: t.Pos, Name: t.Str}, nil
+	}
+
+	return p.parseIdentExpr()
 }
 
-func (p *parser) parseDecStmt(exp ast.Expr) (*ast.IncStmt, error) {
-	_, err := p.accept(ast.DEC)
-	if err != nil {
-		return nil, err
+// parseTypeAnnotation parses the type after a colon: "a: string".
+// It returns nil if there is no annotation.
+func (p *parser) parseTypeAnnotation() (ast.TypeExpr, error) {
+	if p.peek().Type != ast.COLON {
+		return nil, nil
 	}
-
-	p.ignore(ast.SEMICOLON, 1)
-	return &ast.IncStmt{Operator: ast.DEC, Left: exp}, nil
+	p.next()
+	return p.parseType()
 }
 
-func (p *parser) parseAddOrSubAssignStmt(ident ast.Expr) (*ast.AsignStmt, error) {
-	var operator ast.Type
-	switch p.next().Type {
-	case ast.ADD_ASSIGN:
-		operator = ast.ADD
-	case ast.SUB_ASSIGN:
-		operator = ast.SUB
-	case ast.MUL_ASSIGN:
-		operator = ast.MUL
-	case ast.DIV_ASSIGN:
-		operator = ast.DIV
-	case ast.BOR_ASSIGN:
-		operator = ast.BOR
-	case ast.XOR_ASSIGN:
-		operator = ast.XOR
-	case ast.MOD_ASSIGN:
-		operator = ast.MOD
+// parseType parses a type annotation: unions, intersections, arrays, tuples,
+// function and object types, literals and references like Array<T>.
+func (p *parser) parseType() (ast.TypeExpr, error) {
+	pos := p.peek().Pos
+
+	// a leading | is allowed in multiline unions
+	p.ignore(ast.BOR, 1)
+
+	var types []ast.TypeExpr
+	for {
+		t, err := p.parseIntersectionType()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+
+		if p.peek().Type != ast.BOR {
+			break
+		}
+		p.next()
 	}
 
-	exp, err := p.parseExpression()
-	if err != nil {
-		return nil, err
+	if len(types) == 1 {
+		return types[0], nil
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
+	return &ast.UnionType{Pos: pos, Types: types}, nil
+}
 
-	// convert ast.IDENT += EXP to ast.IDENT = ast.IDENT + EXP
-	b := &ast.BinaryExpr{
-		Operator: operator,
-		Left:     ident,
-		Right:    exp,
+func (p *parser) parseIntersectionType() (ast.TypeExpr, error) {
+	pos := p.peek().Pos
+
+	var types []ast.TypeExpr
+	for {
+		t, err := p.parseArrayType()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+
+		if p.peek().Type != ast.AND {
+			break
+		}
+		p.next()
 	}
 
-	d := &ast.AsignStmt{Left: ident, Value: b}
-	return d, nil
+	if len(types) == 1 {
+		return types[0], nil
+	}
+
+	return &ast.IntersectionType{Pos: pos, Types: types}, nil
 }
 
-func (p *parser) parseAssignStmt(exp ast.Expr) (*ast.AsignStmt, error) {
-	_, err := p.accept(ast.ASSIGN)
+// parseArrayType parses a type followed by any number of []
+func (p *parser) parseArrayType() (ast.TypeExpr, error) {
+	start := p.index
+
+	t, err := p.parsePrimaryType()
 	if err != nil {
 		return nil, err
 	}
 
-	right, err := p.parseValueExpression()
-	if err != nil {
-		return nil, err
+	for p.peek().Type == ast.LBRACK {
+		l := p.next()
+
+		if p.peek().Type != ast.RBRACK {
+			// indexed access types like T["key"] are not checked
+			if _, err := p.parseType(); err != nil {
+				return nil, err
+			}
+			if _, err := p.accept(ast.RBRACK); err != nil {
+				return nil, err
+			}
+			t = &ast.TypeRef{Pos: l.Pos, Name: "any", Syntax: p.source(start)}
+			continue
+		}
+
+		p.next()
+		t = &ast.ArrayType{Pos: t.Position(), Elem: t}
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
-	return &ast.AsignStmt{exp, right}, nil
+	return t, nil
 }
 
-func (p *parser) parseDeclareGlobal() ([]ast.Stmt, error) {
-	if t := p.next(); t.Str != "declare" {
-		return nil, NewError(t.Pos, "Expected declare")
-	}
+func (p *parser) parsePrimaryType() (ast.TypeExpr, error) {
+	start := p.index
+	t := p.peek()
+
+	switch t.Type {
+	case ast.LPAREN:
+		// a function type: "(a: T) => void"
+		if p.peekAfterGroup(0).Type == ast.LAMBDA {
+			return p.parseFuncType()
+		}
+
+		// a group: "(A | B)[]"
+		p.next()
+		typ, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.accept(ast.RPAREN); err != nil {
+			return nil, err
+		}
+		return typ, nil
+
+	case ast.LSS:
+		// a generic function type: "<T>(a: T) => T"
+		return p.parseFuncType()
+
+	case ast.NEW:
+		// constructor types are checked as functions: "new () => T"
+		p.next()
+		f, err := p.parseFuncType()
+		if err != nil {
+			return nil, err
+		}
+		f.New = true
+		return f, nil
+
+	case ast.LBRACE:
+		return p.parseObjectType()
+
+	case ast.LBRACK:
+		return p.parseTupleType()
 
-	if t := p.next(); t.Str != "global" {
-		return nil, NewError(t.Pos, "Expected global")
-	}
+	case ast.STRING, ast.INT, ast.HEX, ast.FLOAT, ast.TRUE, ast.FALSE, ast.NULL, ast.UNDEFINED:
+		p.next()
+		return &ast.LiteralType{Pos: t.Pos, Kind: t.Type, Value: t.Str}, nil
 
-	if _, err := p.accept(ast.LBRACE); err != nil {
-		return nil, err
-	}
+	case ast.BACKTICK:
+		// template literal types are checked as strings: `a-${string}`
+		return p.parseTemplateType()
 
-	var stmts []ast.Stmt
+	case ast.SUB:
+		// a negative number: -1
+		p.next()
+		n := p.next()
+		switch n.Type {
+		case ast.INT, ast.FLOAT:
+		default:
+			return nil, NewError(n.Pos, "Expecting a number, got %v", n.Type)
+		}
+		return &ast.LiteralType{Pos: t.Pos, Kind: n.Type, Value: "-" + n.Str}, nil
 
-loop:
-	for {
-		t := p.peek()
-		switch t.Type {
+	case ast.TYPEOF:
+		// typeof types are not checked: "typeof foo"
+		p.next()
+		if _, err := p.parseTypeName(); err != nil {
+			return nil, err
+		}
+		return &ast.TypeRef{Pos: t.Pos, Name: "any", Syntax: p.source(start)}, nil
 
-		case ast.INTERFACE:
-			if err := p.ignoreInterface(); err != nil {
-				return nil, err
+	case ast.IDENT, ast.FUNCTION, ast.CLASS:
+		switch t.Str {
+		case "keyof":
+			// keyof is checked as a string: "keyof T"
+			if p.isTypeStart(p.peekTwo()) {
+				p.next()
+				if _, err := p.parsePrimaryType(); err != nil {
+					return nil, err
+				}
+				return &ast.TypeRef{Pos: t.Pos, Name: "string", Syntax: p.source(start)}, nil
+			}
+		case "readonly", "unique":
+			// modifiers like "readonly string[]"
+			if p.isTypeStart(p.peekTwo()) {
+				p.next()
+				return p.parseArrayType()
 			}
+		}
 
-		case ast.RBRACE:
-			p.next()
-			break loop
+		name, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
 
-		case ast.ENUM:
-			enum, err := p.parseEnumDeclStmt(false)
-			if err != nil {
+		ref := &ast.TypeRef{Pos: t.Pos, Name: name}
+
+		if p.peek().Type == ast.LSS {
+			if ref.Args, err = p.parseTypeArgs(); err != nil {
 				return nil, err
 			}
-			stmts = append(stmts, enum)
+		}
 
-		case ast.CONST:
+		// type predicates are checked as booleans: "v is string"
+		if n := p.peek(); n.Type == ast.IDENT && n.Str == "is" && n.Pos.Line == t.Pos.Line {
 			p.next()
-			c, err := p.parseVarDeclStmt(true)
-			if err != nil {
+			if _, err := p.parseType(); err != nil {
 				return nil, err
 			}
-			stmts = append(stmts, c)
-
-		default:
-			return nil, NewError(t.Pos, "Unexpected token: %s", t.Str)
+			return &ast.TypeRef{Pos: t.Pos, Name: "boolean", Syntax: p.source(start)}, nil
 		}
+
+		return ref, nil
 	}
 
-	return stmts, nil
+	return nil, NewError(t.Pos, "Expecting a type, got %v", t.Type)
 }
 
-// parseExportStmtOrNIL can return nil because there is no
-// equivalent statement like "export interface"
-func (p *parser) parseExportStmtOrNIL() (ast.Stmt, error) {
-	if _, err := p.accept(ast.EXPORT); err != nil {
+// parseTemplateType parses a template literal type. The templates without
+// substitutions are lexed as strings so they are literal types.
+func (p *parser) parseTemplateType() (ast.TypeExpr, error) {
+	t, err := p.accept(ast.BACKTICK)
+	if err != nil {
 		return nil, err
 	}
 
-	t := p.peek()
-	switch t.Type {
-	case ast.ENUM:
-		return p.parseEnumDeclStmt(true)
-
-	case ast.FUNCTION:
-		p.next()
-		return p.parseFuncDeclStmt(true, t)
+	var b strings.Builder
+	b.WriteByte('`')
 
-	case ast.CLASS:
-		cl, err := p.parseClassDeclStmt()
+	for {
+		s, err := p.accept(ast.TEMPLATE)
 		if err != nil {
 			return nil, err
 		}
-		cl.Exported = true
-		return cl, nil
+		b.WriteString(strings.NewReplacer("`", "\\`", "${", "\\${").Replace(s.Str))
 
-	case ast.INTERFACE:
-		if err := p.ignoreInterface(); err != nil {
-			return nil, err
+		if p.peek().Type == ast.BACKTICK {
+			p.next()
+			b.WriteByte('`')
+			return &ast.TypeRef{Pos: t.Pos, Name: "string", Syntax: b.String()}, nil
 		}
-		return nil, nil
 
-	case ast.IDENT:
-		if t.Str == "type" {
-			err := p.ignoreTypeDefinition()
+		if _, err := p.accept(ast.DOLLAR_LBRACE); err != nil {
 			return nil, err
 		}
-		return nil, NewError(t.Pos, "Unexpected %v after export", t.Type)
 
-	case ast.LET, ast.VAR:
-		p.next()
-		s, err := p.parseVarDeclStmt(false)
-		if err != nil {
+		start := p.index
+		if _, err := p.parseType(); err != nil {
 			return nil, err
 		}
-		s.Exported = true
-		return s, nil
-	case ast.CONST:
-		p.next()
-		s, err := p.parseVarDeclStmt(true)
-		if err != nil {
+		b.WriteString("${" + p.source(start) + "}")
+
+		if _, err := p.accept(ast.RBRACE); err != nil {
 			return nil, err
 		}
-		s.Exported = true
-		return s, nil
+	}
+}
 
-	default:
-		return nil, NewError(t.Pos, "Unexpected %v after export", t.Type)
+func (p *parser) isTypeStart(t *ast.Token) bool {
+	switch t.Type {
+	case ast.IDENT, ast.LPAREN, ast.LBRACE, ast.LBRACK, ast.STRING, ast.BACKTICK, ast.TYPEOF:
+		return true
 	}
+	return false
 }
 
-func (p *parser) parseVarDeclStmt(isConst bool) (*ast.VarDeclStmt, error) {
-	t, err := p.accept(ast.IDENT)
+// parseTypeName parses a name with an optional namespace: io.File
+func (p *parser) parseTypeName() (string, error) {
+	t, err := p.acceptIdent()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	name := t.Str
+
+	for p.peek().Type == ast.PERIOD {
+		p.next()
+		t, err := p.acceptIdent()
+		if err != nil {
+			return "", err
+		}
+		name += "." + t.Str
 	}
 
-	if err := p.ignoreUnionTypeDecl(); err != nil {
+	return name, nil
+}
+
+// parseTypeArgs parses the arguments of a generic type: <string, number>
+func (p *parser) parseTypeArgs() ([]ast.TypeExpr, error) {
+	if _, err := p.accept(ast.LSS); err != nil {
 		return nil, err
 	}
 
-	if p.peek().Type != ast.ASSIGN {
-		p.ignore(ast.SEMICOLON, 1)
-		v := &ast.ConstantExpr{t.Pos, ast.UNDEFINED, "undefined"}
-		return &ast.VarDeclStmt{Pos: t.Pos, Name: t.Str, Value: v}, nil
+	var args []ast.TypeExpr
+	for {
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, t)
+
+		if p.peek().Type != ast.COMMA {
+			break
+		}
+		p.next()
 	}
 
-	if _, err := p.accept(ast.ASSIGN); err != nil {
+	if err := p.acceptTypeClose(); err != nil {
 		return nil, err
 	}
 
-	expr, err := p.parseValueExpression()
-	if err != nil {
-		return nil, err
+	return args, nil
+}
+
+// acceptTypeClose accepts the > that closes a list of type parameters or
+// arguments. Nested lists like Array<Array<T>> are lexed as >> so the
+// token is split and only the first > is consumed.
+func (p *parser) acceptTypeClose() error {
+	t, i := p.peekToken(0, false)
+
+	var rest *ast.Token
+	switch t.Type {
+	case ast.GTR:
+		p.next()
+		return nil
+	case ast.RSH:
+		rest = &ast.Token{Type: ast.GTR, Str: ">"}
+	case ast.URSH:
+		rest = &ast.Token{Type: ast.RSH, Str: ">>"}
+	case ast.GEQ:
+		rest = &ast.Token{Type: ast.ASSIGN, Str: "="}
+	default:
+		return NewError(t.Pos, "Expecting %v got %v", ast.GTR, t.Type)
 	}
 
-	v := &ast.VarDeclStmt{
-		Pos:   t.Pos,
-		Name:  t.Str,
-		Value: expr,
-		Const: isConst,
+	rest.Pos = t.Pos
+	rest.Pos.Column++
+	p.index += i - 1
+
+	// split the token to keep the source of the types
+	first := &ast.Token{Type: ast.GTR, Str: ">", Pos: t.Pos}
+	p.tokens[p.index] = first
+	p.index++
+	p.tokens = append(p.tokens[:p.index], append([]*ast.Token{rest}, p.tokens[p.index:]...)...)
+	return nil
+}
+
+// source returns the code of the tokens from start to the current one.
+// It keeps the syntax of the types that are checked as other type.
+func (p *parser) source(start int) string {
+	var b strings.Builder
+	var last *ast.Token
+
+	for _, t := range p.tokens[start:p.index] {
+		if isComment(t) {
+			continue
+		}
+
+		if last != nil && spaceBetween(last, t) {
+			b.WriteByte(' ')
+		}
+
+		switch t.Type {
+		case ast.STRING, ast.RUNE:
+			b.WriteString(strconv.Quote(t.Str))
+		default:
+			b.WriteString(t.Str)
+		}
+
+		last = t
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
-	return v, nil
+	return b.String()
 }
 
-func (p *parser) ignoreUnionTypeDecl() error {
-	if p.peek().Type != ast.COLON {
-		return nil
+func spaceBetween(a, b *ast.Token) bool {
+	switch a.Type {
+	case ast.PERIOD, ast.LPAREN, ast.LBRACK, ast.LSS:
+		return false
 	}
-	p.next()
 
-	if err := p.ignoreTypeDecl(); err != nil {
-		return err
+	switch b.Type {
+	case ast.PERIOD, ast.COMMA, ast.COLON, ast.QUESTION,
+		ast.RPAREN, ast.RBRACK, ast.LBRACK, ast.LSS, ast.GTR:
+		return false
 	}
 
-	// allow union types
-	for p.peek().Type == ast.BOR {
-		p.next()
-		if err := p.ignoreTypeDecl(); err != nil {
-			return err
+	return true
+}
+
+// parseTypeParams parses the parameters of a generic declaration:
+// <T, K extends keyof T = string>
+func (p *parser) parseTypeParams() ([]*ast.TypeParam, error) {
+	if p.peek().Type != ast.LSS {
+		return nil, nil
+	}
+	p.next()
+
+	var params []*ast.TypeParam
+	for {
+		t, err := p.acceptIdent()
+		if err != nil {
+			return nil, err
+		}
+
+		tp := &ast.TypeParam{Pos: t.Pos, Name: t.Str}
+
+		if n := p.peek(); n.Type == ast.IDENT && n.Str == "extends" {
+			p.next()
+			if tp.Constraint, err = p.parseType(); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.peek().Type == ast.ASSIGN {
+			p.next()
+			if tp.Default, err = p.parseType(); err != nil {
+				return nil, err
+			}
+		}
+
+		params = append(params, tp)
+
+		if p.peek().Type != ast.COMMA {
+			break
 		}
+		p.next()
 	}
 
-	if err := p.ignoreGenericDecl(); err != nil {
-		return err
+	if err := p.acceptTypeClose(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return params, nil
 }
 
-func (p *parser) ignoreLambda() error {
-	if err := p.ignoreFuncArgs(); err != nil {
-		return err
+// parseFuncType parses a function type: <T>(a: T) => T
+func (p *parser) parseFuncType() (*ast.FuncType, error) {
+	f := &ast.FuncType{Pos: p.peek().Pos}
+
+	var err error
+	if f.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
 	}
 
-	if _, err := p.accept(ast.LAMBDA); err != nil {
-		return err
+	if f.Params, f.Variadic, err = p.parseFuncTypeParams(); err != nil {
+		return nil, err
 	}
 
-	if err := p.ignoreTypeDecl(); err != nil {
-		return err
+	if _, err := p.accept(ast.LAMBDA); err != nil {
+		return nil, err
 	}
 
-	if err := p.ignoreGenericDecl(); err != nil {
-		return err
+	if f.Result, err = p.parseType(); err != nil {
+		return nil, err
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
-	return nil
+	return f, nil
 }
 
-func (p *parser) ignoreAsExpression() error {
-	t := p.peek()
-	if t.Type != ast.IDENT || t.Str != "as" {
-		return nil
+// parseSignature parses a method signature without body: <T>(a: T): T
+func (p *parser) parseSignature() (*ast.FuncType, error) {
+	f := &ast.FuncType{Pos: p.peek().Pos}
+
+	var err error
+	if f.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
 	}
 
-	p.next()
+	if f.Params, f.Variadic, err = p.parseFuncTypeParams(); err != nil {
+		return nil, err
+	}
 
-	if err := p.ignoreTypeDecl(); err != nil {
-		return err
+	if f.Result, err = p.parseTypeAnnotation(); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return f, nil
 }
 
-func (p *parser) ignoreTypeDecl() error {
-loop:
-	for {
-		t := p.peek()
-		switch t.Type {
-		case ast.LPAREN:
-			if p.peekTwo().Type == ast.IDENT && p.peekThree().Type != ast.COLON {
-				return p.ignoreCompositeType()
-			}
-			if err := p.ignoreLambda(); err != nil {
-				return err
-			}
-		case ast.LBRACE:
-			if err := p.ignoreInterfaceBody(); err != nil {
-				return err
-			}
-		case ast.LBRACK:
-			p.next()
-			if err := p.ignoreInterfaceBody(); err != nil {
-				return err
-			}
-			if _, err := p.accept(ast.RBRACK); err != nil {
-				return err
-			}
-		case ast.IDENT, ast.NULL:
-			p.next()
-			// the type may have a package prefix
-			if p.peek().Type == ast.PERIOD {
-				p.next()
-				if _, err := p.accept(ast.IDENT); err != nil {
-					return err
+// parseFuncTypeParams parses the parameters of a function type.
+func (p *parser) parseFuncTypeParams() ([]*ast.Field, bool, error) {
+	if _, err := p.accept(ast.LPAREN); err != nil {
+		return nil, false, err
+	}
+
+	var params []*ast.Field
+	var variadic bool
+
+	for p.peek().Type != ast.RPAREN {
+		if variadic {
+			return nil, false, NewError(p.peek().Pos, "A rest parameter must be last in a parameter list")
+		}
+
+		if p.peek().Type == ast.PERIOD {
+			// a rest parameter: ...args
+			for i := 0; i < 3; i++ {
+				if _, err := p.accept(ast.PERIOD); err != nil {
+					return nil, false, err
 				}
 			}
-		case ast.STRING:
-			p.next()
+			variadic = true
+		}
+
+		t := p.peek()
+		f := &ast.Field{Pos: t.Pos}
+
+		switch t.Type {
+		case ast.LBRACK, ast.LBRACE:
+			pattern, err := p.parsePattern(true)
+			if err != nil {
+				return nil, false, err
+			}
+			f.Pattern = pattern
 		default:
-			return NewError(t.Pos, "Expecting ast.IDENT or NULL, got %s", t.Str)
+			t, err := p.acceptIdent()
+			if err != nil {
+				return nil, false, err
+			}
+			f.Name = t.Str
 		}
 
-		switch p.peek().Type {
-		case ast.BOR, ast.AND:
+		if p.peek().Type == ast.QUESTION {
 			p.next()
-		default:
-			break loop
+			f.Optional = true
 		}
-	}
 
-	// allow union types
-	for p.peek().Type == ast.LBRACK {
-		p.next()
-		if _, err := p.accept(ast.RBRACK); err != nil {
-			return err
+		var err error
+		if f.Type, err = p.parseTypeAnnotation(); err != nil {
+			return nil, false, err
 		}
-	}
-
-	return nil
-}
-
-// for example: (SaleLine & BankAccount)[]
-func (p *parser) ignoreCompositeType() error {
-	if _, err := p.accept(ast.LPAREN); err != nil {
-		return err
-	}
 
-loop:
-	for {
-		if _, err := p.accept(ast.IDENT); err != nil {
-			return err
-		}
+		params = append(params, f)
 
-		switch p.peek().Type {
-		case ast.BOR, ast.AND:
-			p.next()
-		default:
-			break loop
+		if p.peek().Type != ast.COMMA {
+			break
 		}
+		p.next()
 	}
 
 	if _, err := p.accept(ast.RPAREN); err != nil {
-		return err
+		return nil, false, err
 	}
 
-	for p.peek().Type == ast.LBRACK {
-		p.next()
-		if _, err := p.accept(ast.RBRACK); err != nil {
-			return err
-		}
+	return params, variadic, nil
+}
+
+// parseTupleType parses [A, B]
+func (p *parser) parseTupleType() (*ast.TupleType, error) {
+	t, err := p.accept(ast.LBRACK)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	tuple := &ast.TupleType{Pos: t.Pos}
 
-// ignore type declarations like:
-//
-//   type foo = "bar" | "foo";
-//
-// or:
-//
-//   type foo = () => void;
-//
-func (p *parser) ignoreTypeDefinition() error {
-	p.next()
+	for p.peek().Type != ast.RBRACK {
+		e, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		tuple.Elems = append(tuple.Elems, e)
 
-	if _, err := p.accept(ast.IDENT); err != nil {
-		return err
+		if p.peek().Type != ast.COMMA {
+			break
+		}
+		p.next()
 	}
 
-	if _, err := p.accept(ast.ASSIGN); err != nil {
-		return err
+	if _, err := p.accept(ast.RBRACK); err != nil {
+		return nil, err
 	}
 
-	if err := p.ignoreGenericDecl(); err != nil {
-		return err
-	}
+	return tuple, nil
+}
 
-	if p.peek().Type == ast.LPAREN {
-		return p.ignoreLambda()
+// parseObjectType parses the body of an interface or an object type:
+//
+//	{
+//	    name: string
+//	    age?: number
+//	    readonly id: number
+//	    [key: string]: any
+//	    format(v: any): string
+//	    (v: any): string
+//	}
+func (p *parser) parseObjectType() (*ast.ObjectType, error) {
+	t, err := p.accept(ast.LBRACE)
+	if err != nil {
+		return nil, err
 	}
 
-loop:
-	for {
-		t := p.peek()
-		switch t.Type {
-		case ast.STRING, ast.IDENT:
-			p.next()
-		default:
-			return NewError(t.Pos, "Expecting string or ident, got %v", t.Type)
+	obj := &ast.ObjectType{Pos: t.Pos}
+
+	for p.peek().Type != ast.RBRACE {
+		m, err := p.parseTypeMember()
+		if err != nil {
+			return nil, err
 		}
+		obj.Members = append(obj.Members, m)
 
-		t = p.peek()
-		switch t.Type {
-		case ast.BOR, ast.AND, ast.PERIOD:
+		switch p.peek().Type {
+		case ast.COMMA, ast.SEMICOLON:
 			p.next()
-		default:
-			break loop
 		}
 	}
 
-	p.ignore(ast.SEMICOLON, 1)
-	return nil
-}
-
-func (p *parser) ignoreTypeAssert() error {
-	if p.peek().Type != ast.LSS {
-		return nil
-	}
-
-	p.next()
-	if err := p.ignoreType(); err != nil {
-		return err
+	if _, err := p.accept(ast.RBRACE); err != nil {
+		return nil, err
 	}
 
-	p.ignore(ast.QUESTION, 1)
-	if _, err := p.accept(ast.GTR); err != nil {
-		return err
-	}
-	return nil
+	return obj, nil
 }
 
-// with generics we cant know in advance if ast.IDENT< is
-// an expression or a generic declaration:
-// For example  foo<T>() or foo < T
-// So we peek until we know it and consume it or go back.
-func (p *parser) tryIgnoreGenericDecl() {
-	i := 0
-	if t, _ := p.peekToken(i, false); t.Type != ast.LSS {
-		return
-	}
-	i++
-
-	if t, _ := p.peekToken(i, false); t.Type != ast.IDENT {
-		return
-	}
-	i++
+func (p *parser) parseTypeMember() (*ast.TypeMember, error) {
+	m := &ast.TypeMember{Pos: p.peek().Pos}
 
-	// if it is a selector, advance all its elements
+	// modifiers are followed by the name of the member
 	for {
-		if t, _ := p.peekToken(i, false); t.Type == ast.PERIOD {
-			i++
-		} else {
+		t := p.peek()
+		if t.Type != ast.IDENT || !p.isMemberName(p.peekTwo()) {
 			break
 		}
-		if t, _ := p.peekToken(i, false); t.Type != ast.IDENT {
-			return
+		switch t.Str {
+		case "readonly":
+			m.Readonly = true
+		case "static":
+			m.Static = true
+		case "public", "private", "protected":
+		default:
+			goto name
 		}
-		i++
+		p.next()
 	}
 
-	for {
-		if t, _ := p.peekToken(i, false); t.Type != ast.COMMA {
-			break
-		}
-		i++
+name:
+	t := p.peek()
+	var err error
 
-		if t, _ := p.peekToken(i, false); t.Type != ast.IDENT {
-			return
+	switch {
+	case t.Type == ast.LBRACK:
+		// an index signature: [key: string]: T
+		p.next()
+		start := p.index
+		key, err := p.acceptIdent()
+		if err != nil {
+			return nil, err
 		}
-		i++
+		m.Name = key.Str
 
-		// if it is a selector, advance all its elements
-		for {
-			if t, _ := p.peekToken(i, false); t.Type == ast.PERIOD {
-				i++
-			} else {
-				break
-			}
-			if t, _ := p.peekToken(i, false); t.Type != ast.IDENT {
-				return
+		if p.peek().Type == ast.IN {
+			// mapped types are checked as index signatures: [K in keyof T]: V
+			p.next()
+			if _, err := p.parseType(); err != nil {
+				return nil, err
 			}
-			i++
+			m.KeyType = &ast.TypeRef{Pos: key.Pos, Name: "string", Syntax: p.source(start)}
+		} else if m.KeyType, err = p.parseTypeAnnotation(); err != nil {
+			return nil, err
 		}
-	}
 
-	if t, _ := p.peekToken(i, false); t.Type != ast.GTR {
-		return
-	}
-	i++
+		if _, err := p.accept(ast.RBRACK); err != nil {
+			return nil, err
+		}
 
-	// now we know it was a generic declaration
-	p.index += i
-}
+		p.ignore(ast.QUESTION, 1)
 
-func (p *parser) ignoreGenericDecl() error {
-	if p.peek().Type != ast.LSS {
-		return nil
-	}
+		if m.Type, err = p.parseTypeAnnotation(); err != nil {
+			return nil, err
+		}
+		return m, nil
 
-	p.next()
-	if err := p.ignoreType(); err != nil {
-		return err
-	}
+	case t.Type == ast.LPAREN || t.Type == ast.LSS:
+		// a call signature: (v: any): string
+		m.Method = true
+		m.Type, err = p.parseSignature()
+		return m, err
 
-	n := p.peek()
-	if n.Type == ast.IDENT && n.Str == "extends" {
+	case t.Type == ast.NEW && (p.peekTwo().Type == ast.LPAREN || p.peekTwo().Type == ast.LSS):
+		// a construct signature: new (v: any): Foo
 		p.next()
-		if _, err := p.acceptIdent(); err != nil {
-			return err
-		}
-	}
+		m.Name = "new"
+		m.Method = true
+		m.Type, err = p.parseSignature()
+		return m, err
 
-	for p.peek().Type == ast.COMMA {
+	case t.Type == ast.IDENT && (t.Str == "get" || t.Str == "set") && p.isMemberName(p.peekTwo()):
+		// accessors are checked as properties
 		p.next()
-		if err := p.ignoreType(); err != nil {
-			return err
+		n := p.next()
+		m.Name = n.Str
+		f, err := p.parseSignature()
+		if err != nil {
+			return nil, err
 		}
-
-		n := p.peek()
-		if n.Type == ast.IDENT && n.Str == "extends" {
-			p.next()
-			if _, err := p.acceptIdent(); err != nil {
-				return err
-			}
+		if t.Str == "get" {
+			m.Type = f.Result
+		} else if len(f.Params) > 0 {
+			m.Type = f.Params[0].Type
 		}
+		return m, nil
 	}
 
-	if _, err := p.accept(ast.GTR); err != nil {
-		return err
+	if !p.isMemberName(t) {
+		return nil, NewError(t.Pos, "Expected IDENT, got %v", t.Type)
 	}
+	p.next()
+	m.Name = t.Str
 
-	return nil
-}
-
-func (p *parser) acceptIdent() (*ast.Token, error) {
-	t := p.next()
-
-	switch t.Type {
-	case ast.IDENT, ast.FUNCTION, ast.CLASS:
-	// "Function" is  a valid interface name in compiler
+	if p.peek().Type == ast.QUESTION {
+		p.next()
+		m.Optional = true
+	}
 
-	default:
-		return nil, NewError(t.Pos, "Expecting ast.IDENT got %v", t.Type)
+	switch p.peek().Type {
+	case ast.LPAREN, ast.LSS:
+		m.Method = true
+		m.Type, err = p.parseSignature()
+		return m, err
 	}
 
-	return t, nil
+	m.Type, err = p.parseTypeAnnotation()
+	return m, err
 }
 
-// Ignore the [] after a type: string[]
-func (p *parser) ignoreArrayDecl() error {
-	if p.peek().Type != ast.LBRACK {
-		return nil
+// isMemberName returns true if t can be the name of a member. Keywords
+// are valid names: { default: string, delete(): void }
+func (p *parser) isMemberName(t *ast.Token) bool {
+	switch t.Type {
+	case ast.IDENT, ast.STRING, ast.INT:
+		return true
 	}
-
-	p.next()
-	_, err := p.accept(ast.RBRACK)
-	return err
+	return t.Type >= ast.BREAK
 }
 
-func (p *parser) ignoreType() error {
-	if _, err := p.acceptIdent(); err != nil {
-		return err
+// parseInterfaceDecl parses an interface declaration:
+//
+//	interface Foo<T> extends Bar, Baz<T> {
+//	    name: string
+//	}
+func (p *parser) parseInterfaceDecl() (*ast.InterfaceDeclStmt, error) {
+	t, err := p.accept(ast.INTERFACE)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := p.ignoreArrayDecl(); err != nil {
-		return err
+	name, err := p.acceptIdent()
+	if err != nil {
+		return nil, err
 	}
 
-	for p.peek().Type == ast.PERIOD {
+	i := &ast.InterfaceDeclStmt{Pos: t.Pos, Name: name.Str}
+
+	if i.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
+	}
+
+	switch p.peek().Str {
+	case "extends", "implements":
 		p.next()
-		if _, err := p.acceptIdent(); err != nil {
-			return err
+		if i.Extends, err = p.parseTypeRefs(); err != nil {
+			return nil, err
 		}
-		if err := p.ignoreArrayDecl(); err != nil {
-			return err
+	}
+
+	if i.Body, err = p.parseObjectType(); err != nil {
+		return nil, err
+	}
+
+	p.ignore(ast.SEMICOLON, 1)
+	return i, nil
+}
+
+// parseTypeRefs parses a list of types like: Foo, bar.Baz<T>
+func (p *parser) parseTypeRefs() ([]*ast.TypeRef, error) {
+	var refs []*ast.TypeRef
+
+	for {
+		pos := p.peek().Pos
+		name, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+
+		ref := &ast.TypeRef{Pos: pos, Name: name}
+
+		if p.peek().Type == ast.LSS {
+			if ref.Args, err = p.parseTypeArgs(); err != nil {
+				return nil, err
+			}
+		}
+
+		refs = append(refs, ref)
+
+		if p.peek().Type != ast.COMMA {
+			break
 		}
+		p.next()
 	}
 
-	return nil
+	return refs, nil
 }
 
-func (p *parser) ignoreInterface() error {
-	if _, err := p.accept(ast.INTERFACE); err != nil {
-		return err
+// parseTypeAlias parses type declarations like:
+//
+//	type foo = "bar" | "foo";
+//
+// or:
+//
+//	type foo = () => void;
+func (p *parser) parseTypeAlias() (*ast.TypeAliasStmt, error) {
+	p.next()
+
+	t, err := p.accept(ast.IDENT)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ast.TypeAliasStmt{Pos: t.Pos, Name: t.Str}
+
+	if a.TypeParams, err = p.parseTypeParams(); err != nil {
+		return nil, err
 	}
 
-	if _, err := p.acceptIdent(); err != nil {
-		return err
+	if _, err := p.accept(ast.ASSIGN); err != nil {
+		return nil, err
 	}
 
-	if err := p.ignoreGenericDecl(); err != nil {
-		return err
+	if a.Type, err = p.parseType(); err != nil {
+		return nil, err
 	}
 
-	switch p.peek().Str {
-	case "extends", "implements":
+	p.ignore(ast.SEMICOLON, 1)
+	return a, nil
+}
+
+// parseAsExpr parses a type assertion after an expression: x as Foo
+func (p *parser) parseAsExpr(x ast.Expr) (ast.Expr, error) {
+	for {
+		t := p.peek()
+		if t.Type != ast.IDENT || t.Str != "as" {
+			return x, nil
+		}
+
 		p.next()
-		for {
-			if _, err := p.acceptIdent(); err != nil {
-				return err
-			}
 
-			for p.peek().Type == ast.PERIOD {
-				p.next()
-				if _, err := p.acceptIdent(); err != nil {
-					return err
-				}
-			}
+		// a const assertion: [1, 2] as const
+		if c := p.peek(); c.Type == ast.CONST {
+			p.next()
+			x = &ast.AsExpr{X: x, Type: &ast.TypeRef{Pos: c.Pos, Name: "const"}}
+			continue
+		}
 
-			if p.peek().Type == ast.COMMA {
-				p.next()
-				continue
-			}
-			break
+		typ, err := p.parseType()
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	return p.ignoreInterfaceBody()
+		x = &ast.AsExpr{X: x, Type: typ}
+	}
 }
 
-func (p *parser) ignoreInterfaceBody() error {
-	if _, err := p.accept(ast.LBRACE); err != nil {
+func (p *parser) ignoreTypeAssert() error {
+	if p.peek().Type != ast.LSS {
+		return nil
+	}
+
+	p.next()
+	if _, err := p.parseType(); err != nil {
 		return err
 	}
 
-	for p.peek().Type != ast.RBRACE {
+	return p.acceptTypeClose()
+}
 
-		switch p.peek().Type {
-		case ast.LBRACK:
-			// ignore an indexed interface
-			// For example: [n: number]: T;
-			p.next()
-			if _, err := p.accept(ast.IDENT); err != nil {
-				return err
-			}
-			if err := p.ignoreUnionTypeDecl(); err != nil {
-				return err
-			}
-			if _, err := p.accept(ast.RBRACK); err != nil {
-				return err
-			}
+// with generics we cant know in advance if ast.IDENT< is
+// an expression or a generic declaration:
+// For example  foo<T>() or foo < T
+// So we peek until we know it and consume it or go back.
+// The type arguments are returned to keep them in the ast.
+func (p *parser) tryGenericDecl() []ast.TypeExpr {
+	i := 0
+	if t, _ := p.peekToken(i, false); t.Type != ast.LSS {
+		return nil
+	}
+	i++
 
-		default:
-			t := p.peek()
-			switch t.Type {
-			case ast.IDENT, ast.DEFAULT, ast.FUNCTION, ast.CLASS, ast.ENUM:
-				p.next()
-			default:
-				return NewError(t.Pos, "Expected IDENT, got %v", t.Type)
-			}
+	var args []ast.TypeExpr
 
-			switch p.peek().Type {
-			case ast.LSS:
-				if err := p.ignoreGenericDecl(); err != nil {
-					return err
-				}
-				if err := p.ignoreFuncArgs(); err != nil {
-					return err
-				}
-			case ast.LPAREN:
-				if err := p.ignoreFuncArgs(); err != nil {
-					return err
-				}
-			case ast.QUESTION:
-				p.next()
-			}
+	for {
+		t, _ := p.peekToken(i, false)
+		if t.Type != ast.IDENT {
+			return nil
 		}
+		i++
 
-		if err := p.ignoreUnionTypeDecl(); err != nil {
-			return err
-		}
+		ref := &ast.TypeRef{Pos: t.Pos, Name: t.Str}
 
-		t := p.peek()
-		switch t.Type {
-		case ast.COMMA, ast.SEMICOLON:
-			p.next()
+		// if it is a selector, advance all its elements
+		for {
+			if t, _ := p.peekToken(i, false); t.Type == ast.PERIOD {
+				i++
+			} else {
+				break
+			}
+			t, _ := p.peekToken(i, false)
+			if t.Type != ast.IDENT {
+				return nil
+			}
+			ref.Name += "." + t.Str
+			i++
 		}
-	}
 
-	if _, err := p.accept(ast.RBRACE); err != nil {
-		return err
-	}
+		args = append(args, ref)
 
-	p.ignore(ast.SEMICOLON, 1)
-	return nil
-}
+		if t, _ := p.peekToken(i, false); t.Type != ast.COMMA {
+			break
+		}
+		i++
+	}
 
-func (p *parser) ignoreFuncArgs() error {
-	if _, err := p.accept(ast.LPAREN); err != nil {
-		return err
+	if t, _ := p.peekToken(i, false); t.Type != ast.GTR {
+		return nil
 	}
+	i++
 
-	for p.peek().Type == ast.IDENT {
+	// now we know it was a generic declaration
+	for ; i > 0; i-- {
 		p.next()
+	}
 
-		p.ignore(ast.QUESTION, 1)
+	return args
+}
 
-		if err := p.ignoreUnionTypeDecl(); err != nil {
-			return err
-		}
+func (p *parser) acceptIdent() (*ast.Token, error) {
+	t := p.next()
 
-		p.ignore(ast.COMMA, 1)
-	}
+	switch t.Type {
+	case ast.IDENT, ast.FUNCTION, ast.CLASS:
+	// "Function" is  a valid interface name in compiler
 
-	if _, err := p.accept(ast.RPAREN); err != nil {
-		return err
+	default:
+		return nil, NewError(t.Pos, "Expecting ast.IDENT got %v", t.Type)
 	}
 
-	return nil
+	return t, nil
 }
 
 func (p *parser) parseCallExpr(exp ast.Expr, optional bool) (*ast.CallExpr, error) {
@@ -2692,21 +4336,12 @@ loop:
 			p.next()
 
 		case ast.PERIOD:
-			for i := 0; i < 3; i++ {
-				if _, err := p.accept(ast.PERIOD); err != nil {
-					return nil, false, NewError(t.Pos, "Expecting spread operator")
-				}
-			}
-			spread = true
-			exp, err := p.parseValueExpression()
+			exp, err := p.parseSpreadExpr()
 			if err != nil {
 				return nil, false, err
 			}
+			spread = true
 			args = append(args, exp)
-			if p.peek().Type != ast.RPAREN {
-				return nil, false, NewError(t.Pos, "Spread argument must be the last")
-			}
-			break loop
 
 		default:
 			exp, err := p.parseValueExpression()
@@ -2727,14 +4362,22 @@ func (p *parser) parseValueExpression() (ast.Expr, error) {
 	switch p.peek().Type {
 	case ast.FUNCTION:
 		return p.parseFuncDeclExpr()
+	case ast.YIELD:
+		return p.parseYieldExpr()
 	case ast.LPAREN:
 		// if a expression starts with a paren we need to guess if it is
 		// a lambda. Since the parser is not backtracking we try some basic
 		// heuristics:
 		switch p.peekTwo().Type {
 		case ast.RPAREN:
-			// its a lambda with format: "() => ..."
-			if p.peekThree().Type == ast.LAMBDA {
+			// its a lambda with format: "() => ..." or "(): type => ..."
+			switch p.peekThree().Type {
+			case ast.LAMBDA, ast.COLON:
+				return p.parseLambda()
+			}
+		case ast.LBRACK, ast.LBRACE:
+			// its a lambda with format: "([a, b]) => ..."
+			if p.peekAfterGroup(0).Type == ast.LAMBDA {
 				return p.parseLambda()
 			}
 		case ast.IDENT:
@@ -2748,6 +4391,9 @@ func (p *parser) parseValueExpression() (ast.Expr, error) {
 			case ast.RPAREN:
 				// its a lambda with format: "(t) => ..."
 				return p.parseLambda()
+			case ast.ASSIGN:
+				// its a lambda with format: "(t = 1) => ..."
+				return p.parseLambda()
 			}
 		}
 	case ast.IDENT:
@@ -2755,11 +4401,58 @@ func (p *parser) parseValueExpression() (ast.Expr, error) {
 		if p.peekTwo().Type == ast.LAMBDA {
 			return p.parseLambda()
 		}
+		if p.peek().Str == "async" {
+			if f, ok, err := p.parseAsyncFuncExpr(); ok || err != nil {
+				return f, err
+			}
+		}
 	}
 
 	return p.parseExpression()
 }
 
+// parseAsyncFuncExpr parses "async function() {}", "async () => ..." and
+// "async t => ...". It returns false if async is just an identifier.
+func (p *parser) parseAsyncFuncExpr() (*ast.FuncDeclExpr, bool, error) {
+	var f *ast.FuncDeclExpr
+	var err error
+
+	switch p.peekTwo().Type {
+	case ast.FUNCTION:
+		p.next()
+		f, err = p.parseFuncDeclExpr()
+	case ast.IDENT:
+		if p.peekThree().Type != ast.LAMBDA {
+			return nil, false, nil
+		}
+		p.next()
+		f, err = p.parseLambda()
+	case ast.LPAREN:
+		switch p.peekAfterGroup(1).Type {
+		case ast.LAMBDA, ast.COLON:
+		default:
+			return nil, false, nil
+		}
+		p.next()
+		f, err = p.parseLambda()
+	default:
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	f.Async = true
+	return f, true, nil
+}
+
+// isAsyncFunc returns true if the next tokens are "async function".
+func (p *parser) isAsyncFunc() bool {
+	t := p.peek()
+	return t.Type == ast.IDENT && t.Str == "async" && p.peekTwo().Type == ast.FUNCTION
+}
+
 func (p *parser) parseExpression() (ast.Expr, error) {
 	lh, err := p.parseRelation()
 	if err != nil {
@@ -2834,7 +4527,7 @@ loop:
 				Right:    rh,
 				Operator: t.Type,
 			}
-		case ast.LSH, ast.RSH:
+		case ast.LSH, ast.RSH, ast.URSH:
 			p.next()
 			rh, err := p.parseAdditiveExpr()
 			if err != nil {
@@ -2846,7 +4539,8 @@ loop:
 				Right:    rh,
 				Operator: t.Type,
 			}
-		case ast.EQL, ast.NEQ, ast.SEQ, ast.SNE, ast.LSS, ast.LEQ, ast.GTR, ast.GEQ:
+		case ast.EQL, ast.NEQ, ast.SEQ, ast.SNE, ast.LSS, ast.LEQ, ast.GTR, ast.GEQ,
+			ast.INSTANCEOF, ast.IN:
 			p.next()
 			rh, err := p.parseAdditiveExpr()
 			if err != nil {
@@ -2902,7 +4596,7 @@ loop:
 }
 
 func (p *parser) parseTerm() (ast.Expr, error) {
-	lh, err := p.parseSignedFactor()
+	lh, err := p.parseExponentExpr()
 	if err != nil {
 		return nil, err
 	}
@@ -2915,7 +4609,7 @@ loop:
 		switch t.Type {
 		case ast.MUL, ast.DIV, ast.MOD:
 			p.next()
-			rh, err := p.parseSignedFactor()
+			rh, err := p.parseExponentExpr()
 			if err != nil {
 				return nil, err
 			}
@@ -2928,6 +4622,28 @@ loop:
 	return e, nil
 }
 
+// parseExponentExpr parses a ** b. It is right associative:
+// a ** b ** c is a ** (b ** c)
+func (p *parser) parseExponentExpr() (ast.Expr, error) {
+	lh, err := p.parseSignedFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.Type != ast.POW {
+		return lh, nil
+	}
+
+	p.next()
+	rh, err := p.parseExponentExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.BinaryExpr{Left: lh, Right: rh, Operator: t.Type}, nil
+}
+
 func (p *parser) parseSignedFactor() (ast.Expr, error) {
 	t := p.peek()
 	switch t.Type {
@@ -2939,10 +4655,10 @@ func (p *parser) parseSignedFactor() (ast.Expr, error) {
 		}
 
 		expr = &ast.UnaryExpr{Pos: t.Pos, Operator: t.Type, Operand: expr}
-		if err := p.ignoreAsExpression(); err != nil {
-			return nil, err
-		}
-		return expr, nil
+		return p.parseAsExpr(expr)
+
+	case ast.AWAIT:
+		return p.parseAwaitExpr()
 	}
 
 	expr, err := p.parseFactor()
@@ -2950,11 +4666,7 @@ func (p *parser) parseSignedFactor() (ast.Expr, error) {
 		return nil, err
 	}
 
-	if err := p.ignoreAsExpression(); err != nil {
-		return nil, err
-	}
-
-	return expr, nil
+	return p.parseAsExpr(expr)
 }
 
 func (p *parser) parseMapExpr() (*ast.MapDeclExpr, error) {
@@ -3009,6 +4721,12 @@ loop:
 			break loop
 		case ast.COMMA:
 			p.next()
+		case ast.PERIOD:
+			exp, err := p.parseSpreadExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, ast.KeyValue{Value: exp})
 		default:
 			key := p.next()
 			switch key.Type {
@@ -3042,6 +4760,12 @@ loop:
 			break loop
 		case ast.COMMA:
 			p.next()
+		case ast.PERIOD:
+			exp, err := p.parseSpreadExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, exp)
 		default:
 			exp, err := p.parseValueExpression()
 			if err != nil {
@@ -3054,6 +4778,24 @@ loop:
 	return args, nil
 }
 
+// parseSpreadExpr parses ...exp
+func (p *parser) parseSpreadExpr() (*ast.SpreadExpr, error) {
+	t := p.peek()
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.accept(ast.PERIOD); err != nil {
+			return nil, NewError(t.Pos, "Expecting spread operator")
+		}
+	}
+
+	exp, err := p.parseValueExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.SpreadExpr{Pos: t.Pos, X: exp}, nil
+}
+
 func (p *parser) parseIdentExpr() (ast.Expr, error) {
 	exp, err := p.parseSimpleIdentExpr()
 	if err != nil {
@@ -3074,11 +4816,7 @@ func (p *parser) parseIdentExpr() (ast.Expr, error) {
 		t.First = true
 	}
 
-	if err := p.ignoreAsExpression(); err != nil {
-		return nil, err
-	}
-
-	return v, nil
+	return p.parseAsExpr(v)
 }
 
 // parse the right part after a value, for example:
@@ -3133,6 +4871,12 @@ LOOP:
 			if err != nil {
 				return nil, err
 			}
+		case ast.BACKTICK:
+			// a tagged template: foo`bar`
+			exp, err = p.parseTemplateExpr(exp)
+			if err != nil {
+				return nil, err
+			}
 		case ast.SEMICOLON:
 			p.next()
 			break LOOP
@@ -3144,6 +4888,44 @@ LOOP:
 	return exp, nil
 }
 
+// parseTemplateExpr parses a template literal: `a${b}c`
+// If tag is not nil it is a tagged template: tag`a${b}c`
+func (p *parser) parseTemplateExpr(tag ast.Expr) (*ast.TemplateExpr, error) {
+	t, err := p.accept(ast.BACKTICK)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &ast.TemplateExpr{Pos: t.Pos, Tag: tag}
+
+	for {
+		s, err := p.accept(ast.TEMPLATE)
+		if err != nil {
+			return nil, err
+		}
+		e.Strings = append(e.Strings, s.Str)
+
+		if p.peek().Type == ast.BACKTICK {
+			p.next()
+			return e, nil
+		}
+
+		if _, err := p.accept(ast.DOLLAR_LBRACE); err != nil {
+			return nil, err
+		}
+
+		v, err := p.parseValueExpression()
+		if err != nil {
+			return nil, err
+		}
+		e.Values = append(e.Values, v)
+
+		if _, err := p.accept(ast.RBRACE); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func (p *parser) parseSimpleIdentExpr() (*ast.IdentExpr, error) {
 	t := p.peek()
 
@@ -3178,14 +4960,17 @@ func (p *parser) parseSimpleIdentExpr() (*ast.IdentExpr, error) {
 		ast.FINALLY,
 		ast.THROW,
 		ast.TYPEOF,
+		ast.INSTANCEOF,
+		ast.IN,
+		ast.DO,
 		ast.DELETE:
 		p.next()
 	default:
 		return nil, NewError(t.Pos, "Expecting IDENT, got %v", t.Type)
 	}
 
-	p.tryIgnoreGenericDecl()
-	return &ast.IdentExpr{t.Pos, t.Str}, nil
+	typeArgs := p.tryGenericDecl()
+	return &ast.IdentExpr{Pos: t.Pos, Name: t.Str, TypeArgs: typeArgs}, nil
 }
 
 func (p *parser) parseSelectorExpr(exp ast.Expr, optional bool) (*ast.SelectorExpr, error) {
@@ -3284,21 +5069,32 @@ func (p *parser) parseFactor() (ast.Expr, error) {
 		if err != nil {
 			return nil, NewError(t.Pos, "Error parsing Hex: %v", err)
 		}
-		return &ast.ConstantExpr{t.Pos, ast.INT, strconv.Itoa(int(i))}, nil
+		return &ast.ConstantExpr{Pos: t.Pos, Kind: ast.INT, Value: strconv.Itoa(int(i)), Raw: t.Str}, nil
 
 	case ast.INT, ast.FLOAT, ast.STRING, ast.RUNE:
 		p.next()
-		return &ast.ConstantExpr{t.Pos, t.Type, t.Str}, nil
+		return &ast.ConstantExpr{Pos: t.Pos, Kind: t.Type, Value: t.Str, Raw: t.Raw}, nil
+
+	case ast.REGEX:
+		p.next()
+		return p.parseValueExpr(&ast.ConstantExpr{Pos: t.Pos, Kind: t.Type, Value: t.Str})
+
+	case ast.BACKTICK:
+		exp, err := p.parseTemplateExpr(nil)
+		if err != nil {
+			return nil, err
+		}
+		return p.parseValueExpr(exp)
 
 	case ast.NULL:
 		p.next()
 		// the compiler internally uses nil instead of null.z
-		return &ast.ConstantExpr{t.Pos, ast.NULL, t.Str}, nil
+		return &ast.ConstantExpr{Pos: t.Pos, Kind: ast.NULL, Value: t.Str}, nil
 
 	case ast.UNDEFINED:
 		p.next()
 		// the compiler internally uses nil instead of null.
-		return &ast.ConstantExpr{t.Pos, ast.UNDEFINED, t.Str}, nil
+		return &ast.ConstantExpr{Pos: t.Pos, Kind: ast.UNDEFINED, Value: t.Str}, nil
 
 	case ast.NEW:
 		p.next()
@@ -3341,7 +5137,7 @@ func (p *parser) parseFactor() (ast.Expr, error) {
 
 	case ast.TRUE, ast.FALSE:
 		p.next()
-		return &ast.ConstantExpr{t.Pos, t.Type, t.Str}, nil
+		return &ast.ConstantExpr{Pos: t.Pos, Kind: t.Type, Value: t.Str}, nil
 
 	case ast.LBRACK:
 		return p.parseIndexDeclExpr()
@@ -3374,6 +5170,28 @@ func (p *parser) peekThree() *ast.Token {
 	return t
 }
 
+// peekAfterGroup returns the token after the balanced group of brackets,
+// braces or parens that starts count positions forward. If that token
+// doesn't open a group it returns the next one.
+func (p *parser) peekAfterGroup(count int) *ast.Token {
+	var depth int
+	for i := count; ; i++ {
+		t, _ := p.peekToken(i, false)
+		switch t.Type {
+		case ast.LBRACK, ast.LBRACE, ast.LPAREN:
+			depth++
+		case ast.RBRACK, ast.RBRACE, ast.RPAREN:
+			depth--
+		case ast.EOF:
+			return t
+		}
+		if depth <= 0 {
+			t, _ := p.peekToken(i+1, false)
+			return t
+		}
+	}
+}
+
 func (p *parser) next() *ast.Token {
 	t, i := p.peekToken(0, false)
 	p.index += i
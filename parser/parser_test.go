@@ -92,6 +92,59 @@ func TestParseClassDirectives(t *testing.T) {
 		t.Fatal(class.Directives)
 	}
 }
+
+func TestParseDecorators(t *testing.T) {
+	a, err := ParseStr(`
+		@controller("/users")
+		export class Users {
+			@route.get("/:id", { auth: true })
+			@log
+			get(id: number) { }
+		}
+
+		@task
+		function foo() { }
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class, ok := a.File.Stms[0].(*ast.ClassDeclStmt)
+	if !ok {
+		t.Fatalf("Expected ClassDeclStmt, got %T", a.File.Stms[0])
+	}
+
+	if len(class.Decorators) != 1 || class.Decorators[0].Name != "controller" || len(class.Decorators[0].Args) != 1 {
+		t.Fatal(class.Decorators)
+	}
+
+	m := class.Functions[0].Decorators
+	if len(m) != 2 || m[0].Name != "route.get" || len(m[0].Args) != 2 || m[1].Name != "log" || len(m[1].Args) != 0 {
+		t.Fatal(m)
+	}
+
+	fn, ok := a.File.Stms[1].(*ast.FuncDeclStmt)
+	if !ok {
+		t.Fatalf("Expected FuncDeclStmt, got %T", a.File.Stms[1])
+	}
+
+	if len(fn.Decorators) != 1 || fn.Decorators[0].Name != "task" {
+		t.Fatal(fn.Decorators)
+	}
+}
+
+func TestParseDecoratorsInvalid(t *testing.T) {
+	_, err := ParseStr(`
+		@foo
+		let a = 1
+	`)
+
+	if err == nil || !strings.Contains(err.Error(), "Decorators are not valid here") {
+		t.Fatal(err)
+	}
+}
+
 func TestParseSelector1(t *testing.T) {
 	a, err := ParseStr(`let a = b.c.d`)
 	if err != nil {
@@ -210,3 +263,171 @@ func TestParseSwitchFallthrough3(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseImportClauses(t *testing.T) {
+	a, err := ParseStr(`
+		import def, { a, b as c, default as d } from "x"
+		import type { T } from "y"
+		import * as ns from "z"
+		export * from "w"
+		export { e as f } from "v"
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imports := a.File.Imports
+	if len(imports) != 4 {
+		t.Fatalf("Expected 4 imports, got %d", len(imports))
+	}
+
+	imp := imports[0]
+	if imp.Default != "def" || len(imp.Names) != 3 || imp.Path != "x" {
+		t.Fatal(imp)
+	}
+	if imp.Names[1].Name != "b" || imp.Names[1].Alias != "c" || imp.Names[2].Name != "default" {
+		t.Fatal(imp.Names)
+	}
+
+	if imports[1].Alias != "ns" {
+		t.Fatal(imports[1])
+	}
+	if !imports[2].All || !imports[2].Export {
+		t.Fatal(imports[2])
+	}
+	if !imports[3].Export || imports[3].Names[0].Alias != "f" {
+		t.Fatal(imports[3])
+	}
+}
+
+func TestParseExportDefault(t *testing.T) {
+	a, err := ParseStr(`
+		export default function foo() {}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.File.Default != "foo" {
+		t.Fatal(a.File.Default)
+	}
+
+	_, err = ParseStr(`
+		export default 1
+		export default 2
+	`)
+	if err == nil || !strings.Contains(err.Error(), "multiple default exports") {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTypeAnnotations(t *testing.T) {
+	a, err := ParseStr(`
+		interface Point<T> { x: T; y?: T }
+		type Kind = "a" | "b"
+		function foo(p: Point<number>, k: Kind): string[] { return [] }
+		let f = (a: number): number => a * 2
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.File.Types) != 2 {
+		t.Fatalf("Expected 2 types, got %d", len(a.File.Types))
+	}
+
+	iface, ok := a.File.Types[0].(*ast.InterfaceDeclStmt)
+	if !ok || iface.Name != "Point" || len(iface.TypeParams) != 1 || len(iface.Body.Members) != 2 {
+		t.Fatal(a.File.Types[0])
+	}
+	if !iface.Body.Members[1].Optional {
+		t.Fatal(iface.Body.Members[1])
+	}
+
+	fn := a.File.Stms[0].(*ast.FuncDeclStmt)
+	if ref, ok := fn.Args.List[0].Type.(*ast.TypeRef); !ok || ref.Name != "Point" || len(ref.Args) != 1 {
+		t.Fatal(fn.Args.List[0].Type)
+	}
+	if _, ok := fn.Result.(*ast.ArrayType); !ok {
+		t.Fatal(fn.Result)
+	}
+
+	lambda := a.File.Stms[1].(*ast.VarDeclStmt).Value.(*ast.FuncDeclExpr)
+	if ref, ok := lambda.Result.(*ast.TypeRef); !ok || ref.Name != "number" {
+		t.Fatal(lambda.Result)
+	}
+}
+
+func TestParseTemplateLiteralType(t *testing.T) {
+	a, err := ParseStr(`
+		type L = ` + "`a-${string}`" + `
+		type M = ` + "`${L | \"b\"}-${number}px`" + `
+		let x: ` + "`a${string}`" + ` = "ab"
+		let y: ` + "`plain`" + ` = "plain"
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, syntax := range []string{"`a-${string}`", "`${L | \"b\"}-${number}px`"} {
+		alias := a.File.Types[i].(*ast.TypeAliasStmt)
+		if ref, ok := alias.Type.(*ast.TypeRef); !ok || ref.Name != "string" || ref.Syntax != syntax {
+			t.Fatalf("unexpected type %#v", alias.Type)
+		}
+	}
+
+	x := a.File.Stms[0].(*ast.VarDeclStmt)
+	if ref, ok := x.Type.(*ast.TypeRef); !ok || ref.Name != "string" || ref.Syntax != "`a${string}`" {
+		t.Fatalf("unexpected type %#v", x.Type)
+	}
+
+	y := a.File.Stms[1].(*ast.VarDeclStmt)
+	if lit, ok := y.Type.(*ast.LiteralType); !ok || lit.Value != "plain" {
+		t.Fatalf("unexpected type %#v", y.Type)
+	}
+}
+
+func TestParseFuncComment(t *testing.T) {
+	a, err := ParseStr(`
+		let a = 1 // not a doc
+
+		// Sum returns
+		// the sum.
+		export function sum(a, b) {
+			return a + b
+		}
+
+		/**
+		 * Sub returns the difference.
+		 */
+		function sub(a, b) {
+			return a - b
+		}
+
+		function noDoc() {
+		}
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := make(map[string]*ast.Comment)
+	for _, s := range a.File.Stms {
+		if fn, ok := s.(*ast.FuncDeclStmt); ok {
+			docs[fn.Name] = fn.Comment
+		}
+	}
+
+	if c := docs["sum"]; c == nil || c.MultiLine || c.Str != " Sum returns\n the sum." {
+		t.Fatalf("unexpected comment %+v", c)
+	}
+
+	if c := docs["sub"]; c == nil || !c.MultiLine || !strings.Contains(c.Str, "Sub returns the difference.") {
+		t.Fatalf("unexpected comment %+v", c)
+	}
+
+	if c := docs["noDoc"]; c != nil {
+		t.Fatalf("unexpected comment %+v", c)
+	}
+}
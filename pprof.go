@@ -0,0 +1,175 @@
+package dune
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// writeProfile encodes the profile with the message definitions of
+// github.com/google/pprof/proto/profile.proto
+func writeProfile(w io.Writer, p *Profiler) error {
+	strs := &stringTable{index: map[string]int64{"": 0}, list: []string{""}}
+	b := &protobuf{}
+
+	sampleTypes := [profileValues][2]string{
+		{"samples", "count"},
+		{"wall", "nanoseconds"},
+		{"allocations", "count"},
+		{"alloc_space", "bytes"},
+	}
+
+	for _, t := range sampleTypes {
+		b.valueType(1, strs.id(t[0]), strs.id(t[1]))
+	}
+
+	for _, key := range p.keys {
+		s := p.samples[key]
+		b.message(2, func(m *protobuf) {
+			m.packedUint64(1, s.locations)
+			m.packedInt64(2, s.values[:])
+		})
+	}
+
+	locations := make([]profileLocation, len(p.locations))
+	for l, id := range p.locations {
+		locations[id-1] = l
+	}
+
+	for i, l := range locations {
+		id, l := uint64(i+1), l
+		b.message(4, func(m *protobuf) {
+			m.uint64(1, id)
+			m.message(4, func(line *protobuf) {
+				line.uint64(1, l.function)
+				line.int64(2, int64(l.line))
+			})
+		})
+	}
+
+	functions := make([]profileFunction, len(p.functions))
+	for f, id := range p.functions {
+		functions[id-1] = f
+	}
+
+	for i, f := range functions {
+		id, f := uint64(i+1), f
+		b.message(5, func(m *protobuf) {
+			m.uint64(1, id)
+			m.int64(2, strs.id(f.name))
+			m.int64(3, strs.id(f.name))
+			m.int64(4, strs.id(f.file))
+		})
+	}
+
+	end := p.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	b.int64(9, p.start.UnixNano())
+	b.int64(10, int64(end.Sub(p.start)))
+	b.valueType(11, strs.id("wall"), strs.id("nanoseconds"))
+	b.int64(14, strs.id("wall"))
+
+	for _, s := range strs.list {
+		b.string(6, s)
+	}
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(b.data); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+type stringTable struct {
+	index map[string]int64
+	list  []string
+}
+
+func (t *stringTable) id(s string) int64 {
+	i, ok := t.index[s]
+	if !ok {
+		i = int64(len(t.list))
+		t.index[s] = i
+		t.list = append(t.list, s)
+	}
+	return i
+}
+
+// protobuf writes the wire format of protocol buffers. Fields
+// with the default value are omitted like the official encoders.
+type protobuf struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) key(tag, wire int) {
+	b.varint(uint64(tag)<<3 | uint64(wire))
+}
+
+func (b *protobuf) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(tag, wireVarint)
+	b.varint(x)
+}
+
+func (b *protobuf) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+func (b *protobuf) string(tag int, s string) {
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protobuf) packedUint64(tag int, xs []uint64) {
+	m := &protobuf{}
+	for _, x := range xs {
+		m.varint(x)
+	}
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+func (b *protobuf) packedInt64(tag int, xs []int64) {
+	m := &protobuf{}
+	for _, x := range xs {
+		m.varint(uint64(x))
+	}
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+func (b *protobuf) message(tag int, encode func(m *protobuf)) {
+	m := &protobuf{}
+	encode(m)
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+func (b *protobuf) valueType(tag int, typ, unit int64) {
+	b.message(tag, func(m *protobuf) {
+		m.int64(1, typ)
+		m.int64(2, unit)
+	})
+}
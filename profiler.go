@@ -0,0 +1,194 @@
+package dune
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrProfiling = errors.New("the vm is already being profiled")
+
+// Profiler samples the call stack of a VM to find the functions and
+// lines of the program where the time is spent and the memory allocated.
+//
+// The time is sampled each Period instructions and it is the wall time
+// since the last sample so it includes the time blocked in native
+// functions. The allocations are sampled each AllocRate allocated size.
+type Profiler struct {
+	Period    int
+	AllocRate int64
+
+	mu        sync.Mutex
+	start     time.Time
+	end       time.Time
+	last      time.Time
+	steps     int
+	allocs    int64
+	allocated int64
+	samples   map[string]*profileSample
+	keys      []string // the samples in the order they were found
+	locations map[profileLocation]uint64
+	functions map[profileFunction]uint64
+}
+
+type profileSample struct {
+	locations []uint64
+	values    [profileValues]int64
+}
+
+// the sample types: samples, wall, allocations and alloc_space.
+const profileValues = 4
+
+type profileLocation struct {
+	function uint64
+	line     int
+}
+
+type profileFunction struct {
+	name string
+	file string
+}
+
+// NewProfiler returns a profiler with the default sampling rates.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		Period:    1000,
+		AllocRate: 64 * 1024,
+		samples:   make(map[string]*profileSample),
+		locations: make(map[profileLocation]uint64),
+		functions: make(map[profileFunction]uint64),
+	}
+}
+
+// StartProfile starts sampling the execution. The async functions
+// executed in other goroutines are not profiled.
+func (vm *VM) StartProfile(p *Profiler) error {
+	if vm.profiler != nil {
+		return ErrProfiling
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	p.start = now
+	p.last = now
+	p.mu.Unlock()
+
+	vm.profiler = p
+	return nil
+}
+
+// StopProfile stops sampling and returns the profiler or nil if it was not started.
+func (vm *VM) StopProfile() *Profiler {
+	p := vm.profiler
+	if p == nil {
+		return nil
+	}
+
+	vm.profiler = nil
+
+	p.mu.Lock()
+	p.end = time.Now()
+	p.mu.Unlock()
+
+	return p
+}
+
+// step is called by the vm for each instruction.
+func (p *Profiler) step(vm *VM) {
+	p.steps++
+	if p.steps < p.Period {
+		return
+	}
+
+	p.steps = 0
+
+	now := time.Now()
+	p.record(vm, [profileValues]int64{1, int64(now.Sub(p.last)), 0, 0})
+	p.last = now
+}
+
+// allocation is called by the vm for each allocation.
+func (p *Profiler) allocation(vm *VM, size int) {
+	p.allocs++
+	p.allocated += int64(size)
+	if p.allocated < p.AllocRate {
+		return
+	}
+
+	p.record(vm, [profileValues]int64{0, 0, p.allocs, p.allocated})
+	p.allocs = 0
+	p.allocated = 0
+}
+
+// record adds the values to the sample of the current call stack.
+func (p *Profiler) record(vm *VM, values [profileValues]int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prog := vm.Program
+	locations := make([]uint64, 0, vm.fp+1)
+
+	for i := vm.fp; i >= 0; i-- {
+		frame := vm.callStack[i]
+		f := prog.Functions[frame.funcIndex]
+
+		if f.IsGlobal && vm.initialized {
+			// the global function has ended
+			continue
+		}
+
+		// the pc of the callers has already advanced past the call
+		pc := frame.pc
+		if i != vm.fp && pc > 0 {
+			pc--
+		}
+
+		locations = append(locations, p.location(prog.ToTraceLine(f, pc)))
+	}
+
+	var b strings.Builder
+	for _, l := range locations {
+		b.WriteString(strconv.FormatUint(l, 10))
+		b.WriteByte(',')
+	}
+	key := b.String()
+
+	s, ok := p.samples[key]
+	if !ok {
+		s = &profileSample{locations: locations}
+		p.samples[key] = s
+		p.keys = append(p.keys, key)
+	}
+
+	for i, v := range values {
+		s.values[i] += v
+	}
+}
+
+func (p *Profiler) location(line TraceLine) uint64 {
+	fn := profileFunction{name: line.Function, file: line.File}
+	fid, ok := p.functions[fn]
+	if !ok {
+		fid = uint64(len(p.functions) + 1)
+		p.functions[fn] = fid
+	}
+
+	loc := profileLocation{function: fid, line: line.Line}
+	id, ok := p.locations[loc]
+	if !ok {
+		id = uint64(len(p.locations) + 1)
+		p.locations[loc] = id
+	}
+
+	return id
+}
+
+// Write writes the profile in the gzipped protobuf format of pprof.
+func (p *Profiler) Write(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return writeProfile(w, p)
+}
@@ -27,79 +27,93 @@ const (
 	AddrUnresolved
 )
 
-type Address struct {
-	Kind  AddressKind
-	Value int32
+// Address is an operand of an instruction packed in a single word:
+// the kind in the low 4 bits and the signed value in the other 28.
+type Address uint32
+
+const (
+	addrKindBits = 4
+	addrKindMask = 1<<addrKindBits - 1
+
+	// the range of the value of an address
+	maxAddrValue = 1<<(31-addrKindBits) - 1
+	minAddrValue = -1 << (31 - addrKindBits)
+)
+
+// addressError is the panic of NewAddress if the value doesn't fit. The
+// compiler recovers it to report the programs that are too big.
+type addressError struct {
+	kind  AddressKind
+	value int
 }
 
-func (a *Address) Copy() *Address {
-	if a == Void {
-		return a // the copy must be the same ref
-	}
+func (e *addressError) Error() string {
+	return fmt.Sprintf("address out of range: %d %v. The limit is %d", e.value, e.kind, maxAddrValue)
+}
 
-	return &Address{
-		Kind:  a.Kind,
-		Value: a.Value,
+// NewAddress packs the kind and the value. It panics if the value doesn't
+// fit in 28 bits because the address would point to a different operand.
+func NewAddress(kind AddressKind, value int) Address {
+	if value > maxAddrValue || value < minAddrValue {
+		panic(&addressError{kind, value})
 	}
+	return Address(uint32(int32(value))<<addrKindBits | uint32(kind))
+}
+
+func (r Address) Kind() AddressKind {
+	return AddressKind(r & addrKindMask)
 }
 
-func NewAddress(kind AddressKind, value int) *Address {
-	return &Address{kind, int32(value)}
+func (r Address) Value() int32 {
+	return int32(r) >> addrKindBits
 }
 
-func (r *Address) Equal(b *Address) bool {
-	return r.Kind == b.Kind && r.Value == b.Value
+func (r Address) Equal(b Address) bool {
+	return r == b
 }
 
-func (r *Address) String() string {
-	switch r.Kind {
+func (r Address) String() string {
+	switch r.Kind() {
 	case AddrEnum:
-		return fmt.Sprintf("%dE", r.Value)
+		return fmt.Sprintf("%dE", r.Value())
 	case AddrFunc:
-		return fmt.Sprintf("%dF", r.Value)
+		return fmt.Sprintf("%dF", r.Value())
 	case AddrNativeFunc:
-		return fmt.Sprintf("%dN", r.Value)
+		return fmt.Sprintf("%dN", r.Value())
 	case AddrConstant:
-		return fmt.Sprintf("%dK", r.Value)
+		return fmt.Sprintf("%dK", r.Value())
 	case AddrGlobal:
-		return fmt.Sprintf("%dG", r.Value)
+		return fmt.Sprintf("%dG", r.Value())
 	case AddrLocal:
-		return fmt.Sprintf("%dL", r.Value)
+		return fmt.Sprintf("%dL", r.Value())
 	case AddrClosure:
-		return fmt.Sprintf("%dC", r.Value)
+		return fmt.Sprintf("%dC", r.Value())
 	case AddrClass:
-		return fmt.Sprintf("%dA", r.Value)
+		return fmt.Sprintf("%dA", r.Value())
 	case AddrData:
-		return fmt.Sprintf("%dD", r.Value)
+		return fmt.Sprintf("%dD", r.Value())
 	case AddrUnresolved:
-		return fmt.Sprintf("%dU", r.Value)
+		return fmt.Sprintf("%dU", r.Value())
 	case AddrVoid:
 		return "--"
 	default:
-		return fmt.Sprintf("%d-%d?", r.Kind, r.Value)
+		return fmt.Sprintf("%d-%d?", r.Kind(), r.Value())
 	}
 }
 
 var Void = NewAddress(AddrVoid, 0)
 
+// Instruction is stored by value in a flat slice so the
+// vm doesn't need to follow pointers to execute the code.
 type Instruction struct {
 	Opcode Opcode
-	A      *Address
-	B      *Address
-	C      *Address
-}
-
-func (r *Instruction) Copy() *Instruction {
-	copy := &Instruction{}
-	copy.Opcode = r.Opcode
-	copy.A = r.A.Copy()
-	copy.B = r.B.Copy()
-	copy.C = r.C.Copy()
-	return copy
+	A      Address
+	B      Address
+	C      Address
 }
 
-func NewInstruction(op Opcode, a, b, c *Address) *Instruction {
-	return &Instruction{op, a, b, c}
+func NewInstruction(op Opcode, a, b, c Address) Instruction {
+	return Instruction{op, a, b, c}
 }
 
 func (i *Instruction) String() string {
@@ -118,7 +132,7 @@ type Register struct {
 	EndPC    int
 	Exported bool
 	Module   string
-	KAddress *Address
+	KAddress Address
 }
 
 func (r *Register) Copy() *Register {
@@ -143,9 +157,91 @@ type Class struct {
 	Name       string
 	Exported   bool
 	Module     string
+	Base       int // the index of the base class or -1
 	Fields     []*Field
 	Functions  []int
 	Directives []string
+	Decorators []*Decorator
+}
+
+// Decorator is the metadata declared with @name(args) in a class or a function.
+// The arguments are constant values evaluated by the compiler.
+type Decorator struct {
+	Name string
+	Args []Value
+}
+
+func (d *Decorator) String() string {
+	args := make([]string, len(d.Args))
+	for i, v := range d.Args {
+		args[i] = v.String()
+	}
+	return "@" + d.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// FindDecorator returns the first decorator with the name or nil.
+func FindDecorator(decorators []*Decorator, name string) *Decorator {
+	for _, d := range decorators {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// ToValue returns the decorator as an object: { name, args }. The arguments
+// are copied because they are shared by all the executions of the program.
+func (d *Decorator) ToValue() Value {
+	args := make([]Value, len(d.Args))
+	for i, v := range d.Args {
+		args[i] = copyConstant(v)
+	}
+
+	return NewMapValues(map[Value]Value{
+		NewString("name"): NewString(d.Name),
+		NewString("args"): NewArrayValues(args),
+	})
+}
+
+func copyConstant(v Value) Value {
+	switch v.Type {
+	case Array:
+		a := v.ToArray()
+		values := make([]Value, len(a))
+		for i, item := range a {
+			values[i] = copyConstant(item)
+		}
+		return NewArrayValues(values)
+
+	case Map:
+		m := v.ToMap().Map
+		values := make(map[Value]Value, len(m))
+		for k, item := range m {
+			values[k] = copyConstant(item)
+		}
+		return NewMapValues(values)
+	}
+
+	return v
+}
+
+// Decorators returns the decorators of a function, a closure
+// or the class of an instance.
+func (p *Program) Decorators(v Value) []*Decorator {
+	switch v.Type {
+	case Func:
+		return p.Functions[v.ToFunction()].Decorators
+
+	case Object:
+		switch t := v.ToObject().(type) {
+		case *Closure:
+			return p.Functions[t.FuncIndex].Decorators
+		case *instance:
+			return t.class.Decorators
+		}
+	}
+
+	return nil
 }
 
 func (c *Class) Copy() *Class {
@@ -153,12 +249,15 @@ func (c *Class) Copy() *Class {
 
 	copy.Name = c.Name
 	copy.Exported = c.Exported
+	copy.Base = c.Base
 
 	copy.Fields = make([]*Field, len(c.Fields))
 	for i, v := range c.Fields {
 		copy.Fields[i] = &Field{
 			Name:     v.Name,
 			Exported: v.Exported,
+			Static:   v.Static,
+			Readonly: v.Readonly,
 		}
 	}
 
@@ -167,12 +266,64 @@ func (c *Class) Copy() *Class {
 		copy.Functions[i] = v
 	}
 
+	copy.Decorators = c.Decorators
+
 	return copy
 }
 
+// BaseClass returns the class that cl extends or nil.
+func (p *Program) BaseClass(cl *Class) *Class {
+	if cl.Base < 0 {
+		return nil
+	}
+	return p.Classes[cl.Base]
+}
+
+// ClassFunction returns the method of the class or of its base classes.
+func (p *Program) ClassFunction(cl *Class, name string) (*Function, bool) {
+	return p.findClassFunction(cl, func(f *Function) bool {
+		return f.Name == name && !f.Static && !f.Getter && !f.Setter
+	})
+}
+
+// ClassGetter returns the get accessor of a property.
+func (p *Program) ClassGetter(cl *Class, name string) (*Function, bool) {
+	return p.findClassFunction(cl, func(f *Function) bool {
+		return f.Name == name && f.Getter
+	})
+}
+
+// ClassSetter returns the set accessor of a property.
+func (p *Program) ClassSetter(cl *Class, name string) (*Function, bool) {
+	return p.findClassFunction(cl, func(f *Function) bool {
+		return f.Name == name && f.Setter
+	})
+}
+
+// StaticFunction returns a static method of the class or of its base classes.
+func (p *Program) StaticFunction(cl *Class, name string) (*Function, bool) {
+	return p.findClassFunction(cl, func(f *Function) bool {
+		return f.Name == name && f.Static
+	})
+}
+
+func (p *Program) findClassFunction(cl *Class, match func(f *Function) bool) (*Function, bool) {
+	for ; cl != nil; cl = p.BaseClass(cl) {
+		for _, i := range cl.Functions {
+			f := p.Functions[i]
+			if match(f) {
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
+
 type Field struct {
 	Name     string
 	Exported bool
+	Static   bool
+	Readonly bool
 }
 
 type EnumList struct {
@@ -213,6 +364,12 @@ type Function struct {
 	IsClass           bool
 	Class             int
 	IsGlobal          bool
+	Async             bool
+	Generator         bool
+	Static            bool
+	Getter            bool
+	Setter            bool
+	Defaults          bool // has parameters with default values
 	Index             int
 	Arguments         int
 	OptionalArguments int
@@ -220,9 +377,10 @@ type Function struct {
 	Kind              FunctionKind
 	Registers         []*Register
 	Closures          []*Register
-	Instructions      []*Instruction
+	Instructions      []Instruction
 	Positions         []Position
 	Directives        []string
+	Decorators        []*Decorator
 }
 
 func (c *Function) Copy() *Function {
@@ -233,6 +391,11 @@ func (c *Function) Copy() *Function {
 	copy.Exported = c.Exported
 	copy.IsClass = c.IsClass
 	copy.IsGlobal = c.IsGlobal
+	copy.Async = c.Async
+	copy.Generator = c.Generator
+	copy.Static = c.Static
+	copy.Getter = c.Getter
+	copy.Setter = c.Setter
 	copy.Index = c.Index
 	copy.Arguments = c.Arguments
 	copy.OptionalArguments = c.OptionalArguments
@@ -249,9 +412,9 @@ func (c *Function) Copy() *Function {
 		copy.Closures[i] = v.Copy()
 	}
 
-	copy.Instructions = make([]*Instruction, len(c.Instructions))
+	copy.Instructions = make([]Instruction, len(c.Instructions))
 	for i, v := range c.Instructions {
-		copy.Instructions[i] = v.Copy()
+		copy.Instructions[i] = v
 	}
 
 	copy.Positions = make([]Position, len(c.Positions))
@@ -259,6 +422,8 @@ func (c *Function) Copy() *Function {
 		copy.Positions[i] = v.Copy()
 	}
 
+	copy.Decorators = c.Decorators
+
 	return copy
 }
 
@@ -267,6 +432,7 @@ type Program struct {
 	Enums       []*EnumList
 	Functions   []*Function
 	Classes     []*Class
+	Shapes      []*Shape
 	Constants   []Value
 	Files       []string
 	Directives  []string
@@ -310,6 +476,11 @@ func (p *Program) Copy() *Program {
 		copy.Classes[i] = v.Copy()
 	}
 
+	copy.Shapes = make([]*Shape, len(p.Shapes))
+	for i, v := range p.Shapes {
+		copy.Shapes[i] = v
+	}
+
 	copy.Constants = make([]Value, len(p.Constants))
 	for i, v := range p.Constants {
 		copy.Constants[i] = v
@@ -362,9 +533,9 @@ func (p *Program) HasPermission(name string) bool {
 	return false
 }
 
-func (p *Program) addConstant(v Value) *Address {
+func (p *Program) addConstant(v Value) Address {
 	for i, k := range p.Constants {
-		if k.Type == v.Type && k.object == v.object {
+		if k.Type == v.Type && k.num == v.num && k.object == v.object {
 			return NewAddress(AddrConstant, i)
 		}
 	}
@@ -534,6 +705,9 @@ func Fprint(w io.Writer, p *Program) {
 		fmt.Fprint(w, "\n=============================")
 		for i, c := range p.Classes {
 			fmt.Fprintf(w, "\n%dC Class %s", i, c.Name)
+			for _, d := range c.Decorators {
+				fmt.Fprintf(w, "\n %v", d)
+			}
 			for _, f := range c.Functions {
 				FprintFunction(w, p.Functions[f], p)
 			}
@@ -585,8 +759,17 @@ func FprintFunction(w io.Writer, f *Function, p *Program) {
 		fmt.Fprint(w, "\n-----------------------------")
 	}
 
-	for i, v := range f.Instructions {
-		printInstruction(w, p, f, i, v)
+	if len(f.Decorators) > 0 {
+		fmt.Fprint(w, "\nDecorators")
+		fmt.Fprint(w, "\n-----------------------------")
+		for _, d := range f.Decorators {
+			fmt.Fprintf(w, "\n %v", d)
+		}
+		fmt.Fprint(w, "\n-----------------------------")
+	}
+
+	for i := range f.Instructions {
+		printInstruction(w, p, f, i, &f.Instructions[i])
 	}
 
 	var regType string
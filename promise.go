@@ -0,0 +1,254 @@
+package dune
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Promise is the eventual result of an async function.
+type Promise struct {
+	mu       sync.Mutex
+	resolved bool
+	done     chan struct{}
+	value    Value
+	err      error
+}
+
+func NewPromise() *Promise {
+	return &Promise{done: make(chan struct{})}
+}
+
+func (p *Promise) Type() string {
+	return "Promise"
+}
+
+func (p *Promise) Size() int {
+	return 1
+}
+
+// Resolve fulfills the promise with v. If v is another promise
+// it settles with the same result when v does.
+func (p *Promise) Resolve(v Value) {
+	if !p.lock() {
+		return
+	}
+
+	o, ok := v.ToObjectOrNil().(*Promise)
+	if !ok {
+		p.settle(v, nil)
+		return
+	}
+
+	select {
+	case <-o.done:
+		p.settle(o.value, o.err)
+	default:
+		go func() {
+			p.settle(o.Await())
+		}()
+	}
+}
+
+// Reject settles the promise with an error.
+func (p *Promise) Reject(err error) {
+	if p.lock() {
+		p.settle(NullValue, err)
+	}
+}
+
+// Await blocks until the promise is settled.
+func (p *Promise) Await() (Value, error) {
+	<-p.done
+	return p.value, p.err
+}
+
+// AwaitContext blocks until the promise is settled or the context is done.
+func (p *Promise) AwaitContext(ctx context.Context) (Value, error) {
+	select {
+	case <-p.done:
+		return p.value, p.err
+	case <-ctx.Done():
+		return NullValue, ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when the promise is settled.
+func (p *Promise) Done() <-chan struct{} {
+	return p.done
+}
+
+// lock returns false if the promise has already been resolved.
+func (p *Promise) lock() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resolved {
+		return false
+	}
+	p.resolved = true
+	return true
+}
+
+func (p *Promise) settle(v Value, err error) {
+	p.value = v
+	p.err = err
+	close(p.done)
+}
+
+func (p *Promise) GetMethod(name string) NativeMethod {
+	switch name {
+	case "then":
+		return p.then
+	case "catch":
+		return p.catch
+	case "finally":
+		return p.finally
+	}
+	return nil
+}
+
+func (p *Promise) then(args []Value, vm *VM) (Value, error) {
+	switch len(args) {
+	case 1:
+		return NewObject(p.chain(vm, args[0], UndefinedValue)), nil
+	case 2:
+		return NewObject(p.chain(vm, args[0], args[1])), nil
+	default:
+		return NullValue, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+}
+
+func (p *Promise) catch(args []Value, vm *VM) (Value, error) {
+	if len(args) != 1 {
+		return NullValue, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	return NewObject(p.chain(vm, UndefinedValue, args[0])), nil
+}
+
+func (p *Promise) finally(args []Value, vm *VM) (Value, error) {
+	if len(args) != 1 {
+		return NullValue, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	fn := args[0]
+
+	r := vm.RunAsync(func(m *VM) (Value, error) {
+		v, err := p.Await()
+		if _, e := m.callValue(fn); e != nil {
+			return NullValue, e
+		}
+		return v, err
+	})
+
+	return NewObject(r), nil
+}
+
+// chain returns a promise resolved with the result of the handler
+// that corresponds to how p settles.
+func (p *Promise) chain(vm *VM, onFulfilled, onRejected Value) *Promise {
+	return vm.RunAsync(func(m *VM) (Value, error) {
+		v, err := p.Await()
+		if err != nil {
+			if onRejected.IsNil() {
+				return NullValue, err
+			}
+			e, ok := err.(Error)
+			if !ok {
+				e = Error{message: err.Error()}
+			}
+			return m.callValue(onRejected, NewObject(e))
+		}
+
+		if onFulfilled.IsNil() {
+			return v, nil
+		}
+		return m.callValue(onFulfilled, v)
+	})
+}
+
+// RunAsync runs fn in its own goroutine with a clone of the VM and returns
+// a promise of its result. Without the async permission fn is executed
+// before returning.
+func (vm *VM) RunAsync(fn func(vm *VM) (Value, error)) *Promise {
+	p := NewPromise()
+
+	if !vm.HasPermission("async") {
+		settleWith(p, fn, vm)
+		return p
+	}
+
+	m, err := vm.CloneForAsync()
+	if err != nil {
+		p.Reject(err)
+		return p
+	}
+
+	// the clone is stopped with the context of the execution that started it
+	ctx := vm.GoContext()
+
+	go settleWith(p, func(m *VM) (Value, error) {
+		defer m.watch(ctx)()
+		return fn(m)
+	}, m)
+
+	return p
+}
+
+func settleWith(p *Promise, fn func(vm *VM) (Value, error), vm *VM) {
+	v, err := fn(vm)
+	if err != nil {
+		p.Reject(err)
+		return
+	}
+	p.Resolve(v)
+}
+
+// CloneForAsync returns a VM that shares the globals with vm
+// so it can run functions concurrently.
+func (vm *VM) CloneForAsync() (*VM, error) {
+	m := vm.Clone(vm.Program, vm.Globals())
+
+	if err := m.AddSteps(vm.Steps()); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// callValue calls a function, closure or method value.
+func (vm *VM) callValue(fn Value, args ...Value) (Value, error) {
+	switch fn.Type {
+	case Func:
+		return vm.RunFuncIndex(fn.ToFunction(), args...)
+	case Object:
+		switch t := fn.ToObject().(type) {
+		case *Closure:
+			return vm.RunClosure(t, args...)
+		case method:
+			f := vm.Program.Functions[t.fn]
+			return vm.runMethod(f, t.this, args...)
+		case NativeMethod:
+			return t(args, vm)
+		}
+	}
+	return NullValue, fmt.Errorf("expected a function, got: %s", fn.TypeName())
+}
+
+// trimArgs drops the arguments that a program function or closure
+// doesn't declare so callbacks can ignore the ones they don't need.
+func (vm *VM) trimArgs(fn Value, args []Value) []Value {
+	var f *Function
+	switch fn.Type {
+	case Func:
+		f = vm.Program.Functions[fn.ToFunction()]
+	case Object:
+		if c, ok := fn.ToObject().(*Closure); ok {
+			f = vm.Program.Functions[c.FuncIndex]
+		}
+	}
+
+	if f == nil || f.Variadic || f.Arguments >= len(args) {
+		return args
+	}
+	return args[:f.Arguments]
+}
@@ -0,0 +1,380 @@
+package dune
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RegExp is a compiled regular expression. Literals like /a+/i are compiled
+// once by the compiler and stored in the constants of the program.
+//
+// It has no lastIndex: the same value is shared by all the executions
+// of the program so it is stateless. Use matchAll to iterate the matches.
+type RegExp struct {
+	Source string
+	Flags  string
+	Global bool
+	re     *regexp.Regexp
+}
+
+// NewRegExp compiles a pattern with javascript flags: g, i, m, s and u.
+func NewRegExp(source, flags string) (*RegExp, error) {
+	r := &RegExp{Source: source, Flags: flags}
+
+	var prefix string
+	for i, f := range flags {
+		if strings.ContainsRune(flags[:i], f) {
+			return nil, fmt.Errorf("duplicated flag '%c' in regular expression /%s/%s", f, source, flags)
+		}
+		switch f {
+		case 'g':
+			r.Global = true
+		case 'i', 'm', 's':
+			prefix += string(f)
+		case 'u':
+			// go regular expressions are always unicode
+		default:
+			return nil, fmt.Errorf("invalid flag '%c' in regular expression /%s/%s", f, source, flags)
+		}
+	}
+
+	// go supports named groups as (?P<name>)
+	pattern := namedGroups.ReplaceAllString(source, "(?P<$1")
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression /%s/%s: %v", source, flags, err)
+	}
+
+	r.re = re
+	return r, nil
+}
+
+var namedGroups = regexp.MustCompile(`\(\?<([A-Za-z_])`)
+
+// ParseRegExp compiles a literal as written: /pattern/flags
+func ParseRegExp(literal string) (*RegExp, error) {
+	i := strings.LastIndexByte(literal, '/')
+	if i < 1 || literal[0] != '/' {
+		return nil, fmt.Errorf("invalid regular expression %s", literal)
+	}
+	return NewRegExp(literal[1:i], literal[i+1:])
+}
+
+// Regexp returns the compiled go regular expression.
+func (r *RegExp) Regexp() *regexp.Regexp {
+	return r.re
+}
+
+func (r *RegExp) Type() string {
+	return "RegExp"
+}
+
+func (r *RegExp) Size() int {
+	return 1
+}
+
+func (r *RegExp) String() string {
+	return "/" + r.Source + "/" + r.Flags
+}
+
+func (r *RegExp) Export(recursionLevel int) interface{} {
+	return r.String()
+}
+
+func (r *RegExp) GetProperty(name string, vm *VM) (Value, error) {
+	switch name {
+	case "source":
+		return NewString(r.Source), nil
+	case "flags":
+		return NewString(r.Flags), nil
+	case "global":
+		return NewBool(r.Global), nil
+	case "ignoreCase":
+		return NewBool(strings.ContainsRune(r.Flags, 'i')), nil
+	case "multiline":
+		return NewBool(strings.ContainsRune(r.Flags, 'm')), nil
+	}
+	return UndefinedValue, nil
+}
+
+func (r *RegExp) GetMethod(name string) NativeMethod {
+	switch name {
+	case "test":
+		return r.test
+	case "exec":
+		return r.exec
+	case "toString":
+		return r.toString
+	}
+	return nil
+}
+
+func (r *RegExp) test(args []Value, vm *VM) (Value, error) {
+	if len(args) != 1 {
+		return NullValue, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	return NewBool(r.re.MatchString(args[0].ToString())), nil
+}
+
+func (r *RegExp) exec(args []Value, vm *VM) (Value, error) {
+	if len(args) != 1 {
+		return NullValue, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	return r.Exec(args[0].ToString()), nil
+}
+
+func (r *RegExp) toString(args []Value, vm *VM) (Value, error) {
+	return NewString(r.String()), nil
+}
+
+// Exec returns the first match in s or null.
+func (r *RegExp) Exec(s string) Value {
+	m := r.re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return NullValue
+	}
+	return NewObject(r.newMatch(s, m))
+}
+
+// Match works like String.prototype.match: if the expression is global it
+// returns all the matched strings, if not the first match. Null if there is none.
+func (r *RegExp) Match(s string) Value {
+	if !r.Global {
+		return r.Exec(s)
+	}
+
+	matches := r.re.FindAllString(s, -1)
+	if matches == nil {
+		return NullValue
+	}
+
+	values := make([]Value, len(matches))
+	for i, m := range matches {
+		values[i] = NewString(m)
+	}
+	return NewArrayValues(values)
+}
+
+// MatchAll returns all the matches in s with their groups.
+func (r *RegExp) MatchAll(s string) Value {
+	matches := r.re.FindAllStringSubmatchIndex(s, -1)
+
+	values := make([]Value, len(matches))
+	for i, m := range matches {
+		values[i] = NewObject(r.newMatch(s, m))
+	}
+	return NewArrayValues(values)
+}
+
+// Replace replaces the first match or all of them if the expression is global.
+// The replacement can be a string with the javascript patterns
+// ($1, $<name>, $& ...) or a function that receives the match and the groups.
+func (r *RegExp) Replace(s string, replacement Value, vm *VM) (Value, error) {
+	n := 1
+	if r.Global {
+		n = -1
+	}
+
+	matches := r.re.FindAllStringSubmatchIndex(s, n)
+	if matches == nil {
+		return NewString(s), nil
+	}
+
+	var b strings.Builder
+	last := 0
+
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+
+		switch replacement.Type {
+		case Func, Object:
+			v, err := vm.callValue(replacement, vm.trimArgs(replacement, r.replaceArgs(s, m))...)
+			if err != nil {
+				return NullValue, err
+			}
+			b.WriteString(v.ToString())
+		default:
+			r.expand(&b, replacement.ToString(), s, m)
+		}
+
+		last = m[1]
+	}
+
+	b.WriteString(s[last:])
+	return NewString(b.String()), nil
+}
+
+// replaceArgs returns the arguments of a replacer function:
+// (match, p1, p2, ..., offset, string, groups)
+func (r *RegExp) replaceArgs(s string, m []int) []Value {
+	match := r.newMatch(s, m)
+
+	args := make([]Value, 0, len(match.values)+3)
+	args = append(args, match.values...)
+	args = append(args, NewInt(m[0]), NewString(s))
+	if match.groups.Type != Undefined {
+		args = append(args, match.groups)
+	}
+	return args
+}
+
+// expand writes the replacement template replacing the javascript patterns:
+// $$, $&, $`, $', $n and $<name>
+func (r *RegExp) expand(b *strings.Builder, template, s string, m []int) {
+	group := func(i int) {
+		if m[2*i] >= 0 {
+			b.WriteString(s[m[2*i]:m[2*i+1]])
+		}
+	}
+
+	groups := len(m)/2 - 1
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '$' || i == len(template)-1 {
+			b.WriteByte(c)
+			continue
+		}
+
+		next := template[i+1]
+		switch {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+
+		case next == '&':
+			group(0)
+			i++
+
+		case next == '`':
+			b.WriteString(s[:m[0]])
+			i++
+
+		case next == '\'':
+			b.WriteString(s[m[1]:])
+			i++
+
+		case next >= '0' && next <= '9':
+			// two digits if the group exists
+			if i+2 < len(template) && template[i+2] >= '0' && template[i+2] <= '9' {
+				if n, _ := strconv.Atoi(template[i+1 : i+3]); n > 0 && n <= groups {
+					group(n)
+					i += 2
+					continue
+				}
+			}
+			if n := int(next - '0'); n > 0 && n <= groups {
+				group(n)
+				i++
+				continue
+			}
+			b.WriteByte(c)
+
+		case next == '<':
+			end := strings.IndexByte(template[i:], '>')
+			if end == -1 {
+				b.WriteByte(c)
+				continue
+			}
+			if n := r.re.SubexpIndex(template[i+2 : i+end]); n > 0 {
+				group(n)
+			}
+			i += end
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (r *RegExp) newMatch(s string, m []int) *regExpMatch {
+	values := make([]Value, len(m)/2)
+	for i := range values {
+		if m[2*i] < 0 {
+			values[i] = UndefinedValue
+		} else {
+			values[i] = NewString(s[m[2*i]:m[2*i+1]])
+		}
+	}
+
+	groups := UndefinedValue
+	for i, name := range r.re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if groups.Type == Undefined {
+			groups = NewMap(0)
+		}
+		groups.ToMap().Map[NewString(name)] = values[i]
+	}
+
+	return &regExpMatch{values: values, index: m[0], input: s, groups: groups}
+}
+
+// regExpMatch is the result of exec: the matched string followed
+// by the groups. It has also the properties index, input and groups.
+type regExpMatch struct {
+	values []Value
+	index  int
+	input  string
+	groups Value
+}
+
+func (m *regExpMatch) Type() string {
+	return "RegExpMatch"
+}
+
+func (m *regExpMatch) Size() int {
+	return len(m.values)
+}
+
+func (m *regExpMatch) String() string {
+	s := make([]string, len(m.values))
+	for i, v := range m.values {
+		s[i] = v.String()
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func (m *regExpMatch) Export(recursionLevel int) interface{} {
+	values := make([]interface{}, len(m.values))
+	for i, v := range m.values {
+		values[i] = v.Export(recursionLevel)
+	}
+	return values
+}
+
+func (m *regExpMatch) Len() int {
+	return len(m.values)
+}
+
+func (m *regExpMatch) GetIndex(i int) (Value, error) {
+	if i < 0 || i >= len(m.values) {
+		return UndefinedValue, nil
+	}
+	return m.values[i], nil
+}
+
+func (m *regExpMatch) Values() ([]Value, error) {
+	return m.values, nil
+}
+
+func (m *regExpMatch) GetProperty(name string, vm *VM) (Value, error) {
+	switch name {
+	case "index":
+		return NewInt(m.index), nil
+	case "input":
+		return NewString(m.input), nil
+	case "groups":
+		return m.groups, nil
+	case "length":
+		return NewInt(len(m.values)), nil
+	}
+	return UndefinedValue, nil
+}
@@ -0,0 +1,343 @@
+package dune
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Shape is an interface or a type alias kept in the program
+// to validate values at runtime: reflect.validate(v, "User")
+type Shape struct {
+	Name     string
+	Module   string
+	Exported bool
+	Type     *ShapeType
+}
+
+type ShapeKind int
+
+const (
+	ShapeAny ShapeKind = iota
+	ShapeString
+	ShapeNumber
+	ShapeBoolean
+	ShapeNull
+	ShapeUndefined
+	ShapeLiteral      // Value
+	ShapeArray        // Elems[0]
+	ShapeTuple        // Elems
+	ShapeUnion        // Elems
+	ShapeIntersection // Elems
+	ShapeObject       // Props, Index and the extended interfaces in Elems
+	ShapeRef          // Ref: the index of another shape
+)
+
+// ShapeType is the runtime description of a type annotation.
+type ShapeType struct {
+	Kind  ShapeKind
+	Value Value // the value of a literal
+	Elems []*ShapeType
+	Props []*ShapeProp
+	Index *ShapeType // [key: string]: T
+	Ref   int
+}
+
+// ShapeProp is a property of an object shape.
+type ShapeProp struct {
+	Name     string
+	Type     *ShapeType
+	Optional bool
+}
+
+// ValidationError is an error found validating a value.
+// The path is the location of the value: address.lines[1]
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Shape returns the shape declared with the name. The shapes of
+// the main file are found first, then the exported by other modules.
+func (p *Program) Shape(name string) (*Shape, bool) {
+	var exported *Shape
+
+	for _, s := range p.Shapes {
+		if s.Name != name {
+			continue
+		}
+		if s.Module == "" {
+			return s, true
+		}
+		if s.Exported && exported == nil {
+			exported = s
+		}
+	}
+
+	return exported, exported != nil
+}
+
+// Validate checks that the value matches the shape with the name.
+func (p *Program) Validate(v Value, name string) ([]*ValidationError, error) {
+	s, ok := p.Shape(name)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not declared", name)
+	}
+
+	var errors []*ValidationError
+	p.validate(v, s.Type, "", &errors)
+	return errors, nil
+}
+
+func (p *Program) validate(v Value, t *ShapeType, path string, errors *[]*ValidationError) {
+	if !p.matches(v, t) {
+		*errors = append(*errors, &ValidationError{
+			Path:    path,
+			Message: fmt.Sprintf("expected %s, got %s", p.shapeString(t), p.describeValue(v, t)),
+		})
+		return
+	}
+
+	switch t.Kind {
+	case ShapeRef:
+		p.validate(v, p.Shapes[t.Ref].Type, path, errors)
+
+	case ShapeArray:
+		for i, item := range v.ToArray() {
+			p.validate(item, t.Elems[0], path+"["+strconv.Itoa(i)+"]", errors)
+		}
+
+	case ShapeTuple:
+		for i, item := range v.ToArray() {
+			p.validate(item, t.Elems[i], path+"["+strconv.Itoa(i)+"]", errors)
+		}
+
+	case ShapeIntersection:
+		for _, e := range t.Elems {
+			p.validate(v, e, path, errors)
+		}
+
+	case ShapeUnion:
+		// if no type matches report the errors of the first one that matches the kind
+		var first *ShapeType
+		for _, e := range t.Elems {
+			if !p.matches(v, e) {
+				continue
+			}
+			var errs []*ValidationError
+			p.validate(v, e, path, &errs)
+			if len(errs) == 0 {
+				return
+			}
+			if first == nil {
+				first = e
+			}
+		}
+		p.validate(v, first, path, errors)
+
+	case ShapeObject:
+		for _, e := range t.Elems {
+			p.validate(v, e, path, errors)
+		}
+
+		m := v.ToMap()
+		m.RLock()
+		defer m.RUnlock()
+
+		for _, prop := range t.Props {
+			item, ok := m.Map[NewString(prop.Name)]
+			if !ok || item.Type == Undefined {
+				if !prop.Optional {
+					*errors = append(*errors, &ValidationError{
+						Path:    joinPath(path, prop.Name),
+						Message: "required property is missing",
+					})
+				}
+				continue
+			}
+			p.validate(item, prop.Type, joinPath(path, prop.Name), errors)
+		}
+
+		if t.Index != nil {
+			// sorted to report the errors always in the same order
+			keys := make([]string, 0, len(m.Map))
+			for k := range m.Map {
+				if !t.hasProp(k.ToString()) {
+					keys = append(keys, k.ToString())
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p.validate(m.Map[NewString(k)], t.Index, joinPath(path, k), errors)
+			}
+		}
+	}
+}
+
+// matches checks the kind of the value without validating its elements.
+func (p *Program) matches(v Value, t *ShapeType) bool {
+	switch t.Kind {
+	case ShapeAny:
+		return true
+	case ShapeString:
+		return v.Type == String || v.Type == Rune
+	case ShapeNumber:
+		return isNumber(v)
+	case ShapeBoolean:
+		return v.Type == Bool
+	case ShapeNull:
+		return v.Type == Null
+	case ShapeUndefined:
+		return v.Type == Undefined
+	case ShapeLiteral:
+		if isNumber(v) && isNumber(t.Value) {
+			return v.ToFloat() == t.Value.ToFloat()
+		}
+		return v.StrictEquals(t.Value)
+	case ShapeArray:
+		return v.Type == Array
+	case ShapeTuple:
+		return v.Type == Array && len(v.ToArray()) == len(t.Elems)
+	case ShapeObject:
+		return v.Type == Map
+	case ShapeRef:
+		return p.matches(v, p.Shapes[t.Ref].Type)
+	case ShapeIntersection:
+		for _, e := range t.Elems {
+			if !p.matches(v, e) {
+				return false
+			}
+		}
+		return true
+	case ShapeUnion:
+		for _, e := range t.Elems {
+			if p.matches(v, e) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func (t *ShapeType) hasProp(name string) bool {
+	for _, p := range t.Props {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Program) shapeString(t *ShapeType) string {
+	switch t.Kind {
+	case ShapeAny:
+		return "any"
+	case ShapeString:
+		return "string"
+	case ShapeNumber:
+		return "number"
+	case ShapeBoolean:
+		return "boolean"
+	case ShapeNull:
+		return "null"
+	case ShapeUndefined:
+		return "undefined"
+	case ShapeLiteral:
+		if t.Value.Type == String {
+			return strconv.Quote(t.Value.ToString())
+		}
+		return t.Value.String()
+	case ShapeArray:
+		switch t.Elems[0].Kind {
+		case ShapeUnion, ShapeIntersection:
+			return "(" + p.shapeString(t.Elems[0]) + ")[]"
+		}
+		return p.shapeString(t.Elems[0]) + "[]"
+	case ShapeTuple:
+		return "[" + p.joinShapes(t.Elems, ", ") + "]"
+	case ShapeUnion:
+		return p.joinShapes(t.Elems, " | ")
+	case ShapeIntersection:
+		return p.joinShapes(t.Elems, " & ")
+	case ShapeObject:
+		return "object"
+	case ShapeRef:
+		return p.Shapes[t.Ref].Name
+	}
+	return "unknown"
+}
+
+func (p *Program) joinShapes(types []*ShapeType, sep string) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = p.shapeString(t)
+	}
+	return strings.Join(s, sep)
+}
+
+// describeValue returns the type of the value or the
+// value itself if it was expected to be a literal.
+func (p *Program) describeValue(v Value, t *ShapeType) string {
+	switch v.Type {
+	case String, Rune:
+		if p.hasLiteral(t) {
+			return strconv.Quote(v.ToString())
+		}
+		return "string"
+	case Int, Float:
+		if p.hasLiteral(t) {
+			return v.String()
+		}
+		return "number"
+	case Bool:
+		if p.hasLiteral(t) {
+			return v.String()
+		}
+		return "boolean"
+	case Null:
+		return "null"
+	case Undefined:
+		return "undefined"
+	case Array:
+		return "array"
+	case Map:
+		return "object"
+	}
+	return v.TypeName()
+}
+
+func (p *Program) hasLiteral(t *ShapeType) bool {
+	switch t.Kind {
+	case ShapeLiteral:
+		return true
+	case ShapeRef:
+		return p.hasLiteral(p.Shapes[t.Ref].Type)
+	case ShapeUnion:
+		for _, e := range t.Elems {
+			if p.hasLiteral(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func isNumber(v Value) bool {
+	return v.Type == Int || v.Type == Float
+}
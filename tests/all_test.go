@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -27,6 +28,15 @@ func TestTypescript(t *testing.T) {
 	//  $ f=While go test -v
 	filter := os.Getenv("f")
 
+	// pass a name to write the coverage of the tests to name.lcov and name.html:
+	//
+	//  $ cover=coverage go test
+	var coverage *dune.Coverage
+	cover := os.Getenv("cover")
+	if cover != "" {
+		coverage = dune.NewCoverage()
+	}
+
 	files, err := ioutil.ReadDir(".")
 	if err != nil {
 		t.Fatal(err)
@@ -57,6 +67,7 @@ func TestTypescript(t *testing.T) {
 			}
 
 			vm := dune.NewVM(p)
+			vm.SetCoverage(coverage)
 
 			// dune.Print(p)
 
@@ -71,7 +82,29 @@ func TestTypescript(t *testing.T) {
 		}
 	}
 
+	if coverage != nil {
+		if err := writeCoverage(coverage, cover); err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	if fail {
 		t.Fail()
 	}
 }
+
+func writeCoverage(c *dune.Coverage, name string) error {
+	var lcov bytes.Buffer
+	if err := c.WriteLCOV(&lcov); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(name+".lcov", lcov.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	var html bytes.Buffer
+	if err := c.WriteHTML(&html, filesystem.OS); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+".html", html.Bytes(), 0644)
+}
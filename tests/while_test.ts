@@ -206,4 +206,26 @@ function testWhile14() {
     }
 
     assert.equal(3, i)
-}
\ No newline at end of file
+}
+
+function testDoWhile1() {
+    let a = 0
+    do {
+        a++
+    } while (false)
+    assert.equal(1, a)
+}
+
+function testDoWhile2() {
+    let a = 0
+    do {
+        a++
+        if (a == 2) {
+            continue
+        }
+        if (a == 4) {
+            break
+        }
+    } while (a < 10)
+    assert.equal(4, a)
+}
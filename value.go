@@ -3,13 +3,18 @@ package dune
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"sync"
 	"unicode/utf8"
 )
 
+// Value is a tagged union. Numbers, booleans, runes and the indexes of
+// functions and enums are stored inline in num so they don't allocate.
+// The rest of the types are stored in object.
 type Value struct {
 	Type   Type
+	num    uint64
 	object interface{}
 }
 
@@ -96,31 +101,49 @@ func NewValue(v interface{}) Value {
 var (
 	UndefinedValue = Value{Type: Undefined}
 	NullValue      = Value{Type: Null}
-	TrueValue      = Value{Type: Bool, object: true}
-	FalseValue     = Value{Type: Bool, object: false}
+	TrueValue      = Value{Type: Bool, num: 1}
+	FalseValue     = Value{Type: Bool, num: 0}
 )
 
 func NewInt(v int) Value {
-	return Value{Type: Int, object: int64(v)}
+	return Value{Type: Int, num: uint64(v)}
 }
 
 func NewInt64(v int64) Value {
-	return Value{Type: Int, object: int64(v)}
+	return Value{Type: Int, num: uint64(v)}
 }
 
 func NewRune(v rune) Value {
-	return Value{Type: Rune, object: rune(v)}
+	return Value{Type: Rune, num: uint64(v)}
 }
 
 func NewBool(v bool) Value {
 	if v {
-		return Value{Type: Bool, object: true}
+		return TrueValue
 	}
-	return Value{Type: Bool, object: false}
+	return FalseValue
 }
 
 func NewFloat(v float64) Value {
-	return Value{Type: Float, object: v}
+	return Value{Type: Float, num: math.Float64bits(v)}
+}
+
+// Key returns the value used as the key of a map. Maps compare the bits
+// of the floats so -0 is stored as 0 and all the NaNs as the same NaN,
+// like the keys of a Map in javascript.
+func (v Value) Key() Value {
+	if v.Type != Float {
+		return v
+	}
+
+	f := math.Float64frombits(v.num)
+	switch {
+	case f == 0:
+		return Value{Type: Float}
+	case math.IsNaN(f):
+		return NewFloat(math.NaN())
+	}
+	return v
 }
 
 func NewBytes(v []byte) Value {
@@ -169,15 +192,15 @@ func NewMapValues(m map[Value]Value) Value {
 }
 
 func NewEnum(v int) Value {
-	return Value{Type: Enum, object: int64(v)}
+	return Value{Type: Enum, num: uint64(v)}
 }
 
 func NewFunction(v int) Value {
-	return Value{Type: Func, object: int64(v)}
+	return Value{Type: Func, num: uint64(v)}
 }
 
 func NewNativeFunction(v int) Value {
-	return Value{Type: NativeFunc, object: int64(v)}
+	return Value{Type: NativeFunc, num: uint64(v)}
 }
 
 // Convert the object to a string
@@ -251,11 +274,11 @@ func (v Value) TypeName() string {
 func (v Value) ToInt() int64 {
 	switch v.Type {
 	case Int:
-		return v.object.(int64)
+		return int64(v.num)
 	case Float:
-		return int64(v.object.(float64))
+		return int64(math.Float64frombits(v.num))
 	case Rune:
-		return int64(v.ToRune())
+		return int64(rune(v.num))
 	case Bool:
 		if v.ToBool() {
 			return 1
@@ -271,7 +294,7 @@ func (v Value) ToInt() int64 {
 func (v Value) ToFunction() int {
 	switch v.Type {
 	case Func:
-		return int(v.object.(int64))
+		return int(v.num)
 	default:
 		panic(fmt.Sprintf("Invalid conversion: %v", v))
 	}
@@ -280,7 +303,7 @@ func (v Value) ToFunction() int {
 func (v Value) ToEnum() int {
 	switch v.Type {
 	case Enum:
-		return int(v.object.(int64))
+		return int(v.num)
 	default:
 		panic(fmt.Sprintf("Invalid conversion: %v", v))
 	}
@@ -289,7 +312,7 @@ func (v Value) ToEnum() int {
 func (v Value) ToNativeFunction() int {
 	switch v.Type {
 	case NativeFunc:
-		return int(v.object.(int64))
+		return int(v.num)
 	default:
 		panic(fmt.Sprintf("Invalid conversion: %v", v))
 	}
@@ -298,11 +321,11 @@ func (v Value) ToNativeFunction() int {
 func (v Value) ToFloat() float64 {
 	switch v.Type {
 	case Int:
-		return float64(v.ToInt())
+		return float64(int64(v.num))
 	case Float:
-		return v.object.(float64)
+		return math.Float64frombits(v.num)
 	case Rune:
-		return float64(v.ToRune())
+		return float64(rune(v.num))
 	case Null, Undefined:
 		return 0
 	default:
@@ -313,9 +336,9 @@ func (v Value) ToFloat() float64 {
 func (v Value) ToRune() rune {
 	switch v.Type {
 	case Rune:
-		return v.object.(rune)
+		return rune(v.num)
 	case Int:
-		return rune(v.object.(int64))
+		return rune(int64(v.num))
 	case String:
 		s := v.object.(string)
 		if len(s) != 1 {
@@ -330,9 +353,9 @@ func (v Value) ToRune() rune {
 func (v Value) ToBool() bool {
 	switch v.Type {
 	case Bool:
-		return v.object.(bool)
+		return v.num != 0
 	case Int:
-		return v.ToInt() > 0
+		return int64(v.num) > 0
 	case Undefined, Null:
 		return false
 	default:
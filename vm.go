@@ -1,11 +1,13 @@
 package dune
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -102,6 +104,10 @@ type VM struct {
 	Stdout         io.Writer
 	Stderr         io.Writer
 
+	// Deadline aborts the execution when it is reached. It can't be
+	// catched by the program, like the cancellation of the context.
+	Deadline time.Time
+
 	fp          int
 	steps       int64
 	allocations int64
@@ -110,6 +116,18 @@ type VM struct {
 	tryCatchs   []*tryCatch
 	reg0        int32
 	frameCache  []*stackFrame
+
+	// the context of the current execution and the flag set when it is done
+	ctx         context.Context
+	interrupted int32
+
+	debugger *Debugger
+	profiler *Profiler
+	coverage *coverageRecorder
+
+	// the inline caches of the instructions by function
+	caches       [][]inlineCache
+	cacheProgram *Program
 }
 
 func (vm *VM) GetStdin() io.Reader {
@@ -179,6 +197,12 @@ func (vm *VM) Clone(p *Program, globals []Value) *VM {
 	m.Stdout = vm.Stdout
 	m.Stderr = vm.Stderr
 	m.Now = vm.Now
+	m.Deadline = vm.Deadline
+
+	if vm.coverage != nil {
+		m.SetCoverage(vm.coverage.coverage)
+	}
+
 	return m
 }
 
@@ -187,6 +211,8 @@ func (vm *VM) Initialized() bool {
 }
 
 func (vm *VM) Initialize() error {
+	defer vm.watch(context.Background())()
+
 	vm.run(false)
 
 	if vm.Error == io.EOF {
@@ -208,6 +234,10 @@ func (vm *VM) Initialize() error {
 }
 
 func (vm *VM) Run(args ...Value) (Value, error) {
+	return vm.RunContext(context.Background(), args...)
+}
+
+func (vm *VM) runMain(args ...Value) (Value, error) {
 	// reset the error in case is reused
 	vm.Error = nil
 
@@ -225,11 +255,23 @@ func (vm *VM) Run(args ...Value) (Value, error) {
 		return vm.RetValue, nil
 	}
 
-	return vm.runFunc(f, true, nil, args...)
+	v, err := vm.runFunc(f, true, nil, args...)
+	if err != nil || !f.Async {
+		return v, err
+	}
+
+	// wait for the result if main is async
+	v, err = v.ToObject().(*Promise).AwaitContext(vm.GoContext())
+	vm.cleanupFrame(0)
+	return v, err
 }
 
 // RunFunc executes a function by name
 func (vm *VM) RunFunc(name string, args ...Value) (Value, error) {
+	return vm.RunFuncContext(context.Background(), name, args...)
+}
+
+func (vm *VM) runFuncName(name string, args ...Value) (Value, error) {
 	f, ok := vm.Program.Function(name)
 	if !ok {
 		return NullValue, fmt.Errorf("%s: %w", name, ErrFunctionNotExist)
@@ -239,12 +281,14 @@ func (vm *VM) RunFunc(name string, args ...Value) (Value, error) {
 
 // RunFuncIndex executes a program function by index
 func (vm *VM) RunFuncIndex(index int, args ...Value) (Value, error) {
+	defer vm.watch(context.Background())()
 	f := vm.Program.Functions[index]
 	return vm.runFunc(f, false, nil, args...)
 }
 
 // RunClosure executes a program closure
 func (vm *VM) RunClosure(c *Closure, args ...Value) (Value, error) {
+	defer vm.watch(context.Background())()
 	f := vm.Program.Functions[c.FuncIndex]
 	return vm.runFunc(f, false, c.closures, args...)
 }
@@ -258,8 +302,51 @@ func (vm *VM) runFunc(f *Function, finalizeGlobals bool, closures []*closureRegi
 		return NullValue, fmt.Errorf("can't call a method directly")
 	}
 
+	if err := checkArgs(f, args); err != nil {
+		return NullValue, err
+	}
+
+	if f.Async {
+		return NewObject(vm.callAsync(f, closures, false, NullValue, args)), nil
+	}
+
+	if f.Generator {
+		return NewObject(vm.newGenerator(f, closures, false, NullValue, args)), nil
+	}
+
+	return vm.execFunc(f, finalizeGlobals, closures, false, NullValue, args)
+}
+
+// runMethod executes a class method with this as the receiver.
+func (vm *VM) runMethod(f *Function, this Value, args ...Value) (Value, error) {
+	if err := checkArgs(f, args); err != nil {
+		return NullValue, err
+	}
+
+	if f.Async {
+		return NewObject(vm.callAsync(f, nil, true, this, args)), nil
+	}
+
+	if f.Generator {
+		return NewObject(vm.newGenerator(f, nil, true, this, args)), nil
+	}
+
+	return vm.execFunc(f, false, nil, true, this, args)
+}
+
+// callAsync starts executing an async function and returns a promise of its result.
+func (vm *VM) callAsync(f *Function, closures []*closureRegister, isMethod bool, this Value, args []Value) *Promise {
+	// the arguments can be reused by the caller
+	args = append([]Value(nil), args...)
+
+	return vm.RunAsync(func(m *VM) (Value, error) {
+		return m.execFunc(f, false, closures, isMethod, this, args)
+	})
+}
+
+func checkArgs(f *Function, args []Value) error {
 	if !f.Variadic && f.Arguments < len(args) {
-		return NullValue, fmt.Errorf("function '%s' expects only %d parameters, got %d",
+		return fmt.Errorf("function '%s' expects only %d parameters, got %d",
 			f.Name, f.Arguments, len(args))
 	}
 
@@ -275,9 +362,13 @@ func (vm *VM) runFunc(f *Function, finalizeGlobals bool, closures []*closureRegi
 		} else {
 			errMsg = "function '%s' expects at least %d parameters, got %d"
 		}
-		return NullValue, fmt.Errorf(errMsg, f.Name, minArgs, len(args))
+		return fmt.Errorf(errMsg, f.Name, minArgs, len(args))
 	}
 
+	return nil
+}
+
+func (vm *VM) execFunc(f *Function, finalizeGlobals bool, closures []*closureRegister, isMethod bool, this Value, args []Value) (Value, error) {
 	currentFp := vm.fp
 	currentTryCatchs := vm.tryCatchs
 
@@ -304,8 +395,8 @@ func (vm *VM) runFunc(f *Function, finalizeGlobals bool, closures []*closureRegi
 		if regularArgs > 0 {
 			for i := 0; i < regularArgs; i++ {
 				if i >= lenArgs {
-					// skip if not enouth parameters have been provided
-					break
+					locals[i] = missingArg(f)
+					continue
 				}
 				v := args[i]
 				locals[i] = v
@@ -328,8 +419,8 @@ func (vm *VM) runFunc(f *Function, finalizeGlobals bool, closures []*closureRegi
 	} else {
 		for i := 0; i < f.Arguments; i++ {
 			if i >= lenArgs {
-				// skip if not enouth parameters have been provided
-				break
+				locals[i] = missingArg(f)
+				continue
 			}
 			v := args[i]
 			if err := vm.AddAllocations(v.Size()); err != nil {
@@ -339,6 +430,11 @@ func (vm *VM) runFunc(f *Function, finalizeGlobals bool, closures []*closureRegi
 		}
 	}
 
+	if isMethod {
+		// this is always the next value after the arguments
+		locals[f.Arguments] = this
+	}
+
 	vm.run(finalizeGlobals)
 
 	// restore
@@ -363,7 +459,7 @@ func (vm *VM) addFrame(f *Function) *stackFrame {
 		vm.frameCache[0] = nil
 		vm.frameCache = vm.frameCache[1:]
 
-		frame.retAddress = nil
+		frame.retAddress = Void
 		frame.exit = false
 		frame.maxRegIndex = 0
 		frame.pc = 0
@@ -418,24 +514,33 @@ func (vm *VM) SetGlobalFinalizer(v Finalizable) {
 	frame.finalizables = append(frame.finalizables, v)
 }
 
-func (vm *VM) get(a *Address) Value {
-	switch a.Kind {
+// get returns the value of an operand. The registers of the current
+// function are read inline because most of the operands are locals.
+func (vm *VM) get(a Address) Value {
+	if a&addrKindMask == Address(AddrLocal) {
+		return vm.callStack[vm.fp].values[int32(a)>>addrKindBits]
+	}
+	return vm.getAddress(a)
+}
+
+func (vm *VM) getAddress(a Address) Value {
+	switch a.Kind() {
 	case AddrLocal:
-		return vm.callStack[vm.fp].values[a.Value]
+		return vm.callStack[vm.fp].values[a.Value()]
 	case AddrFunc:
-		return NewFunction(int(a.Value))
+		return NewFunction(int(a.Value()))
 	case AddrConstant:
-		return vm.Program.Constants[a.Value]
+		return vm.Program.Constants[a.Value()]
 	case AddrGlobal:
-		return vm.callStack[0].values[a.Value]
+		return vm.callStack[0].values[a.Value()]
 	case AddrNativeFunc:
-		return NewNativeFunction(int(a.Value))
+		return NewNativeFunction(int(a.Value()))
 	case AddrEnum:
-		return NewEnum(int(a.Value))
+		return NewEnum(int(a.Value()))
 	case AddrData:
-		return NewInt(int(a.Value))
+		return NewInt(int(a.Value()))
 	case AddrClosure:
-		return vm.callStack[vm.fp].closures[a.Value].get()
+		return vm.callStack[vm.fp].closures[a.Value()].get()
 	case AddrVoid:
 		return NullValue
 	case AddrUnresolved:
@@ -445,19 +550,29 @@ func (vm *VM) get(a *Address) Value {
 	}
 }
 
-func (vm *VM) set(a *Address, v Value) {
+// set stores a value in a register. If there are no limits nor profiler
+// the registers of the current function are written inline.
+func (vm *VM) set(a Address, v Value) {
+	if a&addrKindMask != Address(AddrLocal) || vm.MaxAllocations != 0 || vm.profiler != nil {
+		vm.setAddress(a, v)
+		return
+	}
+	vm.callStack[vm.fp].values[int32(a)>>addrKindBits] = v
+}
+
+func (vm *VM) setAddress(a Address, v Value) {
 	if err := vm.AddAllocations(v.Size()); err != nil {
 		vm.Error = err
 		return
 	}
 
-	switch a.Kind {
+	switch a.Kind() {
 	case AddrLocal:
-		vm.callStack[vm.fp].values[a.Value] = v
+		vm.callStack[vm.fp].values[a.Value()] = v
 	case AddrClosure:
-		vm.callStack[vm.fp].closures[a.Value].set(v)
+		vm.callStack[vm.fp].closures[a.Value()].set(v)
 	case AddrGlobal:
-		vm.callStack[0].values[a.Value] = v
+		vm.callStack[0].values[a.Value()] = v
 	case AddrConstant:
 		panic(fmt.Sprintf("can't modify a constant: %v", a))
 	default:
@@ -466,6 +581,10 @@ func (vm *VM) set(a *Address, v Value) {
 }
 
 func (vm *VM) AddAllocations(size int) error {
+	if vm.profiler != nil {
+		vm.profiler.allocation(vm, size)
+	}
+
 	if vm.MaxAllocations == 0 {
 		return nil
 	}
@@ -477,7 +596,7 @@ func (vm *VM) AddAllocations(size int) error {
 	return nil
 }
 
-func (vm *VM) setPrototype(name string, this Value, dst *Address) bool {
+func (vm *VM) setPrototype(name string, this Value, dst Address) bool {
 	if m, ok := vm.getNativePrototype(name, this); ok {
 		vm.set(dst, NewObject(m))
 		return true
@@ -788,6 +907,13 @@ func (vm *VM) run(finalizeGlobals bool) {
 	p := vm.Program
 	// Print(p)
 
+	// the frame and the code are loaded again only when
+	// the execution jumps or changes to a different frame.
+	fp := vm.fp
+	frame := vm.callStack[fp]
+	f := p.Functions[frame.funcIndex]
+	code := f.Instructions
+
 	for {
 		if vm.MaxSteps > 0 {
 			vm.steps++
@@ -797,26 +923,40 @@ func (vm *VM) run(finalizeGlobals bool) {
 			}
 		}
 
-		frame := vm.callStack[vm.fp]
-		f := p.Functions[frame.funcIndex]
-		i := f.Instructions[frame.pc]
+		if atomic.LoadInt32(&vm.interrupted) != 0 {
+			vm.interrupt()
+			return
+		}
+
+		if vm.debugger != nil {
+			vm.debugger.check(vm, frame, f)
+		}
+
+		if vm.profiler != nil {
+			vm.profiler.step(vm)
+		}
+
+		if vm.coverage != nil {
+			vm.coverage.hit(vm, frame, f)
+		}
+
+		i := &code[frame.pc]
 
 		// Print step
 		// i := frame.funcIndex
 		// fmt.Println("->", fmt.Sprintf("FN %-2d", i), fmt.Sprintf("PC %-6d", frame.pc), instr, "  "+f.Name)
 
-		r := exec(i, vm)
-
-		switch r {
+		switch executors[i.Opcode](i, vm) {
 		case vm_next:
 			if vm.Error != nil {
 				return
 			}
 			frame.pc++
-			continue
+			if vm.fp == fp {
+				continue
+			}
 
 		case vm_continue:
-			continue
 
 		case vm_exit:
 			if vm.Error != nil {
@@ -828,6 +968,11 @@ func (vm *VM) run(finalizeGlobals bool) {
 			}
 			return
 		}
+
+		fp = vm.fp
+		frame = vm.callStack[fp]
+		f = p.Functions[frame.funcIndex]
+		code = f.Instructions
 	}
 }
 
@@ -847,7 +992,7 @@ func (vm *VM) recover(recoverValue interface{}) {
 	i := frame.funcIndex
 	f := vm.Program.Functions[i]
 	if frame.pc < len(f.Instructions) {
-		instr = f.Instructions[frame.pc]
+		instr = &f.Instructions[frame.pc]
 	}
 
 	// don't call newError because it's handling itself the stack trace.
@@ -865,7 +1010,7 @@ func (vm *VM) incPC(steps int) {
 	vm.callStack[vm.fp].pc += steps
 }
 
-func (vm *VM) call(a, b *Address, args []Value, optional bool) int {
+func (vm *VM) call(a, b Address, args []Value, optional bool) int {
 	// TODO Handle variadic and spread with closures.
 	// get the function
 	var f *Function
@@ -874,11 +1019,11 @@ func (vm *VM) call(a, b *Address, args []Value, optional bool) int {
 	var isMethod bool
 	var this Value
 
-	switch a.Kind {
+	switch a.Kind() {
 	case AddrFunc:
-		f = vm.Program.Functions[a.Value]
+		f = vm.Program.Functions[a.Value()]
 	case AddrNativeFunc:
-		if err := vm.callNativeFunc(int(a.Value), args, b, this); err != nil {
+		if err := vm.callNativeFunc(int(a.Value()), args, b, this); err != nil {
 			if vm.handle(vm.WrapError(err)) {
 				return vm_continue
 			} else {
@@ -938,10 +1083,26 @@ func (vm *VM) call(a, b *Address, args []Value, optional bool) int {
 		}
 	}
 
+	if f.Async {
+		p := vm.callAsync(f, closures, isMethod, this, args)
+		if b != Void {
+			vm.set(b, NewObject(p))
+		}
+		return vm_next
+	}
+
+	if f.Generator {
+		g := vm.newGenerator(f, closures, isMethod, this, args)
+		if b != Void {
+			vm.set(b, NewObject(g))
+		}
+		return vm_next
+	}
+
 	return vm.callProgramFunc(f, b, args, isMethod, this, closures)
 }
 
-func (vm *VM) callProgramFunc(f *Function, retAddr *Address, args []Value, isMethod bool, this Value, closures []*closureRegister) int {
+func (vm *VM) callProgramFunc(f *Function, retAddr Address, args []Value, isMethod bool, this Value, closures []*closureRegister) int {
 	frame := vm.callStack[vm.fp]
 
 	// set where to store the return value after the call in the current frame
@@ -958,9 +1119,22 @@ func (vm *VM) callProgramFunc(f *Function, retAddr *Address, args []Value, isMet
 		return vm_exit
 	}
 
-	locals := newFrame.values
+	setArgs(f, newFrame.values, args, isMethod, this)
+	return vm_next
+}
+
+// missingArg is the value of the parameters that are not provided. They
+// are undefined if the function declares default values, so they apply,
+// and null in other case as they have always been.
+func missingArg(f *Function) Value {
+	if f.Defaults {
+		return UndefinedValue
+	}
+	return NullValue
+}
 
-	// copy arguments
+// setArgs copies the arguments to the locals of a new frame.
+func setArgs(f *Function, locals []Value, args []Value, isMethod bool, this Value) {
 	if f.Arguments > 0 {
 		count := len(args)
 
@@ -968,10 +1142,11 @@ func (vm *VM) callProgramFunc(f *Function, retAddr *Address, args []Value, isMet
 			regularArgs := f.Arguments - 1
 			if count < regularArgs {
 				copy(locals, args)
-				// zero the rest of the args because memory can be reused
-				for i := count; i < f.Arguments; i++ {
-					locals[i] = NullValue
+				// set the rest of the args because memory can be reused
+				for i := count; i < regularArgs; i++ {
+					locals[i] = missingArg(f)
 				}
+				locals[regularArgs] = NullValue
 			} else {
 				for i := 0; i < regularArgs; i++ {
 					locals[i] = args[i]
@@ -984,6 +1159,9 @@ func (vm *VM) callProgramFunc(f *Function, retAddr *Address, args []Value, isMet
 				copy(locals, args[:f.Arguments])
 			} else {
 				copy(locals, args)
+				for i := count; i < f.Arguments; i++ {
+					locals[i] = missingArg(f)
+				}
 			}
 		}
 	}
@@ -992,11 +1170,9 @@ func (vm *VM) callProgramFunc(f *Function, retAddr *Address, args []Value, isMet
 		// this is always the next value after the arguments
 		locals[f.Arguments] = this
 	}
-
-	return vm_next
 }
 
-func (vm *VM) callNativeFunc(i int, args []Value, retAddress *Address, this Value) error {
+func (vm *VM) callNativeFunc(i int, args []Value, retAddress Address, this Value) error {
 	f := allNativeFuncs[i]
 
 	l := f.Arguments
@@ -1016,7 +1192,7 @@ func (vm *VM) callNativeFunc(i int, args []Value, retAddress *Address, this Valu
 	return nil
 }
 
-func (vm *VM) callNativeMethod(m NativeMethod, args []Value, retAddress *Address) error {
+func (vm *VM) callNativeMethod(m NativeMethod, args []Value, retAddress Address) error {
 	ret, err := m(args, vm)
 	if err != nil {
 		return err
@@ -1082,7 +1258,7 @@ func (vm *VM) setToObject(instr *Instruction) error {
 		case Map:
 			m := av.ToMap()
 			m.Lock()
-			m.Map[bv] = cv
+			m.Map[bv.Key()] = cv
 			m.Unlock()
 		default:
 			return vm.NewError("Invalid index %s for %s", bv.TypeName(), av.TypeName())
@@ -1107,6 +1283,11 @@ func (vm *VM) setToObject(instr *Instruction) error {
 			m.Map[bv] = cv
 			m.Unlock()
 		case Object:
+			if instr.B.Kind() == AddrConstant {
+				if ok, err := vm.setCached(av, bv.ToString(), cv); ok {
+					return err
+				}
+			}
 			i, ok := av.ToObject().(PropertySetter)
 			if !ok {
 				return vm.NewError("Readonly property or not a PropertySetter: %T", av.TypeName())
@@ -1228,7 +1409,7 @@ func (vm *VM) getFromObject(instr *Instruction, errIfNullOrUndefined bool) (bool
 		case Map:
 			m := bv.ToMap()
 			m.RLock()
-			v, ok := m.Map[cv]
+			v, ok := m.Map[cv.Key()]
 			if !ok {
 				v = UndefinedValue
 			}
@@ -1257,6 +1438,12 @@ func (vm *VM) getFromObject(instr *Instruction, errIfNullOrUndefined bool) (bool
 	case String:
 		key := cv.ToString()
 
+		if instr.C.Kind() == AddrConstant {
+			if ok, err := vm.getCached(instr, bv, key); ok {
+				return err == nil, err
+			}
+		}
+
 		switch bv.Type {
 
 		case Enum:
@@ -1384,19 +1571,20 @@ func (vm *VM) instruction() *Instruction {
 	frame := vm.callStack[vm.fp]
 	i := frame.funcIndex
 	f := vm.Program.Functions[i]
-	return f.Instructions[frame.pc]
+	return &f.Instructions[frame.pc]
 }
 
 type stackFrame struct {
 	pc           int
 	funcIndex    int
 	maxRegIndex  int
-	retAddress   *Address
+	retAddress   Address
 	values       []Value
 	closures     []*closureRegister
 	finalizables []Finalizable
 	exit         bool // if it should exit the program when returns
 	inClosure    bool
+	generator    *Generator
 }
 
 type method struct {
@@ -1406,7 +1594,7 @@ type method struct {
 
 type tryCatch struct {
 	catchPC         int
-	errorReg        *Address
+	errorReg        Address
 	finallyPC       int
 	fp              int
 	retPC           int
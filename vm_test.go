@@ -1,12 +1,20 @@
 package dune
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/scorredoira/dune/filesystem"
+	"github.com/scorredoira/dune/parser"
 )
 
 // Tests: Expressions
@@ -1692,6 +1700,199 @@ func TestEnumParser(t *testing.T) {
 	assertValueFS(t, fs, "main.ts", 1)
 }
 
+func TestNamedImports(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import { add, Direction, Point as P, total } from "lib"
+
+		function main() {
+			let p = new P(2)
+			return add(p.x, Direction.Right) + total
+		}
+	`))
+
+	fs.WritePath("lib.ts", []byte(`
+		export const total = 10
+
+		export function add(a: number, b: number) {
+			return a + b
+		}
+
+		export enum Direction {
+			Left = 1,
+			Right = 3,
+		}
+
+		export class Point {
+			x: number
+			constructor(x: number) {
+				this.x = x
+			}
+		}
+	`))
+
+	assertValueFS(t, fs, "main.ts", 15)
+}
+
+func TestDefaultImports(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import double, { minus as sub } from "fn"
+		import Counter from "cls"
+		import base from "expr"
+
+		function main() {
+			let c = new Counter()
+			c.inc()
+			return double(sub(base)) + c.n
+		}
+	`))
+
+	fs.WritePath("fn.ts", []byte(`
+		export default function double(v: number) {
+			return v * 2
+		}
+		export function minus(v: number) {
+			return v - 10
+		}
+	`))
+
+	fs.WritePath("cls.ts", []byte(`
+		export default class Counter {
+			n = 0
+			inc() {
+				this.n++
+			}
+		}
+	`))
+
+	fs.WritePath("expr.ts", []byte(`
+		const values = [10, 20]
+		export default values[1]
+	`))
+
+	assertValueFS(t, fs, "main.ts", 21)
+}
+
+func TestDefaultImportAnonymous(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import sum from "sum"
+		import * as s from "sum"
+
+		function main() {
+			return sum(1, 2) + s.default(3, 4)
+		}
+	`))
+
+	fs.WritePath("sum.ts", []byte(`
+		export default function (a: number, b: number) {
+			return a + b
+		}
+	`))
+
+	assertValueFS(t, fs, "main.ts", 10)
+}
+
+func TestReExports(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import { a, b2, c } from "barrel"
+		import * as barrel from "barrel"
+
+		function main() {
+			return a() + b2() + c + barrel.a() + barrel.b2()
+		}
+	`))
+
+	fs.WritePath("barrel.ts", []byte(`
+		export * from "a"
+		export { b as b2 } from "b"
+		export { default as c } from "c"
+	`))
+
+	fs.WritePath("a.ts", []byte(`
+		export function a() {
+			return 1
+		}
+	`))
+
+	fs.WritePath("b.ts", []byte(`
+		export function b() {
+			return 10
+		}
+	`))
+
+	fs.WritePath("c.ts", []byte(`
+		export default 100
+	`))
+
+	assertValueFS(t, fs, "main.ts", 122)
+}
+
+func TestExportList(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import lib, { value } from "lib"
+
+		function main() {
+			return lib() + value
+		}
+	`))
+
+	fs.WritePath("lib.ts", []byte(`
+		const value = 5
+		function get() {
+			return 2
+		}
+		export { value, get as default }
+	`))
+
+	assertValueFS(t, fs, "main.ts", 7)
+}
+
+func TestImportNotExported(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import { foo } from "lib"
+
+		function main() {
+			return foo()
+		}
+	`))
+
+	fs.WritePath("lib.ts", []byte(`
+		function foo() {
+			return 1
+		}
+	`))
+
+	_, err := Compile(fs, "main.ts")
+	if err == nil || !strings.Contains(err.Error(), "foo is not exported") {
+		t.Fatal(err)
+	}
+
+	// it is reported at the import even if it is not used
+	fs.WritePath("main.ts", []byte(`
+		import { bar } from "lib"
+		import def from "lib"
+	`))
+
+	_, err = Compile(fs, "main.ts")
+	if err == nil || !strings.Contains(err.Error(), `bar is not exported by "lib"`) || !strings.Contains(err.Error(), "main.ts:2") {
+		t.Fatal(err)
+	}
+
+	fs.WritePath("main.ts", []byte(`
+		import def from "lib"
+	`))
+
+	_, err = Compile(fs, "main.ts")
+	if err == nil || !strings.Contains(err.Error(), `Module "lib" has no default export`) {
+		t.Fatal(err)
+	}
+}
+
 func TestEnumString(t *testing.T) {
 	assertValue(t, "up", `
 		enum Direction {
@@ -1723,6 +1924,24 @@ func TestMap(t *testing.T) {
 	`)
 }
 
+func TestMapFloatKeys(t *testing.T) {
+	assertValue(t, 2, `
+		let a = {}
+		let zero = 0.0
+		let negative = -1.0 * zero
+		a[zero] = 1
+		a[negative] = 2
+		return a[zero]
+	`)
+
+	// all the NaNs are the same key
+	m := map[Value]Value{NewFloat(math.NaN()).Key(): TrueValue}
+	nan := NewFloat(math.Float64frombits(0xFFF8000000000123))
+	if _, ok := m[nan.Key()]; !ok {
+		t.Fatal("expected NaN to be a key")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	assertValue(t, true, `
 		let a = { foo: 1 }
@@ -1922,360 +2141,1383 @@ func TestClassInitializeFields(t *testing.T) {
 	`)
 }
 
-func TestModuleImports1(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import * as foo from "foo"
-
-		function main() {
-			return foo.bar
+func TestClassExtends(t *testing.T) {
+	assertValue(t, "Rex: woof (4 legs)", `
+		class Animal {
+			name: string
+			legs = 4
+			constructor(name: string) {
+				this.name = name
+			}
+			describe() {
+				return this.name + ": " + this.sound() + " (" + this.legs + " legs)"
+			}
+			sound() {
+				return "..."
+			}
 		}
-	`))
 
-	fs.WritePath("foo.ts", []byte(`
-		export const bar = 3
-	`))
+		class Dog extends Animal {
+			sound() {
+				return "woof"
+			}
+		}
 
-	assertValueFS(t, fs, "main.ts", 3)
+		return new Dog("Rex").describe()
+	`)
 }
 
-func TestModuleImports2(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "/libs/foo"
-
-		function main() {
-			return foo.bar
+func TestClassSuper(t *testing.T) {
+	assertValue(t, "B(A(1)) 3 x", `
+		class A {
+			a: number
+			constructor(a: number) {
+				this.a = a
+			}
+			name() {
+				return "A(" + this.a + ")"
+			}
 		}
-	`))
 
-	fs.WritePath("/libs/foo.ts", []byte(`
-		export const bar = 3
-	`))
+		class B extends A {
+			b: number
+			c = "x"
+			constructor(a: number, b: number) {
+				super(a)
+				this.b = b
+			}
+			name() {
+				return "B(" + super.name() + ")"
+			}
+		}
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+		let b = new B(1, 2)
+		return b.name() + " " + (b.a + b.b) + " " + b.c
+	`)
 }
 
-func TestModuleImports3(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "../libs/foo"
+func TestClassSuperDefaultConstructor(t *testing.T) {
+	assertValue(t, 5, `
+		class C extends B {
+			z = 2
+		}
 
-		function main() {
-			return foo.bar
+		class B extends A {
+			y = 1
 		}
-	`))
 
-	fs.WritePath("/libs/foo.ts", []byte(`
-		export const bar = 3
-	`))
+		class A {
+			x: number
+			constructor(x: number) {
+				this.x = x
+			}
+		}
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+		let c = new C(2)
+		return c.x + c.y + c.z
+	`)
 }
 
-func TestModuleImports4(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "../dir1/dir2/dir3/foo"
-
-		function main() {
-			return foo.bar
+func TestClassSuperInClosure(t *testing.T) {
+	assertValue(t, 3, `
+		class A {
+			value() {
+				return 1
+			}
 		}
-	`))
-
-	fs.WritePath("/dir1/dir2/dir3/foo.ts", []byte(`
-		import * as xxx from "../../../other/path/bar"
 
-		export const bar = xxx.foo()
-	`))
-
-	fs.WritePath("/other/path/bar.ts", []byte(`
-		export function foo() {
-			return 3
+		class B extends A {
+			value() {
+				let f = () => super.value() + 2
+				return f()
+			}
 		}
-	`))
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+		return new B().value()
+	`)
 }
 
-func TestModuleImportsRelativeToModule(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "../dir1/foo"
+func TestClassBasePrivateField(t *testing.T) {
+	assertValue(t, 3, `
+		class A {
+			private a = 3
+			getA() {
+				return this.a
+			}
+		}
 
-		function main() {
-			return foo.bar
+		class B extends A {
 		}
-	`))
 
-	fs.WritePath("/dir1/foo.ts", []byte(`
-		import * as xxx from "../dir2/bar"
+		return new B().getA()
+	`)
 
-		export const bar = xxx.foo()
-	`))
+	p := compileTest(t, `
+			class A {
+				private a = 3
+			}
+			class B extends A {
+				getA() {
+					return this.a
+				}
+			}
+			return new B().getA()
+		`)
 
-	fs.WritePath("/dir2/bar.ts", []byte(`
-		export function foo() {
-			return 3
+	_, err := NewVM(p).Run()
+	if err == nil || !strings.Contains(err.Error(), "private field") {
+		t.Fatal(err)
+	}
+}
+
+func TestClassSuperErrors(t *testing.T) {
+	_, err := CompileStr(`
+		class A {
+			a = 1
 		}
-	`))
+		class B extends A {
+			constructor() {
+				this.b = 2
+			}
+		}
+	`)
+	assertError(t, "must start with a 'super' call", err)
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+	_, err = CompileStr(`
+		class A {
+			foo() { return super.foo() }
+		}
+	`)
+	assertError(t, "'super' can only be used", err)
+
+	_, err = CompileStr(`
+		let a = 1
+		class B extends a {
+		}
+	`)
+	assertError(t, "Expected class name", err)
 }
 
-func TestModuleImports5(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "../other/path/bar"
+func TestClassAccessors(t *testing.T) {
+	assertValue(t, "John Smith|Jane Doe|Jane!", `
+		class Person {
+			private first = ""
+			private last = ""
 
-		function main() {
-			return new foo.Foo(3).bar
+			get fullName() {
+				return this.first + " " + this.last
+			}
+
+			set fullName(v: string[]) {
+				this.first = v[0]
+				this.last = v[1]
+			}
+
+			get greeting() {
+				return this.first + "!"
+			}
 		}
-	`))
 
-	fs.WritePath("/other/path/bar.ts", []byte(`
-		export class Foo {
-			bar: number
-			constructor(x: number) {
-				this.bar = x
-			}
-			getNum() {
-				return this.bar
+		let p = new Person()
+		p.fullName = ["John", "Smith"]
+		let a = p.fullName
+		p.fullName = ["Jane", "Doe"]
+		return a + "|" + p.fullName + "|" + p.greeting
+	`)
+}
+
+func TestClassSetterValidation(t *testing.T) {
+	p := compileTest(t, `
+			class Account {
+				private _balance = 0
+				get balance() {
+					return this._balance
+				}
+				set balance(v: number) {
+					if (v < 0) {
+						throw "invalid balance"
+					}
+					this._balance = v
+				}
 			}
-		}
-	`))
+			let a = new Account()
+			a.balance = 10
+			a.balance = -1
+		`)
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+	_, err := NewVM(p).Run()
+	if err == nil || !strings.Contains(err.Error(), "invalid balance") {
+		t.Fatal(err)
+	}
 }
 
-func TestModuleImports6(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "bar"
+func TestClassGetterOnly(t *testing.T) {
+	p := compileTest(t, `
+			class Foo {
+				get bar() {
+					return 1
+				}
+			}
+			let foo = new Foo()
+			foo.bar = 2
+		`)
 
-		function main() {
-			return new foo.Foo(3).bar
-		}
-	`))
+	_, err := NewVM(p).Run()
+	if err == nil || !strings.Contains(err.Error(), "only has a get accessor") {
+		t.Fatal(err)
+	}
+}
 
-	fs.WritePath("/dir1/bar.ts", []byte(`
-		export class Foo {
-			bar: number
-			constructor(x: number) {
-				this.bar = x
+func TestClassStatic(t *testing.T) {
+	assertValue(t, 13, `
+		class Counter {
+			static count = 0
+			private static step = 2
+			static readonly start = 10
+
+			static next() {
+				Counter.count += Counter.step
+				return Counter.count
 			}
-			getNum() {
-				return this.bar
+
+			static reset() {
+				Counter.count = Counter.start
 			}
 		}
-	`))
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+		Counter.reset()
+		Counter.next()
+		Counter.count++
+		return Counter.count
+	`)
 }
 
-func TestModuleImports7(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "./bar"
-
-		function main() {
-			return new foo.Foo(3).bar
-		}
-	`))
-
-	fs.WritePath("/dir1/bar.ts", []byte(`
-		export class Foo {
-			bar: number
-			constructor(x: number) {
-				this.bar = x
-			}
-			getNum() {
-				return this.bar
+func TestClassStaticConstructor(t *testing.T) {
+	assertValue(t, 12, `
+		class Cfg {
+			static limit = 10
+			static count = 0
+			constructor() {
+				Cfg.count++
 			}
 		}
-	`))
 
-	assertValueFS(t, fs, "/dir1/main.ts", 3)
+		let a = new Cfg()
+		let b = new Cfg()
+		return Cfg.limit + Cfg.count
+	`)
 }
 
-func TestModuleImportsFromOtherDir(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("/dir1/main.ts", []byte(`
-		import * as foo from "./bar"
-
-		function main() {
-			return foo.bar()
+func TestClassStaticInherited(t *testing.T) {
+	assertValue(t, "base:3", `
+		class Base {
+			static prefix = "base"
+			static format(v: number) {
+				return Base.prefix + ":" + v
+			}
 		}
-	`))
 
-	fs.WritePath("/dir1/bar.ts", []byte(`
-		export function bar() {
-			return 3
+		class Derived extends Base {
 		}
-	`))
-
-	fs.MkdirAll("/foo/bar")
-
-	if err := fs.Chdir("/foo/bar"); err != nil {
-		t.Fatal(err)
-	}
 
-	assertValueFS(t, fs, "../../dir1/main.ts", 3)
+		return Derived.format(3)
+	`)
 }
 
-func TestModuleForSideEffects(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import "foo"
-
-		function main() {
-			return bar
+func TestClassStaticErrors(t *testing.T) {
+	_, err := CompileStr(`
+		class Foo {
+			private static a = 1
 		}
-	`))
+		let x = Foo.a
+	`)
+	assertError(t, "private field", err)
 
-	fs.WritePath("foo.ts", []byte(`
-		export const bar = 3
-	`))
+	_, err = CompileStr(`
+		class Foo {
+			static readonly a = 1
+		}
+		Foo.a = 2
+	`)
+	assertError(t, "readonly", err)
 
-	_, err := Compile(fs, "main.ts")
-	if err == nil || !strings.Contains(err.Error(), "Undeclared identifier") {
-		t.Fatal(err)
-	}
+	_, err = CompileStr(`
+		class Foo {
+		}
+		Foo.bar()
+	`)
+	assertError(t, "Undefined static member", err)
 }
 
-func TestModuleForSideEffects2(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import "foo"
-
-		function main() {
-			bar()
+func TestClassReadonly(t *testing.T) {
+	assertValue(t, 5, `
+		class Foo {
+			readonly a = 2
+			readonly b: number
+			constructor(b: number) {
+				this.b = b
+			}
 		}
-	`))
+		let foo = new Foo(3)
+		return foo.a + foo.b
+	`)
 
-	fs.WritePath("foo.ts", []byte(`
-		export function bar() {}
-	`))
+	p := compileTest(t, `
+			class Foo {
+				readonly a = 2
+				setA() {
+					this.a = 3
+				}
+			}
+			new Foo().setA()
+		`)
 
-	_, err := Compile(fs, "main.ts")
-	if err == nil || !strings.Contains(err.Error(), "Undeclared identifier") {
+	_, err := NewVM(p).Run()
+	if err == nil || !strings.Contains(err.Error(), "readonly") {
 		t.Fatal(err)
 	}
 }
 
-func TestVisibility(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import * as foo from "foo"
+func TestTemplateLiteral(t *testing.T) {
+	assertValue(t, "Hello world!", `
+		let name = "world"
+		return ` + "`Hello ${name}!`" + `
+	`)
 
-		function main() {
-			foo.bar()
-		}
-	`))
+	assertValue(t, "1 + 2 = 3", `
+		let a = 1
+		let b = 2
+		return ` + "`${a} + ${b} = ${a + b}`" + `
+	`)
 
-	fs.WritePath("foo.ts", []byte(`
-		function bar() {}
-	`))
+	assertValue(t, "a-b", `
+		let s = "a"
+		s = ` + "`${s}-${ " + "`${\"b\"}`" + " }`" + `
+		return s
+	`)
 
-	_, err := Compile(fs, "main.ts")
-	if err == nil || !strings.Contains(err.Error(), "not exported") {
-		t.Fatal(err)
-	}
+	assertValue(t, "${a}", `
+		return ` + "`\\${a}`" + `
+	`)
 }
 
-func TestModuleSameNames(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import * as foo from "bar"
+func TestTaggedTemplate(t *testing.T) {
+	assertValue(t, "x|y|z|1|2", `
+		function tag(strings, a, b) {
+			return strings[0] + "|" + strings[1] + "|" + strings[2] + "|" + a + "|" + b
+		}
+		return tag` + "`x${1}y${1 + 1}z`" + `
+	`)
 
-		export function sum() {
-			return 88
+	assertValue(t, "x|3", `
+		let obj = {
+			tag: (strings, ...values) => strings[0] + "|" + values.length
 		}
+		return obj.tag` + "`x${1}${2}${3}`" + `
+	`)
+}
 
-		function main() {
-			return foo.bar()
+func TestAsyncAwait(t *testing.T) {
+	assertValue(t, 10, `
+		async function double(a) {
+			return a * 2
 		}
-	`))
 
-	fs.WritePath("bar.ts", []byte(`
-		export function bar() {
-			return sum()
+		async function main() {
+			let x = await double(2)
+			return x + await double(3)
 		}
-		export function sum() {
-			return 3
+	`)
+
+	assertValue(t, 7, `
+		class Foo {
+			async bar(a) {
+				return a + 1
+			}
 		}
-	`))
 
-	assertValueFS(t, fs, "main.ts", 3)
-}
+		let add = async (a, b) => a + b
 
-func TestInit0(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import * as lib1 from "libs/lib1"
+		let f = new Foo()
+		return await f.bar(2) + await add(2, 2)
+	`)
 
-		export let v
+	assertValue(t, 3, `
+		// awaiting a value that is not a promise returns it as it is
+		return await 3
+	`)
+}
 
-		function init() {
-			v = 1
+func TestAsyncError(t *testing.T) {
+	assertValue(t, "boom", `
+		async function fail() {
+			throw "boom"
 		}
 
-		function main() {
-			return v + lib1.v
+		async function main() {
+			try {
+				await fail()
+			} catch (e) {
+				return e.message
+			}
 		}
-	`))
-
-	fs.WritePath("libs/lib1.ts", []byte(`		
-		export let v
+	`)
+}
 
-		function init() {
-			v = 2
+func TestAwaitOutsideAsync(t *testing.T) {
+	_, err := CompileStr(`
+		function main() {
+			await 1
 		}
-	`))
+	`)
 
-	assertValueFS(t, fs, "main.ts", 3)
+	assertError(t, "await is only valid in async functions", err)
 }
 
-func TestInit1(t *testing.T) {
-	fs := filesystem.NewMemFS()
-	fs.WritePath("main.ts", []byte(`
-		import * as lib1 from "libs/lib1"
-		import * as lib2 from "libs/lib2"
+func TestGenerator(t *testing.T) {
+	assertValue(t, 6, `
+		function* count(n) {
+			for (let i = 1; i <= n; i++) {
+				yield i
+			}
+		}
 
-		export let v
+		let total = 0
+		for (let v of count(3)) {
+			total += v
+		}
+		return total
+	`)
 
-		function init() {
-			v = 0
+	assertValue(t, "1-false-2-true", `
+		let f = function*() {
+			yield 1
+			return 2
 		}
 
-		function main() {
-			return v + lib1.foo() + lib2.v
+		let g = f()
+		let a = g.next()
+		let b = g.next()
+		return a.value + "-" + a.done + "-" + b.value + "-" + b.done
+	`)
+
+	assertValue(t, 5, `
+		function* sum() {
+			let total = 0
+			while (true) {
+				let v = yield total
+				total += v
+			}
 		}
-	`))
 
-	fs.WritePath("libs/lib1.ts", []byte(`
-		import * as lib2 from "libs/lib2"
-		
-		export let v
+		let g = sum()
+		g.next()
+		g.next(2)
+		return g.next(3).value
+	`)
+}
 
-		function init() {
-			v = 1
+func TestGeneratorDelegate(t *testing.T) {
+	assertValue(t, 123, `
+		function* inner() {
+			yield 1
+			yield 2
 		}
 
-		export function foo() {
-			return v + lib2.v
+		function* outer() {
+			yield* inner()
+			yield* [3]
 		}
-	`))
 
-	fs.WritePath("libs/lib2.ts", []byte(`		
-		export let v
+		let total = 0
+		for (let v of outer()) {
+			total = total * 10 + v
+		}
+		return total
+	`)
+}
 
-		function init() {
-			v = 2
+func TestGeneratorTryCatch(t *testing.T) {
+	assertValue(t, 3, `
+		function* items() {
+			try {
+				yield 1
+				throw "boom"
+			} catch (e) {
+				yield 2
+			}
 		}
-	`))
 
-	assertValueFS(t, fs, "main.ts", 5)
+		let total = 0
+		for (let v of items()) {
+			total += v
+		}
+		return total
+	`)
+}
+
+func TestGeneratorMethod(t *testing.T) {
+	assertValue(t, 6, `
+		class List {
+			items = [1, 2, 3];
+
+			*values() {
+				for (let v of this.items) {
+					yield v
+				}
+			}
+		}
+
+		let total = 0
+		for (let v of new List().values()) {
+			total += v
+		}
+		return total
+	`)
+}
+
+func TestForOfIterator(t *testing.T) {
+	// plain objects are iterated by their values even if they have a next function
+	assertValue(t, 1, `
+		let obj = {
+			next: () => 1,
+		}
+
+		let n = 0
+		for (let v of obj) {
+			n += v()
+		}
+		return n
+	`)
+
+	assertValue(t, 3, `
+		class Counter {
+			private n = 0
+
+			next() {
+				this.n++
+				return { value: this.n, done: this.n > 2 }
+			}
+		}
+
+		let total = 0
+		for (let v of new Counter()) {
+			total += v
+		}
+		return total
+	`)
+}
+
+func TestGeneratorReturnFinally(t *testing.T) {
+	assertValue(t, "1-inner-outer-true", `
+		let log = ""
+
+		function* items() {
+			try {
+				try {
+					yield 1
+					yield 2
+				} finally {
+					log += "-inner"
+				}
+			} finally {
+				log += "-outer"
+			}
+		}
+
+		let g = items()
+		let a = g.next()
+		let r = g.return(5)
+		return a.value + log + "-" + (r.value === 5 && r.done && g.next().done)
+	`)
+
+	// a finally block can yield when the generator is returning
+	assertValue(t, "2-true", `
+		function* items() {
+			try {
+				yield 1
+			} finally {
+				yield 2
+			}
+		}
+
+		let g = items()
+		g.next()
+		let r = g.return()
+		return r.value + "-" + g.next().done
+	`)
+
+	// the generator is closed when a for...of loop breaks
+	assertValue(t, "12c1cc", `
+		let log = ""
+
+		function* items() {
+			try {
+				yield 1
+				yield 2
+				yield 3
+			} finally {
+				log += "c"
+			}
+		}
+
+		for (let v of items()) {
+			log += v
+			if (v == 2) {
+				break
+			}
+		}
+
+		outer:
+		for (let i of [1, 2]) {
+			for (let v of items()) {
+				if (i == 2) {
+					break outer
+				}
+				log += i
+				continue outer
+			}
+		}
+
+		return log
+	`)
+}
+
+func TestYieldOutsideGenerator(t *testing.T) {
+	_, err := CompileStr(`
+		function main() {
+			yield 1
+		}
+	`)
+
+	assertError(t, "yield is only valid in generator functions", err)
+}
+
+func TestDestructuringArray(t *testing.T) {
+	assertValue(t, "1-2-undefined", `
+		let [a, b, c] = [1, 2]
+		return a + "-" + b + "-" + c
+	`)
+
+	assertValue(t, "1-3-x", `
+		let [a, , b, c = "x"] = [1, 2, 3]
+		return a + "-" + b + "-" + c
+	`)
+
+	assertValue(t, "1-2-3-2", `
+		let [a, ...rest] = [1, 2, 3]
+		return a + "-" + rest[0] + "-" + rest[1] + "-" + rest.length
+	`)
+
+	assertValue(t, "2-1", `
+		let a = 1
+		let b = 2;
+		[a, b] = [b, a]
+		return a + "-" + b
+	`)
+}
+
+func TestDestructuringObject(t *testing.T) {
+	assertValue(t, "1-x-3", `
+		let row = { id: 1, other: 3 }
+		let { id, name: n = "x", other } = row
+		return id + "-" + n + "-" + other
+	`)
+
+	assertValue(t, "1-undefined-3", `
+		let { a, b, ...rest } = { a: 1, b: 2, c: 3 }
+		return a + "-" + rest.b + "-" + rest.c
+	`)
+
+	assertValue(t, "1-2-3", `
+		let { a, b: { c, d: [e] } } = { a: 1, b: { c: 2, d: [3] } }
+		return a + "-" + c + "-" + e
+	`)
+
+	// defaults are only applied to undefined values
+	assertValue(t, "true-2-x", `
+		let { a = 1, b = 2, c = "x" } = { a: null, b: undefined }
+		return (a === null) + "-" + b + "-" + c
+	`)
+
+	assertValue(t, "1-2", `
+		let x = { a: 0 }
+		let y = [0]
+		;({ a: x.a, b: y[0] } = { a: 1, b: 2 })
+		return x.a + "-" + y[0]
+	`)
+}
+
+func TestDestructuringParams(t *testing.T) {
+	assertValue(t, "1-2-3", `
+		function foo({ a, b }, [c]) {
+			return a + "-" + b + "-" + c
+		}
+		return foo({ a: 1, b: 2 }, [3])
+	`)
+
+	assertValue(t, 6, `
+		let f = ([a, b], { c }) => a + b + c
+		return f([1, 2], { c: 3 })
+	`)
+}
+
+func TestDestructuringForOf(t *testing.T) {
+	assertValue(t, "a1b2", `
+		let s = ""
+		for (let [k, v] of [["a", 1], ["b", 2]]) {
+			s += k + v
+		}
+		return s
+	`)
+
+	assertValue(t, 3, `
+		let n = 0
+		for (const { x } of [{ x: 1 }, { x: 2 }]) {
+			n += x
+		}
+		return n
+	`)
+}
+
+func TestDefaultParams(t *testing.T) {
+	assertValue(t, "1-10-0", `
+		function foo(a, limit = 10, opts = { offset: 0 }) {
+			return a + "-" + limit + "-" + opts.offset
+		}
+		return foo(1)
+	`)
+
+	assertValue(t, "1-5-3", `
+		function foo(a, b = 2, c = a + b) {
+			return a + "-" + b + "-" + c
+		}
+		return foo(1, 5, 3)
+	`)
+
+	// the default is only applied to undefined, not to null
+	assertValue(t, "6-true", `
+		function foo(a, b = a * 2) {
+			return b
+		}
+		return (2 + foo(2, undefined)) + "-" + (foo(1, null) === null)
+	`)
+
+	assertValue(t, true, `
+		function foo(a = 1) {
+			return a
+		}
+		return foo(null) === null && foo() === 1
+	`)
+}
+
+// the parameters that are not provided are null if the
+// function doesn't declare default values.
+func TestOptionalParamsNull(t *testing.T) {
+	assertValue(t, "true-true-true", `
+		function foo(a?: number, b?: string) {
+			return a === null && b === null
+		}
+		function bar(a: number, ...rest: any[]) {
+			return a === null
+		}
+		class A {
+			baz(a?: number) {
+				return a === null
+			}
+		}
+		return foo() + "-" + bar() + "-" + new A().baz()
+	`)
+
+	p := compileTest(t, `
+		function foo(a?: number) {
+			return a === null
+		}
+		function bar(a = 1) {
+			return a
+		}
+	`)
+
+	vm := NewVM(p)
+
+	v, err := vm.RunFunc("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != TrueValue {
+		t.Fatalf("expected the missing parameter to be null, got %v", v)
+	}
+
+	v, err = vm.RunFunc("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ToInt() != 1 {
+		t.Fatalf("expected the default value, got %v", v)
+	}
+}
+
+func TestDefaultParamsLambda(t *testing.T) {
+	assertValue(t, 12, `
+		let f = (a = 2, b = 3) => a * b
+		let g = x => x
+		return f() + f(1, 1) + g(5)
+	`)
+}
+
+func TestDefaultParamsMethod(t *testing.T) {
+	assertValue(t, "hello world!", `
+		class Greeter {
+			greeting: string
+			constructor(greeting = "hello") {
+				this.greeting = greeting
+			}
+			greet(name = "world", { suffix } = { suffix: "!" }) {
+				return this.greeting + " " + name + suffix
+			}
+		}
+		return new Greeter().greet()
+	`)
+}
+
+func TestDefaultParamsEvaluatedOnCall(t *testing.T) {
+	assertValue(t, 1, `
+		function foo(counter = { n: 0 }) {
+			counter.n++
+			return counter.n
+		}
+		foo()
+		return foo()
+	`)
+}
+
+func TestSpreadArray(t *testing.T) {
+	assertValue(t, "012345", `
+		let a = [1, 2]
+		let b = [4, 5]
+		let c = [0, ...a, 3, ...b]
+		let s = ""
+		for (let v of c) {
+			s += v
+		}
+		return s
+	`)
+
+	assertValue(t, 4, `
+		let a = [1, 2]
+		a = [...a, ...a]
+		return a.length
+	`)
+
+	assertValue(t, "abc", `
+		function* gen() {
+			yield "b"
+			yield "c"
+		}
+		let a = ["a", ...gen()]
+		return a[0] + a[1] + a[2]
+	`)
+}
+
+func TestSpreadObject(t *testing.T) {
+	assertValue(t, "1-20-30-4", `
+		let defaults = { a: 1, b: 2, c: 3 }
+		let overrides = { b: 20, c: 30 }
+		let opts = { ...defaults, ...overrides, d: 4 }
+		return opts.a + "-" + opts.b + "-" + opts.c + "-" + opts.d
+	`)
+
+	assertValue(t, "2-x", `
+		let opts = { a: 1 }
+		opts = { ...opts, a: 2, b: "x", ...null }
+		return opts.a + "-" + opts.b
+	`)
+}
+
+func TestSpreadArguments(t *testing.T) {
+	assertValue(t, "12345", `
+		function concat(...values) {
+			let s = ""
+			for (let v of values) {
+				s += v
+			}
+			return s
+		}
+		let a = [2, 3]
+		return concat(1, ...a, 4, ...[5])
+	`)
+
+	assertValue(t, 6, `
+		function sum(a, b, c) {
+			return a + b + c
+		}
+		let args = [2, 3]
+		return sum(...[1], ...args)
+	`)
+}
+
+func TestRestProperties(t *testing.T) {
+	assertValue(t, "1-2-3", `
+		function foo({ a, ...others }) {
+			return a + "-" + others.b + "-" + others.c
+		}
+		return foo({ a: 1, b: 2, c: 3 })
+	`)
+}
+
+func TestInstanceOf(t *testing.T) {
+	assertValue(t, "true-true-false-false", `
+		class A {}
+		class B extends A {}
+		class C {}
+		let b = new B()
+		return (b instanceof A) + "-" + (b instanceof B) + "-" + (b instanceof C) + "-" + (1 instanceof A)
+	`)
+
+	assertValue(t, "true-false-true", `
+		let e
+		try {
+			throw "foo"
+		} catch (err) {
+			e = err
+		}
+		return ([1] instanceof Array) + "-" + ({} instanceof Array) + "-" + (e instanceof Error)
+	`)
+}
+
+func TestIn(t *testing.T) {
+	assertValue(t, "true-false-true-false", `
+		let m = { a: 1 }
+		let a = [1, 2]
+		return ("a" in m) + "-" + ("b" in m) + "-" + (1 in a) + "-" + (2 in a)
+	`)
+
+	assertValue(t, "true-true-true-false", `
+		class A {
+			x = 1
+			foo() {}
+			get bar() { return 1 }
+		}
+		let a = new A()
+		return ("x" in a) + "-" + ("foo" in a) + "-" + ("bar" in a) + "-" + ("baz" in a)
+	`)
+}
+
+func TestPow(t *testing.T) {
+	assertValue(t, 1024, `return 2 ** 10`)
+	assertValue(t, 512, `return 2 ** 3 ** 2`)
+	assertValue(t, 0.5, `return 2 ** -1`)
+	assertValue(t, 2.25, `return 1.5 ** 2`)
+	assertValue(t, 18, `return 2 * 3 ** 2`)
+}
+
+func TestUnsignedShift(t *testing.T) {
+	assertValue(t, 4, `return 16 >>> 2`)
+	assertValue(t, 2147483647, `return -1 >>> 1`)
+	assertValue(t, 4294967295, `return -1 >>> 0`)
+}
+
+func TestLogicalAssignment(t *testing.T) {
+	assertValue(t, "1-0-3", `
+		let a = 1
+		let b = 0
+		let c = null
+		a &&= 2
+		a ||= 5
+		b &&= 5
+		c ??= 3
+		return (a - 1) + "-" + b + "-" + c
+	`)
+
+	assertValue(t, "x", `
+		let m = {}
+		m.a ??= "x"
+		m.a ??= "y"
+		return m.a
+	`)
+}
+
+func TestDoWhile(t *testing.T) {
+	assertValue(t, 1, `
+		let a = 0
+		do {
+			a++
+		} while (false)
+		return a
+	`)
+
+	assertValue(t, "0124", `
+		let s = ""
+		let i = 0
+		do {
+			if (i == 3) {
+				i++
+				continue
+			}
+			s += i
+			if (i == 4) {
+				break
+			}
+			i++
+		} while (i < 10);
+		return s
+	`)
+}
+
+func TestModuleImports1(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import * as foo from "foo"
+
+		function main() {
+			return foo.bar
+		}
+	`))
+
+	fs.WritePath("foo.ts", []byte(`
+		export const bar = 3
+	`))
+
+	assertValueFS(t, fs, "main.ts", 3)
+}
+
+func TestModuleImports2(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "/libs/foo"
+
+		function main() {
+			return foo.bar
+		}
+	`))
+
+	fs.WritePath("/libs/foo.ts", []byte(`
+		export const bar = 3
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImports3(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "../libs/foo"
+
+		function main() {
+			return foo.bar
+		}
+	`))
+
+	fs.WritePath("/libs/foo.ts", []byte(`
+		export const bar = 3
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImports4(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "../dir1/dir2/dir3/foo"
+
+		function main() {
+			return foo.bar
+		}
+	`))
+
+	fs.WritePath("/dir1/dir2/dir3/foo.ts", []byte(`
+		import * as xxx from "../../../other/path/bar"
+
+		export const bar = xxx.foo()
+	`))
+
+	fs.WritePath("/other/path/bar.ts", []byte(`
+		export function foo() {
+			return 3
+		}
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImportsRelativeToModule(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "../dir1/foo"
+
+		function main() {
+			return foo.bar
+		}
+	`))
+
+	fs.WritePath("/dir1/foo.ts", []byte(`
+		import * as xxx from "../dir2/bar"
+
+		export const bar = xxx.foo()
+	`))
+
+	fs.WritePath("/dir2/bar.ts", []byte(`
+		export function foo() {
+			return 3
+		}
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImports5(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "../other/path/bar"
+
+		function main() {
+			return new foo.Foo(3).bar
+		}
+	`))
+
+	fs.WritePath("/other/path/bar.ts", []byte(`
+		export class Foo {
+			bar: number
+			constructor(x: number) {
+				this.bar = x
+			}
+			getNum() {
+				return this.bar
+			}
+		}
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImports6(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "bar"
+
+		function main() {
+			return new foo.Foo(3).bar
+		}
+	`))
+
+	fs.WritePath("/dir1/bar.ts", []byte(`
+		export class Foo {
+			bar: number
+			constructor(x: number) {
+				this.bar = x
+			}
+			getNum() {
+				return this.bar
+			}
+		}
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImports7(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "./bar"
+
+		function main() {
+			return new foo.Foo(3).bar
+		}
+	`))
+
+	fs.WritePath("/dir1/bar.ts", []byte(`
+		export class Foo {
+			bar: number
+			constructor(x: number) {
+				this.bar = x
+			}
+			getNum() {
+				return this.bar
+			}
+		}
+	`))
+
+	assertValueFS(t, fs, "/dir1/main.ts", 3)
+}
+
+func TestModuleImportsFromOtherDir(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/dir1/main.ts", []byte(`
+		import * as foo from "./bar"
+
+		function main() {
+			return foo.bar()
+		}
+	`))
+
+	fs.WritePath("/dir1/bar.ts", []byte(`
+		export function bar() {
+			return 3
+		}
+	`))
+
+	fs.MkdirAll("/foo/bar")
+
+	if err := fs.Chdir("/foo/bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertValueFS(t, fs, "../../dir1/main.ts", 3)
+}
+
+func TestModuleForSideEffects(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import "foo"
+
+		function main() {
+			return bar
+		}
+	`))
+
+	fs.WritePath("foo.ts", []byte(`
+		export const bar = 3
+	`))
+
+	_, err := Compile(fs, "main.ts")
+	if err == nil || !strings.Contains(err.Error(), "Undeclared identifier") {
+		t.Fatal(err)
+	}
+}
+
+func TestModuleForSideEffects2(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import "foo"
+
+		function main() {
+			bar()
+		}
+	`))
+
+	fs.WritePath("foo.ts", []byte(`
+		export function bar() {}
+	`))
+
+	_, err := Compile(fs, "main.ts")
+	if err == nil || !strings.Contains(err.Error(), "Undeclared identifier") {
+		t.Fatal(err)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import * as foo from "foo"
+
+		function main() {
+			foo.bar()
+		}
+	`))
+
+	fs.WritePath("foo.ts", []byte(`
+		function bar() {}
+	`))
+
+	_, err := Compile(fs, "main.ts")
+	if err == nil || !strings.Contains(err.Error(), "not exported") {
+		t.Fatal(err)
+	}
+}
+
+func TestModuleSameNames(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import * as foo from "bar"
+
+		export function sum() {
+			return 88
+		}
+
+		function main() {
+			return foo.bar()
+		}
+	`))
+
+	fs.WritePath("bar.ts", []byte(`
+		export function bar() {
+			return sum()
+		}
+		export function sum() {
+			return 3
+		}
+	`))
+
+	assertValueFS(t, fs, "main.ts", 3)
+}
+
+func TestInit0(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import * as lib1 from "libs/lib1"
+
+		export let v
+
+		function init() {
+			v = 1
+		}
+
+		function main() {
+			return v + lib1.v
+		}
+	`))
+
+	fs.WritePath("libs/lib1.ts", []byte(`		
+		export let v
+
+		function init() {
+			v = 2
+		}
+	`))
+
+	assertValueFS(t, fs, "main.ts", 3)
+}
+
+func TestInit1(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("main.ts", []byte(`
+		import * as lib1 from "libs/lib1"
+		import * as lib2 from "libs/lib2"
+
+		export let v
+
+		function init() {
+			v = 0
+		}
+
+		function main() {
+			return v + lib1.foo() + lib2.v
+		}
+	`))
+
+	fs.WritePath("libs/lib1.ts", []byte(`
+		import * as lib2 from "libs/lib2"
+		
+		export let v
+
+		function init() {
+			v = 1
+		}
+
+		export function foo() {
+			return v + lib2.v
+		}
+	`))
+
+	fs.WritePath("libs/lib2.ts", []byte(`		
+		export let v
+
+		function init() {
+			v = 2
+		}
+	`))
+
+	assertValueFS(t, fs, "main.ts", 5)
 }
 
 func TestParseInterface(t *testing.T) {
@@ -2286,702 +3528,1358 @@ func TestParseInterface(t *testing.T) {
 					{ a: number, b: number }
 				]
 			}
-		`)
+		`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGlobalScope(t *testing.T) {
+	fs := filesystem.NewMemFS()
+
+	fs.WritePath("global.ts", []byte(`
+		declare global {
+			const PI = 3
+		
+			enum Foo {
+				bar = 1
+			}
+		}	
+	`))
+
+	fs.WritePath("main.ts", []byte(`
+		import "global"
+
+		function main() {
+			return PI + Foo.bar
+		}
+	`))
+
+	assertValueFS(t, fs, "main.ts", 4)
+}
+
+func TestProgramPermissions1(t *testing.T) {
+	p, err := CompileStr(`
+		// [permissions foo]
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perm := p.Permissions()
+	if len(perm) != 1 {
+		t.Fatal(perm)
+	}
+
+	if perm[0] != "foo" {
+		t.Fatal(perm)
+	}
+
+	if !p.HasPermission("foo") {
+		t.Fatal(perm)
+	}
+
+	if p.HasPermission("bar") {
+		t.Fatal("Invalid perm")
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	p, err := CompileStr(`
+		// [anonymous]
+		export function index_GET(c: WebContext) {
+			c.response.write("Hello world!! \n")
+		}
+
+	`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Functions) != 2 {
+		t.Fatal()
+	}
+
+	//fmt.Println(p.Functions[1].Directives)
+
+}
+
+// func TestInline1(t *testing.T) {
+// 	assertInlineValue(t, 6000, `
+// 		function main() {
+// 			let v = 0
+// 			for(let i = 0; i < 1000; i++) {
+// 				v += bar() + bar()
+// 			}
+// 			return v
+// 		}
+
+// 		function bar() {
+// 			return 2 + 1
+// 		}
+// 	`)
+// }
+
+// func TestInline2(t *testing.T) {
+// 	assertInlineValue(t, 3, `
+// 		function main() {
+// 			return bar(1, 2)
+// 		}
+
+// 		function bar(a, b) {
+// 			return a + b
+// 		}
+// 	`)
+// }
+
+// func TestInline3(t *testing.T) {
+// 	assertInlineValue(t, 3000, `
+// 		function main() {
+// 			let v = 0
+// 			for(let i = 0; i < 1000; i++) {
+// 				v += bar(1, 2)
+// 			}
+// 			return v
+// 		}
+
+// 		function bar(a, b) {
+// 			return a + b
+// 		}
+// 	`)
+// }
+
+// func TestInline4(t *testing.T) {
+// 	assertInlineValue(t, 3, `
+// 		return bar(3)
+
+// 		function bar(a) {
+// 			return a
+// 		}
+// 	`)
+// }
+
+// func TestInline5(t *testing.T) {
+// 	assertInlineValue(t, 3, `
+// 		return bar(1, 2)
+
+// 		function bar(a, b) {
+// 			return a + b
+// 		}
+// 	`)
+// }
+
+// func TestInline6(t *testing.T) {
+// 	assertInlineValue(t, 103, `
+// 		let x = 100
+// 		let dummy = 33
+// 		let dummy2 = 33
+// 		let dummy3 = 33
+// 		let result = x + bar(1, 2)
+// 		let dummy4 = 33
+// 		let dummy5 = 33
+// 		return result
+
+// 		function bar(a, b) {
+// 			return a + b
+// 		}
+// 	`)
+// }
+
+// func TestInline7(t *testing.T) {
+// 	assertInlineValue(t, 103, `
+// 		function main() {
+// 			let x = 100
+// 			let dummy = 33
+// 			let dummy2 = 33
+// 			let result = x + bar(1, 2)
+// 			let dummy3 = 33
+// 			let dummy4 = 33
+// 			return result
+// 		}
+
+// 		function bar(a, b) {
+// 			let dummy = -70
+// 			let z = a + b
+// 			let dummy2 = -70
+// 			return z
+// 		}
+// 	`)
+// }
+
+// func TestInline8(t *testing.T) {
+// 	fs := filesystem.NewMemFS()
+// 	fs.WritePath("main.ts", []byte(`
+// 		import * as foo from "foo"
+
+// 		function main() {
+// 			return foo.bar()
+// 		}
+// 	`))
+
+// 	fs.WritePath("foo.ts", []byte(`
+// 		export function bar() {
+// 			return foo()
+// 		}
+
+// 		export function foo() {
+// 			return 5
+// 		}
+// 	`))
+
+// 	assertInlineFSValue(t, 5, fs)
+// }
+
+// func TestInlineOptionalParams1(t *testing.T) {
+// 	assertInlineValue(t, 3, `
+// 		return bar()
+
+// 		function bar(a?) {
+// 			return 3
+// 		}
+// 	`)
+// }
+
+func TestTailCall1(t *testing.T) {
+	assertInlineValue(t, 6, `
+		return fact(3)
+
+		function fact(n, a?) {
+			if(a == null) {
+				a = 1
+			}
+
+			if(n == 0) {
+				return a
+			}
+
+        	return fact(n - 1, n * a);
+		}
+	`)
+}
+
+func TestTailCall2(t *testing.T) {
+	assertInlineValue(t, 6, `
+		let a = 0
+		foo()
+		return a
+
+		function foo() {
+			a++
+			if(a > 5) {
+				return a
+			}			
+        	return foo()
+		}
+	`)
+}
+
+func assertNoCalls(t *testing.T, p *Program) {
+	// ignore the global func
+	for _, f := range p.Functions[1:] {
+		for i, instr := range f.Instructions {
+			switch instr.Opcode {
+			case op_cal, op_cas:
+				Print(p)
+				t.Fatalf("There is a call: %s, %d, %v", f.Name, i, instr)
+			}
+		}
+	}
+}
+
+func TestNativeFunc(t *testing.T) {
+	libs := []NativeFunction{
+		{
+			Name:      "math.square",
+			Arguments: 1,
+			Function: func(this Value, args []Value, vm *VM) (Value, error) {
+				v := args[0].ToInt()
+				return NewInt64(v * v), nil
+			},
+		},
+	}
+
+	assertNativeValue(t, libs, 4, `
+		function main() {
+			return math.square(2)
+		}
+	`)
+}
+
+func TestNativeProperty(t *testing.T) {
+	libs := []NativeFunction{
+		{
+			Name: "->math.pi",
+			Function: func(this Value, args []Value, vm *VM) (Value, error) {
+				return NewFloat(3.1416), nil
+			},
+		},
+	}
+
+	assertNativeValue(t, libs, 3.1416, `
+		function main() {
+			return math.pi
+		}
+	`)
+}
+
+func TestNativeObject(t *testing.T) {
+	libs := []NativeFunction{
+		{
+			Name: "tests.newObject",
+			Function: func(this Value, args []Value, vm *VM) (Value, error) {
+				return NewObject(obj{}), nil
+			},
+		},
+	}
+
+	assertNativeValue(t, libs, "Hi foo", `
+		function main() {
+			let obj = tests.newObject()
+			return obj.sayHi(obj.name)
+		}
+	`)
+}
+
+func TestNativeFuncError(t *testing.T) {
+	libs := []NativeFunction{
+		{
+			Name:      "math.square",
+			Arguments: 1,
+			Function: func(this Value, args []Value, vm *VM) (Value, error) {
+				return NullValue, fmt.Errorf("snap!")
+			},
+		},
+		{
+			Name:      "log.error",
+			Arguments: -1,
+			Function: func(this Value, args []Value, vm *VM) (Value, error) {
+				return NullValue, nil
+			},
+		},
+	}
+
+	assertNativeValue(t, libs, nil, `
+		function main() {
+			try {
+				math.square(2)				
+			} catch (error) {
+				log.error("asdfas", error)
+			}
+		}
+	`)
+}
+
+type obj struct{}
+
+func (d obj) GetProperty(key string, vm *VM) (Value, error) {
+	switch key {
+	case "name":
+		return NewString("foo"), nil
+	}
+	return UndefinedValue, nil
+}
+
+func (d obj) GetMethod(name string) NativeMethod {
+	switch name {
+	case "sayHi":
+		return d.sayHI
+	}
+	return nil
+}
+
+func (d obj) sayHI(args []Value, vm *VM) (Value, error) {
+	return NewString("Hi " + args[0].ToString()), nil
+}
+
+// func addPrintFunc() {
+// 	AddBuiltinFunc("print")
+// 	AddNativeFunc(NativeFunction{
+// 		Name:      "print",
+// 		Arguments: -1,
+// 		Function: func(this Value, args []Value, vm *VM) (Value, error) {
+// 			for _, v := range args {
+// 				var text string
+// 				switch v.Type {
+// 				case String, Int, Float, Bool:
+// 					text = v.ToString()
+// 				default:
+// 					b, err := json.MarshalIndent(v.Export(0), "", "    ")
+// 					if err != nil {
+// 						return NullValue, err
+// 					}
+// 					text = string(b)
+// 				}
+
+// 				fmt.Print(text)
+// 				fmt.Print(" ")
+// 			}
+// 			fmt.Print("\n")
+// 			return NullValue, nil
+// 		},
+// 	})
+// }
+
+func assertNativeValue(t *testing.T, funcs []NativeFunction, expected interface{}, code string) {
+	a, err := ParseStr(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompiler()
+
+	for _, f := range funcs {
+		AddNativeFunc(f)
+	}
+
+	p, err := c.Compile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVM(p)
+
+	// Print(p)
+	// vm.MaxSteps = 10
+
+	ret, err := vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewValue(expected)
+
+	if ret != v {
+		t.Fatalf("Expected %v %T, got %v %T", expected, expected, ret, ret)
+	}
+}
+
+func assertValueFS(t *testing.T, fs filesystem.FS, path string, expected interface{}) {
+	p, err := Compile(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Print(p)
+	// PrintNames(p, true)
+	// vm.MaxSteps = 50
+
+	vm := NewVM(p)
+
+	ret, err := vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewValue(expected)
+
+	if ret != v {
+		t.Fatalf("Expected %v %T, got %v %T", expected, expected, ret, ret)
+	}
+}
+
+func assertInlineValue(t *testing.T, expected interface{}, code string) {
+	a, err := ParseStr(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompiler()
+
+	p, err := c.Compile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertNoCalls(t, p)
+
+	// Print(p)
+
+	vm := NewVM(p)
+	vm.MaxSteps = 10000000
+
+	ret, err := vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != NewValue(expected) {
+		t.Fatalf("Expected %v %T, got %v", expected, expected, ret.ToString())
+	}
+}
+
+// func assertInlineFSValue(t *testing.T, expected interface{}, fs filesystem.FS) {
+// 	a, err := Parse(fs, "main.ts")
+// 	if err != nil {
+// 		t.Fatal(err)
+// 	}
+
+// 	c := NewCompiler()
+
+// 	p, err := c.Compile(a)
+// 	if err != nil {
+// 		t.Fatal(err)
+// 	}
+
+// 	assertNoCalls(t, p)
+
+// 	// Print(p)
+
+// 	vm := NewVM(p)
+// 	vm.MaxSteps = 10000000
+
+// 	ret, err := vm.Run()
+// 	if err != nil {
+// 		t.Fatal(err)
+// 	}
+
+// 	if ret != NewValue(expected) {
+// 		t.Fatalf("Expected %v %T, got %v", expected, expected, ret.ToString())
+// 	}
+// }
+
+func assertValue(t *testing.T, expected interface{}, code string) {
+	p := compileTest(t, code)
+	vm := NewVM(p)
+
+	// Print(p)
+	// vm.MaxSteps = 50
+
+	ret, err := vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ret != NewValue(expected) {
+		t.Fatalf("Expected %v %T, got %v", expected, expected, ret.ToString())
+	}
+}
+
+func assertRegister(t *testing.T, register string, expected interface{}, code string) {
+	p := compileTest(t, code)
+	vm := NewVM(p)
+
+	// Print(p)
+	// vm.MaxSteps = 50
+
+	_, err := vm.Run()
 	if err != nil {
 		t.Fatal(err)
 	}
-}
-
-func TestGlobalScope(t *testing.T) {
-	fs := filesystem.NewMemFS()
 
-	fs.WritePath("global.ts", []byte(`
-		declare global {
-			const PI = 3
-		
-			enum Foo {
-				bar = 1
-			}
-		}	
-	`))
+	v, _ := vm.RegisterValue(register)
 
-	fs.WritePath("main.ts", []byte(`
-		import "global"
+	if v != NewValue(expected) {
+		t.Fatalf("Expected %v, got %v", expected, v)
+	}
+}
 
-		function main() {
-			return PI + Foo.bar
-		}
-	`))
+func compileTest(t *testing.T, code string) *Program {
+	p, err := CompileStr(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
 
-	assertValueFS(t, fs, "main.ts", 4)
+func normalize(s string) string {
+	var reg = regexp.MustCompile(`\s+`)
+	s = reg.ReplaceAllString(s, ` `)
+	return s
 }
 
-func TestProgramPermissions1(t *testing.T) {
-	p, err := CompileStr(`
-		// [permissions foo]
-	`)
+func TestCopy(t *testing.T) {
+	p1, err := CompileStr(`
+	let a = 10
 
+	function init() {
+		a++
+	}
+
+	function foo() {
+		a++
+		return a
+	}`)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	perm := p.Permissions()
-	if len(perm) != 1 {
-		t.Fatal(perm)
-	}
+	p1 = p1.Copy()
 
-	if perm[0] != "foo" {
-		t.Fatal(perm)
+	vm := NewVM(p1)
+	if err := vm.Initialize(); err != nil {
+		t.Fatal(err)
 	}
 
-	if !p.HasPermission("foo") {
-		t.Fatal(perm)
+	v, err := vm.RunFunc("foo")
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if p.HasPermission("bar") {
-		t.Fatal("Invalid perm")
+	if v.ToInt() != 12 {
+		t.Fatal(v)
 	}
 }
 
-func TestDirectives(t *testing.T) {
+func TestEval0(t *testing.T) {
 	p, err := CompileStr(`
-		// [anonymous]
-		export function index_GET(c: WebContext) {
-			c.response.write("Hello world!! \n")
-		}
-
+		let a = 1
 	`)
+	assertError(t, "", err)
 
-	if err != nil {
+	vm := NewVM(p)
+	if _, err = vm.Run(); err != nil {
 		t.Fatal(err)
 	}
 
-	if len(p.Functions) != 2 {
-		t.Fatal()
+	g := vm.Globals()
+	if len(g) != 1 {
+		t.Fatal(g)
 	}
 
-	//fmt.Println(p.Functions[1].Directives)
+	if g[0].ToInt() != 1 {
+		t.Fatal(g)
+	}
 
-}
+	err = Eval(vm, `a++
+						foo()			
+						function foo() {
+							a++
+						}`)
 
-// func TestInline1(t *testing.T) {
-// 	assertInlineValue(t, 6000, `
-// 		function main() {
-// 			let v = 0
-// 			for(let i = 0; i < 1000; i++) {
-// 				v += bar() + bar()
-// 			}
-// 			return v
-// 		}
+	assertError(t, "", err)
+	err = Eval(vm, `
+	    let b = 20
+		b += 2
+		`)
 
-// 		function bar() {
-// 			return 2 + 1
-// 		}
-// 	`)
-// }
+	assertError(t, "", err)
 
-// func TestInline2(t *testing.T) {
-// 	assertInlineValue(t, 3, `
-// 		function main() {
-// 			return bar(1, 2)
-// 		}
+	g = vm.Globals()
+	if len(g) != 2 {
+		t.Fatal(g)
+	}
 
-// 		function bar(a, b) {
-// 			return a + b
-// 		}
-// 	`)
-// }
+	if g[0].ToInt() != 3 {
+		t.Fatal(g)
+	}
 
-// func TestInline3(t *testing.T) {
-// 	assertInlineValue(t, 3000, `
-// 		function main() {
-// 			let v = 0
-// 			for(let i = 0; i < 1000; i++) {
-// 				v += bar(1, 2)
-// 			}
-// 			return v
-// 		}
+	if g[1].ToInt() != 22 {
+		t.Fatal(g)
+	}
+}
 
-// 		function bar(a, b) {
-// 			return a + b
-// 		}
-// 	`)
-// }
+func TestEval2(t *testing.T) {
+	p, err := CompileStr(`
+		let a = 1
+	`)
+	assertError(t, "", err)
 
-// func TestInline4(t *testing.T) {
-// 	assertInlineValue(t, 3, `
-// 		return bar(3)
+	vm := NewVM(p)
+	if _, err = vm.Run(); err != nil {
+		t.Fatal(err)
+	}
 
-// 		function bar(a) {
-// 			return a
-// 		}
-// 	`)
-// }
+	err = Eval(vm, `let b = a`)
+	assertError(t, "", err)
 
-// func TestInline5(t *testing.T) {
-// 	assertInlineValue(t, 3, `
-// 		return bar(1, 2)
+	err = Eval(vm, `b = a / 0`)
+	assertError(t, "divide by zero", err)
 
-// 		function bar(a, b) {
-// 			return a + b
-// 		}
-// 	`)
-// }
+	err = Eval(vm, `b = a  + 1`)
+	assertError(t, "", err)
 
-// func TestInline6(t *testing.T) {
-// 	assertInlineValue(t, 103, `
-// 		let x = 100
-// 		let dummy = 33
-// 		let dummy2 = 33
-// 		let dummy3 = 33
-// 		let result = x + bar(1, 2)
-// 		let dummy4 = 33
-// 		let dummy5 = 33
-// 		return result
+	v, ok := vm.RegisterValue("b")
+	if !ok {
+		t.Fatal("b not found")
+	}
 
-// 		function bar(a, b) {
-// 			return a + b
-// 		}
-// 	`)
-// }
+	if v.ToInt() != 2 {
+		t.Fatal(v)
+	}
+}
 
-// func TestInline7(t *testing.T) {
-// 	assertInlineValue(t, 103, `
-// 		function main() {
-// 			let x = 100
-// 			let dummy = 33
-// 			let dummy2 = 33
-// 			let result = x + bar(1, 2)
-// 			let dummy3 = 33
-// 			let dummy4 = 33
-// 			return result
-// 		}
+func TestEval3(t *testing.T) {
+	p, err := CompileStr(`
+		let a = 1
+	`)
+	assertError(t, "", err)
 
-// 		function bar(a, b) {
-// 			let dummy = -70
-// 			let z = a + b
-// 			let dummy2 = -70
-// 			return z
-// 		}
-// 	`)
-// }
+	vm := NewVM(p)
+	if _, err = vm.Run(); err != nil {
+		t.Fatal(err)
+	}
 
-// func TestInline8(t *testing.T) {
-// 	fs := filesystem.NewMemFS()
-// 	fs.WritePath("main.ts", []byte(`
-// 		import * as foo from "foo"
+	err = Eval(vm, `let a = 1`)
+	assertError(t, "Redeclared identifier", err)
+}
 
-// 		function main() {
-// 			return foo.bar()
-// 		}
-// 	`))
+func assertError(t *testing.T, msg string, err error) {
+	if msg == "" {
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return
+	}
 
-// 	fs.WritePath("foo.ts", []byte(`
-// 		export function bar() {
-// 			return foo()
-// 		}
+	if !strings.Contains(err.Error(), msg) {
+		t.Fatalf("Expected %s, got %v", msg, err)
+	}
+}
 
-// 		export function foo() {
-// 			return 5
-// 		}
-// 	`))
+func TestConstantFolding(t *testing.T) {
+	assertValue(t, 86400, `
+		const DAY = 60 * 60 * 24
+		function main() {
+			return DAY
+		}
+	`)
 
-// 	assertInlineFSValue(t, 5, fs)
-// }
+	assertValue(t, 5, `
+		enum Flags {
+			a = 1,
+			b = 2,
+			c = 4
+		}
+		function main() {
+			return Flags.a | Flags.c
+		}
+	`)
 
-// func TestInlineOptionalParams1(t *testing.T) {
-// 	assertInlineValue(t, 3, `
-// 		return bar()
+	assertValue(t, "ab", `
+		function main() {
+			return "a" + "b"
+		}
+	`)
 
-// 		function bar(a?) {
-// 			return 3
-// 		}
-// 	`)
-// }
+	assertValue(t, 2.5, `
+		function main() {
+			return 5 / 2
+		}
+	`)
+}
 
-func TestTailCall1(t *testing.T) {
-	assertInlineValue(t, 6, `
-		return fact(3)
+func TestOptimizations(t *testing.T) {
+	code := `
+		function foo(a) {
+			if (a > 1) {
+				return 1
+				a++
+			}
+			throw "error"
+			return 3
+		}
 
-		function fact(n, a?) {
-			if(a == null) {
-				a = 1
+		function main() {
+			let s = 0
+			for (let i = 0; i < 10; i++) {
+				if (i % 2 == 0) {
+					continue
+				}
+				if (i > 7) {
+					break
+				}
+				s += i
 			}
 
-			if(n == 0) {
-				return a
+			try {
+				foo(0)
+			} catch {
+				s += 100
+			} finally {
+				s += 1000
 			}
 
-        	return fact(n - 1, n * a);
+			let o = { a: { b: 2 } } as any
+			s += o?.a?.b ?? 0
+			s += o?.c?.d ?? 0
+			return s + foo(2)
 		}
-	`)
-}
+	`
 
-func TestTailCall2(t *testing.T) {
-	assertInlineValue(t, 6, `
-		let a = 0
-		foo()
-		return a
+	defer func() { parser.Optimizations = true }()
 
-		function foo() {
-			a++
-			if(a > 5) {
-				return a
-			}			
-        	return foo()
+	var sizes []int
+	for _, opt := range []bool{false, true} {
+		parser.Optimizations = opt
+		p := compileTest(t, code)
+
+		f, ok := p.Function("foo")
+		if !ok {
+			t.Fatal("foo not found")
 		}
-	`)
-}
+		sizes = append(sizes, len(f.Instructions))
 
-func assertNoCalls(t *testing.T, p *Program) {
-	// ignore the global func
-	for _, f := range p.Functions[1:] {
-		for i, instr := range f.Instructions {
-			switch instr.Opcode {
-			case op_cal, op_cas:
-				Print(p)
-				t.Fatalf("There is a call: %s, %d, %v", f.Name, i, instr)
-			}
+		ret, err := NewVM(p).Run()
+		if err != nil {
+			t.Fatal(err)
 		}
+		if ret != NewValue(1119) {
+			t.Fatalf("Expected 1119, got %v", ret)
+		}
+	}
+
+	if sizes[1] >= sizes[0] {
+		t.Fatalf("Expected less instructions, got %d and %d", sizes[0], sizes[1])
 	}
 }
 
-func TestNativeFunc(t *testing.T) {
-	libs := []NativeFunction{
-		{
-			Name:      "math.square",
-			Arguments: 1,
-			Function: func(this Value, args []Value, vm *VM) (Value, error) {
-				v := args[0].ToInt()
-				return NewInt64(v * v), nil
-			},
-		},
+func TestUnboxedValues(t *testing.T) {
+	var v Value
+	allocs := testing.AllocsPerRun(100, func() {
+		v = NewInt64(1 << 40)
+		v = NewFloat(v.ToFloat() * 1.5)
+		v = NewBool(v.ToInt() > 0)
+		v = NewRune('x')
+	})
+
+	if allocs != 0 {
+		t.Fatalf("Expected no allocations, got %v", allocs)
 	}
 
-	assertNativeValue(t, libs, 4, `
+	if NewFloat(-0.5).ToFloat() != -0.5 || NewInt64(-3).ToInt() != -3 || NewRune('ñ').ToRune() != 'ñ' {
+		t.Fatal("Invalid conversion")
+	}
+
+	assertValue(t, 1099511627776, `
 		function main() {
-			return math.square(2)
+			let a = 1 << 39
+			return a + a
 		}
 	`)
 }
 
-func TestNativeProperty(t *testing.T) {
-	libs := []NativeFunction{
-		{
-			Name: "->math.pi",
-			Function: func(this Value, args []Value, vm *VM) (Value, error) {
-				return NewFloat(3.1416), nil
-			},
-		},
-	}
+func TestInlineCache(t *testing.T) {
+	// the same instructions read members of different classes
+	assertValue(t, "1-2-3-b-4-5", `
+		class A {
+			x = 1
+			get y() {
+				return 2
+			}
+			z() {
+				return 3
+			}
+		}
+
+		class B {
+			x = "b"
+			y = 4
+			z() {
+				return 5
+			}
+		}
+
+		function read(o) {
+			return o.x + "-" + o.y + "-" + o.z()
+		}
 
-	assertNativeValue(t, libs, 3.1416, `
 		function main() {
-			return math.pi
+			let a = new A()
+			let b = new B()
+			return read(a) + "-" + read(b)
 		}
 	`)
-}
 
-func TestNativeObject(t *testing.T) {
-	libs := []NativeFunction{
-		{
-			Name: "tests.newObject",
-			Function: func(this Value, args []Value, vm *VM) (Value, error) {
-				return NewObject(obj{}), nil
-			},
-		},
-	}
+	assertValue(t, 12, `
+		class A {
+			private _v = 0
+			set v(n) {
+				this._v = n * 2
+			}
+			get v() {
+				return this._v
+			}
+		}
+
+		class B {
+			v = 0
+		}
+
+		function set(o, n) {
+			o.v = n
+		}
 
-	assertNativeValue(t, libs, "Hi foo", `
 		function main() {
-			let obj = tests.newObject()
-			return obj.sayHi(obj.name)
+			let a = new A()
+			let b = new B()
+			set(a, 3)
+			set(b, 6)
+			set(a, b.v)
+			return a.v
 		}
 	`)
-}
 
-func TestNativeFuncError(t *testing.T) {
-	libs := []NativeFunction{
-		{
-			Name:      "math.square",
-			Arguments: 1,
-			Function: func(this Value, args []Value, vm *VM) (Value, error) {
-				return NullValue, fmt.Errorf("snap!")
-			},
-		},
-		{
-			Name:      "log.error",
-			Arguments: -1,
-			Function: func(this Value, args []Value, vm *VM) (Value, error) {
-				return NullValue, nil
-			},
-		},
+	p := compileTest(t, `
+		class A {
+			x = 1
+		}
+
+		class B {
+			private x = 2
+		}
+
+		function read(o) {
+			return o.x
+		}
+
+		function main() {
+			read(new A())
+			read(new B())
+		}
+	`)
+
+	_, err := NewVM(p).Run()
+	if err == nil || !strings.Contains(err.Error(), "private field") {
+		t.Fatal(err)
 	}
+}
 
-	assertNativeValue(t, libs, nil, `
+func TestRunContext(t *testing.T) {
+	// the cancellation can't be catched by the program
+	p := compileTest(t, `
 		function main() {
 			try {
-				math.square(2)				
-			} catch (error) {
-				log.error("asdfas", error)
+				while (true) { }
+			} catch (e) {
+				return 1
 			}
 		}
 	`)
-}
 
-type obj struct{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
 
-func (d obj) GetProperty(key string, vm *VM) (Value, error) {
-	switch key {
-	case "name":
-		return NewString("foo"), nil
+	vm := NewVM(p)
+	_, err := vm.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
 	}
-	return UndefinedValue, nil
 }
 
-func (d obj) GetMethod(name string) NativeMethod {
-	switch name {
-	case "sayHi":
-		return d.sayHI
+func TestRunFuncContext(t *testing.T) {
+	p := compileTest(t, `
+		function loop() {
+			while (true) { }
+		}
+
+		function sum(a, b) {
+			return a + b
+		}
+	`)
+
+	vm := NewVM(p)
+	if err := vm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := vm.RunFuncContext(ctx, "loop")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got %v", err)
+	}
+
+	// the vm can be reused after the cancellation
+	v, err := vm.RunFunc("sum", NewInt(1), NewInt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != NewInt(3) {
+		t.Fatalf("expected 3, got %v", v)
 	}
-	return nil
 }
 
-func (d obj) sayHI(args []Value, vm *VM) (Value, error) {
-	return NewString("Hi " + args[0].ToString()), nil
+type testFinalizer struct {
+	closed bool
 }
 
-// func addPrintFunc() {
-// 	AddBuiltinFunc("print")
-// 	AddNativeFunc(NativeFunction{
-// 		Name:      "print",
-// 		Arguments: -1,
-// 		Function: func(this Value, args []Value, vm *VM) (Value, error) {
-// 			for _, v := range args {
-// 				var text string
-// 				switch v.Type {
-// 				case String, Int, Float, Bool:
-// 					text = v.ToString()
-// 				default:
-// 					b, err := json.MarshalIndent(v.Export(0), "", "    ")
-// 					if err != nil {
-// 						return NullValue, err
-// 					}
-// 					text = string(b)
-// 				}
+func (f *testFinalizer) Close() error {
+	f.closed = true
+	return nil
+}
 
-// 				fmt.Print(text)
-// 				fmt.Print(" ")
-// 			}
-// 			fmt.Print("\n")
-// 			return NullValue, nil
-// 		},
-// 	})
-// }
+// the native functions are registered once so it's global
+var lastFinalizer *testFinalizer
+
+func TestDeadline(t *testing.T) {
+	AddNativeFunc(NativeFunction{
+		Name: "test.newFinalizable",
+		Function: func(this Value, args []Value, vm *VM) (Value, error) {
+			lastFinalizer = &testFinalizer{}
+			vm.SetFinalizer(lastFinalizer)
+			return NullValue, nil
+		},
+	})
+
+	p := compileTest(t, `
+		function main() {
+			run()
+		}
+
+		function run() {
+			test.newFinalizable()
+			while (true) { }
+		}
+	`)
+
+	vm := NewVM(p)
+	vm.Deadline = time.Now().Add(20 * time.Millisecond)
+
+	_, err := vm.Run()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
 
-func assertNativeValue(t *testing.T, funcs []NativeFunction, expected interface{}, code string) {
-	a, err := ParseStr(code)
-	if err != nil {
-		t.Fatal(err)
+	if lastFinalizer == nil || !lastFinalizer.closed {
+		t.Fatal("the finalizer was not executed")
 	}
+}
 
-	c := NewCompiler()
+func TestDebugger(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/main.ts", []byte(`function main() {
+	let a = 1
+	let b = add(a, 2)
+	return b
+}
 
-	for _, f := range funcs {
-		AddNativeFunc(f)
-	}
+function add(x, y) {
+	let z = x + y
+	return z
+}
+`))
 
-	p, err := c.Compile(a)
+	p, err := Compile(fs, "/main.ts")
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	vm := NewVM(p)
+	d := NewDebugger(vm)
 
-	// Print(p)
-	// vm.MaxSteps = 10
+	stops := make(chan StopReason)
+	d.OnStop = func(reason StopReason) {
+		stops <- reason
+	}
 
-	ret, err := vm.Run()
-	if err != nil {
-		t.Fatal(err)
+	bps := []*Breakpoint{{Line: 3}}
+	d.SetBreakpoints(p.Files[0], bps)
+	if !bps[0].Verified {
+		t.Fatal("the breakpoint was not verified")
 	}
 
-	v := NewValue(expected)
+	done := make(chan error)
+	go func() {
+		_, err := vm.Run()
+		done <- err
+	}()
 
-	if ret != v {
-		t.Fatalf("Expected %v %T, got %v %T", expected, expected, ret, ret)
-	}
-}
+	assertStop(t, d, stops, StopBreakpoint, "main", 3)
+	assertLocal(t, d, "a", NewInt(1))
 
-func assertValueFS(t *testing.T, fs filesystem.FS, path string, expected interface{}) {
-	p, err := Compile(fs, path)
+	d.StepIn()
+	assertStop(t, d, stops, StopStep, "add", 8)
+	assertLocal(t, d, "y", NewInt(2))
+
+	frames, _ := d.Stack()
+	v, err := d.Evaluate(frames[0].Index, "x * 10 + y")
 	if err != nil {
 		t.Fatal(err)
 	}
+	if v != NewInt(12) {
+		t.Fatalf("expected 12, got %v", v)
+	}
 
-	// Print(p)
-	// PrintNames(p, true)
-	// vm.MaxSteps = 50
+	d.StepOver()
+	assertStop(t, d, stops, StopStep, "add", 9)
+	assertLocal(t, d, "z", NewInt(3))
 
-	vm := NewVM(p)
+	d.StepOut()
+	assertStop(t, d, stops, StopStep, "main", 4)
+	assertLocal(t, d, "b", NewInt(3))
 
-	ret, err := vm.Run()
-	if err != nil {
+	d.Continue()
+	if err := <-done; err != nil {
 		t.Fatal(err)
 	}
+}
 
-	v := NewValue(expected)
-
-	if ret != v {
-		t.Fatalf("Expected %v %T, got %v %T", expected, expected, ret, ret)
+func TestDebuggerCondition(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/main.ts", []byte(`function main() {
+	let total = 0
+	for (let i = 0; i < 5; i++) {
+		total += i
 	}
+	return total
 }
+`))
 
-func assertInlineValue(t *testing.T, expected interface{}, code string) {
-	a, err := ParseStr(code)
+	p, err := Compile(fs, "/main.ts")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	c := NewCompiler()
+	vm := NewVM(p)
+	d := NewDebugger(vm)
 
-	p, err := c.Compile(a)
-	if err != nil {
-		t.Fatal(err)
+	stops := make(chan StopReason)
+	d.OnStop = func(reason StopReason) {
+		stops <- reason
 	}
 
-	assertNoCalls(t, p)
+	d.SetBreakpoints(p.Files[0], []*Breakpoint{{Line: 4, Condition: "i == 3"}})
 
-	// Print(p)
+	done := make(chan error)
+	go func() {
+		_, err := vm.Run()
+		done <- err
+	}()
 
-	vm := NewVM(p)
-	vm.MaxSteps = 10000000
+	assertStop(t, d, stops, StopBreakpoint, "main", 4)
+	assertLocal(t, d, "i", NewInt(3))
+	assertLocal(t, d, "total", NewInt(3))
 
-	ret, err := vm.Run()
-	if err != nil {
+	d.Continue()
+	if err := <-done; err != nil {
 		t.Fatal(err)
 	}
-
-	if ret != NewValue(expected) {
-		t.Fatalf("Expected %v %T, got %v", expected, expected, ret.ToString())
-	}
 }
 
-// func assertInlineFSValue(t *testing.T, expected interface{}, fs filesystem.FS) {
-// 	a, err := Parse(fs, "main.ts")
-// 	if err != nil {
-// 		t.Fatal(err)
-// 	}
-
-// 	c := NewCompiler()
-
-// 	p, err := c.Compile(a)
-// 	if err != nil {
-// 		t.Fatal(err)
-// 	}
-
-// 	assertNoCalls(t, p)
+func assertStop(t *testing.T, d *Debugger, stops chan StopReason, reason StopReason, function string, line int) {
+	t.Helper()
 
-// 	// Print(p)
-
-// 	vm := NewVM(p)
-// 	vm.MaxSteps = 10000000
+	select {
+	case r := <-stops:
+		if r != reason {
+			t.Fatalf("expected to stop by %s, got %s", reason, r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the debugger didn't stop")
+	}
 
-// 	ret, err := vm.Run()
-// 	if err != nil {
-// 		t.Fatal(err)
-// 	}
+	frames, err := d.Stack()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-// 	if ret != NewValue(expected) {
-// 		t.Fatalf("Expected %v %T, got %v", expected, expected, ret.ToString())
-// 	}
-// }
+	f := frames[0]
+	if f.Function != function || f.Line != line {
+		t.Fatalf("expected to stop at %s:%d, got %s:%d", function, line, f.Function, f.Line)
+	}
+}
 
-func assertValue(t *testing.T, expected interface{}, code string) {
-	p := compileTest(t, code)
-	vm := NewVM(p)
+func assertLocal(t *testing.T, d *Debugger, name string, expected Value) {
+	t.Helper()
 
-	// Print(p)
-	// vm.MaxSteps = 50
+	frames, err := d.Stack()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	ret, err := vm.Run()
+	locals, err := d.Locals(frames[0].Index)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if ret != NewValue(expected) {
-		t.Fatalf("Expected %v %T, got %v", expected, expected, ret.ToString())
+	for _, v := range locals {
+		if v.Name == name {
+			if v.Value != expected {
+				t.Fatalf("expected %s to be %v, got %v", name, expected, v.Value)
+			}
+			return
+		}
 	}
+
+	t.Fatalf("local %s not found", name)
 }
 
-func assertRegister(t *testing.T, register string, expected interface{}, code string) {
-	p := compileTest(t, code)
+func TestProfiler(t *testing.T) {
+	p := compileTest(t, `
+		function fib(n) {
+			if (n < 2) {
+				return n
+			}
+			return fib(n - 1) + fib(n - 2)
+		}
+
+		function main() {
+			return fib(15)
+		}
+	`)
+
 	vm := NewVM(p)
 
-	// Print(p)
-	// vm.MaxSteps = 50
+	prof := NewProfiler()
+	prof.Period = 10
 
-	_, err := vm.Run()
-	if err != nil {
+	if err := vm.StartProfile(prof); err != nil {
 		t.Fatal(err)
 	}
 
-	v, _ := vm.RegisterValue(register)
-
-	if v != NewValue(expected) {
-		t.Fatalf("Expected %v, got %v", expected, v)
+	if err := vm.StartProfile(NewProfiler()); err != ErrProfiling {
+		t.Fatalf("expected ErrProfiling, got %v", err)
 	}
-}
 
-func compileTest(t *testing.T, code string) *Program {
-	p, err := CompileStr(code)
-	if err != nil {
+	if _, err := vm.Run(); err != nil {
 		t.Fatal(err)
 	}
-	return p
-}
 
-func normalize(s string) string {
-	var reg = regexp.MustCompile(`\s+`)
-	s = reg.ReplaceAllString(s, ` `)
-	return s
-}
+	if vm.StopProfile() != prof {
+		t.Fatal("expected the same profiler")
+	}
 
-func TestCopy(t *testing.T) {
-	p1, err := CompileStr(`
-	let a = 10
+	if len(prof.samples) == 0 {
+		t.Fatal("no samples")
+	}
 
-	function init() {
-		a++
+	for _, s := range prof.samples {
+		if len(s.locations) == 0 {
+			t.Fatal("expected a call stack")
+		}
 	}
 
-	function foo() {
-		a++
-		return a
-	}`)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := prof.Write(&buf); err != nil {
 		t.Fatal(err)
 	}
 
-	p1 = p1.Copy()
-
-	vm := NewVM(p1)
-	if err := vm.Initialize(); err != nil {
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	v, err := vm.RunFunc("foo")
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if v.ToInt() != 12 {
-		t.Fatal(v)
+	for _, s := range []string{"fib", "main", "wall", "nanoseconds"} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Fatalf("expected %s in the profile", s)
+		}
 	}
 }
 
-func TestEval0(t *testing.T) {
-	p, err := CompileStr(`
-		let a = 1
-	`)
-	assertError(t, "", err)
+func TestCoverage(t *testing.T) {
+	fs := filesystem.NewMemFS()
+	fs.WritePath("/main.ts", []byte(`function sign(n) {
+	if (n < 0) {
+		return -1
+	}
+	return 1
+}
 
-	vm := NewVM(p)
-	if _, err = vm.Run(); err != nil {
+function unused() {
+	return 0
+}
+
+function main() {
+	sign(1)
+	sign(2)
+}
+`))
+
+	p, err := Compile(fs, "main.ts")
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	g := vm.Globals()
-	if len(g) != 1 {
-		t.Fatal(g)
-	}
+	c := NewCoverage()
 
-	if g[0].ToInt() != 1 {
-		t.Fatal(g)
+	// the coverage of both executions is merged
+	for i := 0; i < 2; i++ {
+		vm := NewVM(p)
+		vm.SetCoverage(c)
+		if _, err := vm.Run(); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	err = Eval(vm, `a++
-						foo()			
-						function foo() {
-							a++
-						}`)
-
-	assertError(t, "", err)
-	err = Eval(vm, `
-	    let b = 20
-		b += 2
-		`)
+	files := c.Files()
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
 
-	assertError(t, "", err)
+	f := files[0]
 
-	g = vm.Globals()
-	if len(g) != 2 {
-		t.Fatal(g)
+	for line, hits := range map[int]int64{2: 4, 3: 0, 5: 4, 9: 0, 13: 2} {
+		if f.Lines[line] != hits {
+			t.Fatalf("line %d: expected %d, got %d", line, hits, f.Lines[line])
+		}
 	}
 
-	if g[0].ToInt() != 3 {
-		t.Fatal(g)
+	if len(f.Branches) != 1 {
+		t.Fatalf("expected 1 branch, got %d", len(f.Branches))
 	}
 
-	if g[1].ToInt() != 22 {
-		t.Fatal(g)
+	b := f.Branches[0]
+	if b.Line != 2 || !b.Executed || b.Jumped != 4 || b.NotJumped != 0 {
+		t.Fatalf("unexpected branch %+v", b)
 	}
-}
-
-func TestEval2(t *testing.T) {
-	p, err := CompileStr(`
-		let a = 1
-	`)
-	assertError(t, "", err)
 
-	vm := NewVM(p)
-	if _, err = vm.Run(); err != nil {
+	var lcov bytes.Buffer
+	if err := c.WriteLCOV(&lcov); err != nil {
 		t.Fatal(err)
 	}
 
-	err = Eval(vm, `let b = a`)
-	assertError(t, "", err)
-
-	err = Eval(vm, `b = a / 0`)
-	assertError(t, "divide by zero", err)
+	for _, s := range []string{"FNDA:4,sign", "FNDA:0,unused", "BRDA:2,0,0,0", "BRDA:2,0,1,4", "DA:3,0", "end_of_record"} {
+		if !strings.Contains(lcov.String(), s) {
+			t.Fatalf("expected %s in:\n%s", s, lcov.String())
+		}
+	}
 
-	err = Eval(vm, `b = a  + 1`)
-	assertError(t, "", err)
+	var html bytes.Buffer
+	if err := c.WriteHTML(&html, fs); err != nil {
+		t.Fatal(err)
+	}
 
-	v, ok := vm.RegisterValue("b")
-	if !ok {
-		t.Fatal("b not found")
+	for _, s := range []string{`class="partial"`, `class="uncovered"`, "return -1"} {
+		if !strings.Contains(html.String(), s) {
+			t.Fatalf("expected %s in the report", s)
+		}
 	}
+}
 
-	if v.ToInt() != 2 {
-		t.Fatal(v)
+func TestAddressRange(t *testing.T) {
+	for _, v := range []int{0, -1, maxAddrValue, minAddrValue} {
+		a := NewAddress(AddrConstant, v)
+		if a.Kind() != AddrConstant || int(a.Value()) != v {
+			t.Fatalf("expected %d, got %v", v, a)
+		}
 	}
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "address out of range") {
+			t.Fatalf("expected an out of range panic, got %v", r)
+		}
+	}()
+
+	NewAddress(AddrLocal, maxAddrValue+1)
 }
 
-func TestEval3(t *testing.T) {
-	p, err := CompileStr(`
+func TestCompileTooBig(t *testing.T) {
+	a, err := parser.ParseStr(`
 		let a = 1
+		let b = 2
 	`)
-	assertError(t, "", err)
-
-	vm := NewVM(p)
-	if _, err = vm.Run(); err != nil {
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = Eval(vm, `let a = 1`)
-	assertError(t, "Redeclared identifier", err)
-}
-
-func assertError(t *testing.T, msg string, err error) {
-	if msg == "" {
-		if err != nil {
-			t.Fatalf("Expected no error, got: %v", err)
-		}
-		return
-	}
+	// simulate a program with more globals than an address can encode
+	c := NewCompiler()
+	c.globalFunc.registerTop = maxAddrValue
 
-	if !strings.Contains(err.Error(), msg) {
-		t.Fatalf("Expected %s, got %v", msg, err)
+	_, err = c.Compile(a)
+	if err == nil || !strings.Contains(err.Error(), "the program is too big") {
+		t.Fatalf("expected a compile error, got %v", err)
 	}
 }